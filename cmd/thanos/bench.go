@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/bench"
+	"github.com/improbable-eng/thanos/pkg/objstore/client"
+	"github.com/improbable-eng/thanos/pkg/store/storepb"
+	"github.com/oklog/run"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"google.golang.org/grpc"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func registerBench(m map[string]setupFunc, app *kingpin.Application, name string) {
+	cmd := app.Command(name, "generate synthetic blocks in a test bucket and benchmark Series requests against store API servers")
+
+	objstoreConfig := client.RegisterParams(cmd)
+	cmd.Flag("gcs-bucket", "Google Cloud Storage bucket name for stored blocks.").
+		PlaceHolder("<bucket>").StringVar(&objstoreConfig.GCSBucket)
+
+	gen := cmd.Command("generate", "generate blocks with synthetic series and upload them to the bucket")
+	genLabels := gen.Flag("label", "External labels of the generated blocks (repeated).").
+		Default(`bench="synthetic"`).PlaceHolder("<name>=\"<value>\"").Strings()
+	genBlocks := gen.Flag("blocks", "Number of consecutive blocks. The last block ends at the current time, aligned to the block duration.").
+		Default("12").Int()
+	genBlockDuration := gen.Flag("block-duration", "Time range of each block.").
+		Default("2h").Duration()
+	genSeries := gen.Flag("series", "Number of series in each block.").
+		Default("10000").Int()
+	genChurn := gen.Flag("churn", "Fraction of series replaced by new series from one block to the next.").
+		Default("0.1").Float64()
+	genScrapeInterval := gen.Flag("scrape-interval", "Time between two samples of a series.").
+		Default("15s").Duration()
+	genSamplesPerChunk := gen.Flag("samples-per-chunk", "Maximum number of samples in a chunk.").
+		Default("120").Int()
+	genTmpDir := gen.Flag("tmp-dir", "Directory in which blocks are created.").
+		Default(os.TempDir()).String()
+	genDryRun := gen.Flag("dry-run", "Only create blocks without uploading them.").
+		Default("false").Bool()
+	m[name+" generate"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		extLset, err := parseFlagLabels(*genLabels)
+		if err != nil {
+			return errors.Wrap(err, "parse labels")
+		}
+
+		dir, err := ioutil.TempDir(*genTmpDir, "bench-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		dur := int64(*genBlockDuration / time.Millisecond)
+		maxt := timestamp.FromTime(time.Now())
+		maxt -= maxt % dur
+
+		ctx := context.Background()
+		ids, err := bench.GenerateBlocks(ctx, logger, dir, bench.BlockConfig{
+			Blocks:          *genBlocks,
+			BlockDuration:   *genBlockDuration,
+			MinTime:         maxt - int64(*genBlocks)*dur,
+			Series:          *genSeries,
+			Churn:           *genChurn,
+			ScrapeInterval:  *genScrapeInterval,
+			SamplesPerChunk: *genSamplesPerChunk,
+			Labels:          extLset,
+		})
+		if err != nil {
+			return errors.Wrap(err, "generate blocks")
+		}
+
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer closeFn()
+
+		for _, id := range ids {
+			if err := uploadBlock(ctx, logger, bkt, filepath.Join(dir, id.String()), extLset, 0, *genDryRun, false); err != nil {
+				return errors.Wrapf(err, "upload block %s", id)
+			}
+		}
+		return nil
+	}
+
+	series := cmd.Command("series", "run concurrent Series requests and report their latency and the memory usage of the process")
+	seriesStore := series.Flag("store", "Address of the store API server to benchmark. If empty, a store gateway serving the bucket is run in-process, so its memory usage is included in the report.").
+		PlaceHolder("<host:port>").String()
+	seriesSelector := series.Flag("selector", "Series selector of the requests.").
+		Default(bench.MetricName).String()
+	seriesMinTime := series.Flag("min-time", "Start of the requested time range in milliseconds since epoch.").
+		Default(strconv.FormatInt(math.MinInt64, 10)).Int64()
+	seriesMaxTime := series.Flag("max-time", "End of the requested time range in milliseconds since epoch.").
+		Default(strconv.FormatInt(math.MaxInt64, 10)).Int64()
+	seriesConcurrency := series.Flag("concurrency", "Number of requests in flight at any time.").
+		Default("10").Int()
+	seriesRequests := series.Flag("requests", "Total number of requests.").
+		Default("100").Int()
+	seriesDataDir := series.Flag("data-dir", "Data directory of the in-process store gateway.").
+		Default("./data").String()
+	seriesIndexCacheSize := series.Flag("index-cache-size", "Maximum size of items held in the index cache of the in-process store gateway.").
+		Default("250MB").Bytes()
+	seriesChunkPoolSize := series.Flag("chunk-pool-size", "Maximum size of concurrently allocatable bytes for chunks of the in-process store gateway.").
+		Default("2GB").Bytes()
+	seriesMaxConcurrent := series.Flag("store.grpc.series-max-concurrency", "Maximum number of Series requests processed concurrently by the in-process store gateway. 0 means no limit.").
+		Default("20").Int()
+	m[name+" series"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		matchers, err := bench.ParseSelector(*seriesSelector)
+		if err != nil {
+			return errors.Wrap(err, "parse selector")
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		ctx := context.Background()
+
+		var storeClient storepb.StoreClient
+		if *seriesStore != "" {
+			conn, err := grpc.DialContext(ctx, *seriesStore, grpc.WithInsecure())
+			if err != nil {
+				return errors.Wrapf(err, "dial %s", *seriesStore)
+			}
+			defer conn.Close()
+			storeClient = storepb.NewStoreClient(conn)
+		} else {
+			bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
+			if err != nil {
+				return err
+			}
+			defer closeFn()
+
+			c, stop, err := bench.ServeBucketStore(ctx, logger, reg, bkt, bench.BucketStoreConfig{
+				Dir:                 *seriesDataDir,
+				IndexCacheSizeBytes: uint64(*seriesIndexCacheSize),
+				ChunkPoolSizeBytes:  uint64(*seriesChunkPoolSize),
+				MaxConcurrentSeries: *seriesMaxConcurrent,
+			})
+			if err != nil {
+				return err
+			}
+			defer stop()
+			storeClient = c
+		}
+
+		level.Info(logger).Log("msg", "running series benchmark", "requests", *seriesRequests, "concurrency", *seriesConcurrency)
+		res, err := bench.RunSeries(ctx, logger, storeClient, bench.SeriesConfig{
+			Concurrency: *seriesConcurrency,
+			Requests:    *seriesRequests,
+			MinTime:     *seriesMinTime,
+			MaxTime:     *seriesMaxTime,
+			Matchers:    matchers,
+		})
+		if err != nil {
+			return err
+		}
+		return res.Print(os.Stdout)
+	}
+}
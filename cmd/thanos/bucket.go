@@ -2,67 +2,96 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 	"text/template"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/backfill"
 	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/compact"
+	"github.com/improbable-eng/thanos/pkg/compact/downsample"
+	"github.com/improbable-eng/thanos/pkg/extprom"
+	"github.com/improbable-eng/thanos/pkg/objstore"
 	"github.com/improbable-eng/thanos/pkg/objstore/client"
-	"github.com/improbable-eng/thanos/pkg/objstore/s3"
+	"github.com/improbable-eng/thanos/pkg/objstore/filesystem"
+	"github.com/improbable-eng/thanos/pkg/query/ui"
+	"github.com/improbable-eng/thanos/pkg/replicate"
+	"github.com/improbable-eng/thanos/pkg/runutil"
 	"github.com/improbable-eng/thanos/pkg/verifier"
 	"github.com/oklog/run"
 	"github.com/oklog/ulid"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/config"
+	promlabels "github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/relabel"
+	"github.com/prometheus/tsdb/labels"
 	"gopkg.in/alecthomas/kingpin.v2"
-)
-
-var (
-	issuesMap = map[string]verifier.Issue{
-		verifier.IndexIssueID:                verifier.IndexIssue,
-		verifier.OverlappedBlocksIssueID:     verifier.OverlappedBlocksIssue,
-		verifier.DuplicatedCompactionIssueID: verifier.DuplicatedCompactionIssue,
-	}
-	allIssues = func() (s []string) {
-		for id := range issuesMap {
-			s = append(s, id)
-		}
-		return s
-	}
+	yaml "gopkg.in/yaml.v2"
 )
 
 func registerBucket(m map[string]setupFunc, app *kingpin.Application, name string) {
 	cmd := app.Command(name, "inspect metric data in an object storage bucket")
 
-	gcsBucket := cmd.Flag("gcs-bucket", "Google Cloud Storage bucket name for stored blocks.").
-		PlaceHolder("<bucket>").String()
-
-	s3Config := s3.RegisterS3Params(cmd)
+	objstoreConfig := client.RegisterParams(cmd)
+	cmd.Flag("gcs-bucket", "Google Cloud Storage bucket name for stored blocks.").
+		PlaceHolder("<bucket>").StringVar(&objstoreConfig.GCSBucket)
 
 	// Verify command.
 	verify := cmd.Command("verify", "verify all blocks in the bucket against specified issues")
 	verifyRepair := verify.Flag("repair", "attempt to repair blocks for which issues were detected").
 		Short('r').Default("false").Bool()
-	// NOTE(bplotka): Currently we support backup buckets only in the same project.
-	verifyBackupGCSBucket := cmd.Flag("gcs-backup-bucket", "Google Cloud Storage bucket name to backup blocks on repair operations.").
-		PlaceHolder("<bucket>").String()
-	verifyBackupS3Bucket := cmd.Flag("s3-backup-bucket", "S3 bucket name to backup blocks on repair operations.").
+	// The backup bucket is configured by its own flags only. Buckets of providers that need more than a name are
+	// configured by the YAML configuration.
+	verifyBackupGCSBucket := cmd.Flag("gcs-backup-bucket", "Google Cloud Storage bucket name to backup blocks to before they are deleted by repair or cleanup operations.").
 		PlaceHolder("<bucket>").String()
-	verifyIssues := verify.Flag("issues", fmt.Sprintf("Issues to verify (and optionally repair). Possible values: %v", allIssues())).
-		Short('i').Default(verifier.IndexIssueID, verifier.OverlappedBlocksIssueID).Strings()
+	verifyBackupFilesystemDir := cmd.Flag("filesystem-backup-dir", "Local directory to backup blocks to before they are deleted by repair or cleanup operations.").
+		PlaceHolder("<dir>").String()
+	verifyBackupConfigFile := cmd.Flag("objstore-backup.config-file", "Path to YAML file with the object storage configuration of the bucket to backup blocks to before they are deleted by repair or cleanup operations.").
+		PlaceHolder("<objstore-backup.config-yaml-path>").String()
+	verifyBackupConfig := cmd.Flag("objstore-backup.config", "Alternative to 'objstore-backup.config-file' flag. Object storage configuration of the backup bucket in YAML.").
+		PlaceHolder("<objstore-backup.config-yaml>").String()
+	// backupObjstoreConfig does not inherit the provider configuration, prefix, read-only mode or encryption of the
+	// bucket, so blocks can be backed up to a different account or endpoint. Only retries are shared.
+	backupObjstoreConfig := func() client.Config {
+		return client.Config{
+			Providers: client.Providers{
+				GCSBucket:  *verifyBackupGCSBucket,
+				Filesystem: filesystem.Config{Directory: *verifyBackupFilesystemDir},
+			},
+			ConfigFile:    *verifyBackupConfigFile,
+			ConfigContent: *verifyBackupConfig,
+			Retry:         objstoreConfig.Retry,
+		}
+	}
+	verifyOutput := registerOutputFlag(verify)
+	verifyIssues := verify.Flag("issues", fmt.Sprintf("Issues to verify (and optionally repair). Possible values: %v", verifier.DefaultRegistry.IDs())).
+		Short('i').Default(verifier.MissingMetaIssueID, verifier.IndexKnownIssuesID, verifier.OverlappedBlocksIssueID).Enums(verifier.DefaultRegistry.IDs()...)
 	m[name+" verify"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
-		bkt, closeFn, err := client.NewBucket(gcsBucket, *s3Config, reg, name)
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
 		if err != nil {
 			return err
 		}
 
-		backupS3Config := *s3Config
-		backupS3Config.Bucket = *verifyBackupS3Bucket
-		backupBkt, backupCloseFn, err := client.NewBucket(verifyBackupGCSBucket, backupS3Config, reg, name)
+		backupBkt, backupCloseFn, err := client.NewBucket(backupObjstoreConfig(), reg, name)
 		if err == client.ErrNotFound {
 			if *verifyRepair {
 				return errors.Wrap(err, "repair is specified, so backup client is required")
@@ -80,34 +109,35 @@ func registerBucket(m map[string]setupFunc, app *kingpin.Application, name strin
 		defer closeFn()
 		defer backupCloseFn()
 
-		var (
-			ctx    = context.Background()
-			v      *verifier.Verifier
-			issues []verifier.Issue
-		)
-
-		for _, i := range *verifyIssues {
-			issueFn, ok := issuesMap[i]
-			if !ok {
-				return errors.Errorf("no such issue name %s", i)
-			}
-			issues = append(issues, issueFn)
+		issues, err := verifier.DefaultRegistry.Get(*verifyIssues...)
+		if err != nil {
+			return err
 		}
 
+		var v *verifier.Verifier
 		if *verifyRepair {
 			v = verifier.NewWithRepair(logger, bkt, backupBkt, issues)
 		} else {
 			v = verifier.New(logger, bkt, issues)
 		}
 
-		return v.Verify(ctx)
+		findings, err := v.Verify(context.Background())
+		if err != nil {
+			return err
+		}
+		return printFindings(os.Stdout, *verifyOutput, findings)
 	}
 
-	ls := cmd.Command("ls", "list all blocks in the bucket")
-	lsOutput := ls.Flag("output", "Format in which to print each block's information. May be 'json' or custom template.").
-		Short('o').Default("").String()
-	m[name+" ls"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
-		bkt, closeFn, err := client.NewBucket(gcsBucket, *s3Config, reg, name)
+	inspect := cmd.Command("inspect", "inspect all blocks in the bucket summarized per compaction group")
+	inspectCols := inspect.Flag("column", fmt.Sprintf("Columns to print (repeated). Possible values: %v", inspectColumnNames())).
+		Short('c').Default(inspectColumnNames()...).Enums(inspectColumnNames()...)
+	inspectSortBy := inspect.Flag("sort-by", "Columns to sort groups by (repeated). Earlier columns take precedence.").
+		Short('s').Default(inspectColumnGroup).Enums(inspectColumnNames()...)
+	inspectReverse := inspect.Flag("reverse", "Sort groups in descending order.").
+		Default("false").Bool()
+	inspectOutput := registerOutputFlag(inspect)
+	m[name+" inspect"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
 		if err != nil {
 			return err
 		}
@@ -120,53 +150,1781 @@ func registerBucket(m map[string]setupFunc, app *kingpin.Application, name strin
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 		defer cancel()
 
-		var (
-			format     = *lsOutput
-			printBlock func(id ulid.ULID) error
-		)
+		metas, err := downloadMetas(ctx, logger, bkt)
+		if err != nil {
+			return err
+		}
 
-		switch format {
-		case "":
-			printBlock = func(id ulid.ULID) error {
-				fmt.Fprintln(os.Stdout, id.String())
-				return nil
-			}
-		case "json":
-			enc := json.NewEncoder(os.Stdout)
-			enc.SetIndent("", "\t")
+		summaries := summarizeGroups(metas)
+		if err := sortGroupSummaries(summaries, *inspectSortBy, *inspectReverse); err != nil {
+			return err
+		}
+		switch *inspectOutput {
+		case outputJSON:
+			return printGroupSummariesJSON(os.Stdout, summaries)
+		case outputCSV:
+			return printGroupSummariesCSV(os.Stdout, summaries)
+		}
+		return printGroupSummaries(os.Stdout, summaries, *inspectCols)
+	}
 
-			printBlock = func(id ulid.ULID) error {
-				m, err := block.DownloadMeta(ctx, bkt, id)
+	web := cmd.Command("web", "web interface showing the blocks of the bucket on a timeline")
+	webHTTPAddr := web.Flag("http-address", "Listen host:port for HTTP endpoints.").
+		Default(defaultHTTPAddr).String()
+	webRefresh := web.Flag("refresh", "Refresh interval to download metadata from the bucket.").
+		Default("30m").Duration()
+	webTimeout := web.Flag("timeout", "Timeout to download metadata from the bucket.").
+		Default("5m").Duration()
+	m[name+" web"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
+		if err != nil {
+			return err
+		}
+
+		bucketUI := ui.NewBucketUI(logger, *webRefresh)
+
+		router := route.New()
+		bucketUI.Register(router)
+
+		mux := http.NewServeMux()
+		registerMetrics(mux, reg)
+		registerProfile(mux)
+		mux.Handle("/", router)
+
+		l, err := net.Listen("tcp", *webHTTPAddr)
+		if err != nil {
+			closeFn()
+			return errors.Wrapf(err, "listen on address %s", *webHTTPAddr)
+		}
+
+		g.Add(func() error {
+			return errors.Wrap(http.Serve(l, mux), "serve web")
+		}, func(error) {
+			l.Close()
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			defer closeFn()
+
+			return runutil.Repeat(*webRefresh, ctx.Done(), func() error {
+				level.Debug(logger).Log("msg", "refreshing bucket metas")
+
+				tctx, tcancel := context.WithTimeout(ctx, *webTimeout)
+				defer tcancel()
+
+				metas, err := downloadMetas(tctx, logger, bkt)
 				if err != nil {
-					return err
+					level.Error(logger).Log("msg", "refreshing bucket metas failed", "err", err)
+					bucketUI.Set(nil, err)
+					return nil
 				}
-				return enc.Encode(&m)
+
+				blocks := make([]block.Meta, 0, len(metas))
+				for _, m := range metas {
+					blocks = append(blocks, *m)
+				}
+				bucketUI.Set(blocks, nil)
+				return nil
+			})
+		}, func(error) {
+			cancel()
+		})
+
+		level.Info(logger).Log("msg", "starting bucket web", "address", *webHTTPAddr)
+		return nil
+	}
+
+	repl := cmd.Command("replicate", "replicate blocks matching the given filters into another bucket")
+	replicateHTTPAddr := repl.Flag("http-address", "Listen host:port for HTTP endpoints.").
+		Default(defaultHTTPAddr).String()
+	replicateToGCSBucket := repl.Flag("to-gcs-bucket", "Google Cloud Storage bucket name to replicate blocks into.").
+		PlaceHolder("<bucket>").String()
+	replicateToS3Bucket := repl.Flag("to-s3-bucket", "S3 bucket name to replicate blocks into.").
+		PlaceHolder("<bucket>").String()
+	replicateToAzureContainer := repl.Flag("to-azure-container", "Azure Blob Storage container name to replicate blocks into.").
+		PlaceHolder("<container>").String()
+	replicateToSwiftContainer := repl.Flag("to-swift-container", "Swift container name to replicate blocks into.").
+		PlaceHolder("<container>").String()
+	replicateToOSSBucket := repl.Flag("to-oss-bucket", "OSS bucket name to replicate blocks into.").
+		PlaceHolder("<bucket>").String()
+	replicateToFilesystemDir := repl.Flag("to-filesystem-dir", "Local directory to replicate blocks into.").
+		PlaceHolder("<dir>").String()
+	replicateToPrefix := repl.Flag("to-prefix", "Prefix of all objects in the bucket to replicate blocks into.").
+		PlaceHolder("<prefix>").String()
+	replicateToConfigFile := repl.Flag("to-objstore.config-file", "Path to YAML file with the object storage configuration of the bucket to replicate blocks into.").
+		PlaceHolder("<to-objstore.config-yaml-path>").String()
+	replicateToConfig := repl.Flag("to-objstore.config", "Alternative to 'to-objstore.config-file' flag. Object storage configuration of the bucket to replicate blocks into in YAML.").
+		PlaceHolder("<to-objstore.config-yaml>").String()
+	replicateMatcher := repl.Flag("matcher", "Only replicate blocks whose external labels match the given selector, e.g. {cluster=\"eu1\"}.").
+		String()
+	replicateResolutions := repl.Flag("resolution", "Only replicate blocks of the given resolutions (repeated).").
+		Default("0s", "5m", "1h").DurationList()
+	replicateLevels := repl.Flag("compaction", "Only replicate blocks of the given compaction levels (repeated). All levels by default.").
+		Ints()
+	replicateMinTime := repl.Flag("min-time", "Only replicate blocks overlapping with or after the given RFC3339 time.").
+		String()
+	replicateMaxTime := repl.Flag("max-time", "Only replicate blocks overlapping with or before the given RFC3339 time.").
+		String()
+	replicateWait := repl.Flag("wait", "Do not exit after all blocks have been replicated and keep replicating new blocks.").
+		Short('w').Bool()
+	replicateInterval := repl.Flag("interval", "Interval between replication runs when --wait is specified.").
+		Default("5m").Duration()
+	replicateStateFile := repl.Flag("state-file", "Path to a local file in which replicated blocks are recorded, so a restarted replication skips them. Disabled if empty.").
+		PlaceHolder("<path>").String()
+	m[name+" replicate"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		filter, err := parseReplicateFilter(*replicateMatcher, *replicateResolutions, *replicateLevels, *replicateMinTime, *replicateMaxTime)
+		if err != nil {
+			return err
+		}
+
+		// Source and target may be prefixes of the same bucket, so their metrics are labeled apart.
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, extprom.WrapRegistererWith(prometheus.Labels{"role": "source"}, reg), name)
+		if err != nil {
+			return err
+		}
+
+		toObjstoreConfig := *objstoreConfig
+		toObjstoreConfig.GCSBucket = *replicateToGCSBucket
+		toObjstoreConfig.S3.Bucket = *replicateToS3Bucket
+		toObjstoreConfig.Azure.Container = *replicateToAzureContainer
+		toObjstoreConfig.Swift.ContainerName = *replicateToSwiftContainer
+		toObjstoreConfig.OSS.Bucket = *replicateToOSSBucket
+		toObjstoreConfig.Filesystem = filesystem.Config{Directory: *replicateToFilesystemDir}
+		toObjstoreConfig.Prefix = *replicateToPrefix
+		toObjstoreConfig.ConfigFile = *replicateToConfigFile
+		toObjstoreConfig.ConfigContent = *replicateToConfig
+		toBkt, toCloseFn, err := client.NewBucket(toObjstoreConfig, extprom.WrapRegistererWith(prometheus.Labels{"role": "target"}, reg), name)
+		if err != nil {
+			closeFn()
+			if err == client.ErrNotFound {
+				return errors.Wrap(err, "target bucket for replication is required")
 			}
-		default:
-			tmpl, err := template.New("").Parse(format)
-			if err != nil {
-				return errors.Wrap(err, "invalid template")
+			return err
+		}
+
+		var state *replicate.State
+		if *replicateStateFile != "" {
+			if state, err = replicate.LoadState(*replicateStateFile); err != nil {
+				closeFn()
+				toCloseFn()
+				return err
 			}
-			printBlock = func(id ulid.ULID) error {
-				m, err := block.DownloadMeta(ctx, bkt, id)
-				if err != nil {
-					return err
-				}
+			level.Info(logger).Log("msg", "loaded replication state", "replicated", state.Len())
+		}
 
-				if err := tmpl.Execute(os.Stdout, &m); err != nil {
-					return errors.Wrap(err, "execute template")
+		r := replicate.New(logger, reg, bkt, toBkt, filter, state)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			defer closeFn()
+			defer toCloseFn()
+
+			if !*replicateWait {
+				return r.Replicate(ctx)
+			}
+			return runutil.Repeat(*replicateInterval, ctx.Done(), func() error {
+				if err := r.Replicate(ctx); err != nil {
+					// Partially replicated blocks are picked up again in the next run.
+					level.Error(logger).Log("msg", "replication failed", "err", err)
 				}
-				fmt.Fprintln(os.Stdout, "")
 				return nil
+			})
+		}, func(error) {
+			cancel()
+		})
+
+		mux := http.NewServeMux()
+		registerMetrics(mux, reg)
+		registerProfile(mux)
+
+		l, err := net.Listen("tcp", *replicateHTTPAddr)
+		if err != nil {
+			return errors.Wrapf(err, "listen on address %s", *replicateHTTPAddr)
+		}
+
+		g.Add(func() error {
+			return errors.Wrap(http.Serve(l, mux), "serve replicate")
+		}, func(error) {
+			l.Close()
+		})
+
+		level.Info(logger).Log("msg", "starting bucket replication")
+		return nil
+	}
+
+	rewrite := cmd.Command("rewrite", "rewrite blocks deleting or relabeling series and mark the original blocks for deletion")
+	rewriteIDs := rewrite.Flag("id", "ID (ULID) of the block to rewrite (repeated).").
+		Required().Strings()
+	rewriteDelete := rewrite.Flag("delete", "Series selector of series to delete from the blocks (repeated), e.g. {__name__=\"secret\"}.").
+		Strings()
+	rewriteRelabelConfigFile := rewrite.Flag("relabel-config-file", "Path to YAML file with a list of relabel configs applied to all series. Series dropped by the relabeling are deleted, series with equal labels after relabeling are merged.").
+		PlaceHolder("<path>").String()
+	rewriteLabels := rewrite.Flag("label", "External labels replacing the ones of the rewritten blocks (repeated).").
+		PlaceHolder("<name>=\"<value>\"").Strings()
+	rewriteTmpDir := rewrite.Flag("tmp-dir", "Directory in which blocks are downloaded and rewritten.").
+		Default(os.TempDir()).String()
+	rewriteDryRun := rewrite.Flag("dry-run", "Rewrite blocks locally only without uploading them or marking the originals for deletion.").
+		Default("false").Bool()
+	m[name+" rewrite"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		var ids []ulid.ULID
+		for _, s := range *rewriteIDs {
+			id, err := ulid.Parse(s)
+			if err != nil {
+				return errors.Wrapf(err, "parse block ID %s", s)
 			}
+			ids = append(ids, id)
 		}
 
-		return bkt.Iter(ctx, "", func(name string) error {
-			id, ok := block.IsBlockDir(name)
+		modifier, err := seriesModifier(*rewriteDelete, *rewriteRelabelConfigFile)
+		if err != nil {
+			return err
+		}
+		extLset, err := parseFlagLabels(*rewriteLabels)
+		if err != nil {
+			return errors.Wrap(err, "parse labels")
+		}
+		if modifier == nil && len(extLset) == 0 {
+			return errors.New("nothing to rewrite; specify series to delete, relabel config or labels")
+		}
+
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer closeFn()
+
+		ctx := context.Background()
+		for _, id := range ids {
+			if err := rewriteBlock(ctx, logger, bkt, *rewriteTmpDir, id, modifier, extLset, *rewriteDryRun); err != nil {
+				return errors.Wrapf(err, "rewrite block %s", id)
+			}
+		}
+		return nil
+	}
+
+	downsampleCmd := cmd.Command("downsample", "downsample a single block and upload the downsampled block")
+	downsampleID := downsampleCmd.Flag("id", "ID (ULID) of the block to downsample.").
+		Required().String()
+	downsampleResolution := downsampleCmd.Flag("resolution", "Resolution to downsample the block to. Defaults to the resolution of the next downsampling level.").
+		Default("0s").Duration()
+	downsampleTmpDir := downsampleCmd.Flag("tmp-dir", "Directory in which the block is downloaded and downsampled.").
+		Default(os.TempDir()).String()
+	downsampleForce := downsampleCmd.Flag("force", "Downsample the block even if blocks of the resolution already hold all of its data.").
+		Default("false").Bool()
+	downsampleLevels := registerDownsampleLevelsFlag(downsampleCmd)
+	m[name+" downsample"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		id, err := ulid.Parse(*downsampleID)
+		if err != nil {
+			return errors.Wrapf(err, "parse block ID %s", *downsampleID)
+		}
+		levels, err := downsample.ParseLevels(*downsampleLevels)
+		if err != nil {
+			return err
+		}
+
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer closeFn()
+
+		resolution := int64(*downsampleResolution / time.Millisecond)
+		if err := downsampleBlock(context.Background(), logger, bkt, *downsampleTmpDir, id, levels, resolution, *downsampleForce); err != nil {
+			return errors.Wrapf(err, "downsample block %s", id)
+		}
+		return nil
+	}
+
+	upload := cmd.Command("upload", "validate locally created blocks, set their external labels if missing and upload them to the bucket")
+	uploadDirs := upload.Arg("dir", "Block directories to upload. Directory names must be the block IDs (ULIDs).").
+		Required().ExistingDirs()
+	uploadLabels := upload.Flag("label", "External labels of the blocks (repeated). Required for blocks without external labels, e.g. created by Prometheus or a backfill.").
+		PlaceHolder("<name>=\"<value>\"").Strings()
+	uploadResolution := upload.Flag("resolution", "Resolution of the samples set for blocks without external labels. 0s for raw data.").
+		Default("0s").Duration()
+	uploadDryRun := upload.Flag("dry-run", "Only validate blocks without modifying or uploading them.").
+		Default("false").Bool()
+	uploadResume := upload.Flag("resume", "Record uploaded files in the block directories, so a failed upload is resumed by running the command again instead of being restarted. Partial blocks are kept in the bucket on failure.").
+		Default("false").Bool()
+	m[name+" upload"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		extLset, err := parseFlagLabels(*uploadLabels)
+		if err != nil {
+			return errors.Wrap(err, "parse labels")
+		}
+
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer closeFn()
+
+		ctx := context.Background()
+		for _, dir := range *uploadDirs {
+			if err := uploadBlock(ctx, logger, bkt, dir, extLset, int64(*uploadResolution/time.Millisecond), *uploadDryRun, *uploadResume); err != nil {
+				return errors.Wrapf(err, "upload block %s", dir)
+			}
+		}
+		return nil
+	}
+
+	imp := cmd.Command("import", "create blocks from historical data in the Prometheus text exposition format and upload them to the bucket")
+	importFiles := imp.Arg("file", "Files with samples in the text exposition format. All samples must have timestamps.").
+		Required().ExistingFiles()
+	importLabels := imp.Flag("label", "External labels of the created blocks (repeated).").
+		Required().PlaceHolder("<name>=\"<value>\"").Strings()
+	importBlockDuration := imp.Flag("block-duration", "Time range of the created blocks. Blocks are aligned to it.").
+		Default("2h").Duration()
+	importTmpDir := imp.Flag("tmp-dir", "Directory in which blocks are created.").
+		Default(os.TempDir()).String()
+	importDryRun := imp.Flag("dry-run", "Only create and validate blocks without uploading them.").
+		Default("false").Bool()
+	m[name+" import"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		extLset, err := parseFlagLabels(*importLabels)
+		if err != nil {
+			return errors.Wrap(err, "parse labels")
+		}
+
+		importer := backfill.NewImporter(logger, *importBlockDuration)
+		for _, fn := range *importFiles {
+			b, err := ioutil.ReadFile(fn)
+			if err != nil {
+				return errors.Wrapf(err, "read %s", fn)
+			}
+			n, err := importer.Parse(b)
+			if err != nil {
+				return errors.Wrapf(err, "parse %s", fn)
+			}
+			level.Info(logger).Log("msg", "parsed samples", "file", fn, "samples", n)
+		}
+
+		dir, err := ioutil.TempDir(*importTmpDir, "import-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		ids, err := importer.WriteBlocks(dir, extLset)
+		if err != nil {
+			return errors.Wrap(err, "create blocks")
+		}
+
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer closeFn()
+
+		ctx := context.Background()
+		for _, id := range ids {
+			if err := uploadBlock(ctx, logger, bkt, filepath.Join(dir, id.String()), extLset, 0, *importDryRun, false); err != nil {
+				return errors.Wrapf(err, "upload block %s", id)
+			}
+		}
+		return nil
+	}
+
+	mark := cmd.Command("mark", "add or remove deletion, no-compact or no-downsample marks of blocks")
+	markIDs := mark.Flag("id", "ID (ULID) of the block to mark (repeated).").
+		Required().Strings()
+	markMarker := mark.Flag("marker", "Marker to add or remove.").
+		Required().Enum(block.DeletionMarkFilename, block.NoCompactMarkFilename, block.NoDownsampleMarkFilename)
+	markDetails := mark.Flag("details", "Human readable reason of the mark. Required when adding a mark.").
+		String()
+	markNoCompactReason := mark.Flag("no-compact-reason", "Reason of excluding the block from compaction. Only used when adding a no-compact mark.").
+		Default(string(block.ManualNoCompactReason)).
+		Enum(string(block.ManualNoCompactReason), string(block.OutOfOrderChunksNoCompactReason))
+	markRemove := mark.Flag("remove", "Remove the marker instead of adding it.").
+		Default("false").Bool()
+	m[name+" mark"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		var ids []ulid.ULID
+		for _, s := range *markIDs {
+			id, err := ulid.Parse(s)
+			if err != nil {
+				return errors.Wrapf(err, "parse block ID %s", s)
+			}
+			ids = append(ids, id)
+		}
+		if !*markRemove && *markDetails == "" {
+			return errors.New("--details is required when adding a mark")
+		}
+
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer closeFn()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		for _, id := range ids {
+			ok, err := bkt.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+			if err != nil {
+				return errors.Wrapf(err, "check meta file for %s", id)
+			}
 			if !ok {
-				return nil
+				return errors.Errorf("block %s not found in the bucket", id)
 			}
-			return printBlock(id)
-		})
+
+			if *markRemove {
+				err = block.RemoveMark(ctx, logger, bkt, id, *markMarker)
+			} else {
+				err = markBlock(ctx, logger, bkt, id, *markMarker, block.NoCompactReason(*markNoCompactReason), *markDetails)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "mark block %s", id)
+			}
+		}
+		return nil
+	}
+
+	cleanup := cmd.Command("cleanup", "delete blocks marked for deletion and leftovers of aborted uploads")
+	cleanupDeleteDelay := cleanup.Flag("delete-delay", "Time after which blocks marked for deletion are deleted from the bucket.").
+		Default("48h").Duration()
+	cleanupPartialUploadThreshold := cleanup.Flag("partial-upload-threshold", "Age after which blocks without meta file are considered aborted uploads and deleted.").
+		Default("48h").Duration()
+	cleanupDryRun := cleanup.Flag("dry-run", "Only report blocks which would be deleted.").
+		Default("false").Bool()
+	m[name+" cleanup"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
+		if err != nil {
+			return err
+		}
+
+		backupBkt, backupCloseFn, err := client.NewBucket(backupObjstoreConfig(), reg, name)
+		if err == client.ErrNotFound {
+			// Backup bucket is optional for cleanup.
+			backupBkt = nil
+			backupCloseFn = func() error { return nil }
+		} else if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer closeFn()
+		defer backupCloseFn()
+
+		if backupBkt == nil {
+			level.Warn(logger).Log("msg", "no backup bucket configured, deleted blocks cannot be restored")
+		}
+		stats, err := compact.Cleanup(context.Background(), logger, bkt, backupBkt, *cleanupDeleteDelay, *cleanupPartialUploadThreshold, *cleanupDryRun)
+		if err != nil {
+			return errors.Wrap(err, "cleanup")
+		}
+		level.Info(logger).Log("msg", "cleanup done", "dryRun", *cleanupDryRun,
+			"deletedBlocks", stats.DeletedBlocks,
+			"pendingDeletions", stats.PendingDeletions,
+			"partialUploads", stats.PartialUploads,
+			"deletedObjects", stats.DeletedObjects,
+			"deletedBytes", stats.DeletedBytes)
+		return nil
+	}
+
+	retention := cmd.Command("retention", "mark blocks older than the retention of their resolution for deletion")
+	retentionFlags := registerRetentionFlags(retention)
+	retentionSelector := retention.Flag("selector", "Only apply retention to blocks whose external labels match the given selector, e.g. {cluster=\"eu1\"}.").
+		String()
+	retentionDryRun := retention.Flag("dry-run", "Only report blocks which would be marked for deletion.").
+		Default("false").Bool()
+	m[name+" retention"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		retentionByResolution, err := retentionFlags.byResolution()
+		if err != nil {
+			return err
+		}
+
+		var matchers []*promlabels.Matcher
+		if *retentionSelector != "" {
+			matchers, err = promql.ParseMetricSelector(*retentionSelector)
+			if err != nil {
+				return errors.Wrapf(err, "parse selector %s", *retentionSelector)
+			}
+		}
+
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer closeFn()
+
+		ctx := context.Background()
+		metas, err := downloadMetas(ctx, logger, bkt)
+		if err != nil {
+			return err
+		}
+
+		var selected []*block.Meta
+		for _, m := range metas {
+			if matchesAll(promlabels.FromMap(m.Thanos.Labels), matchers) {
+				selected = append(selected, m)
+			}
+		}
+
+		n, err := compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, selected, retentionByResolution, *retentionDryRun)
+		if err != nil {
+			return errors.Wrap(err, "apply retention")
+		}
+		level.Info(logger).Log("msg", "retention applied; marked blocks are deleted by the cleanup command", "blocks", len(selected), "marked", n, "dryRun", *retentionDryRun)
+		return nil
+	}
+
+	downsampleStatusCmd := cmd.Command("downsample-status", "report time ranges per compaction group that are not downsampled yet")
+	downsampleStatusOutput := registerOutputFlag(downsampleStatusCmd)
+	downsampleStatusLevels := registerDownsampleLevelsFlag(downsampleStatusCmd)
+	m[name+" downsample-status"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		levels, err := downsample.ParseLevels(*downsampleStatusLevels)
+		if err != nil {
+			return err
+		}
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer closeFn()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		metas, err := downloadMetas(ctx, logger, bkt)
+		if err != nil {
+			return err
+		}
+		return printDownsampleGaps(os.Stdout, *downsampleStatusOutput, downsampleStatus(metas, levels))
+	}
+
+	analyze := cmd.Command("analyze", "analyze the index of a single block and print its cardinality statistics")
+	analyzeID := analyze.Flag("id", "ID (ULID) of the block to analyze.").
+		Required().String()
+	analyzeLimit := analyze.Flag("limit", "Number of entries to print per statistic.").
+		Default("20").Int()
+	analyzeTmpDir := analyze.Flag("tmp-dir", "Directory in which the block index is downloaded.").
+		Default(os.TempDir()).String()
+	analyzeOutput := registerOutputFlag(analyze)
+	m[name+" analyze"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		id, err := ulid.Parse(*analyzeID)
+		if err != nil {
+			return errors.Wrapf(err, "parse block ID %s", *analyzeID)
+		}
+
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer closeFn()
+
+		dir, err := ioutil.TempDir(*analyzeTmpDir, fmt.Sprintf("analyze-block-%s-", id))
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		ctx := context.Background()
+		meta, err := block.DownloadMeta(ctx, bkt, id)
+		if err != nil {
+			return err
+		}
+		fn := filepath.Join(dir, block.IndexFilename)
+		if err := objstore.DownloadFile(ctx, bkt, path.Join(id.String(), block.IndexFilename), fn); err != nil {
+			return errors.Wrapf(err, "download index of block %s", id)
+		}
+
+		a, err := block.AnalyzeIndex(fn, *analyzeLimit)
+		if err != nil {
+			return errors.Wrapf(err, "analyze block %s", id)
+		}
+		return printIndexAnalysis(os.Stdout, *analyzeOutput, &meta, a)
+	}
+
+	churn := cmd.Command("churn", "compare series of consecutive blocks of a compaction group and report churn per metric name")
+	churnGroup := churn.Flag("group", "Key of the compaction group to analyze as printed by the inspect command, e.g. 0@{cluster=\"eu1\"}.").
+		Required().String()
+	churnMaxBlocks := churn.Flag("max-blocks", "Maximum number of the most recent blocks of the group to compare.").
+		Default("5").Int()
+	churnLimit := churn.Flag("limit", "Number of entries to print per statistic.").
+		Default("10").Int()
+	churnTmpDir := churn.Flag("tmp-dir", "Directory in which the block indexes are downloaded.").
+		Default(os.TempDir()).String()
+	churnOutput := registerOutputFlag(churn)
+	m[name+" churn"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer closeFn()
+
+		ctx := context.Background()
+		metas, err := downloadMetas(ctx, logger, bkt)
+		if err != nil {
+			return err
+		}
+		blocks := consecutiveBlocks(metas, *churnGroup, *churnMaxBlocks)
+		if len(blocks) < 2 {
+			return errors.Errorf("group %s has less than two consecutive blocks", *churnGroup)
+		}
+
+		dir, err := ioutil.TempDir(*churnTmpDir, "churn-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		var (
+			prevIndex string
+			records   []churnRecord
+		)
+		for i, m := range blocks {
+			fn := filepath.Join(dir, m.ULID.String()+"-"+block.IndexFilename)
+			if err := objstore.DownloadFile(ctx, bkt, path.Join(m.ULID.String(), block.IndexFilename), fn); err != nil {
+				return errors.Wrapf(err, "download index of block %s", m.ULID)
+			}
+			if i > 0 {
+				a, err := block.AnalyzeChurn(prevIndex, fn, *churnLimit)
+				if err != nil {
+					return errors.Wrapf(err, "analyze churn between %s and %s", blocks[i-1].ULID, m.ULID)
+				}
+				records = append(records, churnRecord{
+					Prev:        blocks[i-1].ULID,
+					PrevMinTime: blocks[i-1].MinTime,
+					Next:        m.ULID,
+					NextMinTime: m.MinTime,
+					Churn:       a,
+				})
+
+				// Only the index of the previous block is needed for the next comparison.
+				if err := os.Remove(prevIndex); err != nil {
+					return err
+				}
+			}
+			prevIndex = fn
+		}
+		return printChurnAnalyses(os.Stdout, *churnOutput, records)
+	}
+
+	ls := cmd.Command("ls", "list all blocks in the bucket")
+	lsOutput := ls.Flag("output", "Format in which to print each block's information. May be 'json', 'csv' or custom template.").
+		Short('o').Default("").String()
+	m[name+" ls"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer) error {
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, name)
+		if err != nil {
+			return err
+		}
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		defer closeFn()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		var (
+			format     = *lsOutput
+			printBlock func(id ulid.ULID) error
+		)
+
+		switch format {
+		case "":
+			printBlock = func(id ulid.ULID) error {
+				fmt.Fprintln(os.Stdout, id.String())
+				return nil
+			}
+		case outputCSV:
+			cw := csv.NewWriter(os.Stdout)
+			defer cw.Flush()
+
+			if err := cw.Write(blockCSVHeader); err != nil {
+				return err
+			}
+			printBlock = func(id ulid.ULID) error {
+				m, err := block.DownloadMeta(ctx, bkt, id)
+				if err != nil {
+					return err
+				}
+				return cw.Write(blockCSVRecord(&m))
+			}
+		case outputJSON:
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "\t")
+
+			printBlock = func(id ulid.ULID) error {
+				m, err := block.DownloadMeta(ctx, bkt, id)
+				if err != nil {
+					return err
+				}
+				return enc.Encode(&m)
+			}
+		default:
+			tmpl, err := template.New("").Parse(format)
+			if err != nil {
+				return errors.Wrap(err, "invalid template")
+			}
+			printBlock = func(id ulid.ULID) error {
+				m, err := block.DownloadMeta(ctx, bkt, id)
+				if err != nil {
+					return err
+				}
+
+				if err := tmpl.Execute(os.Stdout, &m); err != nil {
+					return errors.Wrap(err, "execute template")
+				}
+				fmt.Fprintln(os.Stdout, "")
+				return nil
+			}
+		}
+
+		return bkt.Iter(ctx, "", func(name string) error {
+			id, ok := block.IsBlockDir(name)
+			if !ok {
+				return nil
+			}
+			return printBlock(id)
+		})
+	}
+}
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+)
+
+// registerOutputFlag registers the output format flag of a reporting command. The structure of
+// json and csv outputs is documented in docs/components/bucket.md and must be kept stable.
+func registerOutputFlag(cmd *kingpin.CmdClause) *string {
+	return cmd.Flag("output", "Output format. The structure of json and csv output is stable and suitable for processing by other tools.").
+		Short('o').Default(outputTable).Enum(outputTable, outputJSON, outputCSV)
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(v)
+}
+
+func printCSV(w io.Writer, header []string, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	return cw.WriteAll(rows)
+}
+
+func printFindings(w io.Writer, output string, findings []verifier.Finding) error {
+	var rows [][]string
+	for _, f := range findings {
+		var ids []string
+		for _, id := range f.Blocks {
+			ids = append(ids, id.String())
+		}
+		rows = append(rows, []string{f.Issue, f.Group, strings.Join(ids, " "), f.Details})
+	}
+
+	switch output {
+	case outputJSON:
+		if findings == nil {
+			findings = []verifier.Finding{}
+		}
+		return printJSON(w, findings)
+	case outputCSV:
+		return printCSV(w, []string{"issue", "group", "blocks", "details"}, rows)
+	}
+
+	if len(findings) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ISSUE\tGROUP\tBLOCKS\tDETAILS")
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	return tw.Flush()
+}
+
+var blockCSVHeader = []string{"id", "labels", "resolution", "level", "min_time", "max_time", "series", "samples", "chunks"}
+
+func blockCSVRecord(m *block.Meta) []string {
+	return []string{
+		m.ULID.String(),
+		labels.FromMap(m.Thanos.Labels).String(),
+		strconv.FormatInt(m.Thanos.Downsample.Resolution, 10),
+		strconv.Itoa(m.Compaction.Level),
+		strconv.FormatInt(m.MinTime, 10),
+		strconv.FormatInt(m.MaxTime, 10),
+		strconv.FormatUint(m.Stats.NumSeries, 10),
+		strconv.FormatUint(m.Stats.NumSamples, 10),
+		strconv.FormatUint(m.Stats.NumChunks, 10),
+	}
+}
+
+// markBlock adds the marker with the given filename to the block. The no-compact reason is only used for no-compact marks.
+func markBlock(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, marker string, noCompactReason block.NoCompactReason, details string) error {
+	switch marker {
+	case block.DeletionMarkFilename:
+		return block.MarkForDeletion(ctx, logger, bkt, id, details)
+	case block.NoCompactMarkFilename:
+		return block.MarkForNoCompact(ctx, logger, bkt, id, noCompactReason, details)
+	case block.NoDownsampleMarkFilename:
+		return block.MarkForNoDownsample(ctx, logger, bkt, id, details)
+	}
+	return errors.Errorf("unknown marker %s", marker)
+}
+
+// seriesModifier returns a modifier deleting series matching any of the given selectors and
+// relabeling the remaining ones with the relabel configs of the given file.
+// It returns nil if there is nothing to modify.
+func seriesModifier(deleteSelectors []string, relabelConfigFile string) (block.SeriesModifier, error) {
+	var matcherSets [][]*promlabels.Matcher
+	for _, s := range deleteSelectors {
+		matchers, err := promql.ParseMetricSelector(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse selector %s", s)
+		}
+		matcherSets = append(matcherSets, matchers)
+	}
+
+	var relabelConfigs []*config.RelabelConfig
+	if relabelConfigFile != "" {
+		b, err := ioutil.ReadFile(relabelConfigFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read relabel config file")
+		}
+		if err := yaml.Unmarshal(b, &relabelConfigs); err != nil {
+			return nil, errors.Wrap(err, "parse relabel config file")
+		}
+	}
+
+	if len(matcherSets) == 0 && len(relabelConfigs) == 0 {
+		return nil, nil
+	}
+
+	return func(lset labels.Labels) labels.Labels {
+		plset := labelsTSDBToProm(lset)
+		for _, matchers := range matcherSets {
+			if matchesAll(plset, matchers) {
+				return nil
+			}
+		}
+		if len(relabelConfigs) == 0 {
+			return lset
+		}
+		return block.LabelsPromToTSDB(relabel.Process(plset, relabelConfigs...))
+	}, nil
+}
+
+func matchesAll(lset promlabels.Labels, matchers []*promlabels.Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// rewriteBlock downloads the block, rewrites it with the given modifier and external labels,
+// uploads the result and marks the original block for deletion.
+func rewriteBlock(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.Bucket,
+	tmpDir string,
+	id ulid.ULID,
+	modifier block.SeriesModifier,
+	extLset labels.Labels,
+	dryRun bool,
+) error {
+	dir, err := ioutil.TempDir(tmpDir, fmt.Sprintf("rewrite-block-%s-", id))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := block.Download(ctx, bkt, id, filepath.Join(dir, id.String())); err != nil {
+		return errors.Wrap(err, "download block")
+	}
+	meta, err := block.ReadMetaFile(filepath.Join(dir, id.String()))
+	if err != nil {
+		return err
+	}
+
+	resid, err := block.Rewrite(dir, id, modifier)
+	if err != nil {
+		return err
+	}
+	resdir := filepath.Join(dir, resid.String())
+
+	resmeta, err := block.ReadMetaFile(resdir)
+	if err != nil {
+		return err
+	}
+	if len(extLset) > 0 {
+		resmeta.Thanos.Labels = extLset.Map()
+		if err := block.WriteMetaFile(resdir, resmeta); err != nil {
+			return err
+		}
+	}
+	if err := block.VerifyIndex(filepath.Join(resdir, block.IndexFilename), resmeta.MinTime, resmeta.MaxTime); err != nil {
+		return errors.Wrapf(err, "rewritten block %s is invalid", resid)
+	}
+
+	level.Info(logger).Log("msg", "rewrote block", "id", id, "newID", resid,
+		"series", meta.Stats.NumSeries, "newSeries", resmeta.Stats.NumSeries,
+		"samples", meta.Stats.NumSamples, "newSamples", resmeta.Stats.NumSamples,
+		"labels", labels.FromMap(resmeta.Thanos.Labels))
+
+	if dryRun {
+		level.Info(logger).Log("msg", "dry run; skipping upload", "id", id, "newID", resid)
+		return nil
+	}
+
+	if err := block.Upload(ctx, bkt, resdir); err != nil {
+		return errors.Wrapf(err, "upload rewritten block %s", resid)
+	}
+	return block.MarkForDeletion(ctx, logger, bkt, id, fmt.Sprintf("rewritten as %s", resid))
+}
+
+// downsampleBlock downsamples the block with the given ID to the resolution and uploads the result. A resolution of zero
+// selects the resolution of the level following the one of the block. Unlike the compactor, the size of the block is
+// not checked against the min source range of the level.
+func downsampleBlock(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.Bucket,
+	tmpDir string,
+	id ulid.ULID,
+	levels []downsample.Level,
+	resolution int64,
+	force bool,
+) error {
+	meta, err := block.DownloadMeta(ctx, bkt, id)
+	if err != nil {
+		return err
+	}
+	resolution, err = downsampleTargetResolution(&meta, levels, resolution)
+	if err != nil {
+		return err
+	}
+
+	if !force {
+		metas, err := downloadMetas(ctx, logger, bkt)
+		if err != nil {
+			return err
+		}
+		if isDownsampled(metas, &meta, resolution) {
+			return errors.Errorf("data of the block is already downsampled to resolution %d; use --force to downsample it again", resolution)
+		}
+	}
+
+	dir, err := ioutil.TempDir(tmpDir, fmt.Sprintf("downsample-block-%s-", id))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	return processDownsampling(ctx, logger, bkt, &meta, dir, resolution)
+}
+
+// downsampleTargetResolution returns the resolution the block of the given meta is downsampled to by the downsample command.
+func downsampleTargetResolution(m *block.Meta, levels []downsample.Level, resolution int64) (int64, error) {
+	if resolution == 0 {
+		l, ok := downsample.NextLevel(levels, m.Thanos.Downsample.Resolution)
+		if !ok {
+			return 0, errors.Errorf("no downsampling level above resolution %d of the block", m.Thanos.Downsample.Resolution)
+		}
+		return l.Resolution, nil
+	}
+	if resolution <= m.Thanos.Downsample.Resolution {
+		return 0, errors.Errorf("resolution %d must be higher than resolution %d of the block", resolution, m.Thanos.Downsample.Resolution)
+	}
+	return resolution, nil
+}
+
+// isDownsampled returns true if all sources of the block of the given meta are held by blocks of the resolution within
+// the same compaction group.
+func isDownsampled(metas []*block.Meta, m *block.Meta, resolution int64) bool {
+	sources := map[string]struct{}{}
+	for _, o := range metas {
+		if o.Thanos.Downsample.Resolution != resolution || !labels.FromMap(o.Thanos.Labels).Equals(labels.FromMap(m.Thanos.Labels)) {
+			continue
+		}
+		for _, id := range o.Compaction.Sources {
+			sources[sourceKey(o, id)] = struct{}{}
+		}
+	}
+	for _, id := range m.Compaction.Sources {
+		if _, ok := sources[sourceKey(m, id)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// uploadBlock validates the local block and uploads it to the bucket. Blocks without external labels are
+// finalized with the given labels and resolution first. Blocks that already have external labels must
+// either match the given ones or no labels must be given.
+func uploadBlock(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.Bucket,
+	dir string,
+	extLset labels.Labels,
+	resolution int64,
+	dryRun bool,
+	resume bool,
+) error {
+	dir = filepath.Clean(dir)
+	id, err := ulid.Parse(filepath.Base(dir))
+	if err != nil {
+		return errors.Wrap(err, "directory name is not a block ID")
+	}
+
+	meta, err := block.ReadMetaFile(dir)
+	if err != nil {
+		return errors.Wrap(err, "read meta")
+	}
+	if meta.ULID != id {
+		return errors.Errorf("block ID %s in meta file does not match directory name", meta.ULID)
+	}
+
+	finalize := len(meta.Thanos.Labels) == 0
+	if finalize && len(extLset) == 0 {
+		return errors.New("block has no external labels, labels need to be specified")
+	}
+	if !finalize && len(extLset) > 0 && !labels.FromMap(meta.Thanos.Labels).Equals(extLset) {
+		return errors.Errorf("block has different external labels %s, use the rewrite command to change them", labels.FromMap(meta.Thanos.Labels))
+	}
+
+	// The block is verified before it is modified, so invalid blocks and dry runs leave it untouched.
+	if err := block.VerifyIndex(filepath.Join(dir, block.IndexFilename), meta.MinTime, meta.MaxTime); err != nil {
+		return errors.Wrap(err, "verify index")
+	}
+
+	ok, err := bkt.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+	if err != nil {
+		return errors.Wrap(err, "check meta file in bucket")
+	}
+	if ok {
+		return errors.New("block already exists in the bucket")
+	}
+
+	if dryRun {
+		level.Info(logger).Log("msg", "dry run; skipping upload of valid block", "id", id, "setLabels", finalize)
+		return nil
+	}
+	if finalize {
+		if meta, err = block.Finalize(dir, extLset.Map(), resolution, nil); err != nil {
+			return errors.Wrap(err, "finalize block")
+		}
+		level.Info(logger).Log("msg", "set external labels", "id", id, "labels", extLset, "resolution", resolution)
+	}
+
+	upload := block.Upload
+	if resume {
+		upload = block.UploadResumable
+	}
+	if err := upload(ctx, bkt, dir); err != nil {
+		return err
+	}
+	level.Info(logger).Log("msg", "uploaded block", "id", id, "mint", meta.MinTime, "maxt", meta.MaxTime,
+		"labels", labels.FromMap(meta.Thanos.Labels), "resolution", meta.Thanos.Downsample.Resolution)
+	return nil
+}
+
+// parseReplicateFilter builds the block filter from the replicate command flags.
+func parseReplicateFilter(matcher string, resolutions []time.Duration, levels []int, minTime, maxTime string) (replicate.BlockFilter, error) {
+	var (
+		f   = replicate.BlockFilter{Levels: levels}
+		err error
+	)
+	if matcher != "" {
+		f.Matchers, err = promql.ParseMetricSelector(matcher)
+		if err != nil {
+			return f, errors.Wrapf(err, "parse matcher %s", matcher)
+		}
+	}
+	for _, r := range resolutions {
+		f.Resolutions = append(f.Resolutions, int64(r/time.Millisecond))
+	}
+	if f.MinTime, err = parseRFC3339Millis(minTime); err != nil {
+		return f, errors.Wrap(err, "parse min time")
+	}
+	if f.MaxTime, err = parseRFC3339Millis(maxTime); err != nil {
+		return f, errors.Wrap(err, "parse max time")
+	}
+	return f, nil
+}
+
+// parseRFC3339Millis parses the given RFC3339 time into milliseconds. Empty string results in zero.
+func parseRFC3339Millis(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixNano() / int64(time.Millisecond), nil
+}
+
+// downloadMetas returns metas of all blocks in the bucket. Blocks without meta file are skipped.
+func downloadMetas(ctx context.Context, logger log.Logger, bkt objstore.BucketReader) ([]*block.Meta, error) {
+	var metas []*block.Meta
+	err := bkt.Iter(ctx, "", func(name string) error {
+		id, ok := block.IsBlockDir(name)
+		if !ok {
+			return nil
+		}
+
+		ok, err := bkt.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+		if err != nil {
+			return errors.Wrapf(err, "check meta file for %s", id)
+		}
+		if !ok {
+			level.Warn(logger).Log("msg", "skipping block without meta file", "id", id)
+			return nil
+		}
+
+		m, err := block.DownloadMeta(ctx, bkt, id)
+		if err != nil {
+			return err
+		}
+		metas = append(metas, &m)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "retrieve bucket block metas")
+	}
+	return metas, nil
+}
+
+// groupSummary aggregates stats of all blocks within a single compaction group.
+type groupSummary struct {
+	key        string
+	labels     labels.Labels
+	resolution int64
+	blocks     int
+	levels     map[int]int
+
+	series  uint64
+	samples uint64
+	chunks  uint64
+
+	minTime int64
+	maxTime int64
+	// Number and total length (in milliseconds) of time ranges not covered by any block.
+	gaps        int
+	gapsRangeMs int64
+}
+
+func summarizeGroups(metas []*block.Meta) []*groupSummary {
+	groups := map[string][]*block.Meta{}
+	for _, m := range metas {
+		k := compact.GroupKey(*m)
+		groups[k] = append(groups[k], m)
+	}
+
+	res := make([]*groupSummary, 0, len(groups))
+	for k, ms := range groups {
+		sort.Slice(ms, func(i, j int) bool {
+			return ms[i].MinTime < ms[j].MinTime
+		})
+
+		s := &groupSummary{
+			key:        k,
+			labels:     labels.FromMap(ms[0].Thanos.Labels),
+			resolution: ms[0].Thanos.Downsample.Resolution,
+			levels:     map[int]int{},
+			minTime:    ms[0].MinTime,
+			maxTime:    ms[0].MaxTime,
+		}
+		for _, m := range ms {
+			s.blocks++
+			s.levels[m.Compaction.Level]++
+			s.series += m.Stats.NumSeries
+			s.samples += m.Stats.NumSamples
+			s.chunks += m.Stats.NumChunks
+
+			if m.MinTime > s.maxTime {
+				s.gaps++
+				s.gapsRangeMs += m.MinTime - s.maxTime
+			}
+			if m.MaxTime > s.maxTime {
+				s.maxTime = m.MaxTime
+			}
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+const (
+	inspectColumnGroup      = "group"
+	inspectColumnResolution = "resolution"
+	inspectColumnBlocks     = "blocks"
+	inspectColumnLevels     = "levels"
+	inspectColumnSeries     = "series"
+	inspectColumnSamples    = "samples"
+	inspectColumnChunks     = "chunks"
+	inspectColumnFrom       = "from"
+	inspectColumnUntil      = "until"
+	inspectColumnRange      = "range"
+	inspectColumnGaps       = "gaps"
+)
+
+type inspectColumn struct {
+	name  string
+	value func(s *groupSummary) string
+	less  func(a, b *groupSummary) bool
+}
+
+var inspectColumns = []inspectColumn{
+	{
+		name:  inspectColumnGroup,
+		value: func(s *groupSummary) string { return s.labels.String() },
+		less:  func(a, b *groupSummary) bool { return labels.Compare(a.labels, b.labels) < 0 },
+	},
+	{
+		name:  inspectColumnResolution,
+		value: func(s *groupSummary) string { return formatMillis(s.resolution) },
+		less:  func(a, b *groupSummary) bool { return a.resolution < b.resolution },
+	},
+	{
+		name:  inspectColumnBlocks,
+		value: func(s *groupSummary) string { return strconv.Itoa(s.blocks) },
+		less:  func(a, b *groupSummary) bool { return a.blocks < b.blocks },
+	},
+	{
+		name: inspectColumnLevels,
+		value: func(s *groupSummary) string {
+			var lvls []int
+			for l := range s.levels {
+				lvls = append(lvls, l)
+			}
+			sort.Ints(lvls)
+
+			var parts []string
+			for _, l := range lvls {
+				parts = append(parts, fmt.Sprintf("%d:%d", l, s.levels[l]))
+			}
+			return strings.Join(parts, " ")
+		},
+		less: func(a, b *groupSummary) bool { return maxLevel(a) < maxLevel(b) },
+	},
+	{
+		name:  inspectColumnSeries,
+		value: func(s *groupSummary) string { return strconv.FormatUint(s.series, 10) },
+		less:  func(a, b *groupSummary) bool { return a.series < b.series },
+	},
+	{
+		name:  inspectColumnSamples,
+		value: func(s *groupSummary) string { return strconv.FormatUint(s.samples, 10) },
+		less:  func(a, b *groupSummary) bool { return a.samples < b.samples },
+	},
+	{
+		name:  inspectColumnChunks,
+		value: func(s *groupSummary) string { return strconv.FormatUint(s.chunks, 10) },
+		less:  func(a, b *groupSummary) bool { return a.chunks < b.chunks },
+	},
+	{
+		name:  inspectColumnFrom,
+		value: func(s *groupSummary) string { return formatTimestamp(s.minTime) },
+		less:  func(a, b *groupSummary) bool { return a.minTime < b.minTime },
+	},
+	{
+		name:  inspectColumnUntil,
+		value: func(s *groupSummary) string { return formatTimestamp(s.maxTime) },
+		less:  func(a, b *groupSummary) bool { return a.maxTime < b.maxTime },
+	},
+	{
+		name:  inspectColumnRange,
+		value: func(s *groupSummary) string { return formatMillis(s.maxTime - s.minTime) },
+		less:  func(a, b *groupSummary) bool { return a.maxTime-a.minTime < b.maxTime-b.minTime },
+	},
+	{
+		name: inspectColumnGaps,
+		value: func(s *groupSummary) string {
+			if s.gaps == 0 {
+				return "0"
+			}
+			return fmt.Sprintf("%d (%s)", s.gaps, formatMillis(s.gapsRangeMs))
+		},
+		less: func(a, b *groupSummary) bool { return a.gapsRangeMs < b.gapsRangeMs },
+	},
+}
+
+func inspectColumnNames() (names []string) {
+	for _, c := range inspectColumns {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+func lookupInspectColumn(name string) (inspectColumn, error) {
+	for _, c := range inspectColumns {
+		if c.name == name {
+			return c, nil
+		}
+	}
+	return inspectColumn{}, errors.Errorf("no such column %s", name)
+}
+
+func sortGroupSummaries(summaries []*groupSummary, sortBy []string, reverse bool) error {
+	var cols []inspectColumn
+	for _, name := range sortBy {
+		c, err := lookupInspectColumn(name)
+		if err != nil {
+			return err
+		}
+		cols = append(cols, c)
+	}
+
+	sort.SliceStable(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if reverse {
+			a, b = b, a
+		}
+		for _, c := range cols {
+			if c.less(a, b) {
+				return true
+			}
+			if c.less(b, a) {
+				return false
+			}
+		}
+		// Keep the order deterministic for equal groups.
+		return a.key < b.key
+	})
+	return nil
+}
+
+func printGroupSummaries(w io.Writer, summaries []*groupSummary, columns []string) error {
+	var cols []inspectColumn
+	for _, name := range columns {
+		c, err := lookupInspectColumn(name)
+		if err != nil {
+			return err
+		}
+		cols = append(cols, c)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	header := make([]string, 0, len(cols))
+	for _, c := range cols {
+		header = append(header, strings.ToUpper(c.name))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, s := range summaries {
+		row := make([]string, 0, len(cols))
+		for _, c := range cols {
+			row = append(row, c.value(s))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// groupSummaryRecord is the stable JSON representation of a group summary.
+type groupSummaryRecord struct {
+	Group      string            `json:"group"`
+	Labels     map[string]string `json:"labels"`
+	Resolution int64             `json:"resolution"`
+	Blocks     int               `json:"blocks"`
+	// Levels maps compaction levels to the number of blocks.
+	Levels    map[int]int `json:"levels"`
+	Series    uint64      `json:"series"`
+	Samples   uint64      `json:"samples"`
+	Chunks    uint64      `json:"chunks"`
+	MinTime   int64       `json:"min_time"`
+	MaxTime   int64       `json:"max_time"`
+	Gaps      int         `json:"gaps"`
+	GapsRange int64       `json:"gaps_range"`
+}
+
+func printGroupSummariesJSON(w io.Writer, summaries []*groupSummary) error {
+	records := make([]groupSummaryRecord, 0, len(summaries))
+	for _, s := range summaries {
+		records = append(records, groupSummaryRecord{
+			Group:      s.key,
+			Labels:     s.labels.Map(),
+			Resolution: s.resolution,
+			Blocks:     s.blocks,
+			Levels:     s.levels,
+			Series:     s.series,
+			Samples:    s.samples,
+			Chunks:     s.chunks,
+			MinTime:    s.minTime,
+			MaxTime:    s.maxTime,
+			Gaps:       s.gaps,
+			GapsRange:  s.gapsRangeMs,
+		})
+	}
+	return printJSON(w, records)
+}
+
+func printGroupSummariesCSV(w io.Writer, summaries []*groupSummary) error {
+	levels, _ := lookupInspectColumn(inspectColumnLevels)
+
+	rows := make([][]string, 0, len(summaries))
+	for _, s := range summaries {
+		rows = append(rows, []string{
+			s.key,
+			s.labels.String(),
+			strconv.FormatInt(s.resolution, 10),
+			strconv.Itoa(s.blocks),
+			levels.value(s),
+			strconv.FormatUint(s.series, 10),
+			strconv.FormatUint(s.samples, 10),
+			strconv.FormatUint(s.chunks, 10),
+			strconv.FormatInt(s.minTime, 10),
+			strconv.FormatInt(s.maxTime, 10),
+			strconv.Itoa(s.gaps),
+			strconv.FormatInt(s.gapsRangeMs, 10),
+		})
+	}
+	return printCSV(w, []string{"group", "labels", "resolution", "blocks", "levels", "series", "samples", "chunks",
+		"min_time", "max_time", "gaps", "gaps_range"}, rows)
+}
+
+func maxLevel(s *groupSummary) (max int) {
+	for l := range s.levels {
+		if l > max {
+			max = l
+		}
+	}
+	return max
+}
+
+func formatTimestamp(ms int64) string {
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+}
+
+func formatMillis(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).String()
+}
+
+// downsampleGap is a time range of a group for which downsampled blocks of the given resolution are missing.
+type downsampleGap struct {
+	labels     labels.Labels
+	resolution int64
+	minTime    int64
+	maxTime    int64
+	blocks     int
+	// pending is true if the source blocks are eligible for downsampling and false if they are
+	// too short and wait for further compaction.
+	pending bool
+}
+
+// downsampleStatus returns the time ranges per group that are not covered by downsampled blocks
+// yet. It follows the rules of downsampleBucket to decide whether a block is downsampled.
+func downsampleStatus(metas []*block.Meta, levels []downsample.Level) []downsampleGap {
+	sources := map[int64]map[ulid.ULID]struct{}{}
+	for _, l := range levels {
+		sources[l.Resolution] = map[ulid.ULID]struct{}{}
+	}
+	for _, m := range metas {
+		s, ok := sources[m.Thanos.Downsample.Resolution]
+		if !ok {
+			continue
+		}
+		for _, id := range m.Compaction.Sources {
+			s[id] = struct{}{}
+		}
+	}
+
+	var gaps []downsampleGap
+	for _, m := range metas {
+		l, ok := downsample.NextLevel(levels, m.Thanos.Downsample.Resolution)
+		if !ok {
+			continue
+		}
+		missing := false
+		for _, id := range m.Compaction.Sources {
+			if _, ok := sources[l.Resolution][id]; !ok {
+				missing = true
+				break
+			}
+		}
+		if !missing {
+			continue
+		}
+		gaps = append(gaps, downsampleGap{
+			labels:     labels.FromMap(m.Thanos.Labels),
+			resolution: l.Resolution,
+			minTime:    m.MinTime,
+			maxTime:    m.MaxTime,
+			blocks:     1,
+			pending:    m.MaxTime-m.MinTime >= l.MinSourceRange,
+		})
+	}
+
+	sort.Slice(gaps, func(i, j int) bool {
+		if c := labels.Compare(gaps[i].labels, gaps[j].labels); c != 0 {
+			return c < 0
+		}
+		if gaps[i].resolution != gaps[j].resolution {
+			return gaps[i].resolution < gaps[j].resolution
+		}
+		return gaps[i].minTime < gaps[j].minTime
+	})
+
+	// Merge adjacent gaps of the same kind into a single time range.
+	var res []downsampleGap
+	for _, g := range gaps {
+		if n := len(res); n > 0 {
+			last := &res[n-1]
+			if last.labels.Equals(g.labels) && last.resolution == g.resolution &&
+				last.pending == g.pending && last.maxTime >= g.minTime {
+				if g.maxTime > last.maxTime {
+					last.maxTime = g.maxTime
+				}
+				last.blocks++
+				continue
+			}
+		}
+		res = append(res, g)
+	}
+	return res
+}
+
+func (g downsampleGap) status() string {
+	if g.pending {
+		return "missing"
+	}
+	return "awaiting compaction"
+}
+
+// downsampleGapRecord is the stable JSON representation of a downsample gap.
+type downsampleGapRecord struct {
+	Labels     map[string]string `json:"labels"`
+	Resolution int64             `json:"resolution"`
+	MinTime    int64             `json:"min_time"`
+	MaxTime    int64             `json:"max_time"`
+	Blocks     int               `json:"blocks"`
+	Status     string            `json:"status"`
+}
+
+func printDownsampleGaps(w io.Writer, output string, gaps []downsampleGap) error {
+	switch output {
+	case outputJSON:
+		records := make([]downsampleGapRecord, 0, len(gaps))
+		for _, g := range gaps {
+			records = append(records, downsampleGapRecord{
+				Labels:     g.labels.Map(),
+				Resolution: g.resolution,
+				MinTime:    g.minTime,
+				MaxTime:    g.maxTime,
+				Blocks:     g.blocks,
+				Status:     g.status(),
+			})
+		}
+		return printJSON(w, records)
+	case outputCSV:
+		rows := make([][]string, 0, len(gaps))
+		for _, g := range gaps {
+			rows = append(rows, []string{
+				g.labels.String(),
+				strconv.FormatInt(g.resolution, 10),
+				strconv.FormatInt(g.minTime, 10),
+				strconv.FormatInt(g.maxTime, 10),
+				strconv.Itoa(g.blocks),
+				g.status(),
+			})
+		}
+		return printCSV(w, []string{"labels", "resolution", "min_time", "max_time", "blocks", "status"}, rows)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "GROUP\tRESOLUTION\tFROM\tUNTIL\tRANGE\tBLOCKS\tSTATUS")
+	for _, g := range gaps {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			g.labels, formatMillis(g.resolution), formatTimestamp(g.minTime), formatTimestamp(g.maxTime),
+			formatMillis(g.maxTime-g.minTime), g.blocks, g.status())
+	}
+	return tw.Flush()
+}
+
+// indexAnalysisRecord is the stable JSON representation of the analyze command output.
+type indexAnalysisRecord struct {
+	ID      ulid.ULID `json:"id"`
+	MinTime int64     `json:"min_time"`
+	MaxTime int64     `json:"max_time"`
+	*block.IndexAnalysis
+}
+
+func printIndexAnalysis(w io.Writer, output string, meta *block.Meta, a *block.IndexAnalysis) error {
+	switch output {
+	case outputJSON:
+		return printJSON(w, indexAnalysisRecord{ID: meta.ULID, MinTime: meta.MinTime, MaxTime: meta.MaxTime, IndexAnalysis: a})
+	case outputCSV:
+		rows := [][]string{
+			{"series", "", strconv.FormatUint(a.Series, 10)},
+			{"label_names", "", strconv.Itoa(a.LabelNames)},
+			{"label_pairs", "", strconv.Itoa(a.LabelPairs)},
+		}
+		for _, section := range []struct {
+			statistic string
+			counts    []block.Count
+		}{
+			{statistic: "highest_cardinality_labels", counts: a.HighestCardinalityLabels},
+			{statistic: "highest_cardinality_metric_names", counts: a.HighestCardinalityMetricNames},
+			{statistic: "most_common_label_pairs", counts: a.MostCommonLabelPairs},
+			{statistic: "label_names_by_value_length", counts: a.LabelNamesByValueLength},
+		} {
+			for _, c := range section.counts {
+				rows = append(rows, []string{section.statistic, c.Name, strconv.FormatUint(c.Count, 10)})
+			}
+		}
+		return printCSV(w, []string{"statistic", "name", "count"}, rows)
+	}
+
+	fmt.Fprintf(w, "Block ID: %s\n", meta.ULID)
+	fmt.Fprintf(w, "Duration: %s\n", formatMillis(meta.MaxTime-meta.MinTime))
+	fmt.Fprintf(w, "Series: %d\n", a.Series)
+	fmt.Fprintf(w, "Label names: %d\n", a.LabelNames)
+	fmt.Fprintf(w, "Label pairs: %d\n", a.LabelPairs)
+
+	for _, section := range []struct {
+		title  string
+		counts []block.Count
+	}{
+		{title: "Highest cardinality labels", counts: a.HighestCardinalityLabels},
+		{title: "Highest cardinality metric names", counts: a.HighestCardinalityMetricNames},
+		{title: "Most common label pairs", counts: a.MostCommonLabelPairs},
+		{title: "Label names with highest cumulative label value length", counts: a.LabelNamesByValueLength},
+	} {
+		fmt.Fprintf(w, "\n%s:\n", section.title)
+		for _, c := range section.counts {
+			fmt.Fprintf(w, "%d %s\n", c.Count, c.Name)
+		}
+	}
+	return nil
+}
+
+// consecutiveBlocks returns at most max most recent blocks of the group that follow each other
+// without overlapping, sorted by time.
+func consecutiveBlocks(metas []*block.Meta, group string, max int) []*block.Meta {
+	var res []*block.Meta
+	for _, m := range metas {
+		if compact.GroupKey(*m) == group {
+			res = append(res, m)
+		}
+	}
+	// Prefer higher compaction levels for blocks starting at the same time as they cover
+	// the data of the lower levels.
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].MinTime != res[j].MinTime {
+			return res[i].MinTime > res[j].MinTime
+		}
+		return res[i].Compaction.Level > res[j].Compaction.Level
+	})
+
+	var chain []*block.Meta
+	for _, m := range res {
+		if len(chain) == max {
+			break
+		}
+		if len(chain) > 0 && m.MaxTime > chain[len(chain)-1].MinTime {
+			continue
+		}
+		chain = append(chain, m)
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
+// churnRecord is the stable JSON representation of churn between two consecutive blocks.
+type churnRecord struct {
+	Prev        ulid.ULID            `json:"prev"`
+	PrevMinTime int64                `json:"prev_min_time"`
+	Next        ulid.ULID            `json:"next"`
+	NextMinTime int64                `json:"next_min_time"`
+	Churn       *block.ChurnAnalysis `json:"churn"`
+}
+
+func printChurnAnalyses(w io.Writer, output string, records []churnRecord) error {
+	switch output {
+	case outputJSON:
+		return printJSON(w, records)
+	case outputCSV:
+		var rows [][]string
+		for _, r := range records {
+			for _, m := range r.Churn.Metrics {
+				rows = append(rows, []string{
+					r.Prev.String(),
+					r.Next.String(),
+					m.Name,
+					strconv.FormatUint(m.Series, 10),
+					strconv.FormatUint(m.Added, 10),
+					strconv.FormatUint(m.Removed, 10),
+				})
+			}
+		}
+		return printCSV(w, []string{"prev", "next", "metric", "series", "added", "removed"}, rows)
+	}
+
+	for _, r := range records {
+		printChurnAnalysis(w, r)
+	}
+	return nil
+}
+
+func printChurnAnalysis(w io.Writer, r churnRecord) {
+	a := r.Churn
+	fmt.Fprintf(w, "%s (%s) -> %s (%s)\n", r.Prev, formatTimestamp(r.PrevMinTime), r.Next, formatTimestamp(r.NextMinTime))
+	fmt.Fprintf(w, "Series: %d -> %d, added: %d, removed: %d\n", a.PrevSeries, a.NextSeries, a.Added, a.Removed)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tSERIES\tADDED\tREMOVED\tCHURN")
+	for _, m := range a.Metrics {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.1f%%\n", m.Name, m.Series, m.Added, m.Removed, 100*m.Rate())
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w, "Label names with most new values:")
+	for _, c := range a.LabelNames {
+		fmt.Fprintf(w, "%d %s\n", c.Count, c.Name)
 	}
+	fmt.Fprintln(w)
 }
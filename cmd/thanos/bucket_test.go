@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/compact"
+	"github.com/improbable-eng/thanos/pkg/compact/downsample"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/tsdb"
+	"github.com/prometheus/tsdb/labels"
+)
+
+func TestBucketInspect_summarizeGroups(t *testing.T) {
+	newMeta := func(id uint64, lset map[string]string, res int64, lvl int, mint, maxt int64) *block.Meta {
+		m := &block.Meta{
+			Version: 1,
+			BlockMeta: tsdb.BlockMeta{
+				ULID:    ulid.MustNew(id, nil),
+				MinTime: mint,
+				MaxTime: maxt,
+				Stats:   tsdb.BlockStats{NumSeries: 10, NumSamples: 100, NumChunks: 20},
+			},
+		}
+		m.Compaction.Level = lvl
+		m.Thanos.Labels = lset
+		m.Thanos.Downsample.Resolution = res
+		return m
+	}
+
+	a := map[string]string{"a": "1"}
+	b := map[string]string{"a": "2"}
+
+	summaries := summarizeGroups([]*block.Meta{
+		newMeta(1, a, 0, 1, 0, 10),
+		newMeta(2, a, 0, 2, 30, 50),
+		newMeta(3, a, 0, 1, 10, 20),
+		newMeta(4, b, 0, 1, 0, 10),
+		newMeta(5, a, 300000, 2, 0, 50),
+	})
+	testutil.Ok(t, sortGroupSummaries(summaries, []string{inspectColumnBlocks}, true))
+	testutil.Equals(t, 3, len(summaries))
+
+	s := summaries[0]
+	testutil.Equals(t, `{a="1"}`, s.labels.String())
+	testutil.Equals(t, int64(0), s.resolution)
+	testutil.Equals(t, 3, s.blocks)
+	testutil.Equals(t, map[int]int{1: 2, 2: 1}, s.levels)
+	testutil.Equals(t, uint64(30), s.series)
+	testutil.Equals(t, int64(0), s.minTime)
+	testutil.Equals(t, int64(50), s.maxTime)
+	testutil.Equals(t, 1, s.gaps)
+	testutil.Equals(t, int64(10), s.gapsRangeMs)
+
+	var buf bytes.Buffer
+	testutil.Ok(t, printGroupSummaries(&buf, summaries, []string{inspectColumnGroup, inspectColumnLevels}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	testutil.Equals(t, 4, len(lines))
+	testutil.Assert(t, strings.HasPrefix(lines[0], "GROUP"), "unexpected header %q", lines[0])
+	testutil.Assert(t, strings.HasSuffix(lines[1], "1:2 2:1"), "unexpected row %q", lines[1])
+
+	buf.Reset()
+	testutil.Ok(t, printGroupSummariesCSV(&buf, summaries))
+	records, err := csv.NewReader(&buf).ReadAll()
+	testutil.Ok(t, err)
+	testutil.Equals(t, 4, len(records))
+	testutil.Equals(t, []string{"group", "labels", "resolution", "blocks", "levels", "series", "samples", "chunks",
+		"min_time", "max_time", "gaps", "gaps_range"}, records[0])
+	testutil.Equals(t, []string{s.key, `{a="1"}`, "0", "3", "1:2 2:1", "30", "300", "60", "0", "50", "1", "10"}, records[1])
+
+	buf.Reset()
+	testutil.Ok(t, printGroupSummariesJSON(&buf, summaries))
+	var decoded []map[string]interface{}
+	testutil.Ok(t, json.Unmarshal(buf.Bytes(), &decoded))
+	testutil.Equals(t, 3, len(decoded))
+	testutil.Equals(t, map[string]interface{}{
+		"group":      s.key,
+		"labels":     map[string]interface{}{"a": "1"},
+		"resolution": float64(0),
+		"blocks":     float64(3),
+		"levels":     map[string]interface{}{"1": float64(2), "2": float64(1)},
+		"series":     float64(30),
+		"samples":    float64(300),
+		"chunks":     float64(60),
+		"min_time":   float64(0),
+		"max_time":   float64(50),
+		"gaps":       float64(1),
+		"gaps_range": float64(10),
+	}, decoded[0])
+}
+
+func TestBucketRewrite_seriesModifier(t *testing.T) {
+	modifier, err := seriesModifier(nil, "")
+	testutil.Ok(t, err)
+	testutil.Assert(t, modifier == nil, "expected no modifier")
+
+	f, err := ioutil.TempFile("", "relabel-config")
+	testutil.Ok(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`
+- action: labeldrop
+  regex: pod
+- source_labels: [job]
+  regex: drop
+  action: drop
+`)
+	testutil.Ok(t, err)
+	testutil.Ok(t, f.Close())
+
+	modifier, err = seriesModifier([]string{`{__name__="secret"}`, `{job="a", instance="1"}`}, f.Name())
+	testutil.Ok(t, err)
+
+	for _, c := range []struct {
+		in, out labels.Labels
+	}{
+		{
+			in: labels.FromStrings("__name__", "secret", "job", "a"),
+		},
+		{
+			in: labels.FromStrings("__name__", "up", "instance", "1", "job", "a"),
+		},
+		{
+			in:  labels.FromStrings("__name__", "up", "instance", "2", "job", "a", "pod", "x"),
+			out: labels.FromStrings("__name__", "up", "instance", "2", "job", "a"),
+		},
+		{
+			in: labels.FromStrings("__name__", "up", "job", "drop"),
+		},
+	} {
+		testutil.Equals(t, c.out, modifier(c.in))
+	}
+}
+
+func TestBucketDownsampleStatus(t *testing.T) {
+	newMeta := func(id uint64, res int64, mint, maxt int64, sources ...uint64) *block.Meta {
+		m := &block.Meta{
+			Version: 1,
+			BlockMeta: tsdb.BlockMeta{
+				ULID:    ulid.MustNew(id, nil),
+				MinTime: mint,
+				MaxTime: maxt,
+			},
+		}
+		for _, s := range sources {
+			m.Compaction.Sources = append(m.Compaction.Sources, ulid.MustNew(s, nil))
+		}
+		m.Thanos.Labels = map[string]string{"a": "1"}
+		m.Thanos.Downsample.Resolution = res
+		return m
+	}
+	const h = int64(60 * 60 * 1000)
+
+	gaps := downsampleStatus([]*block.Meta{
+		// Downsampled raw block.
+		newMeta(1, 0, 0, 48*h, 1),
+		newMeta(2, downsample.ResLevel1, 0, 48*h, 1),
+		// Two adjacent raw blocks not downsampled yet.
+		newMeta(3, 0, 48*h, 96*h, 3),
+		newMeta(4, 0, 96*h, 144*h, 4),
+		// Raw block too short to be downsampled.
+		newMeta(5, 0, 144*h, 146*h, 5),
+	}, downsample.DefaultLevels)
+	testutil.Equals(t, 3, len(gaps))
+
+	testutil.Equals(t, downsample.ResLevel1, gaps[0].resolution)
+	testutil.Equals(t, 48*h, gaps[0].minTime)
+	testutil.Equals(t, 144*h, gaps[0].maxTime)
+	testutil.Equals(t, 2, gaps[0].blocks)
+	testutil.Equals(t, true, gaps[0].pending)
+
+	testutil.Equals(t, downsample.ResLevel1, gaps[1].resolution)
+	testutil.Equals(t, false, gaps[1].pending)
+
+	// The 5m block is too short for 1h downsampling.
+	testutil.Equals(t, downsample.ResLevel2, gaps[2].resolution)
+	testutil.Equals(t, false, gaps[2].pending)
+}
+
+func TestBucketDownsample_targetResolution(t *testing.T) {
+	newMeta := func(id uint64, lset map[string]string, res int64, sources ...uint64) *block.Meta {
+		m := &block.Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(id, nil)}}
+		for _, s := range sources {
+			m.Compaction.Sources = append(m.Compaction.Sources, ulid.MustNew(s, nil))
+		}
+		m.Thanos.Labels = lset
+		m.Thanos.Downsample.Resolution = res
+		return m
+	}
+	raw := newMeta(1, map[string]string{"a": "1"}, 0, 1, 2)
+
+	res, err := downsampleTargetResolution(raw, downsample.DefaultLevels, 0)
+	testutil.Ok(t, err)
+	testutil.Equals(t, downsample.ResLevel1, res)
+	res, err = downsampleTargetResolution(newMeta(2, nil, downsample.ResLevel1), downsample.DefaultLevels, 0)
+	testutil.Ok(t, err)
+	testutil.Equals(t, downsample.ResLevel2, res)
+	res, err = downsampleTargetResolution(raw, downsample.DefaultLevels, downsample.ResLevel2)
+	testutil.Ok(t, err)
+	testutil.Equals(t, downsample.ResLevel2, res)
+
+	_, err = downsampleTargetResolution(newMeta(3, nil, downsample.ResLevel2), downsample.DefaultLevels, 0)
+	testutil.NotOk(t, err)
+	_, err = downsampleTargetResolution(newMeta(3, nil, downsample.ResLevel1), downsample.DefaultLevels, downsample.ResLevel1)
+	testutil.NotOk(t, err)
+
+	// Only blocks of the same group and resolution holding all sources count.
+	testutil.Assert(t, !isDownsampled(nil, raw, downsample.ResLevel1), "expected block not to be downsampled")
+	testutil.Assert(t, !isDownsampled([]*block.Meta{
+		newMeta(4, map[string]string{"a": "1"}, downsample.ResLevel1, 1),
+		newMeta(5, map[string]string{"a": "2"}, downsample.ResLevel1, 2),
+		newMeta(6, map[string]string{"a": "1"}, downsample.ResLevel2, 2),
+	}, raw, downsample.ResLevel1), "expected block not to be downsampled")
+	testutil.Assert(t, isDownsampled([]*block.Meta{
+		newMeta(4, map[string]string{"a": "1"}, downsample.ResLevel1, 1),
+		newMeta(5, map[string]string{"a": "1"}, downsample.ResLevel1, 2),
+	}, raw, downsample.ResLevel1), "expected block to be downsampled")
+}
+
+func TestBucketChurn_consecutiveBlocks(t *testing.T) {
+	newMeta := func(id uint64, lset map[string]string, lvl int, mint, maxt int64) *block.Meta {
+		m := &block.Meta{
+			Version: 1,
+			BlockMeta: tsdb.BlockMeta{
+				ULID:    ulid.MustNew(id, nil),
+				MinTime: mint,
+				MaxTime: maxt,
+			},
+		}
+		m.Compaction.Level = lvl
+		m.Thanos.Labels = lset
+		return m
+	}
+	a := map[string]string{"a": "1"}
+
+	metas := []*block.Meta{
+		newMeta(1, a, 1, 0, 10),
+		newMeta(2, a, 1, 10, 20),
+		newMeta(3, a, 2, 0, 20),
+		newMeta(4, a, 1, 20, 30),
+		newMeta(5, a, 1, 30, 40),
+		newMeta(6, map[string]string{"a": "2"}, 1, 40, 50),
+	}
+	group := compact.GroupKey(*metas[0])
+
+	var ids []uint64
+	for _, m := range consecutiveBlocks(metas, group, 10) {
+		ids = append(ids, m.ULID.Time())
+	}
+	testutil.Equals(t, []uint64{1, 2, 4, 5}, ids)
+
+	ids = ids[:0]
+	for _, m := range consecutiveBlocks(metas, group, 2) {
+		ids = append(ids, m.ULID.Time())
+	}
+	testutil.Equals(t, []uint64{4, 5}, ids)
+}
+
+func TestBucketUpload_uploadBlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-bucket-upload")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+	logger := log.NewNopLogger()
+
+	// Block without external labels, like the ones created by Prometheus.
+	id, err := testutil.CreateBlock(dir, []labels.Labels{
+		{{Name: "a", Value: "1"}},
+		{{Name: "a", Value: "2"}},
+	}, 100, 0, 1000, nil, 0)
+	testutil.Ok(t, err)
+	bdir := filepath.Join(dir, id.String())
+
+	testutil.NotOk(t, uploadBlock(ctx, logger, bkt, bdir, nil, 0, false, false))
+
+	// Dry runs leave the block untouched.
+	extLset := labels.FromStrings("ext", "1")
+	testutil.Ok(t, uploadBlock(ctx, logger, bkt, bdir, extLset, 0, true, false))
+	testutil.Equals(t, 0, len(bkt.Objects()))
+
+	meta, err := block.ReadMetaFile(bdir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(meta.Thanos.Labels))
+
+	testutil.Ok(t, uploadBlock(ctx, logger, bkt, bdir, extLset, 0, false, true))
+
+	meta, err = block.ReadMetaFile(bdir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, extLset.Map(), meta.Thanos.Labels)
+
+	ok, err := bkt.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "meta file not uploaded")
+	_, err = os.Stat(filepath.Join(bdir, block.UploadStateFilename))
+	testutil.Assert(t, os.IsNotExist(err), "upload state not removed")
+
+	// Labels of finalized block cannot be changed.
+	testutil.NotOk(t, uploadBlock(ctx, logger, bkt, bdir, labels.FromStrings("ext", "2"), 0, false, false))
+
+	// Blocks are immutable.
+	testutil.NotOk(t, uploadBlock(ctx, logger, bkt, bdir, extLset, 0, false, false))
+}
@@ -2,27 +2,33 @@ package main
 
 import (
 	"context"
+	"io/ioutil"
 	"net"
-	"net/http"
 	"path"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/block"
 	"github.com/improbable-eng/thanos/pkg/compact"
 	"github.com/improbable-eng/thanos/pkg/compact/downsample"
+	"github.com/improbable-eng/thanos/pkg/objstore"
 	"github.com/improbable-eng/thanos/pkg/objstore/client"
-	"github.com/improbable-eng/thanos/pkg/objstore/s3"
 	"github.com/improbable-eng/thanos/pkg/query/ui"
 	"github.com/improbable-eng/thanos/pkg/runutil"
+	"github.com/improbable-eng/thanos/pkg/server"
+	"github.com/improbable-eng/thanos/pkg/status"
+	"github.com/improbable-eng/thanos/pkg/tracing"
 	"github.com/oklog/run"
-	"github.com/oklog/ulid"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/route"
+	"github.com/prometheus/prometheus/config"
 	"github.com/prometheus/tsdb"
 	"gopkg.in/alecthomas/kingpin.v2"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func registerCompact(m map[string]setupFunc, app *kingpin.Application, name string) {
@@ -31,32 +37,158 @@ func registerCompact(m map[string]setupFunc, app *kingpin.Application, name stri
 	haltOnError := cmd.Flag("debug.halt-on-error", "Halt the process if a critical compaction error is detected.").
 		Hidden().Default("true").Bool()
 
+	skipHaltedGroups := cmd.Flag("compact.skip-halted-groups", "Skip compaction groups with critical errors, e.g. overlapping blocks, "+
+		"and continue compacting other groups instead of halting. Skipped groups are exposed by the thanos_compact_group_halted metric "+
+		"and retried after a restart.").Default("false").Bool()
+
+	repairBlocks := cmd.Flag("compact.repair-broken-blocks", "Repair blocks with broken indexes, e.g. duplicated or out of order chunks, "+
+		"into new blocks and mark the broken blocks for deletion. Blocks that cannot be repaired are still excluded from compaction or halt the compactor.").
+		Default("false").Bool()
+
+	streamUpload := cmd.Flag("compact.stream-upload", "Upload chunks of compacted raw blocks while they are written instead of writing them to the "+
+		"data directory first. Reduces disk usage of the compactor, but a failed compaction has to upload the chunks again.").
+		Default("false").Bool()
+
 	httpAddr := cmd.Flag("http-address", "Listen host:port for HTTP endpoints.").
 		Default(defaultHTTPAddr).String()
 
+	httpFlags := server.RegisterHTTPFlags(cmd)
+
 	dataDir := cmd.Flag("data-dir", "Data directory in which to cache blocks and process compactions.").
 		Default("./data").String()
 
-	gcsBucket := cmd.Flag("gcs.bucket", "Google Cloud Storage bucket name for stored blocks.").
-		PlaceHolder("<bucket>").String()
-
-	s3config := s3.RegisterS3Params(cmd)
+	objstoreConfig := client.RegisterParams(cmd)
+	cmd.Flag("gcs.bucket", "Google Cloud Storage bucket name for stored blocks.").
+		PlaceHolder("<bucket>").StringVar(&objstoreConfig.GCSBucket)
 
 	syncDelay := cmd.Flag("sync-delay", "Minimum age of fresh (non-compacted) blocks before they are being processed.").
 		Default("30m").Duration()
 
+	deleteDelay := cmd.Flag("delete-delay", "Time after which blocks marked for deletion are deleted from the bucket. "+
+		"Store gateways must drop marked blocks before, see their --ignore-deletion-marks-delay flag.").
+		Default("48h").Duration()
+
+	partialUploadThreshold := cmd.Flag("partial-upload-threshold", "Age after which blocks without meta file are considered aborted uploads and deleted. "+
+		"Both the creation time of the block in its ID and the last modification of its objects must be older. 0 disables the deletion.").
+		Default("48h").Duration()
+
 	wait := cmd.Flag("wait", "Do not exit after all compactions have been processed and wait for new work.").
 		Short('w').Bool()
 
+	waitInterval := cmd.Flag("wait-interval", "Wait interval between consecutive compaction runs. Only works when --wait flag specified.").
+		Default("5m").Duration()
+
+	metaFetchConcurrency := cmd.Flag("block-meta-fetch-concurrency", "Number of goroutines to use when fetching block metadata from object storage.").
+		Default("32").Int()
+
+	indexSizeLimit := cmd.Flag("index-size-limit", "Maximum projected index size of compacted blocks. Compactions exceeding it are split "+
+		"into multiple blocks by series, as TSDB cannot read indexes above 64GiB. 0 disables the limit.").
+		Default("64GB").Bytes()
+
+	verticalCompaction := cmd.Flag("compact.enable-vertical-compaction", "Merge overlapping raw blocks of a compaction group, "+
+		"e.g. of Prometheus replicas with equal external labels, into one block instead of halting. Samples with equal timestamps are deduplicated.").
+		Default("false").Bool()
+
+	dedupReplicaLabels := cmd.Flag("deduplication.replica-label", "External label identifying replicas of Prometheus HA pairs. "+
+		"Blocks of replicas are merged into one block whose samples are deduplicated like by the querier. Implies vertical compaction. Can be repeated.").
+		Strings()
+
+	compactionConcurrency := cmd.Flag("compact.concurrency", "Number of compaction groups compacted in parallel.").
+		Default("1").Int()
+	maxDiskUsage := cmd.Flag("compact.max-disk-usage", "Maximum projected local disk usage of compactions running in parallel. "+
+		"Compactions wait for others to complete instead of exceeding it, but a single compaction may always run. 0 disables the limit.").
+		Default("0").Bytes()
+
+	selectorRelabelConfigFile := cmd.Flag("selector.relabel-config-file", "Path to YAML file with relabel configs applied to the "+
+		"external labels of blocks. Blocks dropped by the relabeling are neither compacted nor downsampled, so multiple compactors "+
+		"can each own a disjoint shard of the bucket, e.g. by the hashmod action.").PlaceHolder("<file-path>").String()
+	selectorRelabelConfig := cmd.Flag("selector.relabel-config", "Alternative to 'selector.relabel-config-file' flag. "+
+		"Relabel configs in YAML.").PlaceHolder("<content>").String()
+
+	downloadConcurrency := cmd.Flag("download.concurrency", "Number of chunk segment files of a block downloaded in parallel.").
+		Default("1").Int()
+	downloadRetries := cmd.Flag("download.retries", "Number of times the download of a single block file is retried after network errors not retried by the bucket already.").
+		Default("3").Int()
+
+	uploadConcurrency := cmd.Flag("upload.concurrency", "Number of chunk segment files of a compacted block uploaded in parallel.").
+		Default("1").Int()
+
+	maxBlockDuration := cmd.Flag("compact.max-block-duration", "Maximum time range of compacted blocks, e.g. to keep blocks small enough "+
+		"for store gateways with little memory. Compaction levels with larger ranges are disabled. Blocks shorter than the min source "+
+		"range of a downsampling level are not downsampled to its resolution.").Default("14d").String()
+
+	disableDownsampling := cmd.Flag("downsampling.disable", "Disable downsampling. Only raw blocks are compacted and retained, "+
+		"so long time ranges are queried from raw data.").Default("false").Bool()
+	downsampleLevels := registerDownsampleLevelsFlag(cmd)
+	downsampleConcurrency := cmd.Flag("downsample.concurrency", "Number of blocks downsampled in parallel. "+
+		"Downsamplings share the limit of --compact.max-disk-usage, as they do not run at the same time as compactions.").
+		Default("1").Int()
+
+	retentionFlags := registerRetentionFlags(cmd)
+
 	m[name] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer) error {
-		return runCompact(g, logger, reg,
+		retentionByResolution, err := retentionFlags.byResolution()
+		if err != nil {
+			return err
+		}
+		selectorRelabelConfigs, err := parseRelabelConfigs(*selectorRelabelConfigFile, *selectorRelabelConfig)
+		if err != nil {
+			return err
+		}
+		ranges, err := compactionRanges(*maxBlockDuration)
+		if err != nil {
+			return err
+		}
+		levels, err := downsample.ParseLevels(*downsampleLevels)
+		if err != nil {
+			return err
+		}
+		if *downsampleConcurrency <= 0 {
+			return errors.Errorf("invalid downsample concurrency %d, must be positive", *downsampleConcurrency)
+		}
+		if *wait && *waitInterval <= 0 {
+			return errors.Errorf("invalid wait interval %s, must be positive", *waitInterval)
+		}
+		return runCompact(g, logger, reg, tracer,
 			*httpAddr,
+			httpFlags,
+			newStatus(app, name),
 			*dataDir,
-			*gcsBucket,
-			s3config,
+			objstoreConfig,
 			*syncDelay,
+			*deleteDelay,
+			*partialUploadThreshold,
 			*haltOnError,
+			*skipHaltedGroups,
+			*repairBlocks,
+			*streamUpload,
 			*wait,
+			*waitInterval,
+			*metaFetchConcurrency,
+			int64(*indexSizeLimit),
+			*verticalCompaction,
+			*dedupReplicaLabels,
+			selectorRelabelConfigs,
+			*compactionConcurrency,
+			int64(*maxDiskUsage),
+			ranges,
+			*disableDownsampling,
+			levels,
+			*downsampleConcurrency,
+			retentionByResolution,
+			block.DownloadOptions{
+				Concurrency: *downloadConcurrency,
+				Backoff: block.Backoff{
+					MaxRetries: *downloadRetries,
+					MinBackoff: block.DefaultBackoff.MinBackoff,
+					MaxBackoff: block.DefaultBackoff.MaxBackoff,
+					Jitter:     block.DefaultBackoff.Jitter,
+				},
+			},
+			block.UploadOptions{
+				Concurrency: *uploadConcurrency,
+				Backoff:     block.DefaultBackoff,
+			},
 			name,
 		)
 	}
@@ -66,13 +198,35 @@ func runCompact(
 	g *run.Group,
 	logger log.Logger,
 	reg *prometheus.Registry,
+	tracer opentracing.Tracer,
 	httpAddr string,
+	httpFlags *server.HTTPFlags,
+	st *status.Status,
 	dataDir string,
-	gcsBucket string,
-	s3Config *s3.Config,
+	objstoreConfig *client.Config,
 	syncDelay time.Duration,
+	deleteDelay time.Duration,
+	partialUploadThreshold time.Duration,
 	haltOnError bool,
+	skipHaltedGroups bool,
+	repairBlocks bool,
+	streamUpload bool,
 	wait bool,
+	waitInterval time.Duration,
+	metaFetchConcurrency int,
+	indexSizeLimit int64,
+	verticalCompaction bool,
+	dedupReplicaLabels []string,
+	selectorRelabelConfigs []*config.RelabelConfig,
+	compactionConcurrency int,
+	maxDiskUsage int64,
+	ranges []int64,
+	disableDownsampling bool,
+	downsampleLevels []downsample.Level,
+	downsampleConcurrency int,
+	retentionByResolution map[int64]time.Duration,
+	downloadOpts block.DownloadOptions,
+	uploadOpts block.UploadOptions,
 	component string,
 ) error {
 	halted := prometheus.NewGauge(prometheus.GaugeOpts{
@@ -83,11 +237,22 @@ func runCompact(
 		Name: "thanos_compactor_retries_total",
 		Help: "Total number of retries after retriable compactor error",
 	})
+	partialUploads := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "thanos_compactor_partial_uploads_deleted_total",
+		Help: "Total number of blocks without meta file deleted as aborted partial uploads",
+	})
+	iterations := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "thanos_compact_iteration_duration_seconds",
+		Help:    "Duration of successful compaction iterations, including downsampling, retention and cleanup",
+		Buckets: prometheus.ExponentialBuckets(60, 2, 12),
+	})
 	halted.Set(0)
 
-	reg.MustRegister(halted)
+	reg.MustRegister(halted, retried, partialUploads, iterations)
+	dsMetrics := newDownsampleMetrics(reg)
+	downsampleDisk := compact.NewDiskBudget(maxDiskUsage)
 
-	bkt, closeFn, err := client.NewBucket(&gcsBucket, *s3Config, reg, component)
+	bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, component)
 	if err != nil {
 		return err
 	}
@@ -99,40 +264,81 @@ func runCompact(
 		}
 	}()
 
-	sy, err := compact.NewSyncer(logger, reg, bkt, syncDelay)
+	// Metas are cached on disk, so they are not downloaded again after restarts.
+	// Blocks of replicas are grouped together without their replica labels, so they are compacted vertically.
+	// Shards are selected afterwards, so all replicas belong to the same shard.
+	var filters, downsampleFilters []block.MetaFilter
+	if len(dedupReplicaLabels) > 0 {
+		filters = append(filters, block.NewReplicaLabelRemover(dedupReplicaLabels))
+		verticalCompaction = true
+	}
+	if len(selectorRelabelConfigs) > 0 {
+		filters = append(filters, block.NewRelabelFilter(selectorRelabelConfigs))
+		downsampleFilters = append(downsampleFilters, block.NewRelabelFilter(selectorRelabelConfigs))
+	}
+	fetcher, err := block.NewMetaFetcher(logger, reg, bkt, metaFetchConcurrency, path.Join(dataDir, "meta-syncer"), filters...)
+	if err != nil {
+		return errors.Wrap(err, "create meta fetcher")
+	}
+	// Downsampled blocks keep the labels of their sources, so downsampling fetches metas without the replica label
+	// remover. It shares the disk cache, its metrics are not registered twice.
+	dsFetcher, err := block.NewMetaFetcher(logger, nil, bkt, metaFetchConcurrency, path.Join(dataDir, "meta-syncer"), downsampleFilters...)
+	if err != nil {
+		return errors.Wrap(err, "create downsample meta fetcher")
+	}
+	sy, err := compact.NewSyncer(logger, reg, bkt, fetcher, compact.SyncerOptions{
+		SyncDelay: syncDelay,
+		GroupOptions: compact.GroupOptions{
+			Download:             downloadOpts,
+			Upload:               uploadOpts,
+			IndexSizeLimit:       indexSizeLimit,
+			VerticalCompaction:   verticalCompaction,
+			PenaltyDeduplication: len(dedupReplicaLabels) > 0,
+			RepairBlocks:         repairBlocks,
+			StreamUpload:         streamUpload,
+		},
+	})
 	if err != nil {
 		return err
 	}
+
+	bucketUI := ui.NewBucketUI(logger, waitInterval)
 	// Start cycle of syncing blocks from the bucket and garbage collecting the bucket.
 	{
-		// Instantiate the compactor with different time slices. Timestamps in TSDB
-		// are in milliseconds.
-		comp, err := tsdb.NewLeveledCompactor(reg, logger, []int64{
-			int64(1 * time.Hour / time.Millisecond),
-			int64(2 * time.Hour / time.Millisecond),
-			int64(8 * time.Hour / time.Millisecond),
-			int64(2 * 24 * time.Hour / time.Millisecond),  // 2 days
-			int64(14 * 24 * time.Hour / time.Millisecond), // 2 weeks
-		}, downsample.NewPool())
+		maxRange := ranges[len(ranges)-1]
+		for _, l := range downsampleLevels {
+			if maxRange < l.MinSourceRange && !disableDownsampling {
+				level.Warn(logger).Log("msg", "compacted blocks are too short to be downsampled to the resolution of a level",
+					"max_block_duration", time.Duration(maxRange)*time.Millisecond, "resolution", time.Duration(l.Resolution)*time.Millisecond)
+			}
+		}
+		comp, err := tsdb.NewLeveledCompactor(reg, logger, ranges, downsample.NewPool())
 		if err != nil {
 			return errors.Wrap(err, "create compactor")
 		}
+		compactDir := path.Join(dataDir, "compact")
+
+		bcomp, err := compact.NewBucketCompactor(logger, reg, comp, compactDir, compactionConcurrency, maxDiskUsage, skipHaltedGroups)
+		if err != nil {
+			return errors.Wrap(err, "create bucket compactor")
+		}
 
 		ctx, cancel := context.WithCancel(context.Background())
+		ctx = tracing.ContextWithTracer(ctx, tracer)
 
 		f := func() error {
-			var (
-				compactDir      = path.Join(dataDir, "compact")
-				downsamplingDir = path.Join(dataDir, "downsample")
-			)
+			downsamplingDir := path.Join(dataDir, "downsample")
+			begin := time.Now()
 
 			// Loop over bucket and compact until there's no work left.
 			for {
 				level.Info(logger).Log("msg", "start sync of metas")
 
 				if err := sy.SyncMetas(ctx); err != nil {
+					bucketUI.Set(nil, err)
 					return errors.Wrap(err, "sync")
 				}
+				bucketUI.Set(sy.Metas(), nil)
 
 				level.Info(logger).Log("msg", "start of GC")
 
@@ -144,17 +350,13 @@ func runCompact(
 				if err != nil {
 					return errors.Wrap(err, "build compaction groups")
 				}
-				done := true
-				for _, g := range groups {
-					id, err := g.Compact(ctx, compactDir, comp)
-					if err != nil {
-						return errors.Wrap(err, "compaction")
-					}
-					// If the returned ID has a zero value, the group had no blocks to be compacted.
-					// We keep going through the outer loop until no group has any work left.
-					if id != (ulid.ULID{}) {
-						done = false
-					}
+				if err := bcomp.UpdateProgress(groups); err != nil {
+					level.Warn(logger).Log("msg", "failed to update compaction progress", "err", err)
+				}
+				// We keep going through the outer loop until no group has any work left.
+				done, err := bcomp.Compact(ctx, groups)
+				if err != nil {
+					return errors.Wrap(err, "compaction")
 				}
 				if done {
 					break
@@ -162,21 +364,36 @@ func runCompact(
 			}
 
 			// After all compactions are done, work down the downsampling backlog.
-			// We run two passes of this to ensure that the 1h downsampling is generated
-			// for 5m downsamplings created in the first run.
-			level.Info(logger).Log("msg", "start first pass of downsampling")
+			// We run a pass for each level to ensure that blocks downsampled by a pass are
+			// downsampled to the next level by the following one.
+			if disableDownsampling {
+				level.Info(logger).Log("msg", "downsampling is disabled")
+			} else {
+				for i := range downsampleLevels {
+					level.Info(logger).Log("msg", "start pass of downsampling", "pass", i+1)
+
+					if err := downsampleBucket(ctx, logger, dsMetrics, bkt, dsFetcher, downsamplingDir, downsampleLevels, downsampleConcurrency, downsampleDisk); err != nil {
+						return errors.Wrapf(err, "pass %d of downsampling failed", i+1)
+					}
+				}
+			}
 
-			if err := downsampleBucket(ctx, logger, bkt, downsamplingDir); err != nil {
-				return errors.Wrap(err, "first pass of downsampling failed")
+			if err := applyRetention(ctx, logger, bkt, sy, retentionByResolution); err != nil {
+				return err
 			}
 
-			level.Info(logger).Log("msg", "start second pass of downsampling")
+			level.Info(logger).Log("msg", "start cleanup of blocks marked for deletion and aborted partial uploads")
 
-			if err := downsampleBucket(ctx, logger, bkt, downsamplingDir); err != nil {
-				return errors.Wrap(err, "second pass of downsampling failed")
+			stats, err := compact.Cleanup(ctx, logger, bkt, nil, deleteDelay, partialUploadThreshold, false)
+			partialUploads.Add(float64(stats.PartialUploads))
+			if err != nil {
+				return errors.Wrap(err, "cleanup")
 			}
+			level.Info(logger).Log("msg", "cleanup done", "deletedBlocks", stats.DeletedBlocks, "pendingDeletions", stats.PendingDeletions,
+				"partialUploads", stats.PartialUploads, "deletedBytes", stats.DeletedBytes)
 
-			level.Info(logger).Log("msg", "compaction iteration done")
+			iterations.Observe(time.Since(begin).Seconds())
+			level.Info(logger).Log("msg", "compaction iteration done", "haltedGroups", bcomp.HaltedGroups(), "duration", time.Since(begin))
 			return nil
 		}
 
@@ -188,7 +405,7 @@ func runCompact(
 			}
 
 			// --wait=true is specified.
-			return runutil.Repeat(5*time.Minute, ctx.Done(), func() error {
+			return runutil.Repeat(waitInterval, ctx.Done(), func() error {
 				err := f()
 				if err != nil {
 					// The HaltError type signals that we hit a critical bug and should block
@@ -209,7 +426,7 @@ func runCompact(
 					if compact.IsRetryError(err) {
 						level.Error(logger).Log("msg", "retriable error", "err", err)
 						retried.Inc()
-						// TODO(bplotka): use actual "retry()" here instead of waiting 5 minutes?
+						// TODO(bplotka): use actual "retry()" here instead of waiting the whole wait interval?
 						return nil
 					}
 				}
@@ -222,13 +439,17 @@ func runCompact(
 	}
 	// Start metric and profiling endpoints.
 	{
+		srv, err := server.NewHTTPServer(logger, reg, httpFlags)
+		if err != nil {
+			return errors.Wrap(err, "create HTTP server")
+		}
 		router := route.New()
-		ui.New(logger, nil).Register(router)
+		bucketUI.Register(router)
 
-		mux := http.NewServeMux()
-		registerMetrics(mux, reg)
-		registerProfile(mux)
-		mux.Handle("/", router)
+		registerMetrics(srv, reg)
+		registerProfile(srv)
+		st.Register(srv)
+		srv.Handle("/", router)
 
 		l, err := net.Listen("tcp", httpAddr)
 		if err != nil {
@@ -236,12 +457,119 @@ func runCompact(
 		}
 
 		g.Add(func() error {
-			return errors.Wrap(http.Serve(l, mux), "serve query")
+			return errors.Wrap(srv.Serve(l), "serve query")
 		}, func(error) {
-			l.Close()
+			srv.Shutdown()
 		})
+		srv.Ready()
 	}
 
 	level.Info(logger).Log("msg", "starting compact node")
 	return nil
 }
+
+// compactionRanges returns the time ranges of the compaction levels in milliseconds, which are the timestamp unit
+// of TSDB. Levels with ranges above the given maximum block duration are left out.
+func compactionRanges(maxBlockDuration string) ([]int64, error) {
+	d, err := model.ParseDuration(maxBlockDuration)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse max block duration %s", maxBlockDuration)
+	}
+	var ranges []int64
+	for _, r := range []time.Duration{
+		1 * time.Hour,
+		2 * time.Hour,
+		8 * time.Hour,
+		2 * 24 * time.Hour,  // 2 days
+		14 * 24 * time.Hour, // 2 weeks
+	} {
+		if r > time.Duration(d) {
+			break
+		}
+		ranges = append(ranges, int64(r/time.Millisecond))
+	}
+	// The planner compacts blocks of one range into the next one, so it needs at least two of them.
+	if len(ranges) < 2 {
+		return nil, errors.Errorf("max block duration %s is too short, must be at least 2h", maxBlockDuration)
+	}
+	return ranges, nil
+}
+
+// retentionFlags holds the retention of blocks per resolution.
+type retentionFlags struct {
+	raw, res5m, res1h *string
+}
+
+func registerRetentionFlags(cmd *kingpin.CmdClause) *retentionFlags {
+	return &retentionFlags{
+		raw: cmd.Flag("retention.resolution-raw", "How long to retain raw samples in bucket. 0d - disables this retention.").
+			Default("0d").String(),
+		res5m: cmd.Flag("retention.resolution-5m", "How long to retain samples of resolution 1 (5 minutes) in bucket. 0d - disables this retention.").
+			Default("0d").String(),
+		res1h: cmd.Flag("retention.resolution-1h", "How long to retain samples of resolution 2 (1 hour) in bucket. 0d - disables this retention.").
+			Default("0d").String(),
+	}
+}
+
+// byResolution returns the parsed retentions keyed by resolution.
+func (f *retentionFlags) byResolution() (map[int64]time.Duration, error) {
+	retentionByResolution := map[int64]time.Duration{}
+	for res, s := range map[int64]string{
+		downsample.ResLevel0: *f.raw,
+		downsample.ResLevel1: *f.res5m,
+		downsample.ResLevel2: *f.res1h,
+	} {
+		d, err := model.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse retention %s", s)
+		}
+		retentionByResolution[res] = time.Duration(d)
+	}
+	return retentionByResolution, nil
+}
+
+// applyRetention marks the blocks known to the syncer for deletion whose resolution's retention is exceeded. They
+// are deleted by the cleanup after the delete delay.
+func applyRetention(ctx context.Context, logger log.Logger, bkt objstore.Bucket, sy *compact.Syncer, retentionByResolution map[int64]time.Duration) error {
+	enabled := false
+	for _, d := range retentionByResolution {
+		if d > 0 {
+			enabled = true
+		}
+	}
+	if !enabled {
+		return nil
+	}
+	level.Info(logger).Log("msg", "start of retention")
+
+	var metas []*block.Meta
+	for _, m := range sy.Metas() {
+		m := m
+		metas = append(metas, &m)
+	}
+	n, err := compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, metas, retentionByResolution, false)
+	if err != nil {
+		return errors.Wrap(err, "retention")
+	}
+	level.Info(logger).Log("msg", "retention done", "markedBlocks", n)
+	return nil
+}
+
+// parseRelabelConfigs returns the relabel configs given either as a path or as the YAML content.
+func parseRelabelConfigs(path, content string) ([]*config.RelabelConfig, error) {
+	if path != "" && content != "" {
+		return nil, errors.New("both selector.relabel-config-file and selector.relabel-config flags are set, only one is allowed")
+	}
+	b := []byte(content)
+	if path != "" {
+		var err error
+		if b, err = ioutil.ReadFile(path); err != nil {
+			return nil, errors.Wrap(err, "read relabel config file")
+		}
+	}
+	var relabelConfigs []*config.RelabelConfig
+	if err := yaml.UnmarshalStrict(b, &relabelConfigs); err != nil {
+		return nil, errors.Wrap(err, "parse relabel configs")
+	}
+	return relabelConfigs, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/compact"
+	"github.com/improbable-eng/thanos/pkg/compact/downsample"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/tsdb"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestCompactionRanges(t *testing.T) {
+	const h = int64(60 * 60 * 1000)
+
+	ranges, err := compactionRanges("14d")
+	testutil.Ok(t, err)
+	testutil.Equals(t, []int64{h, 2 * h, 8 * h, 48 * h, 14 * 24 * h}, ranges)
+
+	// Levels are dropped if their range exceeds the maximum.
+	ranges, err = compactionRanges("3d")
+	testutil.Ok(t, err)
+	testutil.Equals(t, []int64{h, 2 * h, 8 * h, 48 * h}, ranges)
+
+	ranges, err = compactionRanges("2h")
+	testutil.Ok(t, err)
+	testutil.Equals(t, []int64{h, 2 * h}, ranges)
+
+	for _, d := range []string{"1h", "0d", "invalid"} {
+		_, err := compactionRanges(d)
+		testutil.Assert(t, err != nil, "expected error for max block duration %s", d)
+	}
+}
+
+func TestRetentionFlags(t *testing.T) {
+	parse := func(args ...string) (map[int64]time.Duration, error) {
+		app := kingpin.New("thanos", "")
+		f := registerRetentionFlags(app.Command("compact", ""))
+		_, err := app.Parse(append([]string{"compact"}, args...))
+		testutil.Ok(t, err)
+		return f.byResolution()
+	}
+
+	// Retention is disabled for all resolutions by default.
+	r, err := parse()
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[int64]time.Duration{
+		downsample.ResLevel0: 0,
+		downsample.ResLevel1: 0,
+		downsample.ResLevel2: 0,
+	}, r)
+
+	r, err = parse("--retention.resolution-raw=30d", "--retention.resolution-1h=1y")
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[int64]time.Duration{
+		downsample.ResLevel0: 30 * 24 * time.Hour,
+		downsample.ResLevel1: 0,
+		downsample.ResLevel2: 365 * 24 * time.Hour,
+	}, r)
+
+	_, err = parse("--retention.resolution-5m=invalid")
+	testutil.NotOk(t, err)
+}
+
+func TestApplyRetention(t *testing.T) {
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+
+	upload := func(id uint64, res int64, age time.Duration) ulid.ULID {
+		m := block.Meta{
+			Version: 1,
+			BlockMeta: tsdb.BlockMeta{
+				ULID:    ulid.MustNew(id, nil),
+				MaxTime: time.Now().Add(-age).UnixNano() / int64(time.Millisecond),
+			},
+		}
+		m.Thanos.Downsample.Resolution = res
+
+		var buf bytes.Buffer
+		testutil.Ok(t, json.NewEncoder(&buf).Encode(&m))
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(m.ULID.String(), block.MetaFilename), &buf))
+		return m.ULID
+	}
+	oldRaw := upload(1, downsample.ResLevel0, 48*time.Hour)
+	newRaw := upload(2, downsample.ResLevel0, 12*time.Hour)
+	old5m := upload(3, downsample.ResLevel1, 48*time.Hour)
+	old1h := upload(4, downsample.ResLevel2, 48*time.Hour)
+
+	fetcher, err := block.NewMetaFetcher(nil, nil, bkt, 4, "")
+	testutil.Ok(t, err)
+	sy, err := compact.NewSyncer(nil, nil, bkt, fetcher, compact.SyncerOptions{})
+	testutil.Ok(t, err)
+	testutil.Ok(t, sy.SyncMetas(ctx))
+	testutil.Equals(t, 4, len(sy.Metas()))
+
+	marked := func(id ulid.ULID) bool {
+		_, err := block.ReadDeletionMark(ctx, bkt, id)
+		if err == block.ErrMarkNotFound {
+			return false
+		}
+		testutil.Ok(t, err)
+		return true
+	}
+
+	// Disabled retention marks nothing.
+	testutil.Ok(t, applyRetention(ctx, log.NewNopLogger(), bkt, sy, map[int64]time.Duration{
+		downsample.ResLevel0: 0,
+		downsample.ResLevel1: 0,
+		downsample.ResLevel2: 0,
+	}))
+	for _, id := range []ulid.ULID{oldRaw, newRaw, old5m, old1h} {
+		testutil.Assert(t, !marked(id), "block %s unexpectedly marked for deletion", id)
+	}
+
+	// Only blocks of the resolution with retention are marked once their data is older than the retention.
+	testutil.Ok(t, applyRetention(ctx, log.NewNopLogger(), bkt, sy, map[int64]time.Duration{
+		downsample.ResLevel0: 24 * time.Hour,
+		downsample.ResLevel1: 0,
+		downsample.ResLevel2: 0,
+	}))
+	testutil.Assert(t, marked(oldRaw), "expected block %s to be marked for deletion", oldRaw)
+	for _, id := range []ulid.ULID{newRaw, old5m, old1h} {
+		testutil.Assert(t, !marked(id), "block %s unexpectedly marked for deletion", id)
+	}
+}
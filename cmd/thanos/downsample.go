@@ -2,12 +2,11 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"net"
-	"net/http"
 	"os"
-	"path"
 	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/prometheus/tsdb/chunkenc"
@@ -15,10 +14,12 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/compact"
 	"github.com/improbable-eng/thanos/pkg/compact/downsample"
 	"github.com/improbable-eng/thanos/pkg/objstore"
 	"github.com/improbable-eng/thanos/pkg/objstore/client"
-	"github.com/improbable-eng/thanos/pkg/objstore/s3"
+	"github.com/improbable-eng/thanos/pkg/server"
+	"github.com/improbable-eng/thanos/pkg/status"
 	"github.com/oklog/run"
 	"github.com/oklog/ulid"
 	"github.com/opentracing/opentracing-go"
@@ -34,19 +35,35 @@ func registerDownsample(m map[string]setupFunc, app *kingpin.Application, name s
 	httpAddr := cmd.Flag("http-address", "listen host:port for HTTP endpoints").
 		Default(defaultHTTPAddr).String()
 
+	httpFlags := server.RegisterHTTPFlags(cmd)
+
 	dataDir := cmd.Flag("data-dir", "Data directory in which to cache blocks and process downsamplings.").
 		Default("./data").String()
 
-	gcsBucket := cmd.Flag("gcs.bucket", "Google Cloud Storage bucket name for stored blocks.").
-		PlaceHolder("<bucket>").Required().String()
-
 	syncDelay := cmd.Flag("sync-delay", "Minimum age of blocks before they are being processed.").
 		Default("2h").Duration()
 
-	s3Config := s3.RegisterS3Params(cmd)
+	objstoreConfig := client.RegisterParams(cmd)
+	cmd.Flag("gcs.bucket", "Google Cloud Storage bucket name for stored blocks.").
+		PlaceHolder("<bucket>").StringVar(&objstoreConfig.GCSBucket)
+	downsampleLevels := registerDownsampleLevelsFlag(cmd)
+	concurrency := cmd.Flag("downsample.concurrency", "Number of blocks downsampled in parallel.").
+		Default("1").Int()
+	metaFetchConcurrency := cmd.Flag("block-meta-fetch-concurrency", "Number of goroutines to use when fetching block metadata from object storage.").
+		Default("32").Int()
+	maxDiskUsage := cmd.Flag("downsample.max-disk-usage", "Maximum projected local disk usage of downsamplings running in parallel. "+
+		"Downsamplings wait for others to complete instead of exceeding it, but a single downsampling may always run. 0 disables the limit.").
+		Default("0").Bytes()
 
 	m[name] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer) error {
-		return runDownsample(g, logger, reg, *httpAddr, *dataDir, *gcsBucket, s3Config, *syncDelay, name)
+		levels, err := downsample.ParseLevels(*downsampleLevels)
+		if err != nil {
+			return err
+		}
+		if *concurrency <= 0 {
+			return errors.Errorf("invalid downsample concurrency %d, must be positive", *concurrency)
+		}
+		return runDownsample(g, logger, reg, *httpAddr, httpFlags, newStatus(app, name), *dataDir, objstoreConfig, *syncDelay, levels, *concurrency, *metaFetchConcurrency, int64(*maxDiskUsage), name)
 	}
 }
 
@@ -55,14 +72,19 @@ func runDownsample(
 	logger log.Logger,
 	reg *prometheus.Registry,
 	httpAddr string,
+	httpFlags *server.HTTPFlags,
+	st *status.Status,
 	dataDir string,
-	gcsBucket string,
-	s3Config *s3.Config,
+	objstoreConfig *client.Config,
 	syncDelay time.Duration,
+	levels []downsample.Level,
+	concurrency int,
+	metaFetchConcurrency int,
+	maxDiskUsage int64,
 	component string,
 ) error {
 
-	bkt, closeFn, err := client.NewBucket(&gcsBucket, *s3Config, reg, component)
+	bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, component)
 	if err != nil {
 		return err
 	}
@@ -74,24 +96,28 @@ func runDownsample(
 		}
 	}()
 
+	metrics := newDownsampleMetrics(reg)
+	disk := compact.NewDiskBudget(maxDiskUsage)
+	// The data dir is cleaned by every pass, so metas are only cached in memory.
+	fetcher, err := block.NewMetaFetcher(logger, reg, bkt, metaFetchConcurrency, "")
+	if err != nil {
+		return errors.Wrap(err, "create meta fetcher")
+	}
+
 	// Start cycle of syncing blocks from the bucket and garbage collecting the bucket.
 	{
 		ctx, cancel := context.WithCancel(context.Background())
 
 		g.Add(func() error {
 			defer closeFn()
-			level.Info(logger).Log("msg", "start first pass of downsampling")
-
-			if err := downsampleBucket(ctx, logger, bkt, dataDir); err != nil {
-				return errors.Wrap(err, "downsampling failed")
-			}
-
-			level.Info(logger).Log("msg", "start second pass of downsampling")
+			// Each pass downsamples blocks by one level, so blocks created by a pass are downsampled further by the next one.
+			for i := range levels {
+				level.Info(logger).Log("msg", "start pass of downsampling", "pass", i+1)
 
-			if err := downsampleBucket(ctx, logger, bkt, dataDir); err != nil {
-				return errors.Wrap(err, "downsampling failed")
+				if err := downsampleBucket(ctx, logger, metrics, bkt, fetcher, dataDir, levels, concurrency, disk); err != nil {
+					return errors.Wrap(err, "downsampling failed")
+				}
 			}
-
 			return nil
 		}, func(error) {
 			cancel()
@@ -99,9 +125,13 @@ func runDownsample(
 	}
 	// Start metric and profiling endpoints.
 	{
-		mux := http.NewServeMux()
-		registerMetrics(mux, reg)
-		registerProfile(mux)
+		srv, err := server.NewHTTPServer(logger, reg, httpFlags)
+		if err != nil {
+			return errors.Wrap(err, "create HTTP server")
+		}
+		registerMetrics(srv, reg)
+		registerProfile(srv)
+		st.Register(srv)
 
 		l, err := net.Listen("tcp", httpAddr)
 		if err != nil {
@@ -109,21 +139,59 @@ func runDownsample(
 		}
 
 		g.Add(func() error {
-			return errors.Wrap(http.Serve(l, mux), "serve query")
+			return errors.Wrap(srv.Serve(l), "serve query")
 		}, func(error) {
-			l.Close()
+			srv.Shutdown()
 		})
+		srv.Ready()
 	}
 
 	level.Info(logger).Log("msg", "starting compact node")
 	return nil
 }
 
+// registerDownsampleLevelsFlag registers the flag configuring the downsampling ladder.
+func registerDownsampleLevelsFlag(cmd *kingpin.CmdClause) *[]string {
+	return cmd.Flag("downsampling.level", "Downsampling level as <resolution>:<min-source-range>, repeated for each level with "+
+		"increasing resolutions. Raw blocks for the first level and blocks of the previous level otherwise are downsampled "+
+		"to the resolution once they cover the min source range.").Default("5m:40h", "1h:10d").Strings()
+}
+
+// downsampleMetrics holds the metrics of downsampling passes, labeled by the compaction group of the downsampled blocks.
+type downsampleMetrics struct {
+	downsamples *prometheus.CounterVec
+	todoBlocks  *prometheus.GaugeVec
+}
+
+func newDownsampleMetrics(reg prometheus.Registerer) *downsampleMetrics {
+	m := &downsampleMetrics{
+		downsamples: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_compact_downsample_total",
+			Help: "Total number of downsampled blocks.",
+		}, []string{"group"}),
+		todoBlocks: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_compact_todo_downsample_blocks",
+			Help: "Number of blocks of the group left to be downsampled in the current pass.",
+		}, []string{"group"}),
+	}
+	if reg != nil {
+		reg.MustRegister(m.downsamples, m.todoBlocks)
+	}
+	return m
+}
+
+// downsampleBucket downsamples the blocks of the metas fetched by the fetcher by one level. Blocks marked for no
+// downsampling are skipped.
 func downsampleBucket(
 	ctx context.Context,
 	logger log.Logger,
+	metrics *downsampleMetrics,
 	bkt objstore.Bucket,
+	fetcher *block.MetaFetcher,
 	dir string,
+	levels []downsample.Level,
+	concurrency int,
+	disk *compact.DiskBudget,
 ) error {
 	if err := os.RemoveAll(dir); err != nil {
 		return errors.Wrap(err, "clean working directory")
@@ -131,100 +199,145 @@ func downsampleBucket(
 	if err := os.MkdirAll(dir, 0777); err != nil {
 		return errors.Wrap(err, "create dir")
 	}
-	var metas []*block.Meta
-
-	err := bkt.Iter(ctx, "", func(name string) error {
-		id, ok := block.IsBlockDir(name)
-		if !ok {
-			return nil
-		}
 
-		rc, err := bkt.Get(ctx, path.Join(id.String(), block.MetaFilename))
-		if err != nil {
-			return errors.Wrapf(err, "get meta for block %s", id)
-		}
-		defer rc.Close()
-
-		var m block.Meta
-		if err := json.NewDecoder(rc).Decode(&m); err != nil {
-			return errors.Wrap(err, "decode meta")
-		}
-		metas = append(metas, &m)
-
-		return nil
-	})
+	fetched, _, err := fetcher.Fetch(ctx)
 	if err != nil {
-		return errors.Wrap(err, "retrieve bucket block metas")
+		return errors.Wrap(err, "fetch bucket block metas")
+	}
+	// Blocks are processed in the order of their IDs like in the listing of the bucket.
+	metas := make([]*block.Meta, 0, len(fetched))
+	for _, m := range fetched {
+		metas = append(metas, m)
 	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].ULID.Compare(metas[j].ULID) < 0 })
 
-	// mapping from a hash over all source IDs to blocks. We don't need to downsample a block
+	// mapping from a hash over all source IDs to blocks per resolution. We don't need to downsample a block
 	// if a downsampled version with the same hash already exists.
-	sources5m := map[ulid.ULID]struct{}{}
-	sources1h := map[ulid.ULID]struct{}{}
-
+	// Split blocks only hold a shard of the series of their sources, so sources are tracked per shard.
+	// Blocks of resolutions that are not a level, e.g. of a level removed from the configuration, are ignored.
+	sources := map[int64]map[string]struct{}{}
+	for _, l := range levels {
+		sources[l.Resolution] = map[string]struct{}{}
+	}
 	for _, m := range metas {
-		switch m.Thanos.Downsample.Resolution {
-		case 0:
+		s, ok := sources[m.Thanos.Downsample.Resolution]
+		if !ok {
 			continue
-		case 5 * 60 * 1000:
-			for _, id := range m.Compaction.Sources {
-				sources5m[id] = struct{}{}
-			}
-		case 60 * 60 * 1000:
-			for _, id := range m.Compaction.Sources {
-				sources1h[id] = struct{}{}
-			}
-		default:
-			return errors.Errorf("unexpected downsampling resolution %d", m.Thanos.Downsample.Resolution)
+		}
+		for _, id := range m.Compaction.Sources {
+			s[sourceKey(m, id)] = struct{}{}
 		}
 	}
 
+	// Blocks are counted as planned downsamplings per group before any of them is processed, so the metric shows the
+	// remaining work of the pass.
+	var planned []*block.Meta
+	metrics.todoBlocks.Reset()
 	for _, m := range metas {
-		switch m.Thanos.Downsample.Resolution {
-		case 0:
-			missing := false
-			for _, id := range m.Compaction.Sources {
-				if _, ok := sources5m[id]; !ok {
-					missing = true
-					break
+		if downsampleResolution(m, levels, sources) == 0 {
+			continue
+		}
+		if fetcher.Marked(m.ULID, block.NoDownsampleMarkFilename) {
+			level.Debug(logger).Log("msg", "skipping block marked for no downsampling", "block", m.ULID)
+			continue
+		}
+		planned = append(planned, m)
+		metrics.todoBlocks.WithLabelValues(compact.GroupKey(*m)).Inc()
+	}
+
+	// Blocks are downsampled by concurrency workers. After the first failed downsampling no further ones are started
+	// and its error is returned once the running ones completed.
+	var (
+		wg       sync.WaitGroup
+		mtx      sync.Mutex
+		firstErr error
+		metac    = make(chan *block.Meta)
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for m := range metac {
+				size := projectedDownsampleDiskUsage(m)
+				derr := disk.Reserve(ctx, size)
+				if derr == nil {
+					derr = processDownsampling(ctx, logger, bkt, m, dir, downsampleResolution(m, levels, sources))
+					disk.Release(size)
 				}
-			}
-			if !missing {
-				continue
-			}
-			// Only downsample blocks once we are sure to get roughly 2 chunks out of it.
-			// NOTE(fabxc): this must match with at which block size the compactor creates downsampled
-			// blockes. Otherwise we may never downsample some data.
-			if m.MaxTime-m.MinTime < 40*60*60*1000 {
-				continue
-			}
-			if err := processDownsampling(ctx, logger, bkt, m, dir, 5*60*1000); err != nil {
-				return err
-			}
 
-		case 5 * 60 * 1000:
-			missing := false
-			for _, id := range m.Compaction.Sources {
-				if _, ok := sources1h[id]; !ok {
-					missing = true
-					break
+				if derr != nil {
+					mtx.Lock()
+					if firstErr == nil {
+						firstErr = derr
+					}
+					mtx.Unlock()
+					continue
 				}
+				metrics.downsamples.WithLabelValues(compact.GroupKey(*m)).Inc()
+				metrics.todoBlocks.WithLabelValues(compact.GroupKey(*m)).Dec()
 			}
-			if !missing {
-				continue
-			}
-			// Only downsample blocks once we are sure to get roughly 2 chunks out of it.
-			// NOTE(fabxc): this must match with at which block size the compactor creates downsampled
-			// blockes. Otherwise we may never downsample some data.
-			if m.MaxTime-m.MinTime < 10*24*60*60*1000 {
-				continue
-			}
-			if err := processDownsampling(ctx, logger, bkt, m, dir, 60*60*1000); err != nil {
-				return err
-			}
+		}()
+	}
+
+	for _, m := range planned {
+		mtx.Lock()
+		failed := firstErr != nil
+		mtx.Unlock()
+		if failed {
+			break
 		}
+		metac <- m
 	}
-	return nil
+	close(metac)
+	wg.Wait()
+
+	return firstErr
+}
+
+// projectedDownsampleDiskUsage returns the local disk space a downsampling of the block needs at most. The block is
+// downloaded and the downsampled block is at most as large as the original one. Sizes of blocks without file inventory
+// are unknown.
+func projectedDownsampleDiskUsage(m *block.Meta) (size int64) {
+	for _, f := range m.Thanos.Files {
+		size += f.SizeBytes
+	}
+	return 2 * size
+}
+
+// downsampleResolution returns the resolution the block of the given meta has to be downsampled to, or zero if there is
+// nothing to do. Blocks are not downsampled again if all their sources are already held by blocks of the target resolution.
+func downsampleResolution(m *block.Meta, levels []downsample.Level, sources map[int64]map[string]struct{}) int64 {
+	l, ok := downsample.NextLevel(levels, m.Thanos.Downsample.Resolution)
+	if !ok {
+		return 0
+	}
+
+	missing := false
+	for _, id := range m.Compaction.Sources {
+		if _, ok := sources[l.Resolution][sourceKey(m, id)]; !ok {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return 0
+	}
+	// Only downsample blocks once we are sure to get roughly 2 chunks out of it.
+	// NOTE(fabxc): this must match with at which block size the compactor creates downsampled
+	// blockes. Otherwise we may never downsample some data.
+	if m.MaxTime-m.MinTime < l.MinSourceRange {
+		return 0
+	}
+	return l.Resolution
+}
+
+// sourceKey identifies the data of a source block held by the block with the given meta.
+func sourceKey(m *block.Meta, id ulid.ULID) string {
+	if m.Thanos.Split == nil {
+		return id.String()
+	}
+	return id.String() + "/" + m.Thanos.Split.String()
 }
 
 func processDownsampling(ctx context.Context, logger log.Logger, bkt objstore.Bucket, m *block.Meta, dir string, resolution int64) error {
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/compact"
+	"github.com/improbable-eng/thanos/pkg/compact/downsample"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/tsdb/labels"
+)
+
+func TestDownsampleBucket_NoDownsampleMark(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-downsample-bucket")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+	logger := log.NewNopLogger()
+
+	var ids []ulid.ULID
+	for i := 0; i < 2; i++ {
+		id, err := testutil.CreateBlock(filepath.Join(dir, "blocks"), []labels.Labels{
+			{{Name: "a", Value: "1"}},
+		}, 100, 0, int64(2*time.Hour/time.Millisecond), labels.FromStrings("ext", "1"), 0)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, bkt, filepath.Join(dir, "blocks", id.String())))
+		ids = append(ids, id)
+	}
+	testutil.Ok(t, block.MarkForNoDownsample(ctx, logger, bkt, ids[1], "test"))
+
+	levels, err := downsample.ParseLevels([]string{"5m:1h"})
+	testutil.Ok(t, err)
+	fetcher, err := block.NewMetaFetcher(nil, nil, bkt, 1, "")
+	testutil.Ok(t, err)
+	testutil.Ok(t, downsampleBucket(ctx, logger, newDownsampleMetrics(nil), bkt, fetcher, filepath.Join(dir, "downsample"),
+		levels, 1, compact.NewDiskBudget(0)))
+
+	// Only the unmarked block is downsampled.
+	metas, _, err := fetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	var sources []ulid.ULID
+	for _, m := range metas {
+		if m.Thanos.Downsample.Resolution == downsample.ResLevel1 {
+			sources = append(sources, m.Compaction.Sources...)
+		}
+	}
+	testutil.Equals(t, []ulid.ULID{ids[0]}, sources)
+}
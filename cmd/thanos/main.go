@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/pprof"
 	"os"
@@ -19,6 +21,10 @@ import (
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	"github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/improbable-eng/thanos/pkg/memlimit"
+	"github.com/improbable-eng/thanos/pkg/server"
+	thanosstatus "github.com/improbable-eng/thanos/pkg/status"
+	thanostls "github.com/improbable-eng/thanos/pkg/tls"
 	"github.com/improbable-eng/thanos/pkg/tracing"
 	"github.com/oklog/run"
 	"github.com/opentracing/opentracing-go"
@@ -26,16 +32,25 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/version"
+	"github.com/soheilhy/cmux"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
 const (
-	defaultClusterAddr = "0.0.0.0:10900"
-	defaultGRPCAddr    = "0.0.0.0:10901"
-	defaultHTTPAddr    = "0.0.0.0:10902"
+	defaultGRPCAddr = "0.0.0.0:10901"
+	defaultHTTPAddr = "0.0.0.0:10902"
+)
+
+const (
+	logFormatLogfmt = "logfmt"
+	logFormatJSON   = "json"
 )
 
 type setupFunc func(*run.Group, log.Logger, *prometheus.Registry, opentracing.Tracer) error
@@ -55,12 +70,24 @@ func main() {
 
 	logLevel := app.Flag("log.level", "Log filtering level.").
 		Default("info").Enum("error", "warn", "info", "debug")
+	logFormat := app.Flag("log.format", "Log format to use. Possible options: logfmt or json.").
+		Default(logFormatLogfmt).Enum(logFormatLogfmt, logFormatJSON)
 
 	gcloudTraceProject := app.Flag("gcloudtrace.project", "GCP project to send Google Cloud Trace tracings to. If empty, tracing will be disabled.").
 		String()
 	gcloudTraceSampleFactor := app.Flag("gcloudtrace.sample-factor", "How often we send traces (1/<sample-factor>). If 0 no trace will be sent periodically, unless forced by baggage item. See `pkg/tracing/tracing.go` for details.").
 		Default("1").Uint64()
 
+	tracingConfigFile := app.Flag("tracing.config-file", "Path to YAML file with tracing configuration. See docs/tracing.md for the format. If empty, the gcloudtrace flags are used.").
+		PlaceHolder("<tracing.config-yaml-path>").String()
+	tracingConfig := app.Flag("tracing.config", "Alternative to 'tracing.config-file' flag. Tracing configuration in YAML.").
+		PlaceHolder("<tracing.config-yaml>").String()
+
+	autoMemLimit := app.Flag("runtime.auto-gomemlimit", "Set the soft memory limit of the Go runtime (GOMEMLIMIT) from the cgroup memory limit of the container. Ignored if the GOMEMLIMIT environment variable is set.").
+		Default("false").Bool()
+	autoMemLimitRatio := app.Flag("runtime.auto-gomemlimit.ratio", "Ratio of the cgroup memory limit to set as the Go runtime memory limit, leaving headroom for memory not managed by the Go runtime.").
+		Default("0.9").Float64()
+
 	cmds := map[string]setupFunc{}
 	registerSidecar(cmds, app, "sidecar")
 	registerStore(cmds, app, "store")
@@ -69,6 +96,7 @@ func main() {
 	registerCompact(cmds, app, "compact")
 	registerBucket(cmds, app, "bucket")
 	registerDownsample(cmds, app, "downsample")
+	registerBench(cmds, app, "bench")
 
 	cmd, err := app.Parse(os.Args[1:])
 	if err != nil {
@@ -93,6 +121,9 @@ func main() {
 			panic("unexpected log level")
 		}
 		logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+		if *logFormat == logFormatJSON {
+			logger = log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+		}
 		logger = level.NewFilter(logger, lvl)
 
 		if *debugName != "" {
@@ -106,8 +137,15 @@ func main() {
 	metrics.MustRegister(
 		version.NewCollector("thanos"),
 		prometheus.NewGoCollector(),
+		memlimit.NewCollector(),
 	)
 
+	if *autoMemLimit {
+		if err := memlimit.Apply(logger, memlimit.DefaultCgroupRoot, *autoMemLimitRatio); err != nil {
+			level.Warn(logger).Log("msg", "failed to set Go runtime memory limit", "err", err)
+		}
+	}
+
 	var g run.Group
 	var tracer opentracing.Tracer
 
@@ -115,8 +153,26 @@ func main() {
 	{
 		ctx := context.Background()
 
+		confContentYaml, err := tracingConfigContent(*tracingConfigFile, *tracingConfig)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if len(confContentYaml) > 0 && *gcloudTraceProject != "" {
+			fmt.Fprintln(os.Stderr, "gcloudtrace flags cannot be used together with tracing configuration")
+			os.Exit(2)
+		}
+
 		var closeFn func() error
-		tracer, closeFn = tracing.NewOptionalGCloudTracer(ctx, logger, *gcloudTraceProject, *gcloudTraceSampleFactor, *debugName)
+		if len(confContentYaml) > 0 {
+			tracer, closeFn, err = tracing.NewTracer(ctx, logger, confContentYaml, *debugName)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, errors.Wrap(err, "tracing failed"))
+				os.Exit(1)
+			}
+		} else {
+			tracer, closeFn = tracing.NewOptionalGCloudTracer(ctx, logger, *gcloudTraceProject, *gcloudTraceSampleFactor, *debugName)
+		}
 
 		ctx, cancel := context.WithCancel(ctx)
 		g.Add(func() error {
@@ -150,6 +206,21 @@ func main() {
 	level.Info(logger).Log("msg", "exiting")
 }
 
+// tracingConfigContent returns the tracing configuration given either as a path or as the YAML content.
+func tracingConfigContent(path, content string) ([]byte, error) {
+	if path != "" && content != "" {
+		return nil, errors.New("both tracing.config-file and tracing.config flags are set, only one is allowed")
+	}
+	if path == "" {
+		return []byte(content), nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read tracing config file")
+	}
+	return b, nil
+}
+
 func interrupt(logger log.Logger, cancel <-chan struct{}) error {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
@@ -162,27 +233,112 @@ func interrupt(logger log.Logger, cancel <-chan struct{}) error {
 	}
 }
 
-func registerProfile(mux *http.ServeMux) {
-	mux.HandleFunc("/debug/pprof/", pprof.Index)
-	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
-	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+// listenHTTPAndGRPC returns listeners for the HTTP and gRPC servers. If both addresses are the same, a single
+// listener is shared and connections are multiplexed by protocol, so both servers are reachable on one port.
+// Multiplexing requires plain text HTTP and gRPC, as the protocol cannot be detected in TLS connections.
+func listenHTTPAndGRPC(logger log.Logger, g *run.Group, httpAddr, grpcAddr string, tlsEnabled bool) (httpL, grpcL net.Listener, err error) {
+	if httpAddr != grpcAddr {
+		httpL, err = net.Listen("tcp", httpAddr)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "listen HTTP on address %s", httpAddr)
+		}
+		grpcL, err = net.Listen("tcp", grpcAddr)
+		if err != nil {
+			httpL.Close()
+			return nil, nil, errors.Wrapf(err, "listen gRPC on address %s", grpcAddr)
+		}
+		return httpL, grpcL, nil
+	}
+
+	if tlsEnabled {
+		return nil, nil, errors.New("TLS is not supported when HTTP and gRPC are served on the same address")
+	}
+	l, err := net.Listen("tcp", httpAddr)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "listen on address %s", httpAddr)
+	}
+
+	m := cmux.New(l)
+	// gRPC clients wait for the server settings frame before they send any headers.
+	grpcL = m.MatchWithWriters(cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"))
+	httpL = m.Match(cmux.Any())
+
+	g.Add(func() error {
+		return errors.Wrap(m.Serve(), "serve multiplexed HTTP and gRPC")
+	}, func(error) {
+		l.Close()
+	})
+	level.Info(logger).Log("msg", "serving HTTP and gRPC on the same address", "address", httpAddr)
+	return httpL, grpcL, nil
+}
+
+// httpMux is implemented by http.ServeMux and server.HTTPServer.
+type httpMux interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+func registerProfile(mux httpMux) {
+	mux.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
+	mux.Handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+	mux.Handle("/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+	mux.Handle("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+	mux.Handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
 	mux.Handle("/debug/pprof/block", pprof.Handler("block"))
 	mux.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
 	mux.Handle("/debug/pprof/heap", pprof.Handler("heap"))
 	mux.Handle("/debug/pprof/threadcreate", pprof.Handler("threadcreate"))
 }
 
-func registerMetrics(mux *http.ServeMux, g prometheus.Gatherer) {
+func registerMetrics(mux httpMux, g prometheus.Gatherer) {
 	mux.Handle("/metrics", promhttp.HandlerFor(g, promhttp.HandlerOpts{}))
 }
 
+// newStatus returns the status of the component run by the given top-level command. Its flags are the global flags
+// and the flags of the command, with the values they were parsed to.
+func newStatus(app *kingpin.Application, cmd string) *thanosstatus.Status {
+	model := app.Model()
+
+	flags := map[string]string{}
+	for _, f := range model.Flags {
+		flags[f.Name] = f.String()
+	}
+	for _, c := range model.Commands {
+		if c.FullCommand != cmd {
+			continue
+		}
+		for _, f := range c.Flags {
+			flags[f.Name] = f.String()
+		}
+	}
+	return thanosstatus.New(flags)
+}
+
+// newGRPCHealthServer returns gRPC health checking server, which reports NOT_SERVING until the component is marked ready.
+func newGRPCHealthServer() *health.Server {
+	hs := health.NewServer()
+	hs.SetServingStatus("", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	return hs
+}
+
+// registerGRPCServices registers health checking and reflection services on the gRPC server, so it can be probed
+// and inspected by standard tools like grpc-health-probe or grpcurl.
+func registerGRPCServices(s *grpc.Server, hs *health.Server) {
+	grpc_health_v1.RegisterHealthServer(s, hs)
+	reflection.Register(s)
+}
+
+// markReady marks the component ready to serve traffic in both HTTP and gRPC probes.
+func markReady(srv *server.HTTPServer, hs *health.Server) {
+	srv.Ready()
+	hs.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
+}
+
 // defaultGRPCServerOpts returns default gRPC server opts that includes:
 // - request histogram
 // - tracing
 // - panic recovery with panic counter
-func defaultGRPCServerOpts(logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer) []grpc.ServerOption {
+// - TLS, if configured
+func defaultGRPCServerOpts(logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, tlsConf *thanostls.ServerConfig) ([]grpc.ServerOption, error) {
 	met := grpc_prometheus.NewServerMetrics()
 	met.EnableHandlingTimeHistogram(
 		grpc_prometheus.WithHistogramBuckets([]float64{
@@ -200,7 +356,7 @@ func defaultGRPCServerOpts(logger log.Logger, reg *prometheus.Registry, tracer o
 		return status.Errorf(codes.Internal, "%s", p)
 	}
 	reg.MustRegister(met, panicsTotal)
-	return []grpc.ServerOption{
+	opts := []grpc.ServerOption{
 		grpc.MaxSendMsgSize(math.MaxInt32),
 		grpc_middleware.WithUnaryServerChain(
 			met.UnaryServerInterceptor(),
@@ -213,4 +369,15 @@ func defaultGRPCServerOpts(logger log.Logger, reg *prometheus.Registry, tracer o
 			grpc_recovery.StreamServerInterceptor(grpc_recovery.WithRecoveryHandler(grpcPanicRecoveryHandler)),
 		),
 	}
+
+	tlsCfg, err := tlsConf.TLSConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "TLS config")
+	}
+	if tlsCfg == nil {
+		level.Info(logger).Log("msg", "disabled TLS, key and cert must be set to enable")
+		return opts, nil
+	}
+	level.Info(logger).Log("msg", "enabled gRPC server side TLS", "client-verification", tlsConf.ClientCAFile != "")
+	return append(opts, grpc.Creds(credentials.NewTLS(tlsCfg))), nil
 }
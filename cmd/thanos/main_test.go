@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/server"
+	"github.com/improbable-eng/thanos/pkg/store/storepb"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/oklog/run"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestListenHTTPAndGRPC_SameAddress(t *testing.T) {
+	var g run.Group
+	httpL, grpcL, err := listenHTTPAndGRPC(log.NewNopLogger(), &g, "127.0.0.1:0", "127.0.0.1:0", false)
+	testutil.Ok(t, err)
+	addr := httpL.Addr().String()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/test", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("http"))
+	})
+	g.Add(func() error {
+		return http.Serve(httpL, mux)
+	}, func(error) {
+		httpL.Close()
+	})
+	s := grpc.NewServer()
+	g.Add(func() error {
+		return s.Serve(grpcL)
+	}, func(error) {
+		s.Stop()
+		grpcL.Close()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	g.Add(func() error {
+		<-ctx.Done()
+		return nil
+	}, func(error) {
+		cancel()
+	})
+
+	done := make(chan error)
+	go func() { done <- g.Run() }()
+
+	resp, err := http.Get("http://" + addr + "/test")
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	testutil.Ok(t, err)
+	testutil.Equals(t, "http", string(b))
+
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+	testutil.Ok(t, err)
+	defer conn.Close()
+
+	// No service is registered, but the request has to reach the gRPC server.
+	_, err = storepb.NewStoreClient(conn).Info(ctx, &storepb.InfoRequest{})
+	st, ok := status.FromError(err)
+	testutil.Assert(t, ok, "expected gRPC status error, got %v", err)
+	testutil.Equals(t, codes.Unimplemented, st.Code())
+
+	cancel()
+	<-done
+}
+
+func TestListenHTTPAndGRPC_SameAddressWithTLS(t *testing.T) {
+	var g run.Group
+	_, _, err := listenHTTPAndGRPC(log.NewNopLogger(), &g, "127.0.0.1:0", "127.0.0.1:0", true)
+	testutil.NotOk(t, err)
+}
+
+func TestGRPCHealth(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	testutil.Ok(t, err)
+
+	s := grpc.NewServer()
+	hs := newGRPCHealthServer()
+	registerGRPCServices(s, hs)
+	go s.Serve(l)
+	defer s.Stop()
+
+	srv, err := server.NewHTTPServer(log.NewNopLogger(), nil, &server.HTTPFlags{})
+	testutil.Ok(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, l.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	testutil.Ok(t, err)
+	defer conn.Close()
+
+	c := grpc_health_v1.NewHealthClient(conn)
+	resp, err := c.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, resp.Status)
+
+	markReady(srv, hs)
+	resp, err = c.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+	testutil.Assert(t, srv.IsReady(), "expected HTTP server to be ready")
+}
+
+func TestNewStatus_Flags(t *testing.T) {
+	app := kingpin.New("thanos", "")
+	app.Flag("log.level", "").Default("info").String()
+	query := app.Command("query", "")
+	query.Flag("query.timeout", "").Default("2m").Duration()
+	sidecar := app.Command("sidecar", "")
+	sidecar.Flag("tsdb.path", "").Default("./data").String()
+
+	cmd, err := app.Parse([]string{"--log.level=debug", "query"})
+	testutil.Ok(t, err)
+
+	flags := newStatus(app, cmd).Flags()
+	testutil.Equals(t, "debug", flags["log.level"])
+	testutil.Equals(t, "2m0s", flags["query.timeout"])
+	_, ok := flags["tsdb.path"]
+	testutil.Assert(t, !ok, "flag of other command included")
+}
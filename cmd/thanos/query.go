@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"math"
-	"net"
 	"net/http"
 	"time"
 
@@ -11,13 +10,20 @@ import (
 	"github.com/go-kit/kit/log/level"
 	"github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/grpc-ecosystem/go-grpc-prometheus"
-	"github.com/improbable-eng/thanos/pkg/cluster"
+	"github.com/improbable-eng/thanos/pkg/discovery/dns"
+	"github.com/improbable-eng/thanos/pkg/discovery/file"
+	"github.com/improbable-eng/thanos/pkg/gate"
+	"github.com/improbable-eng/thanos/pkg/info"
+	"github.com/improbable-eng/thanos/pkg/info/infopb"
 	"github.com/improbable-eng/thanos/pkg/query"
 	"github.com/improbable-eng/thanos/pkg/query/api"
 	"github.com/improbable-eng/thanos/pkg/query/ui"
 	"github.com/improbable-eng/thanos/pkg/runutil"
+	"github.com/improbable-eng/thanos/pkg/server"
+	"github.com/improbable-eng/thanos/pkg/status"
 	"github.com/improbable-eng/thanos/pkg/store"
 	"github.com/improbable-eng/thanos/pkg/store/storepb"
+	thanostls "github.com/improbable-eng/thanos/pkg/tls"
 	"github.com/improbable-eng/thanos/pkg/tracing"
 	"github.com/oklog/run"
 	"github.com/opentracing/opentracing-go"
@@ -27,6 +33,7 @@ import (
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/tsdb/labels"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -37,43 +44,75 @@ func registerQuery(m map[string]setupFunc, app *kingpin.Application, name string
 	httpAddr := cmd.Flag("http-address", "Listen host:port for HTTP endpoints.").
 		Default(defaultHTTPAddr).String()
 
-	grpcAddr := cmd.Flag("grpc-address", "Listen host:port for gRPC endpoints.").
+	httpFlags := server.RegisterHTTPFlags(cmd)
+
+	grpcAddr := cmd.Flag("grpc-address", "Listen host:port for gRPC endpoints. If equal to http-address, HTTP and gRPC are served on the same port.").
 		Default(defaultGRPCAddr).String()
 
+	grpcTLS := thanostls.RegisterServerFlags(cmd)
+	storeTLS := thanostls.RegisterClientFlags(cmd)
+
 	queryTimeout := cmd.Flag("query.timeout", "Maximum time to process query by query node.").
 		Default("2m").Duration()
 
 	maxConcurrentQueries := cmd.Flag("query.max-concurrent", "Maximum number of queries processed concurrently by query node.").
 		Default("20").Int()
 
-	replicaLabel := cmd.Flag("query.replica-label", "Label to treat as a replica indicator along which data is deduplicated. Still you will be able to query without deduplication using 'dedup=false' parameter.").
-		String()
+	maxConcurrentPerTenant := cmd.Flag("query.max-concurrent-per-tenant", "Maximum number of queries processed concurrently for a single tenant. 0 means no limit.").
+		Default("0").Int()
 
-	peers := cmd.Flag("cluster.peers", "Initial peers to join the cluster. It can be either <ip:port>, or <domain:port>.").Strings()
+	tenantHeader := cmd.Flag("query.tenant-header", "HTTP header to determine the tenant of a query. Queries without the header belong to the '"+v1.DefaultTenant+"' tenant.").
+		Default("THANOS-TENANT").String()
 
-	clusterBindAddr := cmd.Flag("cluster.address", "Listen address for cluster.").
-		Default(defaultClusterAddr).String()
+	maxConcurrentPerStore := cmd.Flag("store.max-concurrent-series", "Maximum number of Series requests sent concurrently to a single store. 0 means no limit.").
+		Default("0").Int()
 
-	clusterAdvertiseAddr := cmd.Flag("cluster.advertise-address", "Explicit address to advertise in cluster.").
-		String()
+	queueTimeout := cmd.Flag("query.queue-timeout", "Maximum time a query waits for the per-tenant and per-store concurrency limits. 0 means waiting until the query is canceled or times out.").
+		Default("0s").Duration()
+
+	maxSamples := cmd.Flag("query.max-samples", "Maximum number of samples a single request may fetch from the stores. Requests exceeding it fail with status 422. 0 means no limit.").
+		Default("0").Int()
+
+	maxSeries := cmd.Flag("query.max-series", "Maximum number of series in the result of a single request. Requests exceeding it fail with status 422. 0 means no limit.").
+		Default("0").Int()
+
+	maxBodySize := cmd.Flag("query.max-body-size", "Maximum size of request bodies. Requests exceeding it fail with status 422. 0 means no limit.").
+		Default("0B").Bytes()
 
-	gossipInterval := cmd.Flag("cluster.gossip-interval", "Interval between sending gossip messages. By lowering this value (more frequent) gossip messages are propagated across the cluster more quickly at the expense of increased bandwidth.").
-		Default(cluster.DefaultGossipInterval.String()).Duration()
+	rateLimit := cmd.Flag("query.rate-limit", "Maximum number of requests per second of a single client. Requests exceeding it fail with status 429. 0 means no limit.").
+		Default("0").Float64()
 
-	pushPullInterval := cmd.Flag("cluster.pushpull-interval", "Interval for gossip state syncs. Setting this interval lower (more frequent) will increase convergence speeds across larger clusters at the expense of increased bandwidth usage.").
-		Default(cluster.DefaultPushPullInterval.String()).Duration()
+	rateLimitBurst := cmd.Flag("query.rate-limit-burst", "Number of requests a single client may send at once before the rate limit applies.").
+		Default("10").Int()
+
+	rateLimitClientHeader := cmd.Flag("query.rate-limit-client-header", "HTTP header identifying the client for rate limiting. The remote address is used if it is empty or missing in a request.").
+		Default("").String()
+
+	replicaLabel := cmd.Flag("query.replica-label", "Label to treat as a replica indicator along which data is deduplicated. Still you will be able to query without deduplication using 'dedup=false' parameter.").
+		String()
 
 	selectorLabels := cmd.Flag("selector-label", "Query selector labels that will be exposed in info endpoint (repeated).").
 		PlaceHolder("<name>=\"<value>\"").Strings()
 
-	stores := cmd.Flag("store", "Addresses of statically configured store API servers (repeatable).").
+	stores := cmd.Flag("store", "Addresses of statically configured store API servers (repeatable). The address can be prefixed with 'dns+' or 'dnssrv+' to detect store API servers through respective DNS lookups.").
 		PlaceHolder("<store>").Strings()
 
+	fileSDFiles := cmd.Flag("store.sd-files", "Path to files that contain addresses of store API servers in the Prometheus file_sd format (repeatable). The path can be a glob pattern.").
+		PlaceHolder("<path>").Strings()
+
+	fileSDInterval := cmd.Flag("store.sd-interval", "Refresh interval to re-read file SD files.").
+		Default("5m").Duration()
+
+	dnsSDInterval := cmd.Flag("store.sd-dns-interval", "Interval between DNS resolutions of store and endpoint addresses.").
+		Default("30s").Duration()
+
+	endpoints := cmd.Flag("endpoint", "Addresses of statically configured components exposing the Info gRPC service (repeatable). APIs advertised by the component are discovered automatically. The address can be prefixed with 'dns+' or 'dnssrv+' to detect components through respective DNS lookups.").
+		PlaceHolder("<endpoint>").Strings()
+
+	endpointGroups := cmd.Flag("endpoint-group", "DNS names of statically configured components exposing the Info gRPC service (repeatable). All addresses the name resolves to are treated as interchangeable replicas of a single store and requests are load balanced between them in round-robin fashion.").
+		PlaceHolder("<endpoint-group>").Strings()
+
 	m[name] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer) error {
-		peer, err := cluster.New(logger, reg, *clusterBindAddr, *clusterAdvertiseAddr, *peers, true, *gossipInterval, *pushPullInterval)
-		if err != nil {
-			return errors.Wrap(err, "new cluster peer")
-		}
 		selectorLset, err := parseFlagLabels(*selectorLabels)
 		if err != nil {
 			return errors.Wrap(err, "parse federation labels")
@@ -87,21 +126,48 @@ func registerQuery(m map[string]setupFunc, app *kingpin.Application, name string
 
 			lookupStores[s] = struct{}{}
 		}
+		for _, e := range append(*endpoints, *endpointGroups...) {
+			if _, ok := lookupStores[e]; ok {
+				return errors.Errorf("Address %s is duplicated for --store, --endpoint or --endpoint-group flag.", e)
+			}
+
+			lookupStores[e] = struct{}{}
+		}
 
 		return runQuery(g, logger, reg, tracer,
 			*httpAddr,
+			httpFlags,
+			newStatus(app, name),
 			*grpcAddr,
+			grpcTLS,
+			storeTLS,
 			*maxConcurrentQueries,
+			*maxConcurrentPerTenant,
+			*tenantHeader,
+			*maxConcurrentPerStore,
+			*queueTimeout,
+			v1.Limits{
+				MaxSamples:   *maxSamples,
+				MaxSeries:    *maxSeries,
+				MaxBodyBytes: int64(*maxBodySize),
+				RateLimit:    *rateLimit,
+				RateBurst:    *rateLimitBurst,
+				ClientHeader: *rateLimitClientHeader,
+			},
 			*queryTimeout,
 			*replicaLabel,
-			peer,
 			selectorLset,
 			*stores,
+			*endpoints,
+			*endpointGroups,
+			*fileSDFiles,
+			*fileSDInterval,
+			*dnsSDInterval,
 		)
 	}
 }
 
-func storeClientGRPCOpts(reg *prometheus.Registry, tracer opentracing.Tracer) []grpc.DialOption {
+func storeClientGRPCOpts(logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, tlsConf *thanostls.ClientConfig) ([]grpc.DialOption, error) {
 	grpcMets := grpc_prometheus.NewClientMetrics()
 	grpcMets.EnableClientHandlingTimeHistogram(
 		grpc_prometheus.WithHistogramBuckets([]float64{
@@ -114,7 +180,6 @@ func storeClientGRPCOpts(reg *prometheus.Registry, tracer opentracing.Tracer) []
 		// Current limit is ~2GB.
 		// TODO(bplotka): Split sent chunks on store node per max 4MB chunks if needed.
 		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(math.MaxInt32)),
-		grpc.WithInsecure(),
 		grpc.WithUnaryInterceptor(
 			grpc_middleware.ChainUnaryClient(
 				grpcMets.UnaryClientInterceptor(),
@@ -133,7 +198,16 @@ func storeClientGRPCOpts(reg *prometheus.Registry, tracer opentracing.Tracer) []
 		reg.MustRegister(grpcMets)
 	}
 
-	return dialOpts
+	tlsCfg, err := tlsConf.TLSConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "TLS config")
+	}
+	if tlsCfg == nil {
+		level.Info(logger).Log("msg", "disabled client to server TLS, use --grpc-client-tls-secure to enable")
+		return append(dialOpts, grpc.WithInsecure()), nil
+	}
+	level.Info(logger).Log("msg", "enabled client to server TLS", "client-cert", tlsConf.CertFile != "")
+	return append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg))), nil
 }
 
 // runQuery starts a server that exposes PromQL Query API. It is responsible for querying configured
@@ -144,39 +218,66 @@ func runQuery(
 	reg *prometheus.Registry,
 	tracer opentracing.Tracer,
 	httpAddr string,
+	httpFlags *server.HTTPFlags,
+	st *status.Status,
 	grpcAddr string,
+	grpcTLS *thanostls.ServerConfig,
+	storeTLS *thanostls.ClientConfig,
 	maxConcurrentQueries int,
+	maxConcurrentPerTenant int,
+	tenantHeader string,
+	maxConcurrentPerStore int,
+	queueTimeout time.Duration,
+	limits v1.Limits,
 	queryTimeout time.Duration,
 	replicaLabel string,
-	peer *cluster.Peer,
 	selectorLset labels.Labels,
 	storeAddrs []string,
+	endpointAddrs []string,
+	endpointGroupAddrs []string,
+	fileSDFiles []string,
+	fileSDInterval time.Duration,
+	dnsSDInterval time.Duration,
 ) error {
-	var staticSpecs []query.StoreSpec
-	for _, addr := range storeAddrs {
-		staticSpecs = append(staticSpecs, query.NewStaticStoreSpec(addr))
+	var groupSpecs []query.StoreSpec
+	for _, addr := range endpointGroupAddrs {
+		groupSpecs = append(groupSpecs, query.NewEndpointGroupSpec(addr))
+	}
+
+	fileSD := file.NewDiscovery(fileSDFiles)
+	if err := fileSD.Refresh(); err != nil {
+		return errors.Wrap(err, "read store SD files")
+	}
+	dnsLogger := log.With(logger, "component", "dns")
+	dnsStoreProvider := dns.NewProvider(dnsLogger, reg, nil, "query_store")
+	dnsEndpointProvider := dns.NewProvider(dnsLogger, reg, nil, "query_endpoint")
+
+	dialOpts, err := storeClientGRPCOpts(logger, reg, tracer, storeTLS)
+	if err != nil {
+		return errors.Wrap(err, "building gRPC client")
 	}
 	var (
 		stores = query.NewStoreSet(
 			logger,
 			reg,
 			func() (specs []query.StoreSpec) {
-				specs = append(staticSpecs)
-
-				for id, ps := range peer.PeerStates(cluster.PeerTypesStoreAPIs()...) {
-					specs = append(specs, &gossipSpec{id: id, addr: ps.APIAddr, peer: peer})
+				for _, addr := range dnsStoreProvider.Addresses() {
+					specs = append(specs, query.NewStaticStoreSpec(addr))
 				}
-				return specs
+				for _, addr := range dnsEndpointProvider.Addresses() {
+					specs = append(specs, query.NewEndpointSpec(addr))
+				}
+				return append(specs, groupSpecs...)
 			},
-			storeClientGRPCOpts(reg, tracer),
+			dialOpts,
 		)
 		proxy = store.NewProxyStore(logger, func(context.Context) ([]store.Client, error) {
 			return stores.Get(), nil
-		}, selectorLset)
+		}, selectorLset, gate.NewKeyed(reg, "query_store", maxConcurrentPerStore, queueTimeout))
 		queryableCreator = query.NewQueryableCreator(logger, proxy, replicaLabel)
 		engine           = promql.NewEngine(logger, reg, maxConcurrentQueries, queryTimeout)
 	)
-	// Periodically update the store set with the addresses we see in our cluster.
+	// Periodically update the store set with the discovered addresses.
 	{
 		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
@@ -189,87 +290,86 @@ func runQuery(
 			stores.Close()
 		})
 	}
+	// Periodically re-read file SD files. Addresses of the last successful read are kept on errors.
+	if len(fileSDFiles) > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(fileSDInterval, ctx.Done(), func() error {
+				if err := fileSD.Refresh(); err != nil {
+					level.Error(logger).Log("msg", "refresh store SD files failed", "err", err)
+				}
+				return nil
+			})
+		}, func(error) {
+			cancel()
+		})
+	}
+	// Periodically resolve DNS names of stores and endpoints.
 	{
 		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
-			err := peer.Join(cluster.PeerState{
-				Type:    cluster.PeerTypeQuery,
-				APIAddr: httpAddr,
+			return runutil.Repeat(dnsSDInterval, ctx.Done(), func() error {
+				addrs := append([]string{}, storeAddrs...)
+				dnsStoreProvider.Resolve(ctx, append(addrs, fileSD.Addresses()...))
+				dnsEndpointProvider.Resolve(ctx, endpointAddrs)
+				return nil
 			})
-			if err != nil {
-				return errors.Wrap(err, "join cluster")
-			}
-
-			<-ctx.Done()
-			return nil
 		}, func(error) {
 			cancel()
-			peer.Close(5 * time.Second)
 		})
 	}
+	srv, err := server.NewHTTPServer(logger, reg, httpFlags)
+	if err != nil {
+		return errors.Wrap(err, "create HTTP server")
+	}
+	hs := newGRPCHealthServer()
+	httpL, grpcL, err := listenHTTPAndGRPC(logger, g, httpAddr, grpcAddr, grpcTLS.CertFile != "" || srv.TLSEnabled())
+	if err != nil {
+		return err
+	}
 	// Start query API + UI HTTP server.
 	{
 		router := route.New()
 		ui.New(logger, nil).Register(router)
 
-		api := v1.NewAPI(reg, engine, queryableCreator)
+		api := v1.NewAPI(reg, engine, queryableCreator, gate.NewKeyed(reg, "query_tenant", maxConcurrentPerTenant, queueTimeout), tenantHeader, limits)
 		api.Register(router.WithPrefix("/api/v1"), tracer, logger)
 
-		mux := http.NewServeMux()
-		registerMetrics(mux, reg)
-		registerProfile(mux)
-		mux.Handle("/", router)
-
-		l, err := net.Listen("tcp", httpAddr)
-		if err != nil {
-			return errors.Wrapf(err, "listen HTTP on address %s", httpAddr)
-		}
+		registerMetrics(srv, reg)
+		registerProfile(srv)
+		st.Register(srv)
+		srv.Handle(status.EndpointsPath, status.Handler(func(r *http.Request) interface{} {
+			return stores.Status(r.Context())
+		}))
+		srv.Handle("/", router)
 
 		g.Add(func() error {
-			return errors.Wrap(http.Serve(l, mux), "serve query")
+			return errors.Wrap(srv.Serve(httpL), "serve query")
 		}, func(error) {
-			l.Close()
+			srv.Shutdown()
 		})
 	}
 	// Start query (proxy) gRPC StoreAPI.
 	{
-		l, err := net.Listen("tcp", grpcAddr)
-		if err != nil {
-			return errors.Wrapf(err, "listen gRPC on address")
-		}
 		logger := log.With(logger, "component", "query")
 
-		s := grpc.NewServer(defaultGRPCServerOpts(logger, reg, tracer)...)
+		opts, err := defaultGRPCServerOpts(logger, reg, tracer, grpcTLS)
+		if err != nil {
+			return errors.Wrap(err, "setup gRPC server")
+		}
+		s := grpc.NewServer(opts...)
 		storepb.RegisterStoreServer(s, proxy)
+		infopb.RegisterInfoServer(s, info.NewServer(info.ComponentQuery, proxy, st))
+		registerGRPCServices(s, hs)
 
 		g.Add(func() error {
-			return errors.Wrap(s.Serve(l), "serve gRPC")
+			return errors.Wrap(s.Serve(grpcL), "serve gRPC")
 		}, func(error) {
 			s.Stop()
-			l.Close()
+			grpcL.Close()
 		})
 	}
-	level.Info(logger).Log("msg", "starting query node", "peer", peer.Name())
+	markReady(srv, hs)
+	level.Info(logger).Log("msg", "starting query node")
 	return nil
 }
-
-type gossipSpec struct {
-	id   string
-	addr string
-
-	peer *cluster.Peer
-}
-
-func (s *gossipSpec) Addr() string {
-	return s.addr
-}
-
-// Metadata method for gossip store tries get current peer state. If nothing is found, it means that gossip assumed
-// this host is unhealthy in the meantime.
-func (s *gossipSpec) Metadata(_ context.Context, _ storepb.StoreClient) (labels []storepb.Label, mint int64, maxt int64, err error) {
-	state, ok := s.peer.PeerState(s.id)
-	if !ok {
-		return nil, 0, 0, errors.Errorf("peer %s is no longer in gossip cluster", s.id)
-	}
-	return state.Metadata.Labels, state.Metadata.MinTime, state.Metadata.MaxTime, nil
-}
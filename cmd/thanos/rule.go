@@ -2,17 +2,12 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"math"
 	"math/rand"
 	"net"
-	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,13 +17,19 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/improbable-eng/thanos/pkg/alert"
-	"github.com/improbable-eng/thanos/pkg/cluster"
+	"github.com/improbable-eng/thanos/pkg/discovery/dns"
+	"github.com/improbable-eng/thanos/pkg/discovery/file"
+	"github.com/improbable-eng/thanos/pkg/info"
+	"github.com/improbable-eng/thanos/pkg/info/infopb"
 	"github.com/improbable-eng/thanos/pkg/objstore/client"
-	"github.com/improbable-eng/thanos/pkg/objstore/s3"
+	"github.com/improbable-eng/thanos/pkg/promclient"
 	"github.com/improbable-eng/thanos/pkg/runutil"
+	"github.com/improbable-eng/thanos/pkg/server"
 	"github.com/improbable-eng/thanos/pkg/shipper"
+	"github.com/improbable-eng/thanos/pkg/status"
 	"github.com/improbable-eng/thanos/pkg/store"
 	"github.com/improbable-eng/thanos/pkg/store/storepb"
+	thanostls "github.com/improbable-eng/thanos/pkg/tls"
 	"github.com/improbable-eng/thanos/pkg/tracing"
 	"github.com/oklog/run"
 	"github.com/opentracing/opentracing-go"
@@ -60,9 +61,13 @@ func registerRule(m map[string]setupFunc, app *kingpin.Application, name string)
 	httpAddr := cmd.Flag("http-address", "Listen host:port for HTTP endpoints.").
 		Default(defaultHTTPAddr).String()
 
-	grpcAddr := cmd.Flag("grpc-address", "Listen host:port for gRPC endpoints.").
+	httpFlags := server.RegisterHTTPFlags(cmd)
+
+	grpcAddr := cmd.Flag("grpc-address", "Listen host:port for gRPC endpoints. If equal to http-address, HTTP and gRPC are served on the same port.").
 		Default(defaultGRPCAddr).String()
 
+	grpcTLS := thanostls.RegisterServerFlags(cmd)
+
 	evalInterval := cmd.Flag("eval-interval", "The default evaluation interval to use.").
 		Default("30s").Duration()
 	tsdbBlockDuration := cmd.Flag("tsdb.block-duration", "Block duration for TSDB block.").
@@ -73,33 +78,34 @@ func registerRule(m map[string]setupFunc, app *kingpin.Application, name string)
 	alertmgrs := cmd.Flag("alertmanagers.url", "Alertmanager URLs to push firing alerts to. The scheme may be prefixed with 'dns+' or 'dnssrv+' to detect Alertmanager IPs through respective DNS lookups. The port defaults to 9093 or the SRV record's value. The URL path is used as a prefix for the regular Alertmanager API path.").
 		Strings()
 
-	gcsBucket := cmd.Flag("gcs.bucket", "Google Cloud Storage bucket name for stored blocks. If empty, ruler won't store any block inside Google Cloud Storage.").
-		PlaceHolder("<bucket>").String()
+	objstoreConfig := client.RegisterParams(cmd)
+	cmd.Flag("gcs.bucket", "Google Cloud Storage bucket name for stored blocks. If empty, ruler won't store any block inside Google Cloud Storage.").
+		PlaceHolder("<bucket>").StringVar(&objstoreConfig.GCSBucket)
 
-	s3Config := s3.RegisterS3Params(cmd)
+	queries := cmd.Flag("query", "Addresses of statically configured query API servers (repeatable). The address can be prefixed with 'dns+' or 'dnssrv+' to detect query API servers through respective DNS lookups.").
+		PlaceHolder("<query>").Strings()
 
-	peers := cmd.Flag("cluster.peers", "Initial peers to join the cluster. It can be either <ip:port>, or <domain:port>.").Strings()
+	fileSDFiles := cmd.Flag("query.sd-files", "Path to files that contain addresses of query API servers in the Prometheus file_sd format (repeatable). The path can be a glob pattern.").
+		PlaceHolder("<path>").Strings()
 
-	clusterBindAddr := cmd.Flag("cluster.address", "Listen address for cluster.").
-		Default(defaultClusterAddr).String()
+	fileSDInterval := cmd.Flag("query.sd-interval", "Refresh interval to re-read file SD files.").
+		Default("5m").Duration()
 
-	gossipInterval := cmd.Flag("cluster.gossip-interval", "Interval between sending gossip messages. By lowering this value (more frequent) gossip messages are propagated across the cluster more quickly at the expense of increased bandwidth.").
-		Default(cluster.DefaultGossipInterval.String()).Duration()
+	dnsSDInterval := cmd.Flag("query.sd-dns-interval", "Interval between DNS resolutions of query API server addresses.").
+		Default("30s").Duration()
 
-	pushPullInterval := cmd.Flag("cluster.pushpull-interval", "Interval for gossip state syncs. Setting this interval lower (more frequent) will increase convergence speeds across larger clusters at the expense of increased bandwidth usage.").
-		Default(cluster.DefaultPushPullInterval.String()).Duration()
+	queryScheme := cmd.Flag("query.http-scheme", "Scheme to use when talking to query API servers.").
+		Default("http").Enum("http", "https")
 
-	clusterAdvertiseAddr := cmd.Flag("cluster.advertise-address", "Explicit address to advertise in cluster.").
-		String()
+	queryClientCfg := promclient.RegisterFlags(cmd, "query")
 
 	m[name] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer) error {
 		lset, err := parseFlagLabels(*labelStrs)
 		if err != nil {
 			return errors.Wrap(err, "parse labels")
 		}
-		peer, err := cluster.New(logger, reg, *clusterBindAddr, *clusterAdvertiseAddr, *peers, false, *gossipInterval, *pushPullInterval)
-		if err != nil {
-			return errors.Wrap(err, "new cluster peer")
+		if len(*queries) == 0 && len(*fileSDFiles) == 0 {
+			return errors.New("no --query or --query.sd-files flag specified")
 		}
 
 		tsdbOpts := &tsdb.Options{
@@ -109,7 +115,7 @@ func registerRule(m map[string]setupFunc, app *kingpin.Application, name string)
 			NoLockfile:       true,
 			WALFlushInterval: 30 * time.Second,
 		}
-		return runRule(g, logger, reg, tracer, lset, *alertmgrs, *httpAddr, *grpcAddr, *evalInterval, *dataDir, *ruleFiles, peer, *gcsBucket, s3Config, tsdbOpts, name)
+		return runRule(g, logger, reg, tracer, lset, *alertmgrs, *httpAddr, httpFlags, newStatus(app, name), *grpcAddr, grpcTLS, *evalInterval, *dataDir, *ruleFiles, *queries, *fileSDFiles, *fileSDInterval, *dnsSDInterval, *queryScheme, queryClientCfg, objstoreConfig, tsdbOpts, name)
 	}
 }
 
@@ -123,13 +129,20 @@ func runRule(
 	lset labels.Labels,
 	alertmgrURLs []string,
 	httpAddr string,
+	httpFlags *server.HTTPFlags,
+	st *status.Status,
 	grpcAddr string,
+	grpcTLS *thanostls.ServerConfig,
 	evalInterval time.Duration,
 	dataDir string,
 	ruleFiles []string,
-	peer *cluster.Peer,
-	gcsBucket string,
-	s3Config *s3.Config,
+	queryAddrs []string,
+	fileSDFiles []string,
+	fileSDInterval time.Duration,
+	dnsSDInterval time.Duration,
+	queryScheme string,
+	queryClientCfg *promclient.Config,
+	objstoreConfig *client.Config,
 	tsdbOpts *tsdb.Options,
 	component string,
 ) error {
@@ -147,26 +160,64 @@ func runRule(
 		})
 	}
 
-	// Hit the HTTP query API of query peers in randomized order until we get a result
-	// back or the context get canceled.
-	queryFn := func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
-		peers := peer.PeerStates(cluster.PeerTypeQuery)
-		var ids []string
-		for id := range peers {
-			ids = append(ids, id)
-		}
-		sort.Slice(ids, func(i int, j int) bool {
-			return strings.Compare(ids[i], ids[j]) < 0
+	fileSD := file.NewDiscovery(fileSDFiles)
+	if err := fileSD.Refresh(); err != nil {
+		return errors.Wrap(err, "read query SD files")
+	}
+	dnsProvider := dns.NewProvider(log.With(logger, "component", "dns"), reg, nil, "rule_query")
+
+	// Periodically re-read file SD files. Addresses of the last successful read are kept on errors.
+	if len(fileSDFiles) > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(fileSDInterval, ctx.Done(), func() error {
+				if err := fileSD.Refresh(); err != nil {
+					level.Error(logger).Log("msg", "refresh query SD files failed", "err", err)
+				}
+				return nil
+			})
+		}, func(error) {
+			cancel()
 		})
+	}
+	// Periodically resolve DNS names of query API servers.
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return runutil.Repeat(dnsSDInterval, ctx.Done(), func() error {
+				addrs := append([]string{}, queryAddrs...)
+				dnsProvider.Resolve(ctx, append(addrs, fileSD.Addresses()...))
+				return nil
+			})
+		}, func(error) {
+			cancel()
+		})
+	}
 
-		for _, i := range rand.Perm(len(ids)) {
-			vec, err := queryPrometheusInstant(ctx, logger, peers[ids[i]].APIAddr, q, t)
-			if err != nil {
-				return nil, err
+	queryClient, err := promclient.NewClient(log.With(logger, "component", "promclient"), reg, "rule_query", queryClientCfg)
+	if err != nil {
+		return errors.Wrap(err, "create query client")
+	}
+
+	// Hit the HTTP query API of query nodes in randomized order until we get a result
+	// back or the context get canceled.
+	queryFn := func(ctx context.Context, q string, t time.Time) (promql.Vector, error) {
+		addrs := dnsProvider.Addresses()
+
+		var err error
+		for _, i := range rand.Perm(len(addrs)) {
+			var vec promql.Vector
+			// Always query a vector. Scalar rules won't work for now and arguably have no relevant use case.
+			vec, err = queryClient.QueryInstant(ctx, &url.URL{Scheme: queryScheme, Host: addrs[i]}, q, t, promclient.QueryOptions{Deduplicate: true})
+			if err == nil {
+				return vec, nil
 			}
-			return vec, nil
+			level.Warn(logger).Log("msg", "query failed, trying next query node", "addr", addrs[i], "err", err)
 		}
-		return nil, errors.Errorf("no query peer reachable")
+		if err != nil {
+			return nil, errors.Wrap(err, "query all query nodes")
+		}
+		return nil, errors.Errorf("no query node reachable")
 	}
 
 	// Run rule evaluation and alert notifications.
@@ -217,36 +268,6 @@ func runRule(
 			cancel()
 		})
 	}
-	{
-		var storeLset []storepb.Label
-		for _, l := range lset {
-			storeLset = append(storeLset, storepb.Label{Name: l.Name, Value: l.Value})
-		}
-
-		ctx, cancel := context.WithCancel(context.Background())
-		g.Add(func() error {
-			err := peer.Join(cluster.PeerState{
-				Type:    cluster.PeerTypeSource,
-				APIAddr: grpcAddr,
-				Metadata: cluster.PeerMetadata{
-					Labels: storeLset,
-					// Start out with the full time range. The shipper will constrain it later.
-					// TODO(fabxc): minimum timestamp is never adjusted if shipping is disabled.
-					MinTime: 0,
-					MaxTime: math.MaxInt64,
-				},
-			})
-			if err != nil {
-				return errors.Wrap(err, "join cluster")
-			}
-
-			<-ctx.Done()
-			return nil
-		}, func(error) {
-			cancel()
-			peer.Close(5 * time.Second)
-		})
-	}
 	{
 		sdr := alert.NewSender(logger, reg, alertmgrs.get, nil)
 		ctx, cancel := context.WithCancel(context.Background())
@@ -337,43 +358,49 @@ func runRule(
 		})
 	}
 
+	srv, err := server.NewHTTPServer(logger, reg, httpFlags)
+	if err != nil {
+		return errors.Wrap(err, "create HTTP server")
+	}
+	hs := newGRPCHealthServer()
+	httpL, grpcL, err := listenHTTPAndGRPC(logger, g, httpAddr, grpcAddr, grpcTLS.CertFile != "" || srv.TLSEnabled())
+	if err != nil {
+		return err
+	}
 	// Start HTTP and gRPC servers.
 	{
-		l, err := net.Listen("tcp", grpcAddr)
-		if err != nil {
-			return errors.Wrap(err, "listen API address")
-		}
 		logger := log.With(logger, "component", "store")
 
 		store := store.NewTSDBStore(logger, reg, db, lset)
 
-		s := grpc.NewServer(defaultGRPCServerOpts(logger, reg, tracer)...)
+		opts, err := defaultGRPCServerOpts(logger, reg, tracer, grpcTLS)
+		if err != nil {
+			return errors.Wrap(err, "setup gRPC server")
+		}
+		s := grpc.NewServer(opts...)
 		storepb.RegisterStoreServer(s, store)
+		infopb.RegisterInfoServer(s, info.NewServer(info.ComponentRule, store, st))
+		registerGRPCServices(s, hs)
 
 		g.Add(func() error {
-			return errors.Wrap(s.Serve(l), "serve gRPC")
+			return errors.Wrap(s.Serve(grpcL), "serve gRPC")
 		}, func(error) {
 			s.Stop()
-			l.Close()
+			grpcL.Close()
 		})
 	}
 	{
 		router := route.New()
 
-		mux := http.NewServeMux()
-		registerMetrics(mux, reg)
-		registerProfile(mux)
-		mux.Handle("/", router)
-
-		l, err := net.Listen("tcp", httpAddr)
-		if err != nil {
-			return errors.Wrapf(err, "listen on address %s", httpAddr)
-		}
+		registerMetrics(srv, reg)
+		registerProfile(srv)
+		st.Register(srv)
+		srv.Handle("/", router)
 
 		g.Add(func() error {
-			return errors.Wrap(http.Serve(l, mux), "serve query")
+			return errors.Wrap(srv.Serve(httpL), "serve query")
 		}, func(error) {
-			l.Close()
+			srv.Shutdown()
 		})
 	}
 
@@ -381,7 +408,7 @@ func runRule(
 
 	// The background shipper continuously scans the data directory and uploads
 	// new blocks to Google Cloud Storage or an S3-compatible storage service.
-	bkt, closeFn, err := client.NewBucket(&gcsBucket, *s3Config, reg, component)
+	bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, component)
 	if err != nil && err != client.ErrNotFound {
 		return err
 	}
@@ -399,7 +426,7 @@ func runRule(
 			}
 		}()
 
-		s := shipper.New(logger, nil, dataDir, bkt, func() labels.Labels { return lset })
+		s := shipper.New(logger, reg, dataDir, bkt, func() labels.Labels { return lset }, false, false, 1)
 
 		ctx, cancel := context.WithCancel(context.Background())
 
@@ -408,13 +435,6 @@ func runRule(
 
 			return runutil.Repeat(30*time.Second, ctx.Done(), func() error {
 				s.Sync(ctx)
-
-				minTime, _, err := s.Timestamps()
-				if err != nil {
-					level.Warn(logger).Log("msg", "reading timestamps failed", "err", err)
-				} else {
-					peer.SetTimestamps(minTime, math.MaxInt64)
-				}
 				return nil
 			})
 		}, func(error) {
@@ -422,71 +442,11 @@ func runRule(
 		})
 	}
 
-	level.Info(logger).Log("msg", "starting rule node", "peer", peer.Name())
+	markReady(srv, hs)
+	level.Info(logger).Log("msg", "starting rule node")
 	return nil
 }
 
-func queryPrometheusInstant(ctx context.Context, logger log.Logger, addr, query string, t time.Time) (promql.Vector, error) {
-	u, err := url.Parse(fmt.Sprintf("http://%s/api/v1/query", addr))
-	if err != nil {
-		return nil, err
-	}
-	params := url.Values{}
-	params.Add("query", query)
-	params.Add("time", t.Format(time.RFC3339Nano))
-	params.Add("dedup", "true")
-	u.RawQuery = params.Encode()
-
-	req, err := http.NewRequest("GET", u.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-
-	span, ctx := tracing.StartSpan(ctx, "/rule_instant_query HTTP[client]")
-	defer span.Finish()
-
-	req = req.WithContext(ctx)
-
-	client := &http.Client{
-		Transport: tracing.HTTPTripperware(logger, http.DefaultTransport),
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	// Always try to decode a vector. Scalar rules won't work for now and arguably
-	// have no relevant use case.
-	var m struct {
-		Data struct {
-			Result model.Vector `json:"result"`
-		} `json:"data"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
-		return nil, err
-	}
-	vec := make(promql.Vector, 0, len(m.Data.Result))
-
-	for _, e := range m.Data.Result {
-		lset := make(promlabels.Labels, 0, len(e.Metric))
-
-		for k, v := range e.Metric {
-			lset = append(lset, promlabels.Label{
-				Name:  string(k),
-				Value: string(v),
-			})
-		}
-		sort.Sort(lset)
-
-		vec = append(vec, promql.Sample{
-			Metric: lset,
-			Point:  promql.Point{T: int64(e.Timestamp), V: float64(e.Value)},
-		})
-	}
-	return vec, nil
-}
-
 type alertmanagerSet struct {
 	resolver *net.Resolver
 	addrs    []string
@@ -2,25 +2,26 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"math"
-	"net"
-	"net/http"
 	"net/url"
-	"path"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
-	"github.com/improbable-eng/thanos/pkg/cluster"
+	"github.com/improbable-eng/thanos/pkg/info"
+	"github.com/improbable-eng/thanos/pkg/info/infopb"
 	"github.com/improbable-eng/thanos/pkg/objstore/client"
-	"github.com/improbable-eng/thanos/pkg/objstore/s3"
+	"github.com/improbable-eng/thanos/pkg/promclient"
 	"github.com/improbable-eng/thanos/pkg/reloader"
 	"github.com/improbable-eng/thanos/pkg/runutil"
+	"github.com/improbable-eng/thanos/pkg/server"
 	"github.com/improbable-eng/thanos/pkg/shipper"
+	"github.com/improbable-eng/thanos/pkg/status"
 	"github.com/improbable-eng/thanos/pkg/store"
 	"github.com/improbable-eng/thanos/pkg/store/storepb"
+	thanostls "github.com/improbable-eng/thanos/pkg/tls"
 	"github.com/oklog/run"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
@@ -28,42 +29,32 @@ import (
 	"github.com/prometheus/tsdb/labels"
 	"google.golang.org/grpc"
 	"gopkg.in/alecthomas/kingpin.v2"
-	yaml "gopkg.in/yaml.v2"
 )
 
 func registerSidecar(m map[string]setupFunc, app *kingpin.Application, name string) {
 	cmd := app.Command(name, "sidecar for Prometheus server")
 
-	grpcAddr := cmd.Flag("grpc-address", "Listen address for gRPC endpoints.").
+	grpcAddr := cmd.Flag("grpc-address", "Listen address for gRPC endpoints. If equal to http-address, HTTP and gRPC are served on the same port.").
 		Default(defaultGRPCAddr).String()
 
+	grpcTLS := thanostls.RegisterServerFlags(cmd)
+
 	httpAddr := cmd.Flag("http-address", "Listen address for HTTP endpoints.").
 		Default(defaultHTTPAddr).String()
 
+	httpFlags := server.RegisterHTTPFlags(cmd)
+
 	promURL := cmd.Flag("prometheus.url", "URL at which to reach Prometheus's API.").
 		Default("http://localhost:9090").URL()
 
+	promClientCfg := promclient.RegisterFlags(cmd, "prometheus")
+
 	dataDir := cmd.Flag("tsdb.path", "Data directory of TSDB.").
 		Default("./data").String()
 
-	gcsBucket := cmd.Flag("gcs.bucket", "Google Cloud Storage bucket name for stored blocks. If empty, sidecar won't store any block inside Google Cloud Storage.").
-		PlaceHolder("<bucket>").String()
-
-	s3Config := s3.RegisterS3Params(cmd)
-
-	peers := cmd.Flag("cluster.peers", "Initial peers to join the cluster. It can be either <ip:port>, or <domain:port>.").Strings()
-
-	clusterBindAddr := cmd.Flag("cluster.address", "Listen address for cluster.").
-		Default(defaultClusterAddr).String()
-
-	clusterAdvertiseAddr := cmd.Flag("cluster.advertise-address", "Explicit address to advertise in cluster.").
-		String()
-
-	gossipInterval := cmd.Flag("cluster.gossip-interval", "Interval between sending gossip messages. By lowering this value (more frequent) gossip messages are propagated across the cluster more quickly at the expense of increased bandwidth.").
-		Default(cluster.DefaultGossipInterval.String()).Duration()
-
-	pushPullInterval := cmd.Flag("cluster.pushpull-interval", "Interval for gossip state syncs. Setting this interval lower (more frequent) will increase convergence speeds across larger clusters at the expense of increased bandwidth usage.").
-		Default(cluster.DefaultPushPullInterval.String()).Duration()
+	objstoreConfig := client.RegisterParams(cmd)
+	cmd.Flag("gcs.bucket", "Google Cloud Storage bucket name for stored blocks. If empty, sidecar won't store any block inside Google Cloud Storage.").
+		PlaceHolder("<bucket>").StringVar(&objstoreConfig.GCSBucket)
 
 	reloaderCfgFile := cmd.Flag("reloader.config-file", "Config file watched by the reloader.").
 		Default("").String()
@@ -73,6 +64,23 @@ func registerSidecar(m map[string]setupFunc, app *kingpin.Application, name stri
 
 	reloaderRuleDir := cmd.Flag("reloader.rule-dir", "Rule directory for the reloader to refresh.").String()
 
+	snapshotSync := cmd.Flag("shipper.snapshot-sync", "Once on the first start, upload all blocks of a Prometheus TSDB snapshot to backfill data that existed before the sidecar was deployed. Requires the Prometheus admin APIs (--web.enable-admin-api) and write access to --tsdb.path.").
+		Default("false").Bool()
+
+	applyTombstones := cmd.Flag("shipper.apply-tombstones", "Remove samples deleted through the Prometheus delete API from blocks before uploading them. Otherwise the deletions are lost and the samples are visible again in the bucket.").
+		Default("false").Bool()
+
+	uploadCompacted := cmd.Flag("shipper.upload-compacted", "Upload blocks compacted by Prometheus, e.g. to ship historical data of a long-running Prometheus server. Compacted blocks holding data of blocks that are already in the bucket are not uploaded.").
+		Default("false").Bool()
+
+	uploadConcurrency := cmd.Flag("shipper.upload-concurrency", "Number of chunk segment files of a block uploaded in parallel.").
+		Default("1").Int()
+
+	headSnapshotInterval := cmd.Flag("shipper.head-snapshot-interval", "Interval in which the head of Prometheus is snapshotted and uploaded as a temporary block, "+
+		"so at most the interval of data is lost if the Prometheus node fails before the head is persisted. Head blocks are replaced by the next snapshot "+
+		"and deleted once their data is uploaded in persisted blocks. Requires the Prometheus admin APIs (--web.enable-admin-api). 0 disables head snapshots.").
+		Default("0s").Duration()
+
 	m[name] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer) error {
 		rl := reloader.New(
 			log.With(logger, "component", "reloader"),
@@ -81,23 +89,26 @@ func registerSidecar(m map[string]setupFunc, app *kingpin.Application, name stri
 			*reloaderCfgSubstFile,
 			*reloaderRuleDir,
 		)
-		peer, err := cluster.New(logger, reg, *clusterBindAddr, *clusterAdvertiseAddr, *peers, false, *gossipInterval, *pushPullInterval)
-		if err != nil {
-			return errors.Wrap(err, "new cluster peer")
-		}
 		return runSidecar(
 			g,
 			logger,
 			reg,
 			tracer,
 			*grpcAddr,
+			grpcTLS,
 			*httpAddr,
+			httpFlags,
+			newStatus(app, name),
 			*promURL,
+			promClientCfg,
 			*dataDir,
-			*gcsBucket,
-			s3Config,
-			peer,
+			objstoreConfig,
 			rl,
+			*snapshotSync,
+			*applyTombstones,
+			*uploadCompacted,
+			*uploadConcurrency,
+			*headSnapshotInterval,
 			name,
 		)
 	}
@@ -109,16 +120,33 @@ func runSidecar(
 	reg *prometheus.Registry,
 	tracer opentracing.Tracer,
 	grpcAddr string,
+	grpcTLS *thanostls.ServerConfig,
 	httpAddr string,
+	httpFlags *server.HTTPFlags,
+	st *status.Status,
 	promURL *url.URL,
+	promClientCfg *promclient.Config,
 	dataDir string,
-	gcsBucket string,
-	s3Config *s3.Config,
-	peer *cluster.Peer,
+	objstoreConfig *client.Config,
 	reloader *reloader.Reloader,
+	snapshotSync bool,
+	applyTombstones bool,
+	uploadCompacted bool,
+	uploadConcurrency int,
+	headSnapshotInterval time.Duration,
 	component string,
 ) error {
-	var externalLabels = &extLabelSet{promURL: promURL}
+	promClient, err := promclient.NewClient(log.With(logger, "component", "promclient"), reg, "sidecar", promClientCfg)
+	if err != nil {
+		return errors.Wrap(err, "create Prometheus client")
+	}
+	var externalLabels = &extLabelSet{client: promClient, promURL: promURL}
+
+	srv, err := server.NewHTTPServer(logger, reg, httpFlags)
+	if err != nil {
+		return errors.Wrap(err, "create HTTP server")
+	}
+	hs := newGRPCHealthServer()
 
 	// Setup all the concurrent groups.
 	{
@@ -134,7 +162,7 @@ func runSidecar(
 
 		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
-			// Blocking query of external labels before joining as a Source Peer into gossip.
+			// Blocking query of external labels before serving StoreAPI.
 			// We retry infinitely until we reach and fetch labels from our Prometheus.
 			err := runutil.Retry(2*time.Second, ctx.Done(), func() error {
 				err := externalLabels.Update(ctx)
@@ -159,23 +187,8 @@ func runSidecar(
 				return errors.New("no external labels configured on Prometheus server, uniquely identifying external labels must be configured")
 			}
 
-			// New gossip cluster.
-			err = peer.Join(
-				cluster.PeerState{
-					Type:    cluster.PeerTypeSource,
-					APIAddr: grpcAddr,
-					Metadata: cluster.PeerMetadata{
-						Labels: externalLabels.GetPB(),
-						// Start out with the full time range. The shipper will constrain it later.
-						// TODO(fabxc): minimum timestamp is never adjusted if shipping is disabled.
-						MinTime: 0,
-						MaxTime: math.MaxInt64,
-					},
-				},
-			)
-			if err != nil {
-				return errors.Wrap(err, "join cluster")
-			}
+			// Prometheus is reachable and the sidecar is able to serve StoreAPI.
+			markReady(srv, hs)
 
 			// Periodically query the Prometheus config. We use this as a heartbeat as well as for updating
 			// the external labels we apply.
@@ -188,9 +201,6 @@ func runSidecar(
 					level.Warn(logger).Log("msg", "heartbeat failed", "err", err)
 					promUp.Set(0)
 				} else {
-					// Update gossip.
-					peer.SetLabels(externalLabels.GetPB())
-
 					promUp.Set(1)
 					lastHeartbeat.Set(float64(time.Now().UnixNano()) / 1e9)
 				}
@@ -199,7 +209,6 @@ func runSidecar(
 			})
 		}, func(error) {
 			cancel()
-			peer.Close(2 * time.Second)
 		})
 	}
 	{
@@ -210,45 +219,44 @@ func runSidecar(
 			cancel()
 		})
 	}
+	httpL, grpcL, err := listenHTTPAndGRPC(logger, g, httpAddr, grpcAddr, grpcTLS.CertFile != "" || srv.TLSEnabled())
+	if err != nil {
+		return err
+	}
 	{
-		mux := http.NewServeMux()
-		registerMetrics(mux, reg)
-		registerProfile(mux)
-
-		l, err := net.Listen("tcp", httpAddr)
-		if err != nil {
-			return errors.Wrap(err, "listen metrics address")
-		}
+		registerMetrics(srv, reg)
+		registerProfile(srv)
+		st.Register(srv)
 
 		g.Add(func() error {
-			return errors.Wrap(http.Serve(l, mux), "serve metrics")
+			return errors.Wrap(srv.Serve(httpL), "serve metrics")
 		}, func(error) {
-			l.Close()
+			srv.Shutdown()
 		})
 	}
 	{
-		l, err := net.Listen("tcp", grpcAddr)
-		if err != nil {
-			return errors.Wrap(err, "listen API address")
-		}
 		logger := log.With(logger, "component", "store")
 
-		var client http.Client
-
 		promStore, err := store.NewPrometheusStore(
-			logger, prometheus.DefaultRegisterer, &client, promURL, externalLabels.Get)
+			logger, prometheus.DefaultRegisterer, promClient.HTTPClient(), promURL, externalLabels.Get)
 		if err != nil {
 			return errors.Wrap(err, "create Prometheus store")
 		}
 
-		s := grpc.NewServer(defaultGRPCServerOpts(logger, reg, tracer)...)
+		opts, err := defaultGRPCServerOpts(logger, reg, tracer, grpcTLS)
+		if err != nil {
+			return errors.Wrap(err, "setup gRPC server")
+		}
+		s := grpc.NewServer(opts...)
 		storepb.RegisterStoreServer(s, promStore)
+		infopb.RegisterInfoServer(s, info.NewServer(info.ComponentSidecar, promStore, st))
+		registerGRPCServices(s, hs)
 
 		g.Add(func() error {
-			return errors.Wrap(s.Serve(l), "serve gRPC")
+			return errors.Wrap(s.Serve(grpcL), "serve gRPC")
 		}, func(error) {
 			s.Stop()
-			l.Close()
+			grpcL.Close()
 		})
 	}
 
@@ -256,7 +264,7 @@ func runSidecar(
 
 	// The background shipper continuously scans the data directory and uploads
 	// new blocks to Google Cloud Storage or an S3-compatible storage service.
-	bkt, closeFn, err := client.NewBucket(&gcsBucket, *s3Config, reg, component)
+	bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, component)
 	if err != nil && err != client.ErrNotFound {
 		return err
 	}
@@ -274,21 +282,32 @@ func runSidecar(
 			}
 		}()
 
-		s := shipper.New(logger, nil, dataDir, bkt, externalLabels.Get)
+		s := shipper.New(logger, reg, dataDir, bkt, externalLabels.Get, applyTombstones, uploadCompacted, uploadConcurrency)
 
 		ctx, cancel := context.WithCancel(context.Background())
 
 		g.Add(func() error {
 			defer closeFn()
 
+			snapshotPending := snapshotSync
+			var lastHeadSnapshot time.Time
 			return runutil.Repeat(30*time.Second, ctx.Done(), func() error {
+				if snapshotPending {
+					if err := syncSnapshot(ctx, logger, promClient, promURL, dataDir, s, externalLabels); err != nil {
+						level.Error(logger).Log("msg", "snapshot sync failed, retrying", "err", err)
+					} else {
+						snapshotPending = false
+					}
+				}
 				s.Sync(ctx)
 
-				minTime, _, err := s.Timestamps()
-				if err != nil {
-					level.Warn(logger).Log("msg", "reading timestamps failed", "err", err)
-				} else {
-					peer.SetTimestamps(minTime, math.MaxInt64)
+				// Head snapshots are taken after the sync, so data persisted in the meantime is uploaded first.
+				if headSnapshotInterval > 0 && time.Since(lastHeadSnapshot) >= headSnapshotInterval {
+					if err := syncHeadSnapshot(ctx, logger, promClient, promURL, dataDir, s, externalLabels); err != nil {
+						level.Error(logger).Log("msg", "head snapshot sync failed", "err", err)
+					} else {
+						lastHeadSnapshot = time.Now()
+					}
 				}
 				return nil
 			})
@@ -297,11 +316,12 @@ func runSidecar(
 		})
 	}
 
-	level.Info(logger).Log("msg", "starting sidecar", "peer", peer.Name())
+	level.Info(logger).Log("msg", "starting sidecar")
 	return nil
 }
 
 type extLabelSet struct {
+	client  *promclient.Client
 	promURL *url.URL
 
 	mtx    sync.Mutex
@@ -309,7 +329,7 @@ type extLabelSet struct {
 }
 
 func (s *extLabelSet) Update(ctx context.Context) error {
-	elset, err := queryExternalLabels(ctx, s.promURL)
+	elset, err := s.client.ExternalLabels(ctx, s.promURL)
 	if err != nil {
 		return err
 	}
@@ -328,49 +348,80 @@ func (s *extLabelSet) Get() labels.Labels {
 	return s.labels
 }
 
-func (s *extLabelSet) GetPB() []storepb.Label {
-	s.mtx.Lock()
-	defer s.mtx.Unlock()
-
-	lset := make([]storepb.Label, 0, len(s.labels))
-	for _, l := range s.labels {
-		lset = append(lset, storepb.Label{
-			Name:  l.Name,
-			Value: l.Value,
-		})
-	}
-	return lset
-}
-
-func queryExternalLabels(ctx context.Context, base *url.URL) (labels.Labels, error) {
-	u := *base
-	u.Path = path.Join(u.Path, "/api/v1/status/config")
-
-	req, err := http.NewRequest("GET", u.String(), nil)
+// syncSnapshot creates a snapshot of the Prometheus TSDB and uploads all its blocks, unless it was done before.
+func syncSnapshot(
+	ctx context.Context,
+	logger log.Logger,
+	client *promclient.Client,
+	promURL *url.URL,
+	dataDir string,
+	s *shipper.Shipper,
+	externalLabels *extLabelSet,
+) error {
+	synced, err := s.SnapshotSynced()
 	if err != nil {
-		return nil, errors.Wrap(err, "create request")
+		return err
 	}
-	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if synced {
+		level.Info(logger).Log("msg", "snapshot was already synced before, skipping")
+		return nil
+	}
+	// Uploaded blocks must carry the external labels.
+	if len(externalLabels.Get()) == 0 {
+		return errors.New("external labels not fetched from Prometheus yet")
+	}
+
+	// The head block is skipped as its data is uploaded by regular syncs once it is persisted.
+	name, err := client.Snapshot(ctx, promURL, true)
 	if err != nil {
-		return nil, errors.Wrapf(err, "request config against %s", u.String())
+		return errors.Wrap(err, "create snapshot")
 	}
-	defer resp.Body.Close()
+	dir := filepath.Join(dataDir, "snapshots", name)
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			level.Warn(logger).Log("msg", "removing snapshot failed", "dir", dir, "err", err)
+		}
+	}()
 
-	var d struct {
-		Data struct {
-			YAML string `json:"yaml"`
-		} `json:"data"`
+	level.Info(logger).Log("msg", "uploading blocks of snapshot", "dir", dir)
+	begin := time.Now()
+	if err := s.SyncSnapshot(ctx, dir); err != nil {
+		return errors.Wrapf(err, "sync snapshot %s", name)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
-		return nil, errors.Wrap(err, "decode response")
+	level.Info(logger).Log("msg", "snapshot synced", "duration", time.Since(begin))
+	return nil
+}
+
+// syncHeadSnapshot creates a snapshot of the Prometheus TSDB including its head and uploads the head block.
+func syncHeadSnapshot(
+	ctx context.Context,
+	logger log.Logger,
+	client *promclient.Client,
+	promURL *url.URL,
+	dataDir string,
+	s *shipper.Shipper,
+	externalLabels *extLabelSet,
+) error {
+	// Uploaded blocks must carry the external labels.
+	if len(externalLabels.Get()) == 0 {
+		return errors.New("external labels not fetched from Prometheus yet")
 	}
-	var cfg struct {
-		Global struct {
-			ExternalLabels map[string]string `yaml:"external_labels"`
-		} `yaml:"global"`
+
+	name, err := client.Snapshot(ctx, promURL, false)
+	if err != nil {
+		return errors.Wrap(err, "create snapshot")
 	}
-	if err := yaml.Unmarshal([]byte(d.Data.YAML), &cfg); err != nil {
-		return nil, errors.Wrap(err, "parse Prometheus config")
+	dir := filepath.Join(dataDir, "snapshots", name)
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			level.Warn(logger).Log("msg", "removing snapshot failed", "dir", dir, "err", err)
+		}
+	}()
+
+	begin := time.Now()
+	if err := s.SyncHeadSnapshot(ctx, dir); err != nil {
+		return errors.Wrapf(err, "sync head of snapshot %s", name)
 	}
-	return labels.FromMap(cfg.Global.ExternalLabels), nil
+	level.Debug(logger).Log("msg", "head snapshot synced", "duration", time.Since(begin))
+	return nil
 }
@@ -2,19 +2,21 @@ package main
 
 import (
 	"context"
-	"math"
-	"net"
-	"net/http"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
-	"github.com/improbable-eng/thanos/pkg/cluster"
+	"github.com/improbable-eng/thanos/pkg/gate"
+	"github.com/improbable-eng/thanos/pkg/info"
+	"github.com/improbable-eng/thanos/pkg/info/infopb"
 	"github.com/improbable-eng/thanos/pkg/objstore/client"
-	"github.com/improbable-eng/thanos/pkg/objstore/s3"
+	"github.com/improbable-eng/thanos/pkg/profiler"
 	"github.com/improbable-eng/thanos/pkg/runutil"
+	"github.com/improbable-eng/thanos/pkg/server"
+	"github.com/improbable-eng/thanos/pkg/status"
 	"github.com/improbable-eng/thanos/pkg/store"
 	"github.com/improbable-eng/thanos/pkg/store/storepb"
+	thanostls "github.com/improbable-eng/thanos/pkg/tls"
 	"github.com/oklog/run"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
@@ -27,19 +29,22 @@ import (
 func registerStore(m map[string]setupFunc, app *kingpin.Application, name string) {
 	cmd := app.Command(name, "store node giving access to blocks in a GCS bucket")
 
-	grpcAddr := cmd.Flag("grpc-address", "Listen address for gRPC endpoints.").
+	grpcAddr := cmd.Flag("grpc-address", "Listen address for gRPC endpoints. If equal to http-address, HTTP and gRPC are served on the same port.").
 		Default(defaultGRPCAddr).String()
 
+	grpcTLS := thanostls.RegisterServerFlags(cmd)
+
 	httpAddr := cmd.Flag("http-address", "Listen address for HTTP endpoints.").
 		Default(defaultHTTPAddr).String()
 
+	httpFlags := server.RegisterHTTPFlags(cmd)
+
 	dataDir := cmd.Flag("tsdb.path", "Data directory of TSDB.").
 		Default("./data").String()
 
-	gcsBucket := cmd.Flag("gcs.bucket", "Google Cloud Storage bucket name for stored blocks. If empty sidecar won't store any block inside Google Cloud Storage.").
-		PlaceHolder("<bucket>").String()
-
-	s3Config := s3.RegisterS3Params(cmd)
+	objstoreConfig := client.RegisterParams(cmd)
+	cmd.Flag("gcs.bucket", "Google Cloud Storage bucket name for stored blocks. If empty sidecar won't store any block inside Google Cloud Storage.").
+		PlaceHolder("<bucket>").StringVar(&objstoreConfig.GCSBucket)
 
 	indexCacheSize := cmd.Flag("index-cache-size", "Maximum size of items held in the index cache.").
 		Default("250MB").Bytes()
@@ -47,60 +52,79 @@ func registerStore(m map[string]setupFunc, app *kingpin.Application, name string
 	chunkPoolSize := cmd.Flag("chunk-pool-size", "Maximum size of concurrently allocatable bytes for chunks.").
 		Default("2GB").Bytes()
 
-	peers := cmd.Flag("cluster.peers", "Initial peers to join the cluster. It can be either <ip:port>, or <domain:port>.").Strings()
+	maxConcurrentSeries := cmd.Flag("store.grpc.series-max-concurrency", "Maximum number of Series requests processed concurrently. 0 means no limit.").
+		Default("20").Int()
 
-	clusterBindAddr := cmd.Flag("cluster.address", "Listen address for cluster.").
-		Default(defaultClusterAddr).String()
+	seriesQueueTimeout := cmd.Flag("store.grpc.series-queue-timeout", "Maximum time a Series request waits for a free slot when the concurrency limit is reached. 0 means waiting until the request is canceled.").
+		Default("0s").Duration()
 
-	clusterAdvertiseAddr := cmd.Flag("cluster.advertise-address", "Explicit address to advertise in cluster.").
-		String()
+	ignoreDeletionMarksDelay := cmd.Flag("ignore-deletion-marks-delay", "Duration after which blocks marked for deletion are no longer served. "+
+		"It must be lower than the --delete-delay of the compactor, so blocks are dropped before they are deleted.").
+		Default("24h").Duration()
 
-	gossipInterval := cmd.Flag("cluster.gossip-interval", "Interval between sending gossip messages. By lowering this value (more frequent) gossip messages are propagated across the cluster more quickly at the expense of increased bandwidth.").
-		Default(cluster.DefaultGossipInterval.String()).Duration()
+	heapProfileThreshold := cmd.Flag("debug.heap-profile-threshold", "Upload a heap profile to the bucket under "+profiler.DebugProfiles+" when heap usage exceeds this size. 0 disables it.").
+		Default("0B").Bytes()
 
-	pushPullInterval := cmd.Flag("cluster.pushpull-interval", "Interval for gossip state syncs. Setting this interval lower (more frequent) will increase convergence speeds across larger clusters at the expense of increased bandwidth usage.").
-		Default(cluster.DefaultPushPullInterval.String()).Duration()
+	heapProfileCooldown := cmd.Flag("debug.heap-profile-cooldown", "Minimum time between two heap profiles uploaded because of the heap usage threshold.").
+		Default("10m").Duration()
 
 	m[name] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer) error {
-		peer, err := cluster.New(logger, reg, *clusterBindAddr, *clusterAdvertiseAddr, *peers, false, *gossipInterval, *pushPullInterval)
-		if err != nil {
-			return errors.Wrap(err, "new cluster peer")
-		}
 		return runStore(g,
 			logger,
 			reg,
 			tracer,
-			*gcsBucket,
-			s3Config,
+			objstoreConfig,
 			*dataDir,
 			*grpcAddr,
+			grpcTLS,
 			*httpAddr,
-			peer,
+			httpFlags,
+			newStatus(app, name),
 			uint64(*indexCacheSize),
 			uint64(*chunkPoolSize),
+			*maxConcurrentSeries,
+			*seriesQueueTimeout,
+			*ignoreDeletionMarksDelay,
+			uint64(*heapProfileThreshold),
+			*heapProfileCooldown,
 			name,
 		)
 	}
 }
 
-// runStore starts a daemon that serves queries to cluster peers using data from an object store.
+// runStore starts a daemon that serves queries to query nodes using data from an object store.
 func runStore(
 	g *run.Group,
 	logger log.Logger,
 	reg *prometheus.Registry,
 	tracer opentracing.Tracer,
-	gcsBucket string,
-	s3Config *s3.Config,
+	objstoreConfig *client.Config,
 	dataDir string,
 	grpcAddr string,
+	grpcTLS *thanostls.ServerConfig,
 	httpAddr string,
-	peer *cluster.Peer,
+	httpFlags *server.HTTPFlags,
+	st *status.Status,
 	indexCacheSizeBytes uint64,
 	chunkPoolSizeBytes uint64,
+	maxConcurrentSeries int,
+	seriesQueueTimeout time.Duration,
+	ignoreDeletionMarksDelay time.Duration,
+	heapProfileThreshold uint64,
+	heapProfileCooldown time.Duration,
 	component string,
 ) error {
+	srv, err := server.NewHTTPServer(logger, reg, httpFlags)
+	if err != nil {
+		return errors.Wrap(err, "create HTTP server")
+	}
+	hs := newGRPCHealthServer()
+	httpL, grpcL, err := listenHTTPAndGRPC(logger, g, httpAddr, grpcAddr, grpcTLS.CertFile != "" || srv.TLSEnabled())
+	if err != nil {
+		return err
+	}
 	{
-		bkt, closeFn, err := client.NewBucket(&gcsBucket, *s3Config, reg, component)
+		bkt, closeFn, err := client.NewBucket(*objstoreConfig, reg, component)
 		if err != nil {
 			return err
 		}
@@ -119,6 +143,8 @@ func runStore(
 			dataDir,
 			indexCacheSizeBytes,
 			chunkPoolSizeBytes,
+			gate.New(reg, "store_series", maxConcurrentSeries, seriesQueueTimeout),
+			ignoreDeletionMarksDelay,
 		)
 		if err != nil {
 			return errors.Wrap(err, "create object storage store")
@@ -138,7 +164,6 @@ func runStore(
 				if err := bs.SyncBlocks(ctx); err != nil {
 					level.Warn(logger).Log("msg", "syncing blocks failed", "err", err)
 				}
-				peer.SetTimestamps(bs.TimeRange())
 				return nil
 			})
 
@@ -148,59 +173,47 @@ func runStore(
 			cancel()
 		})
 
-		l, err := net.Listen("tcp", grpcAddr)
-		if err != nil {
-			return errors.Wrap(err, "listen API address")
+		// Profiles can be captured on demand and are uploaded to the bucket, so they survive the store being OOM killed.
+		prof := profiler.New(logger, reg, bkt, component)
+		srv.Handle("/debug/profile/capture", prof)
+
+		if heapProfileThreshold > 0 {
+			ctx, cancel := context.WithCancel(context.Background())
+			g.Add(func() error {
+				return prof.WatchHeap(ctx, 10*time.Second, heapProfileThreshold, heapProfileCooldown)
+			}, func(error) {
+				cancel()
+			})
 		}
 
-		s := grpc.NewServer(defaultGRPCServerOpts(logger, reg, tracer)...)
+		opts, err := defaultGRPCServerOpts(logger, reg, tracer, grpcTLS)
+		if err != nil {
+			return errors.Wrap(err, "setup gRPC server")
+		}
+		s := grpc.NewServer(opts...)
 		storepb.RegisterStoreServer(s, bs)
+		infopb.RegisterInfoServer(s, info.NewServer(info.ComponentStore, bs, st))
+		registerGRPCServices(s, hs)
 
 		g.Add(func() error {
-			return errors.Wrap(s.Serve(l), "serve gRPC")
-		}, func(error) {
-			l.Close()
-		})
-	}
-	{
-		ctx, cancel := context.WithCancel(context.Background())
-		g.Add(func() error {
-			err := peer.Join(cluster.PeerState{
-				Type:    cluster.PeerTypeStore,
-				APIAddr: grpcAddr,
-				Metadata: cluster.PeerMetadata{
-					MinTime: math.MinInt64,
-					MaxTime: math.MaxInt64,
-				},
-			})
-			if err != nil {
-				return errors.Wrap(err, "join cluster")
-			}
-
-			<-ctx.Done()
-			return nil
+			return errors.Wrap(s.Serve(grpcL), "serve gRPC")
 		}, func(error) {
-			cancel()
-			peer.Close(5 * time.Second)
+			grpcL.Close()
 		})
 	}
 	{
-		mux := http.NewServeMux()
-		registerMetrics(mux, reg)
-		registerProfile(mux)
-
-		l, err := net.Listen("tcp", httpAddr)
-		if err != nil {
-			return errors.Wrap(err, "listen metrics address")
-		}
+		registerMetrics(srv, reg)
+		registerProfile(srv)
+		st.Register(srv)
 
 		g.Add(func() error {
-			return errors.Wrap(http.Serve(l, mux), "serve metrics")
+			return errors.Wrap(srv.Serve(httpL), "serve metrics")
 		}, func(error) {
-			l.Close()
+			srv.Shutdown()
 		})
 	}
 
+	markReady(srv, hs)
 	level.Info(logger).Log("msg", "starting store node")
 	return nil
 }
@@ -0,0 +1,134 @@
+// Package backfill creates Thanos blocks from historical data dumped in the Prometheus
+// text exposition format, e.g. exported from other monitoring systems.
+package backfill
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	promlabels "github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/textparse"
+	"github.com/prometheus/tsdb"
+	"github.com/prometheus/tsdb/labels"
+)
+
+type sample struct {
+	lset labels.Labels
+	t    int64
+	v    float64
+}
+
+// Importer groups samples parsed from exposition format dumps by the time range of the block
+// they belong to and writes them as Thanos blocks.
+// All samples are kept in memory until the blocks are written.
+type Importer struct {
+	logger        log.Logger
+	blockDuration int64
+	windows       map[int64][]sample
+}
+
+// NewImporter returns importer creating blocks aligned to the given block duration.
+func NewImporter(logger log.Logger, blockDuration time.Duration) *Importer {
+	return &Importer{
+		logger:        logger,
+		blockDuration: int64(blockDuration / time.Millisecond),
+		windows:       map[int64][]sample{},
+	}
+}
+
+// Parse adds all samples of the exposition format dump to the importer and returns their number.
+// Every sample must have a timestamp.
+func (i *Importer) Parse(b []byte) (n int, err error) {
+	p := textparse.New(b)
+	for p.Next() {
+		series, ts, v := p.At()
+		if ts == nil {
+			return n, errors.Errorf("sample %s has no timestamp", series)
+		}
+
+		var lset promlabels.Labels
+		p.Metric(&lset)
+		if lset.Get(promlabels.MetricName) == "" {
+			return n, errors.Errorf("sample %s has no metric name", series)
+		}
+
+		start := i.windowStart(*ts)
+		i.windows[start] = append(i.windows[start], sample{lset: block.LabelsPromToTSDB(lset), t: *ts, v: v})
+		n++
+	}
+	if err := p.Err(); err != nil {
+		return n, errors.Wrap(err, "parse")
+	}
+	return n, nil
+}
+
+// windowStart returns the start of the block time range the timestamp belongs to.
+func (i *Importer) windowStart(t int64) int64 {
+	start := t / i.blockDuration * i.blockDuration
+	if t < 0 && t%i.blockDuration != 0 {
+		start -= i.blockDuration
+	}
+	return start
+}
+
+// WriteBlocks writes a block for each time range with samples into dir and finalizes
+// them with the given external labels. It returns IDs of the created blocks in time order.
+func (i *Importer) WriteBlocks(dir string, extLset labels.Labels) ([]ulid.ULID, error) {
+	if len(extLset) == 0 {
+		return nil, errors.New("empty external labels are not allowed for Thanos block")
+	}
+
+	var starts []int64
+	for s := range i.windows {
+		starts = append(starts, s)
+	}
+	sort.Slice(starts, func(a, b int) bool { return starts[a] < starts[b] })
+
+	var ids []ulid.ULID
+	for _, start := range starts {
+		id, err := i.writeBlock(dir, start, start+i.blockDuration, i.windows[start])
+		if err != nil {
+			return ids, errors.Wrapf(err, "write block for range [%d, %d)", start, start+i.blockDuration)
+		}
+		if _, err := block.Finalize(filepath.Join(dir, id.String()), extLset.Map(), 0, nil); err != nil {
+			return ids, errors.Wrapf(err, "finalize block %s", id)
+		}
+		level.Info(i.logger).Log("msg", "created block", "id", id, "mint", start, "maxt", start+i.blockDuration, "samples", len(i.windows[start]))
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (i *Importer) writeBlock(dir string, mint, maxt int64, samples []sample) (id ulid.ULID, err error) {
+	// The head only accepts samples in time order.
+	sort.SliceStable(samples, func(a, b int) bool { return samples[a].t < samples[b].t })
+
+	h, err := tsdb.NewHead(nil, i.logger, tsdb.NopWAL(), i.blockDuration)
+	if err != nil {
+		return id, errors.Wrap(err, "create head block")
+	}
+	defer h.Close()
+
+	app := h.Appender()
+	for _, s := range samples {
+		if _, err := app.Add(s.lset, s.t, s.v); err != nil {
+			app.Rollback()
+			return id, errors.Wrapf(err, "add sample of series %s at %d", s.lset, s.t)
+		}
+	}
+	if err := app.Commit(); err != nil {
+		return id, errors.Wrap(err, "commit")
+	}
+
+	c, err := tsdb.NewLeveledCompactor(nil, i.logger, []int64{maxt - mint}, nil)
+	if err != nil {
+		return id, errors.Wrap(err, "create compactor")
+	}
+	return c.Write(dir, h, mint, maxt)
+}
@@ -0,0 +1,79 @@
+package backfill
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/prometheus/tsdb/labels"
+)
+
+func TestImporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-backfill")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	hour := int64(time.Hour / time.Millisecond)
+	imp := NewImporter(log.NewNopLogger(), 2*time.Hour)
+
+	n, err := imp.Parse([]byte(`# HELP http_requests_total Total HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{code="200"} 1 0
+http_requests_total{code="500"} 1 1000
+http_requests_total{code="200"} 5 7200000
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, n)
+
+	// Second dump with samples of the same time ranges, out of order.
+	n, err = imp.Parse([]byte(`up{job="a"} 1 7300000
+up{job="a"} 0 7250000
+http_requests_total{code="200"} 3 3600000
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, n)
+
+	_, err = imp.Parse([]byte("up 1\n"))
+	testutil.NotOk(t, err)
+
+	_, err = imp.WriteBlocks(dir, nil)
+	testutil.NotOk(t, err)
+
+	extLset := labels.FromStrings("replica", "backfill")
+	ids, err := imp.WriteBlocks(dir, extLset)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(ids))
+
+	for i, exp := range []struct {
+		mint, maxt         int64
+		series, numSamples uint64
+	}{
+		{mint: 0, maxt: 2 * hour, series: 2, numSamples: 3},
+		{mint: 2 * hour, maxt: 4 * hour, series: 2, numSamples: 3},
+	} {
+		meta, err := block.ReadMetaFile(filepath.Join(dir, ids[i].String()))
+		testutil.Ok(t, err)
+		testutil.Equals(t, exp.mint, meta.MinTime)
+		testutil.Equals(t, exp.maxt, meta.MaxTime)
+		testutil.Equals(t, exp.series, meta.Stats.NumSeries)
+		testutil.Equals(t, exp.numSamples, meta.Stats.NumSamples)
+		testutil.Equals(t, extLset.Map(), meta.Thanos.Labels)
+
+		testutil.Ok(t, block.VerifyIndex(filepath.Join(dir, ids[i].String(), block.IndexFilename), meta.MinTime, meta.MaxTime))
+	}
+}
+
+func TestImporter_windowStart(t *testing.T) {
+	imp := NewImporter(log.NewNopLogger(), 10*time.Millisecond)
+
+	testutil.Equals(t, int64(0), imp.windowStart(0))
+	testutil.Equals(t, int64(0), imp.windowStart(9))
+	testutil.Equals(t, int64(10), imp.windowStart(10))
+	testutil.Equals(t, int64(-10), imp.windowStart(-1))
+	testutil.Equals(t, int64(-10), imp.windowStart(-10))
+}
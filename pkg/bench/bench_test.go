@@ -0,0 +1,110 @@
+package bench
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/store/storepb"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/prometheus/tsdb"
+	"github.com/prometheus/tsdb/chunks"
+	"github.com/prometheus/tsdb/index"
+	"github.com/prometheus/tsdb/labels"
+)
+
+func TestGenerateBlocksAndRunSeries(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "test-bench")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := BlockConfig{
+		Blocks:          2,
+		BlockDuration:   time.Hour,
+		MinTime:         0,
+		Series:          10,
+		Churn:           0.5,
+		ScrapeInterval:  15 * time.Second,
+		SamplesPerChunk: 50,
+		Labels:          labels.FromStrings("ext", "bench"),
+	}
+	ids, err := GenerateBlocks(ctx, log.NewNopLogger(), filepath.Join(dir, "blocks"), cfg)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(ids))
+
+	// Half of the series of the first block are replaced in the second one.
+	for i, id := range ids {
+		b, err := tsdb.OpenBlock(filepath.Join(dir, "blocks", id.String()), nil)
+		testutil.Ok(t, err)
+
+		testutil.Equals(t, int64(i)*time.Hour.Nanoseconds()/1e6, b.Meta().MinTime)
+		testutil.Equals(t, uint64(10), b.Meta().Stats.NumSeries)
+		testutil.Equals(t, uint64(10*240), b.Meta().Stats.NumSamples)
+
+		ir, err := b.Index()
+		testutil.Ok(t, err)
+		p, err := ir.Postings(index.AllPostingsKey())
+		testutil.Ok(t, err)
+
+		seen := map[string]struct{}{}
+		for p.Next() {
+			var (
+				lset labels.Labels
+				chks []chunks.Meta
+			)
+			testutil.Ok(t, ir.Series(p.At(), &lset, &chks))
+			seen[lset.Get("series")] = struct{}{}
+			// 240 samples are cut into chunks of at most 50 samples.
+			testutil.Equals(t, 5, len(chks))
+		}
+		testutil.Ok(t, p.Err())
+		testutil.Equals(t, 10, len(seen))
+		_, ok := seen[SeriesLabels(i*5).Get("series")]
+		testutil.Assert(t, ok, "first series of block %d missing", i)
+
+		testutil.Ok(t, ir.Close())
+		testutil.Ok(t, b.Close())
+	}
+
+	bkt := inmem.NewBucket()
+	for _, id := range ids {
+		testutil.Ok(t, block.Upload(ctx, bkt, filepath.Join(dir, "blocks", id.String())))
+	}
+	client, closeFn, err := ServeBucketStore(ctx, nil, nil, bkt, BucketStoreConfig{
+		Dir:                 filepath.Join(dir, "store"),
+		IndexCacheSizeBytes: 1e6,
+	})
+	testutil.Ok(t, err)
+	defer closeFn()
+
+	matchers, err := ParseSelector(MetricName + `{job=~"job-.*"}`)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []storepb.LabelMatcher{
+		{Type: storepb.LabelMatcher_RE, Name: "job", Value: "job-.*"},
+		{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: MetricName},
+	}, matchers)
+
+	res, err := RunSeries(ctx, log.NewNopLogger(), client, SeriesConfig{
+		Concurrency: 3,
+		Requests:    10,
+		MinTime:     0,
+		MaxTime:     2 * time.Hour.Nanoseconds() / 1e6,
+		Matchers:    matchers,
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 10, res.Requests)
+	testutil.Equals(t, 0, res.Failures)
+	testutil.Equals(t, 10, len(res.Latencies))
+	// Series of both blocks are merged, 15 distinct series with 5 chunks in each of their blocks.
+	testutil.Equals(t, int64(10*15), res.Series)
+	testutil.Equals(t, int64(10*20*5), res.Chunks)
+	testutil.Assert(t, res.Quantile(0.5) <= res.Quantile(1), "unsorted latencies")
+}
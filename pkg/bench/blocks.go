@@ -0,0 +1,208 @@
+// Package bench generates synthetic blocks and measures the latency and memory usage of Series requests
+// against store API servers. It is used to validate performance related changes, e.g. to the store gateway.
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/tsdb/chunks"
+	"github.com/prometheus/tsdb/labels"
+)
+
+const (
+	// MetricName is the metric name of all generated series.
+	MetricName = "thanos_bench_series"
+
+	// Number of distinct values of the job and instance labels, so requests of different
+	// selectivity can be benchmarked.
+	numJobs      = 10
+	numInstances = 100
+)
+
+// BlockConfig configures the generated blocks.
+type BlockConfig struct {
+	// Blocks is the number of consecutive blocks.
+	Blocks int
+	// BlockDuration is the time range covered by each block.
+	BlockDuration time.Duration
+	// MinTime is the start of the first block in milliseconds.
+	MinTime int64
+	// Series is the number of series in each block.
+	Series int
+	// Churn is the fraction of series replaced by new series from one block to the next.
+	Churn float64
+	// ScrapeInterval is the time between two samples of a series.
+	ScrapeInterval time.Duration
+	// SamplesPerChunk is the maximum number of samples in a chunk.
+	SamplesPerChunk int
+	// Labels are the external labels of the blocks.
+	Labels labels.Labels
+}
+
+func (c BlockConfig) validate() error {
+	if c.Blocks <= 0 {
+		return errors.New("number of blocks must be positive")
+	}
+	if c.Series <= 0 {
+		return errors.New("number of series must be positive")
+	}
+	if c.Churn < 0 || c.Churn > 1 {
+		return errors.Errorf("churn %v must be between 0 and 1", c.Churn)
+	}
+	if c.ScrapeInterval <= 0 || c.BlockDuration < c.ScrapeInterval {
+		return errors.New("scrape interval must be positive and not longer than the block duration")
+	}
+	if c.SamplesPerChunk <= 0 {
+		return errors.New("samples per chunk must be positive")
+	}
+	if len(c.Labels) == 0 {
+		return errors.New("external labels must not be empty")
+	}
+	return nil
+}
+
+// SeriesLabels returns the labels of the series with the given ID. Besides the unique series label,
+// series share one of 10 job and one of 100 instance labels.
+func SeriesLabels(id int) labels.Labels {
+	return labels.FromStrings(
+		"__name__", MetricName,
+		"instance", fmt.Sprintf("instance-%d", id%numInstances),
+		"job", fmt.Sprintf("job-%d", id%numJobs),
+		"series", strconv.Itoa(id),
+	)
+}
+
+// GenerateBlocks writes the configured blocks into dir and returns their IDs. The i-th block holds the series
+// with IDs [i*replaced, i*replaced+series), where replaced is the number of series churned between blocks.
+// Every series has a sample at each scrape interval of the block, its chunks are cut after the configured number of samples.
+func GenerateBlocks(ctx context.Context, logger log.Logger, dir string, cfg BlockConfig) ([]ulid.ULID, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	var (
+		ids      []ulid.ULID
+		replaced = int(cfg.Churn * float64(cfg.Series))
+		dur      = int64(cfg.BlockDuration / time.Millisecond)
+		interval = int64(cfg.ScrapeInterval / time.Millisecond)
+	)
+	for i := 0; i < cfg.Blocks; i++ {
+		if err := ctx.Err(); err != nil {
+			return ids, err
+		}
+		mint := cfg.MinTime + int64(i)*dur
+		maxt := mint + dur
+
+		// Seed per block so the same configuration always generates the same data.
+		rnd := rand.New(rand.NewSource(int64(i)))
+
+		// Series have to be written in the order of their label sets.
+		var (
+			lsets   []labels.Labels
+			symbols = map[string]struct{}{}
+		)
+		for id := i * replaced; id < i*replaced+cfg.Series; id++ {
+			lset := SeriesLabels(id)
+			for _, l := range lset {
+				symbols[l.Name] = struct{}{}
+				symbols[l.Value] = struct{}{}
+			}
+			lsets = append(lsets, lset)
+		}
+		sort.Slice(lsets, func(i, j int) bool {
+			return labels.Compare(lsets[i], lsets[j]) < 0
+		})
+
+		id, err := writeBlock(dir, mint, maxt, symbols, lsets, func() ([]chunks.Meta, error) {
+			return generateChunks(rnd, mint, maxt, interval, cfg.SamplesPerChunk)
+		})
+		if err != nil {
+			return ids, errors.Wrap(err, "write block")
+		}
+		if _, err := block.Finalize(filepath.Join(dir, id.String()), cfg.Labels.Map(), 0, nil); err != nil {
+			return ids, errors.Wrapf(err, "finalize block %s", id)
+		}
+		level.Info(logger).Log("msg", "generated block", "id", id, "mint", mint, "maxt", maxt, "series", cfg.Series)
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// generateChunks returns XOR chunks with samples of a counter at every interval in [mint, maxt).
+func generateChunks(rnd *rand.Rand, mint, maxt, interval int64, samplesPerChunk int) ([]chunks.Meta, error) {
+	var (
+		res []chunks.Meta
+		v   float64
+		chk *chunkenc.XORChunk
+		app chunkenc.Appender
+		err error
+	)
+	for t := mint; t < maxt; t += interval {
+		if chk == nil || chk.NumSamples() >= samplesPerChunk {
+			chk = chunkenc.NewXORChunk()
+			if app, err = chk.Appender(); err != nil {
+				return nil, err
+			}
+			res = append(res, chunks.Meta{MinTime: t, Chunk: chk})
+		}
+		v += float64(rnd.Intn(100))
+		app.Append(t, v)
+		res[len(res)-1].MaxTime = t
+	}
+	return res, nil
+}
+
+// writeBlock writes a level 1 block with the given series into dir. Chunks of a series are generated right before
+// it is written, so only the postings of the block are kept in memory.
+func writeBlock(
+	dir string,
+	mint, maxt int64,
+	symbols map[string]struct{},
+	lsets []labels.Labels,
+	genChunks func() ([]chunks.Meta, error),
+) (id ulid.ULID, err error) {
+	id = ulid.MustNew(ulid.Now(), rand.New(rand.NewSource(time.Now().UnixNano())))
+	bdir := filepath.Join(dir, id.String())
+
+	w, err := block.NewStreamedBlockWriter(bdir, symbols)
+	if err != nil {
+		return id, err
+	}
+	defer w.Close()
+
+	for _, lset := range lsets {
+		chks, err := genChunks()
+		if err != nil {
+			return id, errors.Wrapf(err, "generate chunks of series %s", lset)
+		}
+		if err := w.AddSeries(lset, chks); err != nil {
+			return id, errors.Wrapf(err, "write series %s", lset)
+		}
+	}
+	if err := w.Finish(); err != nil {
+		return id, err
+	}
+
+	meta := &block.Meta{Version: 1}
+	meta.ULID = id
+	meta.MinTime = mint
+	meta.MaxTime = maxt
+	meta.Stats = w.Stats()
+	meta.Compaction.Level = 1
+	meta.Compaction.Sources = []ulid.ULID{id}
+	if err := block.WriteMetaFile(bdir, meta); err != nil {
+		return id, errors.Wrap(err, "write meta file")
+	}
+	return id, nil
+}
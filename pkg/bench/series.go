@@ -0,0 +1,270 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/gate"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/store"
+	"github.com/improbable-eng/thanos/pkg/store/storepb"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"google.golang.org/grpc"
+)
+
+// SeriesConfig configures a Series benchmark.
+type SeriesConfig struct {
+	// Concurrency is the number of requests in flight at any time.
+	Concurrency int
+	// Requests is the total number of requests.
+	Requests int
+	// MinTime and MaxTime are the requested time range in milliseconds.
+	MinTime, MaxTime int64
+	Matchers         []storepb.LabelMatcher
+}
+
+// SeriesResult holds the measurements of a Series benchmark.
+type SeriesResult struct {
+	Requests int
+	Failures int
+	// Series and Chunks are the total number of series and chunks received.
+	Series int64
+	Chunks int64
+	// Duration is the wall time of the whole benchmark.
+	Duration time.Duration
+	// Latencies of successful requests, sorted in ascending order.
+	Latencies []time.Duration
+
+	// TotalAllocBytes is the memory allocated by this process during the benchmark, MaxHeapInuseBytes
+	// the maximum heap usage sampled during the benchmark. They include the store if it runs in-process.
+	TotalAllocBytes   uint64
+	MaxHeapInuseBytes uint64
+}
+
+// Quantile returns the q-quantile of the latencies of successful requests.
+func (r *SeriesResult) Quantile(q float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	return r.Latencies[int(q*float64(len(r.Latencies)-1))]
+}
+
+// Print writes a human readable summary of the result.
+func (r *SeriesResult) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "requests\t%d\n", r.Requests)
+	fmt.Fprintf(tw, "failures\t%d\n", r.Failures)
+	fmt.Fprintf(tw, "series\t%d\n", r.Series)
+	fmt.Fprintf(tw, "chunks\t%d\n", r.Chunks)
+	fmt.Fprintf(tw, "duration\t%s\n", r.Duration)
+	if r.Duration > 0 {
+		fmt.Fprintf(tw, "requests/s\t%.2f\n", float64(r.Requests-r.Failures)/r.Duration.Seconds())
+	}
+	for _, q := range []float64{0.5, 0.9, 0.99, 1} {
+		fmt.Fprintf(tw, "latency p%v\t%s\n", q*100, r.Quantile(q))
+	}
+	fmt.Fprintf(tw, "total alloc bytes\t%d\n", r.TotalAllocBytes)
+	fmt.Fprintf(tw, "max heap in-use bytes\t%d\n", r.MaxHeapInuseBytes)
+	return tw.Flush()
+}
+
+// RunSeries runs the configured number of Series requests against the store API server and measures their
+// latency and the memory usage of this process.
+func RunSeries(ctx context.Context, logger log.Logger, client storepb.StoreClient, cfg SeriesConfig) (*SeriesResult, error) {
+	if cfg.Concurrency <= 0 || cfg.Requests <= 0 {
+		return nil, errors.New("concurrency and number of requests must be positive")
+	}
+	req := &storepb.SeriesRequest{
+		MinTime:  cfg.MinTime,
+		MaxTime:  cfg.MaxTime,
+		Matchers: cfg.Matchers,
+	}
+	res := &SeriesResult{}
+
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	// Sample the heap usage until all requests are done.
+	heapDone := make(chan struct{})
+	heapStopped := make(chan struct{})
+	go func() {
+		defer close(heapStopped)
+		var ms runtime.MemStats
+		for {
+			runtime.ReadMemStats(&ms)
+			if ms.HeapInuse > res.MaxHeapInuseBytes {
+				res.MaxHeapInuseBytes = ms.HeapInuse
+			}
+			select {
+			case <-heapDone:
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}()
+
+	var (
+		mtx   sync.Mutex
+		wg    sync.WaitGroup
+		reqc  = make(chan struct{})
+		begin = time.Now()
+	)
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range reqc {
+				start := time.Now()
+				series, chunks, err := seriesRequest(ctx, client, req)
+				took := time.Since(start)
+
+				mtx.Lock()
+				if err != nil {
+					res.Failures++
+					level.Debug(logger).Log("msg", "series request failed", "err", err)
+				} else {
+					res.Latencies = append(res.Latencies, took)
+					res.Series += series
+					res.Chunks += chunks
+				}
+				mtx.Unlock()
+			}
+		}()
+	}
+	var err error
+loop:
+	for i := 0; i < cfg.Requests; i++ {
+		select {
+		case reqc <- struct{}{}:
+			res.Requests++
+		case <-ctx.Done():
+			err = ctx.Err()
+			break loop
+		}
+	}
+	close(reqc)
+	wg.Wait()
+	res.Duration = time.Since(begin)
+
+	close(heapDone)
+	<-heapStopped
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	res.TotalAllocBytes = after.TotalAlloc - before.TotalAlloc
+
+	sort.Slice(res.Latencies, func(i, j int) bool { return res.Latencies[i] < res.Latencies[j] })
+	return res, err
+}
+
+// ParseSelector parses a series selector, e.g. 'thanos_bench_series{job="job-1"}', into matchers of Series requests.
+func ParseSelector(s string) ([]storepb.LabelMatcher, error) {
+	ms, err := promql.ParseMetricSelector(s)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]storepb.LabelMatcher, 0, len(ms))
+	for _, m := range ms {
+		var t storepb.LabelMatcher_Type
+
+		switch m.Type {
+		case labels.MatchEqual:
+			t = storepb.LabelMatcher_EQ
+		case labels.MatchNotEqual:
+			t = storepb.LabelMatcher_NEQ
+		case labels.MatchRegexp:
+			t = storepb.LabelMatcher_RE
+		case labels.MatchNotRegexp:
+			t = storepb.LabelMatcher_NRE
+		default:
+			return nil, errors.Errorf("unrecognized matcher type %d", m.Type)
+		}
+		res = append(res, storepb.LabelMatcher{Type: t, Name: m.Name, Value: m.Value})
+	}
+	return res, nil
+}
+
+// seriesRequest runs a Series request and returns the number of received series and chunks.
+func seriesRequest(ctx context.Context, client storepb.StoreClient, req *storepb.SeriesRequest) (series, chunks int64, err error) {
+	sc, err := client.Series(ctx, req)
+	if err != nil {
+		return 0, 0, err
+	}
+	for {
+		resp, err := sc.Recv()
+		if err == io.EOF {
+			return series, chunks, nil
+		}
+		if err != nil {
+			return series, chunks, err
+		}
+		if s := resp.GetSeries(); s != nil {
+			series++
+			chunks += int64(len(s.Chunks))
+		}
+	}
+}
+
+// BucketStoreConfig configures a store gateway serving blocks in-process.
+type BucketStoreConfig struct {
+	// Dir is the local directory for index caches of blocks.
+	Dir                 string
+	IndexCacheSizeBytes uint64
+	ChunkPoolSizeBytes  uint64
+	// MaxConcurrentSeries limits the number of concurrently processed Series requests. 0 means no limit.
+	MaxConcurrentSeries int
+}
+
+// ServeBucketStore syncs all blocks of the bucket into a bucket store and serves it on a local gRPC port.
+// It returns a client of the store and a function stopping the server.
+func ServeBucketStore(
+	ctx context.Context,
+	logger log.Logger,
+	reg prometheus.Registerer,
+	bkt objstore.BucketReader,
+	cfg BucketStoreConfig,
+) (storepb.StoreClient, func(), error) {
+	bs, err := store.NewBucketStore(logger, reg, bkt, cfg.Dir, cfg.IndexCacheSizeBytes, cfg.ChunkPoolSizeBytes,
+		gate.New(reg, "store_series", cfg.MaxConcurrentSeries, 0), 0)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "create bucket store")
+	}
+	if err := bs.InitialSync(ctx); err != nil {
+		bs.Close()
+		return nil, nil, errors.Wrap(err, "sync blocks")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		bs.Close()
+		return nil, nil, errors.Wrap(err, "listen")
+	}
+	srv := grpc.NewServer()
+	storepb.RegisterStoreServer(srv, bs)
+	go srv.Serve(l)
+
+	conn, err := grpc.DialContext(ctx, l.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		srv.Stop()
+		bs.Close()
+		return nil, nil, errors.Wrap(err, "dial store")
+	}
+	return storepb.NewStoreClient(conn), func() {
+		conn.Close()
+		srv.Stop()
+		bs.Close()
+	}, nil
+}
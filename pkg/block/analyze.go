@@ -0,0 +1,307 @@
+package block
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/tsdb/chunks"
+	"github.com/prometheus/tsdb/index"
+	"github.com/prometheus/tsdb/labels"
+)
+
+// Count is a named counter used to report cardinality statistics.
+type Count struct {
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+}
+
+// IndexAnalysis contains cardinality statistics of a block index. All lists are sorted
+// in descending order of their counts and limited to the requested number of entries.
+type IndexAnalysis struct {
+	Series     uint64 `json:"series"`
+	LabelNames int    `json:"label_names"`
+	LabelPairs int    `json:"label_pairs"`
+
+	// HighestCardinalityLabels counts distinct values per label name.
+	HighestCardinalityLabels []Count `json:"highest_cardinality_labels"`
+	// HighestCardinalityMetricNames counts series per metric name.
+	HighestCardinalityMetricNames []Count `json:"highest_cardinality_metric_names"`
+	// MostCommonLabelPairs counts series per label pair.
+	MostCommonLabelPairs []Count `json:"most_common_label_pairs"`
+	// LabelNamesByValueLength sums the length of all distinct values per label name, which
+	// approximates the memory used by the label in the symbol table.
+	LabelNamesByValueLength []Count `json:"label_names_by_value_length"`
+}
+
+// AnalyzeIndex reads all series of the index file and gathers cardinality statistics.
+// Each list of the result is limited to the given number of entries.
+func AnalyzeIndex(fn string, limit int) (*IndexAnalysis, error) {
+	r, err := index.NewFileReader(fn)
+	if err != nil {
+		return nil, errors.Wrap(err, "open index file")
+	}
+	defer r.Close()
+
+	p, err := r.Postings(index.AllPostingsKey())
+	if err != nil {
+		return nil, errors.Wrap(err, "get all postings")
+	}
+
+	var (
+		res     IndexAnalysis
+		lset    labels.Labels
+		chks    []chunks.Meta
+		values  = map[string]map[string]struct{}{}
+		metrics = map[string]uint64{}
+		pairs   = map[string]uint64{}
+	)
+	for p.Next() {
+		if err := r.Series(p.At(), &lset, &chks); err != nil {
+			return nil, errors.Wrap(err, "read series")
+		}
+		res.Series++
+
+		for _, l := range lset {
+			addValue(values, l.Name, l.Value)
+			pairs[l.Name+"="+l.Value]++
+
+			if l.Name == "__name__" {
+				metrics[l.Value]++
+			}
+		}
+	}
+	if p.Err() != nil {
+		return nil, errors.Wrap(p.Err(), "walk postings")
+	}
+
+	res.LabelNames = len(values)
+	res.LabelPairs = len(pairs)
+
+	var cardinality, valueLength []Count
+	for n, vals := range values {
+		length := uint64(0)
+		for v := range vals {
+			length += uint64(len(v))
+		}
+		cardinality = append(cardinality, Count{Name: n, Count: uint64(len(vals))})
+		valueLength = append(valueLength, Count{Name: n, Count: length})
+	}
+	res.HighestCardinalityLabels = topCounts(cardinality, limit)
+	res.LabelNamesByValueLength = topCounts(valueLength, limit)
+	res.HighestCardinalityMetricNames = topCounts(mapCounts(metrics), limit)
+	res.MostCommonLabelPairs = topCounts(mapCounts(pairs), limit)
+
+	return &res, nil
+}
+
+func mapCounts(m map[string]uint64) []Count {
+	res := make([]Count, 0, len(m))
+	for n, c := range m {
+		res = append(res, Count{Name: n, Count: c})
+	}
+	return res
+}
+
+// topCounts sorts counts in descending order and returns at most limit of them.
+func topCounts(counts []Count, limit int) []Count {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	if limit > 0 && len(counts) > limit {
+		counts = counts[:limit]
+	}
+	return counts
+}
+
+// MetricChurn describes churn of a single metric name between two blocks.
+type MetricChurn struct {
+	Name string `json:"name"`
+	// Series is the number of distinct series of the metric in both blocks.
+	Series  uint64 `json:"series"`
+	Added   uint64 `json:"added"`
+	Removed uint64 `json:"removed"`
+}
+
+// Rate returns the fraction of series of the metric that exist in only one of the blocks.
+func (c MetricChurn) Rate() float64 {
+	if c.Series == 0 {
+		return 0
+	}
+	return float64(c.Added+c.Removed) / float64(c.Series)
+}
+
+// ChurnAnalysis contains series churn statistics between two consecutive blocks.
+type ChurnAnalysis struct {
+	PrevSeries uint64 `json:"prev_series"`
+	NextSeries uint64 `json:"next_series"`
+	Added      uint64 `json:"added"`
+	Removed    uint64 `json:"removed"`
+
+	// Metrics contains metric names with the highest number of added and removed series.
+	Metrics []MetricChurn `json:"metrics"`
+	// LabelNames counts per label name the values found in added series that do not exist in the previous block.
+	LabelNames []Count `json:"label_names"`
+}
+
+// AnalyzeChurn compares the series of two index files of consecutive blocks and gathers churn statistics.
+// Each list of the result is limited to the given number of entries.
+func AnalyzeChurn(prevIndex, nextIndex string, limit int) (*ChurnAnalysis, error) {
+	prev, err := readSeriesLabels(prevIndex)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read series of %s", prevIndex)
+	}
+	next, err := readSeriesLabels(nextIndex)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read series of %s", nextIndex)
+	}
+
+	res := ChurnAnalysis{
+		PrevSeries: prev.len(),
+		NextSeries: next.len(),
+	}
+	var (
+		metrics    = map[string]*MetricChurn{}
+		prevValues = map[string]map[string]struct{}{}
+		newValues  = map[string]map[string]struct{}{}
+	)
+	metric := func(lset labels.Labels) *MetricChurn {
+		n := lset.Get("__name__")
+		m, ok := metrics[n]
+		if !ok {
+			m = &MetricChurn{Name: n}
+			metrics[n] = m
+		}
+		m.Series++
+		return m
+	}
+	prev.each(func(lset labels.Labels) {
+		for _, l := range lset {
+			addValue(prevValues, l.Name, l.Value)
+		}
+	})
+	prev.each(func(lset labels.Labels) {
+		m := metric(lset)
+		if !next.contains(lset) {
+			m.Removed++
+			res.Removed++
+		}
+	})
+	next.each(func(lset labels.Labels) {
+		if prev.contains(lset) {
+			// Series existing in both blocks are already counted.
+			return
+		}
+		m := metric(lset)
+		m.Added++
+		res.Added++
+
+		for _, l := range lset {
+			if _, ok := prevValues[l.Name][l.Value]; !ok {
+				addValue(newValues, l.Name, l.Value)
+			}
+		}
+	})
+
+	for _, m := range metrics {
+		if m.Added+m.Removed > 0 {
+			res.Metrics = append(res.Metrics, *m)
+		}
+	}
+	sort.Slice(res.Metrics, func(i, j int) bool {
+		ci, cj := res.Metrics[i].Added+res.Metrics[i].Removed, res.Metrics[j].Added+res.Metrics[j].Removed
+		if ci != cj {
+			return ci > cj
+		}
+		return res.Metrics[i].Name < res.Metrics[j].Name
+	})
+	if limit > 0 && len(res.Metrics) > limit {
+		res.Metrics = res.Metrics[:limit]
+	}
+
+	var labelNames []Count
+	for n, vals := range newValues {
+		labelNames = append(labelNames, Count{Name: n, Count: uint64(len(vals))})
+	}
+	res.LabelNames = topCounts(labelNames, limit)
+
+	return &res, nil
+}
+
+func addValue(values map[string]map[string]struct{}, name, value string) {
+	vals, ok := values[name]
+	if !ok {
+		vals = map[string]struct{}{}
+		values[name] = vals
+	}
+	vals[value] = struct{}{}
+}
+
+// seriesSet holds label sets keyed by their hash. Label sets with colliding hashes are kept side by side.
+type seriesSet map[uint64][]labels.Labels
+
+func (s seriesSet) add(lset labels.Labels) {
+	h := lset.Hash()
+	for _, l := range s[h] {
+		if l.Equals(lset) {
+			return
+		}
+	}
+	s[h] = append(s[h], lset)
+}
+
+func (s seriesSet) contains(lset labels.Labels) bool {
+	for _, l := range s[lset.Hash()] {
+		if l.Equals(lset) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s seriesSet) len() (n uint64) {
+	for _, lsets := range s {
+		n += uint64(len(lsets))
+	}
+	return n
+}
+
+func (s seriesSet) each(f func(labels.Labels)) {
+	for _, lsets := range s {
+		for _, lset := range lsets {
+			f(lset)
+		}
+	}
+}
+
+// readSeriesLabels returns label sets of all series of the index file.
+func readSeriesLabels(fn string) (seriesSet, error) {
+	r, err := index.NewFileReader(fn)
+	if err != nil {
+		return nil, errors.Wrap(err, "open index file")
+	}
+	defer r.Close()
+
+	p, err := r.Postings(index.AllPostingsKey())
+	if err != nil {
+		return nil, errors.Wrap(err, "get all postings")
+	}
+
+	var (
+		res  = seriesSet{}
+		lset labels.Labels
+		chks []chunks.Meta
+	)
+	for p.Next() {
+		if err := r.Series(p.At(), &lset, &chks); err != nil {
+			return nil, errors.Wrap(err, "read series")
+		}
+		res.add(append(labels.Labels{}, lset...))
+	}
+	if p.Err() != nil {
+		return nil, errors.Wrap(p.Err(), "walk postings")
+	}
+	return res, nil
+}
@@ -0,0 +1,51 @@
+package block_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/prometheus/tsdb/labels"
+)
+
+func TestAnalyzeIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-analyze-index")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	id, err := testutil.CreateBlock(dir, []labels.Labels{
+		labels.FromStrings("__name__", "a", "job", "x", "instance", "1"),
+		labels.FromStrings("__name__", "a", "job", "x", "instance", "2"),
+		labels.FromStrings("__name__", "a", "job", "x", "instance", "3"),
+		labels.FromStrings("__name__", "b", "job", "x", "instance", "1"),
+	}, 10, 0, 1000, labels.FromStrings("ext", "1"), 0)
+	testutil.Ok(t, err)
+
+	a, err := block.AnalyzeIndex(filepath.Join(dir, id.String(), block.IndexFilename), 2)
+	testutil.Ok(t, err)
+
+	testutil.Equals(t, &block.IndexAnalysis{
+		Series:     4,
+		LabelNames: 3,
+		LabelPairs: 6,
+		HighestCardinalityLabels: []block.Count{
+			{Name: "instance", Count: 3},
+			{Name: "__name__", Count: 2},
+		},
+		HighestCardinalityMetricNames: []block.Count{
+			{Name: "a", Count: 3},
+			{Name: "b", Count: 1},
+		},
+		MostCommonLabelPairs: []block.Count{
+			{Name: "job=x", Count: 4},
+			{Name: "__name__=a", Count: 3},
+		},
+		LabelNamesByValueLength: []block.Count{
+			{Name: "instance", Count: 3},
+			{Name: "__name__", Count: 2},
+		},
+	}, a)
+}
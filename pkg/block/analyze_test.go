@@ -0,0 +1,38 @@
+package block
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/tsdb/labels"
+)
+
+func TestTopCounts(t *testing.T) {
+	counts := mapCounts(map[string]uint64{"a": 1, "b": 3, "c": 3, "d": 2})
+
+	if got, exp := topCounts(counts, 3), []Count{{"b", 3}, {"c", 3}, {"d", 2}}; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if got := topCounts(counts, 0); len(got) != 4 {
+		t.Fatalf("expected all counts without limit, got %v", got)
+	}
+}
+
+func TestSeriesSet_HashCollision(t *testing.T) {
+	a := labels.FromStrings("__name__", "a")
+	b := labels.FromStrings("__name__", "b")
+
+	// Simulate a hash collision of a and b.
+	s := seriesSet{a.Hash(): {b}}
+	if s.contains(a) {
+		t.Fatalf("expected %s not to be contained", a)
+	}
+	s.add(a)
+	s.add(a)
+	if !s.contains(a) {
+		t.Fatalf("expected %s to be contained", a)
+	}
+	if got := s.len(); got != 2 {
+		t.Fatalf("expected 2 series, got %d", got)
+	}
+}
@@ -0,0 +1,110 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+)
+
+// BackupProvenanceFilename is the name of the file in the backup bucket recording why and
+// when the block was backed up.
+const BackupProvenanceFilename = "backup-provenance.json"
+
+// BackupProvenance records the origin of a block in the backup bucket.
+type BackupProvenance struct {
+	// ID of the tsdb block.
+	ID ulid.ULID `json:"id"`
+	// BackupTime is a unix timestamp of when the block was backed up.
+	BackupTime int64 `json:"backup_time"`
+	// Reason is a human readable reason of the backup, e.g. the operation deleting the block.
+	Reason string `json:"reason"`
+	// Hostname of the machine the backup was made from.
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// Backup copies all objects of the block into the backup bucket and records the provenance next to them.
+// The meta file is copied after the data files, so an interrupted backup leaves a partial block behind.
+// It returns error if the block already exists in the backup bucket as blocks should be immutable.
+func Backup(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, backupBkt objstore.Bucket, id ulid.ULID, reason string) error {
+	metaFile := path.Join(id.String(), MetaFilename)
+
+	ok, err := backupBkt.Exists(ctx, metaFile)
+	if err != nil {
+		return errors.Wrapf(err, "check meta file for %s in backup bucket", id)
+	}
+	if ok {
+		return errors.Errorf("%s dir seems to exists in backup bucket. Remove this block manually if you are sure it is safe to do", id)
+	}
+
+	var (
+		objects []string
+		hasMeta bool
+		list    func(dir string) error
+	)
+	list = func(dir string) error {
+		return bkt.Iter(ctx, dir, func(name string) error {
+			switch {
+			case strings.HasSuffix(name, objstore.DirDelim):
+				return list(name)
+			case name == metaFile:
+				hasMeta = true
+			default:
+				objects = append(objects, name)
+			}
+			return nil
+		})
+	}
+	if err := list(id.String() + objstore.DirDelim); err != nil {
+		return errors.Wrap(err, "list block objects")
+	}
+	if hasMeta {
+		objects = append(objects, metaFile)
+	}
+
+	for _, o := range objects {
+		if err := copyObject(ctx, bkt, backupBkt, o); err != nil {
+			return err
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	b, err := json.Marshal(BackupProvenance{
+		ID:         id,
+		BackupTime: time.Now().Unix(),
+		Reason:     reason,
+		Hostname:   hostname,
+	})
+	if err != nil {
+		return errors.Wrap(err, "json encode backup provenance")
+	}
+	provenanceFile := path.Join(id.String(), BackupProvenanceFilename)
+	if err := backupBkt.Upload(ctx, provenanceFile, bytes.NewReader(b)); err != nil {
+		return errors.Wrapf(err, "upload file %s to backup bucket", provenanceFile)
+	}
+
+	level.Info(logger).Log("msg", "block has been backed up", "block", id, "objects", len(objects), "reason", reason)
+	return nil
+}
+
+func copyObject(ctx context.Context, from objstore.BucketReader, to objstore.Bucket, name string) error {
+	rc, err := from.Get(ctx, name)
+	if err != nil {
+		return errors.Wrapf(err, "get %s", name)
+	}
+	defer rc.Close()
+
+	if err := to.Upload(ctx, name, rc); err != nil {
+		return errors.Wrapf(err, "upload %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/oklog/ulid"
+)
+
+func TestBackup(t *testing.T) {
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+	backupBkt := inmem.NewBucket()
+	id := ulid.MustNew(1, nil)
+
+	objects := map[string][]byte{
+		path.Join(id.String(), ChunksDirname, "000001"): []byte("chunks"),
+		path.Join(id.String(), IndexFilename):           []byte("index"),
+		path.Join(id.String(), MetaFilename):            []byte("{}"),
+	}
+	for name, b := range objects {
+		if err := bkt.Upload(ctx, name, bytes.NewReader(b)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Backup(ctx, log.NewNopLogger(), bkt, backupBkt, id, "test"); err != nil {
+		t.Fatal(err)
+	}
+	for name, b := range objects {
+		if got := backupBkt.Objects()[name]; !bytes.Equal(got, b) {
+			t.Fatalf("unexpected content of %s in backup bucket: %q", name, got)
+		}
+	}
+	var p BackupProvenance
+	if err := json.Unmarshal(backupBkt.Objects()[path.Join(id.String(), BackupProvenanceFilename)], &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != id || p.Reason != "test" {
+		t.Fatalf("unexpected provenance %+v", p)
+	}
+	if len(bkt.Objects()) != len(objects) {
+		t.Fatal("source bucket was modified")
+	}
+
+	// Blocks are immutable, so backing up the same block again must fail.
+	if err := Backup(ctx, log.NewNopLogger(), bkt, backupBkt, id, "test"); err == nil {
+		t.Fatal("expected error when block already exists in backup bucket")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 
 	"fmt"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/tsdb"
 	"github.com/prometheus/tsdb/fileutil"
+	"golang.org/x/sync/errgroup"
 )
 
 // Meta describes the a block's meta. It wraps the known TSDB meta structure and
@@ -31,10 +33,66 @@ type Meta struct {
 
 // ThanosMeta holds block meta information specific to Thanos.
 type ThanosMeta struct {
+	// Version of the Thanos section. Meta files written before the section was versioned have version 0, which is
+	// read as ThanosVersion1.
+	Version int `json:"version,omitempty"`
+
 	Labels     map[string]string `json:"labels"`
 	Downsample struct {
 		Resolution int64 `json:"resolution"`
 	} `json:"downsample"`
+	// Files describes the index and chunk files of the block, so they can be verified after download.
+	// Blocks written by older versions have no file descriptions and are not verified.
+	Files []File `json:"files,omitempty"`
+	// Split is set for blocks holding only a shard of the series of their sources, because the index of the
+	// complete block would exceed the size TSDB is able to read.
+	Split *SplitShard `json:"split,omitempty"`
+	// HeadSnapshot is set for blocks uploaded from a snapshot of the head of a Prometheus server. They overlap with
+	// blocks of the same producer persisted later and are deleted once their data is uploaded otherwise.
+	HeadSnapshot bool `json:"head_snapshot,omitempty"`
+}
+
+// SplitShard describes the series a split block holds: all series with a label set hash modulo Count equal to Index.
+// Blocks of different shards have the same sources and may overlap in time.
+type SplitShard struct {
+	Index int `json:"index"`
+	Count int `json:"count"`
+}
+
+func (s *SplitShard) String() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+const (
+	// ThanosVersion1 is the Thanos meta section with external labels and downsampling resolution.
+	ThanosVersion1 = 1
+	// ThanosVersion2 additionally holds the inventory of the index and chunk segment files of the block, with
+	// their sizes and checksums.
+	ThanosVersion2 = 2
+)
+
+// SetFiles sets the inventory of block files and bumps the Thanos section to the version holding it.
+func (m *ThanosMeta) SetFiles(files []File) {
+	m.Files = files
+	m.Version = ThanosVersion2
+}
+
+// ChunkFiles returns the chunk segment files of the inventory, sorted by name. It returns false if the
+// meta has no inventory, i.e. is older than ThanosVersion2.
+func (m *ThanosMeta) ChunkFiles() ([]File, bool) {
+	if m.Version < ThanosVersion2 {
+		return nil, false
+	}
+	var res []File
+	for _, f := range m.Files {
+		if path.Dir(f.RelPath) == ChunksDirname {
+			res = append(res, f)
+		}
+	}
+	return res, true
 }
 
 const (
@@ -87,6 +145,9 @@ func ReadMetaFile(dir string) (*Meta, error) {
 	if m.Version != 1 {
 		return nil, errors.Errorf("unexpected meta file version %d", m.Version)
 	}
+	if m.Thanos.Version > ThanosVersion2 {
+		return nil, errors.Errorf("unexpected Thanos meta version %d", m.Thanos.Version)
+	}
 	return &m, nil
 }
 
@@ -111,74 +172,247 @@ func renameFile(from, to string) error {
 	return pdir.Close()
 }
 
-// Download downloads directory that is mean to be block directory.
+// DownloadOptions configures how block files are downloaded.
+type DownloadOptions struct {
+	// Concurrency is the number of chunk segment files downloaded in parallel. Values lower than 1 mean 1.
+	Concurrency int
+	// Backoff configures how the download of a single file is retried after it failed. The zero value disables retries.
+	Backoff Backoff
+}
+
+// Download downloads directory that is mean to be block directory. Failed files are retried with DefaultBackoff.
 func Download(ctx context.Context, bucket objstore.Bucket, id ulid.ULID, dst string) error {
-	if err := objstore.DownloadDir(ctx, bucket, id.String(), dst); err != nil {
-		return err
-	}
+	return DownloadWithOptions(ctx, bucket, id, dst, DownloadOptions{Backoff: DefaultBackoff})
+}
+
+// DownloadWithOptions downloads directory that is mean to be block directory. Chunk segment files, which make up
+// most of the block, are fetched by opts.Concurrency workers and each file is retried on its own.
+// Downloaded files are verified against the file descriptions of the meta file, a mismatch results in a *CorruptionError.
+// The destination directory is removed if the download fails.
+func DownloadWithOptions(ctx context.Context, bucket objstore.BucketReader, id ulid.ULID, dst string, opts DownloadOptions) (err error) {
+	defer func() {
+		// Best-effort cleanup if the download failed.
+		if err != nil {
+			os.RemoveAll(dst)
+		}
+	}()
 
 	chunksDir := filepath.Join(dst, ChunksDirname)
-	_, err := os.Stat(chunksDir)
-	if os.IsNotExist(err) {
-		// This can happen if block is empty. We cannot easily upload empty directory, so create one here.
-		return os.Mkdir(chunksDir, os.ModePerm)
+	// Empty blocks have no chunks. We cannot easily upload empty directory, so the directory is always created here.
+	if err := os.MkdirAll(chunksDir, os.ModePerm); err != nil {
+		return errors.Wrap(err, "create dir")
 	}
 
+	var chunks []string
+	err = bucket.Iter(ctx, id.String(), func(name string) error {
+		if !strings.HasSuffix(name, objstore.DirDelim) {
+			return downloadFile(ctx, bucket, name, filepath.Join(dst, path.Base(name)), opts)
+		}
+		if path.Base(name) != ChunksDirname {
+			return objstore.DownloadDir(ctx, bucket, name, filepath.Join(dst, path.Base(name)))
+		}
+		return bucket.Iter(ctx, name, func(name string) error {
+			chunks = append(chunks, name)
+			return nil
+		})
+	})
 	if err != nil {
-		return errors.Wrapf(err, "stat %s", chunksDir)
+		return err
 	}
 
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		g, gctx = errgroup.WithContext(ctx)
+		namec   = make(chan string)
+	)
+	for i := 0; i < concurrency; i++ {
+		g.Go(func() error {
+			for name := range namec {
+				if err := downloadFile(gctx, bucket, name, filepath.Join(chunksDir, path.Base(name)), opts); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		defer close(namec)
+		for _, name := range chunks {
+			select {
+			case namec <- name:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+		}
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	meta, err := ReadMetaFile(dst)
+	if err != nil {
+		return errors.Wrap(err, "read meta")
+	}
+	if err := VerifyFiles(dst, meta.Thanos.Files); err != nil {
+		return errors.Wrapf(err, "verify block %s", id)
+	}
 	return nil
 }
 
+// downloadFile downloads the src object to the dst file, retrying failed attempts as configured by opts.
+func downloadFile(ctx context.Context, bkt objstore.BucketReader, src, dst string, opts DownloadOptions) error {
+	err := opts.Backoff.retry(ctx, func() error {
+		return objstore.DownloadFile(ctx, bkt, src, dst)
+	})
+	return errors.Wrapf(err, "download %s", src)
+}
+
+// UploadOptions configures how block files are uploaded.
+type UploadOptions struct {
+	// Concurrency is the number of chunk segment files uploaded in parallel. Values lower than 1 mean 1.
+	Concurrency int
+	// Backoff configures how the upload of a single file is retried after it failed. The zero value disables retries.
+	Backoff Backoff
+}
+
 // Upload uploads block from given block dir that ends with block id.
 // It makes sure cleanup is done on error to avoid partial block uploads.
 // It also verifies basic features of Thanos block.
-// TODO(bplotka): Ensure bucket operations have reasonable backoff retries.
+// Failed files are retried with DefaultBackoff.
 func Upload(ctx context.Context, bkt objstore.Bucket, bdir string) error {
+	return UploadWithOptions(ctx, bkt, bdir, UploadOptions{Backoff: DefaultBackoff})
+}
+
+// UploadWithOptions uploads block from given block dir like Upload. Chunk segment files are uploaded by opts.Concurrency
+// workers. Each file is retried on its own as configured by opts, the partial block is only deleted once the retries
+// of a file are exhausted. The index and meta file are uploaded after all chunk segments.
+func UploadWithOptions(ctx context.Context, bkt objstore.Bucket, bdir string, opts UploadOptions) error {
+	id, err := prepareUploadDir(bdir)
+	if err != nil {
+		return err
+	}
+
+	if err := uploadFile(ctx, bkt, path.Join(bdir, MetaFilename), path.Join(DebugMetas, fmt.Sprintf("%s.json", id)), opts); err != nil {
+		return errors.Wrap(err, "upload meta file to debug dir")
+	}
+
+	if err := uploadChunks(ctx, bkt, bdir, id, opts); err != nil {
+		return cleanUp(bkt, id, errors.Wrap(err, "upload chunks"))
+	}
+
+	if err := uploadFile(ctx, bkt, path.Join(bdir, IndexFilename), path.Join(id.String(), IndexFilename), opts); err != nil {
+		return cleanUp(bkt, id, errors.Wrap(err, "upload index"))
+	}
+
+	// Meta.json always need to be uploaded as a last item. This will allow to assume block directories without meta file
+	// to be pending uploads.
+	if err := uploadFile(ctx, bkt, path.Join(bdir, MetaFilename), path.Join(id.String(), MetaFilename), opts); err != nil {
+		return cleanUp(bkt, id, errors.Wrap(err, "upload meta file"))
+	}
+
+	return nil
+}
+
+// uploadChunks uploads the chunk segment files of the block dir by opts.Concurrency workers.
+func uploadChunks(ctx context.Context, bkt objstore.Bucket, bdir string, id ulid.ULID, opts UploadOptions) error {
+	chunks, err := ioutil.ReadDir(path.Join(bdir, ChunksDirname))
+	if err != nil {
+		return errors.Wrap(err, "read chunks dir")
+	}
+	var files []string
+	for _, fi := range chunks {
+		if !fi.IsDir() {
+			files = append(files, path.Join(ChunksDirname, fi.Name()))
+		}
+	}
+	return uploadConcurrently(ctx, files, opts.Concurrency, func(ctx context.Context, f string) error {
+		return uploadFile(ctx, bkt, path.Join(bdir, f), path.Join(id.String(), f), opts)
+	})
+}
+
+// uploadConcurrently calls upload for all files by the given number of workers. Values lower than 1 mean 1.
+// The context passed to upload is canceled once any call failed.
+func uploadConcurrently(ctx context.Context, files []string, concurrency int, upload func(context.Context, string) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		g, gctx = errgroup.WithContext(ctx)
+		namec   = make(chan string)
+	)
+	for i := 0; i < concurrency; i++ {
+		g.Go(func() error {
+			for f := range namec {
+				if err := upload(gctx, f); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		defer close(namec)
+		for _, f := range files {
+			select {
+			case namec <- f:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+		}
+		return nil
+	})
+	return g.Wait()
+}
+
+// uploadFile uploads the src file as the dst object, retrying failed attempts as configured by opts.
+func uploadFile(ctx context.Context, bkt objstore.Bucket, src, dst string, opts UploadOptions) error {
+	return opts.Backoff.retry(ctx, func() error {
+		return objstore.UploadFile(ctx, bkt, src, dst)
+	})
+}
+
+// prepareUploadDir verifies that bdir is a block directory with a meta file holding external labels and returns the block ID.
+// Descriptions of the block files are added to the meta file if it has none yet.
+func prepareUploadDir(bdir string) (ulid.ULID, error) {
 	df, err := os.Stat(bdir)
 	if err != nil {
-		return errors.Wrap(err, "stat bdir")
+		return ulid.ULID{}, errors.Wrap(err, "stat bdir")
 	}
 	if !df.IsDir() {
-		return errors.Errorf("%s is not a directory", bdir)
+		return ulid.ULID{}, errors.Errorf("%s is not a directory", bdir)
 	}
 
 	// Verify dir.
 	id, err := ulid.Parse(df.Name())
 	if err != nil {
-		return errors.Wrap(err, "not a block dir")
+		return ulid.ULID{}, errors.Wrap(err, "not a block dir")
 	}
 
 	meta, err := ReadMetaFile(bdir)
 	if err != nil {
 		// No meta or broken meta file.
-		return errors.Wrap(err, "read meta")
+		return ulid.ULID{}, errors.Wrap(err, "read meta")
 	}
 
 	if meta.Thanos.Labels == nil || len(meta.Thanos.Labels) == 0 {
-		return errors.Errorf("empty external labels are not allowed for Thanos block.")
-	}
-
-	if objstore.UploadFile(ctx, bkt, path.Join(bdir, MetaFilename), path.Join(DebugMetas, fmt.Sprintf("%s.json", id))); err != nil {
-		return errors.Wrap(err, "upload meta file to debug dir")
-	}
-
-	if err := objstore.UploadDir(ctx, bkt, path.Join(bdir, ChunksDirname), path.Join(id.String(), ChunksDirname)); err != nil {
-		return cleanUp(bkt, id, errors.Wrap(err, "upload chunks"))
-	}
-
-	if objstore.UploadFile(ctx, bkt, path.Join(bdir, IndexFilename), path.Join(id.String(), IndexFilename)); err != nil {
-		return cleanUp(bkt, id, errors.Wrap(err, "upload index"))
+		return ulid.ULID{}, errors.Errorf("empty external labels are not allowed for Thanos block.")
 	}
 
-	// Meta.json always need to be uploaded as a last item. This will allow to assume block directories without meta file
-	// to be pending uploads.
-	if objstore.UploadFile(ctx, bkt, path.Join(bdir, MetaFilename), path.Join(id.String(), MetaFilename)); err != nil {
-		return cleanUp(bkt, id, errors.Wrap(err, "upload meta file"))
+	if len(meta.Thanos.Files) == 0 {
+		files, err := GatherFiles(bdir)
+		if err != nil {
+			return ulid.ULID{}, errors.Wrap(err, "gather block files")
+		}
+		meta.Thanos.SetFiles(files)
+		if err := WriteMetaFile(bdir, meta); err != nil {
+			return ulid.ULID{}, errors.Wrap(err, "write meta")
+		}
 	}
-
-	return nil
+	return id, nil
 }
 
 func cleanUp(bkt objstore.Bucket, id ulid.ULID, err error) error {
@@ -196,16 +430,32 @@ func Delete(ctx context.Context, bucket objstore.Bucket, id ulid.ULID) error {
 	return objstore.DeleteDir(ctx, bucket, id.String())
 }
 
-// DownloadMeta downloads only meta file from bucket by block ID.
-func DownloadMeta(ctx context.Context, bkt objstore.Bucket, id ulid.ULID) (Meta, error) {
-	rc, err := bkt.Get(ctx, path.Join(id.String(), MetaFilename))
+// DownloadMeta downloads only meta file from bucket by block ID. Failed reads are retried with DefaultBackoff.
+func DownloadMeta(ctx context.Context, bkt objstore.BucketReader, id ulid.ULID) (Meta, error) {
+	return DownloadMetaWithOptions(ctx, bkt, id, DownloadOptions{Backoff: DefaultBackoff})
+}
+
+// DownloadMetaWithOptions downloads only meta file from bucket by block ID, retrying failed reads as configured by opts.
+func DownloadMetaWithOptions(ctx context.Context, bkt objstore.BucketReader, id ulid.ULID, opts DownloadOptions) (Meta, error) {
+	var b []byte
+	err := opts.Backoff.retry(ctx, func() error {
+		rc, err := bkt.Get(ctx, path.Join(id.String(), MetaFilename))
+		if err != nil {
+			return errors.Wrapf(err, "meta.json bkt get for %s", id.String())
+		}
+		defer rc.Close()
+
+		if b, err = ioutil.ReadAll(rc); err != nil {
+			return errors.Wrapf(err, "read meta.json for %s", id.String())
+		}
+		return nil
+	})
 	if err != nil {
-		return Meta{}, errors.Wrapf(err, "meta.json bkt get for %s", id.String())
+		return Meta{}, err
 	}
-	defer rc.Close()
 
 	var m Meta
-	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+	if err := json.Unmarshal(b, &m); err != nil {
 		return Meta{}, errors.Wrapf(err, "decode meta.json for block %s", id.String())
 	}
 	return m, nil
@@ -217,7 +467,7 @@ func IsBlockDir(path string) (id ulid.ULID, ok bool) {
 }
 
 // Finalize sets Thanos meta to the block meta JSON and saves it to the disk. It also removes tombstones which are not
-// useful for Thanos.
+// useful for Thanos. Samples deleted by them are visible again unless ApplyTombstones was called before.
 // NOTE: It should be used after writing any block by any Thanos component, otherwise we will miss crucial metadata.
 func Finalize(bdir string, extLset map[string]string, resolution int64, downsampledMeta *tsdb.BlockMeta) (*Meta, error) {
 	newMeta, err := ReadMetaFile(bdir)
@@ -232,12 +482,19 @@ func Finalize(bdir string, extLset map[string]string, resolution int64, downsamp
 		newMeta.Compaction = downsampledMeta.Compaction
 	}
 
-	if err := WriteMetaFile(bdir, newMeta); err != nil {
-		return nil, errors.Wrap(err, "write new meta")
+	// Tombstones are already removed if the block was finalized before.
+	if err = os.Remove(filepath.Join(bdir, "tombstones")); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "remove tombstones")
 	}
 
-	if err = os.Remove(filepath.Join(bdir, "tombstones")); err != nil {
-		return nil, errors.Wrap(err, "remove tombstones")
+	files, err := GatherFiles(bdir)
+	if err != nil {
+		return nil, errors.Wrap(err, "gather block files")
+	}
+	newMeta.Thanos.SetFiles(files)
+
+	if err := WriteMetaFile(bdir, newMeta); err != nil {
+		return nil, errors.Wrap(err, "write new meta")
 	}
 
 	return newMeta, nil
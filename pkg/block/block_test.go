@@ -1,9 +1,21 @@
 package block
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
 	"testing"
 
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
 	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
 )
 
 // NOTE(bplotka): For block packages we cannot use testutil, because they import block package. Consider moving simple
@@ -56,3 +68,130 @@ func TestIsBlockDir(t *testing.T) {
 		})
 	}
 }
+
+// flakyBucket fails the first Get of every object.
+type flakyBucket struct {
+	objstore.Bucket
+
+	mtx    sync.Mutex
+	failed map[string]bool
+}
+
+func (b *flakyBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if !b.failed[name] {
+		b.failed[name] = true
+		return nil, errors.Wrapf(io.ErrUnexpectedEOF, "flaky get %s", name)
+	}
+	return b.Bucket.Get(ctx, name)
+}
+
+func TestDownloadWithOptions(t *testing.T) {
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+	id := ulid.MustNew(1, nil)
+
+	objects := map[string][]byte{
+		IndexFilename: []byte("index"),
+		MetaFilename:  []byte(`{"version":1}`),
+	}
+	for i := 1; i <= 10; i++ {
+		objects[path.Join(ChunksDirname, fmt.Sprintf("%06d", i))] = []byte(fmt.Sprintf("chunks %d", i))
+	}
+	for name, b := range objects {
+		if err := bkt.Upload(ctx, path.Join(id.String(), name), bytes.NewReader(b)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "test-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Every file fails once, so the download only succeeds with retries.
+	dst := filepath.Join(dir, id.String())
+	if err := DownloadWithOptions(ctx, &flakyBucket{Bucket: bkt, failed: map[string]bool{}}, id, dst, DownloadOptions{Concurrency: 4}); err == nil {
+		t.Fatal("expected error without retries")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("expected failed download to be cleaned up, got %v", err)
+	}
+
+	if err := DownloadWithOptions(ctx, &flakyBucket{Bucket: bkt, failed: map[string]bool{}}, id, dst, DownloadOptions{Concurrency: 4, Backoff: Backoff{MaxRetries: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	for name, b := range objects {
+		got, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, b) {
+			t.Fatalf("unexpected content of %s: %q", name, got)
+		}
+	}
+
+	// Empty blocks have no chunks, the directory is created anyway.
+	empty := ulid.MustNew(2, nil)
+	if err := bkt.Upload(ctx, path.Join(empty.String(), MetaFilename), bytes.NewReader([]byte(`{"version":1}`))); err != nil {
+		t.Fatal(err)
+	}
+	if err := Download(ctx, bkt, empty, filepath.Join(dir, empty.String())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, empty.String(), ChunksDirname)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadMetaFile_ThanosVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-meta-versions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		content string
+		ok      bool
+		chunks  int
+	}{
+		// Meta files written before the Thanos section was versioned have no inventory.
+		{content: `{"version":1,"thanos":{"labels":{"a":"b"}}}`, ok: true, chunks: -1},
+		{content: `{"version":1,"thanos":{"version":1,"labels":{"a":"b"}}}`, ok: true, chunks: -1},
+		{
+			content: `{"version":1,"thanos":{"version":2,"labels":{"a":"b"},"files":[` +
+				`{"rel_path":"chunks/000001","size_bytes":10},{"rel_path":"index","size_bytes":20}]}}`,
+			ok:     true,
+			chunks: 1,
+		},
+		{content: `{"version":1,"thanos":{"version":3}}`, ok: false},
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, MetaFilename), []byte(tc.content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		m, err := ReadMetaFile(dir)
+		if !tc.ok {
+			if err == nil {
+				t.Fatalf("expected error for %s", tc.content)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, ok := m.Thanos.ChunkFiles()
+		if tc.chunks < 0 {
+			if ok {
+				t.Fatalf("unexpected inventory for %s", tc.content)
+			}
+			continue
+		}
+		if !ok || len(files) != tc.chunks || files[0].SizeBytes != 10 {
+			t.Fatalf("unexpected chunk files %v for %s", files, tc.content)
+		}
+	}
+}
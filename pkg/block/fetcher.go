@@ -0,0 +1,561 @@
+package block
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/relabel"
+)
+
+var (
+	// ErrMetaNotFound is returned by MetaFetcher for blocks without meta file, e.g. pending or aborted uploads.
+	ErrMetaNotFound = errors.New("meta.json not found")
+	// ErrMetaCorrupted is returned by MetaFetcher for blocks with a meta file that cannot be decoded.
+	ErrMetaCorrupted = errors.New("meta.json corrupted")
+)
+
+// States of blocks reported by the thanos_blocks_meta_synced metric, in addition to the reasons of the filters.
+const (
+	loadedMeta    = "loaded"
+	failedMeta    = "failed"
+	noMeta        = "no-meta-json"
+	corruptedMeta = "corrupted-meta-json"
+)
+
+// Reasons of the filters for removing blocks, reported by the thanos_blocks_meta_synced metric.
+const (
+	LabelExcludedMeta  = "label-excluded"
+	RelabelDroppedMeta = "relabel-dropped"
+	TimeExcludedMeta   = "time-excluded"
+	TooFreshMeta       = "too-fresh"
+	DuplicateMeta      = "duplicate"
+)
+
+// MetaFilter removes blocks from the fetched metas. It increments synced for the reason of each removed block.
+// Filters must not modify the metas themselves, as they are shared with the cache of the fetcher. They may replace them
+// with modified copies instead.
+type MetaFilter interface {
+	Filter(metas map[ulid.ULID]*Meta, synced map[string]int)
+}
+
+type fetcherMetrics struct {
+	syncs        prometheus.Counter
+	syncFailures prometheus.Counter
+	syncDuration prometheus.Histogram
+	synced       *prometheus.GaugeVec
+}
+
+func newFetcherMetrics(reg prometheus.Registerer) *fetcherMetrics {
+	var m fetcherMetrics
+
+	m.syncs = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "thanos_blocks_meta_syncs_total",
+		Help: "Total number of block meta syncs.",
+	})
+	m.syncFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "thanos_blocks_meta_sync_failures_total",
+		Help: "Total number of failed block meta syncs.",
+	})
+	m.syncDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "thanos_blocks_meta_sync_duration_seconds",
+		Help: "Time it took to sync the block metas.",
+		Buckets: []float64{
+			0.01, 1, 10, 100, 1000,
+		},
+	})
+	m.synced = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "thanos_blocks_meta_synced",
+		Help: "Number of block metas synced in the last sync, by state.",
+	}, []string{"state"})
+
+	if reg != nil {
+		reg.MustRegister(
+			m.syncs,
+			m.syncFailures,
+			m.syncDuration,
+			m.synced,
+		)
+	}
+	return &m
+}
+
+// MetaFetcher fetches the metas of all blocks in the bucket. Metas are immutable once uploaded, so they are
+// cached in memory and, if a cache directory is given, on local disk, to avoid downloading them again after restarts.
+type MetaFetcher struct {
+	logger      log.Logger
+	bkt         objstore.BucketReader
+	concurrency int
+	cacheDir    string
+	filters     []MetaFilter
+	metrics     *fetcherMetrics
+
+	mtx    sync.Mutex
+	cached map[ulid.ULID]*Meta
+	marks  map[ulid.ULID]map[string]struct{}
+}
+
+// NewMetaFetcher returns a new MetaFetcher downloading metas with the given concurrency. The given filters are
+// applied in order on every fetch. An empty cacheDir disables the disk cache.
+func NewMetaFetcher(
+	logger log.Logger,
+	reg prometheus.Registerer,
+	bkt objstore.BucketReader,
+	concurrency int,
+	cacheDir string,
+	filters ...MetaFilter,
+) (*MetaFetcher, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if cacheDir != "" {
+		if err := os.MkdirAll(cacheDir, 0777); err != nil {
+			return nil, errors.Wrap(err, "create meta cache dir")
+		}
+	}
+	return &MetaFetcher{
+		logger:      logger,
+		bkt:         bkt,
+		concurrency: concurrency,
+		cacheDir:    cacheDir,
+		filters:     filters,
+		metrics:     newFetcherMetrics(reg),
+		cached:      map[ulid.ULID]*Meta{},
+		marks:       map[ulid.ULID]map[string]struct{}{},
+	}, nil
+}
+
+// Fetch returns the metas of all blocks in the bucket that were not removed by the filters. Blocks with missing or
+// corrupted meta file are returned in partial, with ErrMetaNotFound or ErrMetaCorrupted as cause.
+// If any other error occurs, the returned metas are incomplete and must not be used to decide which blocks were
+// deleted. The returned metas must not be modified.
+func (f *MetaFetcher) Fetch(ctx context.Context) (metas map[ulid.ULID]*Meta, partial map[ulid.ULID]error, err error) {
+	begin := time.Now()
+	defer func() {
+		f.metrics.syncs.Inc()
+		f.metrics.syncDuration.Observe(time.Since(begin).Seconds())
+		if err != nil {
+			f.metrics.syncFailures.Inc()
+		}
+	}()
+
+	// A single recursive listing finds all blocks and whether they have a meta file and marks, instead of checking
+	// the existence of these files for every block.
+	blocks := map[ulid.ULID]bool{}
+	marks := map[ulid.ULID]map[string]struct{}{}
+	err = f.bkt.Iter(ctx, "", func(name string) error {
+		parts := strings.SplitN(name, objstore.DirDelim, 2)
+		id, ok := IsBlockDir(parts[0])
+		if !ok {
+			return nil
+		}
+		blocks[id] = blocks[id] || (len(parts) == 2 && parts[1] == MetaFilename)
+		if len(parts) == 2 && isMarkFilename(parts[1]) {
+			if marks[id] == nil {
+				marks[id] = map[string]struct{}{}
+			}
+			marks[id][parts[1]] = struct{}{}
+		}
+		return nil
+	}, objstore.WithRecursiveIter())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "iter bucket")
+	}
+	f.mtx.Lock()
+	f.marks = marks
+	f.mtx.Unlock()
+
+	var (
+		mtx  sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+		idc  = make(chan ulid.ULID)
+	)
+	metas = map[ulid.ULID]*Meta{}
+	partial = map[ulid.ULID]error{}
+
+	for i := 0; i < f.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for id := range idc {
+				m, err := f.loadMeta(ctx, id, blocks[id])
+
+				mtx.Lock()
+				switch {
+				case err == nil:
+					metas[id] = m
+				case errors.Cause(err) == ErrMetaNotFound || errors.Cause(err) == ErrMetaCorrupted:
+					partial[id] = err
+				default:
+					errs = append(errs, err)
+				}
+				mtx.Unlock()
+			}
+		}()
+	}
+
+	for id := range blocks {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case idc <- id:
+		}
+		if err != nil {
+			break
+		}
+	}
+	close(idc)
+	wg.Wait()
+
+	if err != nil {
+		return metas, partial, err
+	}
+
+	synced := map[string]int{
+		loadedMeta: 0, failedMeta: len(errs), noMeta: 0, corruptedMeta: 0,
+		LabelExcludedMeta: 0, RelabelDroppedMeta: 0, TimeExcludedMeta: 0, TooFreshMeta: 0, DuplicateMeta: 0,
+	}
+	for _, err := range partial {
+		if errors.Cause(err) == ErrMetaNotFound {
+			synced[noMeta]++
+		} else {
+			synced[corruptedMeta]++
+		}
+	}
+
+	if len(errs) > 0 {
+		f.updateSynced(synced)
+		return metas, partial, errors.Wrapf(errs[0], "fetch metas of %d blocks, first error", len(errs))
+	}
+
+	// The listing is complete, so metas of blocks not listed anymore are dropped from the caches.
+	f.mtx.Lock()
+	f.cached = make(map[ulid.ULID]*Meta, len(metas))
+	for id, m := range metas {
+		f.cached[id] = m
+	}
+	f.mtx.Unlock()
+	f.cleanCacheDir(metas)
+
+	for _, filter := range f.filters {
+		filter.Filter(metas, synced)
+	}
+	synced[loadedMeta] = len(metas)
+	f.updateSynced(synced)
+
+	return metas, partial, nil
+}
+
+// Marked returns true if the last listing of Fetch found the mark file with the given name in the block.
+func (f *MetaFetcher) Marked(id ulid.ULID, markFilename string) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	_, ok := f.marks[id][markFilename]
+	return ok
+}
+
+func isMarkFilename(name string) bool {
+	switch name {
+	case DeletionMarkFilename, NoCompactMarkFilename, NoDownsampleMarkFilename:
+		return true
+	}
+	return false
+}
+
+func (f *MetaFetcher) updateSynced(synced map[string]int) {
+	for state, n := range synced {
+		f.metrics.synced.WithLabelValues(state).Set(float64(n))
+	}
+}
+
+// loadMeta returns the meta of the block from the caches or downloads it. listed tells whether the meta file of the
+// block was found by the listing of the bucket.
+func (f *MetaFetcher) loadMeta(ctx context.Context, id ulid.ULID, listed bool) (*Meta, error) {
+	f.mtx.Lock()
+	m, ok := f.cached[id]
+	f.mtx.Unlock()
+	if ok {
+		return m, nil
+	}
+
+	cachedBlockDir := filepath.Join(f.cacheDir, id.String())
+	if f.cacheDir != "" {
+		m, err := ReadMetaFile(cachedBlockDir)
+		if err == nil {
+			return m, nil
+		}
+		if !os.IsNotExist(err) {
+			level.Warn(f.logger).Log("msg", "best effort read of cached meta failed, downloading it again", "block", id, "err", err)
+		}
+	}
+
+	metaFile := path.Join(id.String(), MetaFilename)
+	if !listed {
+		return nil, errors.Wrapf(ErrMetaNotFound, "block %s", id)
+	}
+
+	rc, err := f.bkt.Get(ctx, metaFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get %s", metaFile)
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", metaFile)
+	}
+	m = &Meta{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, errors.Wrapf(ErrMetaCorrupted, "decode %s: %v", metaFile, err)
+	}
+
+	if f.cacheDir != "" {
+		if err := os.MkdirAll(cachedBlockDir, 0777); err != nil {
+			level.Warn(f.logger).Log("msg", "best effort mkdir of the meta cache dir failed", "block", id, "err", err)
+		} else if err := WriteMetaFile(cachedBlockDir, m); err != nil {
+			level.Warn(f.logger).Log("msg", "best effort write of meta to the cache failed", "block", id, "err", err)
+		}
+	}
+	return m, nil
+}
+
+// cleanCacheDir removes cached metas of blocks which are not in the bucket anymore.
+func (f *MetaFetcher) cleanCacheDir(metas map[ulid.ULID]*Meta) {
+	if f.cacheDir == "" {
+		return
+	}
+	fis, err := ioutil.ReadDir(f.cacheDir)
+	if err != nil {
+		level.Warn(f.logger).Log("msg", "best effort read of the meta cache dir failed", "err", err)
+		return
+	}
+	for _, fi := range fis {
+		id, ok := IsBlockDir(fi.Name())
+		if !ok {
+			continue
+		}
+		if _, ok := metas[id]; ok {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(f.cacheDir, fi.Name())); err != nil {
+			level.Warn(f.logger).Log("msg", "best effort removal of cached meta failed", "block", id, "err", err)
+		}
+	}
+}
+
+// LabelFilter removes blocks whose external labels do not match all of the given matchers.
+type LabelFilter struct {
+	matchers []*labels.Matcher
+}
+
+// NewLabelFilter returns a filter keeping the blocks with external labels matching all matchers.
+func NewLabelFilter(matchers []*labels.Matcher) *LabelFilter {
+	return &LabelFilter{matchers: matchers}
+}
+
+// Filter implements MetaFilter.
+func (f *LabelFilter) Filter(metas map[ulid.ULID]*Meta, synced map[string]int) {
+	for id, m := range metas {
+		for _, matcher := range f.matchers {
+			if !matcher.Matches(m.Thanos.Labels[matcher.Name]) {
+				delete(metas, id)
+				synced[LabelExcludedMeta]++
+				break
+			}
+		}
+	}
+}
+
+// RelabelFilter removes blocks whose external labels are dropped by the given relabel configs. With the hashmod
+// action, it splits the blocks of a bucket into disjoint shards by their external labels, e.g. for multiple
+// compactors each owning a shard of the compaction groups.
+type RelabelFilter struct {
+	relabelConfigs []*config.RelabelConfig
+}
+
+// NewRelabelFilter returns a filter keeping the blocks whose external labels are kept by the relabel configs.
+func NewRelabelFilter(relabelConfigs []*config.RelabelConfig) *RelabelFilter {
+	return &RelabelFilter{relabelConfigs: relabelConfigs}
+}
+
+// Filter implements MetaFilter.
+func (f *RelabelFilter) Filter(metas map[ulid.ULID]*Meta, synced map[string]int) {
+	for id, m := range metas {
+		if relabel.Process(labels.FromMap(m.Thanos.Labels), f.relabelConfigs...) != nil {
+			continue
+		}
+		delete(metas, id)
+		synced[RelabelDroppedMeta]++
+	}
+}
+
+// TimeFilter removes blocks which do not overlap with the given time range.
+type TimeFilter struct {
+	minTime, maxTime int64
+}
+
+// NewTimeFilter returns a filter keeping the blocks overlapping with [minTime, maxTime), in milliseconds.
+func NewTimeFilter(minTime, maxTime int64) *TimeFilter {
+	return &TimeFilter{minTime: minTime, maxTime: maxTime}
+}
+
+// Filter implements MetaFilter.
+func (f *TimeFilter) Filter(metas map[ulid.ULID]*Meta, synced map[string]int) {
+	for id, m := range metas {
+		if m.MaxTime > f.minTime && m.MinTime < f.maxTime {
+			continue
+		}
+		delete(metas, id)
+		synced[TimeExcludedMeta]++
+	}
+}
+
+// ConsistencyDelayFilter removes blocks created less than the delay ago, based on the time of their ULID.
+// It protects against eventually consistent object storages still listing an incomplete block.
+type ConsistencyDelayFilter struct {
+	delay time.Duration
+}
+
+// NewConsistencyDelayFilter returns a filter removing blocks younger than delay.
+func NewConsistencyDelayFilter(delay time.Duration) *ConsistencyDelayFilter {
+	return &ConsistencyDelayFilter{delay: delay}
+}
+
+// Filter implements MetaFilter.
+func (f *ConsistencyDelayFilter) Filter(metas map[ulid.ULID]*Meta, synced map[string]int) {
+	for id := range metas {
+		if ulid.Now()-id.Time() >= uint64(f.delay/time.Millisecond) {
+			continue
+		}
+		delete(metas, id)
+		synced[TooFreshMeta]++
+	}
+}
+
+// DeduplicateFilter removes blocks whose data is entirely part of another block of the same resolution, i.e.
+// their compaction sources are a subset of the sources of another block. This happens after compaction until
+// the compacted blocks are deleted.
+type DeduplicateFilter struct{}
+
+// NewDeduplicateFilter returns a filter removing blocks already covered by other blocks.
+func NewDeduplicateFilter() *DeduplicateFilter {
+	return &DeduplicateFilter{}
+}
+
+// Filter implements MetaFilter.
+func (f *DeduplicateFilter) Filter(metas map[ulid.ULID]*Meta, synced map[string]int) {
+	// Split blocks only hold a shard of the series of their sources, so they are deduplicated per shard.
+	type groupKey struct {
+		resolution int64
+		split      string
+	}
+	groups := map[groupKey][]*Meta{}
+	for _, m := range metas {
+		key := groupKey{resolution: m.Thanos.Downsample.Resolution, split: m.Thanos.Split.String()}
+		groups[key] = append(groups[key], m)
+	}
+
+	for _, ms := range groups {
+		// Candidates that could cover a block come first: more sources, then higher compaction
+		// level and finally the more recent ULID, like in garbage collection of the compactor.
+		sort.Slice(ms, func(i, j int) bool {
+			if len(ms[i].Compaction.Sources) != len(ms[j].Compaction.Sources) {
+				return len(ms[i].Compaction.Sources) > len(ms[j].Compaction.Sources)
+			}
+			if ms[i].Compaction.Level != ms[j].Compaction.Level {
+				return ms[i].Compaction.Level > ms[j].Compaction.Level
+			}
+			return ms[i].ULID.Compare(ms[j].ULID) > 0
+		})
+
+		var kept []map[ulid.ULID]struct{}
+		for _, m := range ms {
+			if coveredByAny(m.Compaction.Sources, kept) {
+				delete(metas, m.ULID)
+				synced[DuplicateMeta]++
+				continue
+			}
+			sources := make(map[ulid.ULID]struct{}, len(m.Compaction.Sources))
+			for _, s := range m.Compaction.Sources {
+				sources[s] = struct{}{}
+			}
+			kept = append(kept, sources)
+		}
+	}
+}
+
+// ReplicaLabelRemover removes the given replica labels from the external labels of all blocks, so blocks of
+// replicas of a Prometheus HA pair are treated as blocks of the same source.
+type ReplicaLabelRemover struct {
+	replicaLabels []string
+}
+
+// NewReplicaLabelRemover returns a filter removing the given replica labels from the external labels of blocks.
+func NewReplicaLabelRemover(replicaLabels []string) *ReplicaLabelRemover {
+	return &ReplicaLabelRemover{replicaLabels: replicaLabels}
+}
+
+// Filter implements MetaFilter.
+func (f *ReplicaLabelRemover) Filter(metas map[ulid.ULID]*Meta, _ map[string]int) {
+	for id, m := range metas {
+		var lset map[string]string
+		for _, l := range f.replicaLabels {
+			if _, ok := m.Thanos.Labels[l]; !ok {
+				continue
+			}
+			if lset == nil {
+				lset = make(map[string]string, len(m.Thanos.Labels))
+				for k, v := range m.Thanos.Labels {
+					lset[k] = v
+				}
+			}
+			delete(lset, l)
+		}
+		if lset == nil {
+			continue
+		}
+		cp := *m
+		cp.Thanos.Labels = lset
+		metas[id] = &cp
+	}
+}
+
+func coveredByAny(sources []ulid.ULID, sets []map[ulid.ULID]struct{}) bool {
+	if len(sources) == 0 {
+		return false
+	}
+	for _, set := range sets {
+		covered := true
+		for _, s := range sources {
+			if _, ok := set[s]; !ok {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
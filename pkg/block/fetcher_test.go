@@ -0,0 +1,272 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/tsdb"
+)
+
+// countingBucket counts the Get calls of all objects.
+type countingBucket struct {
+	objstore.Bucket
+
+	mtx  sync.Mutex
+	gets int
+}
+
+func (b *countingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	b.mtx.Lock()
+	b.gets++
+	b.mtx.Unlock()
+	return b.Bucket.Get(ctx, name)
+}
+
+func uploadMeta(t *testing.T, bkt objstore.Bucket, m *Meta) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bkt.Upload(context.Background(), path.Join(m.ULID.String(), MetaFilename), bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sortedIDs(metas map[ulid.ULID]*Meta) []ulid.ULID {
+	var ids []ulid.ULID
+	for id := range metas {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Compare(ids[j]) < 0 })
+	return ids
+}
+
+func TestMetaFetcher_Fetch(t *testing.T) {
+	ctx := context.Background()
+	bkt := &countingBucket{Bucket: inmem.NewBucket()}
+
+	dir, err := ioutil.TempDir("", "test-meta-fetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var ids []ulid.ULID
+	for i := 0; i < 3; i++ {
+		m := &Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(uint64(i), nil)}}
+		uploadMeta(t, bkt, m)
+		ids = append(ids, m.ULID)
+	}
+	// Pending upload without meta file.
+	pending := ulid.MustNew(10, nil)
+	if err := bkt.Upload(ctx, path.Join(pending.String(), IndexFilename), bytes.NewReader([]byte("index"))); err != nil {
+		t.Fatal(err)
+	}
+	corrupted := ulid.MustNew(11, nil)
+	if err := bkt.Upload(ctx, path.Join(corrupted.String(), MetaFilename), bytes.NewReader([]byte("{"))); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewMetaFetcher(nil, nil, bkt, 4, filepath.Join(dir, "meta-cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metas, partial, err := f.Fetch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sortedIDs(metas); len(got) != 3 || got[0] != ids[0] || got[2] != ids[2] {
+		t.Fatalf("unexpected metas %v", got)
+	}
+	if len(partial) != 2 || partial[pending] == nil || partial[corrupted] == nil {
+		t.Fatalf("unexpected partial blocks %v", partial)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "meta-cache", ids[0].String(), MetaFilename)); err != nil {
+		t.Fatalf("meta not cached on disk: %v", err)
+	}
+
+	// Metas are only downloaded once, also after restarts.
+	f, err = NewMetaFetcher(nil, nil, bkt, 4, filepath.Join(dir, "meta-cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gets := bkt.gets
+	if _, _, err := f.Fetch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Only the corrupted meta is fetched again.
+	if bkt.gets != gets+1 {
+		t.Fatalf("expected 1 get, got %d", bkt.gets-gets)
+	}
+
+	// Deleted blocks are dropped from the disk cache.
+	if err := Delete(ctx, bkt, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	metas, _, err = f.Fetch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metas) != 2 {
+		t.Fatalf("unexpected metas %v", sortedIDs(metas))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "meta-cache", ids[0].String())); !os.IsNotExist(err) {
+		t.Fatalf("expected cached meta to be removed, got %v", err)
+	}
+}
+
+func TestMetaFetcher_Marked(t *testing.T) {
+	ctx := context.Background()
+	bkt := &countingBucket{Bucket: inmem.NewBucket()}
+
+	m := &Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil)}}
+	uploadMeta(t, bkt, m)
+	if err := MarkForNoDownsample(ctx, log.NewNopLogger(), bkt, m.ULID, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewMetaFetcher(nil, nil, bkt, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.Fetch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Marked(m.ULID, NoDownsampleMarkFilename) {
+		t.Fatal("expected block to be marked for no downsampling")
+	}
+	if f.Marked(m.ULID, DeletionMarkFilename) || f.Marked(ulid.MustNew(2, nil), NoDownsampleMarkFilename) {
+		t.Fatal("unexpected mark")
+	}
+	// Marks are found by the listing, only the meta file is downloaded.
+	if bkt.gets != 1 {
+		t.Fatalf("expected 1 get, got %d", bkt.gets)
+	}
+
+	// Removed marks are dropped by the next fetch.
+	if err := RemoveMark(ctx, log.NewNopLogger(), bkt, m.ULID, NoDownsampleMarkFilename); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.Fetch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if f.Marked(m.ULID, NoDownsampleMarkFilename) {
+		t.Fatal("expected mark to be removed")
+	}
+}
+
+func TestMetaFilters(t *testing.T) {
+	newMeta := func(id uint64, mint, maxt int64, lset map[string]string, level int, sources ...uint64) *Meta {
+		m := &Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(id, nil), MinTime: mint, MaxTime: maxt}}
+		m.Thanos.Labels = lset
+		m.Compaction.Level = level
+		for _, s := range sources {
+			m.Compaction.Sources = append(m.Compaction.Sources, ulid.MustNew(s, nil))
+		}
+		return m
+	}
+	metas := map[ulid.ULID]*Meta{}
+	for _, m := range []*Meta{
+		newMeta(1, 0, 100, map[string]string{"cluster": "a"}, 1, 1),
+		newMeta(2, 100, 200, map[string]string{"cluster": "a"}, 1, 2),
+		newMeta(3, 0, 200, map[string]string{"cluster": "a"}, 2, 1, 2),
+		newMeta(4, 200, 300, map[string]string{"cluster": "a"}, 1, 4),
+		newMeta(5, 0, 100, map[string]string{"cluster": "b"}, 1, 5),
+	} {
+		metas[m.ULID] = m
+	}
+	synced := map[string]int{}
+
+	NewDeduplicateFilter().Filter(metas, synced)
+	if got := sortedIDs(metas); len(got) != 3 || got[0] != ulid.MustNew(3, nil) {
+		t.Fatalf("unexpected metas after deduplication %v", got)
+	}
+
+	NewTimeFilter(200, 1000).Filter(metas, synced)
+	if got := sortedIDs(metas); len(got) != 1 || got[0] != ulid.MustNew(4, nil) {
+		t.Fatalf("unexpected metas after time filter %v", got)
+	}
+
+	matcher, err := labels.NewMatcher(labels.MatchEqual, "cluster", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	NewLabelFilter([]*labels.Matcher{matcher}).Filter(metas, synced)
+	if len(metas) != 0 {
+		t.Fatalf("unexpected metas after label filter %v", sortedIDs(metas))
+	}
+	if synced[DuplicateMeta] != 2 || synced[TimeExcludedMeta] != 2 || synced[LabelExcludedMeta] != 1 {
+		t.Fatalf("unexpected synced counts %v", synced)
+	}
+
+	fresh := ulid.MustNew(ulid.Now(), nil)
+	metas = map[ulid.ULID]*Meta{fresh: {BlockMeta: tsdb.BlockMeta{ULID: fresh}}}
+	NewConsistencyDelayFilter(time.Hour).Filter(metas, synced)
+	if len(metas) != 0 || synced[TooFreshMeta] != 1 {
+		t.Fatalf("fresh block not filtered: %v", synced)
+	}
+
+	// Shards of hashmod relabel configs are disjoint and cover all blocks.
+	shardFilter := func(shard string) *RelabelFilter {
+		return NewRelabelFilter([]*config.RelabelConfig{
+			{SourceLabels: model.LabelNames{"cluster"}, Modulus: 2, TargetLabel: "shard", Action: config.RelabelHashMod},
+			{SourceLabels: model.LabelNames{"shard"}, Regex: config.MustNewRegexp(shard), Action: config.RelabelKeep},
+		})
+	}
+	all := map[ulid.ULID]*Meta{}
+	for i, c := range "abcdefghij" {
+		m := newMeta(uint64(i+1), 0, 100, map[string]string{"cluster": string(c)}, 1)
+		all[m.ULID] = m
+	}
+	seen := map[ulid.ULID]int{}
+	for _, shard := range []string{"0", "1"} {
+		metas = map[ulid.ULID]*Meta{}
+		for id, m := range all {
+			metas[id] = m
+		}
+		shardFilter(shard).Filter(metas, synced)
+		if len(metas) == 0 || len(metas) == len(all) {
+			t.Fatalf("unexpected blocks %v of shard %s", sortedIDs(metas), shard)
+		}
+		for id := range metas {
+			seen[id]++
+		}
+	}
+	for id := range all {
+		if seen[id] != 1 {
+			t.Fatalf("block %s kept by %d shards", id, seen[id])
+		}
+	}
+	if synced[RelabelDroppedMeta] != len(all) {
+		t.Fatalf("unexpected synced counts %v", synced)
+	}
+
+	// Replica labels are removed from copies of the metas, which are shared with the cache of the fetcher.
+	orig := newMeta(6, 0, 100, map[string]string{"cluster": "a", "replica": "1"}, 1, 6)
+	metas = map[ulid.ULID]*Meta{orig.ULID: orig}
+	NewReplicaLabelRemover([]string{"replica", "rule_replica"}).Filter(metas, synced)
+	if exp := map[string]string{"cluster": "a"}; !reflect.DeepEqual(exp, metas[orig.ULID].Thanos.Labels) {
+		t.Fatalf("expected labels %v, got %v", exp, metas[orig.ULID].Thanos.Labels)
+	}
+	if len(orig.Thanos.Labels) != 2 {
+		t.Fatalf("original meta was modified: %v", orig.Thanos.Labels)
+	}
+}
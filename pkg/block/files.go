@@ -0,0 +1,107 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// File describes a file of the block directory in the meta file, so its content can be verified after it was copied.
+type File struct {
+	// RelPath is the path of the file relative to the block directory, with slash separators.
+	RelPath string `json:"rel_path"`
+	// SizeBytes is the size of the file.
+	SizeBytes int64 `json:"size_bytes"`
+	// SHA256 is the hex encoded SHA256 checksum of the file content.
+	SHA256 string `json:"sha256"`
+}
+
+// CorruptionError is returned if a file of a block does not match its description in the meta file.
+type CorruptionError struct {
+	File   string
+	Reason string
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("corrupted block file %s: %s", e.File, e.Reason)
+}
+
+// IsCorruptionError returns true if the base error is a *CorruptionError.
+func IsCorruptionError(err error) bool {
+	_, ok := errors.Cause(err).(*CorruptionError)
+	return ok
+}
+
+// GatherFiles returns the descriptions of the index and the chunk segment files of the block in bdir, sorted by path.
+func GatherFiles(bdir string) ([]File, error) {
+	names := []string{IndexFilename}
+
+	chunks, err := ioutil.ReadDir(filepath.Join(bdir, ChunksDirname))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "read chunks dir")
+	}
+	for _, fi := range chunks {
+		if !fi.IsDir() {
+			names = append(names, path.Join(ChunksDirname, fi.Name()))
+		}
+	}
+	sort.Strings(names)
+
+	files := make([]File, 0, len(names))
+	for _, n := range names {
+		f, err := describeFile(bdir, n)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func describeFile(bdir, relPath string) (File, error) {
+	f, err := os.Open(filepath.Join(bdir, filepath.FromSlash(relPath)))
+	if err != nil {
+		return File{}, errors.Wrapf(err, "open %s", relPath)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return File{}, errors.Wrapf(err, "read %s", relPath)
+	}
+	return File{
+		RelPath:   relPath,
+		SizeBytes: n,
+		SHA256:    hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// VerifyFiles verifies that the files in bdir match the given descriptions. It returns a *CorruptionError for
+// the first file that is missing or differs in size or checksum.
+func VerifyFiles(bdir string, files []File) error {
+	for _, exp := range files {
+		got, err := describeFile(bdir, exp.RelPath)
+		if os.IsNotExist(errors.Cause(err)) {
+			return &CorruptionError{File: exp.RelPath, Reason: "file is missing"}
+		}
+		if err != nil {
+			return err
+		}
+		if got.SizeBytes != exp.SizeBytes {
+			return &CorruptionError{File: exp.RelPath, Reason: fmt.Sprintf("size is %d bytes, expected %d", got.SizeBytes, exp.SizeBytes)}
+		}
+		if got.SHA256 != exp.SHA256 {
+			return &CorruptionError{File: exp.RelPath, Reason: fmt.Sprintf("SHA256 checksum is %s, expected %s", got.SHA256, exp.SHA256)}
+		}
+	}
+	return nil
+}
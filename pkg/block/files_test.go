@@ -0,0 +1,119 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/tsdb"
+)
+
+func TestVerifyFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-verify-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, ChunksDirname), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"chunks/000002", "chunks/000001", IndexFilename} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(f), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := GatherFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 || files[0].RelPath != "chunks/000001" || files[1].RelPath != "chunks/000002" || files[2].RelPath != IndexFilename {
+		t.Fatalf("unexpected files %v", files)
+	}
+	// SHA256 of "index".
+	if files[2].SizeBytes != 5 || files[2].SHA256 != "1bc04b5291c26a46d918139138b992d2de976d6851d0893b0476b85bfbdfc6e6" {
+		t.Fatalf("unexpected index description %v", files[2])
+	}
+	if err := VerifyFiles(dir, files); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same size, different content.
+	if err := ioutil.WriteFile(filepath.Join(dir, "chunks/000002"), []byte("chunks/000003"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFiles(dir, files); !IsCorruptionError(err) {
+		t.Fatalf("expected corruption error, got %v", err)
+	}
+
+	// Truncated file.
+	if err := ioutil.WriteFile(filepath.Join(dir, "chunks/000002"), []byte("chunks"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFiles(dir, files); !IsCorruptionError(err) {
+		t.Fatalf("expected corruption error, got %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "chunks/000002")); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFiles(dir, files); !IsCorruptionError(err) {
+		t.Fatalf("expected corruption error, got %v", err)
+	}
+}
+
+func TestDownload_Corrupted(t *testing.T) {
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+	id := ulid.MustNew(1, nil)
+
+	dir, err := ioutil.TempDir("", "test-download-corrupted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bdir := filepath.Join(dir, "src", id.String())
+	if err := os.MkdirAll(filepath.Join(bdir, ChunksDirname), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"chunks/000001", IndexFilename} {
+		if err := ioutil.WriteFile(filepath.Join(bdir, f), []byte(f), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	meta := &Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: id}}
+	meta.Thanos.Labels = map[string]string{"ext": "1"}
+	if err := WriteMetaFile(bdir, meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := Upload(ctx, bkt, bdir); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "dst", id.String())
+	if err := Download(ctx, bkt, id, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate bit-rot of a chunk segment in the bucket.
+	if err := bkt.Upload(ctx, path.Join(id.String(), "chunks/000001"), bytes.NewReader([]byte("chunks/000002"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := Download(ctx, bkt, id, dst); !IsCorruptionError(err) {
+		t.Fatalf("expected corruption error, got %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("expected corrupted download to be cleaned up, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package block
 import (
 	"encoding/json"
 	"hash/crc32"
+	"math"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -13,6 +14,7 @@ import (
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/tsdb"
+	"github.com/prometheus/tsdb/chunkenc"
 	"github.com/prometheus/tsdb/chunks"
 	"github.com/prometheus/tsdb/index"
 	"github.com/prometheus/tsdb/labels"
@@ -152,7 +154,7 @@ func ReadIndexCache(fn string) (
 
 // VerifyIndex does a full run over a block index and verifies that it fulfills the order invariants.
 func VerifyIndex(fn string, minTime int64, maxTime int64) error {
-	stats, err := GatherIndexIssueStats(fn, minTime, maxTime)
+	stats, err := GatherIndexHealthStats(fn, minTime, maxTime)
 	if err != nil {
 		return err
 	}
@@ -165,37 +167,86 @@ func VerifyIndex(fn string, minTime int64, maxTime int64) error {
 	return nil
 }
 
-type IndexIssueStats struct {
-	Total int
-
-	OutOfOrderCount int
-	OutOfOrderSum   int
-	ExactSum        int
-
-	// Chunks that are before or after time range in meta.
-	Outsiders int
-	// Outsiders that will be never accessed. They are completely out of time range specified in block meta.
-	CompleteOutsiders int
+// HealthStats holds the issues and cardinality of a block index.
+type HealthStats struct {
+	// TotalSeries is the number of series in the index.
+	TotalSeries int `json:"total_series"`
+	// TotalChunks is the number of chunks referenced by the index.
+	TotalChunks int `json:"total_chunks"`
+
+	// OutOfOrderSeries is the number of series with out of order chunks.
+	OutOfOrderSeries int `json:"out_of_order_series"`
+	// OutOfOrderChunks is the number of chunks with the same time range as the chunk preceding them in their series.
+	OutOfOrderChunks int `json:"out_of_order_chunks"`
+	// DuplicatedChunks is the subset of OutOfOrderChunks that are exact duplicates (in terms of data and time range)
+	// of the chunk preceding them.
+	DuplicatedChunks int `json:"duplicated_chunks"`
+	// OverlappingSeries is the number of series with partially overlapping chunks.
+	OverlappingSeries int `json:"overlapping_series"`
+	// OverlappingChunks is the number of chunks overlapping with the chunk preceding them in their series without
+	// having the same time range. They are only reported and do not fail verification.
+	OverlappingChunks int `json:"overlapping_chunks"`
+
+	// DuplicatedSeries is the number of series that have exactly the same label set as the series preceding them in the index.
+	DuplicatedSeries int `json:"duplicated_series"`
+	// UnsortedLabelSets is the number of series with label sets that are not sorted by label name.
+	UnsortedLabelSets int `json:"unsorted_label_sets"`
+
+	// OutsideChunks is the number of chunks that are before or after the time range in meta.
+	OutsideChunks int `json:"outside_chunks"`
+	// CompleteOutsideChunks is the subset of OutsideChunks that will be never accessed. They are completely out of
+	// the time range specified in block meta.
+	CompleteOutsideChunks int `json:"complete_outside_chunks"`
+
+	// MaxSeriesChunks is the highest number of chunks of a single series.
+	MaxSeriesChunks int `json:"max_series_chunks"`
+	// LabelNames is the number of distinct label names.
+	LabelNames int `json:"label_names"`
+	// MetricNames is the number of distinct metric names.
+	MetricNames int `json:"metric_names"`
+	// MaxLabelValues is the highest number of values of a single label name, which is MaxLabelValuesName.
+	MaxLabelValues     int    `json:"max_label_values"`
+	MaxLabelValuesName string `json:"max_label_values_name"`
 }
 
-func (i IndexIssueStats) ErrSummary() error {
-	if i.OutOfOrderCount > 0 {
+// OutOfOrderChunksErr returns an error if the index has out of order chunks. TSDB refuses to compact such blocks.
+func (i HealthStats) OutOfOrderChunksErr() error {
+	if i.OutOfOrderChunks > 0 {
 		return errors.Errorf("%d/%d series have an average of %.3f out-of-order chunks. "+
-			"%.3f of these are exact duplicates (in terms of data and time range). Outsiders: %d, complete outsiders: %d",
-			i.OutOfOrderCount, i.Total, float64(i.OutOfOrderSum)/float64(i.OutOfOrderCount),
-			float64(i.ExactSum)/float64(i.OutOfOrderSum), i.Outsiders, i.CompleteOutsiders)
+			"%.3f of these are exact duplicates (in terms of data and time range)",
+			i.OutOfOrderSeries, i.TotalSeries, float64(i.OutOfOrderChunks)/float64(i.OutOfOrderSeries),
+			float64(i.DuplicatedChunks)/float64(i.OutOfOrderChunks))
+	}
+	return nil
+}
+
+// ErrSummary returns an error describing the first issue found in the index, if any.
+func (i HealthStats) ErrSummary() error {
+	if err := i.OutOfOrderChunksErr(); err != nil {
+		return errors.Errorf("%s. Outsiders: %d, complete outsiders: %d", err, i.OutsideChunks, i.CompleteOutsideChunks)
+	}
+
+	if i.DuplicatedSeries > 0 {
+		return errors.Errorf("%d/%d series are duplicated. Outsiders: %d, complete outsiders: %d",
+			i.DuplicatedSeries, i.TotalSeries, i.OutsideChunks, i.CompleteOutsideChunks)
+	}
+
+	if i.UnsortedLabelSets > 0 {
+		return errors.Errorf("%d/%d series have unsorted label sets. Outsiders: %d, complete outsiders: %d",
+			i.UnsortedLabelSets, i.TotalSeries, i.OutsideChunks, i.CompleteOutsideChunks)
 	}
 
-	if i.Outsiders > 0 {
+	if i.OutsideChunks > 0 {
 		return errors.Errorf("No chunks are out of order, but found some outsider blocks. (Blocks that outside of block time range): %d. Complete: %d",
-			i.Outsiders, i.CompleteOutsiders)
+			i.OutsideChunks, i.CompleteOutsideChunks)
 	}
 
 	return nil
 }
 
-// GatherIndexIssueStats returns useful counters as well as outsider chunks (chunks outside of block time range) that helps to assess index health.
-func GatherIndexIssueStats(fn string, minTime int64, maxTime int64) (stats IndexIssueStats, err error) {
+// GatherIndexHealthStats returns the issues found in the index as well as its cardinality, which helps to assess index health.
+// Chunks outside of the given block time range are reported as outsiders.
+func GatherIndexHealthStats(fn string, minTime int64, maxTime int64) (stats HealthStats, err error) {
 	r, err := index.NewFileReader(fn)
 	if err != nil {
 		return stats, errors.Wrap(err, "open index file")
@@ -216,7 +267,7 @@ func GatherIndexIssueStats(fn string, minTime int64, maxTime int64) (stats Index
 		lastLset = append(lastLset[:0], lset...)
 
 		id := p.At()
-		stats.Total++
+		stats.TotalSeries++
 
 		if err := r.Series(id, &lset, &chks); err != nil {
 			return stats, errors.Wrap(err, "read series")
@@ -224,59 +275,103 @@ func GatherIndexIssueStats(fn string, minTime int64, maxTime int64) (stats Index
 		if len(lset) == 0 {
 			return stats, errors.Errorf("empty label set detected for series %d", id)
 		}
-		if lastLset != nil && labels.Compare(lastLset, lset) >= 0 {
-			return stats, errors.Errorf("series %v out of order; previous %v", lset, lastLset)
+		if !sort.IsSorted(lset) {
+			stats.UnsortedLabelSets++
+			// Series are ordered by their sorted label sets.
+			sort.Sort(lset)
 		}
 		l0 := lset[0]
 		for _, l := range lset[1:] {
-			if l.Name <= l0.Name {
-				return stats, errors.Errorf("out-of-order label set %s for series %d", lset, id)
+			if l.Name == l0.Name {
+				return stats, errors.Errorf("duplicated label name %s in label set %s for series %d", l.Name, lset, id)
 			}
 			l0 = l
 		}
+		if lastLset != nil {
+			switch c := labels.Compare(lastLset, lset); {
+			case c > 0:
+				return stats, errors.Errorf("series %v out of order; previous %v", lset, lastLset)
+			case c == 0:
+				stats.DuplicatedSeries++
+			}
+		}
 		if len(chks) == 0 {
 			return stats, errors.Errorf("empty chunks for series %d", id)
 		}
 
-		ooo := 0
+		stats.TotalChunks += len(chks)
+		if len(chks) > stats.MaxSeriesChunks {
+			stats.MaxSeriesChunks = len(chks)
+		}
+
+		ooo, overlaps := 0, 0
 		if chks[0].MinTime < minTime || chks[0].MaxTime > maxTime {
-			stats.Outsiders++
+			stats.OutsideChunks++
 			if chks[0].MinTime > maxTime || chks[0].MaxTime < minTime {
-				stats.CompleteOutsiders++
+				stats.CompleteOutsideChunks++
 			}
 		}
 		for i, c := range chks[1:] {
 			c0 := chks[i]
 
 			if c.MinTime < minTime || c.MaxTime > maxTime {
-				stats.Outsiders++
+				stats.OutsideChunks++
 				if c.MinTime > maxTime || c.MaxTime < minTime {
-					stats.CompleteOutsiders++
+					stats.CompleteOutsideChunks++
 				}
 			}
 
 			if c.MinTime > c0.MaxTime {
 				continue
 			}
+			if c.MinTime != c0.MinTime || c.MaxTime != c0.MaxTime {
+				// Chunks partially overlap.
+				overlaps++
+				continue
+			}
 
-			// Chunks overlaps or duplicates.
-			if c.MinTime == c0.MinTime && c.MaxTime == c0.MaxTime {
-				ca := crc32.Checksum(c0.Chunk.Bytes(), castagnoli)
-				cb := crc32.Checksum(c.Chunk.Bytes(), castagnoli)
-				if ca == cb {
-					// Duplicate.
-					stats.ExactSum++
-				}
-				ooo++
+			// Chunks with the same time range are out of order or duplicates.
+			ooo++
+			ca := crc32.Checksum(c0.Chunk.Bytes(), castagnoli)
+			cb := crc32.Checksum(c.Chunk.Bytes(), castagnoli)
+			if ca == cb {
+				// Duplicate.
+				stats.DuplicatedChunks++
 			}
 		}
 		if ooo > 0 {
-			stats.OutOfOrderCount++
-			stats.OutOfOrderSum += ooo
+			stats.OutOfOrderSeries++
+			stats.OutOfOrderChunks += ooo
+		}
+		if overlaps > 0 {
+			stats.OverlappingSeries++
+			stats.OverlappingChunks += overlaps
 		}
 	}
 	if p.Err() != nil {
-		return stats, errors.Wrap(err, "walk postings")
+		return stats, errors.Wrap(p.Err(), "walk postings")
+	}
+
+	lnames, err := r.LabelIndices()
+	if err != nil {
+		return stats, errors.Wrap(err, "read label indices")
+	}
+	for _, lns := range lnames {
+		if len(lns) != 1 {
+			continue
+		}
+		tpls, err := r.LabelValues(lns[0])
+		if err != nil {
+			return stats, errors.Wrap(err, "get label values")
+		}
+		stats.LabelNames++
+		if lns[0] == "__name__" {
+			stats.MetricNames = tpls.Len()
+		}
+		if tpls.Len() > stats.MaxLabelValues {
+			stats.MaxLabelValues = tpls.Len()
+			stats.MaxLabelValuesName = lns[0]
+		}
 	}
 
 	return stats, nil
@@ -286,8 +381,24 @@ func GatherIndexIssueStats(fn string, minTime int64, maxTime int64) (stats Index
 // It:
 // - removes out of order duplicates
 // - all "complete" outsiders (they will not accessed anyway)
+// - merges duplicated series into one
+// - sorts the labels of series with unsorted label sets
+// The Thanos section of the meta file, e.g. external labels and compaction sources, is kept for the new block.
 // Fixable inconsistencies are resolved in the new block.
 func Repair(dir string, id ulid.ULID) (resid ulid.ULID, err error) {
+	return rewriteBlock(dir, id, nil)
+}
+
+// Rewrite opens the block with given id in dir and creates a new one in dir with all series
+// relabeled by the given modifier. Series for which the modifier returns an empty label set are dropped.
+// Series with equal label sets after relabeling are merged into one and samples with equal timestamps
+// are deduplicated.
+// Same as Repair, it also resolves fixable inconsistencies of the block.
+func Rewrite(dir string, id ulid.ULID, modifier SeriesModifier) (resid ulid.ULID, err error) {
+	return rewriteBlock(dir, id, modifier)
+}
+
+func rewriteBlock(dir string, id ulid.ULID, modifier SeriesModifier) (resid ulid.ULID, err error) {
 	bdir := filepath.Join(dir, id.String())
 	entropy := rand.New(rand.NewSource(time.Now().UnixNano()))
 	resid = ulid.MustNew(ulid.Now(), entropy)
@@ -297,7 +408,7 @@ func Repair(dir string, id ulid.ULID) (resid ulid.ULID, err error) {
 		return resid, errors.Wrap(err, "read meta file")
 	}
 	if meta.Thanos.Downsample.Resolution > 0 {
-		return resid, errors.New("cannot repair downsampled block")
+		return resid, errors.New("cannot rewrite downsampled block")
 	}
 
 	b, err := tsdb.OpenBlock(bdir, nil)
@@ -306,43 +417,249 @@ func Repair(dir string, id ulid.ULID) (resid ulid.ULID, err error) {
 	}
 	defer b.Close()
 
-	indexr, err := b.Index()
+	if err := writeRewrittenBlock(filepath.Join(dir, resid.String()), b, newRewrittenMeta(meta, resid), modifier, nil); err != nil {
+		return resid, err
+	}
+	return resid, nil
+}
+
+// Split opens the block with given id in dir and distributes its series by the hash of their label sets
+// across the given number of new blocks in dir. It is used for blocks whose index exceeds the size TSDB is able to read.
+// The new blocks keep the Thanos meta of the original block and hold the shard they represent.
+// Same as Repair, it also resolves fixable inconsistencies of the block.
+func Split(dir string, id ulid.ULID, shards int, pool chunkenc.Pool) (ids []ulid.ULID, err error) {
+	if shards < 2 {
+		return nil, errors.Errorf("cannot split block into %d shards", shards)
+	}
+	bdir := filepath.Join(dir, id.String())
+	entropy := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	meta, err := ReadMetaFile(bdir)
 	if err != nil {
-		return resid, errors.Wrap(err, "open index")
+		return nil, errors.Wrap(err, "read meta file")
+	}
+	if meta.Thanos.Split != nil {
+		return nil, errors.Errorf("block is already shard %s", meta.Thanos.Split)
 	}
 
-	chunkr, err := b.Chunks()
+	b, err := tsdb.OpenBlock(bdir, pool)
 	if err != nil {
-		return resid, errors.Wrap(err, "open chunks")
+		return nil, errors.Wrap(err, "open block")
+	}
+	defer b.Close()
+
+	for i := 0; i < shards; i++ {
+		resmeta := newRewrittenMeta(meta, ulid.MustNew(ulid.Now(), entropy))
+		resmeta.Thanos.Split = &SplitShard{Index: i, Count: shards}
+
+		shard := uint64(i)
+		err := writeRewrittenBlock(filepath.Join(dir, resmeta.ULID.String()), b, resmeta, func(lset labels.Labels) labels.Labels {
+			// Equal series must end up in the same shard, also if their labels are not sorted.
+			sort.Sort(lset)
+			if lset.Hash()%uint64(shards) != shard {
+				return nil
+			}
+			return lset
+		}, nil)
+		if err != nil {
+			return ids, errors.Wrapf(err, "write shard %d", i)
+		}
+		ids = append(ids, resmeta.ULID)
+	}
+	return ids, nil
+}
+
+// MergeOptions configures how blocks are merged.
+type MergeOptions struct {
+	// PenaltyDeduplication deduplicates overlapping chunks of series like the querier deduplicates replicas of HA
+	// pairs. It picks the samples of one replica and switches to another only after a gap in the samples, so
+	// samples scraped by different replicas at slightly different times are not interleaved. Otherwise only
+	// samples with equal timestamps are deduplicated.
+	PenaltyDeduplication bool
+}
+
+// Merge opens the blocks with the given ids in dir and writes all their series into a single new block in dir.
+// It is used for vertical compaction of overlapping blocks, e.g. of Prometheus replicas with equal external labels.
+// Series of several blocks are merged and samples with equal timestamps in overlapping chunks are deduplicated.
+// The new block keeps the Thanos meta of the first block.
+func Merge(dir string, ids []ulid.ULID, pool chunkenc.Pool) (resid ulid.ULID, err error) {
+	return MergeWithOptions(dir, ids, pool, MergeOptions{})
+}
+
+// MergeWithOptions is like Merge but allows to deduplicate the samples of overlapping chunks based on penalties.
+func MergeWithOptions(dir string, ids []ulid.ULID, pool chunkenc.Pool, opts MergeOptions) (resid ulid.ULID, err error) {
+	entropy := rand.New(rand.NewSource(time.Now().UnixNano()))
+	resid = ulid.MustNew(ulid.Now(), entropy)
+
+	return resid, merge(dir, ids, pool, opts, resid, func(resdir string) (tsdb.ChunkWriter, error) {
+		return chunks.NewWriter(filepath.Join(resdir, ChunksDirname))
+	})
+}
+
+// MergeToBucket is like MergeWithOptions but streams the chunks of the new block into the bucket through u while they
+// are written, so the merge does not need local disk for them. The index and meta file of the new block, whose ID is
+// the one of u, are written into dir. The caller completes the upload with u.Finish or u.Abort.
+func MergeToBucket(dir string, ids []ulid.ULID, pool chunkenc.Pool, opts MergeOptions, u *StreamUploader) error {
+	return merge(dir, ids, pool, opts, u.ID(), func(string) (tsdb.ChunkWriter, error) {
+		return newStreamChunkWriter(u), nil
+	})
+}
+
+func merge(
+	dir string,
+	ids []ulid.ULID,
+	pool chunkenc.Pool,
+	opts MergeOptions,
+	resid ulid.ULID,
+	newChunkWriter func(resdir string) (tsdb.ChunkWriter, error),
+) error {
+	if len(ids) < 2 {
+		return errors.Errorf("cannot merge %d blocks", len(ids))
+	}
+
+	var (
+		resmeta *Meta
+		series  []seriesRef
+		sources = map[ulid.ULID]struct{}{}
+	)
+	for _, id := range ids {
+		bdir := filepath.Join(dir, id.String())
+
+		meta, err := ReadMetaFile(bdir)
+		if err != nil {
+			return errors.Wrapf(err, "read meta file of %s", id)
+		}
+		if meta.Thanos.Downsample.Resolution > 0 {
+			return errors.Errorf("cannot merge downsampled block %s", id)
+		}
+
+		b, err := tsdb.OpenBlock(bdir, pool)
+		if err != nil {
+			return errors.Wrapf(err, "open block %s", id)
+		}
+		defer b.Close()
+
+		indexr, err := b.Index()
+		if err != nil {
+			return errors.Wrapf(err, "open index of %s", id)
+		}
+		defer indexr.Close()
+
+		chunkr, err := b.Chunks()
+		if err != nil {
+			return errors.Wrapf(err, "open chunks of %s", id)
+		}
+		defer chunkr.Close()
+
+		s, err := readSeries(indexr, chunkr, nil, nil)
+		if err != nil {
+			return errors.Wrapf(err, "read series of %s", id)
+		}
+		series = append(series, s...)
+
+		for _, s := range meta.Compaction.Sources {
+			sources[s] = struct{}{}
+		}
+		if resmeta == nil {
+			resmeta = newRewrittenMeta(meta, resid)
+			continue
+		}
+		if meta.MinTime < resmeta.MinTime {
+			resmeta.MinTime = meta.MinTime
+		}
+		if meta.MaxTime > resmeta.MaxTime {
+			resmeta.MaxTime = meta.MaxTime
+		}
+		if meta.Compaction.Level > resmeta.Compaction.Level {
+			resmeta.Compaction.Level = meta.Compaction.Level
+		}
+	}
+	resmeta.Compaction.Level++
+	resmeta.Compaction.Sources = resmeta.Compaction.Sources[:0:0]
+	for s := range sources {
+		resmeta.Compaction.Sources = append(resmeta.Compaction.Sources, s)
 	}
+	sort.Slice(resmeta.Compaction.Sources, func(i, j int) bool {
+		return resmeta.Compaction.Sources[i].Compare(resmeta.Compaction.Sources[j]) < 0
+	})
 
 	resdir := filepath.Join(dir, resid.String())
+	if err := os.MkdirAll(resdir, 0777); err != nil {
+		return errors.Wrap(err, "create block dir")
+	}
 
-	chunkw, err := chunks.NewWriter(filepath.Join(resdir, ChunksDirname))
+	chunkw, err := newChunkWriter(resdir)
 	if err != nil {
-		return resid, errors.Wrap(err, "open chunk writer")
+		return errors.Wrap(err, "open chunk writer")
 	}
 	defer chunkw.Close()
 
 	indexw, err := index.NewWriter(filepath.Join(resdir, IndexFilename))
 	if err != nil {
-		return resid, errors.Wrap(err, "open index writer")
+		return errors.Wrap(err, "open index writer")
 	}
 	defer indexw.Close()
 
+	chunkSeq := mergeChunkSequence
+	if opts.PenaltyDeduplication {
+		chunkSeq = dedupChunkSequence
+	}
+	if err := writeSeries(indexw, chunkw, resmeta, series, chunkSeq); err != nil {
+		return errors.Wrap(err, "merge series")
+	}
+	// Close the chunk writer explicitly to get the result of streamed uploads.
+	if err := chunkw.Close(); err != nil {
+		return errors.Wrap(err, "close chunk writer")
+	}
+	return WriteMetaFile(resdir, resmeta)
+}
+
+// newRewrittenMeta returns a copy of meta for a new block with the given ID written from the original one.
+func newRewrittenMeta(meta *Meta, id ulid.ULID) *Meta {
 	// TODO(fabxc): adapt so we properly handle the version once we update to an upstream
 	// that has multiple.
 	resmeta := *meta
-	resmeta.ULID = resid
+	resmeta.ULID = id
 	resmeta.Stats = tsdb.BlockStats{} // reset stats
+	// File descriptions of the source block are invalid for the new one. They are gathered again on upload.
+	resmeta.Thanos.Files = nil
+	if resmeta.Thanos.Version > ThanosVersion1 {
+		resmeta.Thanos.Version = ThanosVersion1
+	}
+	return &resmeta
+}
 
-	if err := rewrite(indexr, chunkr, indexw, chunkw, &resmeta); err != nil {
-		return resid, errors.Wrap(err, "rewrite block")
+// writeRewrittenBlock writes the series of b, replaced by the result of modifier, as new block with the given meta into resdir.
+// If tombstones is not nil, the samples deleted by them are removed from the chunks.
+func writeRewrittenBlock(resdir string, b *tsdb.Block, resmeta *Meta, modifier SeriesModifier, tombstones tsdb.TombstoneReader) error {
+	indexr, err := b.Index()
+	if err != nil {
+		return errors.Wrap(err, "open index")
 	}
-	if err := WriteMetaFile(resdir, &resmeta); err != nil {
-		return resid, err
+	defer indexr.Close()
+
+	chunkr, err := b.Chunks()
+	if err != nil {
+		return errors.Wrap(err, "open chunks")
 	}
-	return resid, nil
+	defer chunkr.Close()
+
+	chunkw, err := chunks.NewWriter(filepath.Join(resdir, ChunksDirname))
+	if err != nil {
+		return errors.Wrap(err, "open chunk writer")
+	}
+	defer chunkw.Close()
+
+	indexw, err := index.NewWriter(filepath.Join(resdir, IndexFilename))
+	if err != nil {
+		return errors.Wrap(err, "open index writer")
+	}
+	defer indexw.Close()
+
+	if err := rewrite(indexr, chunkr, tombstones, indexw, chunkw, resmeta, modifier); err != nil {
+		return errors.Wrap(err, "rewrite block")
+	}
+	return WriteMetaFile(resdir, resmeta)
 }
 
 var castagnoli = crc32.MakeTable(crc32.Castagnoli)
@@ -360,18 +677,18 @@ func sanitizeChunkSequence(chks []chunks.Meta, mint int64, maxt int64) ([]chunks
 
 	// Remove duplicates and complete outsiders.
 	repl := make([]chunks.Meta, 0, len(chks))
-	for i, c := range chks {
+	for _, c := range chks {
 		if c.MinTime > maxt || c.MaxTime < mint {
 			// "Complete" outsider. Ignore.
 			continue
 		}
 
-		if i == 0 {
+		if len(repl) == 0 {
 			repl = append(repl, c)
 			continue
 		}
 
-		last := repl[i-1]
+		last := repl[len(repl)-1]
 
 		if c.MinTime > last.MaxTime {
 			repl = append(repl, c)
@@ -382,7 +699,7 @@ func sanitizeChunkSequence(chks []chunks.Meta, mint int64, maxt int64) ([]chunks
 		// the current one.
 		if c.MinTime != last.MinTime || c.MaxTime != last.MaxTime {
 			return nil, errors.Errorf("non-sequential chunks not equal: [%d, %d] and [%d, %d]",
-				last.MaxTime, last.MaxTime, c.MinTime, c.MaxTime)
+				last.MinTime, last.MaxTime, c.MinTime, c.MaxTime)
 		}
 		ca := crc32.Checksum(last.Chunk.Bytes(), castagnoli)
 		cb := crc32.Checksum(c.Chunk.Bytes(), castagnoli)
@@ -395,62 +712,370 @@ func sanitizeChunkSequence(chks []chunks.Meta, mint int64, maxt int64) ([]chunks
 	return repl, nil
 }
 
+// maxMergedChunkSamples is the maximum number of samples of chunks re-encoded from overlapping chunks. It matches
+// the chunks cut by Prometheus.
+const maxMergedChunkSamples = 120
+
+// mergeChunkSequence orders the input chunks and merges overlapping ones. Of samples with equal timestamps in
+// overlapping chunks, the one of the first chunk is kept. Chunks outside of [mint, maxt] are dropped.
+func mergeChunkSequence(chks []chunks.Meta, mint int64, maxt int64) ([]chunks.Meta, error) {
+	return mergeOverlappingChunks(chks, mint, maxt, mergeChunks)
+}
+
+// dedupChunkSequence orders the input chunks and deduplicates the samples of overlapping ones based on penalties.
+// Chunks outside of [mint, maxt] are dropped.
+func dedupChunkSequence(chks []chunks.Meta, mint int64, maxt int64) ([]chunks.Meta, error) {
+	return mergeOverlappingChunks(chks, mint, maxt, dedupChunks)
+}
+
+// mergeOverlappingChunks orders the input chunks and replaces each run of overlapping chunks by the result of merge.
+// Chunks outside of [mint, maxt] are dropped.
+func mergeOverlappingChunks(chks []chunks.Meta, mint int64, maxt int64, merge func([]chunks.Meta) ([]chunks.Meta, error)) ([]chunks.Meta, error) {
+	sort.SliceStable(chks, func(i, j int) bool {
+		return chks[i].MinTime < chks[j].MinTime
+	})
+
+	var (
+		res     = make([]chunks.Meta, 0, len(chks))
+		overlap []chunks.Meta
+		// overlapMaxt is the end of the current run of overlapping chunks.
+		overlapMaxt int64
+	)
+	flush := func() error {
+		switch len(overlap) {
+		case 0:
+			return nil
+		case 1:
+			res = append(res, overlap[0])
+			return nil
+		}
+		merged, err := merge(overlap)
+		if err != nil {
+			return err
+		}
+		res = append(res, merged...)
+		return nil
+	}
+	for _, c := range chks {
+		if c.MinTime > maxt || c.MaxTime < mint {
+			continue
+		}
+		if len(overlap) > 0 && c.MinTime <= overlapMaxt {
+			overlap = append(overlap, c)
+			if c.MaxTime > overlapMaxt {
+				overlapMaxt = c.MaxTime
+			}
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		overlap, overlapMaxt = []chunks.Meta{c}, c.MaxTime
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+type sample struct {
+	t int64
+	v float64
+}
+
+// chunkSamples appends the samples of the chunk to samples.
+func chunkSamples(c chunks.Meta, samples []sample) ([]sample, error) {
+	it := c.Chunk.Iterator()
+	for it.Next() {
+		t, v := it.At()
+		samples = append(samples, sample{t: t, v: v})
+	}
+	return samples, errors.Wrap(it.Err(), "iterate chunk")
+}
+
+// mergeChunks re-encodes the samples of the given overlapping chunks into new chunks. Of samples with equal
+// timestamps, the one of the first chunk is kept.
+func mergeChunks(chks []chunks.Meta) ([]chunks.Meta, error) {
+	var (
+		samples []sample
+		err     error
+	)
+	for _, c := range chks {
+		if samples, err = chunkSamples(c, samples); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].t < samples[j].t
+	})
+
+	deduped := samples[:0]
+	for _, s := range samples {
+		if len(deduped) > 0 && s.t == deduped[len(deduped)-1].t {
+			continue
+		}
+		deduped = append(deduped, s)
+	}
+	return encodeChunks(deduped)
+}
+
+// dedupChunks re-encodes the samples of the given overlapping chunks ordered by MinTime into new chunks. The chunks
+// are split into sequences of non-overlapping chunks, i.e. the chunks of the replicas of a series, whose samples are
+// deduplicated based on penalties.
+func dedupChunks(chks []chunks.Meta) ([]chunks.Meta, error) {
+	var (
+		replicas [][]sample
+		maxts    []int64
+		err      error
+	)
+	for _, c := range chks {
+		i := 0
+		for ; i < len(replicas); i++ {
+			if c.MinTime > maxts[i] {
+				break
+			}
+		}
+		if i == len(replicas) {
+			replicas = append(replicas, nil)
+			maxts = append(maxts, 0)
+		}
+		if replicas[i], err = chunkSamples(c, replicas[i]); err != nil {
+			return nil, err
+		}
+		maxts[i] = c.MaxTime
+	}
+
+	samples := replicas[0]
+	for _, r := range replicas[1:] {
+		samples = dedupSamples(samples, r)
+	}
+	return encodeChunks(samples)
+}
+
+// initialPenalty is the penalty applied to the replica not picked for the first sample, as no sample interval is
+// known yet. Timestamps are in milliseconds and scrape intervals are typically multiple seconds long.
+const initialPenalty = 5000
+
+// dedupSamples merges the ordered samples of two replicas of a series like the deduplicating iterator of the querier.
+// For the replica not picked for a sample, a penalty twice as high as the delta of the last two samples is added to
+// the timestamp of its next sample. This ensures that no sample too close to the previous one is picked, which would
+// increase the overall sample frequency, and guards against clock drift between the replicas.
+func dedupSamples(a, b []sample) []sample {
+	var (
+		res        = make([]sample, 0, len(a))
+		i, j       int
+		lastT      int64 = math.MinInt64
+		penA, penB int64
+	)
+	for {
+		// Advance both replicas to at least the next highest timestamp plus the potential penalty.
+		for i < len(a) && a[i].t < lastT+1+penA {
+			i++
+		}
+		for j < len(b) && b[j].t < lastT+1+penB {
+			j++
+		}
+
+		var useA bool
+		switch {
+		case i == len(a) && j == len(b):
+			return res
+		case i == len(a):
+			useA = false
+		case j == len(b):
+			useA = true
+		default:
+			useA = a[i].t <= b[j].t
+			pen := int64(initialPenalty)
+			if lastT != math.MinInt64 {
+				if useA {
+					pen = 2 * (a[i].t - lastT)
+				} else {
+					pen = 2 * (b[j].t - lastT)
+				}
+			}
+			if useA {
+				penB = pen
+			} else {
+				penA = pen
+			}
+		}
+
+		if useA {
+			res = append(res, a[i])
+			lastT, penA = a[i].t, 0
+		} else {
+			res = append(res, b[j])
+			lastT, penB = b[j].t, 0
+		}
+	}
+}
+
+// encodeChunks encodes the ordered samples into chunks of at most maxMergedChunkSamples samples.
+func encodeChunks(samples []sample) ([]chunks.Meta, error) {
+	var (
+		res []chunks.Meta
+		app chunkenc.Appender
+	)
+	for _, s := range samples {
+		if len(res) == 0 || res[len(res)-1].Chunk.NumSamples() >= maxMergedChunkSamples {
+			chk := chunkenc.NewXORChunk()
+			var err error
+			if app, err = chk.Appender(); err != nil {
+				return nil, err
+			}
+			res = append(res, chunks.Meta{MinTime: s.t, Chunk: chk})
+		}
+		app.Append(s.t, s.v)
+		res[len(res)-1].MaxTime = s.t
+	}
+	return res, nil
+}
+
+// SeriesModifier returns the label set a series is rewritten with. Returning an empty
+// label set drops the series.
+type SeriesModifier func(lset labels.Labels) labels.Labels
+
+type seriesRef struct {
+	lset labels.Labels
+	chks []chunks.Meta
+}
+
 // rewrite writes all data from the readers back into the writers while cleaning
-// up mis-ordered and duplicated chunks.
+// up mis-ordered and duplicated chunks. If modifier is not nil, the label sets of all series
+// are replaced by its result. If tombstones is not nil, the samples deleted by them are removed.
 func rewrite(
-	indexr tsdb.IndexReader, chunkr tsdb.ChunkReader,
+	indexr tsdb.IndexReader, chunkr tsdb.ChunkReader, tombstones tsdb.TombstoneReader,
 	indexw tsdb.IndexWriter, chunkw tsdb.ChunkWriter,
 	meta *Meta,
+	modifier SeriesModifier,
 ) error {
-	symbols, err := indexr.Symbols()
+	series, err := readSeries(indexr, chunkr, tombstones, modifier)
 	if err != nil {
 		return err
 	}
-	if err := indexw.AddSymbols(symbols); err != nil {
-		return err
+	chunkSeq := sanitizeChunkSequence
+	if modifier != nil {
+		// Different series may end up with the same label set after being modified. Their chunks
+		// overlap without being copies of each other, so they are merged like those of overlapping blocks.
+		chunkSeq = mergeChunkSequence
 	}
+	return writeSeries(indexw, chunkw, meta, series, chunkSeq)
+}
 
+// readSeries returns all series of the readers with their chunks loaded. If modifier is not nil, the label sets of all
+// series are replaced by its result. If tombstones is not nil, the samples deleted by them are removed.
+func readSeries(indexr tsdb.IndexReader, chunkr tsdb.ChunkReader, tombstones tsdb.TombstoneReader, modifier SeriesModifier) ([]seriesRef, error) {
 	all, err := indexr.Postings(index.AllPostingsKey())
 	if err != nil {
-		return err
+		return nil, err
 	}
 	all = indexr.SortedPostings(all)
 
+	// Series are collected upfront since modified label sets may change their order.
+	var (
+		series []seriesRef
+		lset   labels.Labels
+		chks   []chunks.Meta
+	)
+	for all.Next() {
+		if err := indexr.Series(all.At(), &lset, &chks); err != nil {
+			return nil, err
+		}
+		s := seriesRef{
+			lset: append(labels.Labels{}, lset...),
+			chks: append([]chunks.Meta{}, chks...),
+		}
+		if tombstones != nil {
+			dranges, err := tombstones.Get(all.At())
+			if err != nil {
+				return nil, errors.Wrap(err, "get tombstones")
+			}
+			if len(dranges) > 0 {
+				if s.chks, err = deleteSamples(chunkr, s.chks, dranges); err != nil {
+					return nil, errors.Wrapf(err, "delete samples of series %s", s.lset)
+				}
+				if len(s.chks) == 0 {
+					continue
+				}
+			}
+		}
+		if modifier != nil {
+			s.lset = modifier(s.lset)
+			if len(s.lset) == 0 {
+				continue
+			}
+		}
+		for j, c := range s.chks {
+			// Chunks re-encoded due to deletions are already loaded.
+			if c.Chunk != nil {
+				continue
+			}
+			if s.chks[j].Chunk, err = chunkr.Chunk(c.Ref); err != nil {
+				return nil, err
+			}
+		}
+		// The index requires sorted label sets, which may be violated by broken writers or the modifier.
+		sort.Sort(s.lset)
+		series = append(series, s)
+	}
+	if all.Err() != nil {
+		return nil, errors.Wrap(all.Err(), "iterate series")
+	}
+	return series, nil
+}
+
+// chunkSequence returns the chunks written for a series from all its chunks. Chunks outside of
+// [mint, maxt] are dropped.
+type chunkSequence func(chks []chunks.Meta, mint int64, maxt int64) ([]chunks.Meta, error)
+
+// writeSeries writes the given series into the writers and sets the stats of meta. Series with equal label sets
+// are merged, their chunks are passed through chunkSeq.
+func writeSeries(indexw tsdb.IndexWriter, chunkw tsdb.ChunkWriter, meta *Meta, series []seriesRef, chunkSeq chunkSequence) error {
+	sort.SliceStable(series, func(i, j int) bool {
+		return labels.Compare(series[i].lset, series[j].lset) < 0
+	})
+
+	symbols := map[string]struct{}{}
+	for _, s := range series {
+		for _, l := range s.lset {
+			symbols[l.Name] = struct{}{}
+			symbols[l.Value] = struct{}{}
+		}
+	}
+	if err := indexw.AddSymbols(symbols); err != nil {
+		return err
+	}
+
 	// We fully rebuild the postings list index from merged series.
 	var (
 		postings = index.NewMemPostings()
 		values   = map[string]stringset{}
 		i        = uint64(0)
-	)
 
-	var lset labels.Labels
-	var chks []chunks.Meta
-
-	for all.Next() {
-		id := all.At()
+		// Series with the same label set are adjacent after sorting. They are buffered
+		// and merged into a single series before being written.
+		pendingLset labels.Labels
+		pendingChks []chunks.Meta
+	)
 
-		if err := indexr.Series(id, &lset, &chks); err != nil {
-			return err
-		}
-		for i, c := range chks {
-			chks[i].Chunk, err = chunkr.Chunk(c.Ref)
-			if err != nil {
-				return err
-			}
+	flush := func() error {
+		if pendingLset == nil {
+			return nil
 		}
-		chks, err := sanitizeChunkSequence(chks, meta.MinTime, meta.MaxTime)
+		chks, err := chunkSeq(pendingChks, meta.MinTime, meta.MaxTime)
 		if err != nil {
 			return err
 		}
 
 		if len(chks) == 0 {
-			continue
+			return nil
 		}
 
 		if err := chunkw.WriteChunks(chks...); err != nil {
 			return errors.Wrap(err, "write chunks")
 		}
-		if err := indexw.AddSeries(i, lset, chks...); err != nil {
+		if err := indexw.AddSeries(i, pendingLset, chks...); err != nil {
 			return errors.Wrap(err, "add series")
 		}
 
@@ -461,7 +1086,7 @@ func rewrite(
 			meta.Stats.NumSamples += uint64(chk.Chunk.NumSamples())
 		}
 
-		for _, l := range lset {
+		for _, l := range pendingLset {
 			valset, ok := values[l.Name]
 			if !ok {
 				valset = stringset{}
@@ -469,11 +1094,25 @@ func rewrite(
 			}
 			valset.set(l.Value)
 		}
-		postings.Add(i, lset)
+		postings.Add(i, pendingLset)
 		i++
+		return nil
 	}
-	if all.Err() != nil {
-		return errors.Wrap(all.Err(), "iterate series")
+
+	for _, s := range series {
+		if pendingLset != nil && labels.Compare(pendingLset, s.lset) == 0 {
+			pendingChks = append(pendingChks, s.chks...)
+			continue
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+		pendingLset = s.lset
+		pendingChks = s.chks
+	}
+	if err := flush(); err != nil {
+		return err
 	}
 
 	s := make([]string, 0, 256)
@@ -496,6 +1135,127 @@ func rewrite(
 	return nil
 }
 
+// deleteSamples returns the given chunks with all samples in the deleted time ranges removed. Chunks overlapping
+// with deleted ranges are re-encoded, chunks left without samples are dropped.
+func deleteSamples(chunkr tsdb.ChunkReader, chks []chunks.Meta, dranges tsdb.Intervals) ([]chunks.Meta, error) {
+	isDeleted := func(mint, maxt int64) bool {
+		for _, r := range dranges {
+			if mint <= r.Maxt && r.Mint <= maxt {
+				return true
+			}
+		}
+		return false
+	}
+
+	res := make([]chunks.Meta, 0, len(chks))
+	for _, c := range chks {
+		if !isDeleted(c.MinTime, c.MaxTime) {
+			res = append(res, c)
+			continue
+		}
+		chk, err := chunkr.Chunk(c.Ref)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read chunk %d", c.Ref)
+		}
+
+		newChk := chunkenc.NewXORChunk()
+		app, err := newChk.Appender()
+		if err != nil {
+			return nil, err
+		}
+		repl := chunks.Meta{Ref: c.Ref, Chunk: newChk}
+
+		it := chk.Iterator()
+		for it.Next() {
+			t, v := it.At()
+			if isDeleted(t, t) {
+				continue
+			}
+			if newChk.NumSamples() == 0 {
+				repl.MinTime = t
+			}
+			repl.MaxTime = t
+			app.Append(t, v)
+		}
+		if it.Err() != nil {
+			return nil, errors.Wrapf(it.Err(), "iterate chunk %d", c.Ref)
+		}
+		if newChk.NumSamples() > 0 {
+			res = append(res, repl)
+		}
+	}
+	return res, nil
+}
+
+// ApplyTombstones removes the samples deleted by the tombstones of the block in bdir from its chunks and removes
+// the tombstones file. The block keeps its ID. It returns false if the block has no deletions.
+func ApplyTombstones(bdir string) (bool, error) {
+	tmpdir := bdir + ".tmp-apply-tombstones"
+	if err := os.RemoveAll(tmpdir); err != nil {
+		return false, errors.Wrap(err, "clean temporary dir")
+	}
+	defer os.RemoveAll(tmpdir)
+
+	applied, err := writeTombstonesApplied(bdir, tmpdir)
+	if err != nil {
+		return false, err
+	}
+	if applied {
+		// Swap the rewritten files into the block dir. New files are created instead of modifying the existing
+		// ones, so hard links of the block, e.g. from Prometheus, are not affected.
+		if err := os.RemoveAll(filepath.Join(bdir, ChunksDirname)); err != nil {
+			return false, errors.Wrap(err, "remove old chunks")
+		}
+		for _, fn := range []string{ChunksDirname, IndexFilename, MetaFilename} {
+			if err := os.Rename(filepath.Join(tmpdir, fn), filepath.Join(bdir, fn)); err != nil {
+				return false, errors.Wrapf(err, "replace %s", fn)
+			}
+		}
+	}
+	if err := os.Remove(filepath.Join(bdir, "tombstones")); err != nil && !os.IsNotExist(err) {
+		return false, errors.Wrap(err, "remove tombstones")
+	}
+	return applied, nil
+}
+
+func writeTombstonesApplied(bdir, resdir string) (bool, error) {
+	meta, err := ReadMetaFile(bdir)
+	if err != nil {
+		return false, errors.Wrap(err, "read meta file")
+	}
+
+	b, err := tsdb.OpenBlock(bdir, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "open block")
+	}
+	defer b.Close()
+
+	tombstones, err := b.Tombstones()
+	if err != nil {
+		return false, errors.Wrap(err, "open tombstones")
+	}
+	defer tombstones.Close()
+
+	deleted := false
+	if err := tombstones.Iter(func(uint64, tsdb.Intervals) error {
+		deleted = true
+		return nil
+	}); err != nil {
+		return false, errors.Wrap(err, "iterate tombstones")
+	}
+	if !deleted {
+		return false, nil
+	}
+	if meta.Thanos.Downsample.Resolution > 0 {
+		return false, errors.New("cannot apply tombstones to downsampled block")
+	}
+
+	if err := writeRewrittenBlock(resdir, b, newRewrittenMeta(meta, meta.ULID), nil, tombstones); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 type stringset map[string]struct{}
 
 func (ss stringset) set(s string) {
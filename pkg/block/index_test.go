@@ -0,0 +1,276 @@
+package block
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/tsdb"
+	"github.com/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/tsdb/chunks"
+	"github.com/prometheus/tsdb/index"
+	"github.com/prometheus/tsdb/labels"
+)
+
+func TestSanitizeChunkSequence(t *testing.T) {
+	newChunk := func(mint, maxt int64, vals ...float64) chunks.Meta {
+		c := chunkenc.NewXORChunk()
+		app, err := c.Appender()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, v := range vals {
+			app.Append(mint+int64(i), v)
+		}
+		return chunks.Meta{MinTime: mint, MaxTime: maxt, Chunk: c}
+	}
+
+	var (
+		c1 = newChunk(0, 10, 1, 2)
+		c2 = newChunk(11, 20, 3, 4)
+		c3 = newChunk(21, 30, 5, 6)
+		// Complete outsider of the [0, 30] range.
+		outsider = newChunk(100, 110, 7)
+	)
+
+	// Duplicates and outsiders are dropped while remaining chunks are sorted.
+	res, err := sanitizeChunkSequence([]chunks.Meta{outsider, c2, c1, c2, c3, c1}, 0, 30)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if exp := []chunks.Meta{c1, c2, c3}; !reflect.DeepEqual(exp, res) {
+		t.Fatalf("expected %v, got %v", exp, res)
+	}
+
+	// Overlapping chunks with different data cannot be repaired.
+	_, err = sanitizeChunkSequence([]chunks.Meta{c1, newChunk(0, 10, 2, 1)}, 0, 30)
+	if err == nil {
+		t.Fatal("expected error for overlapping chunks with different data")
+	}
+}
+
+func TestMergeChunkSequence(t *testing.T) {
+	newChunk := func(ts ...int64) chunks.Meta {
+		c := chunkenc.NewXORChunk()
+		app, err := c.Appender()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, t := range ts {
+			app.Append(t, float64(t))
+		}
+		return chunks.Meta{MinTime: ts[0], MaxTime: ts[len(ts)-1], Chunk: c}
+	}
+	samples := func(chks []chunks.Meta) (res []int64) {
+		for _, c := range chks {
+			it := c.Chunk.Iterator()
+			for it.Next() {
+				t, _ := it.At()
+				res = append(res, t)
+			}
+		}
+		return res
+	}
+
+	var (
+		c1 = newChunk(0, 2, 4)
+		c2 = newChunk(1, 2, 3, 6)
+		c3 = newChunk(6, 8)
+		c4 = newChunk(20, 22)
+		// Complete outsider of the [0, 30] range.
+		outsider = newChunk(100, 110)
+	)
+
+	// Overlapping chunks are merged with deduplicated samples while others are kept as they are.
+	res, err := mergeChunkSequence([]chunks.Meta{c4, outsider, c2, c3, c1}, 0, 30)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(res) != 2 || !reflect.DeepEqual(res[1], c4) {
+		t.Fatalf("unexpected chunks %v", res)
+	}
+	if res[0].MinTime != 0 || res[0].MaxTime != 8 {
+		t.Fatalf("unexpected merged chunk %v", res[0])
+	}
+	if exp, got := []int64{0, 1, 2, 3, 4, 6, 8, 20, 22}, samples(res); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected samples %v, got %v", exp, got)
+	}
+
+	// Merged chunks are cut at the maximum number of samples.
+	var ts1, ts2 []int64
+	for t := int64(0); t < 2*maxMergedChunkSamples; t++ {
+		ts1 = append(ts1, 2*t)
+		ts2 = append(ts2, 2*t+1)
+	}
+	res, err = mergeChunkSequence([]chunks.Meta{newChunk(ts1...), newChunk(ts2...)}, 0, 1000)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(res) != 4 || res[1].MinTime != maxMergedChunkSamples || res[1].Chunk.NumSamples() != maxMergedChunkSamples {
+		t.Fatalf("unexpected chunks %v", res)
+	}
+}
+
+func TestDedupChunkSequence(t *testing.T) {
+	newChunk := func(ts ...int64) chunks.Meta {
+		c := chunkenc.NewXORChunk()
+		app, err := c.Appender()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, t := range ts {
+			app.Append(t, float64(t))
+		}
+		return chunks.Meta{MinTime: ts[0], MaxTime: ts[len(ts)-1], Chunk: c}
+	}
+
+	// Replica a scrapes every 10s and misses a few scrapes, replica b scrapes with an offset of 2s. Samples of
+	// replica a are used until its gap. Replica b is used after the penalty of twice the last scrape interval.
+	chks := []chunks.Meta{
+		newChunk(0, 10000, 20000),
+		newChunk(2000, 12000, 22000, 32000),
+		newChunk(60000, 70000),
+		newChunk(42000, 52000, 62000, 72000),
+	}
+	res, err := dedupChunkSequence(chks, 0, 100000)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var got []int64
+	for _, c := range res {
+		it := c.Chunk.Iterator()
+		for it.Next() {
+			t, _ := it.At()
+			got = append(got, t)
+		}
+	}
+	if exp := []int64{0, 10000, 20000, 42000, 52000, 62000, 72000}; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected samples %v, got %v", exp, got)
+	}
+}
+
+func TestHealthStats_ErrSummary(t *testing.T) {
+	if err := (HealthStats{TotalSeries: 10}).ErrSummary(); err != nil {
+		t.Fatalf("unexpected error for healthy index: %v", err)
+	}
+	err := (HealthStats{TotalSeries: 10, UnsortedLabelSets: 2}).ErrSummary()
+	if err == nil || err.Error() != "2/10 series have unsorted label sets. Outsiders: 0, complete outsiders: 0" {
+		t.Fatalf("unexpected summary %v", err)
+	}
+
+	stats := HealthStats{TotalSeries: 10, OutOfOrderSeries: 1, OutOfOrderChunks: 2, DuplicatedChunks: 1}
+	if err := stats.OutOfOrderChunksErr(); err == nil {
+		t.Fatal("expected out of order chunks error")
+	}
+	if err := stats.ErrSummary(); err == nil {
+		t.Fatal("expected error summary")
+	}
+
+	// Partially overlapping chunks are only reported.
+	if err := (HealthStats{TotalSeries: 10, OverlappingSeries: 1, OverlappingChunks: 2}).ErrSummary(); err != nil {
+		t.Fatalf("unexpected error for overlapping chunks: %v", err)
+	}
+}
+
+func TestGatherIndexHealthStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-index-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newChunk := func(mint, maxt int64) chunks.Meta {
+		c := chunkenc.NewXORChunk()
+		app, err := c.Appender()
+		if err != nil {
+			t.Fatal(err)
+		}
+		app.Append(mint, 1)
+		app.Append(maxt, 2)
+		return chunks.Meta{MinTime: mint, MaxTime: maxt, Chunk: c}
+	}
+	series := []seriesRef{
+		{lset: labels.FromStrings("a", "1"), chks: []chunks.Meta{newChunk(0, 9), newChunk(10, 19)}},
+		// Unsorted chunks overlap the preceding ones as well.
+		{lset: labels.FromStrings("a", "2"), chks: []chunks.Meta{newChunk(10, 19), newChunk(0, 9)}},
+		{lset: labels.FromStrings("a", "3"), chks: []chunks.Meta{newChunk(0, 9), newChunk(5, 14), newChunk(10, 19)}},
+	}
+
+	chunkw, err := chunks.NewWriter(filepath.Join(dir, ChunksDirname))
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexw, err := index.NewWriter(filepath.Join(dir, IndexFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keep := func(chks []chunks.Meta, _, _ int64) ([]chunks.Meta, error) { return chks, nil }
+	if err := writeSeries(indexw, chunkw, &Meta{BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: 20}}, series, keep); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := chunkw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := GatherIndexHealthStats(filepath.Join(dir, IndexFilename), 0, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalSeries != 3 || stats.TotalChunks != 7 {
+		t.Fatalf("unexpected totals %+v", stats)
+	}
+	// Only chunks with the same time range as the preceding ones are out of order, partial overlaps do not fail
+	// verification.
+	if stats.OutOfOrderSeries != 0 || stats.OutOfOrderChunks != 0 {
+		t.Fatalf("unexpected out of order chunks %+v", stats)
+	}
+	if stats.OverlappingSeries != 2 || stats.OverlappingChunks != 3 {
+		t.Fatalf("unexpected overlapping chunks %+v", stats)
+	}
+	if err := stats.ErrSummary(); err != nil {
+		t.Fatalf("unexpected error summary %v", err)
+	}
+}
+
+type mapChunkReader map[uint64]chunkenc.Chunk
+
+func (r mapChunkReader) Chunk(ref uint64) (chunkenc.Chunk, error) { return r[ref], nil }
+
+func (r mapChunkReader) Close() error { return nil }
+
+func TestDeleteSamples(t *testing.T) {
+	chunkr := mapChunkReader{}
+	newChunk := func(ref uint64, mint, maxt int64) chunks.Meta {
+		c := chunkenc.NewXORChunk()
+		app, err := c.Appender()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ts := mint; ts <= maxt; ts++ {
+			app.Append(ts, float64(ts))
+		}
+		chunkr[ref] = c
+		return chunks.Meta{Ref: ref, MinTime: mint, MaxTime: maxt}
+	}
+	chks := []chunks.Meta{newChunk(1, 0, 9), newChunk(2, 10, 19), newChunk(3, 20, 29)}
+
+	res, err := deleteSamples(chunkr, chks, tsdb.Intervals{{Mint: 5, Maxt: 19}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("expected fully deleted chunk to be dropped, got %v", res)
+	}
+	if res[0].MinTime != 0 || res[0].MaxTime != 4 || res[0].Chunk.NumSamples() != 5 {
+		t.Fatalf("unexpected re-encoded chunk %v with %d samples", res[0], res[0].Chunk.NumSamples())
+	}
+	// Chunks outside of deleted ranges are not loaded.
+	if res[1].Ref != 3 || res[1].Chunk != nil {
+		t.Fatalf("unexpected untouched chunk %v", res[1])
+	}
+}
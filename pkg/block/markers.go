@@ -0,0 +1,212 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DeletionMarkFilename is the known json filename to store details about when block is marked for deletion.
+	DeletionMarkFilename = "deletion-mark.json"
+	// NoCompactMarkFilename is the known json filename to store details about why block is excluded from compaction.
+	NoCompactMarkFilename = "no-compact-mark.json"
+	// NoDownsampleMarkFilename is the known json filename to store details about why block is excluded from downsampling.
+	NoDownsampleMarkFilename = "no-downsample-mark.json"
+)
+
+// DeletionMarkVersion1 is the version of deletion-mark file supported by Thanos.
+const DeletionMarkVersion1 = 1
+
+// MarkVersion1 is the version of no-compact and no-downsample mark files supported by Thanos.
+const MarkVersion1 = 1
+
+// DeletionMark stores block id and when block was marked for deletion.
+type DeletionMark struct {
+	// ID of the tsdb block.
+	ID ulid.ULID `json:"id"`
+	// DeletionTime is a unix timestamp of when the block was marked to be deleted.
+	DeletionTime int64 `json:"deletion_time"`
+	// Version of the file.
+	Version int `json:"version"`
+	// Details is a human readable reason of the deletion.
+	Details string `json:"details,omitempty"`
+}
+
+// NoCompactReason is a reason for a block to be excluded from compaction.
+type NoCompactReason string
+
+const (
+	// ManualNoCompactReason is used when the block was excluded from compaction by the user for a reason
+	// not covered by the other reasons, which is explained in the details of the mark.
+	ManualNoCompactReason NoCompactReason = "manual"
+	// OutOfOrderChunksNoCompactReason is used for blocks whose index references out of order chunks.
+	// TSDB refuses to compact such blocks, so they would halt the compactor otherwise.
+	OutOfOrderChunksNoCompactReason NoCompactReason = "block-index-out-of-order-chunk"
+	// IndexSizeExceedingNoCompactReason is used for shards of compactions split because of the index size limit.
+	// Compacting them again would exceed the limit.
+	IndexSizeExceedingNoCompactReason NoCompactReason = "index-size-exceeding"
+	// HeadSnapshotNoCompactReason is used for head blocks uploaded from snapshots of Prometheus. They overlap with
+	// blocks persisted later by the same Prometheus server.
+	HeadSnapshotNoCompactReason NoCompactReason = "head-snapshot"
+)
+
+// NoCompactMark marks the block as excluded from compaction.
+type NoCompactMark struct {
+	// ID of the tsdb block.
+	ID ulid.ULID `json:"id"`
+	// NoCompactTime is a unix timestamp of when the block was marked for no compact.
+	NoCompactTime int64 `json:"no_compact_time"`
+	// Version of the file.
+	Version int `json:"version"`
+	// Reason is the reason of excluding the block from compaction.
+	Reason NoCompactReason `json:"reason"`
+	// Details is a human readable reason of the mark.
+	Details string `json:"details"`
+}
+
+// NoDownsampleMark marks the block as excluded from downsampling.
+type NoDownsampleMark struct {
+	// ID of the tsdb block.
+	ID ulid.ULID `json:"id"`
+	// NoDownsampleTime is a unix timestamp of when the block was marked for no downsample.
+	NoDownsampleTime int64 `json:"no_downsample_time"`
+	// Version of the file.
+	Version int `json:"version"`
+	// Details is a human readable reason of the mark.
+	Details string `json:"details"`
+}
+
+// ErrMarkNotFound is returned when the requested mark file does not exist.
+var ErrMarkNotFound = errors.New("mark not found")
+
+// ReadDeletionMark reads the deletion mark of the block. It returns ErrMarkNotFound if the block is not marked.
+func ReadDeletionMark(ctx context.Context, bkt objstore.BucketReader, id ulid.ULID) (*DeletionMark, error) {
+	var m DeletionMark
+	if err := readMark(ctx, bkt, id, DeletionMarkFilename, &m); err != nil {
+		return nil, err
+	}
+	if m.Version != DeletionMarkVersion1 {
+		return nil, errors.Errorf("unexpected deletion mark version %d for block %s", m.Version, id)
+	}
+	return &m, nil
+}
+
+// MarkForDeletion creates a file which stores information about when the block was marked for deletion.
+// Marking an already marked block is a no-op.
+func MarkForDeletion(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, details string) error {
+	return uploadMark(ctx, logger, bkt, id, DeletionMarkFilename, DeletionMark{
+		ID:           id,
+		DeletionTime: time.Now().Unix(),
+		Version:      DeletionMarkVersion1,
+		Details:      details,
+	})
+}
+
+// ReadNoCompactMark reads the no-compact mark of the block. It returns ErrMarkNotFound if the block is not marked.
+func ReadNoCompactMark(ctx context.Context, bkt objstore.BucketReader, id ulid.ULID) (*NoCompactMark, error) {
+	var m NoCompactMark
+	if err := readMark(ctx, bkt, id, NoCompactMarkFilename, &m); err != nil {
+		return nil, err
+	}
+	if m.Version != MarkVersion1 {
+		return nil, errors.Errorf("unexpected no-compact mark version %d for block %s", m.Version, id)
+	}
+	return &m, nil
+}
+
+// MarkForNoCompact creates a file which excludes the block from compaction for the given reason.
+// Marking an already marked block is a no-op.
+func MarkForNoCompact(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, reason NoCompactReason, details string) error {
+	return uploadMark(ctx, logger, bkt, id, NoCompactMarkFilename, NoCompactMark{
+		ID:            id,
+		NoCompactTime: time.Now().Unix(),
+		Version:       MarkVersion1,
+		Reason:        reason,
+		Details:       details,
+	})
+}
+
+// MarkForNoDownsample creates a file which excludes the block from downsampling.
+// Marking an already marked block is a no-op.
+func MarkForNoDownsample(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, details string) error {
+	return uploadMark(ctx, logger, bkt, id, NoDownsampleMarkFilename, NoDownsampleMark{
+		ID:               id,
+		NoDownsampleTime: time.Now().Unix(),
+		Version:          MarkVersion1,
+		Details:          details,
+	})
+}
+
+// RemoveMark removes the mark file with the given name from the block. Removing a missing mark is a no-op.
+func RemoveMark(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, markFilename string) error {
+	markFile := path.Join(id.String(), markFilename)
+
+	ok, err := bkt.Exists(ctx, markFile)
+	if err != nil {
+		return errors.Wrapf(err, "check exists %s in bucket", markFile)
+	}
+	if !ok {
+		level.Warn(logger).Log("msg", "requested to remove mark, but block is not marked", "block", id, "mark", markFilename)
+		return nil
+	}
+	if err := bkt.Delete(ctx, markFile); err != nil {
+		return errors.Wrapf(err, "delete file %s from bucket", markFile)
+	}
+	level.Info(logger).Log("msg", "mark has been removed from block", "block", id, "mark", markFilename)
+	return nil
+}
+
+func readMark(ctx context.Context, bkt objstore.BucketReader, id ulid.ULID, markFilename string, v interface{}) error {
+	markFile := path.Join(id.String(), markFilename)
+
+	ok, err := bkt.Exists(ctx, markFile)
+	if err != nil {
+		return errors.Wrapf(err, "check exists %s in bucket", markFile)
+	}
+	if !ok {
+		return ErrMarkNotFound
+	}
+
+	rc, err := bkt.Get(ctx, markFile)
+	if err != nil {
+		return errors.Wrapf(err, "get file %s", markFile)
+	}
+	defer rc.Close()
+
+	if err := json.NewDecoder(rc).Decode(v); err != nil {
+		return errors.Wrapf(err, "decode %s", markFile)
+	}
+	return nil
+}
+
+func uploadMark(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, markFilename string, mark interface{}) error {
+	markFile := path.Join(id.String(), markFilename)
+
+	ok, err := bkt.Exists(ctx, markFile)
+	if err != nil {
+		return errors.Wrapf(err, "check exists %s in bucket", markFile)
+	}
+	if ok {
+		level.Warn(logger).Log("msg", "requested to mark block, but mark already exists", "block", id, "mark", markFilename)
+		return nil
+	}
+
+	b, err := json.Marshal(mark)
+	if err != nil {
+		return errors.Wrapf(err, "json encode %s", markFilename)
+	}
+	if err := bkt.Upload(ctx, markFile, bytes.NewReader(b)); err != nil {
+		return errors.Wrapf(err, "upload file %s to bucket", markFile)
+	}
+	level.Info(logger).Log("msg", "block has been marked", "block", id, "mark", markFilename)
+	return nil
+}
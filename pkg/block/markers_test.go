@@ -0,0 +1,61 @@
+package block
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/oklog/ulid"
+)
+
+func TestMarkers(t *testing.T) {
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+	id := ulid.MustNew(1, nil)
+	markFile := path.Join(id.String(), NoCompactMarkFilename)
+
+	if _, err := ReadNoCompactMark(ctx, bkt, id); err != ErrMarkNotFound {
+		t.Fatalf("expected ErrMarkNotFound, got %v", err)
+	}
+	if err := MarkForNoCompact(ctx, log.NewNopLogger(), bkt, id, OutOfOrderChunksNoCompactReason, "broken index"); err != nil {
+		t.Fatal(err)
+	}
+	var m NoCompactMark
+	if err := json.Unmarshal(bkt.Objects()[markFile], &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.ID != id || m.Version != MarkVersion1 || m.Reason != OutOfOrderChunksNoCompactReason || m.Details != "broken index" {
+		t.Fatalf("unexpected mark %+v", m)
+	}
+	rm, err := ReadNoCompactMark(ctx, bkt, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *rm != m {
+		t.Fatalf("unexpected mark %+v", rm)
+	}
+
+	// Marking again must not override the existing mark.
+	if err := MarkForNoCompact(ctx, log.NewNopLogger(), bkt, id, ManualNoCompactReason, "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(bkt.Objects()[markFile], &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Details != "broken index" {
+		t.Fatalf("mark was overridden: %+v", m)
+	}
+
+	if err := RemoveMark(ctx, log.NewNopLogger(), bkt, id, NoCompactMarkFilename); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bkt.Objects()[markFile]; ok {
+		t.Fatal("mark was not removed")
+	}
+	if err := RemoveMark(ctx, log.NewNopLogger(), bkt, id, NoCompactMarkFilename); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,172 @@
+package block
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/pkg/errors"
+)
+
+// UploadStateFilename is the file in the block directory recording files already uploaded by UploadResumable.
+const UploadStateFilename = "upload-state.json"
+
+const (
+	// uploadStateVersion1 recorded the sizes of uploaded files only. Its files are uploaded again.
+	uploadStateVersion1 = 1
+	uploadStateVersion2 = 2
+)
+
+// uploadState records files of the block directory that were uploaded completely.
+type uploadState struct {
+	Version int `json:"version"`
+	// Files maps uploaded files, relative to the block directory, to their attributes at the time of the upload.
+	Files map[string]uploadedFile `json:"files"`
+}
+
+// uploadedFile holds the attributes of an uploaded file. A file whose attributes changed since was rewritten
+// and is uploaded again.
+type uploadedFile struct {
+	Size int64 `json:"size"`
+	// ModTime is the modification time of the file in nanoseconds since epoch.
+	ModTime int64 `json:"mod_time"`
+}
+
+func newUploadedFile(fi os.FileInfo) uploadedFile {
+	return uploadedFile{Size: fi.Size(), ModTime: fi.ModTime().UnixNano()}
+}
+
+func readUploadState(bdir string) (*uploadState, error) {
+	empty := &uploadState{Version: uploadStateVersion2, Files: map[string]uploadedFile{}}
+
+	b, err := ioutil.ReadFile(filepath.Join(bdir, UploadStateFilename))
+	if os.IsNotExist(err) {
+		return empty, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var v struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	switch v.Version {
+	case uploadStateVersion1:
+		return empty, nil
+	case uploadStateVersion2:
+	default:
+		return nil, errors.Errorf("unexpected upload state file version %d", v.Version)
+	}
+	var s uploadState
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	if s.Files == nil {
+		s.Files = map[string]uploadedFile{}
+	}
+	return &s, nil
+}
+
+func writeUploadState(bdir string, s *uploadState) error {
+	// Make any changes to the file appear atomic.
+	path := filepath.Join(bdir, UploadStateFilename)
+	tmp := path + ".tmp"
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(tmp, b, 0666); err != nil {
+		return err
+	}
+	return renameFile(tmp, path)
+}
+
+// UploadResumable uploads block from given block dir that ends with block id, like Upload. Files are recorded in the
+// upload state file of the block dir once they are uploaded. If the upload fails, the partial block is kept in the
+// bucket, so a retry only uploads chunk segments and the index that are missing or changed in size or modification
+// time since.
+// The meta file is always uploaded last, so the partial block is treated as a pending upload until it completes.
+// The state file is removed after the upload completed.
+// Failed files are retried with DefaultBackoff.
+func UploadResumable(ctx context.Context, bkt objstore.Bucket, bdir string) error {
+	return UploadResumableWithOptions(ctx, bkt, bdir, UploadOptions{Backoff: DefaultBackoff})
+}
+
+// UploadResumableWithOptions uploads block from given block dir like UploadResumable. Chunk segment files are uploaded
+// by opts.Concurrency workers. Each file is retried on its own as configured by opts.Backoff before the upload fails.
+func UploadResumableWithOptions(ctx context.Context, bkt objstore.Bucket, bdir string, opts UploadOptions) error {
+	id, err := prepareUploadDir(bdir)
+	if err != nil {
+		return err
+	}
+
+	state, err := readUploadState(bdir)
+	if err != nil {
+		return errors.Wrap(err, "read upload state")
+	}
+
+	chunks, err := ioutil.ReadDir(filepath.Join(bdir, ChunksDirname))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "read chunks dir")
+	}
+	var files []string
+	for _, fi := range chunks {
+		if !fi.IsDir() {
+			files = append(files, path.Join(ChunksDirname, fi.Name()))
+		}
+	}
+	sort.Strings(files)
+
+	// The state is shared by the concurrent uploads of chunk segments.
+	var mtx sync.Mutex
+	upload := func(ctx context.Context, f string) error {
+		fi, err := os.Stat(filepath.Join(bdir, filepath.FromSlash(f)))
+		if err != nil {
+			return errors.Wrapf(err, "stat %s", f)
+		}
+		mtx.Lock()
+		uploaded, ok := state.Files[f]
+		mtx.Unlock()
+		if ok && uploaded == newUploadedFile(fi) {
+			return nil
+		}
+		if err := uploadFile(ctx, bkt, filepath.Join(bdir, filepath.FromSlash(f)), path.Join(id.String(), f), opts); err != nil {
+			return errors.Wrapf(err, "upload %s", f)
+		}
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		state.Files[f] = newUploadedFile(fi)
+		return errors.Wrap(writeUploadState(bdir, state), "write upload state")
+	}
+	if err := uploadConcurrently(ctx, files, opts.Concurrency, upload); err != nil {
+		return err
+	}
+	if err := upload(ctx, IndexFilename); err != nil {
+		return err
+	}
+
+	if err := uploadFile(ctx, bkt, path.Join(bdir, MetaFilename), path.Join(DebugMetas, fmt.Sprintf("%s.json", id)), opts); err != nil {
+		return errors.Wrap(err, "upload meta file to debug dir")
+	}
+	// Meta.json always need to be uploaded as a last item. This will allow to assume block directories without meta file
+	// to be pending uploads.
+	if err := uploadFile(ctx, bkt, path.Join(bdir, MetaFilename), path.Join(id.String(), MetaFilename), opts); err != nil {
+		return errors.Wrap(err, "upload meta file")
+	}
+
+	if err := os.Remove(filepath.Join(bdir, UploadStateFilename)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "remove upload state")
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package block
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/tsdb"
+)
+
+// failingUploadBucket fails uploads of the object with the given name and records all uploaded objects.
+type failingUploadBucket struct {
+	objstore.Bucket
+
+	fail     string
+	uploaded []string
+}
+
+func (b *failingUploadBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if name == b.fail {
+		return errors.Errorf("failed upload of %s", name)
+	}
+	b.uploaded = append(b.uploaded, name)
+	return b.Bucket.Upload(ctx, name, r)
+}
+
+func TestUploadResumable(t *testing.T) {
+	ctx := context.Background()
+	id := ulid.MustNew(1, nil)
+
+	dir, err := ioutil.TempDir("", "test-upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bdir := filepath.Join(dir, id.String())
+	if err := os.MkdirAll(filepath.Join(bdir, ChunksDirname), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"chunks/000001", "chunks/000002", "chunks/000003", IndexFilename} {
+		if err := ioutil.WriteFile(filepath.Join(bdir, f), []byte(f), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	meta := &Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: id}}
+	meta.Thanos.Labels = map[string]string{"ext": "1"}
+	if err := WriteMetaFile(bdir, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	bkt := &failingUploadBucket{Bucket: inmem.NewBucket(), fail: path.Join(id.String(), "chunks/000003")}
+	if err := UploadResumable(ctx, bkt, bdir); err == nil {
+		t.Fatal("expected upload to fail")
+	}
+	if ok, _ := bkt.Exists(ctx, path.Join(id.String(), MetaFilename)); ok {
+		t.Fatal("meta file of partial block uploaded")
+	}
+	state, err := readUploadState(bdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Files) != 2 {
+		t.Fatalf("unexpected upload state %v", state.Files)
+	}
+
+	// A file rewritten with the same size is detected by its modification time.
+	rewritten := filepath.Join(bdir, "chunks/000001")
+	if err := ioutil.WriteFile(rewritten, []byte("chunks/00000x"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(rewritten, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	// The retry only uploads files missing in the bucket or changed since.
+	bkt.fail = ""
+	bkt.uploaded = nil
+	if err := UploadResumable(ctx, bkt, bdir); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		path.Join(id.String(), "chunks/000001"),
+		path.Join(id.String(), "chunks/000003"),
+		path.Join(id.String(), IndexFilename),
+		path.Join(DebugMetas, id.String()+".json"),
+		path.Join(id.String(), MetaFilename),
+	}
+	if len(bkt.uploaded) != len(exp) {
+		t.Fatalf("unexpected uploads %v", bkt.uploaded)
+	}
+	for i := range exp {
+		if bkt.uploaded[i] != exp[i] {
+			t.Fatalf("unexpected uploads %v", bkt.uploaded)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(bdir, UploadStateFilename)); !os.IsNotExist(err) {
+		t.Fatalf("expected upload state to be removed, got %v", err)
+	}
+}
+
+func TestUploadResumableWithOptions_Concurrency(t *testing.T) {
+	ctx := context.Background()
+	id := ulid.MustNew(1, nil)
+
+	dir, err := ioutil.TempDir("", "test-upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bdir := filepath.Join(dir, id.String())
+	if err := os.MkdirAll(filepath.Join(bdir, ChunksDirname), 0777); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{"chunks/000001", "chunks/000002", "chunks/000003", "chunks/000004", IndexFilename}
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(bdir, f), []byte(f), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	meta := &Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: id}}
+	meta.Thanos.Labels = map[string]string{"ext": "1"}
+	if err := WriteMetaFile(bdir, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	bkt := inmem.NewBucket()
+	if err := UploadResumableWithOptions(ctx, bkt, bdir, UploadOptions{Concurrency: 3}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range append(files, MetaFilename) {
+		if ok, err := bkt.Exists(ctx, path.Join(id.String(), f)); err != nil || !ok {
+			t.Fatalf("expected %s to be uploaded: %v", f, err)
+		}
+	}
+}
+
+func TestReadUploadState_Version1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-upload-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Files recorded by their size only are uploaded again.
+	if err := ioutil.WriteFile(filepath.Join(dir, UploadStateFilename), []byte(`{"version":1,"files":{"index":5}}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	state, err := readUploadState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Version != uploadStateVersion2 || len(state.Files) != 0 {
+		t.Fatalf("unexpected upload state %v", state)
+	}
+}
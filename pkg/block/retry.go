@@ -0,0 +1,61 @@
+package block
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+)
+
+// Backoff configures how failed operations on single bucket objects are retried. Only transient network errors are
+// retried, see objstore.IsTransientErr, and only if the bucket did not retry them already.
+type Backoff struct {
+	// MaxRetries is the number of times a failed operation is retried. Zero disables retries.
+	MaxRetries int
+	// MinBackoff is the time waited before the first retry. It doubles with every retry up to MaxBackoff.
+	MinBackoff time.Duration
+	// MaxBackoff caps the time waited between retries. Zero means no cap.
+	MaxBackoff time.Duration
+	// Jitter randomizes every wait by up to the given fraction of it, e.g. 0.2 for +-20%. It avoids retries of
+	// concurrent operations hitting the bucket at the same time.
+	Jitter float64
+}
+
+// DefaultBackoff is used by Upload, Download and DownloadMeta. It rides over short network failures, e.g. connections
+// reset while reading an object, which a bucket of objstore.BucketWithRetries cannot retry, without delaying failures
+// by minutes.
+var DefaultBackoff = Backoff{
+	MaxRetries: 3,
+	MinBackoff: time.Second,
+	MaxBackoff: 10 * time.Second,
+	Jitter:     0.2,
+}
+
+// retry calls f until it succeeds, fails with an error that is not retried, the retries are exhausted or the context
+// is canceled. It returns the last error of f.
+func (b Backoff) retry(ctx context.Context, f func() error) error {
+	wait := b.MinBackoff
+	for i := 0; ; i++ {
+		err := f()
+		if err == nil || i >= b.MaxRetries || !objstore.IsTransientErr(err) || objstore.IsRetriedErr(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(b.jitter(wait)):
+		}
+		wait *= 2
+		if b.MaxBackoff > 0 && wait > b.MaxBackoff {
+			wait = b.MaxBackoff
+		}
+	}
+}
+
+func (b Backoff) jitter(d time.Duration) time.Duration {
+	if b.Jitter <= 0 || d <= 0 {
+		return d
+	}
+	return d + time.Duration(b.Jitter*(2*rand.Float64()-1)*float64(d))
+}
@@ -0,0 +1,172 @@
+package block
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/tsdb"
+)
+
+func TestBackoff_Retry(t *testing.T) {
+	ctx := context.Background()
+	b := Backoff{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, Jitter: 0.5}
+
+	calls := 0
+	err := b.retry(ctx, func() error {
+		calls++
+		return errors.Wrap(io.ErrUnexpectedEOF, "fail")
+	})
+	if err == nil || calls != 3 {
+		t.Fatalf("expected 3 failed calls, got %d: %v", calls, err)
+	}
+
+	calls = 0
+	err = b.retry(ctx, func() error {
+		calls++
+		if calls < 3 {
+			return errors.Wrap(io.ErrUnexpectedEOF, "fail")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("expected success after 3 calls, got %d: %v", calls, err)
+	}
+
+	// Errors that are not transient are not retried.
+	calls = 0
+	if err := b.retry(ctx, func() error {
+		calls++
+		return errors.New("fail")
+	}); err == nil || calls != 1 {
+		t.Fatalf("expected 1 failed call, got %d: %v", calls, err)
+	}
+
+	// Canceled contexts stop retries.
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	calls = 0
+	if err := (Backoff{MaxRetries: 5, MinBackoff: time.Hour}).retry(cctx, func() error {
+		calls++
+		return errors.Wrap(io.ErrUnexpectedEOF, "fail")
+	}); err == nil || calls != 1 {
+		t.Fatalf("expected 1 failed call, got %d: %v", calls, err)
+	}
+}
+
+// countingBucket fails every Get with a transient error and counts the calls.
+type countingBucket struct {
+	objstore.Bucket
+
+	gets int
+}
+
+func (b *countingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	b.gets++
+	return nil, errors.Wrapf(io.ErrUnexpectedEOF, "get %s", name)
+}
+
+func TestBackoff_RetriedByBucket(t *testing.T) {
+	cbkt := &countingBucket{Bucket: inmem.NewBucket()}
+	bkt := objstore.BucketWithRetries(cbkt, objstore.IsTransientErr, objstore.RetryConfig{MaxRetries: 1, MinBackoff: time.Millisecond})
+
+	// Errors retried by the bucket are not retried again.
+	_, err := DownloadMetaWithOptions(context.Background(), bkt, ulid.MustNew(1, nil), DownloadOptions{
+		Backoff: Backoff{MaxRetries: 3, MinBackoff: time.Millisecond},
+	})
+	if err == nil || cbkt.gets != 2 {
+		t.Fatalf("expected 2 failed gets, got %d: %v", cbkt.gets, err)
+	}
+}
+
+// flakyUploadBucket fails the first upload of every object and records successful uploads in order.
+type flakyUploadBucket struct {
+	objstore.Bucket
+
+	mtx      sync.Mutex
+	failed   map[string]bool
+	uploaded []string
+}
+
+func (b *flakyUploadBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if !b.failed[name] {
+		b.failed[name] = true
+		return errors.Wrapf(io.ErrUnexpectedEOF, "flaky upload %s", name)
+	}
+	b.uploaded = append(b.uploaded, name)
+	return b.Bucket.Upload(ctx, name, r)
+}
+
+func TestUploadWithOptions(t *testing.T) {
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+	id := ulid.MustNew(1, nil)
+
+	dir, err := ioutil.TempDir("", "test-upload-retries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bdir := filepath.Join(dir, id.String())
+	if err := os.MkdirAll(filepath.Join(bdir, ChunksDirname), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"chunks/000001", "chunks/000002", "chunks/000003", IndexFilename} {
+		if err := ioutil.WriteFile(filepath.Join(bdir, f), []byte(f), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	meta := &Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: id}}
+	meta.Thanos.Labels = map[string]string{"ext": "1"}
+	if err := WriteMetaFile(bdir, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every file fails once, so the upload only succeeds with retries.
+	if err := UploadWithOptions(ctx, &flakyUploadBucket{Bucket: bkt, failed: map[string]bool{}}, bdir, UploadOptions{}); err == nil {
+		t.Fatal("expected error without retries")
+	}
+	fbkt := &flakyUploadBucket{Bucket: bkt, failed: map[string]bool{}}
+	if err := UploadWithOptions(ctx, fbkt, bdir, UploadOptions{
+		Concurrency: 2,
+		Backoff:     Backoff{MaxRetries: 1, MinBackoff: time.Millisecond},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Meta file goes last, also with concurrent chunk uploads.
+	if n := len(fbkt.uploaded); n != 6 || fbkt.uploaded[n-1] != path.Join(id.String(), MetaFilename) {
+		t.Fatalf("unexpected uploads %v", fbkt.uploaded)
+	}
+	for _, f := range []string{"chunks/000001", "chunks/000002", "chunks/000003", IndexFilename, MetaFilename} {
+		if ok, err := bkt.Exists(ctx, path.Join(id.String(), f)); err != nil || !ok {
+			t.Fatalf("expected %s to be uploaded: %v", f, err)
+		}
+	}
+
+	if _, err := DownloadMetaWithOptions(ctx, &flakyBucket{Bucket: bkt, failed: map[string]bool{}}, id, DownloadOptions{}); err == nil {
+		t.Fatal("expected error without retries")
+	}
+	m, err := DownloadMetaWithOptions(ctx, &flakyBucket{Bucket: bkt, failed: map[string]bool{}}, id, DownloadOptions{
+		Backoff: Backoff{MaxRetries: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ULID != id {
+		t.Fatalf("unexpected meta %v", m)
+	}
+}
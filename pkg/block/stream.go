@@ -0,0 +1,330 @@
+package block
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/tsdb/chunks"
+)
+
+// StreamUploader uploads the files of a block to the bucket while they are written, without materializing
+// the block in a local directory first. This allows e.g. to pipe the output of a block writer straight into
+// the bucket, so large blocks do not need twice their size of local disk.
+//
+// Same as for Upload, the meta file is uploaded last by Finish, so the block is treated as a pending upload until then.
+type StreamUploader struct {
+	ctx context.Context
+	bkt objstore.Bucket
+	id  ulid.ULID
+
+	mtx   sync.Mutex
+	files []File
+	err   error
+}
+
+// NewStreamUploader returns an uploader for the files of the block with the given ID.
+func NewStreamUploader(ctx context.Context, bkt objstore.Bucket, id ulid.ULID) *StreamUploader {
+	return &StreamUploader{ctx: ctx, bkt: bkt, id: id}
+}
+
+// Create returns a writer for the block file at relPath, e.g. "index" or "chunks/000001". Written data is piped
+// into the bucket upload of the file. Close must be called after the last write and returns the result of the upload.
+// Different files may be written concurrently.
+func (u *StreamUploader) Create(relPath string) (io.WriteCloser, error) {
+	if relPath != IndexFilename && path.Dir(relPath) != ChunksDirname {
+		return nil, errors.Errorf("%s is not a block index or chunk segment file", relPath)
+	}
+
+	pr, pw := io.Pipe()
+	w := &streamFile{
+		u:       u,
+		relPath: relPath,
+		pw:      pw,
+		h:       sha256.New(),
+		done:    make(chan error, 1),
+	}
+	go func() {
+		err := u.bkt.Upload(u.ctx, path.Join(u.id.String(), relPath), pr)
+		// Unblock pending writes if the upload returned before consuming all data.
+		if err != nil {
+			pr.CloseWithError(err)
+		} else {
+			pr.CloseWithError(io.ErrClosedPipe)
+		}
+		w.done <- err
+	}()
+	return w, nil
+}
+
+type streamFile struct {
+	u       *StreamUploader
+	relPath string
+
+	pw   *io.PipeWriter
+	h    hash.Hash
+	n    int64
+	err  error
+	done chan error
+}
+
+func (f *streamFile) Write(b []byte) (int, error) {
+	n, err := f.pw.Write(b)
+	f.h.Write(b[:n])
+	f.n += int64(n)
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+	return n, err
+}
+
+func (f *streamFile) Close() error {
+	if f.err != nil {
+		// Fail the upload instead of storing a truncated file.
+		f.pw.CloseWithError(f.err)
+		<-f.done
+		return f.u.setErr(errors.Wrapf(f.err, "write %s", f.relPath))
+	}
+	f.pw.Close()
+	if err := <-f.done; err != nil {
+		return f.u.setErr(errors.Wrapf(err, "upload %s", f.relPath))
+	}
+
+	f.u.mtx.Lock()
+	defer f.u.mtx.Unlock()
+
+	f.u.files = append(f.u.files, File{
+		RelPath:   f.relPath,
+		SizeBytes: f.n,
+		SHA256:    hex.EncodeToString(f.h.Sum(nil)),
+	})
+	return nil
+}
+
+func (u *StreamUploader) setErr(err error) error {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	if u.err == nil {
+		u.err = err
+	}
+	return err
+}
+
+// Finish uploads the meta file of the block, completing the upload. The descriptions of all streamed files are
+// added to the meta. If any file failed to upload or the meta is invalid, the partial block is deleted from the bucket.
+func (u *StreamUploader) Finish(meta *Meta) error {
+	u.mtx.Lock()
+	err := u.err
+	files := append([]File{}, u.files...)
+	u.mtx.Unlock()
+
+	if err != nil {
+		return cleanUp(u.bkt, u.id, err)
+	}
+	if meta.ULID != u.id {
+		return cleanUp(u.bkt, u.id, errors.Errorf("meta is for block %s, expected %s", meta.ULID, u.id))
+	}
+	if len(meta.Thanos.Labels) == 0 {
+		return cleanUp(u.bkt, u.id, errors.New("empty external labels are not allowed for Thanos block."))
+	}
+	hasIndex := false
+	for _, f := range files {
+		if f.RelPath == IndexFilename {
+			hasIndex = true
+		}
+	}
+	if !hasIndex {
+		return cleanUp(u.bkt, u.id, errors.New("no index file uploaded"))
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].RelPath < files[j].RelPath })
+	meta.Thanos.SetFiles(files)
+
+	b, err := json.MarshalIndent(meta, "", "\t")
+	if err != nil {
+		return cleanUp(u.bkt, u.id, errors.Wrap(err, "encode meta"))
+	}
+	if err := u.bkt.Upload(u.ctx, path.Join(DebugMetas, fmt.Sprintf("%s.json", u.id)), bytes.NewReader(b)); err != nil {
+		return cleanUp(u.bkt, u.id, errors.Wrap(err, "upload meta file to debug dir"))
+	}
+	// Meta.json always need to be uploaded as a last item.
+	if err := u.bkt.Upload(u.ctx, path.Join(u.id.String(), MetaFilename), bytes.NewReader(b)); err != nil {
+		return cleanUp(u.bkt, u.id, errors.Wrap(err, "upload meta file"))
+	}
+	return nil
+}
+
+// Abort deletes all files of the block uploaded so far. It must be called instead of Finish if not all files
+// of the block could be written, after all writers were closed.
+func (u *StreamUploader) Abort() error {
+	return Delete(context.Background(), u.bkt, u.id)
+}
+
+// Err returns the first error of the uploads of files written so far.
+func (u *StreamUploader) Err() error {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	return u.err
+}
+
+// ID returns the ID of the block uploaded.
+func (u *StreamUploader) ID() ulid.ULID {
+	return u.id
+}
+
+// UploadFile streams the local file fn into the block file at relPath, e.g. an index written to local disk.
+func (u *StreamUploader) UploadFile(relPath string, fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", fn)
+	}
+	defer f.Close()
+
+	w, err := u.Create(relPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		w.Close()
+		return errors.Wrapf(err, "copy %s", fn)
+	}
+	return w.Close()
+}
+
+const (
+	// chunksMagic and chunksFormatV1 start the header of chunk segment files written by TSDB.
+	chunksMagic    = 0x85BD40DD
+	chunksFormatV1 = 1
+	// chunkSegmentHeaderSize is the size of the header, including padding, of chunk segment files written by TSDB.
+	chunkSegmentHeaderSize = 8
+	// chunkSegmentSize is the size at which TSDB cuts a new chunk segment file.
+	chunkSegmentSize = 512 * 1024 * 1024
+)
+
+// streamChunkWriter writes chunks in the segment file format of TSDB into files created by a StreamUploader,
+// so chunks of a block written e.g. by a compaction are uploaded without being stored on local disk.
+type streamChunkWriter struct {
+	u           *StreamUploader
+	segmentSize int64
+
+	// seq is the sequence number of the current segment, which TSDB uses as upper half of chunk references.
+	seq int
+	f   io.WriteCloser
+	w   *bufio.Writer
+	n   int64
+
+	buf [binary.MaxVarintLen32]byte
+	crc hash.Hash32
+}
+
+func newStreamChunkWriter(u *StreamUploader) *streamChunkWriter {
+	return &streamChunkWriter{
+		u:           u,
+		segmentSize: chunkSegmentSize,
+		seq:         -1,
+		crc:         crc32.New(castagnoli),
+	}
+}
+
+// WriteChunks writes the chunks and sets their references, like the chunk writer of TSDB.
+func (w *streamChunkWriter) WriteChunks(chks ...chunks.Meta) error {
+	// Chunks written at once are kept in the same segment unless they exceed the segment size on their own.
+	maxLen := int64(binary.MaxVarintLen32)
+	for _, c := range chks {
+		maxLen += binary.MaxVarintLen32 + 1 + int64(len(c.Chunk.Bytes())) + crc32.Size
+	}
+	if w.f == nil || w.n > w.segmentSize || w.n+maxLen > w.segmentSize && maxLen <= w.segmentSize {
+		if err := w.cut(); err != nil {
+			return err
+		}
+	}
+
+	seq := uint64(w.seq) << 32
+	for i := range chks {
+		chk := &chks[i]
+		chk.Ref = seq | uint64(w.n)
+
+		n := binary.PutUvarint(w.buf[:], uint64(len(chk.Chunk.Bytes())))
+		if err := w.write(w.buf[:n]); err != nil {
+			return err
+		}
+		w.buf[0] = byte(chk.Chunk.Encoding())
+		if err := w.write(w.buf[:1]); err != nil {
+			return err
+		}
+		if err := w.write(chk.Chunk.Bytes()); err != nil {
+			return err
+		}
+
+		w.crc.Reset()
+		w.crc.Write(w.buf[:1])
+		w.crc.Write(chk.Chunk.Bytes())
+		if err := w.write(w.crc.Sum(w.buf[:0])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *streamChunkWriter) write(b []byte) error {
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	return err
+}
+
+// cut completes the current segment and starts the next one.
+func (w *streamChunkWriter) cut() error {
+	if err := w.finishSegment(); err != nil {
+		return err
+	}
+	w.seq++
+
+	f, err := w.u.Create(path.Join(ChunksDirname, fmt.Sprintf("%0.6d", w.seq+1)))
+	if err != nil {
+		return err
+	}
+	w.f = f
+	w.w = bufio.NewWriterSize(f, 8*1024*1024)
+
+	var header [chunkSegmentHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:4], chunksMagic)
+	header[4] = chunksFormatV1
+	w.n = 0
+	return w.write(header[:])
+}
+
+func (w *streamChunkWriter) finishSegment() error {
+	if w.f == nil {
+		return nil
+	}
+	f := w.f
+	w.f = nil
+
+	if err := w.w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Close completes the upload of the last segment. It returns the error of its upload.
+func (w *streamChunkWriter) Close() error {
+	return w.finishSegment()
+}
@@ -0,0 +1,152 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/tsdb"
+	"github.com/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/tsdb/chunks"
+)
+
+func TestStreamUploader(t *testing.T) {
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+	id := ulid.MustNew(1, nil)
+
+	dir, err := ioutil.TempDir("", "test-stream-upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	u := NewStreamUploader(ctx, bkt, id)
+	if _, err := u.Create("tombstones"); err == nil {
+		t.Fatal("expected error for non-block file")
+	}
+	for _, f := range []string{"chunks/000001", "chunks/000002", IndexFilename} {
+		w, err := u.Create(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, f); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ok, _ := bkt.Exists(ctx, path.Join(id.String(), MetaFilename)); ok {
+		t.Fatal("meta file uploaded before finish")
+	}
+
+	meta := &Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: id}}
+	meta.Thanos.Labels = map[string]string{"ext": "1"}
+	if err := u.Finish(meta); err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Thanos.Files) != 3 || meta.Thanos.Files[0].RelPath != "chunks/000001" || meta.Thanos.Files[2].RelPath != IndexFilename {
+		t.Fatalf("unexpected files %v", meta.Thanos.Files)
+	}
+	if chks, ok := meta.Thanos.ChunkFiles(); !ok || len(chks) != 2 {
+		t.Fatalf("unexpected chunk files %v", chks)
+	}
+
+	// The downloaded block is verified against the file descriptions gathered while streaming.
+	if err := Download(ctx, bkt, id, filepath.Join(dir, id.String())); err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks without index are not finished.
+	id2 := ulid.MustNew(2, nil)
+	u = NewStreamUploader(ctx, bkt, id2)
+	w, err := u.Create("chunks/000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta.ULID = id2
+	if err := u.Finish(meta); err == nil {
+		t.Fatal("expected finish without index to fail")
+	}
+	if ok, _ := bkt.Exists(ctx, path.Join(id2.String(), "chunks/000001")); ok {
+		t.Fatal("expected partial block to be deleted")
+	}
+}
+
+func TestStreamChunkWriter(t *testing.T) {
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+	id := ulid.MustNew(1, nil)
+
+	dir, err := ioutil.TempDir("", "test-stream-chunks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var chks []chunks.Meta
+	for i := 0; i < 10; i++ {
+		c := chunkenc.NewXORChunk()
+		app, err := c.Appender()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 10; j++ {
+			app.Append(int64(i*10+j), float64(i))
+		}
+		chks = append(chks, chunks.Meta{Chunk: c})
+	}
+
+	u := NewStreamUploader(ctx, bkt, id)
+	w := newStreamChunkWriter(u)
+	// Cut a new segment every few chunks.
+	w.segmentSize = 200
+	for i := range chks {
+		if err := w.WriteChunks(chks[i : i+1]...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w.seq < 1 {
+		t.Fatalf("expected several segments, got %d", w.seq+1)
+	}
+
+	// Segments are readable by TSDB.
+	for name, b := range bkt.Objects() {
+		fn := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fn), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fn, b, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := chunks.NewDirReader(filepath.Join(dir, id.String(), ChunksDirname), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for i, c := range chks {
+		got, err := r.Chunk(c.Ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), c.Chunk.Bytes()) {
+			t.Fatalf("unexpected chunk %d", i)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package block
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	promlabels "github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/tsdb"
+	"github.com/prometheus/tsdb/chunks"
+	"github.com/prometheus/tsdb/index"
+	"github.com/prometheus/tsdb/labels"
+)
+
+// StreamedBlockWriter writes series into the index and chunk files of a new block as they are added.
+// Only the postings and label values are kept in memory until the block is finished, as they are
+// written after all series.
+type StreamedBlockWriter struct {
+	chunkw tsdb.ChunkWriter
+	indexw tsdb.IndexWriter
+
+	postings *index.MemPostings
+	values   map[string]map[string]struct{}
+	ref      uint64
+	stats    tsdb.BlockStats
+	closed   bool
+}
+
+// NewStreamedBlockWriter creates the index and chunk files of a new block in dir. All label names and values of the
+// added series must be part of the given symbols.
+func NewStreamedBlockWriter(dir string, symbols map[string]struct{}) (*StreamedBlockWriter, error) {
+	chunkw, err := chunks.NewWriter(filepath.Join(dir, ChunksDirname))
+	if err != nil {
+		return nil, errors.Wrap(err, "open chunk writer")
+	}
+	indexw, err := index.NewWriter(filepath.Join(dir, IndexFilename))
+	if err != nil {
+		chunkw.Close()
+		return nil, errors.Wrap(err, "open index writer")
+	}
+	w := &StreamedBlockWriter{
+		chunkw:   chunkw,
+		indexw:   indexw,
+		postings: index.NewMemPostings(),
+		values:   map[string]map[string]struct{}{},
+	}
+	if err := indexw.AddSymbols(symbols); err != nil {
+		w.Close()
+		return nil, errors.Wrap(err, "add symbols")
+	}
+	return w, nil
+}
+
+// AddSeries writes the chunks and the index entry of a series. Series must be added in the order of their label sets.
+// Series without chunks are skipped.
+func (w *StreamedBlockWriter) AddSeries(lset labels.Labels, chks []chunks.Meta) error {
+	if len(chks) == 0 {
+		return nil
+	}
+	if err := w.chunkw.WriteChunks(chks...); err != nil {
+		return errors.Wrap(err, "write chunks")
+	}
+	if err := w.indexw.AddSeries(w.ref, lset, chks...); err != nil {
+		return errors.Wrap(err, "add series")
+	}
+
+	w.stats.NumSeries++
+	w.stats.NumChunks += uint64(len(chks))
+	for _, c := range chks {
+		w.stats.NumSamples += uint64(c.Chunk.NumSamples())
+	}
+	for _, l := range lset {
+		vals, ok := w.values[l.Name]
+		if !ok {
+			vals = map[string]struct{}{}
+			w.values[l.Name] = vals
+		}
+		vals[l.Value] = struct{}{}
+	}
+	w.postings.Add(w.ref, lset)
+	w.ref++
+	return nil
+}
+
+// Stats returns the statistics of the series added so far.
+func (w *StreamedBlockWriter) Stats() tsdb.BlockStats {
+	return w.stats
+}
+
+// Finish writes the label indexes and postings and closes the files of the block.
+func (w *StreamedBlockWriter) Finish() error {
+	names := make([]string, 0, len(w.values))
+	for n := range w.values {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		vals := make([]string, 0, len(w.values[n]))
+		for v := range w.values[n] {
+			vals = append(vals, v)
+		}
+		if err := w.indexw.WriteLabelIndex([]string{n}, vals); err != nil {
+			return errors.Wrap(err, "write label index")
+		}
+	}
+	for _, l := range w.postings.SortedKeys() {
+		if err := w.indexw.WritePostings(l.Name, l.Value, w.postings.Get(l.Name, l.Value)); err != nil {
+			return errors.Wrap(err, "write postings")
+		}
+	}
+
+	w.closed = true
+	if err := w.chunkw.Close(); err != nil {
+		w.indexw.Close()
+		return errors.Wrap(err, "close chunk writer")
+	}
+	return errors.Wrap(w.indexw.Close(), "close index writer")
+}
+
+// Close closes the files of an unfinished block.
+func (w *StreamedBlockWriter) Close() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	w.chunkw.Close()
+	w.indexw.Close()
+}
+
+// LabelsPromToTSDB converts Prometheus labels, e.g. parsed or relabeled ones, into the labels series are written with.
+func LabelsPromToTSDB(lset promlabels.Labels) labels.Labels {
+	res := make(labels.Labels, 0, len(lset))
+	for _, l := range lset {
+		res = append(res, labels.Label{Name: l.Name, Value: l.Value})
+	}
+	return res
+}
@@ -0,0 +1,90 @@
+package block
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/tsdb"
+	"github.com/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/tsdb/chunks"
+	"github.com/prometheus/tsdb/labels"
+)
+
+func TestStreamedBlockWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-streamed-block-writer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	id := ulid.MustNew(1, nil)
+	bdir := filepath.Join(dir, id.String())
+
+	w, err := NewStreamedBlockWriter(bdir, map[string]struct{}{"a": {}, "1": {}, "2": {}, "b": {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, lset := range []labels.Labels{
+		labels.FromStrings("a", "1"),
+		labels.FromStrings("a", "2"),
+		labels.FromStrings("a", "2", "b", "1"),
+	} {
+		chk := chunkenc.NewXORChunk()
+		app, err := chk.Appender()
+		if err != nil {
+			t.Fatal(err)
+		}
+		app.Append(10, 1)
+		app.Append(20, 2)
+		if err := w.AddSeries(lset, []chunks.Meta{{MinTime: 10, MaxTime: 20, Chunk: chk}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Series without chunks are skipped.
+	if err := w.AddSeries(labels.FromStrings("b", "2"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if s := w.Stats(); s.NumSeries != 3 || s.NumChunks != 3 || s.NumSamples != 6 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	meta := &Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: 0, MaxTime: 100, Stats: w.Stats()}}
+	if err := WriteMetaFile(bdir, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := tsdb.OpenBlock(bdir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	q, err := tsdb.NewBlockQuerier(b, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	ss, err := q.Select(labels.NewEqualMatcher("a", "2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for ss.Next() {
+		got = append(got, ss.At().Labels().String())
+	}
+	if ss.Err() != nil {
+		t.Fatal(ss.Err())
+	}
+	if len(got) != 2 || got[0] != `{a="2"}` || got[1] != `{a="2",b="1"}` {
+		t.Fatalf("unexpected series %v", got)
+	}
+}
@@ -0,0 +1,219 @@
+package compact
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+)
+
+// CleanupStats summarizes the work done by Cleanup.
+type CleanupStats struct {
+	// DeletedBlocks is the number of blocks deleted because their deletion mark was past the delete delay.
+	DeletedBlocks int
+	// PendingDeletions is the number of marked blocks whose delete delay did not pass yet.
+	PendingDeletions int
+	// PartialUploads is the number of deleted blocks without meta file older than the partial upload threshold.
+	PartialUploads int
+	// DeletedObjects is the number of objects removed from the bucket.
+	DeletedObjects int
+	// DeletedBytes is the total size of the objects removed from the bucket.
+	DeletedBytes int64
+}
+
+// Cleanup deletes blocks marked for deletion longer than deleteDelay ago and blocks without meta file created and
+// last modified more than partialUploadThreshold ago. The latter are leftovers of aborted uploads.
+// A zero partialUploadThreshold disables the deletion of partial uploads.
+// If backupBkt is not nil, blocks are copied into it before they are deleted.
+// With dryRun set, blocks are only reported but not deleted.
+func Cleanup(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.Bucket,
+	backupBkt objstore.Bucket,
+	deleteDelay time.Duration,
+	partialUploadThreshold time.Duration,
+	dryRun bool,
+) (stats CleanupStats, err error) {
+	// A single recursive listing finds all blocks together with their meta files and deletion marks, so only
+	// existing marks are downloaded.
+	type blockFiles struct {
+		meta, mark   bool
+		lastModified time.Time
+	}
+	var (
+		ids    []ulid.ULID
+		blocks = map[ulid.ULID]*blockFiles{}
+	)
+	err = bkt.IterWithAttributes(ctx, "", func(name string, attrs objstore.ObjectAttributes) error {
+		parts := strings.SplitN(name, objstore.DirDelim, 2)
+		id, ok := block.IsBlockDir(parts[0])
+		if !ok {
+			return nil
+		}
+		files, ok := blocks[id]
+		if !ok {
+			files = &blockFiles{}
+			blocks[id] = files
+			ids = append(ids, id)
+		}
+		if attrs.LastModified.After(files.lastModified) {
+			files.lastModified = attrs.LastModified
+		}
+		if len(parts) == 2 {
+			switch parts[1] {
+			case block.MetaFilename:
+				files.meta = true
+			case block.DeletionMarkFilename:
+				files.mark = true
+			}
+		}
+		return nil
+	}, objstore.WithRecursiveIter())
+	if err != nil {
+		return stats, errors.Wrap(err, "iterate bucket")
+	}
+
+	for _, id := range ids {
+		var (
+			m   *block.DeletionMark
+			err = block.ErrMarkNotFound
+		)
+		if blocks[id].mark {
+			m, err = block.ReadDeletionMark(ctx, bkt, id)
+		}
+		if err != nil && err != block.ErrMarkNotFound {
+			if deletedConcurrently(ctx, bkt, path.Join(id.String(), block.DeletionMarkFilename)) {
+				continue
+			}
+			return stats, errors.Wrapf(err, "read deletion mark for %s", id)
+		}
+		if err == nil {
+			if time.Since(time.Unix(m.DeletionTime, 0)) < deleteDelay {
+				stats.PendingDeletions++
+				continue
+			}
+			level.Info(logger).Log("msg", "deleting block marked for deletion", "id", id, "details", m.Details, "dryRun", dryRun)
+
+			n, size, err := backupAndDeleteBlock(ctx, logger, bkt, backupBkt, id, "cleanup: "+m.Details, dryRun)
+			if err != nil {
+				return stats, errors.Wrapf(err, "delete block %s", id)
+			}
+			stats.DeletedBlocks++
+			stats.DeletedObjects += n
+			stats.DeletedBytes += size
+			continue
+		}
+
+		if partialUploadThreshold == 0 {
+			continue
+		}
+		if blocks[id].meta {
+			continue
+		}
+		// ULIDs contain the creation time of the block, which no upload of it can precede. Uploads in progress keep
+		// adding objects, so blocks created long before they are uploaded must additionally not have been modified
+		// recently to be considered aborted. Not all buckets report modification times.
+		if ulid.Now()-id.Time() < uint64(partialUploadThreshold/time.Millisecond) {
+			continue
+		}
+		if lm := blocks[id].lastModified; !lm.IsZero() && time.Since(lm) < partialUploadThreshold {
+			continue
+		}
+		level.Info(logger).Log("msg", "deleting aborted partial upload", "id", id, "dryRun", dryRun)
+
+		n, size, err := backupAndDeleteBlock(ctx, logger, bkt, backupBkt, id, "cleanup: aborted partial upload", dryRun)
+		if err != nil {
+			return stats, errors.Wrapf(err, "delete partial upload %s", id)
+		}
+		stats.PartialUploads++
+		stats.DeletedObjects += n
+		stats.DeletedBytes += size
+	}
+	return stats, nil
+}
+
+func backupAndDeleteBlock(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.Bucket,
+	backupBkt objstore.Bucket,
+	id ulid.ULID,
+	reason string,
+	dryRun bool,
+) (int, int64, error) {
+	if backupBkt != nil && !dryRun {
+		// Blocks repaired by bucket verify are backed up before they are marked for deletion.
+		ok, err := backupBkt.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+		if err != nil {
+			return 0, 0, errors.Wrapf(err, "check meta file for %s in backup bucket", id)
+		}
+		if ok {
+			level.Info(logger).Log("msg", "block already backed up", "id", id)
+		} else if err := block.Backup(ctx, logger, bkt, backupBkt, id, reason); err != nil {
+			return 0, 0, errors.Wrap(err, "backup")
+		}
+	}
+	return deleteBlock(ctx, bkt, id, dryRun)
+}
+
+// deleteBlock deletes all objects of the block and returns their number and total size. The meta file is deleted
+// first, so an interrupted deletion leaves a partial block behind, and the deletion mark last,
+// so an interrupted deletion is resumed by the next cleanup.
+func deleteBlock(ctx context.Context, bkt objstore.Bucket, id ulid.ULID, dryRun bool) (int, int64, error) {
+	var (
+		objects  []string
+		size     int64
+		metaFile = path.Join(id.String(), block.MetaFilename)
+		markFile = path.Join(id.String(), block.DeletionMarkFilename)
+		hasMeta  bool
+		hasMark  bool
+	)
+
+	err := bkt.IterWithAttributes(ctx, id.String(), func(name string, attrs objstore.ObjectAttributes) error {
+		size += attrs.Size
+		switch name {
+		case metaFile:
+			hasMeta = true
+		case markFile:
+			hasMark = true
+		default:
+			objects = append(objects, name)
+		}
+		return nil
+	}, objstore.WithRecursiveIter())
+	if err != nil {
+		return 0, 0, err
+	}
+	if hasMeta {
+		objects = append([]string{metaFile}, objects...)
+	}
+	if hasMark {
+		objects = append(objects, markFile)
+	}
+	if dryRun {
+		return len(objects), size, nil
+	}
+
+	for _, o := range objects {
+		if err := bkt.Delete(ctx, o); err != nil && !deletedConcurrently(ctx, bkt, o) {
+			return 0, 0, errors.Wrapf(err, "delete %s", o)
+		}
+	}
+	return len(objects), size, nil
+}
+
+// deletedConcurrently returns true if the object does not exist anymore after an operation on it failed. Compactors
+// of different shards clean up the whole bucket, so they may delete the same blocks at the same time. Some providers
+// return errors for deleting missing objects.
+func deletedConcurrently(ctx context.Context, bkt objstore.BucketReader, name string) bool {
+	ok, err := bkt.Exists(ctx, name)
+	return err == nil && !ok
+}
@@ -0,0 +1,160 @@
+package compact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/objstore/filesystem"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+)
+
+func TestCleanup(t *testing.T) {
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+
+	upload := func(id ulid.ULID, withMeta bool, markedAgo time.Duration) {
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), block.ChunksDirname, "000001"), bytes.NewReader([]byte("chunks"))))
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), block.IndexFilename), bytes.NewReader([]byte("index"))))
+		if withMeta {
+			testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), block.MetaFilename), bytes.NewReader([]byte("{}"))))
+		}
+		if markedAgo > 0 {
+			b, err := json.Marshal(block.DeletionMark{
+				ID:           id,
+				DeletionTime: time.Now().Add(-markedAgo).Unix(),
+				Version:      block.DeletionMarkVersion1,
+			})
+			testutil.Ok(t, err)
+			testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), block.DeletionMarkFilename), bytes.NewReader(b)))
+		}
+	}
+
+	var (
+		healthy       = ulid.MustNew(1, nil)
+		markedOld     = ulid.MustNew(2, nil)
+		markedRecent  = ulid.MustNew(3, nil)
+		partialOld    = ulid.MustNew(4, nil)
+		partialRecent = ulid.MustNew(ulid.Now(), nil)
+	)
+	upload(healthy, true, 0)
+	upload(markedOld, true, 3*time.Hour)
+	upload(markedRecent, true, time.Minute)
+	upload(partialOld, false, 0)
+	upload(partialRecent, false, 0)
+
+	var deletedBytes int64
+	for name, b := range bkt.Objects() {
+		if strings.HasPrefix(name, markedOld.String()) || strings.HasPrefix(name, partialOld.String()) {
+			deletedBytes += int64(len(b))
+		}
+	}
+
+	stats, err := Cleanup(ctx, log.NewNopLogger(), bkt, nil, time.Hour, time.Hour, true)
+	testutil.Ok(t, err)
+	testutil.Equals(t, CleanupStats{DeletedBlocks: 1, PendingDeletions: 1, PartialUploads: 1, DeletedObjects: 6, DeletedBytes: deletedBytes}, stats)
+	testutil.Equals(t, 15, len(bkt.Objects()))
+
+	backupBkt := inmem.NewBucket()
+	stats, err = Cleanup(ctx, log.NewNopLogger(), bkt, backupBkt, time.Hour, time.Hour, false)
+	testutil.Ok(t, err)
+	testutil.Equals(t, CleanupStats{DeletedBlocks: 1, PendingDeletions: 1, PartialUploads: 1, DeletedObjects: 6, DeletedBytes: deletedBytes}, stats)
+	testutil.Equals(t, 9, len(bkt.Objects()))
+
+	for _, id := range []ulid.ULID{markedOld, partialOld} {
+		for name := range bkt.Objects() {
+			testutil.Assert(t, !strings.HasPrefix(name, id.String()), "object %s of deleted block still exists", name)
+		}
+		_, ok := backupBkt.Objects()[path.Join(id.String(), block.BackupProvenanceFilename)]
+		testutil.Assert(t, ok, "provenance of block %s not found in backup bucket", id)
+	}
+	// Deleted objects and provenance files.
+	testutil.Equals(t, 8, len(backupBkt.Objects()))
+}
+
+func TestCleanup_PartialUploadModificationTime(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "test-cleanup")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	bkt, err := filesystem.NewBucket(dir)
+	testutil.Ok(t, err)
+
+	// The block was created long ago but its upload is still in progress.
+	id := ulid.MustNew(1, nil)
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), block.IndexFilename), bytes.NewReader([]byte("index"))))
+
+	stats, err := Cleanup(ctx, log.NewNopLogger(), bkt, nil, time.Hour, time.Hour, false)
+	testutil.Ok(t, err)
+	testutil.Equals(t, CleanupStats{}, stats)
+
+	old := time.Now().Add(-2 * time.Hour)
+	testutil.Ok(t, os.Chtimes(filepath.Join(dir, id.String(), block.IndexFilename), old, old))
+
+	stats, err = Cleanup(ctx, log.NewNopLogger(), bkt, nil, time.Hour, time.Hour, false)
+	testutil.Ok(t, err)
+	testutil.Equals(t, CleanupStats{PartialUploads: 1, DeletedObjects: 1, DeletedBytes: int64(len("index"))}, stats)
+
+	// Blocks created recently are never considered aborted uploads.
+	fresh := ulid.MustNew(ulid.Now(), nil)
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(fresh.String(), block.IndexFilename), bytes.NewReader([]byte("index"))))
+	testutil.Ok(t, os.Chtimes(filepath.Join(dir, fresh.String(), block.IndexFilename), old, old))
+
+	stats, err = Cleanup(ctx, log.NewNopLogger(), bkt, nil, time.Hour, time.Hour, false)
+	testutil.Ok(t, err)
+	testutil.Equals(t, CleanupStats{}, stats)
+}
+
+// racingBucket emulates another compactor deleting all blocks right before the first deletion. Deleting missing objects
+// fails like on GCS.
+type racingBucket struct {
+	*inmem.Bucket
+	raced bool
+}
+
+func (b *racingBucket) Delete(ctx context.Context, name string) error {
+	if !b.raced {
+		b.raced = true
+		for o := range b.Objects() {
+			if err := b.Bucket.Delete(ctx, o); err != nil {
+				return err
+			}
+		}
+	}
+	if _, ok := b.Objects()[name]; !ok {
+		return errors.Errorf("object %s not found", name)
+	}
+	return b.Bucket.Delete(ctx, name)
+}
+
+func TestCleanup_ConcurrentDeletion(t *testing.T) {
+	ctx := context.Background()
+	bkt := &racingBucket{Bucket: inmem.NewBucket()}
+
+	for _, id := range []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(2, nil)} {
+		b, err := json.Marshal(block.DeletionMark{ID: id, DeletionTime: time.Now().Add(-2 * time.Hour).Unix(), Version: block.DeletionMarkVersion1})
+		testutil.Ok(t, err)
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), block.IndexFilename), bytes.NewReader([]byte("index"))))
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), block.MetaFilename), bytes.NewReader([]byte("{}"))))
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), block.DeletionMarkFilename), bytes.NewReader(b)))
+	}
+
+	// Blocks deleted by another compactor in the meantime do not fail the cleanup.
+	_, err := Cleanup(ctx, log.NewNopLogger(), bkt, nil, time.Hour, time.Hour, false)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(bkt.Objects()))
+}
@@ -3,6 +3,7 @@ package compact
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"os"
 	"path"
 	"path/filepath"
@@ -15,6 +16,7 @@ import (
 	"github.com/improbable-eng/thanos/pkg/block"
 	"github.com/improbable-eng/thanos/pkg/compact/downsample"
 	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/tracing"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
@@ -25,13 +27,45 @@ import (
 // Syncer syncronizes block metas from a bucket into a local directory.
 // It sorts them into compaction groups based on equal label sets.
 type Syncer struct {
-	logger    log.Logger
-	reg       prometheus.Registerer
-	bkt       objstore.Bucket
-	syncDelay time.Duration
-	mtx       sync.Mutex
-	blocks    map[ulid.ULID]*block.Meta
-	metrics   *syncerMetrics
+	logger  log.Logger
+	reg     prometheus.Registerer
+	bkt     objstore.Bucket
+	opts    SyncerOptions
+	mtx     sync.Mutex
+	fetcher *block.MetaFetcher
+	blocks  map[ulid.ULID]*block.Meta
+	metrics *syncerMetrics
+	// noCompact holds the blocks with a no-compact mark. They are left out of compaction groups.
+	noCompact map[ulid.ULID]struct{}
+}
+
+// SyncerOptions configures a Syncer and the compaction groups it creates.
+type SyncerOptions struct {
+	// SyncDelay is the minimum age of blocks for being considered.
+	SyncDelay time.Duration
+
+	GroupOptions
+}
+
+// GroupOptions configures the compaction of a group.
+type GroupOptions struct {
+	// Download configures the download of the blocks to compact.
+	Download block.DownloadOptions
+	// Upload configures the upload of compacted blocks.
+	Upload block.UploadOptions
+	// IndexSizeLimit splits compactions whose projected index size exceeds it into multiple blocks.
+	// Zero disables the limit.
+	IndexSizeLimit int64
+	// VerticalCompaction merges overlapping raw blocks of a group into one block instead of halting the compaction.
+	VerticalCompaction bool
+	// PenaltyDeduplication deduplicates the samples of merged blocks like the querier deduplicates HA pairs.
+	PenaltyDeduplication bool
+	// RepairBlocks rewrites blocks with broken indexes without duplicated chunks and series, if that repairs them,
+	// instead of excluding them from compaction or halting.
+	RepairBlocks bool
+	// StreamUpload uploads chunks of compacted raw blocks while they are written instead of writing them to
+	// local disk first.
+	StreamUpload bool
 }
 
 type syncerMetrics struct {
@@ -44,6 +78,7 @@ type syncerMetrics struct {
 	garbageCollectionDuration prometheus.Histogram
 	compactions               *prometheus.CounterVec
 	compactionFailures        *prometheus.CounterVec
+	quarantinedBlocks         *prometheus.CounterVec
 }
 
 func newSyncerMetrics(reg prometheus.Registerer) *syncerMetrics {
@@ -67,7 +102,7 @@ func newSyncerMetrics(reg prometheus.Registerer) *syncerMetrics {
 
 	m.garbageCollectedBlocks = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "thanos_compact_garbage_collected_blocks_total",
-		Help: "Total number of deleted blocks by compactor.",
+		Help: "Total number of blocks marked for deletion by compactor.",
 	})
 
 	m.garbageCollections = prometheus.NewCounter(prometheus.CounterOpts{
@@ -94,6 +129,10 @@ func newSyncerMetrics(reg prometheus.Registerer) *syncerMetrics {
 		Name: "thanos_compact_group_compactions_failures_total",
 		Help: "Total number of failed group compactions.",
 	}, []string{"group"})
+	m.quarantinedBlocks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_compact_quarantined_blocks_total",
+		Help: "Total number of blocks with broken indexes excluded from compaction or repaired by the compactor.",
+	}, []string{"action"})
 
 	if reg != nil {
 		reg.MustRegister(
@@ -106,22 +145,24 @@ func newSyncerMetrics(reg prometheus.Registerer) *syncerMetrics {
 			m.garbageCollectionDuration,
 			m.compactions,
 			m.compactionFailures,
+			m.quarantinedBlocks,
 		)
 	}
 	return &m
 }
 
-// NewSyncer returns a new Syncer for the given Bucket and directory.
-// Blocks must be at least as old as the sync delay for being considered.
-func NewSyncer(logger log.Logger, reg prometheus.Registerer, bkt objstore.Bucket, syncDelay time.Duration) (*Syncer, error) {
+// NewSyncer returns a new Syncer for the given Bucket and directory. Metas of the blocks are fetched by the given fetcher.
+func NewSyncer(logger log.Logger, reg prometheus.Registerer, bkt objstore.Bucket, fetcher *block.MetaFetcher, opts SyncerOptions) (*Syncer, error) {
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
 	return &Syncer{
 		logger:    logger,
 		reg:       reg,
-		syncDelay: syncDelay,
+		opts:      opts,
+		fetcher:   fetcher,
 		blocks:    map[ulid.ULID]*block.Meta{},
+		noCompact: map[ulid.ULID]struct{}{},
 		bkt:       bkt,
 		metrics:   newSyncerMetrics(reg),
 	}, nil
@@ -146,52 +187,43 @@ func (c *Syncer) SyncMetas(ctx context.Context) error {
 }
 
 func (c *Syncer) syncMetas(ctx context.Context) error {
-	// Read back all block metas so we can detect deleted blocks.
-	remote := map[ulid.ULID]struct{}{}
-
-	err := c.bkt.Iter(ctx, "", func(name string) error {
-		id, ok := block.IsBlockDir(name)
-		if !ok {
-			return nil
+	metas, partial, err := c.fetcher.Fetch(ctx)
+	if err != nil {
+		return retry(errors.Wrap(err, "fetch block metas"))
+	}
+	for id, err := range partial {
+		// Blocks without meta file are pending or aborted uploads. Broken meta files require manual repair.
+		if errors.Cause(err) != block.ErrMetaNotFound {
+			return retry(errors.Wrapf(err, "invalid meta file of block %s", id))
 		}
+		level.Debug(c.logger).Log("msg", "skipping block without meta file", "block", id)
+	}
 
-		remote[id] = struct{}{}
+	blocks := make(map[ulid.ULID]*block.Meta, len(metas))
+	noCompact := map[ulid.ULID]struct{}{}
 
-		// Check if we already have this block cached locally.
-		if _, ok := c.blocks[id]; ok {
-			return nil
+	for id, meta := range metas {
+		// Blocks marked for deletion are left out, so they are neither compacted nor garbage collected again.
+		// Marks can be added and removed at any time. They are found by the listing of the fetcher on every sync,
+		// so they do not need to be read for every block.
+		if c.fetcher.Marked(id, block.DeletionMarkFilename) {
+			continue
 		}
-
-		level.Debug(c.logger).Log("msg", "download meta", "block", id)
-
-		meta, err := block.DownloadMeta(ctx, c.bkt, id)
-		if err != nil {
-			return errors.Wrapf(err, "downloading meta.json for %s", id)
+		if c.fetcher.Marked(id, block.NoCompactMarkFilename) {
+			noCompact[id] = struct{}{}
 		}
 
 		// ULIDs contain a millisecond timestamp. We do not consider blocks that have been created too recently to
 		// avoid races when a block is only partially uploaded. This relates only to level 1 blocks.
 		// NOTE: It is not safe to miss compacted block in sync step. Compactor needs to aware of ALL old blocks.
-		if meta.Compaction.Level == 1 && ulid.Now()-id.Time() < uint64(c.syncDelay/time.Millisecond) {
-			return nil
-		}
-
-		remote[id] = struct{}{}
-		c.blocks[id] = &meta
-
-		return nil
-	})
-	if err != nil {
-		return retry(errors.Wrap(err, "retrieve bucket block metas"))
-	}
-
-	// Delete all local block dirs that no longer exist in the bucket.
-	for id := range c.blocks {
-		if _, ok := remote[id]; !ok {
-			delete(c.blocks, id)
+		if meta.Compaction.Level == 1 && ulid.Now()-id.Time() < uint64(c.opts.SyncDelay/time.Millisecond) {
+			continue
 		}
+		blocks[id] = meta
 	}
 
+	c.blocks = blocks
+	c.noCompact = noCompact
 	return nil
 }
 
@@ -205,7 +237,20 @@ func groupKey(res int64, lbls labels.Labels) string {
 	return fmt.Sprintf("%d@%s", res, lbls)
 }
 
+// Metas returns a copy of the metas of all blocks currently known to the syncer.
+func (c *Syncer) Metas() []block.Meta {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	res := make([]block.Meta, 0, len(c.blocks))
+	for _, m := range c.blocks {
+		res = append(res, *m)
+	}
+	return res
+}
+
 // Groups returns the compaction groups for all blocks currently known to the syncer.
+// Blocks marked for no compaction are not part of any group, but are still considered by garbage collection.
 // It creates all groups from the scratch on every call.
 func (c *Syncer) Groups() (res []*Group, err error) {
 	c.mtx.Lock()
@@ -213,6 +258,10 @@ func (c *Syncer) Groups() (res []*Group, err error) {
 
 	groups := map[string]*Group{}
 	for _, m := range c.blocks {
+		if _, ok := c.noCompact[m.ULID]; ok {
+			level.Debug(c.logger).Log("msg", "skipping block marked for no compaction", "block", m.ULID)
+			continue
+		}
 		g, ok := groups[GroupKey(*m)]
 		if !ok {
 			g, err = newGroup(
@@ -223,6 +272,8 @@ func (c *Syncer) Groups() (res []*Group, err error) {
 				c.metrics.compactions.WithLabelValues(GroupKey(*m)),
 				c.metrics.compactionFailures.WithLabelValues(GroupKey(*m)),
 				c.metrics.garbageCollectedBlocks,
+				c.metrics.quarantinedBlocks,
+				c.opts.GroupOptions,
 			)
 			if err != nil {
 				return nil, errors.Wrap(err, "create compaction group")
@@ -238,7 +289,7 @@ func (c *Syncer) Groups() (res []*Group, err error) {
 	return res, nil
 }
 
-// GarbageCollect deletes blocks from the bucket if their data is available as part of a
+// GarbageCollect marks blocks in the bucket for deletion if their data is available as part of a
 // block with a higher compaction level.
 func (c *Syncer) GarbageCollect(ctx context.Context) error {
 	c.mtx.Lock()
@@ -246,10 +297,19 @@ func (c *Syncer) GarbageCollect(ctx context.Context) error {
 
 	begin := time.Now()
 
-	// Run a separate round of garbage collections for each valid resolution.
-	for _, res := range []int64{
-		downsample.ResLevel0, downsample.ResLevel1, downsample.ResLevel2,
-	} {
+	// Run a separate round of garbage collections for each resolution of the synced blocks, which includes
+	// the resolutions of custom downsampling levels.
+	resolutions := map[int64]struct{}{}
+	for _, m := range c.blocks {
+		resolutions[m.Thanos.Downsample.Resolution] = struct{}{}
+	}
+	var sorted []int64
+	for res := range resolutions {
+		sorted = append(sorted, res)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	for _, res := range sorted {
 		err := c.garbageCollect(ctx, res)
 		if err != nil {
 			c.metrics.garbageCollectionFailures.Inc()
@@ -267,7 +327,10 @@ func (c *Syncer) GarbageCollect(ctx context.Context) error {
 func (c *Syncer) GarbageBlocks(resolution int64) (ids []ulid.ULID, err error) {
 	// Map each block to its highest priority parent. Initial blocks have themselves
 	// in their source section, i.e. are their own parent.
-	parents := map[ulid.ULID]ulid.ULID{}
+	// Blocks split by series only hold a shard of their sources, so parents are tracked per shard.
+	parents := map[sourceShard]ulid.ULID{}
+	// Highest compaction level of split blocks per source and shard.
+	splitLevels := map[ulid.ULID]map[block.SplitShard]int{}
 
 	for id, meta := range c.blocks {
 
@@ -278,10 +341,20 @@ func (c *Syncer) GarbageBlocks(resolution int64) (ids []ulid.ULID, err error) {
 
 		// For each source block we contain, check whether we are the highest priority parent block.
 		for _, sid := range meta.Compaction.Sources {
-			pid, ok := parents[sid]
+			if meta.Thanos.Split != nil {
+				if splitLevels[sid] == nil {
+					splitLevels[sid] = map[block.SplitShard]int{}
+				}
+				if l := splitLevels[sid][*meta.Thanos.Split]; meta.Compaction.Level > l {
+					splitLevels[sid][*meta.Thanos.Split] = meta.Compaction.Level
+				}
+			}
+
+			key := sourceShard{source: sid, shard: meta.Thanos.Split.String()}
+			pid, ok := parents[key]
 			// No parents for the source block so far.
 			if !ok {
-				parents[sid] = id
+				parents[key] = id
 				continue
 			}
 			pmeta, ok := c.blocks[pid]
@@ -298,13 +371,13 @@ func (c *Syncer) GarbageBlocks(resolution int64) (ids []ulid.ULID, err error) {
 			level, plevel := meta.Compaction.Level, pmeta.Compaction.Level
 
 			if level > plevel || (level == plevel && id.Compare(pid) > 0) {
-				parents[sid] = id
+				parents[key] = id
 			}
 		}
 	}
 
 	// A block can safely be deleted if they are not the highest priority parent for
-	// any source block.
+	// any source block or if split blocks of all shards hold its data.
 	topParents := map[ulid.ULID]struct{}{}
 	for _, pid := range parents {
 		topParents[pid] = struct{}{}
@@ -315,7 +388,7 @@ func (c *Syncer) GarbageBlocks(resolution int64) (ids []ulid.ULID, err error) {
 		if meta.Thanos.Downsample.Resolution != resolution {
 			continue
 		}
-		if _, ok := topParents[id]; ok {
+		if _, ok := topParents[id]; ok && !coveredBySplitBlocks(meta, splitLevels) {
 			continue
 		}
 
@@ -324,6 +397,39 @@ func (c *Syncer) GarbageBlocks(resolution int64) (ids []ulid.ULID, err error) {
 	return ids, nil
 }
 
+type sourceShard struct {
+	source ulid.ULID
+	shard  string
+}
+
+// coveredBySplitBlocks returns true if the block is not split and all its sources are contained in
+// split blocks of all shards with a higher compaction level.
+func coveredBySplitBlocks(meta *block.Meta, splitLevels map[ulid.ULID]map[block.SplitShard]int) bool {
+	if meta.Thanos.Split != nil || len(meta.Compaction.Sources) == 0 {
+		return false
+	}
+	for _, sid := range meta.Compaction.Sources {
+		covered := false
+		for shard := range splitLevels[sid] {
+			complete := true
+			for i := 0; i < shard.Count; i++ {
+				if splitLevels[sid][block.SplitShard{Index: i, Count: shard.Count}] <= meta.Compaction.Level {
+					complete = false
+					break
+				}
+			}
+			if complete {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *Syncer) garbageCollect(ctx context.Context, resolution int64) error {
 	garbageIds, err := c.GarbageBlocks(resolution)
 	if err != nil {
@@ -335,15 +441,11 @@ func (c *Syncer) garbageCollect(ctx context.Context, resolution int64) error {
 			return ctx.Err()
 		}
 
-		// Spawn a new context so we always delete a block in full on shutdown.
-		delCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		level.Info(c.logger).Log("msg", "marking outdated block for deletion", "block", id)
 
-		level.Info(c.logger).Log("msg", "deleting outdated block", "block", id)
-
-		err := block.Delete(delCtx, c.bkt, id)
-		cancel()
-		if err != nil {
-			return retry(errors.Wrapf(err, "delete block %s from bucket", id))
+		// The block is deleted by the cleanup after the delete delay, so store gateways can drop it first.
+		if err := block.MarkForDeletion(ctx, c.logger, c.bkt, id, "compactor: outdated block"); err != nil {
+			return retry(errors.Wrapf(err, "mark block %s for deletion", id))
 		}
 
 		// Immediately update our in-memory state so no further call to SyncMetas is needed
@@ -366,6 +468,8 @@ type Group struct {
 	compactions                 prometheus.Counter
 	compactionFailures          prometheus.Counter
 	groupGarbageCollectedBlocks prometheus.Counter
+	quarantinedBlocks           *prometheus.CounterVec
+	opts                        GroupOptions
 }
 
 // newGroup returns a new compaction group.
@@ -377,6 +481,8 @@ func newGroup(
 	compactions prometheus.Counter,
 	compactionFailures prometheus.Counter,
 	groupGarbageCollectedBlocks prometheus.Counter,
+	quarantinedBlocks *prometheus.CounterVec,
+	opts GroupOptions,
 ) (*Group, error) {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -390,6 +496,8 @@ func newGroup(
 		compactions:                 compactions,
 		compactionFailures:          compactionFailures,
 		groupGarbageCollectedBlocks: groupGarbageCollectedBlocks,
+		quarantinedBlocks:           quarantinedBlocks,
+		opts:                        opts,
 	}
 	return g, nil
 }
@@ -450,6 +558,10 @@ func (cg *Group) Compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 		return ulid.ULID{}, errors.Wrap(err, "create compaction group dir")
 	}
 
+	span, ctx := tracing.StartSpan(ctx, "compaction_group")
+	span.SetTag("group", cg.Key())
+	defer span.Finish()
+
 	id, err := cg.compact(ctx, subDir, comp)
 	if err != nil {
 		cg.compactionFailures.Inc()
@@ -459,6 +571,184 @@ func (cg *Group) Compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 	return id, err
 }
 
+// PlannedCompactions returns how many compactions of the group the planner of comp schedules until it has no work left.
+// The compactions are simulated on the meta files of the group in dir without downloading any blocks.
+func (cg *Group) PlannedCompactions(dir string, comp tsdb.Compactor) (n int, err error) {
+	cg.mtx.Lock()
+	metas := make([]*block.Meta, 0, len(cg.blocks))
+	for _, m := range cg.blocks {
+		metas = append(metas, m)
+	}
+	cg.mtx.Unlock()
+
+	if err := os.RemoveAll(dir); err != nil {
+		return 0, errors.Wrap(err, "clean planning dir")
+	}
+	defer os.RemoveAll(dir)
+
+	for _, m := range metas {
+		if err := writePlanningMeta(dir, m); err != nil {
+			return 0, err
+		}
+	}
+
+	entropy := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for {
+		plan, err := comp.Plan(dir)
+		if err != nil {
+			return n, errors.Wrap(err, "plan compaction")
+		}
+		if len(plan) == 0 {
+			return n, nil
+		}
+		n++
+
+		// The planned blocks are replaced by a block covering all of them, like the compacted block would. As it has
+		// no tombstones, every simulated compaction either reduces the number of blocks or removes the tombstones of one.
+		res := &block.Meta{Version: 1}
+		res.ULID = ulid.MustNew(ulid.Now(), entropy)
+		for i, pdir := range plan {
+			m, err := block.ReadMetaFile(pdir)
+			if err != nil {
+				return n, errors.Wrapf(err, "read meta from %s", pdir)
+			}
+			if i == 0 || m.MinTime < res.MinTime {
+				res.MinTime = m.MinTime
+			}
+			if i == 0 || m.MaxTime > res.MaxTime {
+				res.MaxTime = m.MaxTime
+			}
+			if m.Compaction.Level >= res.Compaction.Level {
+				res.Compaction.Level = m.Compaction.Level + 1
+			}
+			res.Compaction.Sources = append(res.Compaction.Sources, m.Compaction.Sources...)
+			res.Thanos = m.Thanos
+
+			if err := os.RemoveAll(pdir); err != nil {
+				return n, errors.Wrapf(err, "remove planning dir %s", pdir)
+			}
+		}
+		if err := writePlanningMeta(dir, res); err != nil {
+			return n, err
+		}
+	}
+}
+
+// writePlanningMeta writes the meta into its block directory in dir, which is all the planner looks at.
+func writePlanningMeta(dir string, meta *block.Meta) error {
+	bdir := filepath.Join(dir, meta.ULID.String())
+	if err := os.MkdirAll(bdir, 0777); err != nil {
+		return errors.Wrap(err, "create planning block dir")
+	}
+	if err := block.WriteMetaFile(bdir, meta); err != nil {
+		return errors.Wrap(err, "write planning meta file")
+	}
+	return nil
+}
+
+// splitAndCompact splits all blocks of the plan into the given number of shards by series and compacts
+// the blocks of each shard into a separate block. It returns the IDs of the compacted blocks ordered by shard.
+func splitAndCompact(dir string, comp tsdb.Compactor, plan []string, shards int) ([]ulid.ULID, error) {
+	shardDirs := make([][]string, shards)
+	for _, pdir := range plan {
+		id, err := ulid.Parse(filepath.Base(pdir))
+		if err != nil {
+			return nil, errors.Wrapf(err, "plan dir %s", pdir)
+		}
+		ids, err := block.Split(dir, id, shards, downsample.NewPool())
+		if err != nil {
+			return nil, errors.Wrapf(err, "split block %s", id)
+		}
+		for i, sid := range ids {
+			shardDirs[i] = append(shardDirs[i], filepath.Join(dir, sid.String()))
+		}
+		// Free the disk space as early as possible.
+		if err := os.RemoveAll(pdir); err != nil {
+			return nil, errors.Wrapf(err, "remove split block dir %s", pdir)
+		}
+	}
+
+	compIDs := make([]ulid.ULID, 0, shards)
+	for i, dirs := range shardDirs {
+		compID, err := comp.Compact(dir, dirs...)
+		if err != nil {
+			return nil, halt(errors.Wrapf(err, "compact shard %d of blocks %v", i, plan))
+		}
+		for _, d := range dirs {
+			if err := os.RemoveAll(d); err != nil {
+				return nil, errors.Wrapf(err, "remove split block dir %s", d)
+			}
+		}
+		compIDs = append(compIDs, compID)
+	}
+	return compIDs, nil
+}
+
+// repairBlock rewrites the downloaded block of the meta in dir into a new block without duplicated chunks and
+// series, chunks outside of its time range and unsorted label sets. If the new block is valid, it is uploaded and
+// the broken block is marked for deletion. It returns the ID of the new block or a zero ID if the repair did not
+// result in a valid block, e.g. because of out of order chunks that are not duplicates.
+func (cg *Group) repairBlock(ctx context.Context, logger log.Logger, dir string, meta *block.Meta) (ulid.ULID, error) {
+	resid, err := block.Repair(dir, meta.ULID)
+	if err != nil {
+		level.Warn(logger).Log("msg", "repair of broken block failed", "block", meta.ULID, "err", err)
+		return ulid.ULID{}, nil
+	}
+	rdir := filepath.Join(dir, resid.String())
+	defer os.RemoveAll(rdir)
+
+	if err := block.VerifyIndex(filepath.Join(rdir, block.IndexFilename), meta.MinTime, meta.MaxTime); err != nil {
+		level.Warn(logger).Log("msg", "repaired block is still invalid", "block", meta.ULID, "err", err)
+		return ulid.ULID{}, nil
+	}
+	if err := block.UploadWithOptions(ctx, cg.bkt, rdir, cg.opts.Upload); err != nil {
+		return ulid.ULID{}, errors.Wrapf(err, "upload repaired block %s", resid)
+	}
+	level.Info(logger).Log("msg", "repaired broken block, marking it for deletion", "block", meta.ULID, "result_block", resid)
+	if err := block.MarkForDeletion(ctx, logger, cg.bkt, meta.ULID, fmt.Sprintf("compactor: repaired as %s", resid)); err != nil {
+		return ulid.ULID{}, errors.Wrapf(err, "mark broken block %s for deletion", meta.ULID)
+	}
+	cg.quarantinedBlocks.WithLabelValues("repaired").Inc()
+	return resid, nil
+}
+
+// mergeBlocks merges the overlapping blocks of the plan into a single block and returns its ID.
+func mergeBlocks(dir string, plan []string, opts block.MergeOptions) (ulid.ULID, error) {
+	ids := make([]ulid.ULID, 0, len(plan))
+	for _, pdir := range plan {
+		id, err := ulid.Parse(filepath.Base(pdir))
+		if err != nil {
+			return ulid.ULID{}, errors.Wrapf(err, "plan dir %s", pdir)
+		}
+		ids = append(ids, id)
+	}
+	id, err := block.MergeWithOptions(dir, ids, downsample.NewPool(), opts)
+	if err != nil {
+		return ulid.ULID{}, halt(errors.Wrapf(err, "merge blocks %v", plan))
+	}
+	return id, nil
+}
+
+// streamMergeBlocks is like mergeBlocks but uploads the chunks of the merged block through u while they are written.
+// Failed uploads are retried, other errors halt like in mergeBlocks.
+func streamMergeBlocks(dir string, plan []string, opts block.MergeOptions, u *block.StreamUploader) (ulid.ULID, error) {
+	ids := make([]ulid.ULID, 0, len(plan))
+	for _, pdir := range plan {
+		id, err := ulid.Parse(filepath.Base(pdir))
+		if err != nil {
+			return ulid.ULID{}, errors.Wrapf(err, "plan dir %s", pdir)
+		}
+		ids = append(ids, id)
+	}
+	if err := block.MergeToBucket(dir, ids, downsample.NewPool(), opts, u); err != nil {
+		if u.Err() != nil {
+			return ulid.ULID{}, retry(errors.Wrapf(err, "stream merged chunks of blocks %v", plan))
+		}
+		return ulid.ULID{}, halt(errors.Wrapf(err, "merge blocks %v", plan))
+	}
+	return u.ID(), nil
+}
+
 // HaltError is a type wrapper for errors that should halt any further progress on compactions.
 type HaltError struct {
 	err error
@@ -532,31 +822,95 @@ func (cg *Group) areBlocksOverlapping(include *block.Meta, excludeDirs ...string
 	return nil
 }
 
+// firstOverlappingBlocks returns the IDs of the earliest run of blocks of the group that overlap each other, directly
+// or through other blocks of the run.
+func (cg *Group) firstOverlappingBlocks() []ulid.ULID {
+	metas := make([]*block.Meta, 0, len(cg.blocks))
+	for _, m := range cg.blocks {
+		metas = append(metas, m)
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		return metas[i].MinTime < metas[j].MinTime
+	})
+
+	var (
+		run  []ulid.ULID
+		maxt int64
+	)
+	for _, m := range metas {
+		if len(run) == 0 || m.MinTime >= maxt {
+			if len(run) > 1 {
+				break
+			}
+			run, maxt = []ulid.ULID{m.ULID}, m.MaxTime
+			continue
+		}
+		run = append(run, m.ULID)
+		if m.MaxTime > maxt {
+			maxt = m.MaxTime
+		}
+	}
+	if len(run) < 2 {
+		return nil
+	}
+	return run
+}
+
+// isBlockOverlapping returns an error if the given block overlaps with any block of the group other than the excluded ones.
+func (cg *Group) isBlockOverlapping(meta *block.Meta, excludeDirs ...string) error {
+	exclude := map[ulid.ULID]struct{}{}
+	for _, e := range excludeDirs {
+		id, err := ulid.Parse(filepath.Base(e))
+		if err != nil {
+			return errors.Wrapf(err, "overlaps find dir %s", e)
+		}
+		exclude[id] = struct{}{}
+	}
+
+	for _, m := range cg.blocks {
+		if _, ok := exclude[m.ULID]; ok {
+			continue
+		}
+		if m.MinTime < meta.MaxTime && meta.MinTime < m.MaxTime {
+			return errors.Errorf("block %s overlaps with block %s", meta.ULID, m.ULID)
+		}
+	}
+	return nil
+}
+
 func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (compID ulid.ULID, err error) {
 	cg.mtx.Lock()
 	defer cg.mtx.Unlock()
 
-	// Check for overlapped blocks.
+	logger := tracing.LoggerWithTraceID(ctx, cg.logger)
+
+	// Check for overlapped blocks. With vertical compaction, overlapping raw blocks are merged instead.
+	var vertical []string
 	if err := cg.areBlocksOverlapping(nil); err != nil {
-		return compID, halt(errors.Wrap(err, "pre compaction overlap check"))
+		if !cg.opts.VerticalCompaction || cg.resolution != downsample.ResLevel0 {
+			return compID, halt(errors.Wrap(err, "pre compaction overlap check"))
+		}
+		for _, id := range cg.firstOverlappingBlocks() {
+			vertical = append(vertical, filepath.Join(dir, id.String()))
+		}
+		level.Info(logger).Log("msg", "found overlapping blocks, compacting them vertically", "blocks", fmt.Sprintf("%v", vertical))
 	}
 
 	// Planning a compaction works purely based on the meta.json files in our future group's dir.
 	// So we first dump all our memory block metas into the directory.
 	for _, meta := range cg.blocks {
-		bdir := filepath.Join(dir, meta.ULID.String())
-		if err := os.MkdirAll(bdir, 0777); err != nil {
-			return compID, errors.Wrap(err, "create planning block dir")
-		}
-		if err := block.WriteMetaFile(bdir, meta); err != nil {
-			return compID, errors.Wrap(err, "write planning meta file")
+		if err := writePlanningMeta(dir, meta); err != nil {
+			return compID, err
 		}
 	}
 
 	// Plan against the written meta.json files.
-	plan, err := comp.Plan(dir)
-	if err != nil {
-		return compID, errors.Wrap(err, "plan compaction")
+	plan := vertical
+	if len(plan) == 0 {
+		plan, err = comp.Plan(dir)
+		if err != nil {
+			return compID, errors.Wrap(err, "plan compaction")
+		}
 	}
 	if len(plan) == 0 {
 		// Nothing to do.
@@ -592,52 +946,173 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 			return compID, errors.Wrapf(err, "plan dir %s", pdir)
 		}
 
-		if err := block.Download(ctx, cg.bkt, id, pdir); err != nil {
+		if err := block.DownloadWithOptions(ctx, cg.bkt, id, pdir, cg.opts.Download); err != nil {
+			// Corrupted blocks in the bucket will not heal on retry and need manual repair.
+			if block.IsCorruptionError(err) {
+				return compID, halt(errors.Wrapf(err, "download block %s", id))
+			}
 			return compID, retry(errors.Wrapf(err, "download block %s", id))
 		}
 
 		// Ensure all input blocks are valid.
-		if err := block.VerifyIndex(filepath.Join(pdir, block.IndexFilename), meta.MinTime, meta.MaxTime); err != nil {
+		stats, err := block.GatherIndexHealthStats(filepath.Join(pdir, block.IndexFilename), meta.MinTime, meta.MaxTime)
+		if err != nil {
+			return compID, halt(errors.Wrapf(err, "gather index health stats of plan block %s", pdir))
+		}
+		// Repaired blocks replace the broken ones in the next planning cycle.
+		if serr := stats.ErrSummary(); serr != nil && cg.opts.RepairBlocks {
+			resid, err := cg.repairBlock(ctx, logger, dir, meta)
+			if err != nil {
+				return compID, retry(errors.Wrapf(err, "repair plan block %s", id))
+			}
+			if resid != (ulid.ULID{}) {
+				return compID, retry(errors.Wrapf(serr, "plan block %s was repaired as %s", id, resid))
+			}
+		}
+		// TSDB refuses to compact blocks with out of order chunks. They are excluded from compaction instead of
+		// halting, so the rest of the group can still be compacted.
+		if err := stats.OutOfOrderChunksErr(); err != nil {
+			level.Warn(logger).Log("msg", "found out of order chunks in plan block, marking it for no compaction", "block", id, "err", err)
+			if err := block.MarkForNoCompact(ctx, logger, cg.bkt, id, block.OutOfOrderChunksNoCompactReason, err.Error()); err != nil {
+				return compID, retry(errors.Wrapf(err, "mark block %s for no compaction", id))
+			}
+			cg.quarantinedBlocks.WithLabelValues("no-compact").Inc()
+			return compID, retry(errors.Wrapf(err, "plan block %s has out of order chunks", id))
+		}
+		if err := stats.ErrSummary(); err != nil {
 			return compID, halt(errors.Wrapf(err, "invalid plan block %s", pdir))
 		}
 	}
-	level.Debug(cg.logger).Log("msg", "downloaded and verified blocks",
+	level.Debug(logger).Log("msg", "downloaded and verified blocks",
 		"blocks", fmt.Sprintf("%v", plan), "duration", time.Since(begin))
 
+	// TSDB is not able to read index files above 64GiB. If the index of the compacted block may exceed the limit,
+	// the series of the plan are split into shards, which are compacted into separate blocks.
+	// Merged blocks are not split, as the merge does not shrink the index of its input blocks much.
+	shards := 1
+	if cg.opts.IndexSizeLimit > 0 && len(vertical) == 0 {
+		var projected int64
+		for _, pdir := range plan {
+			fi, err := os.Stat(filepath.Join(pdir, block.IndexFilename))
+			if err != nil {
+				return compID, errors.Wrapf(err, "stat index of %s", pdir)
+			}
+			projected += fi.Size()
+		}
+		if projected > cg.opts.IndexSizeLimit {
+			shards = int((projected-1)/cg.opts.IndexSizeLimit) + 1
+			level.Info(logger).Log("msg", "projected index size exceeds limit, splitting compaction",
+				"blocks", fmt.Sprintf("%v", plan), "projected_index_size", projected, "shards", shards)
+		}
+	}
+
 	begin = time.Now()
 
-	compID, err = comp.Compact(dir, plan...)
-	if err != nil {
-		return compID, halt(errors.Wrapf(err, "compact blocks %v", plan))
+	// Raw blocks that are not split may be merged with their chunks streamed into the bucket, as the block merge
+	// writes the same result as a compaction for non overlapping blocks.
+	var streamed *block.StreamUploader
+	if cg.opts.StreamUpload && cg.resolution == downsample.ResLevel0 && shards == 1 && len(plan) > 1 {
+		streamed = block.NewStreamUploader(ctx, cg.bkt, ulid.MustNew(ulid.Now(), rand.New(rand.NewSource(time.Now().UnixNano()))))
+		defer func() {
+			// The streamed block is complete once finished, so it is only deleted on errors before.
+			if err != nil && streamed != nil {
+				if aerr := streamed.Abort(); aerr != nil {
+					level.Warn(logger).Log("msg", "failed to delete partially streamed block", "block", streamed.ID(), "err", aerr)
+				}
+			}
+		}()
+	}
+
+	var compIDs []ulid.ULID
+	if streamed != nil {
+		compID, err = streamMergeBlocks(dir, plan, block.MergeOptions{PenaltyDeduplication: cg.opts.PenaltyDeduplication}, streamed)
+		if err != nil {
+			return compID, err
+		}
+		compIDs = append(compIDs, compID)
+	} else if len(vertical) > 0 {
+		compID, err = mergeBlocks(dir, plan, block.MergeOptions{PenaltyDeduplication: cg.opts.PenaltyDeduplication})
+		if err != nil {
+			return compID, err
+		}
+		compIDs = append(compIDs, compID)
+	} else if shards > 1 {
+		compIDs, err = splitAndCompact(dir, comp, plan, shards)
+		if err != nil {
+			return compID, err
+		}
+	} else {
+		compID, err = comp.Compact(dir, plan...)
+		if err != nil {
+			return compID, halt(errors.Wrapf(err, "compact blocks %v", plan))
+		}
+		compIDs = append(compIDs, compID)
 	}
-	level.Debug(cg.logger).Log("msg", "compacted blocks",
+	level.Debug(logger).Log("msg", "compacted blocks",
 		"blocks", fmt.Sprintf("%v", plan), "duration", time.Since(begin))
 
-	bdir := filepath.Join(dir, compID.String())
+	for i, id := range compIDs {
+		bdir := filepath.Join(dir, id.String())
 
-	newMeta, err := block.Finalize(bdir, cg.labels.Map(), cg.resolution, nil)
-	if err != nil {
-		return compID, errors.Wrapf(err, "failed to finalize the block %s", bdir)
-	}
+		newMeta, err := block.Finalize(bdir, cg.labels.Map(), cg.resolution, nil)
+		if err != nil {
+			return compID, errors.Wrapf(err, "failed to finalize the block %s", bdir)
+		}
+		if shards > 1 {
+			newMeta.Thanos.Split = &block.SplitShard{Index: i, Count: shards}
+			if err := block.WriteMetaFile(bdir, newMeta); err != nil {
+				return compID, errors.Wrapf(err, "write meta of split block %s", bdir)
+			}
+		}
 
-	// Ensure the output block is valid.
-	if err := block.VerifyIndex(filepath.Join(bdir, block.IndexFilename), newMeta.MinTime, newMeta.MaxTime); err != nil {
-		return compID, halt(errors.Wrapf(err, "invalid result block %s", bdir))
-	}
+		// Ensure the output block is valid.
+		if err := block.VerifyIndex(filepath.Join(bdir, block.IndexFilename), newMeta.MinTime, newMeta.MaxTime); err != nil {
+			return compID, halt(errors.Wrapf(err, "invalid result block %s", bdir))
+		}
 
-	// Ensure the output block is not overlapping with anything else.
-	if err := cg.areBlocksOverlapping(newMeta, plan...); err != nil {
-		return compID, halt(errors.Wrapf(err, "resulted compacted block %s overlaps with something", bdir))
-	}
+		// Ensure the output block is not overlapping with anything else. Other overlapping blocks of the group are
+		// merged by the next vertical compactions.
+		if len(vertical) > 0 {
+			if err := cg.isBlockOverlapping(newMeta, plan...); err != nil {
+				return compID, halt(errors.Wrapf(err, "resulted merged block %s overlaps with something", bdir))
+			}
+		} else if err := cg.areBlocksOverlapping(newMeta, plan...); err != nil {
+			return compID, halt(errors.Wrapf(err, "resulted compacted block %s overlaps with something", bdir))
+		}
 
-	begin = time.Now()
+		// Shards of a split block overlap each other and must never be compacted together again.
+		// The mark is uploaded first, so the block is never seen without it.
+		if shards > 1 {
+			details := fmt.Sprintf("compactor: shard %s of compaction of %v", newMeta.Thanos.Split, newMeta.Compaction.Sources)
+			if err := block.MarkForNoCompact(ctx, logger, cg.bkt, id, block.IndexSizeExceedingNoCompactReason, details); err != nil {
+				return compID, retry(errors.Wrapf(err, "mark split block %s for no compaction", id))
+			}
+		}
+
+		begin = time.Now()
 
-	if err := block.Upload(ctx, cg.bkt, bdir); err != nil {
-		return compID, retry(errors.Wrapf(err, "upload of %s failed", compID))
+		if streamed != nil {
+			// Only the index is left to upload, the chunks were streamed while merging.
+			if err := streamed.UploadFile(block.IndexFilename, filepath.Join(bdir, block.IndexFilename)); err != nil {
+				return compID, retry(errors.Wrapf(err, "upload index of %s failed", id))
+			}
+			if err := streamed.Finish(newMeta); err != nil {
+				return compID, retry(errors.Wrapf(err, "upload of %s failed", id))
+			}
+			streamed = nil
+		} else if err := block.UploadWithOptions(ctx, cg.bkt, bdir, cg.opts.Upload); err != nil {
+			return compID, retry(errors.Wrapf(err, "upload of %s failed", id))
+		}
+		level.Debug(logger).Log("msg", "uploaded block", "result_block", id, "duration", time.Since(begin))
+	}
+	compID = compIDs[0]
+
+	result := compID.String()
+	if len(compIDs) > 1 {
+		result = fmt.Sprintf("%v", compIDs)
 	}
-	level.Debug(cg.logger).Log("msg", "uploaded block", "result_block", compID, "duration", time.Since(begin))
 
-	// Delete the blocks we just compacted from the group and bucket so they do not get included
+	// Mark the blocks we just compacted for deletion and remove them from the group so they do not get included
 	// into the next planning cycle.
 	// Eventually the block we just uploaded should get synced into the group again (including sync-delay).
 	for _, b := range plan {
@@ -650,16 +1125,245 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 			return compID, errors.Wrapf(err, "remove old block dir %s", id)
 		}
 
-		// Spawn a new context so we always delete a block in full on shutdown.
-		delCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-		level.Info(cg.logger).Log("msg", "deleting compacted block", "old_block", id, "result_block", compID)
-		err = block.Delete(delCtx, cg.bkt, id)
-		cancel()
-		if err != nil {
-			return compID, retry(errors.Wrapf(err, "delete old block %s from bucket ", id))
+		level.Info(logger).Log("msg", "marking compacted block for deletion", "old_block", id, "result_block", result)
+		if err := block.MarkForDeletion(ctx, logger, cg.bkt, id, fmt.Sprintf("compactor: compacted into %s", result)); err != nil {
+			return compID, retry(errors.Wrapf(err, "mark old block %s for deletion", id))
 		}
 		cg.groupGarbageCollectedBlocks.Inc()
 	}
 
 	return compID, nil
 }
+
+// BucketCompactor runs the compactions of independent groups concurrently.
+type BucketCompactor struct {
+	logger      log.Logger
+	comp        tsdb.Compactor
+	compactDir  string
+	concurrency int
+	disk        *DiskBudget
+
+	// skipHaltedGroups skips groups whose compaction failed with a halt error instead of halting all compactions.
+	skipHaltedGroups bool
+	mtx              sync.Mutex
+	haltedGroups     map[string]error
+	haltedGroupsVec  *prometheus.GaugeVec
+
+	plannedCompactionsVec *prometheus.GaugeVec
+}
+
+// NewBucketCompactor returns a compactor running up to concurrency group compactions at once in compactDir.
+// A group compaction only starts if the projected local disk usage of all running compactions stays within
+// diskLimit, unless no other compaction is running. Zero disables the disk limit.
+// With skipHaltedGroups, a group whose compaction fails with a halt error is skipped by all further compactions
+// of the process, while other groups continue to be compacted.
+func NewBucketCompactor(
+	logger log.Logger,
+	reg prometheus.Registerer,
+	comp tsdb.Compactor,
+	compactDir string,
+	concurrency int,
+	diskLimit int64,
+	skipHaltedGroups bool,
+) (*BucketCompactor, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if concurrency <= 0 {
+		return nil, errors.Errorf("invalid compaction concurrency %d, must be positive", concurrency)
+	}
+	c := &BucketCompactor{
+		logger:           logger,
+		comp:             comp,
+		compactDir:       compactDir,
+		concurrency:      concurrency,
+		disk:             NewDiskBudget(diskLimit),
+		skipHaltedGroups: skipHaltedGroups,
+		haltedGroups:     map[string]error{},
+		haltedGroupsVec: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_compact_group_halted",
+			Help: "Set to 1 if compactions of the group are skipped after a halt error.",
+		}, []string{"group"}),
+		plannedCompactionsVec: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_compact_todo_compactions",
+			Help: "Number of compactions planned for the group until the planner has no work left.",
+		}, []string{"group"}),
+	}
+	if reg != nil {
+		reg.MustRegister(c.haltedGroupsVec, c.plannedCompactionsVec)
+	}
+	return c, nil
+}
+
+// Compact runs a single compaction for each of the given groups. It returns true if none of the groups had any
+// work left. After the first failed compaction no further compactions are started. Its error is returned once the
+// running compactions completed. Halted groups are skipped if enabled.
+func (c *BucketCompactor) Compact(ctx context.Context, groups []*Group) (done bool, err error) {
+	var (
+		wg     sync.WaitGroup
+		mtx    sync.Mutex
+		groupc = make(chan *Group)
+		failed = func() bool {
+			mtx.Lock()
+			defer mtx.Unlock()
+			return err != nil
+		}
+	)
+	done = true
+
+	for i := 0; i < c.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for g := range groupc {
+				id, gerr := c.compactGroup(ctx, g)
+				if gerr != nil && IsHaltError(gerr) && c.skipHaltedGroups {
+					c.haltGroup(g.Key(), gerr)
+					gerr = nil
+				}
+
+				mtx.Lock()
+				if gerr != nil && err == nil {
+					err = errors.Wrapf(gerr, "compaction of group %s", g.Key())
+				}
+				// If the returned ID has a zero value, the group had no blocks to be compacted.
+				if id != (ulid.ULID{}) {
+					done = false
+				}
+				mtx.Unlock()
+			}
+		}()
+	}
+
+	for _, g := range groups {
+		if failed() {
+			break
+		}
+		if c.isHalted(g.Key()) {
+			continue
+		}
+		groupc <- g
+	}
+	close(groupc)
+	wg.Wait()
+
+	return done, err
+}
+
+// UpdateProgress simulates the compactions of the given groups and exposes how many of them are planned for each group.
+// Groups not given anymore, e.g. because they were compacted completely, are removed from the metric.
+func (c *BucketCompactor) UpdateProgress(groups []*Group) error {
+	c.plannedCompactionsVec.Reset()
+
+	dir := filepath.Join(c.compactDir, "progress")
+	for _, g := range groups {
+		n, err := g.PlannedCompactions(dir, c.comp)
+		if err != nil {
+			return errors.Wrapf(err, "simulate compactions of group %s", g.Key())
+		}
+		c.plannedCompactionsVec.WithLabelValues(g.Key()).Set(float64(n))
+	}
+	return nil
+}
+
+func (c *BucketCompactor) haltGroup(key string, err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	level.Error(c.logger).Log("msg", "critical error in compaction of group, skipping it from now on", "group", key, "err", err)
+	c.haltedGroups[key] = err
+	c.haltedGroupsVec.WithLabelValues(key).Set(1)
+}
+
+func (c *BucketCompactor) isHalted(key string) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	_, ok := c.haltedGroups[key]
+	return ok
+}
+
+// HaltedGroups returns the number of groups skipped after a halt error.
+func (c *BucketCompactor) HaltedGroups() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return len(c.haltedGroups)
+}
+
+func (c *BucketCompactor) compactGroup(ctx context.Context, g *Group) (ulid.ULID, error) {
+	size := g.projectedDiskUsage()
+	begin := time.Now()
+	if err := c.disk.Reserve(ctx, size); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "wait for local disk space")
+	}
+	defer c.disk.Release(size)
+
+	if d := time.Since(begin); d > time.Second {
+		level.Debug(c.logger).Log("msg", "waited for local disk space", "group", g.Key(), "projected_disk_usage", size, "duration", d)
+	}
+	return g.Compact(ctx, c.compactDir, c.comp)
+}
+
+// projectedDiskUsage returns the local disk space a compaction of the group needs at most. All blocks of the
+// group may be downloaded and written again compacted. Sizes of blocks without file inventory are unknown.
+func (cg *Group) projectedDiskUsage() (size int64) {
+	cg.mtx.Lock()
+	defer cg.mtx.Unlock()
+
+	for _, m := range cg.blocks {
+		for _, f := range m.Thanos.Files {
+			size += f.SizeBytes
+		}
+	}
+	return 2 * size
+}
+
+// DiskBudget accounts the projected local disk usage of running compactions or downsamplings.
+type DiskBudget struct {
+	mtx     sync.Mutex
+	limit   int64
+	used    int64
+	running int
+	// released is closed and replaced whenever a reservation is released.
+	released chan struct{}
+}
+
+// NewDiskBudget returns a budget of limit bytes. Zero disables the limit.
+func NewDiskBudget(limit int64) *DiskBudget {
+	return &DiskBudget{limit: limit, released: make(chan struct{})}
+}
+
+// Reserve blocks until size fits into the limit or no other reservation is held. It returns the error of the context
+// if it is canceled while waiting, in which case nothing is reserved.
+func (b *DiskBudget) Reserve(ctx context.Context, size int64) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	for b.limit > 0 && b.running > 0 && b.used+size > b.limit {
+		released := b.released
+		b.mtx.Unlock()
+		select {
+		case <-ctx.Done():
+			b.mtx.Lock()
+			return ctx.Err()
+		case <-released:
+		}
+		b.mtx.Lock()
+	}
+	b.used += size
+	b.running++
+	return nil
+}
+
+// Release returns a reservation of size to the budget.
+func (b *DiskBudget) Release(size int64) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.used -= size
+	b.running--
+	close(b.released)
+	b.released = make(chan struct{})
+}
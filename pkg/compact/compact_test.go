@@ -18,6 +18,7 @@ import (
 	"github.com/improbable-eng/thanos/pkg/testutil"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/tsdb"
 	"github.com/prometheus/tsdb/labels"
 )
@@ -35,7 +36,9 @@ func TestSyncer_SyncMetas(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
 	defer cancel()
 
-	sy, err := NewSyncer(nil, nil, bkt, 0)
+	fetcher, err := block.NewMetaFetcher(nil, nil, bkt, 4, "")
+	testutil.Ok(t, err)
+	sy, err := NewSyncer(nil, nil, bkt, fetcher, SyncerOptions{})
 	testutil.Ok(t, err)
 
 	// Generate 15 blocks. Initially the first 10 are synced into memory and only the last
@@ -76,6 +79,79 @@ func TestSyncer_SyncMetas(t *testing.T) {
 	testutil.Equals(t, ids[5:], groups[0].IDs())
 }
 
+func TestSyncer_Groups_NoCompactMark(t *testing.T) {
+	bkt, cleanup, err := testutil.NewObjectStoreBucket(t)
+	testutil.Ok(t, err)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	var ids []ulid.ULID
+	for i := 0; i < 3; i++ {
+		var m block.Meta
+		m.Version = 1
+		m.ULID = ulid.MustNew(uint64(i), nil)
+
+		var buf bytes.Buffer
+		testutil.Ok(t, json.NewEncoder(&buf).Encode(&m))
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(m.ULID.String(), block.MetaFilename), &buf))
+		ids = append(ids, m.ULID)
+	}
+	testutil.Ok(t, block.MarkForNoCompact(ctx, log.NewNopLogger(), bkt, ids[1], block.ManualNoCompactReason, "test"))
+
+	fetcher, err := block.NewMetaFetcher(nil, nil, bkt, 4, "")
+	testutil.Ok(t, err)
+	sy, err := NewSyncer(nil, nil, bkt, fetcher, SyncerOptions{})
+	testutil.Ok(t, err)
+	testutil.Ok(t, sy.SyncMetas(ctx))
+
+	groups, err := sy.Groups()
+	testutil.Ok(t, err)
+	testutil.Equals(t, []ulid.ULID{ids[0], ids[2]}, groups[0].IDs())
+	testutil.Equals(t, 3, len(sy.Metas()))
+
+	// Removing the mark makes the block part of compaction again.
+	testutil.Ok(t, block.RemoveMark(ctx, log.NewNopLogger(), bkt, ids[1], block.NoCompactMarkFilename))
+	testutil.Ok(t, sy.SyncMetas(ctx))
+
+	groups, err = sy.Groups()
+	testutil.Ok(t, err)
+	testutil.Equals(t, ids, groups[0].IDs())
+}
+
+func TestSyncer_GarbageBlocks_SplitBlocks(t *testing.T) {
+	sy, err := NewSyncer(nil, nil, nil, nil, SyncerOptions{})
+	testutil.Ok(t, err)
+
+	newMeta := func(id uint64, level int, split *block.SplitShard, sources ...uint64) *block.Meta {
+		var m block.Meta
+		m.Version = 1
+		m.ULID = ulid.MustNew(id, nil)
+		m.Compaction.Level = level
+		m.Thanos.Split = split
+		for _, s := range sources {
+			m.Compaction.Sources = append(m.Compaction.Sources, ulid.MustNew(s, nil))
+		}
+		sy.blocks[m.ULID] = &m
+		return &m
+	}
+	// Sources compacted into two shards of a split block.
+	newMeta(1, 1, nil, 1)
+	newMeta(2, 1, nil, 2)
+	newMeta(3, 2, &block.SplitShard{Index: 0, Count: 2}, 1, 2)
+	newMeta(4, 2, &block.SplitShard{Index: 1, Count: 2}, 1, 2)
+	// Only one shard of a split block exists yet.
+	newMeta(5, 1, nil, 5)
+	newMeta(6, 1, nil, 6)
+	newMeta(7, 2, &block.SplitShard{Index: 0, Count: 2}, 5, 6)
+
+	ids, err := sy.GarbageBlocks(0)
+	testutil.Ok(t, err)
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Compare(ids[j]) < 0 })
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(2, nil)}, ids)
+}
+
 // TODO(bplotka): Add leaktest when this is done: https://github.com/improbable-eng/thanos/issues/234
 func TestSyncer_GarbageCollect(t *testing.T) {
 	dir, err := ioutil.TempDir("", "test-compact-gc")
@@ -143,12 +219,25 @@ func TestSyncer_GarbageCollect(t *testing.T) {
 	}
 
 	// Do one initial synchronization with the bucket.
-	sy, err := NewSyncer(nil, nil, bkt, 0)
+	fetcher, err := block.NewMetaFetcher(nil, nil, bkt, 4, "")
+	testutil.Ok(t, err)
+	sy, err := NewSyncer(nil, nil, bkt, fetcher, SyncerOptions{})
 	testutil.Ok(t, err)
 	testutil.Ok(t, sy.SyncMetas(ctx))
 
 	testutil.Ok(t, sy.GarbageCollect(ctx))
 
+	// Outdated blocks are only marked for deletion, the cleanup deletes them.
+	for _, id := range []ulid.ULID{metas[0].ULID, m1.ULID, m2.ULID} {
+		_, err := block.ReadDeletionMark(ctx, bkt, id)
+		testutil.Ok(t, err)
+	}
+	_, err = block.ReadDeletionMark(ctx, bkt, m3.ULID)
+	testutil.Equals(t, block.ErrMarkNotFound, err)
+
+	_, err = Cleanup(ctx, log.NewNopLogger(), bkt, nil, 0, 0, false)
+	testutil.Ok(t, err)
+
 	var rem []ulid.ULID
 	err = bkt.Iter(ctx, "", func(n string) error {
 		rem = append(rem, ulid.MustParse(n[:len(n)-1]))
@@ -256,6 +345,8 @@ func TestGroup_Compact(t *testing.T) {
 		metrics.compactions.WithLabelValues(""),
 		metrics.compactionFailures.WithLabelValues(""),
 		metrics.garbageCollectedBlocks,
+		metrics.quarantinedBlocks,
+		GroupOptions{Download: block.DownloadOptions{Concurrency: 2}},
 	)
 	testutil.Ok(t, err)
 
@@ -292,21 +383,367 @@ func TestGroup_Compact(t *testing.T) {
 	testutil.Assert(t, extLset.Equals(labels.FromMap(meta.Thanos.Labels)), "ext labels does not match")
 	testutil.Equals(t, int64(124), meta.Thanos.Downsample.Resolution)
 
-	// Check object storage. All blocks that were included in new compacted one should be removed.
-	err = bkt.Iter(ctx, "", func(n string) error {
-		id, ok := block.IsBlockDir(n)
-		if !ok {
-			return nil
+	// Check object storage. All blocks that were included in new compacted one should be marked for deletion.
+	for _, source := range meta.Compaction.Sources {
+		_, err := block.ReadDeletionMark(ctx, bkt, source)
+		testutil.Ok(t, err)
+	}
+	_, err = block.ReadDeletionMark(ctx, bkt, freshB)
+	testutil.Equals(t, block.ErrMarkNotFound, err)
+}
+
+func TestGroup_Compact_Vertical(t *testing.T) {
+	prepareDir, err := ioutil.TempDir("", "test-compact-prepare")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(prepareDir)
+
+	bkt, cleanup, err := testutil.NewObjectStoreBucket(t)
+	testutil.Ok(t, err)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	// Two replicas with equal external labels uploaded blocks of the same time range, partially with equal series.
+	extLset := labels.Labels{{Name: "e1", Value: "1"}}
+	var metas []*block.Meta
+	for _, c := range []struct {
+		series     []labels.Labels
+		mint, maxt int64
+	}{
+		{series: []labels.Labels{{{Name: "a", Value: "1"}}, {{Name: "a", Value: "2"}}}, mint: 0, maxt: 1000},
+		{series: []labels.Labels{{{Name: "a", Value: "2"}}, {{Name: "a", Value: "3"}}}, mint: 0, maxt: 1000},
+		{series: []labels.Labels{{{Name: "a", Value: "1"}}}, mint: 1000, maxt: 2000},
+	} {
+		id, err := testutil.CreateBlock(prepareDir, c.series, 100, c.mint, c.maxt, extLset, 0)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, bkt, filepath.Join(prepareDir, id.String())))
+
+		meta, err := block.ReadMetaFile(filepath.Join(prepareDir, id.String()))
+		testutil.Ok(t, err)
+		metas = append(metas, meta)
+	}
+
+	dir, err := ioutil.TempDir("", "test-compact")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	comp, err := tsdb.NewLeveledCompactor(nil, log.NewLogfmtLogger(os.Stderr), []int64{1000, 3000}, nil)
+	testutil.Ok(t, err)
+
+	newTestGroup := func(verticalCompaction bool) *Group {
+		metrics := newSyncerMetrics(nil)
+		g, err := newGroup(
+			nil,
+			bkt,
+			extLset,
+			0,
+			metrics.compactions.WithLabelValues(""),
+			metrics.compactionFailures.WithLabelValues(""),
+			metrics.garbageCollectedBlocks,
+			metrics.quarantinedBlocks,
+			GroupOptions{VerticalCompaction: verticalCompaction},
+		)
+		testutil.Ok(t, err)
+		for _, m := range metas {
+			testutil.Ok(t, g.Add(m))
 		}
+		return g
+	}
+
+	// Overlapping blocks halt the compaction unless vertical compaction is enabled.
+	_, err = newTestGroup(false).Compact(ctx, dir, comp)
+	testutil.Assert(t, IsHaltError(err), "expected halt error, got %v", err)
+
+	id, err := newTestGroup(true).Compact(ctx, dir, comp)
+	testutil.Ok(t, err)
+	testutil.Assert(t, id != ulid.ULID{}, "no compaction took place")
+
+	resDir := filepath.Join(dir, id.String())
+	testutil.Ok(t, block.Download(ctx, bkt, id, resDir))
+
+	meta, err := block.ReadMetaFile(resDir)
+	testutil.Ok(t, err)
+
+	testutil.Equals(t, int64(0), meta.MinTime)
+	testutil.Equals(t, int64(1000), meta.MaxTime)
+	testutil.Equals(t, uint64(3), meta.Stats.NumSeries)
+	// Samples of the series present in both blocks are deduplicated.
+	testutil.Equals(t, uint64(3*100), meta.Stats.NumSamples)
+	testutil.Equals(t, 2, meta.Compaction.Level)
+	testutil.Assert(t, extLset.Equals(labels.FromMap(meta.Thanos.Labels)), "ext labels does not match")
+	testutil.Equals(t, int64(0), meta.Thanos.Downsample.Resolution)
+
+	sources := []ulid.ULID{metas[0].ULID, metas[1].ULID}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Compare(sources[j]) < 0 })
+	testutil.Equals(t, sources, meta.Compaction.Sources)
+
+	for _, s := range sources {
+		_, err := block.ReadDeletionMark(ctx, bkt, s)
+		testutil.Ok(t, err)
+	}
+	_, err = block.ReadDeletionMark(ctx, bkt, metas[2].ULID)
+	testutil.Equals(t, block.ErrMarkNotFound, err)
+}
+
+func TestGroup_Compact_StreamUpload(t *testing.T) {
+	prepareDir, err := ioutil.TempDir("", "test-compact-prepare")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(prepareDir)
+
+	bkt, cleanup, err := testutil.NewObjectStoreBucket(t)
+	testutil.Ok(t, err)
+	defer cleanup()
 
-		for _, source := range meta.Compaction.Sources {
-			if id.Compare(source) == 0 {
-				return errors.Errorf("Unexpectedly found %s block in bucket", source.String())
-			}
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	extLset := labels.Labels{{Name: "e1", Value: "1"}}
+	var metas []*block.Meta
+	for _, c := range []struct {
+		series     []labels.Labels
+		mint, maxt int64
+	}{
+		{series: []labels.Labels{{{Name: "a", Value: "1"}}, {{Name: "a", Value: "2"}}}, mint: 0, maxt: 1000},
+		{series: []labels.Labels{{{Name: "a", Value: "1"}}, {{Name: "a", Value: "3"}}}, mint: 1000, maxt: 2000},
+		{series: []labels.Labels{{{Name: "a", Value: "4"}}}, mint: 2000, maxt: 3000},
+		// Due to TSDB compaction delay (not compacting fresh block), we need one more block to trigger compaction.
+		{series: []labels.Labels{{{Name: "a", Value: "5"}}}, mint: 3001, maxt: 4000},
+	} {
+		id, err := testutil.CreateBlock(prepareDir, c.series, 100, c.mint, c.maxt, extLset, 0)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, bkt, filepath.Join(prepareDir, id.String())))
+
+		meta, err := block.ReadMetaFile(filepath.Join(prepareDir, id.String()))
+		testutil.Ok(t, err)
+		metas = append(metas, meta)
+	}
+
+	dir, err := ioutil.TempDir("", "test-compact")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	metrics := newSyncerMetrics(nil)
+	g, err := newGroup(
+		nil,
+		bkt,
+		extLset,
+		0,
+		metrics.compactions.WithLabelValues(""),
+		metrics.compactionFailures.WithLabelValues(""),
+		metrics.garbageCollectedBlocks,
+		metrics.quarantinedBlocks,
+		GroupOptions{StreamUpload: true},
+	)
+	testutil.Ok(t, err)
+	for _, m := range metas {
+		testutil.Ok(t, g.Add(m))
+	}
+
+	comp, err := tsdb.NewLeveledCompactor(nil, log.NewLogfmtLogger(os.Stderr), []int64{1000, 3000}, nil)
+	testutil.Ok(t, err)
+
+	id, err := g.Compact(ctx, dir, comp)
+	testutil.Ok(t, err)
+	testutil.Assert(t, id != ulid.ULID{}, "no compaction took place")
+
+	// Chunks of the compacted block are never written to local disk.
+	_, err = os.Stat(filepath.Join(dir, id.String(), block.ChunksDirname))
+	testutil.Assert(t, os.IsNotExist(err), "expected no local chunks, got %v", err)
+
+	// The download verifies the streamed files against their descriptions in the meta file.
+	resDir := filepath.Join(prepareDir, "result", id.String())
+	testutil.Ok(t, block.Download(ctx, bkt, id, resDir))
+
+	meta, err := block.ReadMetaFile(resDir)
+	testutil.Ok(t, err)
+
+	testutil.Equals(t, int64(0), meta.MinTime)
+	testutil.Equals(t, int64(3000), meta.MaxTime)
+	testutil.Equals(t, uint64(4), meta.Stats.NumSeries)
+	testutil.Equals(t, uint64(5*100), meta.Stats.NumSamples)
+	testutil.Equals(t, 2, meta.Compaction.Level)
+	testutil.Assert(t, extLset.Equals(labels.FromMap(meta.Thanos.Labels)), "ext labels does not match")
+	testutil.Ok(t, block.VerifyIndex(filepath.Join(resDir, block.IndexFilename), meta.MinTime, meta.MaxTime))
+
+	for _, m := range metas[:3] {
+		_, err := block.ReadDeletionMark(ctx, bkt, m.ULID)
+		testutil.Ok(t, err)
+	}
+	_, err = block.ReadDeletionMark(ctx, bkt, metas[3].ULID)
+	testutil.Equals(t, block.ErrMarkNotFound, err)
+}
+
+func TestDiskBudget(t *testing.T) {
+	ctx := context.Background()
+	b := NewDiskBudget(100)
+
+	// A single reservation may always exceed the limit.
+	testutil.Ok(t, b.Reserve(ctx, 150))
+	reserved := make(chan error)
+	go func() {
+		reserved <- b.Reserve(ctx, 50)
+	}()
+
+	select {
+	case <-reserved:
+		t.Fatal("reservation exceeding the limit did not wait")
+	case <-time.After(100 * time.Millisecond):
+	}
+	b.Release(150)
+	testutil.Ok(t, <-reserved)
+
+	// Reservations within the limit do not wait.
+	testutil.Ok(t, b.Reserve(ctx, 50))
+	b.Release(50)
+	b.Release(50)
+	testutil.Equals(t, int64(0), b.used)
+	testutil.Equals(t, 0, b.running)
+}
+
+func TestDiskBudget_Cancel(t *testing.T) {
+	b := NewDiskBudget(100)
+	testutil.Ok(t, b.Reserve(context.Background(), 80))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reserved := make(chan error)
+	go func() {
+		reserved <- b.Reserve(ctx, 50)
+	}()
+
+	// Releases that still leave too little space keep the reservation waiting.
+	testutil.Ok(t, b.Reserve(context.Background(), 10))
+	b.Release(10)
+	select {
+	case <-reserved:
+		t.Fatal("reservation exceeding the limit did not wait")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	testutil.Equals(t, context.Canceled, <-reserved)
+
+	// The canceled reservation is not accounted.
+	b.Release(80)
+	testutil.Equals(t, int64(0), b.used)
+	testutil.Equals(t, 0, b.running)
+}
+
+func TestNewBucketCompactor(t *testing.T) {
+	_, err := NewBucketCompactor(nil, nil, nil, "", 0, 0, false)
+	testutil.NotOk(t, err)
+
+	c, err := NewBucketCompactor(nil, nil, nil, "", 2, 0, false)
+	testutil.Ok(t, err)
+
+	done, err := c.Compact(context.Background(), nil)
+	testutil.Ok(t, err)
+	testutil.Assert(t, done, "expected no work for no groups")
+}
+
+func TestBucketCompactor_SkipHaltedGroups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-compact")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	newMeta := func(id uint64, mint, maxt int64, lset map[string]string) *block.Meta {
+		m := &block.Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(id, nil), MinTime: mint, MaxTime: maxt}}
+		m.Thanos.Labels = lset
+		return m
+	}
+	metrics := newSyncerMetrics(nil)
+	newTestGroup := func(metas ...*block.Meta) *Group {
+		lset := labels.FromMap(metas[0].Thanos.Labels)
+		g, err := newGroup(
+			nil,
+			nil,
+			lset,
+			0,
+			metrics.compactions.WithLabelValues(lset.String()),
+			metrics.compactionFailures.WithLabelValues(lset.String()),
+			metrics.garbageCollectedBlocks,
+			metrics.quarantinedBlocks,
+			GroupOptions{},
+		)
+		testutil.Ok(t, err)
+		for _, m := range metas {
+			testutil.Ok(t, g.Add(m))
 		}
-		return nil
-	})
+		return g
+	}
+	// Overlapping blocks halt the compaction of the first group, while the second group has no work.
+	groups := []*Group{
+		newTestGroup(newMeta(1, 0, 100, map[string]string{"a": "1"}), newMeta(2, 50, 150, map[string]string{"a": "1"})),
+		newTestGroup(newMeta(3, 0, 100, map[string]string{"a": "2"})),
+	}
+	comp, err := tsdb.NewLeveledCompactor(nil, log.NewNopLogger(), []int64{1000, 3000}, nil)
+	testutil.Ok(t, err)
+
+	c, err := NewBucketCompactor(nil, nil, comp, dir, 1, 0, false)
+	testutil.Ok(t, err)
+	_, err = c.Compact(context.Background(), groups)
+	testutil.Assert(t, IsHaltError(err), "expected halt error, got %v", err)
+
+	c, err = NewBucketCompactor(nil, nil, comp, dir, 1, 0, true)
 	testutil.Ok(t, err)
+	for i := 0; i < 2; i++ {
+		done, err := c.Compact(context.Background(), groups)
+		testutil.Ok(t, err)
+		testutil.Assert(t, done, "expected no work left")
+		testutil.Equals(t, 1, c.HaltedGroups())
+	}
+	// The halted group was skipped by the second compaction.
+	var m dto.Metric
+	testutil.Ok(t, metrics.compactions.WithLabelValues(groups[0].Labels().String()).Write(&m))
+	testutil.Equals(t, 2.0, m.GetCounter().GetValue())
+	testutil.Ok(t, c.haltedGroupsVec.WithLabelValues(groups[0].Key()).Write(&m))
+	testutil.Equals(t, 1.0, m.GetGauge().GetValue())
+}
+
+func TestBucketCompactor_UpdateProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-compact")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	metrics := newSyncerMetrics(nil)
+	g, err := newGroup(
+		nil,
+		nil,
+		labels.Labels{{Name: "a", Value: "1"}},
+		0,
+		metrics.compactions.WithLabelValues(""),
+		metrics.compactionFailures.WithLabelValues(""),
+		metrics.garbageCollectedBlocks,
+		metrics.quarantinedBlocks,
+		GroupOptions{},
+	)
+	testutil.Ok(t, err)
+	// Seven adjacent level 1 blocks. The first two ranges of three blocks are compacted, while the most recent
+	// block is never planned.
+	for i := 0; i < 7; i++ {
+		id := ulid.MustNew(uint64(i+1), nil)
+		m := &block.Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: int64(i * 1000), MaxTime: int64((i + 1) * 1000)}}
+		m.Compaction.Level = 1
+		m.Compaction.Sources = []ulid.ULID{id}
+		m.Thanos.Labels = map[string]string{"a": "1"}
+		testutil.Ok(t, g.Add(m))
+	}
+	comp, err := tsdb.NewLeveledCompactor(nil, log.NewNopLogger(), []int64{1000, 3000}, nil)
+	testutil.Ok(t, err)
+
+	n, err := g.PlannedCompactions(filepath.Join(dir, "plan"), comp)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, n)
+	// The simulation does not change the group.
+	testutil.Equals(t, 7, len(g.IDs()))
+
+	c, err := NewBucketCompactor(nil, nil, comp, dir, 1, 0, false)
+	testutil.Ok(t, err)
+	testutil.Ok(t, c.UpdateProgress([]*Group{g}))
+
+	var m dto.Metric
+	testutil.Ok(t, c.plannedCompactionsVec.WithLabelValues(g.Key()).Write(&m))
+	testutil.Equals(t, 2.0, m.GetGauge().GetValue())
 }
 
 func TestHaltError(t *testing.T) {
@@ -2,16 +2,19 @@ package downsample
 
 import (
 	"math"
+	"math/rand"
+	"os"
 	"path/filepath"
-	"sort"
+	"strings"
+	"time"
 
 	"github.com/improbable-eng/thanos/pkg/block"
 	"github.com/prometheus/prometheus/pkg/value"
 	"github.com/prometheus/tsdb/chunkenc"
 
-	"github.com/go-kit/kit/log"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/tsdb"
 	"github.com/prometheus/tsdb/chunks"
 	"github.com/prometheus/tsdb/index"
@@ -25,7 +28,72 @@ const (
 	ResLevel2 = int64(60 * 60 * 1000) // 1 hour in milliseconds
 )
 
+// Level is a step of the downsampling ladder. Blocks of the resolution of the previous level, or raw blocks for the
+// first level, are downsampled to Resolution once they cover at least MinSourceRange. Both are in milliseconds.
+type Level struct {
+	Resolution     int64
+	MinSourceRange int64
+}
+
+// DefaultLevels downsample raw blocks of 40 hours to 5 minutes and blocks of 10 days to 1 hour resolution.
+// The source ranges ensure that downsampled series have roughly 2 chunks.
+var DefaultLevels = []Level{
+	{Resolution: ResLevel1, MinSourceRange: 40 * 60 * 60 * 1000},
+	{Resolution: ResLevel2, MinSourceRange: 10 * 24 * 60 * 60 * 1000},
+}
+
+// ParseLevels parses downsampling levels given as <resolution>:<min source range>, e.g. 5m:40h.
+// Resolutions must increase from level to level.
+func ParseLevels(specs []string) ([]Level, error) {
+	var levels []Level
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid downsampling level %q, expected <resolution>:<min source range>", spec)
+		}
+		res, err := model.ParseDuration(parts[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse resolution of downsampling level %q", spec)
+		}
+		rng, err := model.ParseDuration(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse min source range of downsampling level %q", spec)
+		}
+		l := Level{
+			Resolution:     int64(time.Duration(res) / time.Millisecond),
+			MinSourceRange: int64(time.Duration(rng) / time.Millisecond),
+		}
+		prev := ResLevel0
+		if len(levels) > 0 {
+			prev = levels[len(levels)-1].Resolution
+		}
+		if l.Resolution <= prev {
+			return nil, errors.Errorf("resolution of downsampling level %q must be higher than the one of the previous level", spec)
+		}
+		if l.MinSourceRange < l.Resolution {
+			return nil, errors.Errorf("min source range of downsampling level %q must not be lower than its resolution", spec)
+		}
+		levels = append(levels, l)
+	}
+	return levels, nil
+}
+
+// NextLevel returns the level blocks of the given resolution are downsampled to. It returns false if there is none,
+// i.e. the resolution is the one of the last level or of none of the levels.
+func NextLevel(levels []Level, resolution int64) (Level, bool) {
+	prev := ResLevel0
+	for _, l := range levels {
+		if prev == resolution {
+			return l, true
+		}
+		prev = l.Resolution
+	}
+	return Level{}, false
+}
+
 // Downsample downsamples the given block. It writes a new block into dir and returns its ID.
+// Series are downsampled one by one and written to disk right away, so the memory usage is bounded by
+// the largest series and the postings of the new block rather than by the size of the block.
 func Downsample(
 	origMeta *block.Meta,
 	b tsdb.BlockReader,
@@ -48,25 +116,42 @@ func Downsample(
 	}
 	defer chunkr.Close()
 
-	rng := origMeta.MaxTime - origMeta.MinTime
+	symbols, err := indexr.Symbols()
+	if err != nil {
+		return id, errors.Wrap(err, "read symbols")
+	}
+
+	id = ulid.MustNew(ulid.Now(), rand.New(rand.NewSource(time.Now().UnixNano())))
+	bdir := filepath.Join(dir, id.String())
+	tmp := bdir + ".tmp"
 
-	// Write downsampled data in a custom memory block where we have fine-grained control
-	// over created chunks.
-	// This is necessary since we need to inject special values at the end of chunks for
-	// some aggregations.
-	newb := newMemBlock()
+	// The block is written into a temporary directory, so aborted downsamplings never leave partial blocks behind.
+	if err := os.RemoveAll(tmp); err != nil {
+		return id, errors.Wrap(err, "clean temporary block dir")
+	}
+	defer os.RemoveAll(tmp)
+
+	w, err := block.NewStreamedBlockWriter(tmp, symbols)
+	if err != nil {
+		return id, err
+	}
+	defer w.Close()
 
 	pall, err := indexr.Postings(index.AllPostingsKey())
 	if err != nil {
 		return id, errors.Wrap(err, "get all postings list")
 	}
+	// The series of the new block have to be written in the order of their label sets, which is the order of the
+	// series references of the index.
+	pall = indexr.SortedPostings(pall)
+
 	var (
 		aggrChunks []*AggrChunk
 		all        []sample
 		chks       []chunks.Meta
+		lset       labels.Labels
 	)
 	for pall.Next() {
-		var lset labels.Labels
 		chks = chks[:0]
 		all = all[:0]
 		aggrChunks = aggrChunks[:0]
@@ -93,7 +178,9 @@ func Downsample(
 					return id, errors.Wrapf(err, "expand chunk %d", c.Ref)
 				}
 			}
-			newb.addSeries(&series{lset: lset, chunks: downsampleRaw(all, resolution)})
+			if err := w.AddSeries(lset, downsampleRaw(all, resolution)); err != nil {
+				return id, errors.Wrapf(err, "write series %s", lset)
+			}
 			continue
 		}
 
@@ -112,114 +199,41 @@ func Downsample(
 		if err != nil {
 			return id, errors.Wrap(err, "downsample aggregate block")
 		}
-		newb.addSeries(&series{lset: lset, chunks: res})
+		if err := w.AddSeries(lset, res); err != nil {
+			return id, errors.Wrapf(err, "write series %s", lset)
+		}
 	}
 	if pall.Err() != nil {
 		return id, errors.Wrap(pall.Err(), "iterate series set")
 	}
-	comp, err := tsdb.NewLeveledCompactor(nil, log.NewNopLogger(), []int64{rng}, NewPool())
-	if err != nil {
-		return id, errors.Wrap(err, "create compactor")
-	}
-	id, err = comp.Write(dir, newb, origMeta.MinTime, origMeta.MaxTime)
-	if err != nil {
-		return id, errors.Wrap(err, "compact head")
-	}
-	bdir := filepath.Join(dir, id.String())
-
-	_, err = block.Finalize(bdir, origMeta.Thanos.Labels, resolution, &origMeta.BlockMeta)
-	if err != nil {
-		return id, errors.Wrapf(err, "failed to finalize the block %s", bdir)
-	}
-	return id, nil
-}
-
-// memBlock is an in-memory block that implements a subset of the tsdb.BlockReader interface
-// to allow tsdb.LeveledCompactor to persist the data as a block.
-type memBlock struct {
-	// Dummies to implement unused methods.
-	tsdb.IndexReader
-
-	symbols  map[string]struct{}
-	postings []uint64
-	series   []*series
-	chunks   []chunkenc.Chunk
-}
-
-func newMemBlock() *memBlock {
-	return &memBlock{symbols: map[string]struct{}{}}
-}
-
-func (b *memBlock) addSeries(s *series) {
-	sid := uint64(len(b.series))
-	b.postings = append(b.postings, sid)
-	b.series = append(b.series, s)
-
-	for _, l := range s.lset {
-		b.symbols[l.Name] = struct{}{}
-		b.symbols[l.Value] = struct{}{}
+	if err := w.Finish(); err != nil {
+		return id, err
 	}
 
-	for i, cm := range s.chunks {
-		cid := uint64(len(b.chunks))
-		s.chunks[i].Ref = cid
-		b.chunks = append(b.chunks, cm.Chunk)
+	meta := &block.Meta{Version: 1}
+	meta.ULID = id
+	meta.MinTime = origMeta.MinTime
+	meta.MaxTime = origMeta.MaxTime
+	meta.Stats = w.Stats()
+	if err := block.WriteMetaFile(tmp, meta); err != nil {
+		return id, errors.Wrap(err, "write meta file")
 	}
-}
-
-func (b *memBlock) Postings(name, val string) (index.Postings, error) {
-	allName, allVal := index.AllPostingsKey()
-
-	if name != allName || val != allVal {
-		return nil, errors.New("unsupported call to Postings()")
+	if err := os.Rename(tmp, bdir); err != nil {
+		return id, errors.Wrap(err, "rename block dir")
 	}
-	sort.Slice(b.postings, func(i, j int) bool {
-		return labels.Compare(b.series[b.postings[i]].lset, b.series[b.postings[j]].lset) < 0
-	})
-	return index.NewListPostings(b.postings), nil
-}
 
-func (b *memBlock) Series(id uint64, lset *labels.Labels, chks *[]chunks.Meta) error {
-	if id >= uint64(len(b.series)) {
-		return errors.Wrapf(tsdb.ErrNotFound, "series with ID %d does not exist", id)
+	newMeta, err := block.Finalize(bdir, origMeta.Thanos.Labels, resolution, &origMeta.BlockMeta)
+	if err != nil {
+		return id, errors.Wrapf(err, "failed to finalize the block %s", bdir)
 	}
-	s := b.series[id]
-
-	*lset = append((*lset)[:0], s.lset...)
-	*chks = append((*chks)[:0], s.chunks...)
-
-	return nil
-}
-
-func (b *memBlock) Chunk(id uint64) (chunkenc.Chunk, error) {
-	if id >= uint64(len(b.chunks)) {
-		return nil, errors.Wrapf(tsdb.ErrNotFound, "chunk with ID %d does not exist", id)
+	// The downsampled block holds the same shard of series as a split original block.
+	if origMeta.Thanos.Split != nil {
+		newMeta.Thanos.Split = origMeta.Thanos.Split
+		if err := block.WriteMetaFile(bdir, newMeta); err != nil {
+			return id, errors.Wrapf(err, "write meta of block %s", bdir)
+		}
 	}
-	return b.chunks[id], nil
-}
-
-func (b *memBlock) Symbols() (map[string]struct{}, error) {
-	return b.symbols, nil
-}
-
-func (b *memBlock) SortedPostings(p index.Postings) index.Postings {
-	return p
-}
-
-func (b *memBlock) Index() (tsdb.IndexReader, error) {
-	return b, nil
-}
-
-func (b *memBlock) Chunks() (tsdb.ChunkReader, error) {
-	return b, nil
-}
-
-func (b *memBlock) Tombstones() (tsdb.TombstoneReader, error) {
-	return tsdb.EmptyTombstoneReader(), nil
-}
-
-func (b *memBlock) Close() error {
-	return nil
+	return id, nil
 }
 
 // currentWindow returns the end timestamp of the window that t falls into.
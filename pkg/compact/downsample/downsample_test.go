@@ -5,6 +5,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
 
 	"github.com/prometheus/prometheus/pkg/value"
@@ -16,6 +17,8 @@ import (
 	"github.com/fortytw2/leaktest"
 	"github.com/improbable-eng/thanos/pkg/block"
 	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/pkg/errors"
+	"github.com/prometheus/tsdb"
 	"github.com/prometheus/tsdb/chunkenc"
 	"github.com/prometheus/tsdb/index"
 	"github.com/prometheus/tsdb/labels"
@@ -34,6 +37,42 @@ func TestExpandChunkIterator(t *testing.T) {
 	testutil.Equals(t, []sample{{100, 1}, {200, 2}, {200, 3}, {201, 4}, {300, 6}, {500, 5}}, res)
 }
 
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels([]string{"5m:40h", "1h:10d", "6h:60d"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []Level{
+		{Resolution: ResLevel1, MinSourceRange: 40 * ResLevel2},
+		{Resolution: ResLevel2, MinSourceRange: 10 * 24 * ResLevel2},
+		{Resolution: 6 * ResLevel2, MinSourceRange: 60 * 24 * ResLevel2},
+	}, levels)
+
+	l, ok := NextLevel(levels, ResLevel0)
+	testutil.Assert(t, ok, "expected level for raw blocks")
+	testutil.Equals(t, ResLevel1, l.Resolution)
+	l, ok = NextLevel(levels, ResLevel2)
+	testutil.Assert(t, ok, "expected level for 1h blocks")
+	testutil.Equals(t, 6*ResLevel2, l.Resolution)
+	_, ok = NextLevel(levels, 6*ResLevel2)
+	testutil.Assert(t, !ok, "expected no level after the last one")
+	_, ok = NextLevel(levels, 2*ResLevel2)
+	testutil.Assert(t, !ok, "expected no level for unknown resolution")
+	_, ok = NextLevel(nil, ResLevel0)
+	testutil.Assert(t, !ok, "expected no level without levels")
+
+	for _, specs := range [][]string{
+		{"5m"},
+		{"5m:40h:1"},
+		{"x:40h"},
+		{"5m:x"},
+		{"1h:10d", "5m:40h"},
+		{"5m:40h", "5m:10d"},
+		{"1h:30m"},
+	} {
+		_, err := ParseLevels(specs)
+		testutil.Assert(t, err != nil, "expected error for levels %v", specs)
+	}
+}
+
 func TestDownsampleRaw(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 
@@ -203,6 +242,17 @@ func testDownsample(t *testing.T, data []*downsampleTestSet, meta *block.Meta, r
 
 	testutil.Equals(t, len(exp), len(got))
 
+	// Only the finished block is left in dir.
+	files, err := ioutil.ReadDir(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(files))
+	testutil.Equals(t, id.String(), files[0].Name())
+
+	resMeta, err := block.ReadMetaFile(filepath.Join(dir, id.String()))
+	testutil.Ok(t, err)
+	testutil.Equals(t, uint64(len(data)), resMeta.Stats.NumSeries)
+	testutil.Equals(t, resolution, resMeta.Thanos.Downsample.Resolution)
+
 	for h, ser := range exp {
 		for _, at := range []AggrType{AggrCount, AggrSum, AggrMin, AggrMax, AggrCounter} {
 			t.Logf("series %d, type %s", h, at)
@@ -289,3 +339,91 @@ func (it *sampleIterator) Seek(int64) bool {
 func (it *sampleIterator) At() (t int64, v float64) {
 	return it.l[it.i].t, it.l[it.i].v
 }
+
+// memBlock is an in-memory block that implements a subset of the tsdb.BlockReader interface
+// to serve test data as input of downsampling.
+type memBlock struct {
+	// Dummies to implement unused methods.
+	tsdb.IndexReader
+
+	symbols  map[string]struct{}
+	postings []uint64
+	series   []*series
+	chunks   []chunkenc.Chunk
+}
+
+func newMemBlock() *memBlock {
+	return &memBlock{symbols: map[string]struct{}{}}
+}
+
+func (b *memBlock) addSeries(s *series) {
+	sid := uint64(len(b.series))
+	b.postings = append(b.postings, sid)
+	b.series = append(b.series, s)
+
+	for _, l := range s.lset {
+		b.symbols[l.Name] = struct{}{}
+		b.symbols[l.Value] = struct{}{}
+	}
+
+	for i, cm := range s.chunks {
+		cid := uint64(len(b.chunks))
+		s.chunks[i].Ref = cid
+		b.chunks = append(b.chunks, cm.Chunk)
+	}
+}
+
+func (b *memBlock) Postings(name, val string) (index.Postings, error) {
+	allName, allVal := index.AllPostingsKey()
+
+	if name != allName || val != allVal {
+		return nil, errors.New("unsupported call to Postings()")
+	}
+	sort.Slice(b.postings, func(i, j int) bool {
+		return labels.Compare(b.series[b.postings[i]].lset, b.series[b.postings[j]].lset) < 0
+	})
+	return index.NewListPostings(b.postings), nil
+}
+
+func (b *memBlock) Series(id uint64, lset *labels.Labels, chks *[]chunks.Meta) error {
+	if id >= uint64(len(b.series)) {
+		return errors.Wrapf(tsdb.ErrNotFound, "series with ID %d does not exist", id)
+	}
+	s := b.series[id]
+
+	*lset = append((*lset)[:0], s.lset...)
+	*chks = append((*chks)[:0], s.chunks...)
+
+	return nil
+}
+
+func (b *memBlock) Chunk(id uint64) (chunkenc.Chunk, error) {
+	if id >= uint64(len(b.chunks)) {
+		return nil, errors.Wrapf(tsdb.ErrNotFound, "chunk with ID %d does not exist", id)
+	}
+	return b.chunks[id], nil
+}
+
+func (b *memBlock) Symbols() (map[string]struct{}, error) {
+	return b.symbols, nil
+}
+
+func (b *memBlock) SortedPostings(p index.Postings) index.Postings {
+	return p
+}
+
+func (b *memBlock) Index() (tsdb.IndexReader, error) {
+	return b, nil
+}
+
+func (b *memBlock) Chunks() (tsdb.ChunkReader, error) {
+	return b, nil
+}
+
+func (b *memBlock) Tombstones() (tsdb.TombstoneReader, error) {
+	return tsdb.EmptyTombstoneReader(), nil
+}
+
+func (b *memBlock) Close() error {
+	return nil
+}
@@ -0,0 +1,50 @@
+package compact
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/pkg/errors"
+)
+
+// ApplyRetentionPolicyByResolution marks for deletion all blocks whose data is entirely older than
+// the retention configured for their resolution. Resolutions without retention or with zero retention
+// are kept forever. With dryRun set, blocks are only reported. It returns the number of affected blocks.
+func ApplyRetentionPolicyByResolution(
+	ctx context.Context,
+	logger log.Logger,
+	bkt objstore.Bucket,
+	metas []*block.Meta,
+	retentionByResolution map[int64]time.Duration,
+	dryRun bool,
+) (int, error) {
+	now := time.Now()
+	n := 0
+
+	for _, m := range metas {
+		retention, ok := retentionByResolution[m.Thanos.Downsample.Resolution]
+		if !ok || retention.Seconds() == 0 {
+			continue
+		}
+		maxTime := time.Unix(m.MaxTime/1000, 0)
+		if now.Sub(maxTime) <= retention {
+			continue
+		}
+		n++
+
+		level.Info(logger).Log("msg", "applying retention: marking block for deletion", "id", m.ULID,
+			"maxTime", maxTime.UTC().Format(time.RFC3339), "resolution", m.Thanos.Downsample.Resolution, "dryRun", dryRun)
+		if dryRun {
+			continue
+		}
+		if err := block.MarkForDeletion(ctx, logger, bkt, m.ULID, fmt.Sprintf("retention of %s exceeded", retention)); err != nil {
+			return n, errors.Wrapf(err, "mark block %s for deletion", m.ULID)
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,56 @@
+package compact
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/compact/downsample"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/tsdb"
+)
+
+func TestApplyRetentionPolicyByResolution(t *testing.T) {
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+
+	newMeta := func(id uint64, res int64, age time.Duration) *block.Meta {
+		m := &block.Meta{
+			Version: 1,
+			BlockMeta: tsdb.BlockMeta{
+				ULID:    ulid.MustNew(id, nil),
+				MaxTime: time.Now().Add(-age).UnixNano() / int64(time.Millisecond),
+			},
+		}
+		m.Thanos.Downsample.Resolution = res
+		return m
+	}
+	metas := []*block.Meta{
+		newMeta(1, downsample.ResLevel0, 48*time.Hour),
+		newMeta(2, downsample.ResLevel0, 12*time.Hour),
+		newMeta(3, downsample.ResLevel1, 48*time.Hour),
+		newMeta(4, downsample.ResLevel2, 480*time.Hour),
+	}
+	retention := map[int64]time.Duration{
+		downsample.ResLevel0: 24 * time.Hour,
+		downsample.ResLevel1: 72 * time.Hour,
+	}
+
+	n, err := ApplyRetentionPolicyByResolution(ctx, log.NewNopLogger(), bkt, metas, retention, true)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, n)
+	testutil.Equals(t, 0, len(bkt.Objects()))
+
+	n, err = ApplyRetentionPolicyByResolution(ctx, log.NewNopLogger(), bkt, metas, retention, false)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, n)
+
+	_, ok := bkt.Objects()[path.Join(metas[0].ULID.String(), block.DeletionMarkFilename)]
+	testutil.Assert(t, ok, "expected block %s to be marked for deletion", metas[0].ULID)
+	testutil.Equals(t, 1, len(bkt.Objects()))
+}
@@ -0,0 +1,170 @@
+// Package dns resolves addresses of components through DNS lookups.
+package dns
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// QType is the type of DNS lookup, given as a prefix of the address.
+type QType string
+
+const (
+	// A looks up A and AAAA records of the host, e.g. "dns+thanos-store:10901". The port is mandatory.
+	A = QType("dns")
+	// SRV looks up SRV records of the host and uses their targets and ports, e.g. "dnssrv+_grpc._tcp.thanos-store".
+	SRV = QType("dnssrv")
+)
+
+// Resolver looks up DNS records. It is satisfied by net.Resolver.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+// Provider resolves addresses with a lookup type prefix and keeps the results of the last resolution.
+// Addresses without a prefix are returned as they are.
+type Provider struct {
+	logger   log.Logger
+	resolver Resolver
+
+	mtx      sync.Mutex
+	resolved map[string][]string
+
+	lookups  prometheus.Counter
+	failures prometheus.Counter
+}
+
+// NewProvider returns a new Provider. The name distinguishes metrics of providers in the same process.
+// The resolver defaults to net.DefaultResolver if nil.
+func NewProvider(logger log.Logger, reg prometheus.Registerer, resolver Resolver, name string) *Provider {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	p := &Provider{
+		logger:   logger,
+		resolver: resolver,
+		resolved: map[string][]string{},
+		lookups: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "thanos_dns_lookups_total",
+			Help:        "The number of DNS lookups resolutions attempts.",
+			ConstLabels: prometheus.Labels{"provider": name},
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "thanos_dns_failures_total",
+			Help:        "The number of DNS lookup failures.",
+			ConstLabels: prometheus.Labels{"provider": name},
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(p.lookups, p.failures)
+	}
+	return p
+}
+
+// IsDynamicNode returns true if the address has a lookup type prefix and has to be resolved.
+func IsDynamicNode(addr string) bool {
+	qtype, _ := splitAddr(addr)
+	return qtype != ""
+}
+
+// Resolve resolves all given addresses. Results of addresses that fail to resolve are kept from the previous
+// resolution, so a temporary DNS outage does not remove all nodes. Addresses not given anymore are dropped.
+func (p *Provider) Resolve(ctx context.Context, addrs []string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	resolved := make(map[string][]string, len(addrs))
+	for _, addr := range addrs {
+		qtype, name := splitAddr(addr)
+		if qtype == "" {
+			resolved[addr] = []string{addr}
+			continue
+		}
+
+		p.lookups.Inc()
+		res, err := p.resolve(ctx, qtype, name)
+		if err != nil {
+			p.failures.Inc()
+			level.Error(p.logger).Log("msg", "dns resolution failed", "addr", addr, "err", err)
+			if prev, ok := p.resolved[addr]; ok {
+				resolved[addr] = prev
+			}
+			continue
+		}
+		if len(res) == 0 {
+			level.Warn(p.logger).Log("msg", "dns resolution returned no addresses", "addr", addr)
+		}
+		resolved[addr] = res
+	}
+	p.resolved = resolved
+}
+
+// Addresses returns unique sorted addresses of the last resolution.
+func (p *Provider) Addresses() []string {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	unique := map[string]struct{}{}
+	for _, addrs := range p.resolved {
+		for _, a := range addrs {
+			unique[a] = struct{}{}
+		}
+	}
+	res := make([]string, 0, len(unique))
+	for a := range unique {
+		res = append(res, a)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (p *Provider) resolve(ctx context.Context, qtype QType, name string) ([]string, error) {
+	var res []string
+	switch qtype {
+	case A:
+		host, port, err := net.SplitHostPort(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "missing port in address %q", name)
+		}
+		ips, err := p.resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, errors.Wrapf(err, "lookup IP addresses %q", host)
+		}
+		for _, ip := range ips {
+			res = append(res, net.JoinHostPort(ip.String(), port))
+		}
+	case SRV:
+		_, recs, err := p.resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "lookup SRV records %q", name)
+		}
+		for _, rec := range recs {
+			res = append(res, net.JoinHostPort(strings.TrimSuffix(rec.Target, "."), strconv.Itoa(int(rec.Port))))
+		}
+	default:
+		return nil, errors.Errorf("invalid lookup type %q", qtype)
+	}
+	return res, nil
+}
+
+// splitAddr returns the lookup type and the name to resolve. The lookup type is empty if the address has no prefix.
+func splitAddr(addr string) (QType, string) {
+	ps := strings.SplitN(addr, "+", 2)
+	if len(ps) != 2 {
+		return "", addr
+	}
+	return QType(ps[0]), ps[1]
+}
@@ -0,0 +1,70 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/pkg/errors"
+)
+
+type mockResolver struct {
+	ips  map[string][]net.IPAddr
+	srvs map[string][]*net.SRV
+	err  error
+}
+
+func (r *mockResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.ips[host], nil
+}
+
+func (r *mockResolver) LookupSRV(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+	if r.err != nil {
+		return "", nil, r.err
+	}
+	return "", r.srvs[name], nil
+}
+
+func TestProvider(t *testing.T) {
+	r := &mockResolver{
+		ips: map[string][]net.IPAddr{
+			"store": {{IP: net.ParseIP("10.0.0.1")}, {IP: net.ParseIP("10.0.0.2")}},
+		},
+		srvs: map[string][]*net.SRV{
+			"_grpc._tcp.sidecar": {{Target: "sidecar-0.example.org.", Port: 10901}, {Target: "sidecar-1.example.org.", Port: 10901}},
+		},
+	}
+	p := NewProvider(nil, nil, r, "test")
+
+	p.Resolve(context.Background(), []string{"127.0.0.1:10901", "dns+store:10901", "dnssrv+_grpc._tcp.sidecar", "dns+store:10902"})
+	testutil.Equals(t, []string{
+		"10.0.0.1:10901",
+		"10.0.0.1:10902",
+		"10.0.0.2:10901",
+		"10.0.0.2:10902",
+		"127.0.0.1:10901",
+		"sidecar-0.example.org:10901",
+		"sidecar-1.example.org:10901",
+	}, p.Addresses())
+
+	// Failed lookups keep previous results, removed addresses are dropped.
+	r.err = errors.New("temporary failure")
+	p.Resolve(context.Background(), []string{"dns+store:10901", "dns+new:10901"})
+	testutil.Equals(t, []string{"10.0.0.1:10901", "10.0.0.2:10901"}, p.Addresses())
+
+	// Port is required for A lookups.
+	r.err = nil
+	p.Resolve(context.Background(), []string{"dns+store"})
+	testutil.Equals(t, []string{}, p.Addresses())
+}
+
+func TestIsDynamicNode(t *testing.T) {
+	testutil.Assert(t, !IsDynamicNode("127.0.0.1:10901"), "static address")
+	testutil.Assert(t, !IsDynamicNode("store:10901"), "static address")
+	testutil.Assert(t, IsDynamicNode("dns+store:10901"), "dns address")
+	testutil.Assert(t, IsDynamicNode("dnssrv+_grpc._tcp.store"), "dnssrv address")
+}
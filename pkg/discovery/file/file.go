@@ -0,0 +1,106 @@
+// Package file discovers addresses of components from files in the Prometheus file_sd format.
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// TargetGroup is a group of targets as defined in the Prometheus file_sd format. Labels are accepted
+// for compatibility with existing files but are not used.
+type TargetGroup struct {
+	Targets []string          `yaml:"targets" json:"targets"`
+	Labels  map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// Discovery reads addresses from files matching the given glob patterns. Files with the .json extension
+// are decoded as JSON, all others as YAML.
+type Discovery struct {
+	patterns []string
+
+	mtx     sync.Mutex
+	current []string
+}
+
+// NewDiscovery returns a new Discovery reading the files matching the given patterns.
+func NewDiscovery(patterns []string) *Discovery {
+	return &Discovery{patterns: patterns}
+}
+
+// Addresses returns unique sorted addresses read by the last successful refresh.
+func (d *Discovery) Addresses() []string {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.current
+}
+
+// Refresh reads all files again. Addresses of the previous refresh are kept if any of the files cannot be read,
+// so a partially written file does not remove the targets.
+func (d *Discovery) Refresh() error {
+	unique := map[string]struct{}{}
+
+	for _, p := range d.patterns {
+		files, err := filepath.Glob(p)
+		if err != nil {
+			return errors.Wrapf(err, "invalid pattern %q", p)
+		}
+		for _, fn := range files {
+			tgs, err := readFile(fn)
+			if err != nil {
+				return err
+			}
+			for _, tg := range tgs {
+				for _, t := range tg.Targets {
+					unique[t] = struct{}{}
+				}
+			}
+		}
+	}
+
+	res := make([]string, 0, len(unique))
+	for a := range unique {
+		res = append(res, a)
+	}
+	sort.Strings(res)
+
+	d.mtx.Lock()
+	d.current = res
+	d.mtx.Unlock()
+
+	return nil
+}
+
+func readFile(fn string) ([]*TargetGroup, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read file %s", fn)
+	}
+
+	var tgs []*TargetGroup
+	if strings.ToLower(filepath.Ext(fn)) == ".json" {
+		err = json.Unmarshal(b, &tgs)
+	} else {
+		err = yaml.UnmarshalStrict(b, &tgs)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "decode file %s", fn)
+	}
+	for i, tg := range tgs {
+		if tg == nil {
+			return nil, errors.Errorf("nil target group item %d in file %s", i, fn)
+		}
+		for _, t := range tg.Targets {
+			if t == "" {
+				return nil, errors.Errorf("empty target in file %s", fn)
+			}
+		}
+	}
+	return tgs, nil
+}
@@ -0,0 +1,39 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+func TestDiscovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-file-sd")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "a.yaml"), []byte(`
+- targets: ['store-0:10901', 'store-1:10901']
+  labels:
+    env: prod
+`), 0644))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "b.json"), []byte(`[{"targets": ["sidecar-0:10901", "store-0:10901"]}]`), 0644))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "ignored.txt"), []byte(`invalid`), 0644))
+
+	d := NewDiscovery([]string{filepath.Join(dir, "*.yaml"), filepath.Join(dir, "*.json")})
+	testutil.Equals(t, 0, len(d.Addresses()))
+
+	testutil.Ok(t, d.Refresh())
+	testutil.Equals(t, []string{"sidecar-0:10901", "store-0:10901", "store-1:10901"}, d.Addresses())
+
+	// Invalid file keeps previous addresses.
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "b.json"), []byte(`[{"targets": [`), 0644))
+	testutil.NotOk(t, d.Refresh())
+	testutil.Equals(t, []string{"sidecar-0:10901", "store-0:10901", "store-1:10901"}, d.Addresses())
+
+	testutil.Ok(t, os.Remove(filepath.Join(dir, "b.json")))
+	testutil.Ok(t, d.Refresh())
+	testutil.Equals(t, []string{"store-0:10901", "store-1:10901"}, d.Addresses())
+}
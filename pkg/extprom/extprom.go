@@ -0,0 +1,130 @@
+// Package extprom extends the Prometheus client library with helpers it does not provide in the version we use.
+package extprom
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// WrapRegistererWith returns a Registerer that adds the given labels to all metrics of the collectors registered
+// through it. The collectors are registered with a separate registry, which is collected by reg, so collectors
+// registered through different label sets do not conflict even if they expose the same metrics with the same
+// constant labels, e.g. the metrics of two clients of the same bucket.
+func WrapRegistererWith(labels prometheus.Labels, reg prometheus.Registerer) prometheus.Registerer {
+	return &wrappingRegisterer{
+		reg:    reg,
+		labels: labels,
+		inner:  prometheus.NewRegistry(),
+	}
+}
+
+type wrappingRegisterer struct {
+	reg    prometheus.Registerer
+	labels prometheus.Labels
+	inner  *prometheus.Registry
+
+	once sync.Once
+	err  error
+}
+
+func (r *wrappingRegisterer) Register(c prometheus.Collector) error {
+	// The inner registry is exposed through reg with the first registered collector, so a conflicting label set
+	// is reported on first use.
+	r.once.Do(func() {
+		r.err = r.reg.Register(&labelingCollector{
+			gatherer: r.inner,
+			labels:   r.labels,
+			desc:     prometheus.NewDesc("thanos_wrapped_registry", "Registry with labels added to all metrics.", nil, r.labels),
+		})
+	})
+	if r.err != nil {
+		return r.err
+	}
+	return r.inner.Register(c)
+}
+
+func (r *wrappingRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *wrappingRegisterer) Unregister(c prometheus.Collector) bool {
+	return r.inner.Unregister(c)
+}
+
+// labelingCollector collects the metrics of the gatherer with the additional labels. Its descriptor only identifies
+// the label set towards the registry, the metrics are collected with descriptors of their own.
+type labelingCollector struct {
+	gatherer prometheus.Gatherer
+	labels   prometheus.Labels
+	desc     *prometheus.Desc
+}
+
+func (c *labelingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *labelingCollector) Collect(ch chan<- prometheus.Metric) {
+	mfs, err := c.gatherer.Gather()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+	}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			ch <- c.labeledMetric(mf, m)
+		}
+	}
+}
+
+func (c *labelingCollector) labeledMetric(mf *dto.MetricFamily, m *dto.Metric) prometheus.Metric {
+	var names, values []string
+	for _, lp := range m.GetLabel() {
+		names = append(names, lp.GetName())
+		values = append(values, lp.GetValue())
+	}
+	extra := make([]string, 0, len(c.labels))
+	for n := range c.labels {
+		extra = append(extra, n)
+	}
+	sort.Strings(extra)
+	for _, n := range extra {
+		names = append(names, n)
+		values = append(values, c.labels[n])
+	}
+	desc := prometheus.NewDesc(mf.GetName(), mf.GetHelp(), names, nil)
+
+	var (
+		metric prometheus.Metric
+		err    error
+	)
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		metric, err = prometheus.NewConstMetric(desc, prometheus.CounterValue, m.GetCounter().GetValue(), values...)
+	case dto.MetricType_GAUGE:
+		metric, err = prometheus.NewConstMetric(desc, prometheus.GaugeValue, m.GetGauge().GetValue(), values...)
+	case dto.MetricType_HISTOGRAM:
+		buckets := map[float64]uint64{}
+		for _, b := range m.GetHistogram().GetBucket() {
+			buckets[b.GetUpperBound()] = b.GetCumulativeCount()
+		}
+		metric, err = prometheus.NewConstHistogram(desc, m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum(), buckets, values...)
+	case dto.MetricType_SUMMARY:
+		quantiles := map[float64]float64{}
+		for _, q := range m.GetSummary().GetQuantile() {
+			quantiles[q.GetQuantile()] = q.GetValue()
+		}
+		metric, err = prometheus.NewConstSummary(desc, m.GetSummary().GetSampleCount(), m.GetSummary().GetSampleSum(), quantiles, values...)
+	default:
+		metric, err = prometheus.NewConstMetric(desc, prometheus.UntypedValue, m.GetUntyped().GetValue(), values...)
+	}
+	if err != nil {
+		return prometheus.NewInvalidMetric(desc, err)
+	}
+	return metric
+}
@@ -0,0 +1,55 @@
+package extprom_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/extprom"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWrapRegistererWith(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+
+	// Both buckets register the same metrics with the same constant labels.
+	bkt := objstore.BucketWithMetrics("test", inmem.NewBucket(), extprom.WrapRegistererWith(prometheus.Labels{"role": "source"}, reg))
+	target := objstore.BucketWithMetrics("test", inmem.NewBucket(), extprom.WrapRegistererWith(prometheus.Labels{"role": "target"}, reg))
+
+	testutil.Ok(t, bkt.Upload(ctx, "a", bytes.NewReader([]byte("a"))))
+	testutil.Ok(t, target.Upload(ctx, "a", bytes.NewReader([]byte("a"))))
+	testutil.Ok(t, target.Upload(ctx, "b", bytes.NewReader([]byte("b"))))
+
+	mfs, err := reg.Gather()
+	testutil.Ok(t, err)
+
+	uploads := map[string]float64{}
+	for _, mf := range mfs {
+		if mf.GetName() != "thanos_objstore_bucket_operations_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			var role, op string
+			for _, l := range m.GetLabel() {
+				switch l.GetName() {
+				case "role":
+					role = l.GetValue()
+				case "operation":
+					op = l.GetValue()
+				}
+			}
+			if op == "upload" {
+				uploads[role] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	testutil.Equals(t, map[string]float64{"source": 1, "target": 2}, uploads)
+
+	// Registering the same label set twice still conflicts.
+	err = extprom.WrapRegistererWith(prometheus.Labels{"role": "target"}, reg).Register(prometheus.NewCounter(prometheus.CounterOpts{Name: "c", Help: "c"}))
+	testutil.NotOk(t, err)
+}
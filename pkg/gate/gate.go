@@ -0,0 +1,211 @@
+// Package gate limits the number of concurrently running operations, either in total or separately
+// for each key, e.g. a tenant or a store.
+package gate
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrQueueTimeout is returned by Start if no slot was freed within the queue timeout.
+var ErrQueueTimeout = errors.New("timed out waiting for a free slot")
+
+var waitDurationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.6, 1, 2, 3.5, 5, 10}
+
+// Gate limits the number of concurrently running operations. Operations exceeding the limit
+// wait until a slot is freed, the queue timeout passes or their context is canceled.
+type Gate struct {
+	ch           chan struct{}
+	queueTimeout time.Duration
+
+	inflight     prometheus.Gauge
+	waitDuration prometheus.Histogram
+	timeouts     prometheus.Counter
+}
+
+// New returns a Gate that allows maxConcurrent operations at once. A non-positive maxConcurrent
+// disables the limit, but operations are still instrumented. A zero queue timeout lets operations wait until
+// their context is canceled. The name distinguishes metrics of gates in the same process.
+func New(reg prometheus.Registerer, name string, maxConcurrent int, queueTimeout time.Duration) *Gate {
+	g := &Gate{
+		queueTimeout: queueTimeout,
+		inflight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "thanos_gate_operations_in_flight",
+			Help:        "Number of operations currently running in the gate.",
+			ConstLabels: prometheus.Labels{"gate": name},
+		}),
+		waitDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        "thanos_gate_wait_duration_seconds",
+			Help:        "Time operations spent waiting for a free slot in the gate.",
+			ConstLabels: prometheus.Labels{"gate": name},
+			Buckets:     waitDurationBuckets,
+		}),
+		timeouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "thanos_gate_queue_timeouts_total",
+			Help:        "Number of operations rejected because no slot was freed within the queue timeout.",
+			ConstLabels: prometheus.Labels{"gate": name},
+		}),
+	}
+	if maxConcurrent > 0 {
+		g.ch = make(chan struct{}, maxConcurrent)
+	}
+	if reg != nil {
+		reg.MustRegister(g.inflight, g.waitDuration, g.timeouts)
+	}
+	return g
+}
+
+// Start blocks until the operation can run. Done must be called once the operation finished if and only if
+// no error is returned.
+func (g *Gate) Start(ctx context.Context) error {
+	if err := wait(ctx, g.ch, g.queueTimeout, g.waitDuration); err != nil {
+		if err == ErrQueueTimeout {
+			g.timeouts.Inc()
+		}
+		return err
+	}
+	g.inflight.Inc()
+	return nil
+}
+
+// Done frees the slot taken by Start.
+func (g *Gate) Done() {
+	g.inflight.Dec()
+	if g.ch != nil {
+		<-g.ch
+	}
+}
+
+// Keyed limits the number of concurrently running operations separately for each key. The gate of a key
+// is created on first use and removed once no operation of the key is running or waiting.
+type Keyed struct {
+	maxConcurrent int
+	queueTimeout  time.Duration
+
+	mtx   sync.Mutex
+	gates map[string]*keyedGate
+
+	inflight     *prometheus.GaugeVec
+	waitDuration prometheus.Histogram
+	timeouts     prometheus.Counter
+}
+
+type keyedGate struct {
+	ch chan struct{}
+	// Number of running and waiting operations.
+	refs int
+}
+
+// NewKeyed returns a Keyed gate that allows maxConcurrent operations at once for each key. A non-positive maxConcurrent
+// disables the limit. A zero queue timeout lets operations wait until their context is canceled.
+// The name distinguishes metrics of gates in the same process.
+func NewKeyed(reg prometheus.Registerer, name string, maxConcurrent int, queueTimeout time.Duration) *Keyed {
+	k := &Keyed{
+		maxConcurrent: maxConcurrent,
+		queueTimeout:  queueTimeout,
+		gates:         map[string]*keyedGate{},
+		inflight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "thanos_keyed_gate_operations_in_flight",
+			Help:        "Number of operations currently running in the gate for each key.",
+			ConstLabels: prometheus.Labels{"gate": name},
+		}, []string{"key"}),
+		waitDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:        "thanos_keyed_gate_wait_duration_seconds",
+			Help:        "Time operations spent waiting for a free slot in the gate of their key.",
+			ConstLabels: prometheus.Labels{"gate": name},
+			Buckets:     waitDurationBuckets,
+		}),
+		timeouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        "thanos_keyed_gate_queue_timeouts_total",
+			Help:        "Number of operations rejected because no slot of their key was freed within the queue timeout.",
+			ConstLabels: prometheus.Labels{"gate": name},
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(k.inflight, k.waitDuration, k.timeouts)
+	}
+	return k
+}
+
+// Start blocks until the operation of the given key can run. Done must be called with the same key once
+// the operation finished if and only if no error is returned.
+func (k *Keyed) Start(ctx context.Context, key string) error {
+	k.mtx.Lock()
+	g, ok := k.gates[key]
+	if !ok {
+		g = &keyedGate{}
+		if k.maxConcurrent > 0 {
+			g.ch = make(chan struct{}, k.maxConcurrent)
+		}
+		k.gates[key] = g
+	}
+	g.refs++
+	k.mtx.Unlock()
+
+	if err := wait(ctx, g.ch, k.queueTimeout, k.waitDuration); err != nil {
+		if err == ErrQueueTimeout {
+			k.timeouts.Inc()
+		}
+		k.release(key, g)
+		return err
+	}
+	k.inflight.WithLabelValues(key).Inc()
+	return nil
+}
+
+// Done frees the slot of the key taken by Start.
+func (k *Keyed) Done(key string) {
+	k.mtx.Lock()
+	g, ok := k.gates[key]
+	k.mtx.Unlock()
+	if !ok {
+		return
+	}
+	if g.ch != nil {
+		<-g.ch
+	}
+	k.inflight.WithLabelValues(key).Dec()
+	k.release(key, g)
+}
+
+func (k *Keyed) release(key string, g *keyedGate) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	g.refs--
+	if g.refs == 0 {
+		delete(k.gates, key)
+		k.inflight.DeleteLabelValues(key)
+	}
+}
+
+// wait takes a slot of the channel. A nil channel has no limit.
+func wait(ctx context.Context, ch chan struct{}, queueTimeout time.Duration, waitDuration prometheus.Histogram) error {
+	if ch == nil {
+		waitDuration.Observe(0)
+		return nil
+	}
+	begin := time.Now()
+	defer func() {
+		waitDuration.Observe(time.Since(begin).Seconds())
+	}()
+
+	var timeout <-chan time.Time
+	if queueTimeout > 0 {
+		t := time.NewTimer(queueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return ErrQueueTimeout
+	}
+}
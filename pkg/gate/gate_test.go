@@ -0,0 +1,65 @@
+package gate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+func TestGate(t *testing.T) {
+	g := New(nil, "test", 2, 50*time.Millisecond)
+
+	testutil.Ok(t, g.Start(context.Background()))
+	testutil.Ok(t, g.Start(context.Background()))
+
+	// The limit is reached, so the queue timeout hits.
+	testutil.Equals(t, ErrQueueTimeout, g.Start(context.Background()))
+
+	// Canceled context is returned before the queue timeout.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	testutil.Equals(t, context.Canceled, g.Start(ctx))
+
+	g.Done()
+	testutil.Ok(t, g.Start(context.Background()))
+
+	// Waiting operations get the slot once it is freed.
+	errc := make(chan error)
+	go func() { errc <- g.Start(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+	g.Done()
+	testutil.Ok(t, <-errc)
+}
+
+func TestGate_Unlimited(t *testing.T) {
+	g := New(nil, "test", 0, time.Millisecond)
+	for i := 0; i < 100; i++ {
+		testutil.Ok(t, g.Start(context.Background()))
+	}
+	for i := 0; i < 100; i++ {
+		g.Done()
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	k := NewKeyed(nil, "test", 1, 50*time.Millisecond)
+
+	testutil.Ok(t, k.Start(context.Background(), "a"))
+	testutil.Ok(t, k.Start(context.Background(), "b"))
+
+	// Keys are limited separately.
+	testutil.Equals(t, ErrQueueTimeout, k.Start(context.Background(), "a"))
+	testutil.Equals(t, ErrQueueTimeout, k.Start(context.Background(), "b"))
+
+	k.Done("a")
+	testutil.Ok(t, k.Start(context.Background(), "a"))
+
+	k.Done("a")
+	k.Done("b")
+	testutil.Equals(t, 0, len(k.gates))
+
+	// Done of an unknown key is ignored.
+	k.Done("c")
+}
@@ -0,0 +1,58 @@
+// Package info implements the Info gRPC service, which advertises the type of the component
+// and metadata of all APIs it exposes, so clients can discover its capabilities through a single endpoint.
+package info
+
+import (
+	"context"
+
+	"github.com/improbable-eng/thanos/pkg/info/infopb"
+	"github.com/improbable-eng/thanos/pkg/status"
+	"github.com/improbable-eng/thanos/pkg/store/storepb"
+	"github.com/pkg/errors"
+)
+
+// Component types advertised by the Info service.
+const (
+	ComponentQuery   = "query"
+	ComponentRule    = "rule"
+	ComponentSidecar = "sidecar"
+	ComponentStore   = "store"
+)
+
+// Server implements infopb.InfoServer. Metadata of the Store API is taken from the Info method of
+// the StoreAPI server, so it is always in sync with what the component returns there.
+type Server struct {
+	component string
+	store     storepb.StoreServer
+	status    *status.Status
+}
+
+// NewServer returns Info server of the given component type. The store can be nil if the component
+// does not expose the Store API, the status can be nil if the component does not expose it.
+func NewServer(component string, store storepb.StoreServer, st *status.Status) *Server {
+	return &Server{component: component, store: store, status: st}
+}
+
+// Info implements infopb.InfoServer.
+func (s *Server) Info(ctx context.Context, _ *infopb.InfoRequest) (*infopb.InfoResponse, error) {
+	resp := &infopb.InfoResponse{ComponentType: s.component}
+	if s.status != nil {
+		resp.Status = s.status.Proto()
+	}
+	if s.store == nil {
+		return resp, nil
+	}
+
+	storeInfo, err := s.store.Info(ctx, &storepb.InfoRequest{})
+	if err != nil {
+		return nil, errors.Wrap(err, "get store info")
+	}
+	if len(storeInfo.Labels) > 0 {
+		resp.LabelSets = []infopb.LabelSet{{Labels: storeInfo.Labels}}
+	}
+	resp.Store = &infopb.StoreInfo{
+		MinTime: storeInfo.MinTime,
+		MaxTime: storeInfo.MaxTime,
+	}
+	return resp, nil
+}
@@ -0,0 +1,52 @@
+package info
+
+import (
+	"context"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/info/infopb"
+	"github.com/improbable-eng/thanos/pkg/status"
+	"github.com/improbable-eng/thanos/pkg/store/storepb"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+type testStore struct {
+	storepb.StoreServer
+	info *storepb.InfoResponse
+}
+
+func (s *testStore) Info(context.Context, *storepb.InfoRequest) (*storepb.InfoResponse, error) {
+	return s.info, nil
+}
+
+func TestServer_Info(t *testing.T) {
+	ctx := context.Background()
+
+	resp, err := NewServer(ComponentRule, nil, nil).Info(ctx, &infopb.InfoRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, &infopb.InfoResponse{ComponentType: ComponentRule}, resp)
+
+	store := &testStore{info: &storepb.InfoResponse{MinTime: 10, MaxTime: 20}}
+	resp, err = NewServer(ComponentStore, store, nil).Info(ctx, &infopb.InfoRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, &infopb.InfoResponse{
+		ComponentType: ComponentStore,
+		Store:         &infopb.StoreInfo{MinTime: 10, MaxTime: 20},
+	}, resp)
+
+	lset := []storepb.Label{{Name: "replica", Value: "a"}}
+	store.info = &storepb.InfoResponse{Labels: lset, MinTime: 10, MaxTime: 20}
+	resp, err = NewServer(ComponentSidecar, store, nil).Info(ctx, &infopb.InfoRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, &infopb.InfoResponse{
+		ComponentType: ComponentSidecar,
+		LabelSets:     []infopb.LabelSet{{Labels: lset}},
+		Store:         &infopb.StoreInfo{MinTime: 10, MaxTime: 20},
+	}, resp)
+
+	resp, err = NewServer(ComponentQuery, nil, status.New(map[string]string{"query.timeout": "2m"})).Info(ctx, &infopb.InfoRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, ComponentQuery, resp.ComponentType)
+	testutil.Assert(t, resp.Status != nil, "status not advertised")
+	testutil.Equals(t, []infopb.Flag{{Name: "query.timeout", Value: "2m"}}, resp.Status.Flags)
+}
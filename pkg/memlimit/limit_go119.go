@@ -0,0 +1,16 @@
+// +build go1.19
+
+package memlimit
+
+import "runtime/debug"
+
+const supported = true
+
+func setLimit(limit int64) {
+	debug.SetMemoryLimit(limit)
+}
+
+// currentLimit returns the current limit. Negative input only reads it.
+func currentLimit() int64 {
+	return debug.SetMemoryLimit(-1)
+}
@@ -0,0 +1,14 @@
+// +build !go1.19
+
+package memlimit
+
+import "math"
+
+// The Go runtime supports a soft memory limit only since Go 1.19.
+const supported = false
+
+func setLimit(int64) {}
+
+func currentLimit() int64 {
+	return math.MaxInt64
+}
@@ -0,0 +1,103 @@
+// Package memlimit sets the soft memory limit of the Go runtime (GOMEMLIMIT) from the memory limit
+// of the cgroup the process runs in, so the garbage collector works harder before the container is OOM killed.
+package memlimit
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultCgroupRoot is the path cgroup file systems are mounted at.
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+const (
+	cgroupV2MemoryMax   = "memory.max"
+	cgroupV1MemoryLimit = "memory/memory.limit_in_bytes"
+
+	// cgroup v1 reports a page aligned maximum int64 value if no limit is set.
+	cgroupV1Unlimited = math.MaxInt64 &^ (1<<12 - 1)
+)
+
+// ErrNoLimit is returned if the cgroup has no memory limit set.
+var ErrNoLimit = errors.New("no cgroup memory limit set")
+
+// CgroupLimit returns the memory limit in bytes of the cgroup mounted at the given root. The limit of
+// cgroup v2 is used if available, otherwise the limit of cgroup v1.
+func CgroupLimit(root string) (uint64, error) {
+	b, err := ioutil.ReadFile(filepath.Join(root, cgroupV2MemoryMax))
+	if os.IsNotExist(err) {
+		b, err = ioutil.ReadFile(filepath.Join(root, cgroupV1MemoryLimit))
+	}
+	if os.IsNotExist(err) {
+		return 0, ErrNoLimit
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "read cgroup memory limit")
+	}
+
+	s := strings.TrimSpace(string(b))
+	if s == "max" {
+		return 0, ErrNoLimit
+	}
+	limit, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parse cgroup memory limit %q", s)
+	}
+	if limit >= cgroupV1Unlimited {
+		return 0, ErrNoLimit
+	}
+	return limit, nil
+}
+
+// Apply sets the soft memory limit of the Go runtime to the given ratio of the cgroup memory limit.
+// The limit is left untouched if the GOMEMLIMIT environment variable is set or the cgroup has no memory limit.
+func Apply(logger log.Logger, root string, ratio float64) error {
+	if ratio <= 0 || ratio > 1 {
+		return errors.Errorf("memory limit ratio must be in (0, 1], got %v", ratio)
+	}
+	if !supported {
+		return errors.New("setting the memory limit requires a binary built with Go 1.19 or newer")
+	}
+	if v := os.Getenv("GOMEMLIMIT"); v != "" {
+		level.Info(logger).Log("msg", "GOMEMLIMIT environment variable is set, not overriding it", "GOMEMLIMIT", v)
+		return nil
+	}
+
+	cgroupLimit, err := CgroupLimit(root)
+	if err == ErrNoLimit {
+		level.Info(logger).Log("msg", "no cgroup memory limit found, Go runtime memory limit is not set")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	limit := int64(float64(cgroupLimit) * ratio)
+	setLimit(limit)
+	level.Info(logger).Log("msg", "set Go runtime memory limit from cgroup", "cgroup_limit_bytes", cgroupLimit, "ratio", ratio, "limit_bytes", limit)
+	return nil
+}
+
+// NewCollector returns a collector exposing the soft memory limit currently applied to the Go runtime,
+// either by Apply or the GOMEMLIMIT environment variable. It is zero if no limit is set.
+func NewCollector() prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanos_memory_limit_bytes",
+		Help: "Soft memory limit of the Go runtime. Zero if no limit is set.",
+	}, func() float64 {
+		limit := currentLimit()
+		if limit == math.MaxInt64 {
+			return 0
+		}
+		return float64(limit)
+	})
+}
@@ -0,0 +1,74 @@
+package memlimit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+func TestCgroupLimit(t *testing.T) {
+	for _, tcase := range []struct {
+		files map[string]string
+		limit uint64
+		err   error
+	}{
+		{
+			files: map[string]string{},
+			err:   ErrNoLimit,
+		},
+		{
+			files: map[string]string{cgroupV2MemoryMax: "max\n"},
+			err:   ErrNoLimit,
+		},
+		{
+			files: map[string]string{cgroupV2MemoryMax: "2147483648\n"},
+			limit: 2147483648,
+		},
+		{
+			// cgroup v2 takes precedence.
+			files: map[string]string{cgroupV2MemoryMax: "1073741824\n", cgroupV1MemoryLimit: "2147483648\n"},
+			limit: 1073741824,
+		},
+		{
+			files: map[string]string{cgroupV1MemoryLimit: "2147483648\n"},
+			limit: 2147483648,
+		},
+		{
+			files: map[string]string{cgroupV1MemoryLimit: "9223372036854771712\n"},
+			err:   ErrNoLimit,
+		},
+	} {
+		func() {
+			dir, err := ioutil.TempDir("", "cgroup")
+			testutil.Ok(t, err)
+			defer os.RemoveAll(dir)
+
+			for name, content := range tcase.files {
+				testutil.Ok(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0777))
+				testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0666))
+			}
+
+			limit, err := CgroupLimit(dir)
+			testutil.Equals(t, tcase.err, err)
+			testutil.Equals(t, tcase.limit, limit)
+		}()
+	}
+}
+
+func TestCgroupLimit_Invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroup")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, cgroupV2MemoryMax), []byte("invalid"), 0666))
+	_, err = CgroupLimit(dir)
+	testutil.NotOk(t, err)
+}
+
+func TestApply_InvalidRatio(t *testing.T) {
+	testutil.NotOk(t, Apply(nil, DefaultCgroupRoot, 0))
+	testutil.NotOk(t, Apply(nil, DefaultCgroupRoot, 1.5))
+}
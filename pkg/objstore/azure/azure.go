@@ -0,0 +1,368 @@
+// Package azure implements common object storage abstractions against Azure Blob Storage.
+package azure
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-pipeline-go/pipeline"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	opObjectsList  = "ListBlobs"
+	opObjectInsert = "PutBlob"
+	opObjectGet    = "GetBlob"
+	opObjectStat   = "GetBlobProperties"
+	opObjectDelete = "DeleteBlob"
+)
+
+const (
+	// DirDelim is the delimiter used to model a directory structure in an object store bucket.
+	DirDelim = "/"
+
+	// DefaultEndpoint is the endpoint suffix of the public Azure cloud.
+	DefaultEndpoint = "blob.core.windows.net"
+
+	// blockSize is the size of the blocks objects are uploaded in. Blobs consist of at most 50000 blocks.
+	blockSize = 8 * 1024 * 1024
+
+	msiResource = "https://storage.azure.com/"
+
+	// tokenRefreshMargin is how long before its expiry a token of the managed identity is refreshed. It must be
+	// within the refresh window of adal, which is 5 minutes.
+	tokenRefreshMargin = 4 * time.Minute
+	// tokenRetryInterval is the delay before a failed token refresh is retried.
+	tokenRetryInterval = 30 * time.Second
+)
+
+// Config encapsulates the necessary config values to instantiate an Azure Blob Storage client.
+type Config struct {
+	Account    string `yaml:"account"`
+	AccountKey string `yaml:"account_key"`
+	Container  string `yaml:"container"`
+	// Endpoint is the endpoint suffix, e.g. blob.core.windows.net, of the storage account. If it holds a URL
+	// with scheme, e.g. for the storage emulator, it is used as the base URL of the account.
+	Endpoint string `yaml:"endpoint"`
+	// MSIClientID selects the user-assigned managed identity if the account key is empty and the node has
+	// more than one identity.
+	MSIClientID string `yaml:"msi_client_id"`
+}
+
+// RegisterAzureParams registers the Azure flags into the given Config struct.
+func RegisterAzureParams(cmd *kingpin.CmdClause, conf *Config) {
+	cmd.Flag("azure.account", "Azure storage account name for stored blocks.").
+		PlaceHolder("<account>").Envar("AZURE_STORAGE_ACCOUNT").StringVar(&conf.Account)
+
+	cmd.Flag("azure.container", "Azure Blob Storage container name for stored blocks.").
+		PlaceHolder("<container>").Envar("AZURE_STORAGE_CONTAINER").StringVar(&conf.Container)
+
+	cmd.Flag("azure.endpoint", "Azure Blob Storage endpoint suffix, or base URL of the account for storage emulators.").
+		Default(DefaultEndpoint).Envar("AZURE_STORAGE_ENDPOINT").StringVar(&conf.Endpoint)
+
+	cmd.Flag("azure.msi-client-id", "Client ID of the user-assigned managed identity used if no account key is set. The only identity of the node is used if empty.").
+		PlaceHolder("<id>").Envar("AZURE_MSI_CLIENT_ID").StringVar(&conf.MSIClientID)
+
+	conf.AccountKey = os.Getenv("AZURE_STORAGE_ACCESS_KEY")
+}
+
+// Validate checks to see if any of the Azure config options are set.
+func (conf *Config) Validate() error {
+	if conf.Account == "" || conf.Container == "" {
+		return errors.New("insufficient azure configuration information")
+	}
+	return nil
+}
+
+// Bucket implements the store.Bucket interface against Azure Blob Storage.
+type Bucket struct {
+	container azblob.ContainerURL
+	opsTotal  *prometheus.CounterVec
+}
+
+// NewBucket returns a new Bucket using the provided Azure config values. The account key is used for authentication
+// if set, otherwise tokens of the managed identity of the node are requested.
+func NewBucket(conf *Config, reg prometheus.Registerer, component string) (*Bucket, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+				DualStack: true,
+			}).DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			// Cover cases where the tcp connection works but the server never answers.
+			ResponseHeaderTimeout: 15 * time.Second,
+			DisableCompression:    true,
+		},
+	}
+	msiEndpoint, err := adal.GetMSIVMEndpoint()
+	if err != nil {
+		return nil, errors.Wrap(err, "get managed identity endpoint")
+	}
+	return newBucket(conf, reg, component, client, msiEndpoint)
+}
+
+func newBucket(conf *Config, reg prometheus.Registerer, component string, client *http.Client, msiEndpoint string) (*Bucket, error) {
+	endpoint := conf.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = fmt.Sprintf("https://%s.%s", conf.Account, endpoint)
+	}
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/") + "/" + conf.Container)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse azure endpoint")
+	}
+
+	var cred azblob.Credential
+	if conf.AccountKey != "" {
+		if cred, err = azblob.NewSharedKeyCredential(conf.Account, conf.AccountKey); err != nil {
+			return nil, errors.Wrap(err, "create azure shared key credential")
+		}
+	} else if cred, err = msiCredential(msiEndpoint, conf.MSIClientID); err != nil {
+		return nil, errors.Wrap(err, "get managed identity token")
+	}
+
+	p := azblob.NewPipeline(cred, azblob.PipelineOptions{
+		// Operations are retried by the bucket wrapper around all providers.
+		Retry:     azblob.RetryOptions{MaxTries: 1},
+		Telemetry: azblob.TelemetryOptions{Value: fmt.Sprintf("thanos-%s/%s (%s)", component, version.Version, runtime.Version())},
+		HTTPSender: pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+			return func(ctx context.Context, req pipeline.Request) (pipeline.Response, error) {
+				resp, err := client.Do(req.WithContext(ctx))
+				if err != nil {
+					err = pipeline.NewError(err, "HTTP request failed")
+				}
+				return pipeline.NewHTTPResponse(resp), err
+			}
+		}),
+	})
+
+	bkt := &Bucket{
+		container: azblob.NewContainerURL(*u, p),
+		opsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "thanos_objstore_azure_bucket_operations_total",
+			Help:        "Total number of operations that were executed against an Azure Blob Storage container.",
+			ConstLabels: prometheus.Labels{"bucket": conf.Container},
+		}, []string{"operation"}),
+	}
+	if reg != nil {
+		reg.MustRegister(bkt.opsTotal)
+	}
+	return bkt, nil
+}
+
+// msiCredential returns a credential holding a token of the managed identity of the node, which is refreshed in
+// the background before it expires. The identity is selected by clientID if the node has more than one.
+func msiCredential(msiEndpoint, clientID string) (azblob.Credential, error) {
+	var (
+		spt *adal.ServicePrincipalToken
+		err error
+	)
+	if clientID != "" {
+		spt, err = adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(msiEndpoint, msiResource, clientID)
+	} else {
+		spt, err = adal.NewServicePrincipalTokenFromMSI(msiEndpoint, msiResource)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Fetch the first token right away, so a missing identity fails on startup.
+	if err := spt.Refresh(); err != nil {
+		return nil, err
+	}
+	return azblob.NewTokenCredential(spt.OAuthToken(), func(cred azblob.TokenCredential) time.Duration {
+		if err := spt.EnsureFresh(); err != nil {
+			return tokenRetryInterval
+		}
+		cred.SetToken(spt.OAuthToken())
+
+		if d := time.Until(spt.Token().Expires()) - tokenRefreshMargin; d > tokenRetryInterval {
+			return d
+		}
+		return tokenRetryInterval
+	}), nil
+}
+
+// statusCode returns the HTTP status of the Blob service response that failed with err, or 0 if err is no
+// service error.
+func statusCode(err error) int {
+	// Service errors of the SDK may have no cause, so the chain cannot be walked with errors.Cause.
+	for err != nil {
+		if e, ok := err.(azblob.StorageError); ok {
+			return e.Response().StatusCode
+		}
+		c, ok := err.(interface{ Cause() error })
+		if !ok {
+			return 0
+		}
+		err = c.Cause()
+	}
+	return 0
+}
+
+func isNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+// IsRetryableErr returns true if an operation that failed with err is likely to succeed when it is retried.
+func IsRetryableErr(err error) bool {
+	if s := statusCode(err); s != 0 {
+		return s == http.StatusTooManyRequests || s >= http.StatusInternalServerError
+	}
+	return objstore.IsTransientErr(err)
+}
+
+// Iter calls f for each entry in the given directory. The argument to f is the full
+// object name including the prefix of the inspected directory.
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	}, options...)
+}
+
+// IterWithAttributes is like Iter but additionally passes the size and modification time of blobs to f.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error, options ...objstore.IterOption) error {
+	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
+	// object itself as one prefix item.
+	if dir != "" {
+		dir = strings.TrimSuffix(dir, DirDelim) + DirDelim
+	}
+	recursive := objstore.ApplyIterOptions(options...).Recursive
+
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		b.opsTotal.WithLabelValues(opObjectsList).Inc()
+
+		var (
+			blobs    []azblob.BlobItemInternal
+			prefixes []azblob.BlobPrefix
+		)
+		if recursive {
+			resp, err := b.container.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{Prefix: dir})
+			if err != nil {
+				return errors.Wrap(err, "list azure blobs")
+			}
+			blobs, marker = resp.Segment.BlobItems, resp.NextMarker
+		} else {
+			resp, err := b.container.ListBlobsHierarchySegment(ctx, marker, DirDelim, azblob.ListBlobsSegmentOptions{Prefix: dir})
+			if err != nil {
+				return errors.Wrap(err, "list azure blobs")
+			}
+			blobs, prefixes, marker = resp.Segment.BlobItems, resp.Segment.BlobPrefixes, resp.NextMarker
+		}
+
+		// Entries of a page are sorted by name, but blobs and prefixes are listed separately.
+		var (
+			names []string
+			attrs = map[string]objstore.ObjectAttributes{}
+		)
+		for _, p := range prefixes {
+			names = append(names, p.Name)
+		}
+		for _, blob := range blobs {
+			a := objstore.ObjectAttributes{LastModified: blob.Properties.LastModified}
+			if blob.Properties.ContentLength != nil {
+				a.Size = *blob.Properties.ContentLength
+			}
+			names = append(names, blob.Name)
+			attrs[blob.Name] = a
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			if err := f(n, attrs[n]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Get returns a reader for the given object name.
+func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.getRange(ctx, name, 0, azblob.CountToEnd)
+}
+
+// GetRange returns a new range reader for the given object name and range.
+func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.getRange(ctx, name, off, length)
+}
+
+func (b *Bucket) getRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	b.opsTotal.WithLabelValues(opObjectGet).Inc()
+
+	resp, err := b.container.NewBlobURL(name).Download(ctx, off, length, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "get azure blob %s", name)
+	}
+	// Failed reads are retried by the caller, the SDK must not retry them on its own.
+	return resp.Body(azblob.RetryReaderOptions{}), nil
+}
+
+// Exists checks if the given object exists.
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := b.Attributes(ctx, name)
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Attributes returns the size and modification time of the blob.
+func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	b.opsTotal.WithLabelValues(opObjectStat).Inc()
+
+	props, err := b.container.NewBlobURL(name).GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrapf(err, "stat azure blob %s", name)
+	}
+	return objstore.ObjectAttributes{Size: props.ContentLength(), LastModified: props.LastModified()}, nil
+}
+
+// Upload the contents of the reader as an object into the bucket. Objects are uploaded as a list of blocks, which
+// are committed once all of them are written.
+func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	b.opsTotal.WithLabelValues(opObjectInsert).Inc()
+
+	_, err := azblob.UploadStreamToBlockBlob(ctx, r, b.container.NewBlockBlobURL(name), azblob.UploadStreamToBlockBlobOptions{
+		BufferSize: blockSize,
+		MaxBuffers: 1,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "upload azure blob %s", name)
+	}
+	return nil
+}
+
+// Delete removes the object with the given name.
+func (b *Bucket) Delete(ctx context.Context, name string) error {
+	b.opsTotal.WithLabelValues(opObjectDelete).Inc()
+
+	if _, err := b.container.NewBlobURL(name).Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{}); err != nil {
+		return errors.Wrapf(err, "delete azure blob %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+var lastModified = time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC)
+
+// fakeBlobService implements the subset of the Blob service REST API used by Bucket for a single container.
+type fakeBlobService struct {
+	t       *testing.T
+	account string
+	token   string
+
+	mtx    sync.Mutex
+	blobs  map[string][]byte
+	blocks map[string][]byte
+}
+
+func (s *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// Signatures are computed by the SDK, only the scheme of the credential is checked.
+	auth := r.Header.Get("Authorization")
+	if s.token == "" {
+		if !strings.HasPrefix(auth, "SharedKey "+s.account+":") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	} else if auth != "Bearer "+s.token {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/container/")
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodGet && q.Get("comp") == "list":
+		s.list(w, q.Get("prefix"), q.Get("delimiter"))
+	case r.Method == http.MethodGet:
+		b, ok := s.blobs[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if rng := r.Header.Get("x-ms-range"); rng != "" {
+			var start, end int
+			fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+			if end >= len(b) {
+				end = len(b) - 1
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(b[start : end+1])
+			return
+		}
+		w.Write(b)
+	case r.Method == http.MethodHead:
+		b, ok := s.blobs[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	case r.Method == http.MethodPut:
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.ContentLength != int64(len(b)) {
+			s.t.Errorf("unexpected content length %d of %d bytes", r.ContentLength, len(b))
+		}
+		switch q.Get("comp") {
+		case "block":
+			s.blocks[name+"/"+q.Get("blockid")] = b
+		case "blocklist":
+			var list struct {
+				Latest []string `xml:"Latest"`
+			}
+			if err := xml.Unmarshal(b, &list); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			blob := []byte{}
+			for _, id := range list.Latest {
+				blob = append(blob, s.blocks[name+"/"+id]...)
+			}
+			s.blobs[name] = blob
+		default:
+			s.blobs[name] = b
+		}
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete:
+		if _, ok := s.blobs[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// list returns all entries in a single page, unsorted, to check that Iter orders them.
+func (s *fakeBlobService) list(w http.ResponseWriter, prefix, delim string) {
+	var blobs, prefixes []string
+	seen := map[string]bool{}
+	for name := range s.blobs {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if i := strings.Index(name[len(prefix):], DirDelim); delim != "" && i >= 0 {
+			p := name[:len(prefix)+i+1]
+			if !seen[p] {
+				seen[p] = true
+				prefixes = append(prefixes, p)
+			}
+			continue
+		}
+		blobs = append(blobs, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(blobs)))
+
+	fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>`)
+	for _, p := range prefixes {
+		fmt.Fprintf(w, "<BlobPrefix><Name>%s</Name></BlobPrefix>", p)
+	}
+	for _, b := range blobs {
+		fmt.Fprintf(w, "<Blob><Name>%s</Name><Properties><Last-Modified>%s</Last-Modified><Content-Length>%d</Content-Length></Properties></Blob>",
+			b, lastModified.Format(http.TimeFormat), len(s.blobs[b]))
+	}
+	fmt.Fprint(w, `</Blobs><NextMarker /></EnumerationResults>`)
+}
+
+func testBucket(t *testing.T, bkt *Bucket) {
+	ctx := context.Background()
+
+	testutil.Ok(t, bkt.Upload(ctx, "dir/a", bytes.NewReader([]byte("object a"))))
+	testutil.Ok(t, bkt.Upload(ctx, "dir/sub/b", bytes.NewReader(nil)))
+
+	// Objects larger than a block are uploaded in multiple blocks.
+	large := bytes.Repeat([]byte("0123456789"), blockSize/5)
+	testutil.Ok(t, bkt.Upload(ctx, "dir/large", bytes.NewReader(large)))
+
+	rc, err := bkt.Get(ctx, "dir/large")
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(rc)
+	rc.Close()
+	testutil.Ok(t, err)
+	testutil.Assert(t, bytes.Equal(large, b), "unexpected content of large object")
+
+	rc, err = bkt.GetRange(ctx, "dir/a", 2, 3)
+	testutil.Ok(t, err)
+	b, err = ioutil.ReadAll(rc)
+	rc.Close()
+	testutil.Ok(t, err)
+	testutil.Equals(t, "jec", string(b))
+
+	var names []string
+	testutil.Ok(t, bkt.Iter(ctx, "dir", func(n string) error {
+		names = append(names, n)
+		return nil
+	}))
+	testutil.Equals(t, []string{"dir/a", "dir/large", "dir/sub/"}, names)
+
+	names = nil
+	testutil.Ok(t, bkt.IterWithAttributes(ctx, "dir", func(n string, attrs objstore.ObjectAttributes) error {
+		names = append(names, n)
+		if n == "dir/large" {
+			testutil.Equals(t, int64(len(large)), attrs.Size)
+			testutil.Assert(t, lastModified.Equal(attrs.LastModified), "unexpected modification time %v", attrs.LastModified)
+		}
+		return nil
+	}, objstore.WithRecursiveIter()))
+	testutil.Equals(t, []string{"dir/a", "dir/large", "dir/sub/b"}, names)
+
+	attrs, err := bkt.Attributes(ctx, "dir/a")
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(8), attrs.Size)
+	testutil.Assert(t, lastModified.Equal(attrs.LastModified), "unexpected modification time %v", attrs.LastModified)
+
+	ok, err := bkt.Exists(ctx, "dir/a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected object to exist")
+
+	testutil.Ok(t, bkt.Delete(ctx, "dir/a"))
+	ok, err = bkt.Exists(ctx, "dir/a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected object to be deleted")
+
+	_, err = bkt.Get(ctx, "dir/a")
+	testutil.Assert(t, isNotFound(err), "expected not found error, got %v", err)
+	testutil.Assert(t, !IsRetryableErr(err), "expected not found error not to be retried")
+}
+
+func TestBucket_SharedKey(t *testing.T) {
+	srv := httptest.NewTLSServer(&fakeBlobService{
+		t:       t,
+		account: "account",
+		blobs:   map[string][]byte{},
+		blocks:  map[string][]byte{},
+	})
+	defer srv.Close()
+
+	bkt, err := newBucket(&Config{
+		Account:    "account",
+		AccountKey: base64.StdEncoding.EncodeToString([]byte("secret")),
+		Container:  "container",
+		Endpoint:   srv.URL,
+	}, nil, "test", srv.Client(), "")
+	testutil.Ok(t, err)
+
+	testBucket(t, bkt)
+}
+
+func TestBucket_MSI(t *testing.T) {
+	var tokenRequests int
+	msi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("resource") != msiResource || r.URL.Query().Get("client_id") != "id" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		expiresOn := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+		fmt.Fprintf(w, `{"access_token": "token", "expires_in": "3600", "expires_on": "%s", "resource": "%s", "token_type": "Bearer"}`, expiresOn, msiResource)
+	}))
+	defer msi.Close()
+
+	// Tokens are only sent over TLS.
+	srv := httptest.NewTLSServer(&fakeBlobService{
+		t:      t,
+		token:  "token",
+		blobs:  map[string][]byte{},
+		blocks: map[string][]byte{},
+	})
+	defer srv.Close()
+
+	bkt, err := newBucket(&Config{
+		Account:     "account",
+		Container:   "container",
+		Endpoint:    srv.URL,
+		MSIClientID: "id",
+	}, nil, "test", srv.Client(), msi.URL)
+	testutil.Ok(t, err)
+
+	testBucket(t, bkt)
+	testutil.Equals(t, 1, tokenRequests)
+}
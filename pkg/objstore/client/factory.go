@@ -3,38 +3,325 @@ package client
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"runtime"
 
 	"cloud.google.com/go/storage"
 	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/azure"
+	"github.com/improbable-eng/thanos/pkg/objstore/encryption"
+	"github.com/improbable-eng/thanos/pkg/objstore/filesystem"
 	"github.com/improbable-eng/thanos/pkg/objstore/gcs"
+	"github.com/improbable-eng/thanos/pkg/objstore/oss"
 	"github.com/improbable-eng/thanos/pkg/objstore/s3"
+	"github.com/improbable-eng/thanos/pkg/objstore/swift"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/version"
 	"google.golang.org/api/option"
+	"gopkg.in/alecthomas/kingpin.v2"
+	yaml "gopkg.in/yaml.v2"
 )
 
-var ErrNotFound = errors.New("no valid GCS or S3 configuration supplied")
+var ErrNotFound = errors.New("no valid GCS, S3, Azure, Swift, OSS or filesystem configuration supplied")
 
-// NewBucket initializes and returns new object storage clients.
-func NewBucket(gcsBucket *string, s3Config s3.Config, reg *prometheus.Registry, component string) (objstore.Bucket, func() error, error) {
-	if *gcsBucket != "" {
+// Providers holds the configuration of every object storage provider. Only one of them may be valid.
+type Providers struct {
+	// GCSBucket is the name of the GCS bucket. Its flag is registered by every component itself.
+	GCSBucket  string
+	GCS        gcs.Config
+	S3         s3.Config
+	Azure      azure.Config
+	Swift      swift.Config
+	OSS        oss.Config
+	Filesystem filesystem.Config
+}
+
+// Config configures the object storage provider and the behavior common to all providers.
+type Config struct {
+	Providers
+
+	// ConfigFile is the path to the YAML configuration of the provider. If set, the provider flags are ignored.
+	ConfigFile string
+	// ConfigContent is the YAML configuration of the provider, an alternative to ConfigFile.
+	ConfigContent string
+	// Prefix of all objects in the bucket.
+	Prefix    string
+	Retry     objstore.RetryConfig
+	RateLimit objstore.RateLimitConfig
+	// Readonly rejects uploads and deletions.
+	Readonly bool
+	// Encryption configures client-side encryption of objects.
+	Encryption encryption.Config
+}
+
+// RegisterParams registers the flags of all object storage providers, except for the GCS bucket, and the flags common
+// to them and returns an initialized Config struct.
+func RegisterParams(cmd *kingpin.CmdClause) *Config {
+	var conf Config
+
+	gcs.RegisterGCSParams(cmd, &conf.GCS)
+	s3.RegisterS3Params(cmd, &conf.S3)
+	azure.RegisterAzureParams(cmd, &conf.Azure)
+	swift.RegisterSwiftParams(cmd, &conf.Swift)
+	oss.RegisterOSSParams(cmd, &conf.OSS)
+	filesystem.RegisterFilesystemParams(cmd, &conf.Filesystem)
+
+	cmd.Flag("objstore.config-file", "Path to YAML file with the object storage configuration. See docs/getting_started.md for the format. If set, the provider specific flags are ignored.").
+		PlaceHolder("<objstore.config-yaml-path>").StringVar(&conf.ConfigFile)
+
+	cmd.Flag("objstore.config", "Alternative to 'objstore.config-file' flag. Object storage configuration in YAML.").
+		PlaceHolder("<objstore.config-yaml>").StringVar(&conf.ConfigContent)
+
+	cmd.Flag("objstore.prefix", "Prefix of all objects in the bucket, e.g. to share one bucket between environments.").
+		PlaceHolder("<prefix>").StringVar(&conf.Prefix)
+
+	cmd.Flag("objstore.max-retries", "Number of times operations against the bucket are retried after transient errors. 0 disables retries.").
+		Default("3").IntVar(&conf.Retry.MaxRetries)
+
+	cmd.Flag("objstore.max-retry-elapsed", "Time after which failed operations against the bucket are no longer retried. 0 means no limit.").
+		Default("1m").DurationVar(&conf.Retry.MaxElapsed)
+
+	cmd.Flag("objstore.read-ops-limit", "Maximum number of listings, downloads and existence checks per second against the bucket. 0 disables the limit.").
+		Default("0").Float64Var(&conf.RateLimit.ReadOps)
+
+	cmd.Flag("objstore.write-ops-limit", "Maximum number of uploads and deletions per second against the bucket. 0 disables the limit.").
+		Default("0").Float64Var(&conf.RateLimit.WriteOps)
+
+	cmd.Flag("objstore.read-bytes-limit", "Maximum number of bytes downloaded per second from the bucket. 0 disables the limit.").
+		Default("0").BytesVar(&conf.RateLimit.ReadBytes)
+
+	cmd.Flag("objstore.write-bytes-limit", "Maximum number of bytes uploaded per second to the bucket. 0 disables the limit.").
+		Default("0").BytesVar(&conf.RateLimit.WriteBytes)
+
+	cmd.Flag("objstore.read-only", "Reject uploads and deletions, e.g. to run the component against a production bucket with the guarantee that it is not modified.").
+		Default("false").BoolVar(&conf.Readonly)
+
+	cmd.Flag("objstore.encryption-key-file", "Path to a file containing a 32 byte key that encrypts the keys of client-side encrypted objects. All objects in the bucket need to be encrypted with the same key.").
+		PlaceHolder("<path>").StringVar(&conf.Encryption.KeyFile)
+
+	cmd.Flag("objstore.encryption-kms-key-name", "Cloud KMS key that encrypts the keys of client-side encrypted objects, e.g. projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>.").
+		PlaceHolder("<key>").StringVar(&conf.Encryption.KMSKeyName)
+
+	return &conf
+}
+
+// configContent returns the YAML configuration of the provider given either as a path or as the content. It is empty if
+// the provider is configured by flags.
+func (conf Config) configContent() ([]byte, error) {
+	if conf.ConfigFile != "" && conf.ConfigContent != "" {
+		return nil, errors.New("both a file and the content of the object storage configuration are given, only one is allowed")
+	}
+	if conf.ConfigFile == "" {
+		return []byte(conf.ConfigContent), nil
+	}
+	b, err := ioutil.ReadFile(conf.ConfigFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "read object storage config file")
+	}
+	return b, nil
+}
+
+// wrap applies the configuration common to all providers to the bucket of a provider.
+func (conf Config) wrap(name string, b objstore.Bucket, retryable func(error) bool, keys encryption.KeyWrapper, reg prometheus.Registerer) objstore.Bucket {
+	// Retries are subject to the rate limits as well.
+	b = objstore.BucketWithRateLimits(b, conf.RateLimit)
+	if retryable != nil {
+		b = objstore.BucketWithRetries(b, retryable, conf.Retry)
+	}
+	b = objstore.NewPrefixedBucket(b, conf.Prefix)
+	if keys != nil {
+		b = encryption.NewEncryptedBucket(b, keys)
+	}
+	if conf.Readonly {
+		b = objstore.NewReadonlyBucket(b)
+	}
+	return objstore.BucketWithMetrics(name, objstore.BucketWithTracing(b), reg)
+}
+
+// ObjProvider is the name of an object storage provider.
+type ObjProvider string
+
+const (
+	GCS        ObjProvider = "GCS"
+	S3         ObjProvider = "S3"
+	AZURE      ObjProvider = "AZURE"
+	SWIFT      ObjProvider = "SWIFT"
+	OSS        ObjProvider = "OSS"
+	FILESYSTEM ObjProvider = "FILESYSTEM"
+)
+
+// BucketConfig is the object storage configuration passed in YAML. Config holds the provider specific configuration.
+type BucketConfig struct {
+	Type   ObjProvider `yaml:"type"`
+	Config interface{} `yaml:"config"`
+}
+
+// gcsConfig is the YAML configuration of GCS. It includes the bucket name, which is given by a separate flag otherwise.
+type gcsConfig struct {
+	Bucket     string `yaml:"bucket"`
+	gcs.Config `yaml:",inline"`
+}
+
+// parseBucketConfig returns the configuration of the provider selected by the given YAML content. The configuration
+// of all other providers is left empty.
+func parseBucketConfig(content []byte) (Providers, error) {
+	var p Providers
+
+	bucketConf := &BucketConfig{}
+	if err := yaml.UnmarshalStrict(content, bucketConf); err != nil {
+		return p, errors.Wrap(err, "parse object storage config")
+	}
+	// Config is decoded into the provider specific struct once the type is known.
+	config, err := yaml.Marshal(bucketConf.Config)
+	if err != nil {
+		return p, errors.Wrap(err, "marshal content of object storage configuration")
+	}
+
+	switch bucketConf.Type {
+	case GCS:
+		var c gcsConfig
+		if err := yaml.UnmarshalStrict(config, &c); err != nil {
+			return p, errors.Wrap(err, "parse gcs config")
+		}
+		if c.Bucket == "" {
+			return p, errors.New("no gcs bucket configured")
+		}
+		p.GCSBucket, p.GCS = c.Bucket, c.Config
+	case S3:
+		if err := yaml.UnmarshalStrict(config, &p.S3); err != nil {
+			return p, errors.Wrap(err, "parse s3 config")
+		}
+		err = p.S3.Validate()
+	case AZURE:
+		p.Azure.Endpoint = azure.DefaultEndpoint
+		if err := yaml.UnmarshalStrict(config, &p.Azure); err != nil {
+			return p, errors.Wrap(err, "parse azure config")
+		}
+		err = p.Azure.Validate()
+	case SWIFT:
+		p.Swift = swift.DefaultConfig
+		if err := yaml.UnmarshalStrict(config, &p.Swift); err != nil {
+			return p, errors.Wrap(err, "parse swift config")
+		}
+		err = p.Swift.Validate()
+	case OSS:
+		p.OSS = oss.DefaultConfig
+		if err := yaml.UnmarshalStrict(config, &p.OSS); err != nil {
+			return p, errors.Wrap(err, "parse oss config")
+		}
+		err = p.OSS.Validate()
+	case FILESYSTEM:
+		if err := yaml.UnmarshalStrict(config, &p.Filesystem); err != nil {
+			return p, errors.Wrap(err, "parse filesystem config")
+		}
+		err = p.Filesystem.Validate()
+	default:
+		return p, errors.Errorf("object storage with type %s is not supported", bucketConf.Type)
+	}
+	return p, err
+}
+
+// NewBucket initializes and returns new object storage clients. All objects are stored below the configured prefix of
+// the bucket. Operations are rate limited, retried after transient errors, instrumented with metrics and traced as part of the span
+// in their context. Objects are encrypted client-side if a key encryption key is configured. Uploads and deletions fail
+// with objstore.ErrReadonly if the bucket is configured as read-only. The provider is configured by the YAML
+// configuration of conf if given and by its provider configs otherwise, of which only one may be valid.
+func NewBucket(conf Config, reg prometheus.Registerer, component string) (objstore.Bucket, func() error, error) {
+	keys, err := encryption.NewKeyWrapper(context.Background(), conf.Encryption)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "configure client-side encryption")
+	}
+
+	p := conf.Providers
+	content, err := conf.configContent()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(content) > 0 {
+		if p, err = parseBucketConfig(content); err != nil {
+			return nil, nil, err
+		}
+	}
+	return newBucket(p, conf, keys, reg, component)
+}
+
+// configured returns the providers with a valid configuration.
+func (p Providers) configured() []ObjProvider {
+	var res []ObjProvider
+	if p.GCSBucket != "" {
+		res = append(res, GCS)
+	}
+	if p.S3.Validate() == nil {
+		res = append(res, S3)
+	}
+	if p.Azure.Validate() == nil {
+		res = append(res, AZURE)
+	}
+	if p.Swift.Validate() == nil {
+		res = append(res, SWIFT)
+	}
+	if p.OSS.Validate() == nil {
+		res = append(res, OSS)
+	}
+	if p.Filesystem.Validate() == nil {
+		res = append(res, FILESYSTEM)
+	}
+	return res
+}
+
+// newBucket creates the bucket of the only valid provider configuration.
+func newBucket(p Providers, conf Config, keys encryption.KeyWrapper, reg prometheus.Registerer, component string) (objstore.Bucket, func() error, error) {
+	configured := p.configured()
+	if len(configured) == 0 {
+		return nil, nil, ErrNotFound
+	}
+	if len(configured) > 1 {
+		return nil, nil, errors.Errorf("multiple object storage providers configured: %v, only one is allowed", configured)
+	}
+
+	switch configured[0] {
+	case GCS:
 		gcsOptions := option.WithUserAgent(fmt.Sprintf("thanos-%s/%s (%s)", component, version.Version, runtime.Version()))
 		gcsClient, err := storage.NewClient(context.Background(), gcsOptions)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "create GCS client")
 		}
-		return objstore.BucketWithMetrics(*gcsBucket, gcs.NewBucket(*gcsBucket, gcsClient.Bucket(*gcsBucket), reg), reg), gcsClient.Close, nil
-	}
-
-	if s3Config.Validate() == nil {
-		b, err := s3.NewBucket(&s3Config, reg, component)
+		b, err := gcs.NewBucket(p.GCSBucket, gcsClient.Bucket(p.GCSBucket), &p.GCS, reg)
+		if err != nil {
+			gcsClient.Close()
+			return nil, nil, errors.Wrap(err, "create GCS bucket")
+		}
+		return conf.wrap(p.GCSBucket, b, gcs.IsRetryableErr, keys, reg), gcsClient.Close, nil
+	case S3:
+		b, err := s3.NewBucket(&p.S3, reg, component)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "create s3 client")
 		}
-		return objstore.BucketWithMetrics(s3Config.Bucket, b, reg), func() error { return nil }, nil
+		return conf.wrap(p.S3.Bucket, b, s3.IsRetryableErr, keys, reg), func() error { return nil }, nil
+	case AZURE:
+		b, err := azure.NewBucket(&p.Azure, reg, component)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "create azure client")
+		}
+		return conf.wrap(p.Azure.Container, b, azure.IsRetryableErr, keys, reg), func() error { return nil }, nil
+	case SWIFT:
+		b, err := swift.NewBucket(&p.Swift, reg, component)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "create swift client")
+		}
+		return conf.wrap(p.Swift.ContainerName, b, swift.IsRetryableErr, keys, reg), func() error { return nil }, nil
+	case OSS:
+		b, err := oss.NewBucket(&p.OSS, reg, component)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "create oss client")
+		}
+		return conf.wrap(p.OSS.Bucket, b, oss.IsRetryableErr, keys, reg), func() error { return nil }, nil
+	default:
+		b, err := filesystem.NewBucket(p.Filesystem.Directory)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "create filesystem bucket")
+		}
+		return conf.wrap(p.Filesystem.Directory, b, nil, keys, reg), func() error { return nil }, nil
 	}
-
-	return nil, nil, ErrNotFound
 }
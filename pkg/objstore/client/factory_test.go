@@ -0,0 +1,132 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/units"
+	"github.com/improbable-eng/thanos/pkg/extprom"
+	"github.com/improbable-eng/thanos/pkg/objstore/filesystem"
+	"github.com/improbable-eng/thanos/pkg/objstore/s3"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseBucketConfig(t *testing.T) {
+	p, err := parseBucketConfig([]byte(`
+type: S3
+config:
+  bucket: blocks
+  endpoint: s3.amazonaws.com
+  access_key: key
+  secret_key: secret
+  part_size: 16777216
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, Providers{S3: s3.Config{
+		Bucket:    "blocks",
+		Endpoint:  "s3.amazonaws.com",
+		AccessKey: "key",
+		SecretKey: "secret",
+		PartSize:  16 * units.MiB,
+	}}, p)
+
+	p, err = parseBucketConfig([]byte("type: GCS\nconfig:\n  bucket: blocks\n  kms_key_name: key"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, "blocks", p.GCSBucket)
+	testutil.Equals(t, "key", p.GCS.KMSKeyName)
+
+	// Options missing in the configuration keep the defaults of the flags.
+	p, err = parseBucketConfig([]byte("type: SWIFT\nconfig:\n  auth_url: http://keystone/v3\n  username: u\n  password: p\n  container_name: blocks"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, "Default", p.Swift.UserDomainName)
+	testutil.Equals(t, units.GiB, p.Swift.SegmentSize)
+
+	for _, c := range []string{
+		"",
+		"type: UNKNOWN",
+		"type: FILESYSTEM",
+		"type: FILESYSTEM\nconfig:\n  unknown_field: dir",
+		"type: FILESYSTEM\nunknown_field: 1",
+		"type: GCS\nconfig:\n  kms_key_name: key",
+		"type: S3\nconfig:\n  bucket: blocks",
+	} {
+		_, err := parseBucketConfig([]byte(c))
+		testutil.Assert(t, err != nil, "expected error for config %q", c)
+	}
+}
+
+func TestConfig_ConfigContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-objstore-config")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	content := "type: FILESYSTEM\nconfig:\n  dir: " + dir
+	file := filepath.Join(dir, "objstore.yaml")
+	testutil.Ok(t, ioutil.WriteFile(file, []byte(content), 0600))
+
+	for _, conf := range []Config{{ConfigFile: file}, {ConfigContent: content}} {
+		b, err := conf.configContent()
+		testutil.Ok(t, err)
+		p, err := parseBucketConfig(b)
+		testutil.Ok(t, err)
+		testutil.Equals(t, Providers{Filesystem: filesystem.Config{Directory: dir}}, p)
+	}
+
+	b, err := Config{}.configContent()
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(b))
+
+	_, err = Config{ConfigFile: file, ConfigContent: content}.configContent()
+	testutil.NotOk(t, err)
+	_, err = Config{ConfigFile: filepath.Join(dir, "missing")}.configContent()
+	testutil.NotOk(t, err)
+}
+
+func TestNewBucket_MultipleProviders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-objstore-providers")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	_, _, err = NewBucket(Config{}, prometheus.NewRegistry(), "test")
+	testutil.Equals(t, ErrNotFound, err)
+
+	conf := Config{Providers: Providers{Filesystem: filesystem.Config{Directory: dir}}}
+	_, closeFn, err := NewBucket(conf, prometheus.NewRegistry(), "test")
+	testutil.Ok(t, err)
+	testutil.Ok(t, closeFn())
+
+	conf.S3 = s3.Config{Bucket: "blocks", Endpoint: "s3.amazonaws.com"}
+	_, _, err = NewBucket(conf, prometheus.NewRegistry(), "test")
+	testutil.NotOk(t, err)
+	testutil.Assert(t, err != ErrNotFound, "expected error about multiple providers, got %v", err)
+
+	// Provider flags are ignored if a YAML configuration is given.
+	conf.ConfigContent = "type: FILESYSTEM\nconfig:\n  dir: " + dir
+	_, closeFn, err = NewBucket(conf, prometheus.NewRegistry(), "test")
+	testutil.Ok(t, err)
+	testutil.Ok(t, closeFn())
+}
+
+func TestNewBucket_SameBucketTwice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-objstore-same-bucket")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	// Two prefixes of the same bucket register the same metrics, so each one needs labels of its own.
+	reg := prometheus.NewRegistry()
+	conf := Config{Providers: Providers{Filesystem: filesystem.Config{Directory: dir}}, Prefix: "a"}
+	_, closeFn, err := NewBucket(conf, extprom.WrapRegistererWith(prometheus.Labels{"role": "source"}, reg), "test")
+	testutil.Ok(t, err)
+	testutil.Ok(t, closeFn())
+
+	conf.Prefix = "b"
+	_, closeFn, err = NewBucket(conf, extprom.WrapRegistererWith(prometheus.Labels{"role": "target"}, reg), "test")
+	testutil.Ok(t, err)
+	testutil.Ok(t, closeFn())
+
+	_, err = reg.Gather()
+	testutil.Ok(t, err)
+}
@@ -0,0 +1,538 @@
+// Package encryption implements client-side encryption of the objects of buckets that are not fully trusted.
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/pkg/errors"
+)
+
+// Objects are stored as a header holding the encrypted data key of the object followed by the encrypted chunks of the
+// object. The header consists of the magic bytes, the format version, the chunk size and the length of the encrypted
+// data key as big endian uint32 and uint16, and the encrypted data key. Every chunk is sealed with AES-256-GCM under
+// the data key, with its index as nonce. The last chunk is sealed with different additional data, so that truncated
+// objects are detected.
+const (
+	magic         = "TENC"
+	formatVersion = 1
+	chunkSize     = 64 * 1024
+	dataKeySize   = 32
+
+	// headerPrefixSize is the size of the header without the encrypted data key.
+	headerPrefixSize = len(magic) + 1 + 4 + 2
+	// headerReadSize is the number of bytes read to get the header before range reads. It fits the data keys
+	// encrypted by all key wrappers, so a single request suffices.
+	headerReadSize = 1024
+	// maxCachedHeaders is the number of object headers kept to avoid reading and decrypting them for every range
+	// read.
+	maxCachedHeaders = 10000
+)
+
+var (
+	chunkAD      = []byte{0}
+	finalChunkAD = []byte{1}
+)
+
+// header holds the parameters needed to decrypt an object.
+type header struct {
+	// size is the size of the encoded header, i.e. the offset of the first chunk.
+	size      int64
+	chunkSize int
+	aead      cipher.AEAD
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(i uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], i)
+	return nonce
+}
+
+func encodeHeader(chunkSize int, wrappedKey []byte) []byte {
+	b := make([]byte, headerPrefixSize, headerPrefixSize+len(wrappedKey))
+	copy(b, magic)
+	b[len(magic)] = formatVersion
+	binary.BigEndian.PutUint32(b[len(magic)+1:], uint32(chunkSize))
+	binary.BigEndian.PutUint16(b[len(magic)+5:], uint16(len(wrappedKey)))
+	return append(b, wrappedKey...)
+}
+
+// decodeHeaderPrefix returns the chunk size and the length of the encrypted data key of the header starting with b.
+func decodeHeaderPrefix(b []byte) (int, int, error) {
+	if len(b) < headerPrefixSize || string(b[:len(magic)]) != magic {
+		return 0, 0, errors.New("object is not encrypted")
+	}
+	if v := b[len(magic)]; v != formatVersion {
+		return 0, 0, errors.Errorf("unsupported encryption format version %d", v)
+	}
+	chunkSize := int(binary.BigEndian.Uint32(b[len(magic)+1:]))
+	if chunkSize == 0 {
+		return 0, 0, errors.New("invalid chunk size 0")
+	}
+	return chunkSize, int(binary.BigEndian.Uint16(b[len(magic)+5:])), nil
+}
+
+// NewEncryptedBucket returns a bucket that encrypts objects before uploading them to bkt and decrypts them when they
+// are read. Every object is encrypted with its own data key, which is stored in the object encrypted by keys.
+// Objects are encrypted in chunks, so ranges are read without downloading whole objects. All objects read through
+// the bucket must have been encrypted. Sizes reported by IterWithAttributes and Attributes are the sizes of the
+// encrypted objects.
+func NewEncryptedBucket(bkt objstore.Bucket, keys KeyWrapper) objstore.Bucket {
+	return &encryptedBucket{Bucket: bkt, keys: keys, headers: map[string]*header{}}
+}
+
+type encryptedBucket struct {
+	objstore.Bucket
+
+	keys KeyWrapper
+
+	mtx     sync.Mutex
+	headers map[string]*header
+}
+
+func (b *encryptedBucket) cachedHeader(name string) *header {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return b.headers[name]
+}
+
+func (b *encryptedBucket) cacheHeader(name string, h *header) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if len(b.headers) >= maxCachedHeaders {
+		// Evict an arbitrary header.
+		for n := range b.headers {
+			delete(b.headers, n)
+			break
+		}
+	}
+	b.headers[name] = h
+}
+
+func (b *encryptedBucket) dropHeader(name string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	delete(b.headers, name)
+}
+
+// readHeader reads the header of an object from r and decrypts its data key.
+func (b *encryptedBucket) readHeader(ctx context.Context, r io.Reader) (*header, error) {
+	prefix := make([]byte, headerPrefixSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errors.New("object is not encrypted")
+		}
+		return nil, err
+	}
+	chunkSize, keyLen, err := decodeHeaderPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	wrapped := make([]byte, keyLen)
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return nil, errors.Wrap(err, "read data key")
+	}
+	key, err := b.keys.UnwrapKey(ctx, wrapped)
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypt data key")
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "create cipher")
+	}
+	return &header{size: int64(headerPrefixSize + keyLen), chunkSize: chunkSize, aead: aead}, nil
+}
+
+// header returns the header of the object with the given name, reading it with a range read if it is not cached.
+func (b *encryptedBucket) header(ctx context.Context, name string) (*header, error) {
+	if h := b.cachedHeader(name); h != nil {
+		return h, nil
+	}
+	rc, err := b.Bucket.GetRange(ctx, name, 0, headerReadSize)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "read header")
+	}
+	// Data keys not fitting into the first read are read separately.
+	if _, keyLen, err := decodeHeaderPrefix(buf); err == nil && headerPrefixSize+keyLen > len(buf) {
+		rc, err := b.Bucket.GetRange(ctx, name, int64(len(buf)), int64(headerPrefixSize+keyLen-len(buf)))
+		if err != nil {
+			return nil, err
+		}
+		rest, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "read header")
+		}
+		buf = append(buf, rest...)
+	}
+	h, err := b.readHeader(ctx, bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	b.cacheHeader(name, h)
+	return h, nil
+}
+
+// Get returns a reader for the decrypted content of the given object. Reads fail if the object was modified.
+func (b *encryptedBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	rc, err := b.Bucket.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(rc)
+	h, err := b.readHeader(ctx, br)
+	if err != nil {
+		rc.Close()
+		return nil, errors.Wrapf(err, "read encryption header of %s", name)
+	}
+	b.cacheHeader(name, h)
+	return &decryptReader{r: br, closer: rc, h: h, left: -1, whole: true}, nil
+}
+
+// GetRange returns a reader for the given range of the decrypted content of the object. Only the chunks overlapping
+// with the range are downloaded.
+func (b *encryptedBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	h, err := b.header(ctx, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read encryption header of %s", name)
+	}
+	if length <= 0 {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	var (
+		cs          = int64(h.chunkSize)
+		sealedSize  = cs + int64(h.aead.Overhead())
+		first, last = off / cs, (off + length - 1) / cs
+	)
+	rc, err := b.Bucket.GetRange(ctx, name, h.size+first*sealedSize, (last-first+1)*sealedSize)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		r:      bufio.NewReader(rc),
+		closer: rc,
+		h:      h,
+		chunk:  uint64(first),
+		skip:   int(off - first*cs),
+		left:   length,
+	}, nil
+}
+
+// Upload encrypts the content of the reader with a new data key and uploads it.
+func (b *encryptedBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	b.dropHeader(name)
+
+	er, err := newEncryptReader(ctx, b.keys, r)
+	if err != nil {
+		return errors.Wrapf(err, "encrypt %s", name)
+	}
+	return b.Bucket.Upload(ctx, name, er)
+}
+
+func (b *encryptedBucket) Delete(ctx context.Context, name string) error {
+	b.dropHeader(name)
+	return b.Bucket.Delete(ctx, name)
+}
+
+// decryptReader decrypts the chunks read from r, the first of which has the given index. It skips the first skip
+// bytes of plaintext and returns up to left bytes after them. left is negative for reads of whole objects, which must
+// end with the final chunk.
+type decryptReader struct {
+	r      *bufio.Reader
+	closer io.Closer
+	h      *header
+
+	chunk uint64
+	skip  int
+	left  int64
+	whole bool
+
+	sealed, plain []byte
+	buf           []byte
+	final         bool
+	err           error
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.next()
+	}
+	if r.left >= 0 && int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	if r.left >= 0 {
+		if r.left -= int64(n); r.left == 0 {
+			r.buf, r.err = nil, io.EOF
+		}
+	}
+	return n, nil
+}
+
+// next decrypts the next chunk into buf.
+func (r *decryptReader) next() error {
+	if r.final {
+		return io.EOF
+	}
+	if r.sealed == nil {
+		r.sealed = make([]byte, r.h.chunkSize+r.h.aead.Overhead())
+		r.plain = make([]byte, 0, r.h.chunkSize)
+	}
+	n, err := io.ReadFull(r.r, r.sealed)
+	if err == io.EOF {
+		if r.whole {
+			return errors.New("encrypted object is truncated")
+		}
+		return io.EOF
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	sealed := r.sealed[:n]
+	nonce := chunkNonce(r.chunk)
+
+	var plain []byte
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		// Only the last chunk of an object is shorter than the others.
+		r.final = true
+		plain, err = r.h.aead.Open(r.plain[:0], nonce, sealed, finalChunkAD)
+	case r.whole:
+		if _, perr := r.r.Peek(1); perr != nil {
+			if perr != io.EOF {
+				return perr
+			}
+			r.final = true
+		}
+		ad := chunkAD
+		if r.final {
+			ad = finalChunkAD
+		}
+		plain, err = r.h.aead.Open(r.plain[:0], nonce, sealed, ad)
+	default:
+		// A range may end with the final chunk of an object whose size is a multiple of the chunk size.
+		plain, err = r.h.aead.Open(r.plain[:0], nonce, sealed, chunkAD)
+		if err != nil {
+			plain, err = r.h.aead.Open(r.plain[:0], nonce, sealed, finalChunkAD)
+			r.final = err == nil
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "decrypt chunk %d", r.chunk)
+	}
+	r.chunk++
+
+	if r.skip >= len(plain) {
+		r.skip -= len(plain)
+		return nil
+	}
+	r.buf, r.skip = plain[r.skip:], 0
+	return nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.closer.Close()
+}
+
+// encryptReader returns the header and the encrypted chunks of the content read from src.
+type encryptReader struct {
+	ctx  context.Context
+	keys KeyWrapper
+	src  io.Reader
+	r    *bufio.Reader
+
+	aead   cipher.AEAD
+	header []byte
+	// sealed is true once chunks were encrypted with the current data key.
+	sealed bool
+
+	chunk      uint64
+	plain, out []byte
+	outBuf     []byte
+	final      bool
+	pos        int64
+}
+
+func newEncryptReader(ctx context.Context, keys KeyWrapper, src io.Reader) (io.Reader, error) {
+	r := &encryptReader{
+		ctx:    ctx,
+		keys:   keys,
+		src:    src,
+		r:      bufio.NewReader(src),
+		plain:  make([]byte, chunkSize),
+		outBuf: make([]byte, 0, chunkSize+16),
+	}
+	if err := r.newDataKey(); err != nil {
+		return nil, err
+	}
+	r.out = r.header
+
+	if s, ok := src.(io.Seeker); ok {
+		if start, err := s.Seek(0, io.SeekCurrent); err == nil {
+			return &seekableEncryptReader{encryptReader: r, s: s, start: start}, nil
+		}
+	}
+	return r, nil
+}
+
+// newDataKey generates a new data key and encodes the header holding it.
+func (r *encryptReader) newDataKey() error {
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return errors.Wrap(err, "generate data key")
+	}
+	wrapped, err := r.keys.WrapKey(r.ctx, key)
+	if err != nil {
+		return errors.Wrap(err, "encrypt data key")
+	}
+	if len(wrapped) > 1<<16-1 {
+		return errors.Errorf("encrypted data key of %d bytes is too large", len(wrapped))
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return errors.Wrap(err, "create cipher")
+	}
+	r.aead, r.header, r.sealed = aead, encodeHeader(chunkSize, wrapped), false
+	return nil
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.final {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	r.pos += int64(n)
+	return n, nil
+}
+
+// next encrypts the next chunk into out.
+func (r *encryptReader) next() error {
+	n, err := io.ReadFull(r.r, r.plain)
+	switch err {
+	case nil:
+		_, perr := r.r.Peek(1)
+		if perr != nil && perr != io.EOF {
+			return perr
+		}
+		r.final = perr == io.EOF
+	case io.EOF, io.ErrUnexpectedEOF:
+		r.final = true
+	default:
+		return err
+	}
+	ad := chunkAD
+	if r.final {
+		ad = finalChunkAD
+	}
+	r.out = r.aead.Seal(r.outBuf[:0], chunkNonce(r.chunk), r.plain[:n], ad)
+	r.chunk++
+	r.sealed = true
+	return nil
+}
+
+// seekableEncryptReader is an encryptReader of a seekable source. It can be rewound to its start, e.g. to retry
+// uploads, and reports its size when seeking to its end.
+type seekableEncryptReader struct {
+	*encryptReader
+
+	s     io.Seeker
+	start int64
+}
+
+// Seek seeks to the start or the end of the encrypted stream. Other offsets are not supported.
+func (r *seekableEncryptReader) Seek(offset int64, whence int) (int64, error) {
+	size := int64(-1)
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		s, err := r.size()
+		if err != nil {
+			return 0, err
+		}
+		size = s
+		offset += size
+	}
+	switch {
+	case offset == r.pos:
+		return r.pos, nil
+	case offset == 0:
+		return 0, r.rewind()
+	case offset == size:
+		// Reads at the end return io.EOF until the reader is rewound.
+		r.out, r.final, r.pos = nil, true, size
+		return size, nil
+	}
+	return 0, errors.New("encrypted streams can only be sought to their start or end")
+}
+
+// size returns the size of the whole encrypted stream.
+func (r *seekableEncryptReader) size() (int64, error) {
+	cur, err := r.s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := r.s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.s.Seek(cur, io.SeekStart); err != nil {
+		return 0, err
+	}
+	plain := end - r.start
+	chunks := (plain + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		// Empty objects consist of an empty final chunk.
+		chunks = 1
+	}
+	return int64(len(r.header)) + plain + chunks*int64(r.aead.Overhead()), nil
+}
+
+// rewind restarts the stream. A new data key is used if chunks were encrypted already, so that a source changing
+// between reads is never encrypted with the same key and nonces twice.
+func (r *seekableEncryptReader) rewind() error {
+	if _, err := r.s.Seek(r.start, io.SeekStart); err != nil {
+		return err
+	}
+	if r.sealed {
+		if err := r.newDataKey(); err != nil {
+			return err
+		}
+	}
+	r.r.Reset(r.src)
+	r.out, r.final, r.chunk, r.pos = r.header, false, 0, 0
+	return nil
+}
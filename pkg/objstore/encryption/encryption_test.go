@@ -0,0 +1,155 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+func testKeys(t *testing.T, b byte) KeyWrapper {
+	keys, err := NewStaticKeyWrapper(bytes.Repeat([]byte{b}, 32))
+	testutil.Ok(t, err)
+	return keys
+}
+
+func TestEncryptedBucket(t *testing.T) {
+	ctx := context.Background()
+	raw := inmem.NewBucket()
+	bkt := NewEncryptedBucket(raw, testKeys(t, 1))
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 5} {
+		content := make([]byte, size)
+		rand.Read(content)
+		testutil.Ok(t, bkt.Upload(ctx, "obj", bytes.NewReader(content)))
+
+		encrypted := raw.Objects()["obj"]
+		testutil.Assert(t, len(encrypted) > size, "expected encrypted object to be larger than %d bytes, got %d", size, len(encrypted))
+		if size > 0 {
+			testutil.Assert(t, !bytes.Contains(encrypted, content), "expected object of %d bytes to be encrypted", size)
+		}
+
+		rc, err := bkt.Get(ctx, "obj")
+		testutil.Ok(t, err)
+		b, err := ioutil.ReadAll(rc)
+		testutil.Ok(t, err)
+		testutil.Ok(t, rc.Close())
+		testutil.Assert(t, bytes.Equal(content, b), "unexpected content of object of %d bytes", size)
+
+		for _, r := range [][2]int{
+			{0, 1},
+			{0, size},
+			{1, chunkSize},
+			{chunkSize - 1, 2},
+			{chunkSize, chunkSize},
+			{size - 1, 10},
+		} {
+			off, length := r[0], r[1]
+			if off < 0 || off >= size {
+				continue
+			}
+			rc, err := bkt.GetRange(ctx, "obj", int64(off), int64(length))
+			testutil.Ok(t, err)
+			b, err := ioutil.ReadAll(rc)
+			testutil.Ok(t, err)
+			testutil.Ok(t, rc.Close())
+
+			end := off + length
+			if end > size {
+				end = size
+			}
+			testutil.Assert(t, bytes.Equal(content[off:end], b), "unexpected range %d+%d of object of %d bytes", off, length, size)
+		}
+	}
+
+	// Objects can neither be read with a different key nor without encryption.
+	_, err := NewEncryptedBucket(raw, testKeys(t, 2)).Get(ctx, "obj")
+	testutil.NotOk(t, err)
+	testutil.Ok(t, raw.Upload(ctx, "plain", bytes.NewReader([]byte("plain"))))
+	_, err = bkt.Get(ctx, "plain")
+	testutil.NotOk(t, err)
+	_, err = bkt.GetRange(ctx, "plain", 0, 1)
+	testutil.NotOk(t, err)
+}
+
+func TestEncryptedBucket_Modified(t *testing.T) {
+	ctx := context.Background()
+	raw := inmem.NewBucket()
+	bkt := NewEncryptedBucket(raw, testKeys(t, 1))
+
+	content := make([]byte, 2*chunkSize+10)
+	rand.Read(content)
+	testutil.Ok(t, bkt.Upload(ctx, "obj", bytes.NewReader(content)))
+	encrypted := raw.Objects()["obj"]
+
+	read := func() error {
+		rc, err := bkt.Get(ctx, "obj")
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		_, err = ioutil.ReadAll(rc)
+		return err
+	}
+
+	// Objects truncated after a complete chunk are detected.
+	truncated := encrypted[:len(encrypted)-10-16]
+	testutil.Ok(t, raw.Upload(ctx, "obj", bytes.NewReader(truncated)))
+	testutil.NotOk(t, read())
+
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(tampered)-1] ^= 1
+	testutil.Ok(t, raw.Upload(ctx, "obj", bytes.NewReader(tampered)))
+	testutil.NotOk(t, read())
+}
+
+func TestEncryptReader_Seek(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys(t, 1)
+	content := make([]byte, 2*chunkSize+10)
+	rand.Read(content)
+
+	r, err := newEncryptReader(ctx, keys, bytes.NewReader(content))
+	testutil.Ok(t, err)
+	s, ok := r.(io.Seeker)
+	testutil.Assert(t, ok, "expected reader of seekable source to be seekable")
+
+	size, err := s.Seek(0, io.SeekEnd)
+	testutil.Ok(t, err)
+	_, err = s.Seek(0, io.SeekStart)
+	testutil.Ok(t, err)
+
+	// A partially read stream can be rewound.
+	_, err = io.ReadFull(r, make([]byte, chunkSize))
+	testutil.Ok(t, err)
+	pos, err := s.Seek(0, io.SeekCurrent)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(chunkSize), pos)
+	_, err = s.Seek(1, io.SeekStart)
+	testutil.NotOk(t, err)
+	_, err = s.Seek(0, io.SeekStart)
+	testutil.Ok(t, err)
+
+	encrypted, err := ioutil.ReadAll(r)
+	testutil.Ok(t, err)
+	testutil.Equals(t, size, int64(len(encrypted)))
+
+	raw := inmem.NewBucket()
+	testutil.Ok(t, raw.Upload(ctx, "obj", bytes.NewReader(encrypted)))
+	rc, err := NewEncryptedBucket(raw, keys).Get(ctx, "obj")
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Assert(t, bytes.Equal(content, b), "unexpected content of rewound stream")
+
+	// Sources that cannot be rewound result in readers that cannot be either.
+	r, err = newEncryptReader(ctx, keys, io.MultiReader(bytes.NewReader(content)))
+	testutil.Ok(t, err)
+	_, ok = r.(io.Seeker)
+	testutil.Assert(t, !ok, "expected reader of unseekable source not to be seekable")
+}
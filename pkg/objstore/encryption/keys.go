@@ -0,0 +1,153 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	kmsEndpoint = "https://cloudkms.googleapis.com/v1/"
+	kmsScope    = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// KeyWrapper encrypts and decrypts the data keys of objects with a key encryption key.
+type KeyWrapper interface {
+	// WrapKey returns the encrypted data key.
+	WrapKey(ctx context.Context, key []byte) ([]byte, error)
+	// UnwrapKey returns the data key decrypted from the result of WrapKey.
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// Config configures the key encryption key of client-side encryption. Encryption is disabled if no key is configured.
+type Config struct {
+	// KeyFile is the path to a file containing a 32 byte key encryption key.
+	KeyFile string
+	// KMSKeyName is the Cloud KMS key used as key encryption key, e.g.
+	// projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>.
+	KMSKeyName string
+}
+
+// NewKeyWrapper returns the key wrapper of the configured key encryption key or nil if encryption is disabled.
+func NewKeyWrapper(ctx context.Context, conf Config) (KeyWrapper, error) {
+	switch {
+	case conf.KeyFile != "" && conf.KMSKeyName != "":
+		return nil, errors.New("encryption key file and Cloud KMS key are mutually exclusive")
+	case conf.KeyFile != "":
+		key, err := ioutil.ReadFile(conf.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read encryption key file")
+		}
+		return NewStaticKeyWrapper(key)
+	case conf.KMSKeyName != "":
+		client, err := google.DefaultClient(ctx, kmsScope)
+		if err != nil {
+			return nil, errors.Wrap(err, "create Cloud KMS client")
+		}
+		return NewKMSKeyWrapper(client, conf.KMSKeyName), nil
+	}
+	return nil, nil
+}
+
+type staticKeyWrapper struct {
+	aead cipher.AEAD
+}
+
+// NewStaticKeyWrapper returns a key wrapper encrypting data keys with AES-256-GCM under the given 32 byte key.
+func NewStaticKeyWrapper(key []byte) (KeyWrapper, error) {
+	if len(key) != 32 {
+		return nil, errors.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &staticKeyWrapper{aead: aead}, nil
+}
+
+func (w *staticKeyWrapper) WrapKey(_ context.Context, key []byte) ([]byte, error) {
+	nonce := make([]byte, w.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "generate nonce")
+	}
+	return w.aead.Seal(nonce, nonce, key, nil), nil
+}
+
+func (w *staticKeyWrapper) UnwrapKey(_ context.Context, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < w.aead.NonceSize() {
+		return nil, errors.New("encrypted data key is too short")
+	}
+	n := w.aead.NonceSize()
+	return w.aead.Open(nil, wrapped[:n], wrapped[n:], nil)
+}
+
+type kmsKeyWrapper struct {
+	client   *http.Client
+	endpoint string
+	keyName  string
+}
+
+// NewKMSKeyWrapper returns a key wrapper encrypting data keys with the given Cloud KMS key. The client must add
+// credentials to requests.
+func NewKMSKeyWrapper(client *http.Client, keyName string) KeyWrapper {
+	return &kmsKeyWrapper{client: client, endpoint: kmsEndpoint, keyName: keyName}
+}
+
+// do calls the given method of the Cloud KMS key.
+func (w *kmsKeyWrapper) do(ctx context.Context, method string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return errors.Wrap(err, "encode request")
+	}
+	req, err := http.NewRequest(http.MethodPost, w.endpoint+w.keyName+":"+method, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "Cloud KMS %s", method)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("Cloud KMS %s: %s: %s", method, resp.Status, bytes.TrimSpace(msg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.Wrapf(err, "decode Cloud KMS %s response", method)
+	}
+	return nil
+}
+
+func (w *kmsKeyWrapper) WrapKey(ctx context.Context, key []byte) ([]byte, error) {
+	var resp struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	err := w.do(ctx, "encrypt", map[string]string{"plaintext": base64.StdEncoding.EncodeToString(key)}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Ciphertext)
+}
+
+func (w *kmsKeyWrapper) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext string `json:"plaintext"`
+	}
+	err := w.do(ctx, "decrypt", map[string]string{"ciphertext": base64.StdEncoding.EncodeToString(wrapped)}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Plaintext)
+}
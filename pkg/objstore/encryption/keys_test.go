@@ -0,0 +1,108 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+func TestStaticKeyWrapper(t *testing.T) {
+	ctx := context.Background()
+	_, err := NewStaticKeyWrapper([]byte("short"))
+	testutil.NotOk(t, err)
+
+	keys := testKeys(t, 1)
+	key := bytes.Repeat([]byte{3}, dataKeySize)
+	wrapped, err := keys.WrapKey(ctx, key)
+	testutil.Ok(t, err)
+	testutil.Assert(t, !bytes.Contains(wrapped, key), "expected data key to be encrypted")
+
+	unwrapped, err := keys.UnwrapKey(ctx, wrapped)
+	testutil.Ok(t, err)
+	testutil.Equals(t, key, unwrapped)
+
+	_, err = testKeys(t, 2).UnwrapKey(ctx, wrapped)
+	testutil.NotOk(t, err)
+}
+
+func TestKMSKeyWrapper(t *testing.T) {
+	const keyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+
+	// The fake service "encrypts" by reversing the plaintext.
+	reverse := func(b []byte) []byte {
+		r := make([]byte, len(b))
+		for i := range b {
+			r[len(b)-1-i] = b[i]
+		}
+		return r
+	}
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+
+		var req map[string]string
+		testutil.Ok(t, json.NewDecoder(r.Body).Decode(&req))
+		switch {
+		case strings.HasSuffix(r.URL.Path, ":encrypt"):
+			b, err := base64.StdEncoding.DecodeString(req["plaintext"])
+			testutil.Ok(t, err)
+			json.NewEncoder(w).Encode(map[string]string{"ciphertext": base64.StdEncoding.EncodeToString(reverse(b))})
+		case strings.HasSuffix(r.URL.Path, ":decrypt"):
+			if req["ciphertext"] == "" {
+				http.Error(w, `{"error": "invalid ciphertext"}`, http.StatusBadRequest)
+				return
+			}
+			b, err := base64.StdEncoding.DecodeString(req["ciphertext"])
+			testutil.Ok(t, err)
+			json.NewEncoder(w).Encode(map[string]string{"plaintext": base64.StdEncoding.EncodeToString(reverse(b))})
+		}
+	}))
+	defer srv.Close()
+
+	keys := &kmsKeyWrapper{client: http.DefaultClient, endpoint: srv.URL + "/v1/", keyName: keyName}
+	ctx := context.Background()
+
+	wrapped, err := keys.WrapKey(ctx, []byte("key"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, []byte("yek"), wrapped)
+	unwrapped, err := keys.UnwrapKey(ctx, wrapped)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []byte("key"), unwrapped)
+	testutil.Equals(t, []string{"/v1/" + keyName + ":encrypt", "/v1/" + keyName + ":decrypt"}, paths)
+
+	_, err = keys.UnwrapKey(ctx, nil)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, strings.Contains(err.Error(), "invalid ciphertext"), "expected error message of the service, got %v", err)
+}
+
+func TestNewKeyWrapper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-encryption-keys")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key")
+	testutil.Ok(t, ioutil.WriteFile(keyFile, bytes.Repeat([]byte{1}, 32), 0600))
+
+	keys, err := NewKeyWrapper(context.Background(), Config{})
+	testutil.Ok(t, err)
+	testutil.Assert(t, keys == nil, "expected encryption to be disabled")
+
+	keys, err = NewKeyWrapper(context.Background(), Config{KeyFile: keyFile})
+	testutil.Ok(t, err)
+	testutil.Assert(t, keys != nil, "expected encryption to be enabled")
+
+	_, err = NewKeyWrapper(context.Background(), Config{KeyFile: keyFile, KMSKeyName: "key"})
+	testutil.NotOk(t, err)
+	_, err = NewKeyWrapper(context.Background(), Config{KeyFile: filepath.Join(dir, "missing")})
+	testutil.NotOk(t, err)
+}
@@ -0,0 +1,242 @@
+// Package filesystem implements common object storage abstractions against a local directory. It is meant for
+// single-node, air-gapped and development setups.
+package filesystem
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// DirDelim is the delimiter used to model a directory structure in an object store bucket.
+const DirDelim = "/"
+
+// tmpSuffix marks files that are being uploaded. They are not visible as objects.
+const tmpSuffix = ".tmp-upload"
+
+// Config encapsulates the necessary config values to instantiate a filesystem bucket.
+type Config struct {
+	Directory string `yaml:"dir"`
+}
+
+// RegisterFilesystemParams registers the filesystem flags into the given Config struct.
+func RegisterFilesystemParams(cmd *kingpin.CmdClause, conf *Config) {
+	cmd.Flag("filesystem.dir", "Local directory used as bucket for stored blocks. Only for single-node and development setups.").
+		PlaceHolder("<dir>").StringVar(&conf.Directory)
+}
+
+// Validate checks to see if any of the filesystem config options are set.
+func (conf *Config) Validate() error {
+	if conf.Directory == "" {
+		return errors.New("no filesystem bucket directory configured")
+	}
+	return nil
+}
+
+// Bucket implements the store.Bucket interface against a local directory. Objects are files below the root directory,
+// object names are their slash separated paths relative to it.
+type Bucket struct {
+	rootDir string
+}
+
+// NewBucket returns a new Bucket with the given root directory, which is created if it does not exist.
+func NewBucket(rootDir string) (*Bucket, error) {
+	absDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(absDir, 0777); err != nil {
+		return nil, errors.Wrapf(err, "create bucket dir %s", absDir)
+	}
+	return &Bucket{rootDir: absDir}, nil
+}
+
+func (b *Bucket) path(name string) string {
+	return filepath.Join(b.rootDir, filepath.FromSlash(name))
+}
+
+// Iter calls f for each entry in the given directory. The argument to f is the full
+// object name including the prefix of the inspected directory.
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	}, options...)
+}
+
+// IterWithAttributes is like Iter but additionally passes the size and modification time of files to f.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error, options ...objstore.IterOption) error {
+	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
+	// object itself as one prefix item.
+	if dir != "" {
+		dir = strings.TrimSuffix(dir, DirDelim) + DirDelim
+	}
+
+	entries := map[string]objstore.ObjectAttributes{}
+	if err := b.list(dir, objstore.ApplyIterOptions(options...).Recursive, entries); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(entries))
+	for n := range entries {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := f(n, entries[n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list adds the entries of dir to entries. Subdirectories are listed as well if recursive is set, otherwise they are
+// added as entries.
+func (b *Bucket) list(dir string, recursive bool, entries map[string]objstore.ObjectAttributes) error {
+	files, err := ioutil.ReadDir(b.path(dir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "read dir %s", dir)
+	}
+
+	for _, fi := range files {
+		switch {
+		case fi.IsDir() && recursive:
+			if err := b.list(dir+fi.Name()+DirDelim, recursive, entries); err != nil {
+				return err
+			}
+		case fi.IsDir():
+			entries[dir+fi.Name()+DirDelim] = objstore.ObjectAttributes{}
+		case !strings.HasSuffix(fi.Name(), tmpSuffix):
+			entries[dir+fi.Name()] = objstore.ObjectAttributes{Size: fi.Size(), LastModified: fi.ModTime()}
+		}
+	}
+	return nil
+}
+
+// Get returns a reader for the given object name.
+func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.GetRange(ctx, name, 0, -1)
+}
+
+type rangeReaderCloser struct {
+	io.Reader
+	f *os.File
+}
+
+func (r *rangeReaderCloser) Close() error {
+	return r.f.Close()
+}
+
+// GetRange returns a new range reader for the given object name and range. A negative length reads until the
+// end of the object.
+func (b *Bucket) GetRange(_ context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if name == "" {
+		return nil, errors.New("object name is empty")
+	}
+	file := b.path(name)
+	if fi, err := os.Stat(file); err != nil {
+		return nil, errors.Wrapf(err, "stat %s", name)
+	} else if fi.IsDir() {
+		return nil, errors.Errorf("object %s is a directory", name)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open %s", name)
+	}
+	if off > 0 {
+		if _, err := f.Seek(off, io.SeekStart); err != nil {
+			f.Close()
+			return nil, errors.Wrapf(err, "seek %d in %s", off, name)
+		}
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return &rangeReaderCloser{Reader: io.LimitReader(f, length), f: f}, nil
+}
+
+// Exists checks if the given object exists.
+func (b *Bucket) Exists(_ context.Context, name string) (bool, error) {
+	fi, err := os.Stat(b.path(name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "stat %s", name)
+	}
+	return !fi.IsDir(), nil
+}
+
+// Attributes returns the size and modification time of the file.
+func (b *Bucket) Attributes(_ context.Context, name string) (objstore.ObjectAttributes, error) {
+	fi, err := os.Stat(b.path(name))
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrapf(err, "stat %s", name)
+	}
+	if fi.IsDir() {
+		return objstore.ObjectAttributes{}, errors.Errorf("%s is a directory", name)
+	}
+	return objstore.ObjectAttributes{Size: fi.Size(), LastModified: fi.ModTime()}, nil
+}
+
+// Upload the contents of the reader as an object into the bucket. The object is written to a temporary file first,
+// so readers never see partially written objects.
+func (b *Bucket) Upload(_ context.Context, name string, r io.Reader) (err error) {
+	file := b.path(name)
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		return errors.Wrapf(err, "create dir for %s", name)
+	}
+
+	tmp := file + tmpSuffix
+	f, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrapf(err, "create %s", name)
+	}
+	defer func() {
+		// Best-effort cleanup if the upload failed.
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	if _, err = io.Copy(f, r); err != nil {
+		return errors.Wrapf(err, "write %s", name)
+	}
+	if err = f.Close(); err != nil {
+		return errors.Wrapf(err, "close %s", name)
+	}
+	if err = os.Rename(tmp, file); err != nil {
+		return errors.Wrapf(err, "rename %s", name)
+	}
+	return nil
+}
+
+// Delete removes the object with the given name. Directories left empty are removed as well, so they are no longer
+// listed, same as for object storages without real directories.
+func (b *Bucket) Delete(_ context.Context, name string) error {
+	file := b.path(name)
+	if err := os.Remove(file); err != nil {
+		return errors.Wrapf(err, "delete %s", name)
+	}
+	for dir := filepath.Dir(file); dir != b.rootDir && strings.HasPrefix(dir, b.rootDir); dir = filepath.Dir(dir) {
+		// Fails for non-empty directories.
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/objtesting"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+func TestBucket(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "test-filesystem-bucket")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	bkt, err := NewBucket(filepath.Join(dir, "bucket"))
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, bkt.Upload(ctx, "dir/a", bytes.NewReader([]byte("object a"))))
+	testutil.Ok(t, bkt.Upload(ctx, "dir/sub/b", bytes.NewReader(nil)))
+	testutil.Ok(t, bkt.Upload(ctx, "c", bytes.NewReader([]byte("object c"))))
+
+	rc, err := bkt.Get(ctx, "dir/a")
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "object a", string(b))
+
+	rc, err = bkt.GetRange(ctx, "dir/a", 2, 3)
+	testutil.Ok(t, err)
+	b, err = ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "jec", string(b))
+
+	_, err = bkt.Get(ctx, "dir")
+	testutil.NotOk(t, err)
+	_, err = bkt.Get(ctx, "missing")
+	testutil.NotOk(t, err)
+
+	var names []string
+	iter := func(n string) error {
+		names = append(names, n)
+		return nil
+	}
+	testutil.Ok(t, bkt.Iter(ctx, "", iter))
+	testutil.Equals(t, []string{"c", "dir/"}, names)
+
+	names = nil
+	testutil.Ok(t, bkt.Iter(ctx, "dir", iter))
+	testutil.Equals(t, []string{"dir/a", "dir/sub/"}, names)
+
+	names = nil
+	testutil.Ok(t, bkt.Iter(ctx, "missing/", iter))
+	testutil.Equals(t, 0, len(names))
+
+	names = nil
+	testutil.Ok(t, bkt.Iter(ctx, "", iter, objstore.WithRecursiveIter()))
+	testutil.Equals(t, []string{"c", "dir/a", "dir/sub/b"}, names)
+
+	attrs := map[string]objstore.ObjectAttributes{}
+	testutil.Ok(t, bkt.IterWithAttributes(ctx, "", func(n string, a objstore.ObjectAttributes) error {
+		attrs[n] = a
+		return nil
+	}))
+	testutil.Equals(t, objstore.ObjectAttributes{}, attrs["dir/"])
+	testutil.Equals(t, int64(8), attrs["c"].Size)
+	testutil.Assert(t, time.Since(attrs["c"].LastModified) < time.Minute, "unexpected modification time %v", attrs["c"].LastModified)
+
+	ok, err := bkt.Exists(ctx, "dir/sub/b")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected object to exist")
+	ok, err = bkt.Exists(ctx, "dir/sub")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected directory not to be an object")
+
+	a, err := bkt.Attributes(ctx, "c")
+	testutil.Ok(t, err)
+	testutil.Equals(t, attrs["c"], a)
+	_, err = bkt.Attributes(ctx, "dir/sub")
+	testutil.NotOk(t, err)
+
+	// Deleting the last object of a directory removes it from listings.
+	testutil.Ok(t, bkt.Delete(ctx, "dir/sub/b"))
+	names = nil
+	testutil.Ok(t, bkt.Iter(ctx, "dir", iter))
+	testutil.Equals(t, []string{"dir/a"}, names)
+
+	testutil.Ok(t, bkt.Delete(ctx, "dir/a"))
+	testutil.Ok(t, bkt.Delete(ctx, "c"))
+	names = nil
+	testutil.Ok(t, bkt.Iter(ctx, "", iter))
+	testutil.Equals(t, 0, len(names))
+
+	// The bucket directory itself is kept.
+	_, err = os.Stat(filepath.Join(dir, "bucket"))
+	testutil.Ok(t, err)
+}
+
+func TestBucket_Acceptance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-filesystem-bucket")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	bkt, err := NewBucket(dir)
+	testutil.Ok(t, err)
+	objtesting.AcceptanceTest(t, bkt)
+}
@@ -4,11 +4,17 @@ package gcs
 import (
 	"context"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"strings"
 
 	"cloud.google.com/go/storage"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
+	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 const (
@@ -26,16 +32,53 @@ const (
 // DirDelim is the delimiter used to model a directory structure in an object store bucket.
 const DirDelim = "/"
 
+// Config encapsulates the encryption settings of a GCS bucket. The bucket itself is selected by the
+// bucket name flag of each command.
+type Config struct {
+	// KMSKeyName is the Cloud KMS key used to encrypt uploaded objects.
+	KMSKeyName string `yaml:"kms_key_name"`
+	// EncryptionKeyFile is the path to a file containing the 32 byte customer-supplied key used to
+	// encrypt and decrypt objects.
+	EncryptionKeyFile string `yaml:"encryption_key_file"`
+}
+
+// RegisterGCSParams registers the GCS encryption flags into the given Config struct.
+func RegisterGCSParams(cmd *kingpin.CmdClause, conf *Config) {
+	cmd.Flag("gcs.kms-key-name", "Cloud KMS key used to encrypt uploaded objects, e.g. projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>.").
+		PlaceHolder("<key>").Envar("GCS_KMS_KEY_NAME").StringVar(&conf.KMSKeyName)
+
+	cmd.Flag("gcs.encryption-key-file", "Path to a file containing the 32 byte customer-supplied key used to encrypt and decrypt objects.").
+		PlaceHolder("<path>").Envar("GCS_ENCRYPTION_KEY_FILE").StringVar(&conf.EncryptionKeyFile)
+}
+
 // Bucket implements the store.Bucket and shipper.Bucket interfaces against GCS.
 type Bucket struct {
-	bkt      *storage.BucketHandle
-	opsTotal *prometheus.CounterVec
+	bkt           *storage.BucketHandle
+	kmsKeyName    string
+	encryptionKey []byte
+	opsTotal      *prometheus.CounterVec
 }
 
 // NewBucket returns a new Bucket against the given bucket handle.
-func NewBucket(name string, b *storage.BucketHandle, reg prometheus.Registerer) *Bucket {
+func NewBucket(name string, b *storage.BucketHandle, conf *Config, reg prometheus.Registerer) (*Bucket, error) {
+	if conf.KMSKeyName != "" && conf.EncryptionKeyFile != "" {
+		return nil, errors.New("Cloud KMS and customer-supplied encryption keys are mutually exclusive")
+	}
+	var key []byte
+	if conf.EncryptionKeyFile != "" {
+		var err error
+		if key, err = ioutil.ReadFile(conf.EncryptionKeyFile); err != nil {
+			return nil, errors.Wrap(err, "read encryption key file")
+		}
+		if len(key) != 32 {
+			return nil, errors.Errorf("customer-supplied encryption key must be 32 bytes, got %d", len(key))
+		}
+	}
+
 	bkt := &Bucket{
-		bkt: b,
+		bkt:           b,
+		kmsKeyName:    conf.KMSKeyName,
+		encryptionKey: key,
 		opsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name:        "thanos_objstore_gcs_bucket_operations_total",
 			Help:        "Total number of operations that were executed against a Google Compute Storage bucket.",
@@ -45,21 +88,42 @@ func NewBucket(name string, b *storage.BucketHandle, reg prometheus.Registerer)
 	if reg != nil {
 		reg.MustRegister()
 	}
-	return bkt
+	return bkt, nil
+}
+
+// object returns the handle of the named object. Objects encrypted with a customer-supplied key can only be
+// accessed with the key.
+func (b *Bucket) object(name string) *storage.ObjectHandle {
+	o := b.bkt.Object(name)
+	if b.encryptionKey != nil {
+		o = o.Key(b.encryptionKey)
+	}
+	return o
 }
 
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
-func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	}, options...)
+}
+
+// IterWithAttributes is like Iter but additionally passes the size and modification time of objects to f.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error, options ...objstore.IterOption) error {
 	b.opsTotal.WithLabelValues(opObjectsList).Inc()
 	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
 	// object itself as one prefix item.
 	if dir != "" {
 		dir = strings.TrimSuffix(dir, DirDelim) + DirDelim
 	}
+	delim := DirDelim
+	if objstore.ApplyIterOptions(options...).Recursive {
+		delim = ""
+	}
 	it := b.bkt.Objects(ctx, &storage.Query{
 		Prefix:    dir,
-		Delimiter: DirDelim,
+		Delimiter: delim,
 	})
 	for {
 		select {
@@ -74,7 +138,12 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 		if err != nil {
 			return err
 		}
-		if err := f(attrs.Prefix + attrs.Name); err != nil {
+		if attrs.Prefix != "" {
+			err = f(attrs.Prefix, objstore.ObjectAttributes{})
+		} else {
+			err = f(attrs.Name, objstore.ObjectAttributes{Size: attrs.Size, LastModified: attrs.Updated})
+		}
+		if err != nil {
 			return err
 		}
 	}
@@ -83,13 +152,13 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 // Get returns a reader for the given object name.
 func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
 	b.opsTotal.WithLabelValues(opObjectGet).Inc()
-	return b.bkt.Object(name).NewReader(ctx)
+	return b.object(name).NewReader(ctx)
 }
 
 // GetRange returns a new range reader for the given object name and range.
 func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
 	b.opsTotal.WithLabelValues(opObjectGet).Inc()
-	return b.bkt.Object(name).NewRangeReader(ctx, off, length)
+	return b.object(name).NewRangeReader(ctx, off, length)
 }
 
 // Handle returns the underlying GCS bucket handle.
@@ -102,7 +171,7 @@ func (b *Bucket) Handle() *storage.BucketHandle {
 func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 	b.opsTotal.WithLabelValues(opObjectGet).Inc()
 
-	if _, err := b.bkt.Object(name).Attrs(ctx); err == nil {
+	if _, err := b.object(name).Attrs(ctx); err == nil {
 		return true, nil
 	} else if err != storage.ErrObjectNotExist {
 		return false, err
@@ -110,11 +179,23 @@ func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 	return false, nil
 }
 
+// Attributes returns the size and modification time of the object.
+func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	b.opsTotal.WithLabelValues(opObjectGet).Inc()
+
+	attrs, err := b.object(name).Attrs(ctx)
+	if err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	return objstore.ObjectAttributes{Size: attrs.Size, LastModified: attrs.Updated}, nil
+}
+
 // Upload writes the file specified in src to remote GCS location specified as target.
 func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
 	b.opsTotal.WithLabelValues(opObjectInsert).Inc()
 
-	w := b.bkt.Object(name).NewWriter(ctx)
+	w := b.object(name).NewWriter(ctx)
+	w.KMSKeyName = b.kmsKeyName
 
 	if _, err := io.Copy(w, r); err != nil {
 		return err
@@ -128,3 +209,11 @@ func (b *Bucket) Delete(ctx context.Context, name string) error {
 
 	return b.bkt.Object(name).Delete(ctx)
 }
+
+// IsRetryableErr returns true if an operation that failed with err is likely to succeed when it is retried.
+func IsRetryableErr(err error) bool {
+	if e, ok := errors.Cause(err).(*googleapi.Error); ok {
+		return e.Code == http.StatusTooManyRequests || e.Code >= http.StatusInternalServerError
+	}
+	return objstore.IsTransientErr(err)
+}
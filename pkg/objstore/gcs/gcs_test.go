@@ -0,0 +1,16 @@
+package gcs_test
+
+import (
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/objstore/objtesting"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+func TestBucket_Acceptance(t *testing.T) {
+	bkt, cleanup, err := testutil.NewObjectStoreBucket(t)
+	testutil.Ok(t, err)
+	defer cleanup()
+
+	objtesting.AcceptanceTest(t, bkt)
+}
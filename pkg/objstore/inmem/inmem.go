@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"strings"
 
+	"github.com/improbable-eng/thanos/pkg/objstore"
 	"github.com/pkg/errors"
 )
 
@@ -31,15 +32,35 @@ func (b *Bucket) Objects() map[string][]byte {
 
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
-func (b *Bucket) Iter(_ context.Context, dir string, f func(string) error) error {
-	unique := map[string]struct{}{}
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	}, options...)
+}
+
+// IterWithAttributes is like Iter but additionally passes the size of objects to f. Their modification time is
+// not tracked.
+func (b *Bucket) IterWithAttributes(_ context.Context, dir string, f func(string, objstore.ObjectAttributes) error, options ...objstore.IterOption) error {
+	unique := map[string]objstore.ObjectAttributes{}
+	recursive := objstore.ApplyIterOptions(options...).Recursive
 
-	for filename := range b.objects {
-		if !strings.HasPrefix(filename, dir) {
+	if dir != "" {
+		dir = strings.TrimSuffix(dir, "/") + "/"
+	}
+	for filename, content := range b.objects {
+		if !strings.HasPrefix(filename, dir) || filename == dir {
 			continue
 		}
-		parts := strings.SplitAfter(filename, "/")
-		unique[parts[0]] = struct{}{}
+		if recursive {
+			unique[filename] = objstore.ObjectAttributes{Size: int64(len(content))}
+			continue
+		}
+		parts := strings.SplitAfter(strings.TrimPrefix(filename, dir), "/")
+		if len(parts) > 1 {
+			unique[dir+parts[0]] = objstore.ObjectAttributes{}
+		} else {
+			unique[filename] = objstore.ObjectAttributes{Size: int64(len(content))}
+		}
 	}
 	var keys []string
 	for n := range unique {
@@ -48,7 +69,7 @@ func (b *Bucket) Iter(_ context.Context, dir string, f func(string) error) error
 	sort.Strings(keys)
 
 	for _, k := range keys {
-		if err := f(k); err != nil {
+		if err := f(k, unique[k]); err != nil {
 			return err
 		}
 	}
@@ -90,6 +111,15 @@ func (b *Bucket) Exists(_ context.Context, name string) (bool, error) {
 	return ok, nil
 }
 
+// Attributes returns the size of the object. The modification time is not tracked and always zero.
+func (b *Bucket) Attributes(_ context.Context, name string) (objstore.ObjectAttributes, error) {
+	file, ok := b.objects[name]
+	if !ok {
+		return objstore.ObjectAttributes{}, errors.Errorf("no such file %s", name)
+	}
+	return objstore.ObjectAttributes{Size: int64(len(file))}, nil
+}
+
 // Upload writes the file specified in src to into the memory.
 func (b *Bucket) Upload(_ context.Context, name string, r io.Reader) error {
 	body, err := ioutil.ReadAll(r)
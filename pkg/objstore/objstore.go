@@ -28,7 +28,11 @@ type Bucket interface {
 type BucketReader interface {
 	// Iter calls f for each entry in the given directory. The argument to f is the full
 	// object name including the prefix of the inspected directory.
-	Iter(ctx context.Context, dir string, f func(string) error) error
+	Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error
+
+	// IterWithAttributes is like Iter but additionally passes the attributes of objects to f. The attributes of
+	// directories are zero.
+	IterWithAttributes(ctx context.Context, dir string, f func(string, ObjectAttributes) error, options ...IterOption) error
 
 	// Get returns a reader for the given object name.
 	Get(ctx context.Context, name string) (io.ReadCloser, error)
@@ -38,6 +42,9 @@ type BucketReader interface {
 
 	// Exists checks if the given object exists in the bucket.
 	Exists(ctx context.Context, name string) (bool, error)
+
+	// Attributes returns the size and modification time of the given object.
+	Attributes(ctx context.Context, name string) (ObjectAttributes, error)
 }
 
 // UploadDir uploads all files in srcdir to the bucket with into a top-level directory
@@ -80,16 +87,60 @@ func UploadFile(ctx context.Context, bkt Bucket, src, dst string) error {
 // DirDelim is the delimiter used to model a directory structure in an object store bucket.
 const DirDelim = "/"
 
+// ObjectAttributes are the attributes of an object returned by listings.
+type ObjectAttributes struct {
+	// Size is the size of the object in bytes.
+	Size int64
+	// LastModified is the time the object was uploaded.
+	LastModified time.Time
+}
+
+// IterParams are the parameters of a listing set by IterOptions.
+type IterParams struct {
+	// Recursive lists all objects below the directory instead of its direct entries. Directories are not passed to
+	// the callback then.
+	Recursive bool
+}
+
+// ignoreAttributes adapts the callback of Iter to IterWithAttributes.
+func ignoreAttributes(f func(string) error) func(string, ObjectAttributes) error {
+	return func(name string, _ ObjectAttributes) error {
+		return f(name)
+	}
+}
+
+// IterOption configures a listing.
+type IterOption func(*IterParams)
+
+// WithRecursiveIter lists all objects below the directory, e.g. all files of all blocks in a single listing.
+func WithRecursiveIter() IterOption {
+	return func(p *IterParams) {
+		p.Recursive = true
+	}
+}
+
+// ApplyIterOptions returns the parameters set by the given options.
+func ApplyIterOptions(options ...IterOption) IterParams {
+	var p IterParams
+	for _, o := range options {
+		o(&p)
+	}
+	return p
+}
+
 // DeleteDir removes all objects prefixed with dir from the bucket.
+// It stops on the first failed deletion and returns its error.
 func DeleteDir(ctx context.Context, bkt Bucket, dir string) error {
-	bkt.Iter(ctx, dir, func(name string) error {
+	return bkt.Iter(ctx, dir, func(name string) error {
 		// If we hit a directory, call DeleteDir recursively.
 		if strings.HasSuffix(name, DirDelim) {
 			return DeleteDir(ctx, bkt, name)
 		}
-		return bkt.Delete(ctx, name)
+		if err := bkt.Delete(ctx, name); err != nil {
+			return errors.Wrapf(err, "delete %s", name)
+		}
+		return nil
 	})
-	return nil
 }
 
 // DownloadFile downloads the src file from the bucket to dst. If dst is an existing
@@ -168,13 +219,18 @@ func BucketWithMetrics(name string, b Bucket, r prometheus.Registerer) Bucket {
 			ConstLabels: prometheus.Labels{"bucket": name},
 			Buckets:     []float64{0.005, 0.01, 0.02, 0.04, 0.08, 0.15, 0.3, 0.6, 1, 1.5, 2.5, 5, 10, 20, 30},
 		}, []string{"operation"}),
+		opsTransferredBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "thanos_objstore_bucket_operation_transferred_bytes_total",
+			Help:        "Total number of bytes transferred from or to the bucket by operation.",
+			ConstLabels: prometheus.Labels{"bucket": name},
+		}, []string{"operation"}),
 		lastSuccessfullUploadTime: prometheus.NewGauge(prometheus.GaugeOpts{
 			Name:        "thanos_objstore_bucket_last_successful_upload_time",
 			Help:        "Second timestamp of the last successful upload to the bucket.",
 			ConstLabels: prometheus.Labels{"bucket": name}}),
 	}
 	if r != nil {
-		r.MustRegister(bkt.ops, bkt.opsFailures, bkt.opsDuration, bkt.lastSuccessfullUploadTime)
+		r.MustRegister(bkt.ops, bkt.opsFailures, bkt.opsDuration, bkt.opsTransferredBytes, bkt.lastSuccessfullUploadTime)
 	}
 	return bkt
 }
@@ -185,17 +241,24 @@ type metricBucket struct {
 	ops                       *prometheus.CounterVec
 	opsFailures               *prometheus.CounterVec
 	opsDuration               *prometheus.HistogramVec
+	opsTransferredBytes       *prometheus.CounterVec
 	lastSuccessfullUploadTime prometheus.Gauge
 }
 
-func (b *metricBucket) Iter(ctx context.Context, dir string, f func(name string) error) error {
+func (b *metricBucket) Iter(ctx context.Context, dir string, f func(name string) error, options ...IterOption) error {
+	return b.IterWithAttributes(ctx, dir, ignoreAttributes(f), options...)
+}
+
+func (b *metricBucket) IterWithAttributes(ctx context.Context, dir string, f func(string, ObjectAttributes) error, options ...IterOption) error {
 	const op = "iter"
+	start := time.Now()
 
-	err := b.bkt.Iter(ctx, dir, f)
+	err := b.bkt.IterWithAttributes(ctx, dir, f, options...)
 	if err != nil {
 		b.opsFailures.WithLabelValues(op).Inc()
 	}
 	b.ops.WithLabelValues(op).Inc()
+	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
 
 	return err
 }
@@ -210,7 +273,7 @@ func (b *metricBucket) Get(ctx context.Context, name string) (io.ReadCloser, err
 		return nil, err
 	}
 	rc = newTimingReadCloser(rc,
-		b.opsDuration.WithLabelValues(op), b.opsFailures.WithLabelValues(op))
+		b.opsDuration.WithLabelValues(op), b.opsFailures.WithLabelValues(op), b.opsTransferredBytes.WithLabelValues(op))
 
 	return rc, nil
 }
@@ -225,7 +288,7 @@ func (b *metricBucket) GetRange(ctx context.Context, name string, off, length in
 		return nil, err
 	}
 	rc = newTimingReadCloser(rc,
-		b.opsDuration.WithLabelValues(op), b.opsFailures.WithLabelValues(op))
+		b.opsDuration.WithLabelValues(op), b.opsFailures.WithLabelValues(op), b.opsTransferredBytes.WithLabelValues(op))
 
 	return rc, nil
 }
@@ -244,11 +307,27 @@ func (b *metricBucket) Exists(ctx context.Context, name string) (bool, error) {
 	return ok, err
 }
 
+func (b *metricBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	const op = "attributes"
+	start := time.Now()
+
+	attrs, err := b.bkt.Attributes(ctx, name)
+	if err != nil {
+		b.opsFailures.WithLabelValues(op).Inc()
+	}
+	b.ops.WithLabelValues(op).Inc()
+	b.opsDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+
+	return attrs, err
+}
+
 func (b *metricBucket) Upload(ctx context.Context, name string, r io.Reader) error {
 	const op = "upload"
 	start := time.Now()
 
+	r, cr := newCountingReader(r)
 	err := b.bkt.Upload(ctx, name, r)
+	b.opsTransferredBytes.WithLabelValues(op).Add(float64(cr.n))
 	if err != nil {
 		b.opsFailures.WithLabelValues(op).Inc()
 	} else {
@@ -282,15 +361,17 @@ type timingReadCloser struct {
 	start    time.Time
 	duration prometheus.Histogram
 	failed   prometheus.Counter
+	bytes    prometheus.Counter
 }
 
-func newTimingReadCloser(rc io.ReadCloser, dur prometheus.Histogram, failed prometheus.Counter) *timingReadCloser {
+func newTimingReadCloser(rc io.ReadCloser, dur prometheus.Histogram, failed, bytes prometheus.Counter) *timingReadCloser {
 	return &timingReadCloser{
 		ReadCloser: rc,
 		ok:         true,
 		start:      time.Now(),
 		duration:   dur,
 		failed:     failed,
+		bytes:      bytes,
 	}
 }
 
@@ -306,9 +387,35 @@ func (rc *timingReadCloser) Close() error {
 
 func (rc *timingReadCloser) Read(b []byte) (n int, err error) {
 	n, err = rc.ReadCloser.Read(b)
+	rc.bytes.Add(float64(n))
 	if rc.ok && err != nil && err != io.EOF {
 		rc.failed.Inc()
 		rc.ok = false
 	}
 	return n, err
 }
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+// newCountingReader returns a reader counting the bytes read from r in the returned countingReader. The reader
+// keeps implementing io.Seeker if r does, so that uploads of files can still be retried.
+func newCountingReader(r io.Reader) (io.Reader, *countingReader) {
+	cr := &countingReader{Reader: r}
+	if s, ok := r.(io.Seeker); ok {
+		return struct {
+			*countingReader
+			io.Seeker
+		}{cr, s}, cr
+	}
+	return cr, cr
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,79 @@
+package objstore_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBucketWithMetrics(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+	bkt := objstore.BucketWithMetrics("test", inmem.NewBucket(), reg)
+
+	testutil.Ok(t, bkt.Upload(ctx, "a", bytes.NewReader([]byte("0123456789"))))
+
+	rc, err := bkt.GetRange(ctx, "a", 2, 3)
+	testutil.Ok(t, err)
+	_, err = ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+
+	_, err = bkt.Get(ctx, "missing")
+	testutil.NotOk(t, err)
+	testutil.Ok(t, bkt.Iter(ctx, "", func(string) error { return nil }))
+
+	mfs, err := reg.Gather()
+	testutil.Ok(t, err)
+
+	values := map[string]map[string]float64{}
+	for _, mf := range mfs {
+		values[mf.GetName()] = map[string]float64{}
+		for _, m := range mf.GetMetric() {
+			var op string
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "bucket" {
+					testutil.Equals(t, "test", l.GetValue())
+				}
+				if l.GetName() == "operation" {
+					op = l.GetValue()
+				}
+			}
+			switch {
+			case m.Counter != nil:
+				values[mf.GetName()][op] = m.GetCounter().GetValue()
+			case m.Histogram != nil:
+				values[mf.GetName()][op] = float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	testutil.Equals(t, map[string]float64{"upload": 1, "get_range": 1, "get": 1, "iter": 1}, values["thanos_objstore_bucket_operations_total"])
+	testutil.Equals(t, map[string]float64{"get": 1}, values["thanos_objstore_bucket_operation_failures_total"])
+	testutil.Equals(t, map[string]float64{"upload": 1, "get_range": 1, "iter": 1}, values["thanos_objstore_bucket_operation_duration_seconds"])
+	testutil.Equals(t, map[string]float64{"upload": 10, "get_range": 3}, values["thanos_objstore_bucket_operation_transferred_bytes_total"])
+}
+
+func TestDeleteDir(t *testing.T) {
+	ctx := context.Background()
+	raw := inmem.NewBucket()
+	for _, name := range []string{"dir/a", "dir/sub/b", "other/c"} {
+		testutil.Ok(t, raw.Upload(ctx, name, bytes.NewReader([]byte(name))))
+	}
+
+	err := objstore.DeleteDir(ctx, objstore.NewReadonlyBucket(raw), "dir")
+	testutil.Equals(t, objstore.ErrReadonly, errors.Cause(err))
+	testutil.Equals(t, 3, len(raw.Objects()))
+
+	testutil.Ok(t, objstore.DeleteDir(ctx, raw, "dir"))
+	testutil.Equals(t, 1, len(raw.Objects()))
+	_, ok := raw.Objects()["other/c"]
+	testutil.Assert(t, ok, "object outside of the deleted dir should be kept")
+}
@@ -0,0 +1,140 @@
+// Package objtesting provides an acceptance test suite for implementations of objstore.Bucket. New providers and
+// third-party buckets should pass it before they are used with Thanos.
+package objtesting
+
+import (
+	"context"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/pkg/errors"
+)
+
+// AcceptanceTest checks that the given bucket behaves like Thanos expects of object storage. The bucket must be empty
+// and is left empty if all checks pass.
+func AcceptanceTest(t *testing.T, bkt objstore.Bucket) {
+	ctx := context.Background()
+
+	// Missing objects are reported as errors by reads, but not by existence checks and listings.
+	_, err := bkt.Get(ctx, "id1/obj_1.some")
+	testutil.NotOk(t, err)
+	_, err = bkt.GetRange(ctx, "id1/obj_1.some", 0, 1)
+	testutil.NotOk(t, err)
+	_, err = bkt.Attributes(ctx, "id1/obj_1.some")
+	testutil.NotOk(t, err)
+	ok, err := bkt.Exists(ctx, "id1/obj_1.some")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected missing object not to exist")
+	testutil.Equals(t, []string(nil), iter(t, bkt, ""))
+	testutil.Equals(t, []string(nil), iter(t, bkt, "id1/"))
+
+	testutil.Ok(t, bkt.Upload(ctx, "id1/obj_1.some", strings.NewReader("@test-data@")))
+
+	ok, err = bkt.Exists(ctx, "id1/obj_1.some")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected uploaded object to exist")
+	attrs, err := bkt.Attributes(ctx, "id1/obj_1.some")
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(11), attrs.Size)
+
+	testutil.Equals(t, "@test-data@", get(t, bkt, "id1/obj_1.some"))
+	testutil.Equals(t, "test", getRange(t, bkt, "id1/obj_1.some", 1, 4))
+	testutil.Equals(t, "@test-data@", getRange(t, bkt, "id1/obj_1.some", 0, 11))
+	// Ranges past the end of the object return the remainder of the object.
+	testutil.Equals(t, "ta@", getRange(t, bkt, "id1/obj_1.some", 8, 100))
+
+	// Directories are not objects.
+	_, err = bkt.Get(ctx, "id1")
+	testutil.NotOk(t, err)
+	ok, err = bkt.Exists(ctx, "id1/")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected directory not to be an object")
+
+	// Uploads replace existing objects.
+	testutil.Ok(t, bkt.Upload(ctx, "id1/obj_1.some", strings.NewReader("@test-data2@")))
+	testutil.Equals(t, "@test-data2@", get(t, bkt, "id1/obj_1.some"))
+
+	testutil.Ok(t, bkt.Upload(ctx, "id1/obj_2.some", strings.NewReader("@test-data3@")))
+	testutil.Ok(t, bkt.Upload(ctx, "id1/sub/obj_3.some", strings.NewReader("@test-data4@")))
+	testutil.Ok(t, bkt.Upload(ctx, "id2/obj_4.some", strings.NewReader("@test-data5@")))
+	testutil.Ok(t, bkt.Upload(ctx, "obj_5.some", strings.NewReader("")))
+
+	// Listings contain the direct entries of a directory with a trailing delimiter for subdirectories. Directories
+	// may be given with or without trailing delimiter.
+	testutil.Equals(t, []string{"id1/", "id2/", "obj_5.some"}, iter(t, bkt, ""))
+	testutil.Equals(t, []string{"id1/obj_1.some", "id1/obj_2.some", "id1/sub/"}, iter(t, bkt, "id1"))
+	testutil.Equals(t, []string{"id1/obj_1.some", "id1/obj_2.some", "id1/sub/"}, iter(t, bkt, "id1/"))
+	testutil.Equals(t, []string(nil), iter(t, bkt, "id3/"))
+	testutil.Equals(t, []string{"id1/obj_1.some", "id1/obj_2.some", "id1/sub/obj_3.some", "id2/obj_4.some", "obj_5.some"},
+		iter(t, bkt, "", objstore.WithRecursiveIter()))
+	testutil.Equals(t, []string{"id1/obj_1.some", "id1/obj_2.some", "id1/sub/obj_3.some"},
+		iter(t, bkt, "id1/", objstore.WithRecursiveIter()))
+
+	sizes := map[string]int64{}
+	testutil.Ok(t, bkt.IterWithAttributes(ctx, "id1/", func(name string, attrs objstore.ObjectAttributes) error {
+		sizes[name] = attrs.Size
+		return nil
+	}))
+	testutil.Equals(t, map[string]int64{"id1/obj_1.some": 12, "id1/obj_2.some": 12, "id1/sub/": 0}, sizes)
+
+	// Errors of the callback abort listings and are returned.
+	errStop := errors.New("stop")
+	calls := 0
+	err = bkt.Iter(ctx, "", func(string) error {
+		calls++
+		return errStop
+	})
+	testutil.Equals(t, errStop, errors.Cause(err))
+	testutil.Equals(t, 1, calls)
+
+	testutil.Ok(t, bkt.Delete(ctx, "obj_5.some"))
+	ok, err = bkt.Exists(ctx, "obj_5.some")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected deleted object not to exist")
+	_, err = bkt.Get(ctx, "obj_5.some")
+	testutil.NotOk(t, err)
+
+	// Deleting a directory removes all objects below it, including those of subdirectories, and nothing else.
+	testutil.Ok(t, objstore.DeleteDir(ctx, bkt, "id1"))
+	testutil.Equals(t, []string(nil), iter(t, bkt, "id1/"))
+	testutil.Equals(t, []string{"id2/"}, iter(t, bkt, ""))
+	testutil.Equals(t, "@test-data5@", get(t, bkt, "id2/obj_4.some"))
+
+	testutil.Ok(t, objstore.DeleteDir(ctx, bkt, "id2/"))
+	testutil.Equals(t, []string(nil), iter(t, bkt, "", objstore.WithRecursiveIter()))
+}
+
+// iter returns the sorted names passed by a listing of the directory.
+func iter(t *testing.T, bkt objstore.BucketReader, dir string, options ...objstore.IterOption) []string {
+	var names []string
+	testutil.Ok(t, bkt.Iter(context.Background(), dir, func(name string) error {
+		names = append(names, name)
+		return nil
+	}, options...))
+	sort.Strings(names)
+	return names
+}
+
+func get(t *testing.T, bkt objstore.BucketReader, name string) string {
+	rc, err := bkt.Get(context.Background(), name)
+	testutil.Ok(t, err)
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	return string(b)
+}
+
+func getRange(t *testing.T, bkt objstore.BucketReader, name string, off, length int64) string {
+	rc, err := bkt.GetRange(context.Background(), name, off, length)
+	testutil.Ok(t, err)
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	return string(b)
+}
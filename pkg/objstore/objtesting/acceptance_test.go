@@ -0,0 +1,13 @@
+package objtesting
+
+import (
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+)
+
+func TestAcceptanceTest(t *testing.T) {
+	AcceptanceTest(t, inmem.NewBucket())
+	AcceptanceTest(t, objstore.NewPrefixedBucket(inmem.NewBucket(), "prefix"))
+}
@@ -0,0 +1,338 @@
+// Package oss implements common object storage abstractions against Alibaba Cloud Object Storage Service.
+package oss
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/units"
+	alioss "github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	opObjectsList  = "ListObjects"
+	opObjectInsert = "PutObject"
+	opObjectGet    = "GetObject"
+	opObjectStat   = "HeadObject"
+	opObjectDelete = "DeleteObject"
+)
+
+// DirDelim is the delimiter used to model a directory structure in an object store bucket.
+const DirDelim = "/"
+
+// Config encapsulates the necessary config values to instantiate an OSS client.
+type Config struct {
+	// Endpoint is the regional endpoint, e.g. oss-cn-hangzhou.aliyuncs.com, which is accessed with HTTPS. A URL with
+	// scheme is used as is instead.
+	Endpoint        string `yaml:"endpoint"`
+	Bucket          string `yaml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	AccessKeySecret string `yaml:"access_key_secret"`
+	// SecurityToken is the token of temporary STS credentials. It is empty for AccessKeys of RAM users.
+	SecurityToken string `yaml:"security_token"`
+	// PartSize is the size of the parts objects larger than it are uploaded in.
+	PartSize units.Base2Bytes `yaml:"part_size"`
+}
+
+// DefaultConfig holds the defaults of the OSS flags for configurations given in YAML.
+var DefaultConfig = Config{
+	PartSize: 64 * units.MiB,
+}
+
+// RegisterOSSParams registers the OSS flags into the given Config struct.
+func RegisterOSSParams(cmd *kingpin.CmdClause, conf *Config) {
+	cmd.Flag("oss.endpoint", "Alibaba Cloud OSS endpoint, e.g. oss-cn-hangzhou.aliyuncs.com.").
+		PlaceHolder("<endpoint>").Envar("OSS_ENDPOINT").StringVar(&conf.Endpoint)
+
+	cmd.Flag("oss.bucket", "Alibaba Cloud OSS bucket name for stored blocks.").
+		PlaceHolder("<bucket>").Envar("OSS_BUCKET").StringVar(&conf.Bucket)
+
+	cmd.Flag("oss.access-key-id", "Alibaba Cloud AccessKey ID.").
+		PlaceHolder("<id>").Envar("OSS_ACCESS_KEY_ID").StringVar(&conf.AccessKeyID)
+
+	cmd.Flag("oss.part-size", "Objects larger than this are uploaded with multipart uploads of parts of this size.").
+		Default("64MB").BytesVar(&conf.PartSize)
+
+	conf.AccessKeySecret = os.Getenv("OSS_ACCESS_KEY_SECRET")
+	conf.SecurityToken = os.Getenv("OSS_SECURITY_TOKEN")
+}
+
+// Validate checks to see if any of the OSS config options are set.
+func (conf *Config) Validate() error {
+	if conf.Endpoint == "" ||
+		conf.Bucket == "" ||
+		conf.AccessKeyID == "" ||
+		conf.AccessKeySecret == "" {
+		return errors.New("insufficient oss configuration information")
+	}
+	return nil
+}
+
+// Bucket implements the store.Bucket interface against Alibaba Cloud OSS.
+type Bucket struct {
+	bucket   *alioss.Bucket
+	partSize int64
+	opsTotal *prometheus.CounterVec
+}
+
+// NewBucket returns a new Bucket using the provided OSS config values.
+func NewBucket(conf *Config, reg prometheus.Registerer, component string) (*Bucket, error) {
+	if conf.PartSize < 100*units.KiB {
+		return nil, errors.New("oss part size must be at least 100KiB")
+	}
+	endpoint := conf.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	opts := []alioss.ClientOption{
+		alioss.UserAgent(fmt.Sprintf("thanos-%s/%s (%s)", component, version.Version, runtime.Version())),
+		alioss.HTTPClient(&http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+					DualStack: true,
+				}).DialContext,
+				MaxIdleConns:          100,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+				// Cover cases where the tcp connection works but the server never answers.
+				ResponseHeaderTimeout: 15 * time.Second,
+				DisableCompression:    true,
+			},
+		}),
+	}
+	if conf.SecurityToken != "" {
+		opts = append(opts, alioss.SecurityToken(conf.SecurityToken))
+	}
+	client, err := alioss.New(endpoint, conf.AccessKeyID, conf.AccessKeySecret, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "create oss client")
+	}
+	bucket, err := client.Bucket(conf.Bucket)
+	if err != nil {
+		return nil, errors.Wrap(err, "create oss bucket client")
+	}
+
+	bkt := &Bucket{
+		bucket:   bucket,
+		partSize: int64(conf.PartSize),
+		opsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "thanos_objstore_oss_bucket_operations_total",
+			Help:        "Total number of operations that were executed against an Alibaba Cloud OSS bucket.",
+			ConstLabels: prometheus.Labels{"bucket": conf.Bucket},
+		}, []string{"operation"}),
+	}
+	if reg != nil {
+		reg.MustRegister(bkt.opsTotal)
+	}
+	return bkt, nil
+}
+
+func statusCode(err error) int {
+	if e, ok := errors.Cause(err).(alioss.ServiceError); ok {
+		return e.StatusCode
+	}
+	return 0
+}
+
+func isNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+// IsRetryableErr returns true if an operation that failed with err is likely to succeed when it is retried.
+func IsRetryableErr(err error) bool {
+	if s := statusCode(err); s != 0 {
+		return s == http.StatusTooManyRequests || s >= http.StatusInternalServerError
+	}
+	return objstore.IsTransientErr(err)
+}
+
+// Iter calls f for each entry in the given directory. The argument to f is the full
+// object name including the prefix of the inspected directory.
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	}, options...)
+}
+
+// IterWithAttributes is like Iter but additionally passes the size and modification time of objects to f.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error, options ...objstore.IterOption) error {
+	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
+	// object itself as one prefix item.
+	if dir != "" {
+		dir = strings.TrimSuffix(dir, DirDelim) + DirDelim
+	}
+
+	opts := []alioss.Option{alioss.WithContext(ctx), alioss.Prefix(dir), alioss.MaxKeys(1000)}
+	if !objstore.ApplyIterOptions(options...).Recursive {
+		opts = append(opts, alioss.Delimiter(DirDelim))
+	}
+	marker := ""
+	for {
+		b.opsTotal.WithLabelValues(opObjectsList).Inc()
+		res, err := b.bucket.ListObjects(append(opts, alioss.Marker(marker))...)
+		if err != nil {
+			return errors.Wrap(err, "list oss objects")
+		}
+
+		// Entries of a page are sorted by name, but objects and prefixes are listed separately.
+		var (
+			names = append([]string(nil), res.CommonPrefixes...)
+			attrs = map[string]objstore.ObjectAttributes{}
+		)
+		for _, o := range res.Objects {
+			names = append(names, o.Key)
+			attrs[o.Key] = objstore.ObjectAttributes{Size: o.Size, LastModified: o.LastModified}
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			if err := f(n, attrs[n]); err != nil {
+				return err
+			}
+		}
+
+		if !res.IsTruncated {
+			return nil
+		}
+		marker = res.NextMarker
+	}
+}
+
+// Get returns a reader for the given object name.
+func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	b.opsTotal.WithLabelValues(opObjectGet).Inc()
+	rc, err := b.bucket.GetObject(name, alioss.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "get oss object %s", name)
+	}
+	return rc, nil
+}
+
+// GetRange returns a new range reader for the given object name and range.
+func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	b.opsTotal.WithLabelValues(opObjectGet).Inc()
+	rc, err := b.bucket.GetObject(name, alioss.WithContext(ctx), alioss.Range(off, off+length-1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "get range of oss object %s", name)
+	}
+	return rc, nil
+}
+
+// Exists checks if the given object exists.
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	if _, err := b.Attributes(ctx, name); err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Attributes returns the size and modification time of the object.
+func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	b.opsTotal.WithLabelValues(opObjectStat).Inc()
+	h, err := b.bucket.GetObjectDetailedMeta(name, alioss.WithContext(ctx))
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrapf(err, "stat oss object %s", name)
+	}
+
+	size, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrapf(err, "parse size of %s", name)
+	}
+	lastModified, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrapf(err, "parse modification time of %s", name)
+	}
+	return objstore.ObjectAttributes{Size: size, LastModified: lastModified}, nil
+}
+
+// Upload the contents of the reader as an object into the bucket. Objects larger than the part size, e.g. chunk
+// segments, are uploaded with a multipart upload.
+func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	buf := make([]byte, b.partSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		b.opsTotal.WithLabelValues(opObjectInsert).Inc()
+		if err := b.bucket.PutObject(name, bytes.NewReader(buf[:n]), alioss.WithContext(ctx)); err != nil {
+			return errors.Wrapf(err, "upload oss object %s", name)
+		}
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "read %s", name)
+	}
+
+	b.opsTotal.WithLabelValues(opObjectInsert).Inc()
+	imur, err := b.bucket.InitiateMultipartUpload(name, alioss.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "init multipart upload of oss object %s", name)
+	}
+	if err := b.uploadParts(ctx, imur, buf, r); err != nil {
+		// Abort without the context of the upload, so no parts are left behind if it was canceled.
+		b.opsTotal.WithLabelValues(opObjectDelete).Inc()
+		_ = b.bucket.AbortMultipartUpload(imur)
+		return errors.Wrapf(err, "multipart upload of oss object %s", name)
+	}
+	return nil
+}
+
+// uploadParts uploads the content of the full buffer and the remaining reader as parts of the multipart upload and
+// completes it.
+func (b *Bucket) uploadParts(ctx context.Context, imur alioss.InitiateMultipartUploadResult, buf []byte, r io.Reader) error {
+	var (
+		parts []alioss.UploadPart
+		n     = len(buf)
+	)
+	for i := 1; ; i++ {
+		b.opsTotal.WithLabelValues(opObjectInsert).Inc()
+		part, err := b.bucket.UploadPart(imur, bytes.NewReader(buf[:n]), int64(n), i, alioss.WithContext(ctx))
+		if err != nil {
+			return errors.Wrapf(err, "upload part %d", i)
+		}
+		parts = append(parts, part)
+
+		n, err = io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return errors.Wrap(err, "read part")
+		}
+	}
+
+	b.opsTotal.WithLabelValues(opObjectInsert).Inc()
+	if _, err := b.bucket.CompleteMultipartUpload(imur, parts, alioss.WithContext(ctx)); err != nil {
+		return errors.Wrap(err, "complete multipart upload")
+	}
+	return nil
+}
+
+// Delete removes the object with the given name.
+func (b *Bucket) Delete(ctx context.Context, name string) error {
+	b.opsTotal.WithLabelValues(opObjectDelete).Inc()
+	if err := b.bucket.DeleteObject(name, alioss.WithContext(ctx)); err != nil {
+		return errors.Wrapf(err, "delete oss object %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"hash/crc64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/units"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+// fakeOSS implements the subset of the OSS API used by Bucket for a single bucket. Requests are expected path-style,
+// as the client uses for IP endpoints.
+type fakeOSS struct {
+	token string
+
+	mtx     sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	parts   int
+}
+
+func (s *fakeOSS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// Signatures are computed by the SDK, only check that the credentials are used.
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "OSS id:") ||
+		r.Header.Get("x-oss-security-token") != s.token {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, "/bucket") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/bucket"), "/")
+
+	q := r.URL.Query()
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		s.list(w, q.Get("prefix"), q.Get("marker"))
+	case r.Method == http.MethodPost && q.Get("uploadId") == "":
+		id := fmt.Sprintf("upload-%d", len(s.uploads))
+		s.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", name, id)
+	case r.Method == http.MethodPost:
+		b, _ := ioutil.ReadAll(r.Body)
+		var req struct {
+			Parts []struct {
+				PartNumber int    `xml:"PartNumber"`
+				ETag       string `xml:"ETag"`
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(b, &req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var obj []byte
+		for _, p := range req.Parts {
+			if p.ETag != fmt.Sprintf(`"%d"`, p.PartNumber) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			obj = append(obj, s.uploads[q.Get("uploadId")][p.PartNumber]...)
+		}
+		delete(s.uploads, q.Get("uploadId"))
+		s.objects[name] = obj
+	case r.Method == http.MethodPut && q.Get("uploadId") != "":
+		b, _ := ioutil.ReadAll(r.Body)
+		var n int
+		fmt.Sscanf(q.Get("partNumber"), "%d", &n)
+		s.uploads[q.Get("uploadId")][n] = b
+		s.parts++
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, n))
+		setCRC(w, b)
+	case r.Method == http.MethodPut:
+		b, _ := ioutil.ReadAll(r.Body)
+		s.objects[name] = b
+		setCRC(w, b)
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		b, ok := s.objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				fmt.Fprint(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+			}
+			return
+		}
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", fmt.Sprint(len(b)))
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			return
+		}
+		if rng := r.Header.Get("Range"); rng != "" {
+			var start, end int
+			fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+			if end >= len(b) {
+				end = len(b) - 1
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(b[start : end+1])
+			return
+		}
+		setCRC(w, b)
+		w.Write(b)
+	case r.Method == http.MethodDelete:
+		delete(s.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// setCRC sets the CRC64 header the client verifies uploads and downloads with.
+func setCRC(w http.ResponseWriter, b []byte) {
+	w.Header().Set("x-oss-hash-crc64ecma", fmt.Sprint(crc64.Checksum(b, crc64.MakeTable(crc64.ECMA))))
+}
+
+// list returns pages of at most 2 entries to test pagination.
+func (s *fakeOSS) list(w http.ResponseWriter, prefix, marker string) {
+	var names []string
+	for n := range s.objects {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var (
+		entries []string
+		seen    = map[string]bool{}
+	)
+	for _, n := range names {
+		if !strings.HasPrefix(n, prefix) {
+			continue
+		}
+		if i := strings.Index(n[len(prefix):], DirDelim); i >= 0 {
+			n = n[:len(prefix)+i+1]
+		}
+		if !seen[n] && n > marker {
+			seen[n] = true
+			entries = append(entries, n)
+		}
+	}
+	truncated := len(entries) > 2
+	if truncated {
+		entries = entries[:2]
+	}
+
+	fmt.Fprint(w, "<ListBucketResult>")
+	for _, e := range entries {
+		if strings.HasSuffix(e, DirDelim) {
+			fmt.Fprintf(w, "<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>", e)
+		} else {
+			fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", e)
+		}
+	}
+	if truncated {
+		fmt.Fprintf(w, "<IsTruncated>true</IsTruncated><NextMarker>%s</NextMarker>", entries[1])
+	} else {
+		fmt.Fprint(w, "<IsTruncated>false</IsTruncated>")
+	}
+	fmt.Fprint(w, "</ListBucketResult>")
+}
+
+func TestBucket(t *testing.T) {
+	ctx := context.Background()
+	srv := &fakeOSS{
+		token:   "sts-token",
+		objects: map[string][]byte{},
+		uploads: map[string]map[int][]byte{},
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	bkt, err := NewBucket(&Config{
+		Endpoint:        ts.URL,
+		Bucket:          "bucket",
+		AccessKeyID:     "id",
+		AccessKeySecret: "secret",
+		SecurityToken:   "sts-token",
+		PartSize:        100 * units.KiB,
+	}, nil, "test")
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, bkt.Upload(ctx, "dir/a", bytes.NewReader([]byte("object a"))))
+	testutil.Ok(t, bkt.Upload(ctx, "dir/sub/b", bytes.NewReader(nil)))
+	testutil.Ok(t, bkt.Upload(ctx, "dir/c", bytes.NewReader(nil)))
+	testutil.Equals(t, 0, srv.parts)
+
+	// Objects larger than the part size are uploaded in parts.
+	large := bytes.Repeat([]byte("0123456789"), 25*1024)
+	testutil.Ok(t, bkt.Upload(ctx, "dir/large", bytes.NewReader(large)))
+	testutil.Equals(t, 3, srv.parts)
+
+	rc, err := bkt.Get(ctx, "dir/large")
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(rc)
+	rc.Close()
+	testutil.Ok(t, err)
+	testutil.Assert(t, bytes.Equal(large, b), "unexpected content of large object")
+
+	rc, err = bkt.GetRange(ctx, "dir/a", 2, 3)
+	testutil.Ok(t, err)
+	b, err = ioutil.ReadAll(rc)
+	rc.Close()
+	testutil.Ok(t, err)
+	testutil.Equals(t, "jec", string(b))
+
+	var names []string
+	testutil.Ok(t, bkt.Iter(ctx, "dir", func(n string) error {
+		names = append(names, n)
+		return nil
+	}))
+	testutil.Equals(t, []string{"dir/a", "dir/c", "dir/large", "dir/sub/"}, names)
+
+	ok, err := bkt.Exists(ctx, "dir/a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected object to exist")
+
+	attrs, err := bkt.Attributes(ctx, "dir/a")
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(8), attrs.Size)
+	testutil.Assert(t, attrs.LastModified.Equal(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)), "unexpected modification time %v", attrs.LastModified)
+
+	testutil.Ok(t, bkt.Delete(ctx, "dir/a"))
+	ok, err = bkt.Exists(ctx, "dir/a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected object to be deleted")
+
+	_, err = bkt.Get(ctx, "dir/a")
+	testutil.Assert(t, isNotFound(err), "expected not found error, got %v", err)
+	testutil.Assert(t, strings.Contains(err.Error(), "NoSuchKey"), "expected error code, got %v", err)
+}
@@ -0,0 +1,62 @@
+package objstore
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// NewPrefixedBucket returns a bucket that stores all objects under the given prefix of bkt. Object names passed to and
+// returned by the bucket are relative to the prefix, so several environments can share one bucket without seeing each
+// other's blocks. bkt is returned unchanged if the prefix is empty.
+func NewPrefixedBucket(bkt Bucket, prefix string) Bucket {
+	prefix = strings.Trim(prefix, DirDelim)
+	if prefix == "" {
+		return bkt
+	}
+	return &prefixedBucket{bkt: bkt, prefix: prefix + DirDelim}
+}
+
+type prefixedBucket struct {
+	bkt Bucket
+	// prefix ends with DirDelim.
+	prefix string
+}
+
+func (b *prefixedBucket) name(name string) string {
+	return b.prefix + name
+}
+
+func (b *prefixedBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
+	return b.IterWithAttributes(ctx, dir, ignoreAttributes(f), options...)
+}
+
+func (b *prefixedBucket) IterWithAttributes(ctx context.Context, dir string, f func(string, ObjectAttributes) error, options ...IterOption) error {
+	return b.bkt.IterWithAttributes(ctx, b.name(dir), func(name string, attrs ObjectAttributes) error {
+		return f(strings.TrimPrefix(name, b.prefix), attrs)
+	}, options...)
+}
+
+func (b *prefixedBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.bkt.Get(ctx, b.name(name))
+}
+
+func (b *prefixedBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.bkt.GetRange(ctx, b.name(name), off, length)
+}
+
+func (b *prefixedBucket) Exists(ctx context.Context, name string) (bool, error) {
+	return b.bkt.Exists(ctx, b.name(name))
+}
+
+func (b *prefixedBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	return b.bkt.Attributes(ctx, b.name(name))
+}
+
+func (b *prefixedBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	return b.bkt.Upload(ctx, b.name(name), r)
+}
+
+func (b *prefixedBucket) Delete(ctx context.Context, name string) error {
+	return b.bkt.Delete(ctx, b.name(name))
+}
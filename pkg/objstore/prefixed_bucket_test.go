@@ -0,0 +1,63 @@
+package objstore_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+func TestPrefixedBucket(t *testing.T) {
+	ctx := context.Background()
+	raw := inmem.NewBucket()
+	testutil.Ok(t, raw.Upload(ctx, "other/obj", bytes.NewReader([]byte("other"))))
+
+	testutil.Equals(t, objstore.Bucket(raw), objstore.NewPrefixedBucket(raw, "/"))
+
+	bkt := objstore.NewPrefixedBucket(raw, "/prod/")
+	testutil.Ok(t, bkt.Upload(ctx, "dir/a", bytes.NewReader([]byte("object a"))))
+	testutil.Ok(t, bkt.Upload(ctx, "b", bytes.NewReader([]byte("object b"))))
+
+	var names []string
+	for n := range raw.Objects() {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	testutil.Equals(t, []string{"other/obj", "prod/b", "prod/dir/a"}, names)
+
+	names = nil
+	testutil.Ok(t, bkt.Iter(ctx, "", func(n string) error {
+		names = append(names, n)
+		return nil
+	}))
+	testutil.Equals(t, []string{"b", "dir/"}, names)
+
+	names = nil
+	testutil.Ok(t, bkt.Iter(ctx, "dir", func(n string) error {
+		names = append(names, n)
+		return nil
+	}))
+	testutil.Equals(t, []string{"dir/a"}, names)
+
+	rc, err := bkt.GetRange(ctx, "dir/a", 2, 3)
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "jec", string(b))
+
+	ok, err := bkt.Exists(ctx, "b")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected object to exist")
+	ok, err = bkt.Exists(ctx, "other/obj")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected object outside of prefix to be hidden")
+
+	testutil.Ok(t, bkt.Delete(ctx, "b"))
+	_, err = raw.Get(ctx, "prod/b")
+	testutil.NotOk(t, err)
+}
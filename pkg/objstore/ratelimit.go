@@ -0,0 +1,126 @@
+package objstore
+
+import (
+	"context"
+	"io"
+
+	"github.com/alecthomas/units"
+	"github.com/improbable-eng/thanos/pkg/ratelimit"
+)
+
+// RateLimitConfig limits the rate of operations against a bucket, e.g. to stay below the throttling limits of the
+// provider. Zero values disable the respective limit.
+type RateLimitConfig struct {
+	// ReadOps is the number of Iter, Get, GetRange, Exists and Attributes operations per second.
+	ReadOps float64
+	// WriteOps is the number of Upload and Delete operations per second.
+	WriteOps float64
+	// ReadBytes is the number of bytes read from objects per second.
+	ReadBytes units.Base2Bytes
+	// WriteBytes is the number of bytes uploaded per second.
+	WriteBytes units.Base2Bytes
+}
+
+// BucketWithRateLimits returns a bucket that delays operations against b to keep within the configured limits.
+// Every limit allows bursts of one second worth of operations or bytes.
+func BucketWithRateLimits(b Bucket, conf RateLimitConfig) Bucket {
+	if conf == (RateLimitConfig{}) {
+		return b
+	}
+	return &rateLimitedBucket{
+		bkt:        b,
+		readOps:    ratelimit.NewLimiter(conf.ReadOps, int(conf.ReadOps)),
+		writeOps:   ratelimit.NewLimiter(conf.WriteOps, int(conf.WriteOps)),
+		readBytes:  ratelimit.NewLimiter(float64(conf.ReadBytes), int(conf.ReadBytes)),
+		writeBytes: ratelimit.NewLimiter(float64(conf.WriteBytes), int(conf.WriteBytes)),
+	}
+}
+
+type rateLimitedBucket struct {
+	bkt Bucket
+
+	readOps, writeOps     *ratelimit.Limiter
+	readBytes, writeBytes *ratelimit.Limiter
+}
+
+func (b *rateLimitedBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
+	return b.IterWithAttributes(ctx, dir, ignoreAttributes(f), options...)
+}
+
+func (b *rateLimitedBucket) IterWithAttributes(ctx context.Context, dir string, f func(string, ObjectAttributes) error, options ...IterOption) error {
+	if err := b.readOps.WaitN(ctx, 1); err != nil {
+		return err
+	}
+	return b.bkt.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (b *rateLimitedBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.readOps.WaitN(ctx, 1); err != nil {
+		return nil, err
+	}
+	rc, err := b.bkt.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitedReadCloser{rateLimitedReader{Reader: rc, ctx: ctx, limiter: b.readBytes}, rc}, nil
+}
+
+func (b *rateLimitedBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	if err := b.readOps.WaitN(ctx, 1); err != nil {
+		return nil, err
+	}
+	rc, err := b.bkt.GetRange(ctx, name, off, length)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitedReadCloser{rateLimitedReader{Reader: rc, ctx: ctx, limiter: b.readBytes}, rc}, nil
+}
+
+func (b *rateLimitedBucket) Exists(ctx context.Context, name string) (bool, error) {
+	if err := b.readOps.WaitN(ctx, 1); err != nil {
+		return false, err
+	}
+	return b.bkt.Exists(ctx, name)
+}
+
+func (b *rateLimitedBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	if err := b.readOps.WaitN(ctx, 1); err != nil {
+		return ObjectAttributes{}, err
+	}
+	return b.bkt.Attributes(ctx, name)
+}
+
+func (b *rateLimitedBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if err := b.writeOps.WaitN(ctx, 1); err != nil {
+		return err
+	}
+	return b.bkt.Upload(ctx, name, &rateLimitedReader{Reader: r, ctx: ctx, limiter: b.writeBytes})
+}
+
+func (b *rateLimitedBucket) Delete(ctx context.Context, name string) error {
+	if err := b.writeOps.WaitN(ctx, 1); err != nil {
+		return err
+	}
+	return b.bkt.Delete(ctx, name)
+}
+
+// rateLimitedReader takes a token of the limiter for every byte read and blocks until they are available.
+type rateLimitedReader struct {
+	io.Reader
+
+	ctx     context.Context
+	limiter *ratelimit.Limiter
+}
+
+func (r *rateLimitedReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	if werr := r.limiter.WaitN(r.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
+
+type rateLimitedReadCloser struct {
+	rateLimitedReader
+	io.Closer
+}
@@ -0,0 +1,53 @@
+package objstore_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+func TestBucketWithRateLimits(t *testing.T) {
+	ctx := context.Background()
+	raw := inmem.NewBucket()
+	testutil.Equals(t, objstore.Bucket(raw), objstore.BucketWithRateLimits(raw, objstore.RateLimitConfig{}))
+
+	bkt := objstore.BucketWithRateLimits(raw, objstore.RateLimitConfig{ReadOps: 1, WriteBytes: 10, ReadBytes: 10})
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	// Operations within the burst are not delayed.
+	ok, err := bkt.Exists(canceled, "a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected object not to exist")
+	_, err = bkt.Exists(canceled, "a")
+	testutil.Equals(t, context.Canceled, err)
+
+	testutil.Ok(t, bkt.Upload(ctx, "a", bytes.NewReader([]byte("0123456789"))))
+	testutil.Equals(t, context.Canceled, bkt.Upload(canceled, "b", bytes.NewReader([]byte("0123456789"))))
+
+	// Operations without a configured limit are not delayed.
+	testutil.Ok(t, bkt.Delete(canceled, "b"))
+
+	// Reads wait for the bytes they transferred.
+	start := time.Now()
+	rc, err := objstore.BucketWithRateLimits(raw, objstore.RateLimitConfig{ReadBytes: 100}).Get(ctx, "a")
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Ok(t, rc.Close())
+	testutil.Equals(t, "0123456789", string(b))
+	testutil.Assert(t, time.Since(start) < time.Second, "read within burst delayed")
+
+	deadline, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	rc, err = objstore.BucketWithRateLimits(raw, objstore.RateLimitConfig{ReadBytes: 5}).GetRange(deadline, "a", 0, 10)
+	testutil.Ok(t, err)
+	_, err = ioutil.ReadAll(rc)
+	testutil.Equals(t, context.DeadlineExceeded, err)
+}
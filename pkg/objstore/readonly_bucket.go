@@ -0,0 +1,29 @@
+package objstore
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ErrReadonly is the cause of errors of uploads and deletions against read-only buckets.
+var ErrReadonly = errors.New("bucket is read-only")
+
+// NewReadonlyBucket returns a bucket that passes reads to bkt and rejects uploads and deletions with ErrReadonly, so
+// components can be run against a bucket with the guarantee that it is not modified.
+func NewReadonlyBucket(bkt Bucket) Bucket {
+	return &readonlyBucket{BucketReader: bkt}
+}
+
+type readonlyBucket struct {
+	BucketReader
+}
+
+func (b *readonlyBucket) Upload(_ context.Context, name string, _ io.Reader) error {
+	return errors.Wrapf(ErrReadonly, "upload %s", name)
+}
+
+func (b *readonlyBucket) Delete(_ context.Context, name string) error {
+	return errors.Wrapf(ErrReadonly, "delete %s", name)
+}
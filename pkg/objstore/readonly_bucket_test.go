@@ -0,0 +1,44 @@
+package objstore_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/pkg/errors"
+)
+
+func TestReadonlyBucket(t *testing.T) {
+	ctx := context.Background()
+	raw := inmem.NewBucket()
+	testutil.Ok(t, raw.Upload(ctx, "dir/a", bytes.NewReader([]byte("object a"))))
+
+	bkt := objstore.NewReadonlyBucket(raw)
+
+	rc, err := bkt.Get(ctx, "dir/a")
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "object a", string(b))
+
+	var names []string
+	testutil.Ok(t, bkt.Iter(ctx, "dir", func(n string) error {
+		names = append(names, n)
+		return nil
+	}))
+	testutil.Equals(t, []string{"dir/a"}, names)
+
+	err = bkt.Upload(ctx, "dir/b", bytes.NewReader([]byte("object b")))
+	testutil.Equals(t, objstore.ErrReadonly, errors.Cause(err))
+	err = bkt.Delete(ctx, "dir/a")
+	testutil.Equals(t, objstore.ErrReadonly, errors.Cause(err))
+
+	testutil.Equals(t, 1, len(raw.Objects()))
+	ok, err := bkt.Exists(ctx, "dir/a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected object to exist")
+}
@@ -0,0 +1,214 @@
+package objstore
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMinRetryBackoff = 100 * time.Millisecond
+	defaultMaxRetryBackoff = 10 * time.Second
+)
+
+// RetryConfig configures how operations against a bucket are retried after transient errors.
+type RetryConfig struct {
+	// MaxRetries is the number of times a failed operation is retried. Zero disables retries.
+	MaxRetries int
+	// MaxElapsed stops retrying once the given time passed since the start of the operation. Zero means no limit.
+	MaxElapsed time.Duration
+	// MinBackoff is the time waited before the first retry. It doubles with every retry up to MaxBackoff.
+	// It defaults to 100ms.
+	MinBackoff time.Duration
+	// MaxBackoff caps the time waited between retries. It defaults to 10s.
+	MaxBackoff time.Duration
+}
+
+// IsTransientErr returns true if err is a network error that is likely to go away when the operation is retried.
+// Providers use it to classify errors that are not responses of the object storage service.
+func IsTransientErr(err error) bool {
+	err = errors.Cause(err)
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	switch e := err.(type) {
+	case *net.OpError:
+		// Refused and reset connections are not temporary by the definition of net.Error but are usually gone quickly.
+		return true
+	case net.Error:
+		return e.Timeout() || e.Temporary()
+	}
+	return err == io.ErrUnexpectedEOF
+}
+
+// BucketWithRetries returns a bucket that retries idempotent operations against b with exponential backoff if
+// retryable classifies their error as transient. Iter is only retried if it failed before visiting any entry and
+// Upload only if the reader can be rewound with io.Seeker.
+func BucketWithRetries(b Bucket, retryable func(error) bool, conf RetryConfig) Bucket {
+	if conf.MaxRetries <= 0 {
+		return b
+	}
+	if conf.MinBackoff <= 0 {
+		conf.MinBackoff = defaultMinRetryBackoff
+	}
+	if conf.MaxBackoff <= 0 {
+		conf.MaxBackoff = defaultMaxRetryBackoff
+	}
+	return &retryBucket{bkt: b, retryable: retryable, conf: conf}
+}
+
+type retryBucket struct {
+	bkt       Bucket
+	retryable func(error) bool
+	conf      RetryConfig
+}
+
+// retriedError wraps transient errors returned once the retries of an operation are exhausted.
+type retriedError struct {
+	err error
+}
+
+func (e retriedError) Error() string { return e.err.Error() }
+
+// Cause returns the error of the last attempt, so errors.Cause sees through the wrapper.
+func (e retriedError) Cause() error { return e.err }
+
+// IsRetriedErr returns true if err was returned by a bucket of BucketWithRetries after exhausting its retries. Callers
+// retrying on their own should not retry such errors again.
+func IsRetriedErr(err error) bool {
+	for err != nil {
+		if _, ok := err.(retriedError); ok {
+			return true
+		}
+		c, ok := err.(interface{ Cause() error })
+		if !ok {
+			return false
+		}
+		err = c.Cause()
+	}
+	return false
+}
+
+// permanentError wraps errors of operations that must not be retried regardless of their cause.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+
+// retry calls f until it succeeds, fails permanently, the retries or the time for them are exhausted or the
+// context is canceled. It returns the last error of f.
+func (b *retryBucket) retry(ctx context.Context, f func() error) error {
+	var (
+		start = time.Now()
+		wait  = b.conf.MinBackoff
+	)
+	for i := 0; ; i++ {
+		err := f()
+		if p, ok := err.(permanentError); ok {
+			return p.err
+		}
+		if err == nil || ctx.Err() != nil || !b.retryable(err) {
+			return err
+		}
+		if i >= b.conf.MaxRetries {
+			return retriedError{err: err}
+		}
+		// Wait up to +-20% of the backoff so that retries of concurrent operations do not hit the bucket at once.
+		d := wait + time.Duration((0.4*rand.Float64()-0.2)*float64(wait))
+		if b.conf.MaxElapsed > 0 && time.Since(start)+d > b.conf.MaxElapsed {
+			return retriedError{err: err}
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(d):
+		}
+		if wait *= 2; wait > b.conf.MaxBackoff {
+			wait = b.conf.MaxBackoff
+		}
+	}
+}
+
+func (b *retryBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...IterOption) error {
+	return b.IterWithAttributes(ctx, dir, ignoreAttributes(f), options...)
+}
+
+func (b *retryBucket) IterWithAttributes(ctx context.Context, dir string, f func(string, ObjectAttributes) error, options ...IterOption) error {
+	var visited bool
+	return b.retry(ctx, func() error {
+		err := b.bkt.IterWithAttributes(ctx, dir, func(name string, attrs ObjectAttributes) error {
+			visited = true
+			return f(name, attrs)
+		}, options...)
+		if err != nil && visited {
+			// Entries were passed to f already, retrying would pass them again.
+			return permanentError{err: err}
+		}
+		return err
+	})
+}
+
+func (b *retryBucket) Get(ctx context.Context, name string) (rc io.ReadCloser, err error) {
+	err = b.retry(ctx, func() error {
+		rc, err = b.bkt.Get(ctx, name)
+		return err
+	})
+	return rc, err
+}
+
+func (b *retryBucket) GetRange(ctx context.Context, name string, off, length int64) (rc io.ReadCloser, err error) {
+	err = b.retry(ctx, func() error {
+		rc, err = b.bkt.GetRange(ctx, name, off, length)
+		return err
+	})
+	return rc, err
+}
+
+func (b *retryBucket) Exists(ctx context.Context, name string) (ok bool, err error) {
+	err = b.retry(ctx, func() error {
+		ok, err = b.bkt.Exists(ctx, name)
+		return err
+	})
+	return ok, err
+}
+
+func (b *retryBucket) Attributes(ctx context.Context, name string) (attrs ObjectAttributes, err error) {
+	err = b.retry(ctx, func() error {
+		attrs, err = b.bkt.Attributes(ctx, name)
+		return err
+	})
+	return attrs, err
+}
+
+func (b *retryBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return b.bkt.Upload(ctx, name, r)
+	}
+	start, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return b.bkt.Upload(ctx, name, r)
+	}
+	first := true
+	return b.retry(ctx, func() error {
+		if !first {
+			if _, err := s.Seek(start, io.SeekStart); err != nil {
+				return permanentError{err: errors.Wrap(err, "rewind reader for retry")}
+			}
+		}
+		first = false
+		return b.bkt.Upload(ctx, name, r)
+	})
+}
+
+func (b *retryBucket) Delete(ctx context.Context, name string) error {
+	return b.retry(ctx, func() error {
+		return b.bkt.Delete(ctx, name)
+	})
+}
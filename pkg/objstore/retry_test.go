@@ -0,0 +1,135 @@
+package objstore_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/pkg/errors"
+)
+
+var errTransient = errors.New("transient")
+
+// flakyBucket fails the given number of calls of every operation with errTransient before passing them on.
+type flakyBucket struct {
+	objstore.Bucket
+
+	failures int
+	calls    map[string]int
+}
+
+func (b *flakyBucket) fail(op string) error {
+	b.calls[op]++
+	if b.calls[op] <= b.failures {
+		return errTransient
+	}
+	return nil
+}
+
+func (b *flakyBucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error, options ...objstore.IterOption) error {
+	if err := b.fail("iter"); err != nil {
+		return err
+	}
+	return b.Bucket.IterWithAttributes(ctx, dir, f, options...)
+}
+
+func (b *flakyBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := b.fail("get"); err != nil {
+		return nil, err
+	}
+	return b.Bucket.Get(ctx, name)
+}
+
+func (b *flakyBucket) Exists(ctx context.Context, name string) (bool, error) {
+	if err := b.fail("exists"); err != nil {
+		return false, err
+	}
+	return b.Bucket.Exists(ctx, name)
+}
+
+func (b *flakyBucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	if err := b.fail("attributes"); err != nil {
+		return objstore.ObjectAttributes{}, err
+	}
+	return b.Bucket.Attributes(ctx, name)
+}
+
+func (b *flakyBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	// Consume the reader like a failed upload would.
+	if err := b.fail("upload"); err != nil {
+		_, _ = ioutil.ReadAll(r)
+		return err
+	}
+	return b.Bucket.Upload(ctx, name, r)
+}
+
+func TestBucketWithRetries(t *testing.T) {
+	ctx := context.Background()
+	retryable := func(err error) bool { return errors.Cause(err) == errTransient }
+	conf := objstore.RetryConfig{MaxRetries: 2, MinBackoff: time.Millisecond}
+
+	flaky := &flakyBucket{Bucket: inmem.NewBucket(), failures: 2, calls: map[string]int{}}
+	bkt := objstore.BucketWithRetries(flaky, retryable, conf)
+
+	// Seekable readers are rewound before the upload is retried.
+	testutil.Ok(t, bkt.Upload(ctx, "a", bytes.NewReader([]byte("content"))))
+	testutil.Equals(t, 3, flaky.calls["upload"])
+
+	rc, err := bkt.Get(ctx, "a")
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "content", string(b))
+
+	ok, err := bkt.Exists(ctx, "a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected object to exist")
+
+	attrs, err := bkt.Attributes(ctx, "a")
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(7), attrs.Size)
+
+	// Readers that cannot be rewound are not retried.
+	flaky = &flakyBucket{Bucket: inmem.NewBucket(), failures: 1, calls: map[string]int{}}
+	bkt = objstore.BucketWithRetries(flaky, retryable, conf)
+	testutil.NotOk(t, bkt.Upload(ctx, "b", io.MultiReader(bytes.NewReader([]byte("content")))))
+	testutil.Equals(t, 1, flaky.calls["upload"])
+
+	// Errors not classified as transient are not retried.
+	bkt = objstore.BucketWithRetries(flaky, func(error) bool { return false }, conf)
+	testutil.Equals(t, errTransient, errors.Cause(bkt.Iter(ctx, "", func(string) error { return nil })))
+	testutil.Equals(t, 1, flaky.calls["iter"])
+
+	// Operations fail once the retries are exhausted.
+	flaky = &flakyBucket{Bucket: inmem.NewBucket(), failures: 3, calls: map[string]int{}}
+	bkt = objstore.BucketWithRetries(flaky, retryable, conf)
+	_, err = bkt.Exists(ctx, "a")
+	testutil.Equals(t, errTransient, errors.Cause(err))
+	testutil.Equals(t, 3, flaky.calls["exists"])
+	// Callers with retries of their own see that the error was retried already.
+	testutil.Assert(t, objstore.IsRetriedErr(errors.Wrap(err, "exists")), "expected retried error, got %v", err)
+	testutil.Assert(t, !objstore.IsRetriedErr(errTransient), "expected error not to be retried")
+
+	// Iter is not retried once it passed entries to f.
+	flaky = &flakyBucket{Bucket: inmem.NewBucket(), calls: map[string]int{}}
+	testutil.Ok(t, flaky.Upload(ctx, "a", bytes.NewReader(nil)))
+	bkt = objstore.BucketWithRetries(flaky, retryable, conf)
+	err = bkt.Iter(ctx, "", func(string) error { return errTransient })
+	testutil.Equals(t, errTransient, err)
+	testutil.Equals(t, 1, flaky.calls["iter"])
+
+	// The context stops retries.
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	flaky = &flakyBucket{Bucket: inmem.NewBucket(), failures: 3, calls: map[string]int{}}
+	bkt = objstore.BucketWithRetries(flaky, retryable, conf)
+	_, err = bkt.Get(cctx, "a")
+	testutil.Equals(t, errTransient, err)
+	testutil.Equals(t, 1, flaky.calls["get"])
+}
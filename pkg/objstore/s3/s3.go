@@ -2,20 +2,31 @@
 package s3
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/alecthomas/units"
+	"github.com/improbable-eng/thanos/pkg/objstore"
 	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/credentials"
+	"github.com/minio/minio-go/pkg/encrypt"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/version"
+	"golang.org/x/sync/errgroup"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -30,34 +41,85 @@ const (
 // DirDelim is the delimiter used to model a directory structure in an object store bucket.
 const DirDelim = "/"
 
+const (
+	defaultSTSEndpoint = "https://sts.amazonaws.com"
+	// stsRegion is the signing region of the global STS endpoint.
+	stsRegion = "us-east-1"
+)
+
+// Limits of S3 uploads.
+const (
+	minPartSize      = int64(5 * units.MiB)
+	maxPartSize      = int64(5 * units.GiB)
+	maxPartsCount    = 10000
+	maxSinglePutSize = int64(5 * units.GiB)
+)
+
+const (
+	// defaultPartSize is the minimum part size of objects of known size. It is small enough for the parts of chunk
+	// segments to be uploaded concurrently.
+	defaultPartSize = int64(16 * units.MiB)
+	// defaultUnknownSizePartSize is the part size of objects of unknown size. It allows for objects of up to 625GiB.
+	defaultUnknownSizePartSize = int64(64 * units.MiB)
+	defaultPartConcurrency     = 4
+)
+
+// Supported server-side encryption types.
+const (
+	SSES3  = "SSE-S3"
+	SSEKMS = "SSE-KMS"
+	SSEC   = "SSE-C"
+)
+
 // Bucket implements the store.Bucket interface against s3-compatible APIs.
 type Bucket struct {
 	bucket   string
 	client   *minio.Client
+	sse      encrypt.ServerSide
 	opsTotal *prometheus.CounterVec
+
+	partSize         int64
+	partConcurrency  int
+	disableMultipart bool
 }
 
 // Config encapsulates the necessary config values to instantiate an s3 client.
 type Config struct {
-	Bucket      string
-	Endpoint    string
-	AccessKey   string
-	SecretKey   string
-	Insecure    bool
-	SignatureV2 bool
-}
+	Bucket      string `yaml:"bucket"`
+	Endpoint    string `yaml:"endpoint"`
+	AccessKey   string `yaml:"access_key"`
+	SecretKey   string `yaml:"secret_key"`
+	Insecure    bool   `yaml:"insecure"`
+	SignatureV2 bool   `yaml:"signature_version2"`
+
+	// RoleARN is the role assumed with the static credentials. Not assumed if empty.
+	RoleARN     string `yaml:"role_arn"`
+	STSEndpoint string `yaml:"sts_endpoint"`
 
-// RegisterS3Params registers the s3 flags and returns an initialized Config struct.
-func RegisterS3Params(cmd *kingpin.CmdClause) *Config {
-	var s3config Config
+	// SSEType is the server-side encryption applied to uploaded objects. It is disabled if empty.
+	SSEType       string            `yaml:"sse"`
+	SSEKMSKeyID   string            `yaml:"sse_kms_key_id"`
+	SSEKMSContext map[string]string `yaml:"sse_kms_context"`
+	// SSECKeyFile is the path to a file containing the 32 byte customer key for SSE-C.
+	SSECKeyFile string `yaml:"sse_c_key_file"`
 
+	// PartSize is the size of the parts of multipart uploads. If zero, it is chosen based on the object size.
+	PartSize units.Base2Bytes `yaml:"part_size"`
+	// PartConcurrency is the number of parts of a multipart upload that are uploaded at once. It defaults to 4.
+	PartConcurrency int `yaml:"part_concurrency"`
+	// DisableMultipart uploads objects with a single request, which limits their size to 5GiB.
+	DisableMultipart bool `yaml:"disable_multipart"`
+}
+
+// RegisterS3Params registers the s3 flags into the given Config struct.
+func RegisterS3Params(cmd *kingpin.CmdClause, s3config *Config) {
 	cmd.Flag("s3.bucket", "S3-Compatible API bucket name for stored blocks.").
 		PlaceHolder("<bucket>").Envar("S3_BUCKET").StringVar(&s3config.Bucket)
 
 	cmd.Flag("s3.endpoint", "S3-Compatible API endpoint for stored blocks.").
 		PlaceHolder("<api-url>").Envar("S3_ENDPOINT").StringVar(&s3config.Endpoint)
 
-	cmd.Flag("s3.access-key", "Access key for an S3-Compatible API.").
+	cmd.Flag("s3.access-key", "Access key for an S3-Compatible API. If empty, credentials are looked up in the AWS environment variables, the shared credentials file, a web identity token and instance roles, in that order.").
 		PlaceHolder("<key>").Envar("S3_ACCESS_KEY").StringVar(&s3config.AccessKey)
 
 	s3config.SecretKey = os.Getenv("S3_SECRET_KEY")
@@ -68,30 +130,143 @@ func RegisterS3Params(cmd *kingpin.CmdClause) *Config {
 	cmd.Flag("s3.signature-version2", "Whether to use S3 Signature Version 2; otherwise Signature Version 4 will be used.").
 		Default("false").Envar("S3_SIGNATURE_VERSION2").BoolVar(&s3config.SignatureV2)
 
-	return &s3config
+	cmd.Flag("s3.role-arn", "ARN of an IAM role to assume with the configured access key.").
+		PlaceHolder("<arn>").Envar("S3_ROLE_ARN").StringVar(&s3config.RoleARN)
+
+	cmd.Flag("s3.sts-endpoint", "AWS Security Token Service endpoint used to assume roles.").
+		Default(defaultSTSEndpoint).Envar("S3_STS_ENDPOINT").StringVar(&s3config.STSEndpoint)
+
+	cmd.Flag("s3.sse", fmt.Sprintf("Server-side encryption of uploaded objects. One of %s, %s or %s. Disabled if empty.", SSES3, SSEKMS, SSEC)).
+		Default("").Envar("S3_SSE").EnumVar(&s3config.SSEType, "", SSES3, SSEKMS, SSEC)
+
+	cmd.Flag("s3.sse-kms-key-id", "ID of the KMS key used with SSE-KMS.").
+		PlaceHolder("<key-id>").Envar("S3_SSE_KMS_KEY_ID").StringVar(&s3config.SSEKMSKeyID)
+
+	cmd.Flag("s3.sse-kms-context", "Encryption context used with SSE-KMS (repeated).").
+		PlaceHolder("<key>=<value>").StringMapVar(&s3config.SSEKMSContext)
+
+	cmd.Flag("s3.sse-c-key-file", "Path to a file containing the 32 byte customer key used with SSE-C.").
+		PlaceHolder("<path>").Envar("S3_SSE_C_KEY_FILE").StringVar(&s3config.SSECKeyFile)
+
+	cmd.Flag("s3.part-size", "Size of the parts of multipart uploads. If 0, it is chosen based on the object size.").
+		Default("0").Envar("S3_PART_SIZE").BytesVar(&s3config.PartSize)
+
+	cmd.Flag("s3.part-concurrency", "Number of parts of a multipart upload that are uploaded concurrently.").
+		Default("4").Envar("S3_PART_CONCURRENCY").IntVar(&s3config.PartConcurrency)
+
+	cmd.Flag("s3.disable-multipart", "Upload objects with a single request, e.g. for S3-compatible APIs without multipart uploads. Limits objects to 5GiB.").
+		Default("false").Envar("S3_DISABLE_MULTIPART").BoolVar(&s3config.DisableMultipart)
 }
 
 // Validate checks to see if any of the s3 config options are set.
 func (conf *Config) Validate() error {
 	if conf.Bucket == "" ||
 		conf.Endpoint == "" ||
-		conf.AccessKey == "" ||
-		conf.SecretKey == "" {
+		(conf.AccessKey == "") != (conf.SecretKey == "") {
 		return errors.New("insufficient s3 configuration information")
 	}
+	if conf.RoleARN != "" && (conf.AccessKey == "" || conf.SignatureV2) {
+		return errors.New("s3 role can only be assumed with an access key and signature version 4")
+	}
 	return nil
 }
 
+// newCredentials returns the static credentials if an access key is configured and the default credentials chain
+// otherwise. The IAM provider of the chain also exchanges web identity tokens given by AWS_WEB_IDENTITY_TOKEN_FILE
+// and AWS_ROLE_ARN. If a role is configured, it is assumed with the static credentials.
+func newCredentials(conf *Config, component string) (*credentials.Credentials, error) {
+	switch {
+	case conf.RoleARN != "":
+		stsEndpoint := conf.STSEndpoint
+		if stsEndpoint == "" {
+			stsEndpoint = defaultSTSEndpoint
+		}
+		return credentials.NewSTSAssumeRole(stsEndpoint, credentials.STSAssumeRoleOptions{
+			AccessKey:       conf.AccessKey,
+			SecretKey:       conf.SecretKey,
+			Location:        stsRegion,
+			RoleARN:         conf.RoleARN,
+			RoleSessionName: fmt.Sprintf("thanos-%s", component),
+		})
+	case conf.AccessKey != "" && conf.SignatureV2:
+		return credentials.NewStaticV2(conf.AccessKey, conf.SecretKey, ""), nil
+	case conf.AccessKey != "":
+		return credentials.NewStaticV4(conf.AccessKey, conf.SecretKey, ""), nil
+	}
+	return credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.FileAWSCredentials{},
+		// Bound lookups of the instance metadata service outside of EC2 and ECS.
+		&credentials.IAM{Client: &http.Client{Timeout: 10 * time.Second}},
+	}), nil
+}
+
+// serverSideEncryption returns the server-side encryption configured for uploaded objects or nil if it is disabled.
+func (conf *Config) serverSideEncryption() (encrypt.ServerSide, error) {
+	switch conf.SSEType {
+	case "":
+		return nil, nil
+	case SSES3:
+		return encrypt.NewSSE(), nil
+	case SSEKMS:
+		if conf.SSEKMSKeyID == "" {
+			return nil, errors.New("no KMS key ID configured for SSE-KMS")
+		}
+		sse := kmsEncryption{keyID: conf.SSEKMSKeyID}
+		// The context is omitted entirely rather than sent as an empty JSON object.
+		if len(conf.SSEKMSContext) > 0 {
+			b, err := json.Marshal(conf.SSEKMSContext)
+			if err != nil {
+				return nil, errors.Wrap(err, "marshal SSE-KMS encryption context")
+			}
+			sse.context = base64.StdEncoding.EncodeToString(b)
+		}
+		return sse, nil
+	case SSEC:
+		if conf.SSECKeyFile == "" {
+			return nil, errors.New("no customer key file configured for SSE-C")
+		}
+		key, err := ioutil.ReadFile(conf.SSECKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read SSE-C key file")
+		}
+		return encrypt.NewSSEC(key)
+	}
+	return nil, errors.Errorf("unsupported server-side encryption %q", conf.SSEType)
+}
+
+// kmsEncryption is SSE-KMS with an optional encryption context. It replaces encrypt.NewSSEKMS, which sends the
+// context in a header unknown to S3.
+type kmsEncryption struct {
+	keyID   string
+	context string
+}
+
+func (s kmsEncryption) Type() encrypt.Type { return encrypt.KMS }
+
+func (s kmsEncryption) Marshal(h http.Header) {
+	h.Set("X-Amz-Server-Side-Encryption", "aws:kms")
+	h.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", s.keyID)
+	if s.context != "" {
+		h.Set("X-Amz-Server-Side-Encryption-Context", s.context)
+	}
+}
+
 // NewBucket returns a new Bucket using the provided s3 config values.
 func NewBucket(conf *Config, reg prometheus.Registerer, component string) (*Bucket, error) {
-	var f func(string, string, string, bool) (*minio.Client, error)
-	if conf.SignatureV2 {
-		f = minio.NewV2
-	} else {
-		f = minio.NewV4
+	if conf.PartSize != 0 && (int64(conf.PartSize) < minPartSize || int64(conf.PartSize) > maxPartSize) {
+		return nil, errors.New("s3 part size must be between 5MiB and 5GiB")
+	}
+	sse, err := conf.serverSideEncryption()
+	if err != nil {
+		return nil, errors.Wrap(err, "configure server-side encryption")
 	}
 
-	client, err := f(conf.Endpoint, conf.AccessKey, conf.SecretKey, !conf.Insecure)
+	creds, err := newCredentials(conf, component)
+	if err != nil {
+		return nil, errors.Wrap(err, "initialize s3 credentials")
+	}
+	client, err := minio.NewWithCredentials(conf.Endpoint, creds, !conf.Insecure, "")
 	if err != nil {
 		return nil, errors.Wrap(err, "initialize s3 client")
 	}
@@ -123,11 +298,18 @@ func NewBucket(conf *Config, reg prometheus.Registerer, component string) (*Buck
 	bkt := &Bucket{
 		bucket: conf.Bucket,
 		client: client,
+		sse:    sse,
 		opsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name:        "thanos_objstore_s3_bucket_operations_total",
 			Help:        "Total number of operations that were executed against an s3 bucket.",
 			ConstLabels: prometheus.Labels{"bucket": conf.Bucket},
 		}, []string{"operation"}),
+		partSize:         int64(conf.PartSize),
+		partConcurrency:  conf.PartConcurrency,
+		disableMultipart: conf.DisableMultipart,
+	}
+	if bkt.partConcurrency <= 0 {
+		bkt.partConcurrency = defaultPartConcurrency
 	}
 	if reg != nil {
 		reg.MustRegister(bkt.opsTotal)
@@ -137,7 +319,14 @@ func NewBucket(conf *Config, reg prometheus.Registerer, component string) (*Buck
 
 // Iter calls f for each entry in the given directory. The argument to f is the full
 // object name including the prefix of the inspected directory.
-func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) error {
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	}, options...)
+}
+
+// IterWithAttributes is like Iter but additionally passes the size and modification time of objects to f.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error, options ...objstore.IterOption) error {
 	b.opsTotal.WithLabelValues(opObjectsList).Inc()
 	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
 	// object itself as one prefix item.
@@ -145,12 +334,16 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 		dir = strings.TrimSuffix(dir, DirDelim) + DirDelim
 	}
 
-	for object := range b.client.ListObjects(b.bucket, dir, false, ctx.Done()) {
+	recursive := objstore.ApplyIterOptions(options...).Recursive
+	for object := range b.client.ListObjects(b.bucket, dir, recursive, ctx.Done()) {
+		if object.Err != nil {
+			return errors.Wrap(object.Err, "list s3 objects")
+		}
 		// this sometimes happens with empty buckets
 		if object.Key == "" {
 			continue
 		}
-		if err := f(object.Key); err != nil {
+		if err := f(object.Key, objstore.ObjectAttributes{Size: object.Size, LastModified: object.LastModified}); err != nil {
 			return err
 		}
 	}
@@ -161,13 +354,13 @@ func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error) err
 // Get returns a reader for the given object name.
 func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
 	b.opsTotal.WithLabelValues(opObjectGet).Inc()
-	return b.client.GetObjectWithContext(ctx, b.bucket, name, minio.GetObjectOptions{})
+	return b.client.GetObjectWithContext(ctx, b.bucket, name, minio.GetObjectOptions{ServerSideEncryption: b.sse})
 }
 
 // GetRange returns a new range reader for the given object name and range.
 func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
 	b.opsTotal.WithLabelValues(opObjectGet).Inc()
-	opts := &minio.GetObjectOptions{}
+	opts := &minio.GetObjectOptions{ServerSideEncryption: b.sse}
 	err := opts.SetRange(off, off+length)
 	if err != nil {
 		return nil, err
@@ -178,7 +371,10 @@ func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (
 // Exists checks if the given object exists.
 func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 	b.opsTotal.WithLabelValues(opObjectStat).Inc()
-	_, err := b.client.StatObject(b.bucket, name, minio.StatObjectOptions{})
+	// Objects encrypted with SSE-C can only be inspected with the customer key.
+	_, err := b.client.StatObject(b.bucket, name, minio.StatObjectOptions{
+		GetObjectOptions: minio.GetObjectOptions{ServerSideEncryption: b.sse},
+	})
 	if err != nil {
 		errResponse := minio.ToErrorResponse(err)
 		if errResponse.Code == "NoSuchKey" {
@@ -190,11 +386,204 @@ func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
 	return true, nil
 }
 
-// Upload the contents of the reader as an object into the bucket.
+// Attributes returns the size and modification time of the object.
+func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	b.opsTotal.WithLabelValues(opObjectStat).Inc()
+	info, err := b.client.StatObject(b.bucket, name, minio.StatObjectOptions{
+		GetObjectOptions: minio.GetObjectOptions{ServerSideEncryption: b.sse},
+	})
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrapf(err, "stat s3 object %s", name)
+	}
+	return objstore.ObjectAttributes{Size: info.Size, LastModified: info.LastModified}, nil
+}
+
+// Upload the contents of the reader as an object into the bucket. The configured server-side encryption applies
+// to single and multipart uploads. Objects larger than the part size are uploaded with multipart uploads, whose
+// parts are uploaded concurrently.
 func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
 	b.opsTotal.WithLabelValues(opObjectInsert).Inc()
-	_, err := b.client.PutObjectWithContext(ctx, b.bucket, name, r, -1, minio.PutObjectOptions{})
-	return errors.Wrap(err, "upload s3 object")
+
+	size, err := readerSize(r)
+	if err != nil {
+		return errors.Wrapf(err, "determine size of %s", name)
+	}
+	if b.disableMultipart {
+		return b.putObject(ctx, name, r, size)
+	}
+	partSize := b.objectPartSize(size)
+	if size >= 0 && size <= partSize {
+		return b.putObject(ctx, name, r, size)
+	}
+
+	// Objects of unknown size that fit into a single part are not worth a multipart upload.
+	buf := make([]byte, partSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return b.putObject(ctx, name, bytes.NewReader(buf[:n]), int64(n))
+	}
+	if err != nil {
+		return errors.Wrapf(err, "read %s", name)
+	}
+
+	core := minio.Core{Client: b.client}
+	uploadID, err := core.NewMultipartUpload(b.bucket, name, minio.PutObjectOptions{ServerSideEncryption: b.sse})
+	if err != nil {
+		return errors.Wrapf(err, "init multipart upload of s3 object %s", name)
+	}
+	if err := b.uploadParts(ctx, core, name, uploadID, buf, r); err != nil {
+		// Abort the upload, so no parts are left behind. The call does not use the possibly canceled context.
+		_ = core.AbortMultipartUpload(b.bucket, name, uploadID)
+		return errors.Wrapf(err, "multipart upload of s3 object %s", name)
+	}
+	return nil
+}
+
+// objectPartSize returns the part size for an object of the given size, which is negative if the size is unknown.
+func (b *Bucket) objectPartSize(size int64) int64 {
+	partSize := b.partSize
+	if partSize == 0 {
+		partSize = defaultPartSize
+		if size < 0 {
+			partSize = defaultUnknownSizePartSize
+		}
+	}
+	// Large objects need larger parts to stay within the maximum number of parts.
+	if min := (size + maxPartsCount - 1) / maxPartsCount; min > partSize {
+		partSize = (min + int64(units.MiB) - 1) / int64(units.MiB) * int64(units.MiB)
+	}
+	return partSize
+}
+
+// putObject uploads the object with a single request. Objects of unknown size are read into memory first.
+func (b *Bucket) putObject(ctx context.Context, name string, r io.Reader, size int64) error {
+	if size < 0 {
+		body, err := ioutil.ReadAll(io.LimitReader(r, maxSinglePutSize+1))
+		if err != nil {
+			return errors.Wrapf(err, "read %s", name)
+		}
+		r, size = bytes.NewReader(body), int64(len(body))
+	}
+	if size > maxSinglePutSize {
+		return errors.Errorf("s3 object %s exceeds the maximum size of single uploads", name)
+	}
+	_, err := minio.Core{Client: b.client}.PutObject(b.bucket, name, withContext(ctx, r), size, "", "", nil, b.sse)
+	return errors.Wrapf(err, "upload s3 object %s", name)
+}
+
+// uploadParts uploads the content of the full buffer and the remaining reader as parts of the multipart upload and
+// completes it. Up to partConcurrency parts are read into memory and uploaded at once.
+func (b *Bucket) uploadParts(ctx context.Context, core minio.Core, name, uploadID string, buf []byte, r io.Reader) error {
+	var (
+		mtx   sync.Mutex
+		parts []minio.CompletePart
+		// Buffers of finished parts are reused for the following ones. The first buffer is in use already, the
+		// others are allocated once needed.
+		bufs     = make(chan []byte, b.partConcurrency)
+		n        = len(buf)
+		partSize = len(buf)
+	)
+	for i := 1; i < b.partConcurrency; i++ {
+		bufs <- nil
+	}
+	g, gctx := errgroup.WithContext(ctx)
+
+	for i := 1; ; i++ {
+		if i > maxPartsCount {
+			_ = g.Wait()
+			return errors.Errorf("object exceeds %d parts", maxPartsCount)
+		}
+		part, data := i, buf[:n]
+		g.Go(func() error {
+			defer func() { bufs <- data[:cap(data)] }()
+
+			p, err := core.PutObjectPart(b.bucket, name, uploadID, part, withContext(gctx, bytes.NewReader(data)), int64(len(data)), "", "", b.sse)
+			if err != nil {
+				return errors.Wrapf(err, "upload part %d", part)
+			}
+			mtx.Lock()
+			parts = append(parts, minio.CompletePart{PartNumber: part, ETag: p.ETag})
+			mtx.Unlock()
+			return nil
+		})
+
+		select {
+		case buf = <-bufs:
+		case <-gctx.Done():
+			return g.Wait()
+		}
+		if buf == nil {
+			buf = make([]byte, partSize)
+		}
+		var err error
+		n, err = io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			_ = g.Wait()
+			return errors.Wrap(err, "read part")
+		}
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	if _, err := core.CompleteMultipartUpload(b.bucket, name, uploadID, parts); err != nil {
+		return errors.Wrap(err, "complete multipart upload")
+	}
+	return nil
+}
+
+// readerSize returns the number of bytes left in r or -1 if it cannot be determined without reading r.
+func readerSize(r io.Reader) (int64, error) {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len()), nil
+	case io.Seeker:
+		cur, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			// Not all seekers support seeking, e.g. pipes.
+			return -1, nil
+		}
+		end, err := v.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1, nil
+		}
+		if _, err := v.Seek(cur, io.SeekStart); err != nil {
+			return 0, errors.Wrap(err, "rewind reader")
+		}
+		return end - cur, nil
+	}
+	return -1, nil
+}
+
+// contextReader fails reads once its context is done. The low-level upload API of minio does not take a context,
+// so this aborts requests reading their body from it instead.
+type contextReader struct {
+	io.Reader
+	ctx context.Context
+}
+
+// withContext returns a reader of r bound to ctx. It keeps implementing io.Seeker if r does, which minio requires
+// to retry requests.
+func withContext(ctx context.Context, r io.Reader) io.Reader {
+	cr := &contextReader{Reader: r, ctx: ctx}
+	if s, ok := r.(io.Seeker); ok {
+		return struct {
+			*contextReader
+			io.Seeker
+		}{cr, s}
+	}
+	return cr
+}
+
+func (r *contextReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(b)
 }
 
 // Delete removes the object with the given name.
@@ -202,3 +591,16 @@ func (b *Bucket) Delete(ctx context.Context, name string) error {
 	b.opsTotal.WithLabelValues(opObjectDelete).Inc()
 	return b.client.RemoveObject(b.bucket, name)
 }
+
+// IsRetryableErr returns true if an operation that failed with err is likely to succeed when it is retried.
+func IsRetryableErr(err error) bool {
+	resp := minio.ToErrorResponse(errors.Cause(err))
+	switch resp.Code {
+	case "SlowDown", "InternalError", "RequestTimeout", "ServiceUnavailable":
+		return true
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return true
+	}
+	return objstore.IsTransientErr(err)
+}
@@ -1,14 +1,24 @@
 package s3
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/xml"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/alecthomas/units"
 	"github.com/improbable-eng/thanos/pkg/testutil"
 )
 
@@ -30,9 +40,11 @@ func TestUserAgent(t *testing.T) {
 	defer api.Close()
 
 	s3Config := Config{
-		Bucket:   "testing",
-		Endpoint: s3URL.Host,
-		Insecure: true,
+		Bucket:    "testing",
+		Endpoint:  s3URL.Host,
+		AccessKey: "key",
+		SecretKey: "secret",
+		Insecure:  true,
 	}
 
 	bucket, err := NewBucket(&s3Config, nil, "test-component")
@@ -43,3 +55,302 @@ func TestUserAgent(t *testing.T) {
 	testutil.Assert(t, bucketExists, "Couldn't get test bucket")
 	testutil.Assert(t, strings.Contains(receivedUserAgent, "thanos-test-component"), "Didn't receive proper user agent string from client")
 }
+
+func TestBucket_ServerSideEncryption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-s3-sse")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	key := bytes.Repeat([]byte("k"), 32)
+	keyFile := filepath.Join(dir, "key")
+	testutil.Ok(t, ioutil.WriteFile(keyFile, key, 0600))
+
+	for _, tcase := range []struct {
+		conf Config
+		// Headers expected when initiating the multipart upload and on all
+		// requests for the object data.
+		initiate, data map[string]string
+	}{
+		{
+			conf:     Config{},
+			initiate: map[string]string{"X-Amz-Server-Side-Encryption": ""},
+			data:     map[string]string{"X-Amz-Server-Side-Encryption": ""},
+		},
+		{
+			conf:     Config{SSEType: SSES3},
+			initiate: map[string]string{"X-Amz-Server-Side-Encryption": "AES256"},
+			data:     map[string]string{"X-Amz-Server-Side-Encryption": ""},
+		},
+		{
+			conf: Config{SSEType: SSEKMS, SSEKMSKeyID: "key-id", SSEKMSContext: map[string]string{"a": "b"}},
+			initiate: map[string]string{
+				"X-Amz-Server-Side-Encryption":                "aws:kms",
+				"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": "key-id",
+				"X-Amz-Server-Side-Encryption-Context":        base64.StdEncoding.EncodeToString([]byte(`{"a":"b"}`)),
+			},
+			data: map[string]string{"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": ""},
+		},
+		{
+			conf: Config{SSEType: SSEC, SSECKeyFile: keyFile},
+			initiate: map[string]string{
+				"X-Amz-Server-Side-Encryption-Customer-Algorithm": "AES256",
+				"X-Amz-Server-Side-Encryption-Customer-Key":       base64.StdEncoding.EncodeToString(key),
+			},
+			data: map[string]string{
+				"X-Amz-Server-Side-Encryption-Customer-Algorithm": "AES256",
+				"X-Amz-Server-Side-Encryption-Customer-Key":       base64.StdEncoding.EncodeToString(key),
+			},
+		},
+	} {
+		var initiate, part, stat http.Header
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = ioutil.ReadAll(r.Body)
+			w.Header().Add("Last-Modified", "Sun, 15 Apr 2018 20:26:05 GMT")
+			w.Header().Add("ETag", `"etag"`)
+
+			q := r.URL.Query()
+			switch _, location := q["location"]; {
+			case location:
+				fmt.Fprint(w, "<LocationConstraint></LocationConstraint>")
+			case r.Method == http.MethodPost && q.Get("uploadId") == "":
+				initiate = r.Header
+				fmt.Fprint(w, "<InitiateMultipartUploadResult><UploadId>id</UploadId></InitiateMultipartUploadResult>")
+			case r.Method == http.MethodPost:
+				fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>testing</Bucket><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+			case r.Method == http.MethodPut:
+				part = r.Header
+			case r.Method == http.MethodHead:
+				stat = r.Header
+			}
+		}))
+
+		s3URL, _ := url.ParseRequestURI(api.URL)
+		conf := tcase.conf
+		conf.Bucket = "testing"
+		conf.Endpoint = s3URL.Host
+		conf.AccessKey = "key"
+		conf.SecretKey = "secret"
+		conf.Insecure = true
+		conf.PartSize = units.Base2Bytes(minPartSize)
+
+		bkt, err := NewBucket(&conf, nil, "test-component")
+		testutil.Ok(t, err)
+		// Exceed the part size for a multipart upload.
+		testutil.Ok(t, bkt.Upload(context.Background(), "test_obj", bytes.NewReader(make([]byte, minPartSize+1))))
+		_, err = bkt.Exists(context.Background(), "test_obj")
+		testutil.Ok(t, err)
+		api.Close()
+
+		for k, v := range tcase.initiate {
+			testutil.Equals(t, v, initiate.Get(k))
+		}
+		for k, v := range tcase.data {
+			testutil.Equals(t, v, part.Get(k))
+			testutil.Equals(t, v, stat.Get(k))
+		}
+	}
+}
+
+func TestBucket_InvalidServerSideEncryption(t *testing.T) {
+	for _, conf := range []Config{
+		{SSEType: SSEKMS},
+		{SSEType: SSEC},
+		{SSEType: SSEC, SSECKeyFile: "/does/not/exist"},
+		{SSEType: "unknown"},
+	} {
+		conf.Bucket = "testing"
+		conf.Endpoint = "localhost:9000"
+		_, err := NewBucket(&conf, nil, "test-component")
+		testutil.NotOk(t, err)
+	}
+}
+
+// fakeS3 implements the subset of the S3 API used by Bucket.Upload for a single bucket.
+type fakeS3 struct {
+	mtx     sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	puts    int
+	parts   int
+	// failPart is the number of the part whose upload fails.
+	failPart int
+	aborted  bool
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	name := strings.TrimPrefix(r.URL.Path, "/testing/")
+	q := r.URL.Query()
+
+	switch _, location := q["location"]; {
+	case location:
+		fmt.Fprint(w, "<LocationConstraint></LocationConstraint>")
+	case r.Method == http.MethodPost && q.Get("uploadId") == "":
+		id := fmt.Sprintf("upload-%d", len(s.uploads))
+		s.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && q.Get("uploadId") != "":
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		if n == s.failPart {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "<Error><Code>InvalidPart</Code></Error>")
+			return
+		}
+		s.uploads[q.Get("uploadId")][n] = body
+		s.parts++
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, n))
+	case r.Method == http.MethodPost:
+		var req struct {
+			Parts []struct {
+				PartNumber int
+			} `xml:"Part"`
+		}
+		_ = xml.Unmarshal(body, &req)
+		var b []byte
+		for _, p := range req.Parts {
+			b = append(b, s.uploads[q.Get("uploadId")][p.PartNumber]...)
+		}
+		s.objects[name] = b
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>testing</Bucket><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodDelete && q.Get("uploadId") != "":
+		delete(s.uploads, q.Get("uploadId"))
+		s.aborted = true
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		s.objects[name] = body
+		s.puts++
+		w.Header().Set("ETag", `"etag"`)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestBucket_Upload(t *testing.T) {
+	ctx := context.Background()
+	large := bytes.Repeat([]byte("0123456789"), int(12*units.MiB/10))
+
+	for _, tcase := range []struct {
+		name  string
+		conf  Config
+		data  []byte
+		r     func([]byte) io.Reader
+		puts  int
+		parts int
+	}{
+		{
+			name: "small object",
+			data: []byte("data"),
+			r:    func(b []byte) io.Reader { return bytes.NewReader(b) },
+			puts: 1,
+		},
+		{
+			name: "small object of unknown size",
+			data: []byte("data"),
+			r:    func(b []byte) io.Reader { return io.MultiReader(bytes.NewReader(b)) },
+			puts: 1,
+		},
+		{
+			name:  "large object",
+			conf:  Config{PartSize: 5 * units.MiB, PartConcurrency: 2},
+			data:  large,
+			r:     func(b []byte) io.Reader { return bytes.NewReader(b) },
+			parts: 3,
+		},
+		{
+			name:  "large object of unknown size",
+			conf:  Config{PartSize: 5 * units.MiB, PartConcurrency: 2},
+			data:  large,
+			r:     func(b []byte) io.Reader { return io.MultiReader(bytes.NewReader(b)) },
+			parts: 3,
+		},
+		{
+			name: "large object without multipart",
+			conf: Config{PartSize: 5 * units.MiB, DisableMultipart: true},
+			data: large,
+			r:    func(b []byte) io.Reader { return io.MultiReader(bytes.NewReader(b)) },
+			puts: 1,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			s3 := &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+			api := httptest.NewServer(s3)
+			defer api.Close()
+
+			s3URL, _ := url.ParseRequestURI(api.URL)
+			conf := tcase.conf
+			conf.Bucket = "testing"
+			conf.Endpoint = s3URL.Host
+			conf.AccessKey = "key"
+			conf.SecretKey = "secret"
+			conf.Insecure = true
+			// Signature version 2 sends bodies without the chunk signatures of streaming version 4 requests.
+			conf.SignatureV2 = true
+
+			bkt, err := NewBucket(&conf, nil, "test-component")
+			testutil.Ok(t, err)
+			testutil.Ok(t, bkt.Upload(ctx, "dir/obj", tcase.r(tcase.data)))
+
+			testutil.Equals(t, tcase.puts, s3.puts)
+			testutil.Equals(t, tcase.parts, s3.parts)
+			testutil.Assert(t, bytes.Equal(tcase.data, s3.objects["dir/obj"]), "unexpected content of uploaded object")
+		})
+	}
+
+	t.Run("failed part", func(t *testing.T) {
+		s3 := &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}, failPart: 2}
+		api := httptest.NewServer(s3)
+		defer api.Close()
+
+		s3URL, _ := url.ParseRequestURI(api.URL)
+		conf := Config{
+			Bucket:      "testing",
+			Endpoint:    s3URL.Host,
+			AccessKey:   "key",
+			SecretKey:   "secret",
+			Insecure:    true,
+			SignatureV2: true,
+			PartSize:    5 * units.MiB,
+		}
+		bkt, err := NewBucket(&conf, nil, "test-component")
+		testutil.Ok(t, err)
+		testutil.NotOk(t, bkt.Upload(ctx, "dir/obj", bytes.NewReader(large)))
+
+		testutil.Assert(t, s3.aborted, "expected multipart upload to be aborted")
+		_, ok := s3.objects["dir/obj"]
+		testutil.Assert(t, !ok, "expected object not to exist")
+	})
+}
+
+func TestBucket_ObjectPartSize(t *testing.T) {
+	bkt := &Bucket{}
+	testutil.Equals(t, defaultUnknownSizePartSize, bkt.objectPartSize(-1))
+	testutil.Equals(t, defaultPartSize, bkt.objectPartSize(100))
+	// Parts are large enough for the maximum number of parts.
+	testutil.Equals(t, int64(105*units.MiB), bkt.objectPartSize(int64(units.TiB)))
+
+	bkt.partSize = minPartSize
+	testutil.Equals(t, minPartSize, bkt.objectPartSize(-1))
+	testutil.Equals(t, int64(11*units.MiB), bkt.objectPartSize(int64(100*units.GiB)))
+}
+
+func TestBucket_InvalidPartSize(t *testing.T) {
+	for _, size := range []units.Base2Bytes{units.MiB, 6 * units.GiB} {
+		_, err := NewBucket(&Config{Bucket: "testing", Endpoint: "localhost:9000", PartSize: size}, nil, "test-component")
+		testutil.NotOk(t, err)
+	}
+}
+
+func TestConfig_ValidateRole(t *testing.T) {
+	conf := Config{Bucket: "testing", Endpoint: "localhost:9000", RoleARN: "arn:role"}
+	testutil.NotOk(t, conf.Validate())
+
+	conf.AccessKey, conf.SecretKey = "key", "secret"
+	testutil.Ok(t, conf.Validate())
+
+	// Roles are assumed with signature version 4 only.
+	conf.SignatureV2 = true
+	testutil.NotOk(t, conf.Validate())
+}
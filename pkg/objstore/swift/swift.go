@@ -0,0 +1,390 @@
+// Package swift implements common object storage abstractions against OpenStack Swift.
+package swift
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/units"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/ncw/swift"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	opObjectsList  = "GET container"
+	opObjectInsert = "PUT object"
+	opObjectGet    = "GET object"
+	opObjectStat   = "HEAD object"
+	opObjectDelete = "DELETE object"
+)
+
+// DirDelim is the delimiter used to model a directory structure in an object store bucket.
+const DirDelim = "/"
+
+// segmentsSuffix is appended to the container name to get the container holding the segments of large objects.
+const segmentsSuffix = "_segments"
+
+// Config encapsulates the necessary config values to instantiate a Swift client.
+type Config struct {
+	// AuthURL is the Keystone endpoint. URLs ending with /v3 use the identity API v3, all others v2.0.
+	AuthURL           string `yaml:"auth_url"`
+	Username          string `yaml:"username"`
+	UserDomainName    string `yaml:"user_domain_name"`
+	Password          string `yaml:"password"`
+	ProjectName       string `yaml:"project_name"`
+	ProjectDomainName string `yaml:"project_domain_name"`
+	RegionName        string `yaml:"region_name"`
+	ContainerName     string `yaml:"container_name"`
+	// SegmentSize is the size of the segments objects larger than it are uploaded in.
+	SegmentSize units.Base2Bytes `yaml:"segment_size"`
+}
+
+// DefaultConfig holds the defaults of the Swift flags for configurations given in YAML.
+var DefaultConfig = Config{
+	UserDomainName:    "Default",
+	ProjectDomainName: "Default",
+	SegmentSize:       units.GiB,
+}
+
+// RegisterSwiftParams registers the Swift flags into the given Config struct.
+func RegisterSwiftParams(cmd *kingpin.CmdClause, conf *Config) {
+	cmd.Flag("swift.auth-url", "OpenStack Keystone endpoint, e.g. https://keystone:5000/v3. URLs ending with /v3 use the identity API v3, all others v2.0.").
+		PlaceHolder("<url>").Envar("OS_AUTH_URL").StringVar(&conf.AuthURL)
+
+	cmd.Flag("swift.username", "OpenStack user name.").
+		PlaceHolder("<user>").Envar("OS_USERNAME").StringVar(&conf.Username)
+
+	cmd.Flag("swift.user-domain-name", "OpenStack domain of the user (identity API v3 only).").
+		Default("Default").Envar("OS_USER_DOMAIN_NAME").StringVar(&conf.UserDomainName)
+
+	cmd.Flag("swift.project-name", "OpenStack project (tenant) name.").
+		PlaceHolder("<project>").Envar("OS_PROJECT_NAME").StringVar(&conf.ProjectName)
+
+	cmd.Flag("swift.project-domain-name", "OpenStack domain of the project (identity API v3 only).").
+		Default("Default").Envar("OS_PROJECT_DOMAIN_NAME").StringVar(&conf.ProjectDomainName)
+
+	cmd.Flag("swift.region-name", "OpenStack region of the object storage endpoint. The first endpoint is used if empty.").
+		PlaceHolder("<region>").Envar("OS_REGION_NAME").StringVar(&conf.RegionName)
+
+	cmd.Flag("swift.container-name", "Swift container name for stored blocks. It is created if it does not exist.").
+		PlaceHolder("<container>").Envar("OS_CONTAINER_NAME").StringVar(&conf.ContainerName)
+
+	cmd.Flag("swift.segment-size", "Objects larger than this are uploaded as dynamic large objects with segments of this size.").
+		Default("1GB").BytesVar(&conf.SegmentSize)
+
+	conf.Password = os.Getenv("OS_PASSWORD")
+}
+
+// Validate checks to see if any of the Swift config options are set.
+func (conf *Config) Validate() error {
+	if conf.AuthURL == "" ||
+		conf.Username == "" ||
+		conf.Password == "" ||
+		conf.ContainerName == "" {
+		return errors.New("insufficient swift configuration information")
+	}
+	return nil
+}
+
+// Bucket implements the store.Bucket interface against OpenStack Swift.
+// NOTE: The Swift client does not take a context, so operations are not aborted once their context is canceled.
+type Bucket struct {
+	connection    *swift.Connection
+	containerName string
+	segmentSize   int64
+	opsTotal      *prometheus.CounterVec
+}
+
+// NewBucket returns a new Bucket using the provided Swift config values. The container is created if it does
+// not exist yet.
+func NewBucket(conf *Config, reg prometheus.Registerer, component string) (*Bucket, error) {
+	if conf.SegmentSize <= 0 {
+		return nil, errors.New("swift segment size must be positive")
+	}
+	authVersion := 2
+	if strings.HasSuffix(strings.TrimSuffix(conf.AuthURL, "/"), "/v3") {
+		authVersion = 3
+	}
+	bkt := &Bucket{
+		connection: &swift.Connection{
+			AuthUrl:      conf.AuthURL,
+			AuthVersion:  authVersion,
+			UserName:     conf.Username,
+			ApiKey:       conf.Password,
+			Domain:       conf.UserDomainName,
+			Tenant:       conf.ProjectName,
+			TenantDomain: conf.ProjectDomainName,
+			Region:       conf.RegionName,
+			UserAgent:    fmt.Sprintf("thanos-%s/%s (%s)", component, version.Version, runtime.Version()),
+			// Requests failing with expired tokens are retried once with a new token. Other failed operations
+			// are retried by the bucket wrapper around all providers.
+			Retries: 1,
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+					DualStack: true,
+				}).DialContext,
+				MaxIdleConns:          100,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+				// Cover cases where the tcp connection works but the server never answers.
+				ResponseHeaderTimeout: 15 * time.Second,
+				DisableCompression:    true,
+			},
+		},
+		containerName: conf.ContainerName,
+		segmentSize:   int64(conf.SegmentSize),
+		opsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "thanos_objstore_swift_bucket_operations_total",
+			Help:        "Total number of operations that were executed against a Swift container.",
+			ConstLabels: prometheus.Labels{"bucket": conf.ContainerName},
+		}, []string{"operation"}),
+	}
+	if err := bkt.connection.Authenticate(); err != nil {
+		return nil, errors.Wrap(err, "keystone auth")
+	}
+	if err := bkt.createContainer(conf.ContainerName); err != nil {
+		return nil, err
+	}
+	if reg != nil {
+		reg.MustRegister(bkt.opsTotal)
+	}
+	return bkt, nil
+}
+
+func isNotFound(err error) bool {
+	e, ok := errors.Cause(err).(*swift.Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// IsRetryableErr returns true if an operation that failed with err is likely to succeed when it is retried.
+func IsRetryableErr(err error) bool {
+	if e, ok := errors.Cause(err).(*swift.Error); ok && e.StatusCode != 0 {
+		return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+	}
+	return objstore.IsTransientErr(err)
+}
+
+func (b *Bucket) createContainer(container string) error {
+	b.opsTotal.WithLabelValues("PUT container").Inc()
+
+	if err := b.connection.ContainerCreate(container, nil); err != nil {
+		return errors.Wrapf(err, "create swift container %s", container)
+	}
+	return nil
+}
+
+// Iter calls f for each entry in the given directory. The argument to f is the full
+// object name including the prefix of the inspected directory.
+func (b *Bucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.IterWithAttributes(ctx, dir, func(name string, _ objstore.ObjectAttributes) error {
+		return f(name)
+	}, options...)
+}
+
+// IterWithAttributes is like Iter but additionally passes the size and modification time of objects to f. The size
+// of objects stored in segments is not known from listings and reported as 0.
+func (b *Bucket) IterWithAttributes(ctx context.Context, dir string, f func(string, objstore.ObjectAttributes) error, options ...objstore.IterOption) error {
+	// Ensure the object name actually ends with a dir suffix. Otherwise we'll just iterate the
+	// object itself as one prefix item.
+	if dir != "" {
+		dir = strings.TrimSuffix(dir, DirDelim) + DirDelim
+	}
+
+	opts := &swift.ObjectsOpts{Prefix: dir}
+	if !objstore.ApplyIterOptions(options...).Recursive {
+		opts.Delimiter = []rune(DirDelim)[0]
+	}
+	return b.list(b.containerName, opts, f)
+}
+
+// list calls f for all objects of the container matching opts. Pseudo directories of listings with delimiter are
+// passed with their name ending with the delimiter.
+func (b *Bucket) list(container string, opts *swift.ObjectsOpts, f func(string, objstore.ObjectAttributes) error) error {
+	return b.connection.ObjectsWalk(container, opts, func(opts *swift.ObjectsOpts) (interface{}, error) {
+		b.opsTotal.WithLabelValues(opObjectsList).Inc()
+
+		objects, err := b.connection.Objects(container, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range objects {
+			if err := f(o.Name, objstore.ObjectAttributes{Size: o.Bytes, LastModified: o.LastModified}); err != nil {
+				return nil, err
+			}
+		}
+		return objects, nil
+	})
+}
+
+// Get returns a reader for the given object name.
+func (b *Bucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return b.get(name, nil)
+}
+
+// GetRange returns a new range reader for the given object name and range.
+func (b *Bucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	return b.get(name, swift.Headers{"Range": fmt.Sprintf("bytes=%d-%d", off, off+length-1)})
+}
+
+func (b *Bucket) get(name string, h swift.Headers) (io.ReadCloser, error) {
+	b.opsTotal.WithLabelValues(opObjectGet).Inc()
+
+	// Checksums cannot be verified for ranges and the segments of large objects.
+	file, _, err := b.connection.ObjectOpen(b.containerName, name, false, h)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get swift object %s", name)
+	}
+	return file, nil
+}
+
+// Exists checks if the given object exists.
+func (b *Bucket) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := b.Attributes(ctx, name)
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Attributes returns the size and modification time of the object.
+func (b *Bucket) Attributes(ctx context.Context, name string) (objstore.ObjectAttributes, error) {
+	b.opsTotal.WithLabelValues(opObjectStat).Inc()
+
+	o, _, err := b.connection.Object(b.containerName, name)
+	if err != nil {
+		return objstore.ObjectAttributes{}, errors.Wrapf(err, "stat swift object %s", name)
+	}
+	return objstore.ObjectAttributes{Size: o.Bytes, LastModified: o.LastModified}, nil
+}
+
+// Upload the contents of the reader as an object into the bucket. Objects larger than the segment size are uploaded
+// as dynamic large object: the segments are stored in a separate container and the object itself is a manifest
+// referencing them, so reads return the concatenated segments.
+// NOTE: Segments are left behind if a large object is overwritten by a small one. Block files are never overwritten
+// with different content, so this is not worth an additional listing for every upload.
+func (b *Bucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	br := bufio.NewReader(r)
+
+	// Most objects fit into a single segment, so the first segment is uploaded as the object itself. It is only
+	// moved into the segments container if more data follows.
+	if err := b.put(b.containerName, name, io.LimitReader(br, b.segmentSize), nil); err != nil {
+		return errors.Wrapf(err, "upload swift object %s", name)
+	}
+	if _, err := br.Peek(1); err == io.EOF {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "read %s", name)
+	}
+
+	var (
+		segContainer = b.containerName + segmentsSuffix
+		segPrefix    = name + DirDelim
+	)
+	if err := b.createContainer(segContainer); err != nil {
+		return err
+	}
+	// Remove segments of a previous version of the object, they would be part of the new object otherwise.
+	if err := b.deleteSegments(segPrefix); err != nil {
+		return err
+	}
+
+	b.opsTotal.WithLabelValues(opObjectInsert).Inc()
+	if _, err := b.connection.ObjectCopy(b.containerName, name, segContainer, segPrefix+segmentName(0), nil); err != nil {
+		return errors.Wrapf(err, "copy first segment of swift object %s", name)
+	}
+	for i := 1; ; i++ {
+		if _, err := br.Peek(1); err == io.EOF {
+			break
+		} else if err != nil {
+			return errors.Wrapf(err, "read %s", name)
+		}
+		if err := b.put(segContainer, segPrefix+segmentName(i), io.LimitReader(br, b.segmentSize), nil); err != nil {
+			return errors.Wrapf(err, "upload segment %d of swift object %s", i, name)
+		}
+	}
+
+	h := swift.Headers{"X-Object-Manifest": segContainer + "/" + segPrefix}
+	if err := b.put(b.containerName, name, bytes.NewReader(nil), h); err != nil {
+		return errors.Wrapf(err, "upload manifest of swift object %s", name)
+	}
+	return nil
+}
+
+// segmentName returns the name of the i-th segment. Segments are concatenated in lexical order of their names.
+func segmentName(i int) string {
+	return fmt.Sprintf("%08d", i)
+}
+
+func (b *Bucket) put(container, name string, r io.Reader, h swift.Headers) error {
+	b.opsTotal.WithLabelValues(opObjectInsert).Inc()
+
+	_, err := b.connection.ObjectPut(container, name, r, false, "", "", h)
+	return err
+}
+
+// deleteSegments deletes all segments with the given prefix from the segments container.
+func (b *Bucket) deleteSegments(prefix string) error {
+	container := b.containerName + segmentsSuffix
+
+	// Collect the segments first, deleting them while listing would shift the pages.
+	var segments []string
+	err := b.list(container, &swift.ObjectsOpts{Prefix: prefix}, func(name string, _ objstore.ObjectAttributes) error {
+		segments = append(segments, name)
+		return nil
+	})
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "list segments %s", prefix)
+	}
+
+	for _, s := range segments {
+		b.opsTotal.WithLabelValues(opObjectDelete).Inc()
+
+		if err := b.connection.ObjectDelete(container, s); err != nil && !isNotFound(err) {
+			return errors.Wrapf(err, "delete segment %s", s)
+		}
+	}
+	return nil
+}
+
+// Delete removes the object with the given name. Segments of large objects are deleted as well.
+func (b *Bucket) Delete(ctx context.Context, name string) error {
+	b.opsTotal.WithLabelValues(opObjectStat).Inc()
+
+	_, h, err := b.connection.Object(b.containerName, name)
+	if err != nil {
+		return errors.Wrapf(err, "stat swift object %s", name)
+	}
+
+	b.opsTotal.WithLabelValues(opObjectDelete).Inc()
+	if err := b.connection.ObjectDelete(b.containerName, name); err != nil {
+		return errors.Wrapf(err, "delete swift object %s", name)
+	}
+
+	if h.IsLargeObjectDLO() {
+		return b.deleteSegments(name + DirDelim)
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package swift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+var lastModified = time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC)
+
+// fakeSwift implements the subset of the Keystone and Swift APIs used by Bucket.
+type fakeSwift struct {
+	url   string
+	token string
+
+	mtx        sync.Mutex
+	containers map[string]map[string][]byte
+	manifests  map[string]string
+}
+
+func (s *fakeSwift) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	switch r.URL.Path {
+	case "/v2.0/tokens":
+		fmt.Fprintf(w, `{"access": {"token": {"id": %q}, "serviceCatalog": [
+			{"type": "compute", "endpoints": [{"region": "r1", "publicURL": "http://compute"}]},
+			{"type": "object-store", "endpoints": [{"region": "r0", "publicURL": "http://other"}, {"region": "r1", "publicURL": %q}]}
+		]}}`, s.token, s.url+"/swift/v1")
+		return
+	case "/v3/auth/tokens":
+		w.Header().Set("X-Subject-Token", s.token)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": {"catalog": [
+			{"type": "object-store", "endpoints": [
+				{"region_id": "r1", "region": "r1", "interface": "internal", "url": "http://internal"},
+				{"region_id": "r1", "region": "r1", "interface": "public", "url": %q}
+			]}
+		]}}`, s.url+"/swift/v1")
+		return
+	}
+	if r.Header.Get("X-Auth-Token") != s.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/swift/v1/"), "/", 2)
+	container := parts[0]
+	if len(parts) == 1 {
+		s.serveContainer(w, r, container)
+		return
+	}
+	name := parts[1]
+	objects, ok := s.containers[container]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		b, _ := ioutil.ReadAll(r.Body)
+		objects[name] = b
+		delete(s.manifests, container+"/"+name)
+		if m := r.Header.Get("X-Object-Manifest"); m != "" {
+			s.manifests[container+"/"+name] = m
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		b, ok := objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if m, ok := s.manifests[container+"/"+name]; ok {
+			w.Header().Set("X-Object-Manifest", m)
+			p := strings.SplitN(m, "/", 2)
+			var segs []string
+			for n := range s.containers[p[0]] {
+				if strings.HasPrefix(n, p[1]) {
+					segs = append(segs, n)
+				}
+			}
+			sort.Strings(segs)
+			b = nil
+			for _, n := range segs {
+				b = append(b, s.containers[p[0]][n]...)
+			}
+		}
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+			return
+		}
+		if rng := r.Header.Get("Range"); rng != "" {
+			var start, end int
+			fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+			if end >= len(b) {
+				end = len(b) - 1
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(b[start : end+1])
+			return
+		}
+		w.Write(b)
+	case "COPY":
+		b, ok := objects[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		dst, _ := url.PathUnescape(r.Header.Get("Destination"))
+		p := strings.SplitN(strings.TrimPrefix(dst, "/"), "/", 2)
+		s.containers[p[0]][p[1]] = b
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if _, ok := objects[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(objects, name)
+		delete(s.manifests, container+"/"+name)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *fakeSwift) serveContainer(w http.ResponseWriter, r *http.Request, container string) {
+	if r.Method == http.MethodPut {
+		if _, ok := s.containers[container]; ok {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		s.containers[container] = map[string][]byte{}
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	objects, ok := s.containers[container]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var (
+		q        = r.URL.Query()
+		prefix   = q.Get("prefix")
+		delim    = q.Get("delimiter")
+		marker   = q.Get("marker")
+		limit, _ = strconv.Atoi(q.Get("limit"))
+		entries  []string
+		seen     = map[string]bool{}
+		page     = []map[string]interface{}{}
+		subdirs  = map[string]bool{}
+		allNames []string
+	)
+	for n := range objects {
+		allNames = append(allNames, n)
+	}
+	sort.Strings(allNames)
+	for _, n := range allNames {
+		if !strings.HasPrefix(n, prefix) {
+			continue
+		}
+		if i := strings.Index(n[len(prefix):], "/"); delim != "" && i >= 0 {
+			n = n[:len(prefix)+i+1]
+			subdirs[n] = true
+		}
+		if !seen[n] && n > marker {
+			seen[n] = true
+			entries = append(entries, n)
+		}
+	}
+	for _, e := range entries {
+		if len(page) == limit {
+			break
+		}
+		if subdirs[e] {
+			page = append(page, map[string]interface{}{"subdir": e})
+		} else {
+			page = append(page, map[string]interface{}{
+				"name":          e,
+				"bytes":         len(objects[e]),
+				"last_modified": lastModified.Format("2006-01-02T15:04:05.000000"),
+			})
+		}
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+func testBucket(t *testing.T, authURL string) {
+	ctx := context.Background()
+	srv := &fakeSwift{
+		token:      "token",
+		containers: map[string]map[string][]byte{},
+		manifests:  map[string]string{},
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	srv.url = ts.URL
+
+	bkt, err := NewBucket(&Config{
+		AuthURL:       ts.URL + authURL,
+		Username:      "user",
+		Password:      "pass",
+		ProjectName:   "project",
+		RegionName:    "r1",
+		ContainerName: "thanos",
+		SegmentSize:   10,
+	}, nil, "test")
+	testutil.Ok(t, err)
+	_, ok := srv.containers["thanos"]
+	testutil.Assert(t, ok, "expected container to be created")
+
+	testutil.Ok(t, bkt.Upload(ctx, "dir/a", bytes.NewReader([]byte("object a"))))
+	testutil.Ok(t, bkt.Upload(ctx, "dir/sub/b", bytes.NewReader(nil)))
+
+	// Objects larger than the segment size are split into segments.
+	large := []byte("0123456789abcdefghij0123456789x")
+	testutil.Ok(t, bkt.Upload(ctx, "dir/large", bytes.NewReader(large)))
+	testutil.Equals(t, 4, len(srv.containers["thanos_segments"]))
+
+	rc, err := bkt.Get(ctx, "dir/large")
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(rc)
+	rc.Close()
+	testutil.Ok(t, err)
+	testutil.Equals(t, string(large), string(b))
+
+	// Overwriting a large object drops the old segments.
+	testutil.Ok(t, bkt.Upload(ctx, "dir/large", bytes.NewReader(large[:15])))
+	testutil.Equals(t, 2, len(srv.containers["thanos_segments"]))
+
+	rc, err = bkt.GetRange(ctx, "dir/large", 8, 4)
+	testutil.Ok(t, err)
+	b, err = ioutil.ReadAll(rc)
+	rc.Close()
+	testutil.Ok(t, err)
+	testutil.Equals(t, "89ab", string(b))
+
+	var names []string
+	testutil.Ok(t, bkt.Iter(ctx, "dir", func(n string) error {
+		names = append(names, n)
+		return nil
+	}))
+	testutil.Equals(t, []string{"dir/a", "dir/large", "dir/sub/"}, names)
+
+	names = nil
+	testutil.Ok(t, bkt.IterWithAttributes(ctx, "dir", func(n string, attrs objstore.ObjectAttributes) error {
+		names = append(names, n)
+		if n == "dir/a" {
+			testutil.Equals(t, int64(8), attrs.Size)
+			testutil.Assert(t, lastModified.Equal(attrs.LastModified), "unexpected modification time %v", attrs.LastModified)
+		}
+		return nil
+	}, objstore.WithRecursiveIter()))
+	testutil.Equals(t, []string{"dir/a", "dir/large", "dir/sub/b"}, names)
+
+	attrs, err := bkt.Attributes(ctx, "dir/large")
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(15), attrs.Size)
+	testutil.Assert(t, lastModified.Equal(attrs.LastModified), "unexpected modification time %v", attrs.LastModified)
+
+	ok, err = bkt.Exists(ctx, "dir/a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected object to exist")
+
+	testutil.Ok(t, bkt.Delete(ctx, "dir/a"))
+	ok, err = bkt.Exists(ctx, "dir/a")
+	testutil.Ok(t, err)
+	testutil.Assert(t, !ok, "expected object to be deleted")
+
+	testutil.Ok(t, bkt.Delete(ctx, "dir/large"))
+	testutil.Equals(t, 0, len(srv.containers["thanos_segments"]))
+
+	// Expired tokens are renewed.
+	srv.mtx.Lock()
+	srv.token = "new-token"
+	srv.mtx.Unlock()
+	ok, err = bkt.Exists(ctx, "dir/sub/b")
+	testutil.Ok(t, err)
+	testutil.Assert(t, ok, "expected object to exist")
+}
+
+func TestBucket_KeystoneV2(t *testing.T) {
+	testBucket(t, "/v2.0")
+}
+
+func TestBucket_KeystoneV3(t *testing.T) {
+	testBucket(t, "/v3")
+}
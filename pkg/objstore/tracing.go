@@ -0,0 +1,149 @@
+package objstore
+
+import (
+	"context"
+	"io"
+
+	"github.com/improbable-eng/thanos/pkg/tracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// BucketWithTracing returns a bucket that starts a span for every operation against b as child of the span found in
+// the operation's context. Spans of reads end when the returned reader is closed.
+func BucketWithTracing(b Bucket) Bucket {
+	return &tracingBucket{bkt: b}
+}
+
+type tracingBucket struct {
+	bkt Bucket
+}
+
+func startBucketSpan(ctx context.Context, op string) (opentracing.Span, context.Context) {
+	return tracing.StartSpan(ctx, "bucket_"+op)
+}
+
+func finishBucketSpan(span opentracing.Span, err error) {
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogKV("err", err.Error())
+	}
+	span.Finish()
+}
+
+func (b *tracingBucket) Iter(ctx context.Context, dir string, f func(name string) error, options ...IterOption) error {
+	return b.IterWithAttributes(ctx, dir, ignoreAttributes(f), options...)
+}
+
+func (b *tracingBucket) IterWithAttributes(ctx context.Context, dir string, f func(string, ObjectAttributes) error, options ...IterOption) error {
+	span, ctx := startBucketSpan(ctx, "iter")
+	span.SetTag("dir", dir)
+	span.SetTag("recursive", ApplyIterOptions(options...).Recursive)
+
+	var n int
+	err := b.bkt.IterWithAttributes(ctx, dir, func(name string, attrs ObjectAttributes) error {
+		n++
+		return f(name, attrs)
+	}, options...)
+	span.SetTag("entries", n)
+	finishBucketSpan(span, err)
+	return err
+}
+
+func (b *tracingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	span, ctx := startBucketSpan(ctx, "get")
+	span.SetTag("name", name)
+
+	rc, err := b.bkt.Get(ctx, name)
+	if err != nil {
+		finishBucketSpan(span, err)
+		return nil, err
+	}
+	return &tracingReadCloser{ReadCloser: rc, span: span}, nil
+}
+
+func (b *tracingBucket) GetRange(ctx context.Context, name string, off, length int64) (io.ReadCloser, error) {
+	span, ctx := startBucketSpan(ctx, "get_range")
+	span.SetTag("name", name)
+	span.SetTag("offset", off)
+	span.SetTag("length", length)
+
+	rc, err := b.bkt.GetRange(ctx, name, off, length)
+	if err != nil {
+		finishBucketSpan(span, err)
+		return nil, err
+	}
+	return &tracingReadCloser{ReadCloser: rc, span: span}, nil
+}
+
+func (b *tracingBucket) Exists(ctx context.Context, name string) (bool, error) {
+	span, ctx := startBucketSpan(ctx, "exists")
+	span.SetTag("name", name)
+
+	ok, err := b.bkt.Exists(ctx, name)
+	span.SetTag("exists", ok)
+	finishBucketSpan(span, err)
+	return ok, err
+}
+
+func (b *tracingBucket) Attributes(ctx context.Context, name string) (ObjectAttributes, error) {
+	span, ctx := startBucketSpan(ctx, "attributes")
+	span.SetTag("name", name)
+
+	attrs, err := b.bkt.Attributes(ctx, name)
+	span.SetTag("bytes", attrs.Size)
+	finishBucketSpan(span, err)
+	return attrs, err
+}
+
+func (b *tracingBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	span, ctx := startBucketSpan(ctx, "upload")
+	span.SetTag("name", name)
+
+	r, cr := newCountingReader(r)
+	err := b.bkt.Upload(ctx, name, r)
+	span.SetTag("bytes", cr.n)
+	finishBucketSpan(span, err)
+	return err
+}
+
+func (b *tracingBucket) Delete(ctx context.Context, name string) error {
+	span, ctx := startBucketSpan(ctx, "delete")
+	span.SetTag("name", name)
+
+	err := b.bkt.Delete(ctx, name)
+	finishBucketSpan(span, err)
+	return err
+}
+
+// tracingReadCloser finishes the span of a read with the number of bytes read once it is closed.
+type tracingReadCloser struct {
+	io.ReadCloser
+
+	span opentracing.Span
+	n    int64
+	err  error
+}
+
+func (rc *tracingReadCloser) Read(b []byte) (int, error) {
+	n, err := rc.ReadCloser.Read(b)
+	rc.n += int64(n)
+	if err != nil && err != io.EOF && rc.err == nil {
+		rc.err = err
+	}
+	return n, err
+}
+
+func (rc *tracingReadCloser) Close() error {
+	err := rc.ReadCloser.Close()
+	if rc.span == nil {
+		return err
+	}
+	rc.span.SetTag("bytes", rc.n)
+	if rc.err == nil {
+		rc.err = err
+	}
+	finishBucketSpan(rc.span, rc.err)
+	rc.span = nil
+	return err
+}
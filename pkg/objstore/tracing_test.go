@@ -0,0 +1,60 @@
+package objstore_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/improbable-eng/thanos/pkg/tracing"
+	"github.com/opentracing/basictracer-go"
+)
+
+func TestBucketWithTracing(t *testing.T) {
+	m := &basictracer.InMemorySpanRecorder{}
+	tr := basictracer.NewWithOptions(basictracer.Options{
+		ShouldSample: func(uint64) bool { return true },
+		Recorder:     m,
+	})
+	root, ctx := tracing.StartSpan(tracing.ContextWithTracer(context.Background(), tr), "series")
+
+	bkt := objstore.BucketWithTracing(inmem.NewBucket())
+	testutil.Ok(t, bkt.Upload(ctx, "dir/a", bytes.NewReader([]byte("0123456789"))))
+
+	rc, err := bkt.GetRange(ctx, "dir/a", 2, 3)
+	testutil.Ok(t, err)
+	_, err = ioutil.ReadAll(rc)
+	testutil.Ok(t, err)
+	// The span of a read ends only once the reader is closed.
+	testutil.Equals(t, 1, len(m.GetSpans()))
+	testutil.Ok(t, rc.Close())
+	testutil.Ok(t, rc.Close())
+
+	_, err = bkt.Get(ctx, "dir/missing")
+	testutil.NotOk(t, err)
+	testutil.Ok(t, bkt.Iter(ctx, "dir", func(string) error { return nil }))
+	root.Finish()
+
+	spans := m.GetSpans()
+	testutil.Equals(t, 5, len(spans))
+	for _, s := range spans[:4] {
+		testutil.Equals(t, root.Context().(basictracer.SpanContext).SpanID, s.ParentSpanID)
+	}
+
+	testutil.Equals(t, "bucket_upload", spans[0].Operation)
+	testutil.Equals(t, "dir/a", spans[0].Tags["name"])
+	testutil.Equals(t, int64(10), spans[0].Tags["bytes"])
+
+	testutil.Equals(t, "bucket_get_range", spans[1].Operation)
+	testutil.Equals(t, int64(3), spans[1].Tags["bytes"])
+	testutil.Equals(t, nil, spans[1].Tags["error"])
+
+	testutil.Equals(t, "bucket_get", spans[2].Operation)
+	testutil.Equals(t, true, spans[2].Tags["error"])
+
+	testutil.Equals(t, "bucket_iter", spans[3].Operation)
+	testutil.Equals(t, 1, spans[3].Tags["entries"])
+}
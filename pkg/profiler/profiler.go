@@ -0,0 +1,236 @@
+// Package profiler captures pprof profiles on demand or when heap usage exceeds a threshold and
+// optionally uploads them to the object storage, so profiles of components killed for running out
+// of memory are available for post-mortem analysis.
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/runutil"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DebugProfiles is a directory in the bucket profiles are uploaded to.
+	DebugProfiles = "debug/profiles"
+
+	// KindCPU is the kind of CPU profiles. All other kinds are looked up by their pprof name, e.g. "heap".
+	KindCPU = "cpu"
+
+	defaultCPUDuration = 30 * time.Second
+	maxCPUDuration     = 5 * time.Minute
+)
+
+// Profiler captures profiles. Only one capture runs at a time.
+type Profiler struct {
+	logger    log.Logger
+	bkt       objstore.Bucket
+	component string
+	hostname  string
+
+	mtx sync.Mutex
+
+	captures prometheus.Counter
+	failures prometheus.Counter
+	uploads  prometheus.Counter
+}
+
+// New returns a new Profiler. The bucket can be nil, in which case profiles cannot be uploaded.
+// The component is used as a prefix of names of uploaded profiles.
+func New(logger log.Logger, reg prometheus.Registerer, bkt objstore.Bucket, component string) *Profiler {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	p := &Profiler{
+		logger:    logger,
+		bkt:       bkt,
+		component: component,
+		hostname:  hostname,
+		captures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "thanos_profiler_captures_total",
+			Help: "Total number of captured profiles.",
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "thanos_profiler_capture_failures_total",
+			Help: "Total number of profiles that failed to be captured or uploaded.",
+		}),
+		uploads: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "thanos_profiler_uploads_total",
+			Help: "Total number of profiles uploaded to the object storage.",
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(p.captures, p.failures, p.uploads)
+	}
+	return p
+}
+
+// Capture returns a profile of the given kind in the gzipped protobuf format. CPU profiles
+// are recorded for the given duration, which is ignored for other kinds.
+func (p *Profiler) Capture(ctx context.Context, kind string, d time.Duration) ([]byte, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	b, err := capture(ctx, kind, d)
+	if err != nil {
+		p.failures.Inc()
+		return nil, err
+	}
+	p.captures.Inc()
+	return b, nil
+}
+
+// CaptureAndUpload captures a profile and uploads it to the bucket. It returns the name of the uploaded object.
+func (p *Profiler) CaptureAndUpload(ctx context.Context, kind string, d time.Duration) (string, error) {
+	if p.bkt == nil {
+		return "", errors.New("no bucket configured")
+	}
+	b, err := p.Capture(ctx, kind, d)
+	if err != nil {
+		return "", err
+	}
+
+	name := path.Join(DebugProfiles, fmt.Sprintf("%s-%s-%s-%s.pb.gz",
+		p.component, p.hostname, time.Now().UTC().Format("20060102T150405Z"), kind))
+	if err := p.bkt.Upload(ctx, name, bytes.NewReader(b)); err != nil {
+		p.failures.Inc()
+		return "", errors.Wrapf(err, "upload profile %s", name)
+	}
+	p.uploads.Inc()
+	level.Info(p.logger).Log("msg", "uploaded profile", "kind", kind, "object", name)
+	return name, nil
+}
+
+// WatchHeap checks heap usage at the given interval and uploads a heap profile whenever it exceeds
+// the threshold in bytes. At most one profile is uploaded per cooldown, so a process staying above
+// the threshold does not fill the bucket. It blocks until the context is canceled.
+func (p *Profiler) WatchHeap(ctx context.Context, interval time.Duration, threshold uint64, cooldown time.Duration) error {
+	var last time.Time
+	return runutil.Repeat(interval, ctx.Done(), func() error {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		if ms.HeapInuse < threshold || time.Since(last) < cooldown {
+			return nil
+		}
+		level.Warn(p.logger).Log("msg", "heap usage exceeds threshold, capturing heap profile", "heap_inuse_bytes", ms.HeapInuse, "threshold_bytes", threshold)
+
+		last = time.Now()
+		if _, err := p.CaptureAndUpload(ctx, "heap", 0); err != nil {
+			level.Error(p.logger).Log("msg", "capturing heap profile failed", "err", err)
+		}
+		return nil
+	})
+}
+
+// ServeHTTP captures a profile of the kind given by the "kind" query parameter, "heap" by default.
+// The duration of CPU profiles is given in the "seconds" parameter. If the "upload" parameter is true,
+// the profile is uploaded to the bucket and the name of the object is returned as JSON. Otherwise
+// the profile is returned in the response.
+func (p *Profiler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	kind := r.FormValue("kind")
+	if kind == "" {
+		kind = "heap"
+	}
+	d := defaultCPUDuration
+	if s := r.FormValue("seconds"); s != "" {
+		sec, err := strconv.Atoi(s)
+		if err != nil || sec <= 0 {
+			http.Error(w, fmt.Sprintf("invalid seconds parameter %q", s), http.StatusBadRequest)
+			return
+		}
+		d = time.Duration(sec) * time.Second
+	}
+	if d > maxCPUDuration {
+		http.Error(w, fmt.Sprintf("duration exceeds maximum of %s", maxCPUDuration), http.StatusBadRequest)
+		return
+	}
+	if kind != KindCPU && pprof.Lookup(kind) == nil {
+		http.Error(w, fmt.Sprintf("unknown profile kind %q", kind), http.StatusBadRequest)
+		return
+	}
+
+	upload, _ := strconv.ParseBool(r.FormValue("upload"))
+	if !upload {
+		b, err := p.Capture(r.Context(), kind, d)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pb.gz"`, kind))
+		w.Write(b)
+		return
+	}
+
+	if p.bkt == nil {
+		http.Error(w, "no bucket configured to upload profiles to", http.StatusBadRequest)
+		return
+	}
+	name, err := p.CaptureAndUpload(r.Context(), kind, d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Object string `json:"object"`
+	}{Object: name})
+}
+
+func capture(ctx context.Context, kind string, d time.Duration) ([]byte, error) {
+	var buf bytes.Buffer
+	if kind != KindCPU {
+		prof := pprof.Lookup(kind)
+		if prof == nil {
+			return nil, errors.Errorf("unknown profile kind %q", kind)
+		}
+		if kind == "heap" {
+			// Get up-to-date statistics of allocations.
+			runtime.GC()
+		}
+		if err := prof.WriteTo(&buf, 0); err != nil {
+			return nil, errors.Wrapf(err, "write %s profile", kind)
+		}
+		return buf.Bytes(), nil
+	}
+
+	// Fails if a CPU profile is already recorded, e.g. through /debug/pprof/profile.
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		return nil, errors.Wrap(err, "start CPU profile")
+	}
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+	pprof.StopCPUProfile()
+
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, "record CPU profile")
+	}
+	return buf.Bytes(), nil
+}
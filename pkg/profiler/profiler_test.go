@@ -0,0 +1,76 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+func TestProfiler_CaptureAndUpload(t *testing.T) {
+	bkt := inmem.NewBucket()
+	p := New(nil, nil, bkt, "store")
+
+	name, err := p.CaptureAndUpload(context.Background(), "heap", 0)
+	testutil.Ok(t, err)
+	testutil.Assert(t, strings.HasPrefix(name, DebugProfiles+"/store-"), "unexpected object name %s", name)
+	testutil.Assert(t, strings.HasSuffix(name, "-heap.pb.gz"), "unexpected object name %s", name)
+	testutil.Assert(t, len(bkt.Objects()[name]) > 0, "expected uploaded profile")
+
+	_, err = p.CaptureAndUpload(context.Background(), "unknown", 0)
+	testutil.NotOk(t, err)
+
+	_, err = New(nil, nil, nil, "store").CaptureAndUpload(context.Background(), "heap", 0)
+	testutil.NotOk(t, err)
+}
+
+func TestProfiler_CaptureCPU(t *testing.T) {
+	p := New(nil, nil, nil, "store")
+
+	b, err := p.Capture(context.Background(), KindCPU, 100*time.Millisecond)
+	testutil.Ok(t, err)
+	testutil.Assert(t, len(b) > 0, "expected CPU profile")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = p.Capture(ctx, KindCPU, time.Minute)
+	testutil.NotOk(t, err)
+}
+
+func TestProfiler_ServeHTTP(t *testing.T) {
+	bkt := inmem.NewBucket()
+	p := New(nil, nil, bkt, "store")
+
+	for _, tcase := range []struct {
+		method string
+		url    string
+		code   int
+	}{
+		{method: http.MethodGet, url: "/?kind=heap", code: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, url: "/?kind=unknown", code: http.StatusBadRequest},
+		{method: http.MethodPost, url: "/?kind=cpu&seconds=abc", code: http.StatusBadRequest},
+		{method: http.MethodPost, url: "/?kind=cpu&seconds=3600", code: http.StatusBadRequest},
+		{method: http.MethodPost, url: "/?kind=goroutine", code: http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(tcase.method, tcase.url, nil))
+		testutil.Equals(t, tcase.code, rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/?kind=heap&upload=true", nil))
+	testutil.Equals(t, http.StatusOK, rec.Code)
+
+	var res struct {
+		Object string `json:"object"`
+	}
+	testutil.Ok(t, json.NewDecoder(rec.Body).Decode(&res))
+	_, ok := bkt.Objects()[res.Object]
+	testutil.Assert(t, ok, "expected uploaded profile %s", res.Object)
+}
@@ -0,0 +1,423 @@
+// Package promclient offers typed and instrumented helpers for the Prometheus HTTP APIs used by Thanos components.
+package promclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	thanostls "github.com/improbable-eng/thanos/pkg/tls"
+	"github.com/improbable-eng/thanos/pkg/tracing"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	promlabels "github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/tsdb/labels"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+)
+
+// Config configures TLS, authentication and retries of the client.
+type Config struct {
+	TLSCAFile             string
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSServerName         string
+	TLSInsecureSkipVerify bool
+
+	BasicAuthUsername     string
+	BasicAuthPasswordFile string
+
+	// MaxRetries is the number of times failed requests are retried. Requests are retried on
+	// connection errors and server side errors only.
+	MaxRetries int
+	// RetryInterval is the time waited before the first retry. It doubles with every retry.
+	RetryInterval time.Duration
+}
+
+// RegisterFlags registers flags of the client, e.g. --prometheus.tls-ca for the "prometheus" prefix,
+// and returns an initialized Config.
+func RegisterFlags(cmd *kingpin.CmdClause, prefix string) *Config {
+	var c Config
+
+	cmd.Flag(prefix+".tls-ca", "TLS CA certificates to verify the HTTPS server. If empty, the system CA certificates are used.").
+		Default("").StringVar(&c.TLSCAFile)
+	cmd.Flag(prefix+".tls-cert", "TLS certificate to identify this client to the HTTPS server.").
+		Default("").StringVar(&c.TLSCertFile)
+	cmd.Flag(prefix+".tls-key", "TLS key for the client's certificate.").
+		Default("").StringVar(&c.TLSKeyFile)
+	cmd.Flag(prefix+".tls-server-name", "Server name to verify the hostname of the HTTPS server certificate.").
+		Default("").StringVar(&c.TLSServerName)
+	cmd.Flag(prefix+".tls-insecure-skip-verify", "Do not verify the certificate of the HTTPS server.").
+		Default("false").BoolVar(&c.TLSInsecureSkipVerify)
+	cmd.Flag(prefix+".basic-auth-username", "Username for basic authentication against the HTTP server.").
+		Default("").StringVar(&c.BasicAuthUsername)
+	cmd.Flag(prefix+".basic-auth-password-file", "File holding the password for basic authentication against the HTTP server.").
+		Default("").StringVar(&c.BasicAuthPasswordFile)
+	cmd.Flag(prefix+".max-retries", "Number of times failed HTTP requests are retried.").
+		Default("2").IntVar(&c.MaxRetries)
+
+	c.RetryInterval = time.Second
+	return &c
+}
+
+// Client talks to the HTTP APIs of Prometheus and compatible servers, e.g. Thanos query.
+type Client struct {
+	logger     log.Logger
+	httpClient *http.Client
+
+	maxRetries    int
+	retryInterval time.Duration
+
+	duration *prometheus.HistogramVec
+	failures *prometheus.CounterVec
+}
+
+// NewClient returns a new Client. The name distinguishes metrics of clients in the same process.
+// The config can be nil, in which case plain HTTP without authentication and retries is used.
+func NewClient(logger log.Logger, reg prometheus.Registerer, name string, cfg *Config) (*Client, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if cfg.TLSCAFile != "" || cfg.TLSCertFile != "" || cfg.TLSServerName != "" || cfg.TLSInsecureSkipVerify {
+		tlsCfg, err := thanostls.NewClientConfig(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSCAFile, cfg.TLSServerName, cfg.TLSInsecureSkipVerify)
+		if err != nil {
+			return nil, errors.Wrap(err, "create TLS config")
+		}
+		transport.TLSClientConfig = tlsCfg
+	}
+
+	var rt http.RoundTripper = transport
+	if cfg.BasicAuthUsername != "" {
+		var password string
+		if cfg.BasicAuthPasswordFile != "" {
+			b, err := ioutil.ReadFile(cfg.BasicAuthPasswordFile)
+			if err != nil {
+				return nil, errors.Wrapf(err, "read basic auth password file %s", cfg.BasicAuthPasswordFile)
+			}
+			password = strings.TrimSpace(string(b))
+		}
+		rt = &basicAuthRoundTripper{username: cfg.BasicAuthUsername, password: password, next: rt}
+	}
+
+	c := &Client{
+		logger:        logger,
+		httpClient:    &http.Client{Transport: tracing.HTTPTripperware(logger, rt)},
+		maxRetries:    cfg.MaxRetries,
+		retryInterval: cfg.RetryInterval,
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "thanos_promclient_request_duration_seconds",
+			Help:        "Duration of requests against Prometheus HTTP APIs including retries.",
+			ConstLabels: prometheus.Labels{"client": name},
+			Buckets:     []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 15, 30, 60},
+		}, []string{"api"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "thanos_promclient_request_failures_total",
+			Help:        "Total number of failed requests against Prometheus HTTP APIs.",
+			ConstLabels: prometheus.Labels{"client": name},
+		}, []string{"api"}),
+	}
+	if c.retryInterval <= 0 {
+		c.retryInterval = time.Second
+	}
+	if reg != nil {
+		reg.MustRegister(c.duration, c.failures)
+	}
+	return c, nil
+}
+
+// HTTPClient returns the underlying HTTP client, which carries the TLS and authentication settings.
+func (c *Client) HTTPClient() *http.Client {
+	return c.httpClient
+}
+
+type basicAuthRoundTripper struct {
+	username string
+	password string
+	next     http.RoundTripper
+}
+
+func (rt *basicAuthRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	// Requests must not be modified by round trippers.
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.Header = make(http.Header, len(r.Header))
+	for k, v := range r.Header {
+		r2.Header[k] = v
+	}
+	r2.SetBasicAuth(rt.username, rt.password)
+	return rt.next.RoundTrip(r2)
+}
+
+// apiResponse is the envelope of all Prometheus HTTP API responses.
+type apiResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+}
+
+// retryableError marks errors after which the request can be retried.
+type retryableError struct {
+	error
+}
+
+// do calls the API endpoint and decodes the data of the response into v. GET requests are retried.
+func (c *Client) do(ctx context.Context, api, method string, base *url.URL, endpoint string, params url.Values, v interface{}) (err error) {
+	span, ctx := tracing.StartSpan(ctx, fmt.Sprintf("/prom_%s HTTP[client]", api))
+	defer span.Finish()
+
+	begin := time.Now()
+	defer func() {
+		c.duration.WithLabelValues(api).Observe(time.Since(begin).Seconds())
+		if err != nil {
+			c.failures.WithLabelValues(api).Inc()
+		}
+	}()
+
+	u := *base
+	u.Path = path.Join(u.Path, endpoint)
+	u.RawQuery = params.Encode()
+
+	retries := c.maxRetries
+	if method != http.MethodGet {
+		retries = 0
+	}
+	interval := c.retryInterval
+	for i := 0; ; i++ {
+		err = c.doOnce(ctx, method, u.String(), v)
+		if _, ok := err.(retryableError); !ok || i >= retries {
+			break
+		}
+		level.Debug(c.logger).Log("msg", "request failed, retrying", "url", u.String(), "err", err)
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "request %s", u.String())
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+	if e, ok := err.(retryableError); ok {
+		return e.error
+	}
+	return err
+}
+
+func (c *Client) doOnce(ctx context.Context, method, u string, v interface{}) error {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return errors.Wrapf(err, "request %s", u)
+		}
+		return retryableError{errors.Wrapf(err, "request %s", u)}
+	}
+	defer func() {
+		// Drain the body so the connection can be reused.
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	var r apiResponse
+	if decErr := json.NewDecoder(resp.Body).Decode(&r); decErr != nil || r.Status == "" {
+		err = errors.Errorf("request %s: unexpected response with status code %d", u, resp.StatusCode)
+	} else if r.Status != "success" {
+		err = errors.Errorf("request %s: %s: %s", u, r.ErrorType, r.Error)
+	}
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		if err == nil {
+			err = errors.Errorf("request %s: status code %d", u, resp.StatusCode)
+		}
+		return retryableError{err}
+	}
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("request %s: status code %d", u, resp.StatusCode)
+	}
+
+	if v == nil {
+		return nil
+	}
+	if err := json.Unmarshal(r.Data, v); err != nil {
+		return errors.Wrapf(err, "decode response of %s", u)
+	}
+	return nil
+}
+
+// Config returns the YAML configuration the Prometheus server is running with.
+func (c *Client) Config(ctx context.Context, base *url.URL) (string, error) {
+	var d struct {
+		YAML string `json:"yaml"`
+	}
+	if err := c.do(ctx, "config", http.MethodGet, base, "/api/v1/status/config", nil, &d); err != nil {
+		return "", err
+	}
+	return d.YAML, nil
+}
+
+// ExternalLabels returns the external labels configured on the Prometheus server.
+func (c *Client) ExternalLabels(ctx context.Context, base *url.URL) (labels.Labels, error) {
+	y, err := c.Config(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Global struct {
+			ExternalLabels map[string]string `yaml:"external_labels"`
+		} `yaml:"global"`
+	}
+	if err := yaml.Unmarshal([]byte(y), &cfg); err != nil {
+		return nil, errors.Wrap(err, "parse Prometheus config")
+	}
+	return labels.FromMap(cfg.Global.ExternalLabels), nil
+}
+
+// Snapshot creates a snapshot of the TSDB of the Prometheus server and returns the name of its directory
+// inside the snapshots directory of the Prometheus data directory. The admin APIs of Prometheus
+// have to be enabled.
+func (c *Client) Snapshot(ctx context.Context, base *url.URL, skipHead bool) (string, error) {
+	params := url.Values{}
+	params.Add("skip_head", strconv.FormatBool(skipHead))
+
+	var d struct {
+		Name string `json:"name"`
+	}
+	if err := c.do(ctx, "snapshot", http.MethodPost, base, "/api/v1/admin/tsdb/snapshot", params, &d); err != nil {
+		return "", err
+	}
+	return d.Name, nil
+}
+
+// QueryOptions are optional parameters of queries.
+type QueryOptions struct {
+	// Deduplicate enables deduplication of replicated series by Thanos query.
+	Deduplicate bool
+}
+
+// QueryInstant evaluates the instant query at the given time. Only queries returning
+// a vector are supported.
+func (c *Client) QueryInstant(ctx context.Context, base *url.URL, query string, t time.Time, opts QueryOptions) (promql.Vector, error) {
+	params := url.Values{}
+	params.Add("query", query)
+	params.Add("time", t.Format(time.RFC3339Nano))
+	// Thanos query deduplicates by default, so the parameter is always set. Prometheus ignores it.
+	params.Add("dedup", strconv.FormatBool(opts.Deduplicate))
+
+	var d struct {
+		ResultType string       `json:"resultType"`
+		Result     model.Vector `json:"result"`
+	}
+	if err := c.do(ctx, "query", http.MethodGet, base, "/api/v1/query", params, &d); err != nil {
+		return nil, err
+	}
+	if d.ResultType != string(model.ValVector) {
+		return nil, errors.Errorf("unsupported result type %q of query %q", d.ResultType, query)
+	}
+
+	vec := make(promql.Vector, 0, len(d.Result))
+	for _, e := range d.Result {
+		lset := make(promlabels.Labels, 0, len(e.Metric))
+		for k, v := range e.Metric {
+			lset = append(lset, promlabels.Label{
+				Name:  string(k),
+				Value: string(v),
+			})
+		}
+		sort.Sort(lset)
+
+		vec = append(vec, promql.Sample{
+			Metric: lset,
+			Point:  promql.Point{T: int64(e.Timestamp), V: float64(e.Value)},
+		})
+	}
+	return vec, nil
+}
+
+// RuleGroup is a group of recording and alerting rules.
+type RuleGroup struct {
+	Name     string  `json:"name"`
+	File     string  `json:"file"`
+	Interval float64 `json:"interval"`
+	Rules    []Rule  `json:"rules"`
+}
+
+// Rule is a recording or alerting rule. Type is either "recording" or "alerting".
+type Rule struct {
+	Type        string            `json:"type"`
+	Name        string            `json:"name"`
+	Query       string            `json:"query"`
+	Duration    float64           `json:"duration"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	Health      string            `json:"health"`
+	LastError   string            `json:"lastError"`
+}
+
+// Rules returns the rule groups loaded by the server.
+func (c *Client) Rules(ctx context.Context, base *url.URL) ([]RuleGroup, error) {
+	var d struct {
+		Groups []RuleGroup `json:"groups"`
+	}
+	if err := c.do(ctx, "rules", http.MethodGet, base, "/api/v1/rules", nil, &d); err != nil {
+		return nil, err
+	}
+	return d.Groups, nil
+}
+
+// ActiveTarget is a target currently scraped by the server.
+type ActiveTarget struct {
+	DiscoveredLabels map[string]string `json:"discoveredLabels"`
+	Labels           map[string]string `json:"labels"`
+	ScrapeURL        string            `json:"scrapeUrl"`
+	LastError        string            `json:"lastError"`
+	LastScrape       time.Time         `json:"lastScrape"`
+	Health           string            `json:"health"`
+}
+
+// DroppedTarget is a discovered target dropped by relabeling.
+type DroppedTarget struct {
+	DiscoveredLabels map[string]string `json:"discoveredLabels"`
+}
+
+// TargetDiscovery holds active and dropped targets of the server.
+type TargetDiscovery struct {
+	ActiveTargets  []ActiveTarget  `json:"activeTargets"`
+	DroppedTargets []DroppedTarget `json:"droppedTargets"`
+}
+
+// Targets returns the active and dropped scrape targets of the server.
+func (c *Client) Targets(ctx context.Context, base *url.URL) (*TargetDiscovery, error) {
+	var d TargetDiscovery
+	if err := c.do(ctx, "targets", http.MethodGet, base, "/api/v1/targets", nil, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
@@ -0,0 +1,138 @@
+package promclient
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/prometheus/tsdb/labels"
+)
+
+func newTestServer(t *testing.T, h http.HandlerFunc) (*httptest.Server, *url.URL) {
+	srv := httptest.NewServer(h)
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+	return srv, u
+}
+
+func TestClient_ExternalLabels(t *testing.T) {
+	srv, u := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, "/api/v1/status/config", r.URL.Path)
+		fmt.Fprint(w, `{"status":"success","data":{"yaml":"global:\n  external_labels:\n    region: eu\n    replica: a\n"}}`)
+	})
+	defer srv.Close()
+
+	c, err := NewClient(nil, nil, "test", nil)
+	testutil.Ok(t, err)
+
+	lset, err := c.ExternalLabels(context.Background(), u)
+	testutil.Ok(t, err)
+	testutil.Equals(t, labels.FromStrings("region", "eu", "replica", "a"), lset)
+}
+
+func TestClient_Snapshot(t *testing.T) {
+	srv, u := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, http.MethodPost, r.Method)
+		testutil.Equals(t, "/api/v1/admin/tsdb/snapshot", r.URL.Path)
+		testutil.Equals(t, "true", r.URL.Query().Get("skip_head"))
+		fmt.Fprint(w, `{"status":"success","data":{"name":"20180101T000000Z-abcdef"}}`)
+	})
+	defer srv.Close()
+
+	c, err := NewClient(nil, nil, "test", nil)
+	testutil.Ok(t, err)
+
+	name, err := c.Snapshot(context.Background(), u, true)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "20180101T000000Z-abcdef", name)
+}
+
+func TestClient_QueryInstant(t *testing.T) {
+	srv, u := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		testutil.Equals(t, "/api/v1/query", r.URL.Path)
+		testutil.Equals(t, "up", r.URL.Query().Get("query"))
+		testutil.Equals(t, "true", r.URL.Query().Get("dedup"))
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"job":"a","__name__":"up"},"value":[10,"1"]}]}}`)
+	})
+	defer srv.Close()
+
+	c, err := NewClient(nil, nil, "test", nil)
+	testutil.Ok(t, err)
+
+	vec, err := c.QueryInstant(context.Background(), u, "up", time.Unix(10, 0), QueryOptions{Deduplicate: true})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(vec))
+	testutil.Equals(t, "{__name__=\"up\", job=\"a\"}", vec[0].Metric.String())
+	testutil.Equals(t, int64(10000), vec[0].T)
+	testutil.Equals(t, float64(1), vec[0].V)
+}
+
+func TestClient_Errors(t *testing.T) {
+	srv, u := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"invalid query"}`)
+	})
+	defer srv.Close()
+
+	calls := 0
+	retrySrv, retryURL := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer retrySrv.Close()
+
+	c, err := NewClient(nil, nil, "test", &Config{MaxRetries: 2, RetryInterval: time.Millisecond})
+	testutil.Ok(t, err)
+
+	// Client errors are not retried.
+	_, err = c.Rules(context.Background(), u)
+	testutil.NotOk(t, err)
+
+	_, err = c.Targets(context.Background(), retryURL)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, 3, calls)
+
+	// Snapshots are not retried as every request creates a new snapshot.
+	calls = 0
+	_, err = c.Snapshot(context.Background(), retryURL, false)
+	testutil.NotOk(t, err)
+	testutil.Equals(t, 1, calls)
+}
+
+func TestClient_BasicAuth(t *testing.T) {
+	srv, u := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "thanos" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"status":"success","data":{"groups":[{"name":"a","file":"a.yaml","rules":[{"type":"recording","name":"r","query":"up"}]}]}}`)
+	})
+	defer srv.Close()
+
+	f, err := ioutil.TempFile("", "password")
+	testutil.Ok(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("secret\n")
+	testutil.Ok(t, err)
+	testutil.Ok(t, f.Close())
+
+	c, err := NewClient(nil, nil, "test", &Config{BasicAuthUsername: "thanos", BasicAuthPasswordFile: f.Name()})
+	testutil.Ok(t, err)
+
+	groups, err := c.Rules(context.Background(), u)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []RuleGroup{{Name: "a", File: "a.yaml", Rules: []Rule{{Type: "recording", Name: "r", Query: "up"}}}}, groups)
+
+	c, err = NewClient(nil, nil, "test", nil)
+	testutil.Ok(t, err)
+	_, err = c.Rules(context.Background(), u)
+	testutil.NotOk(t, err)
+}
@@ -20,7 +20,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math"
+	"net"
 	"net/http"
 	"strconv"
 	"sync"
@@ -29,7 +31,9 @@ import (
 	"github.com/NYTimes/gziphandler"
 
 	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/gate"
 	"github.com/improbable-eng/thanos/pkg/query"
+	"github.com/improbable-eng/thanos/pkg/ratelimit"
 	"github.com/improbable-eng/thanos/pkg/tracing"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
@@ -52,17 +56,22 @@ const (
 type errorType string
 
 const (
-	errorNone     errorType = ""
-	errorTimeout            = "timeout"
-	errorCanceled           = "canceled"
-	errorExec               = "execution"
-	errorBadData            = "bad_data"
-	errorInternal           = "internal"
+	errorNone            errorType = ""
+	errorTimeout                   = "timeout"
+	errorCanceled                  = "canceled"
+	errorExec                      = "execution"
+	errorBadData                   = "bad_data"
+	errorInternal                  = "internal"
+	errorLimit                     = "limit_exceeded"
+	errorTooManyRequests           = "too_many_requests"
 )
 
+// DefaultTenant is the tenant of requests without the tenant header.
+const DefaultTenant = "default-tenant"
+
 var corsHeaders = map[string]string{
 	"Access-Control-Allow-Headers":  "Accept, Accept-Encoding, Authorization, Content-Type, Origin",
-	"Access-Control-Allow-Methods":  "GET, OPTIONS",
+	"Access-Control-Allow-Methods":  "GET, POST, OPTIONS",
 	"Access-Control-Allow-Origin":   "*",
 	"Access-Control-Expose-Headers": "Date",
 }
@@ -93,23 +102,50 @@ func setCORS(w http.ResponseWriter) {
 
 type apiFunc func(r *http.Request) (interface{}, []error, *apiError)
 
+// Limits are limits of single requests. Zero values disable the respective limit.
+type Limits struct {
+	// MaxSamples is the maximum number of samples a request may fetch from the stores.
+	MaxSamples int
+	// MaxSeries is the maximum number of series in the result of a request.
+	MaxSeries int
+	// MaxBodyBytes is the maximum size of request bodies.
+	MaxBodyBytes int64
+
+	// RateLimit is the number of requests per second allowed for a single client, with bursts of up to
+	// RateBurst requests.
+	RateLimit float64
+	RateBurst int
+	// ClientHeader is the request header identifying the client for rate limiting. The remote address
+	// is used if it is empty or the header is missing.
+	ClientHeader string
+}
+
 // API can register a set of endpoints in a router and handle
 // them using the provided storage and query engine.
 type API struct {
 	queryableCreate query.QueryableCreator
 	queryEngine     *promql.Engine
+	tenantGate      *gate.Keyed
+	tenantHeader    string
+	limits          Limits
+	rateLimiter     *ratelimit.Keyed
 
 	instantQueryDuration prometheus.Histogram
 	rangeQueryDuration   prometheus.Histogram
+	limitHits            *prometheus.CounterVec
 
 	now func() time.Time
 }
 
-// NewAPI returns an initialized API type.
+// NewAPI returns an initialized API type. The tenant gate limits the number of concurrent queries of a single tenant,
+// which is taken from the given request header. The tenant gate can be nil. Requests exceeding the limits are rejected.
 func NewAPI(
 	reg *prometheus.Registry,
 	qe *promql.Engine,
 	c query.QueryableCreator,
+	tenantGate *gate.Keyed,
+	tenantHeader string,
+	limits Limits,
 ) *API {
 	instantQueryDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
 		Name: "thanos_query_api_instant_query_duration_seconds",
@@ -126,15 +162,26 @@ func NewAPI(
 		},
 	})
 
+	limitHits := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_query_api_limit_hits_total",
+		Help: "Total number of requests rejected because they exceeded a limit.",
+	}, []string{"limit"})
+
 	reg.MustRegister(
 		instantQueryDuration,
 		rangeQueryDuration,
+		limitHits,
 	)
 	return &API{
 		queryEngine:          qe,
 		queryableCreate:      c,
+		tenantGate:           tenantGate,
+		tenantHeader:         tenantHeader,
+		limits:               limits,
+		rateLimiter:          ratelimit.NewKeyed(limits.RateLimit, limits.RateBurst),
 		instantQueryDuration: instantQueryDuration,
 		rangeQueryDuration:   rangeQueryDuration,
+		limitHits:            limitHits,
 		now:                  time.Now,
 	}
 }
@@ -144,6 +191,10 @@ func (api *API) Register(r *route.Router, tracer opentracing.Tracer, logger log.
 	instr := func(name string, f apiFunc) http.HandlerFunc {
 		hf := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			setCORS(w)
+			if err := api.checkRequest(w, r); err != nil {
+				respondError(w, err, nil)
+				return
+			}
 			if data, warnings, err := f(r); err != nil {
 				respondError(w, err, data)
 			} else if data != nil {
@@ -158,11 +209,114 @@ func (api *API) Register(r *route.Router, tracer opentracing.Tracer, logger log.
 	r.Options("/*path", instr("options", api.options))
 
 	r.Get("/query", instr("query", api.query))
+	r.Post("/query", instr("query", api.query))
 	r.Get("/query_range", instr("query_range", api.queryRange))
+	r.Post("/query_range", instr("query_range", api.queryRange))
 
 	r.Get("/label/:name/values", instr("label_values", api.labelValues))
 
 	r.Get("/series", instr("series", api.series))
+	r.Post("/series", instr("series", api.series))
+}
+
+// Limit names used in metrics.
+const (
+	limitSamples  = "samples"
+	limitSeries   = "series"
+	limitBodySize = "body_size"
+	limitRate     = "rate"
+)
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// checkRequest rejects requests of clients exceeding the rate limit and requests with too large bodies.
+// Form values of the request are parsed.
+func (api *API) checkRequest(w http.ResponseWriter, r *http.Request) *apiError {
+	if api.rateLimiter != nil {
+		client := ""
+		if api.limits.ClientHeader != "" {
+			client = r.Header.Get(api.limits.ClientHeader)
+		}
+		if client == "" {
+			client = r.RemoteAddr
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				client = host
+			}
+		}
+		if ok, retryAfter := api.rateLimiter.Allow(client); !ok {
+			api.limitHits.WithLabelValues(limitRate).Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			return &apiError{errorTooManyRequests, errors.Errorf("rate limit of %v requests per second exceeded by client %s", api.limits.RateLimit, client)}
+		}
+	}
+
+	if max := api.limits.MaxBodyBytes; max > 0 {
+		if r.ContentLength > max {
+			api.limitHits.WithLabelValues(limitBodySize).Inc()
+			return &apiError{errorLimit, errors.Wrapf(errBodyTooLarge, "limit of %d bytes", max)}
+		}
+		r.Body = &maxBytesReader{ReadCloser: r.Body, n: max}
+	}
+	// Parse forms here so too large bodies of requests without content length are detected.
+	if err := r.ParseForm(); err != nil {
+		if errors.Cause(err) == errBodyTooLarge {
+			api.limitHits.WithLabelValues(limitBodySize).Inc()
+			return &apiError{errorLimit, errors.Wrapf(err, "limit of %d bytes", api.limits.MaxBodyBytes)}
+		}
+		return &apiError{errorBadData, errors.Wrap(err, "parse form")}
+	}
+	return nil
+}
+
+// maxBytesReader fails with errBodyTooLarge once more than n bytes are read.
+type maxBytesReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *maxBytesReader) Read(p []byte) (int, error) {
+	if r.n < 0 {
+		return 0, errBodyTooLarge
+	}
+	// Read one byte more than allowed to detect too large bodies.
+	if int64(len(p)) > r.n+1 {
+		p = p[:r.n+1]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.n -= int64(n)
+	if r.n < 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+// checkSeriesLimit returns an error if the number of series exceeds the limit.
+func (api *API) checkSeriesLimit(n int) *apiError {
+	if api.limits.MaxSeries <= 0 || n <= api.limits.MaxSeries {
+		return nil
+	}
+	api.limitHits.WithLabelValues(limitSeries).Inc()
+	return &apiError{errorLimit, errors.Errorf("result has more than the limit of %d series", api.limits.MaxSeries)}
+}
+
+// limitError converts errors of exceeded query limits, nil is returned for other errors.
+func (api *API) limitError(err error) *apiError {
+	if errors.Cause(err) != query.ErrSamplesLimitExceeded {
+		return nil
+	}
+	api.limitHits.WithLabelValues(limitSamples).Inc()
+	return &apiError{errorLimit, err}
+}
+
+// seriesCount returns the number of series in the query result.
+func seriesCount(v promql.Value) int {
+	switch v := v.(type) {
+	case promql.Vector:
+		return len(v)
+	case promql.Matrix:
+		return len(v)
+	}
+	return 1
 }
 
 type queryData struct {
@@ -199,6 +353,12 @@ func (api *API) query(r *http.Request) (interface{}, []error, *apiError) {
 		defer cancel()
 	}
 
+	done, apiErr := api.startTenantQuery(ctx, r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	defer done()
+
 	var (
 		warnmtx             sync.Mutex
 		warnings            []error
@@ -224,13 +384,16 @@ func (api *API) query(r *http.Request) (interface{}, []error, *apiError) {
 	defer span.Finish()
 
 	begin := api.now()
-	qry, err := api.queryEngine.NewInstantQuery(api.queryableCreate(enableDeduplication, partialErrReporter), r.FormValue("query"), ts)
+	qry, err := api.queryEngine.NewInstantQuery(api.queryableCreate(enableDeduplication, api.limits.MaxSamples, partialErrReporter), r.FormValue("query"), ts)
 	if err != nil {
 		return nil, nil, &apiError{errorBadData, err}
 	}
 
 	res := qry.Exec(ctx)
 	if res.Err != nil {
+		if apiErr := api.limitError(res.Err); apiErr != nil {
+			return nil, nil, apiErr
+		}
 		switch res.Err.(type) {
 		case promql.ErrQueryCanceled:
 			return nil, nil, &apiError{errorCanceled, res.Err}
@@ -242,6 +405,9 @@ func (api *API) query(r *http.Request) (interface{}, []error, *apiError) {
 		return nil, nil, &apiError{errorExec, res.Err}
 	}
 	api.instantQueryDuration.Observe(time.Since(begin).Seconds())
+	if apiErr := api.checkSeriesLimit(seriesCount(res.Value)); apiErr != nil {
+		return nil, nil, apiErr
+	}
 
 	return &queryData{
 		ResultType: res.Value.Type(),
@@ -249,6 +415,22 @@ func (api *API) query(r *http.Request) (interface{}, []error, *apiError) {
 	}, warnings, nil
 }
 
+// startTenantQuery waits until the tenant of the request is allowed to run another query. The returned function
+// must be called once the query finished.
+func (api *API) startTenantQuery(ctx context.Context, r *http.Request) (func(), *apiError) {
+	if api.tenantGate == nil {
+		return func() {}, nil
+	}
+	tenant := r.Header.Get(api.tenantHeader)
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	if err := api.tenantGate.Start(ctx, tenant); err != nil {
+		return nil, &apiError{errorTimeout, errors.Wrapf(err, "wait for concurrency limit of tenant %s", tenant)}
+	}
+	return func() { api.tenantGate.Done(tenant) }, nil
+}
+
 func (api *API) queryRange(r *http.Request) (interface{}, []error, *apiError) {
 	start, err := parseTime(r.FormValue("start"))
 	if err != nil {
@@ -291,6 +473,12 @@ func (api *API) queryRange(r *http.Request) (interface{}, []error, *apiError) {
 		defer cancel()
 	}
 
+	done, apiErr := api.startTenantQuery(ctx, r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	defer done()
+
 	var (
 		warnmtx             sync.Mutex
 		warnings            []error
@@ -316,13 +504,16 @@ func (api *API) queryRange(r *http.Request) (interface{}, []error, *apiError) {
 	defer span.Finish()
 
 	begin := api.now()
-	qry, err := api.queryEngine.NewRangeQuery(api.queryableCreate(enableDeduplication, partialErrReporter), r.FormValue("query"), start, end, step)
+	qry, err := api.queryEngine.NewRangeQuery(api.queryableCreate(enableDeduplication, api.limits.MaxSamples, partialErrReporter), r.FormValue("query"), start, end, step)
 	if err != nil {
 		return nil, nil, &apiError{errorBadData, err}
 	}
 
 	res := qry.Exec(ctx)
 	if res.Err != nil {
+		if apiErr := api.limitError(res.Err); apiErr != nil {
+			return nil, nil, apiErr
+		}
 		switch res.Err.(type) {
 		case promql.ErrQueryCanceled:
 			return nil, nil, &apiError{errorCanceled, res.Err}
@@ -332,6 +523,9 @@ func (api *API) queryRange(r *http.Request) (interface{}, []error, *apiError) {
 		return nil, nil, &apiError{errorExec, res.Err}
 	}
 	api.rangeQueryDuration.Observe(time.Since(begin).Seconds())
+	if apiErr := api.checkSeriesLimit(seriesCount(res.Value)); apiErr != nil {
+		return nil, nil, apiErr
+	}
 
 	return &queryData{
 		ResultType: res.Value.Type(),
@@ -357,7 +551,7 @@ func (api *API) labelValues(r *http.Request) (interface{}, []error, *apiError) {
 		warnmtx.Unlock()
 	}
 
-	q, err := api.queryableCreate(true, partialErrReporter).Querier(ctx, math.MinInt64, math.MaxInt64)
+	q, err := api.queryableCreate(true, 0, partialErrReporter).Querier(ctx, math.MinInt64, math.MaxInt64)
 	if err != nil {
 		return nil, nil, &apiError{errorExec, err}
 	}
@@ -435,7 +629,7 @@ func (api *API) series(r *http.Request) (interface{}, []error, *apiError) {
 		}
 	}
 
-	q, err := api.queryableCreate(enableDeduplication, partialErrReporter).Querier(r.Context(), timestamp.FromTime(start), timestamp.FromTime(end))
+	q, err := api.queryableCreate(enableDeduplication, api.limits.MaxSamples, partialErrReporter).Querier(r.Context(), timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
 		return nil, nil, &apiError{errorExec, err}
 	}
@@ -445,6 +639,9 @@ func (api *API) series(r *http.Request) (interface{}, []error, *apiError) {
 	for _, mset := range matcherSets {
 		s, err := q.Select(&storage.SelectParams{}, mset...)
 		if err != nil {
+			if apiErr := api.limitError(err); apiErr != nil {
+				return nil, nil, apiErr
+			}
 			return nil, nil, &apiError{errorExec, err}
 		}
 		sets = append(sets, s)
@@ -454,6 +651,9 @@ func (api *API) series(r *http.Request) (interface{}, []error, *apiError) {
 	metrics := []labels.Labels{}
 	for set.Next() {
 		metrics = append(metrics, set.At().Labels())
+		if apiErr := api.checkSeriesLimit(len(metrics)); apiErr != nil {
+			return nil, nil, apiErr
+		}
 	}
 	if set.Err() != nil {
 		return nil, nil, &apiError{errorExec, set.Err()}
@@ -483,8 +683,10 @@ func respondError(w http.ResponseWriter, apiErr *apiError, data interface{}) {
 	switch apiErr.typ {
 	case errorBadData:
 		code = http.StatusBadRequest
-	case errorExec:
+	case errorExec, errorLimit:
 		code = 422
+	case errorTooManyRequests:
+		code = http.StatusTooManyRequests
 	case errorCanceled, errorTimeout:
 		code = http.StatusServiceUnavailable
 	case errorInternal:
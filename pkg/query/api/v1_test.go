@@ -24,13 +24,16 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/prometheus/common/route"
 
 	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/gate"
 	"github.com/improbable-eng/thanos/pkg/query"
+	"github.com/improbable-eng/thanos/pkg/ratelimit"
 	"github.com/improbable-eng/thanos/pkg/testutil"
 	"github.com/opentracing/opentracing-go"
 	"github.com/prometheus/client_golang/prometheus"
@@ -41,7 +44,7 @@ import (
 )
 
 func testQueryableCreator(queryable storage.Queryable) query.QueryableCreator {
-	return func(deduplicate bool, p query.PartialErrReporter) storage.Queryable {
+	return func(deduplicate bool, maxSamples int, p query.PartialErrReporter) storage.Queryable {
 		return queryable
 	}
 }
@@ -649,6 +652,167 @@ func TestOptionsMethod(t *testing.T) {
 	}
 }
 
+func TestStartTenantQuery(t *testing.T) {
+	api := &API{
+		tenantGate:   gate.NewKeyed(nil, "test", 1, 10*time.Millisecond),
+		tenantHeader: "THANOS-TENANT",
+	}
+	newRequest := func(tenant string) *http.Request {
+		r := httptest.NewRequest("GET", "/api/v1/query", nil)
+		if tenant != "" {
+			r.Header.Set("THANOS-TENANT", tenant)
+		}
+		return r
+	}
+	ctx := context.Background()
+
+	doneA, apiErr := api.startTenantQuery(ctx, newRequest("a"))
+	testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+
+	// Tenant a reached its limit, other tenants are not affected.
+	_, apiErr = api.startTenantQuery(ctx, newRequest("a"))
+	testutil.Assert(t, apiErr != nil && apiErr.typ == errorTimeout, "expected timeout error, got %v", apiErr)
+
+	doneB, apiErr := api.startTenantQuery(ctx, newRequest("b"))
+	testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+	doneDefault, apiErr := api.startTenantQuery(ctx, newRequest(""))
+	testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+
+	doneA()
+	doneA, apiErr = api.startTenantQuery(ctx, newRequest("a"))
+	testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+
+	doneA()
+	doneB()
+	doneDefault()
+}
+
+func TestLimits(t *testing.T) {
+	suite, err := promql.NewTest(t, `
+		load 1m
+			test_metric1{foo="bar"} 0+100x100
+			test_metric1{foo="boo"} 1+0x100
+	`)
+	testutil.Ok(t, err)
+	defer suite.Close()
+	testutil.Ok(t, suite.Run())
+
+	api := &API{
+		queryableCreate: testQueryableCreator(suite.Storage()),
+		queryEngine:     suite.QueryEngine(),
+		limits:          Limits{MaxSeries: 1},
+
+		instantQueryDuration: prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		rangeQueryDuration:   prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		limitHits:            prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"limit"}),
+
+		now: time.Now,
+	}
+
+	for _, tcase := range []struct {
+		endpoint apiFunc
+		query    url.Values
+		errType  errorType
+	}{
+		{
+			endpoint: api.query,
+			query:    url.Values{"query": []string{`test_metric1{foo="bar"}`}, "time": []string{"60"}},
+		},
+		{
+			endpoint: api.query,
+			query:    url.Values{"query": []string{"test_metric1"}, "time": []string{"60"}},
+			errType:  errorLimit,
+		},
+		{
+			endpoint: api.queryRange,
+			query:    url.Values{"query": []string{"test_metric1"}, "start": []string{"0"}, "end": []string{"60"}, "step": []string{"15"}},
+			errType:  errorLimit,
+		},
+		{
+			endpoint: api.series,
+			query:    url.Values{"match[]": []string{"test_metric1"}},
+			errType:  errorLimit,
+		},
+	} {
+		req := httptest.NewRequest("GET", "http://example.com?"+tcase.query.Encode(), nil)
+		_, _, apiErr := tcase.endpoint(req)
+		if tcase.errType == errorNone {
+			testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+			continue
+		}
+		testutil.Assert(t, apiErr != nil && apiErr.typ == tcase.errType, "expected %s error, got %v", tcase.errType, apiErr)
+	}
+
+	// Samples limit errors of the querier are limit errors of the API.
+	api.queryableCreate = testQueryableCreator(errQueryable{err: query.ErrSamplesLimitExceeded})
+	req := httptest.NewRequest("GET", "http://example.com?query=test_metric1", nil)
+	_, _, apiErr := api.query(req)
+	testutil.Assert(t, apiErr != nil && apiErr.typ == errorLimit, "expected limit error, got %v", apiErr)
+}
+
+type errQueryable struct {
+	storage.Querier
+	err error
+}
+
+func (q errQueryable) Querier(context.Context, int64, int64) (storage.Querier, error) {
+	return q, nil
+}
+
+func (q errQueryable) Select(*storage.SelectParams, ...*labels.Matcher) (storage.SeriesSet, error) {
+	return nil, q.err
+}
+
+func (q errQueryable) Close() error {
+	return nil
+}
+
+func TestCheckRequest(t *testing.T) {
+	r := route.New()
+	api := &API{
+		limits:      Limits{MaxBodyBytes: 10, RateLimit: 0.001, RateBurst: 2, ClientHeader: "X-Client"},
+		rateLimiter: ratelimit.NewKeyed(0.001, 2),
+		limitHits:   prometheus.NewCounterVec(prometheus.CounterOpts{}, []string{"limit"}),
+	}
+	api.Register(r, &opentracing.NoopTracer{}, log.NewNopLogger())
+
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	do := func(client, body string) (*http.Response, response) {
+		req, err := http.NewRequest("OPTIONS", s.URL+"/any_path", strings.NewReader(body))
+		testutil.Ok(t, err)
+		req.Header.Set("X-Client", client)
+
+		resp, err := http.DefaultClient.Do(req)
+		testutil.Ok(t, err)
+		defer resp.Body.Close()
+
+		var res response
+		if resp.StatusCode != http.StatusNoContent {
+			testutil.Ok(t, json.NewDecoder(resp.Body).Decode(&res))
+		}
+		return resp, res
+	}
+
+	resp, _ := do("a", "a=1")
+	testutil.Equals(t, http.StatusNoContent, resp.StatusCode)
+
+	// Too large bodies are rejected.
+	resp, res := do("a", "a=1234567890")
+	testutil.Equals(t, 422, resp.StatusCode)
+	testutil.Equals(t, errorType(errorLimit), res.ErrorType)
+
+	// The burst of client a is used up, other clients are not affected.
+	resp, res = do("a", "")
+	testutil.Equals(t, http.StatusTooManyRequests, resp.StatusCode)
+	testutil.Equals(t, errorType(errorTooManyRequests), res.ErrorType)
+	testutil.Assert(t, resp.Header.Get("Retry-After") != "", "missing Retry-After header")
+
+	resp, _ = do("b", "")
+	testutil.Equals(t, http.StatusNoContent, resp.StatusCode)
+}
+
 func BenchmarkQueryResultEncoding(b *testing.B) {
 	var mat promql.Matrix
 	for i := 0; i < 1000; i++ {
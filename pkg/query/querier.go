@@ -4,14 +4,16 @@ import (
 	"context"
 	"sort"
 	"strings"
+	"sync/atomic"
 
 	"github.com/go-kit/kit/log"
-
+	"github.com/go-kit/kit/log/level"
 	"github.com/improbable-eng/thanos/pkg/store/storepb"
 	"github.com/improbable-eng/thanos/pkg/tracing"
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/tsdb/chunkenc"
 )
 
 // PartialErrReporter allows to report partial errors. Partial error occurs when only part of the results are ready and
@@ -19,18 +21,23 @@ import (
 // NOTE: It is required to be thread-safe.
 type PartialErrReporter func(error)
 
+// ErrSamplesLimitExceeded is returned by queriers once more samples than allowed were fetched from the stores.
+var ErrSamplesLimitExceeded = errors.New("samples limit exceeded")
+
 // QueryableCreator returns implementation of promql.Queryable that fetches data from the proxy store API endpoints.
 // If deduplication is enabled, all data retrieved from it will be deduplicated along the replicaLabel by default.
-type QueryableCreator func(deduplicate bool, p PartialErrReporter) storage.Queryable
+// Each querier fetches at most maxSamples samples, a non-positive maxSamples disables the limit.
+type QueryableCreator func(deduplicate bool, maxSamples int, p PartialErrReporter) storage.Queryable
 
 // NewQueryableCreator creates QueryableCreator.
 func NewQueryableCreator(logger log.Logger, proxy storepb.StoreServer, replicaLabel string) QueryableCreator {
-	return func(deduplicate bool, p PartialErrReporter) storage.Queryable {
+	return func(deduplicate bool, maxSamples int, p PartialErrReporter) storage.Queryable {
 		return &queryable{
 			logger:           logger,
 			replicaLabel:     replicaLabel,
 			proxy:            proxy,
 			deduplicate:      deduplicate,
+			maxSamples:       maxSamples,
 			partialErrReport: p,
 		}
 	}
@@ -41,12 +48,15 @@ type queryable struct {
 	replicaLabel     string
 	proxy            storepb.StoreServer
 	deduplicate      bool
+	maxSamples       int
 	partialErrReport PartialErrReporter
 }
 
 // Querier returns a new storage querier against the underlying proxy store API.
 func (q *queryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
-	return newQuerier(ctx, q.logger, mint, maxt, q.replicaLabel, q.proxy, q.deduplicate, q.partialErrReport), nil
+	qr := newQuerier(ctx, q.logger, mint, maxt, q.replicaLabel, q.proxy, q.deduplicate, q.partialErrReport)
+	qr.maxSamples = q.maxSamples
+	return qr, nil
 }
 
 type querier struct {
@@ -58,6 +68,10 @@ type querier struct {
 	proxy            storepb.StoreServer
 	deduplicate      bool
 	partialErrReport PartialErrReporter
+
+	// Number of samples fetched by all selects and its limit.
+	samples    int64
+	maxSamples int
 }
 
 // newQuerier creates implementation of storage.Querier that fetches data from the proxy
@@ -98,13 +112,24 @@ func (q *querier) isDedupEnabled() bool {
 type seriesServer struct {
 	// This field just exist to pseudo-implement the unused methods of the interface.
 	storepb.Store_SeriesServer
-	ctx context.Context
+	ctx    context.Context
+	cancel func()
+
+	// samples counts the fetched samples, shared by all selects of a querier. Once more than maxSamples
+	// samples were fetched, the request is canceled and limitErr is set.
+	samples    *int64
+	maxSamples int
+	limitErr   error
 
 	seriesSet []storepb.Series
 	warnings  []string
 }
 
 func (s *seriesServer) Send(r *storepb.SeriesResponse) error {
+	// Drain the remaining responses of a canceled request. Failing would block the sending proxy.
+	if s.limitErr != nil {
+		return nil
+	}
 	if r.GetWarning() != "" {
 		s.warnings = append(s.warnings, r.GetWarning())
 		return nil
@@ -113,10 +138,35 @@ func (s *seriesServer) Send(r *storepb.SeriesResponse) error {
 	if r.GetSeries() == nil {
 		return errors.New("no seriesSet")
 	}
+	if s.maxSamples > 0 {
+		if n := atomic.AddInt64(s.samples, int64(seriesSamples(r.GetSeries()))); n > int64(s.maxSamples) {
+			s.limitErr = errors.Wrapf(ErrSamplesLimitExceeded, "more than %d samples fetched", s.maxSamples)
+			s.seriesSet = nil
+			s.cancel()
+			return nil
+		}
+	}
 	s.seriesSet = append(s.seriesSet, *r.GetSeries())
 	return nil
 }
 
+// seriesSamples returns the number of samples in the chunks of the series. Only one aggregate
+// of downsampled chunks is counted.
+func seriesSamples(s *storepb.Series) (n int) {
+	for _, c := range s.Chunks {
+		for _, x := range []*storepb.Chunk{c.Raw, c.Count, c.Sum, c.Min, c.Max, c.Counter} {
+			if x == nil {
+				continue
+			}
+			if chk, err := chunkenc.FromData(chunkEncoding(x.Type), x.Data); err == nil {
+				n += chk.NumSamples()
+			}
+			break
+		}
+	}
+	return n
+}
+
 func (s *seriesServer) Context() context.Context {
 	return s.ctx
 }
@@ -165,20 +215,34 @@ func (q *querier) Select(params *storage.SelectParams, ms ...*labels.Matcher) (s
 
 	queryAggrs, resAggr := aggrsFromFunc(params.Func)
 
-	resp := &seriesServer{ctx: ctx}
-	if err := q.proxy.Series(&storepb.SeriesRequest{
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resp := &seriesServer{
+		ctx:        ctx,
+		cancel:     cancel,
+		samples:    &q.samples,
+		maxSamples: q.maxSamples,
+	}
+	err = q.proxy.Series(&storepb.SeriesRequest{
 		MinTime:             q.mint,
 		MaxTime:             q.maxt,
 		Matchers:            sms,
 		MaxResolutionWindow: params.Step / 5, // Fit at least 5 samples between steps.
 		Aggregates:          queryAggrs,
-	}, resp); err != nil {
+	}, resp)
+	if resp.limitErr != nil {
+		return nil, resp.limitErr
+	}
+	if err != nil {
 		return nil, errors.Wrap(err, "proxy Series()")
 	}
 
 	for _, w := range resp.warnings {
 		q.partialErrReport(errors.New(w))
 	}
+	level.Debug(tracing.LoggerWithTraceID(ctx, q.logger)).Log("msg", "select processed",
+		"series", len(resp.seriesSet), "warnings", len(resp.warnings))
 
 	if !q.isDedupEnabled() {
 		// Return data without any deduplication.
@@ -74,6 +74,34 @@ func TestQuerier_Series(t *testing.T) {
 	testutil.Equals(t, len(expected), i)
 }
 
+func TestQuerier_SeriesSamplesLimit(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	testProxy := &storeServer{
+		resps: []*storepb.SeriesResponse{
+			storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{0, 0}, {2, 1}, {3, 2}}),
+			storeSeriesResponse(t, labels.FromStrings("a", "b"), []sample{{2, 2}, {3, 3}, {4, 4}}, []sample{{1, 1}, {2, 2}, {3, 3}}),
+		},
+	}
+
+	// All 9 samples are within the limit.
+	q := newQuerier(context.Background(), nil, 1, 300, "", testProxy, false, nil)
+	q.maxSamples = 9
+	_, err := q.Select(&storage.SelectParams{})
+	testutil.Ok(t, err)
+
+	// The limit applies to all selects of the querier.
+	_, err = q.Select(&storage.SelectParams{})
+	testutil.Equals(t, ErrSamplesLimitExceeded, errors.Cause(err))
+	testutil.Ok(t, q.Close())
+
+	q = newQuerier(context.Background(), nil, 1, 300, "", testProxy, false, nil)
+	q.maxSamples = 8
+	_, err = q.Select(&storage.SelectParams{})
+	testutil.Equals(t, ErrSamplesLimitExceeded, errors.Cause(err))
+	testutil.Ok(t, q.Close())
+}
+
 func TestSortReplicaLabel(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 
@@ -9,6 +9,8 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/info/infopb"
+	"github.com/improbable-eng/thanos/pkg/status"
 	"github.com/improbable-eng/thanos/pkg/store"
 	"github.com/improbable-eng/thanos/pkg/store/storepb"
 	"github.com/pkg/errors"
@@ -18,6 +20,9 @@ import (
 	"google.golang.org/grpc"
 )
 
+// endpointGroupServiceConfig balances requests of endpoint groups between all addresses of the group.
+const endpointGroupServiceConfig = `{"loadBalancingConfig": [{"round_robin": {}}]}`
+
 type StoreSpec interface {
 	// Address for the store spec. It is used as ID for store.
 	Addr() string
@@ -26,7 +31,7 @@ type StoreSpec interface {
 	// If metadata call fails we assume that store is no longer accessible and we should not use it.
 	// NOTE: It is implementation responsibility to retry until context timeout, but a caller responsibilty to manage
 	// given store connection.
-	Metadata(ctx context.Context, client storepb.StoreClient) (labels []storepb.Label, mint int64, maxt int64, err error)
+	Metadata(ctx context.Context, conn *grpc.ClientConn) (labels []storepb.Label, mint int64, maxt int64, err error)
 }
 
 type staticStoreSpec struct {
@@ -46,14 +51,54 @@ func (s *staticStoreSpec) Addr() string {
 
 // Metadata method for static store tries to reach host Info method until context timeout. If we are unable to get metadata after
 // that time, we assume that the host is unhealthy and return error.
-func (s *staticStoreSpec) Metadata(ctx context.Context, client storepb.StoreClient) (labels []storepb.Label, mint int64, maxt int64, err error) {
-	resp, err := client.Info(ctx, &storepb.InfoRequest{}, grpc.FailFast(false))
+func (s *staticStoreSpec) Metadata(ctx context.Context, conn *grpc.ClientConn) (labels []storepb.Label, mint int64, maxt int64, err error) {
+	resp, err := storepb.NewStoreClient(conn).Info(ctx, &storepb.InfoRequest{}, grpc.FailFast(false))
 	if err != nil {
 		return nil, 0, 0, errors.Wrapf(err, "fetching store info from %s", s.addr)
 	}
 	return resp.Labels, resp.MinTime, resp.MaxTime, nil
 }
 
+type endpointSpec struct {
+	addr string
+	// group is true if the address is a DNS name resolving to interchangeable replicas.
+	group bool
+}
+
+// NewEndpointSpec creates store spec for static endpoint exposing the Info service. The endpoint is used as store
+// only if it advertises the Store API.
+func NewEndpointSpec(addr string) StoreSpec {
+	return &endpointSpec{addr: addr}
+}
+
+// NewEndpointGroupSpec creates store spec for a DNS name resolving to replicas of the same component, e.g. all pods
+// of a replicated store gateway. The replicas are treated as a single store and requests are load balanced between
+// them in round-robin fashion instead of being sent to each of them.
+func NewEndpointGroupSpec(addr string) StoreSpec {
+	return &endpointSpec{addr: addr, group: true}
+}
+
+func (s *endpointSpec) Addr() string {
+	return s.addr
+}
+
+// Metadata method for endpoint asks the Info service for APIs the endpoint exposes until context timeout. Endpoints
+// that do not expose the Store API result in error, so they are not used as stores.
+func (s *endpointSpec) Metadata(ctx context.Context, conn *grpc.ClientConn) (labels []storepb.Label, mint int64, maxt int64, err error) {
+	resp, err := infopb.NewInfoClient(conn).Info(ctx, &infopb.InfoRequest{}, grpc.FailFast(false))
+	if err != nil {
+		return nil, 0, 0, errors.Wrapf(err, "fetching info from %s", s.addr)
+	}
+	if resp.Store == nil {
+		return nil, 0, 0, errors.Errorf("endpoint %s of %q component does not expose the Store API", s.addr, resp.ComponentType)
+	}
+	// All components expose a single label set for now.
+	if len(resp.LabelSets) > 0 {
+		labels = resp.LabelSets[0].Labels
+	}
+	return labels, resp.Store.MinTime, resp.Store.MaxTime, nil
+}
+
 // StoreSet maintains a set of active stores. It is backed up by Store Specifications that are dynamically fetched on
 // every Update() call.
 type StoreSet struct {
@@ -94,7 +139,7 @@ func (c *storeSetNodeCollector) Collect(ch chan<- prometheus.Metric) {
 	}
 }
 
-// NewStoreSet returns a new set of stores from cluster peers and statically configured ones.
+// NewStoreSet returns a new set of stores from the given store specs.
 func NewStoreSet(
 	logger log.Logger,
 	reg *prometheus.Registry,
@@ -178,7 +223,11 @@ func (s *StoreSet) updateStore(ctx context.Context, spec StoreSpec) (*storeRef,
 	s.mtx.RUnlock()
 	if !ok {
 		// New store or was unhealthy and was removed in the past - create new one.
-		conn, err := grpc.DialContext(ctx, addr, s.dialOpts...)
+		target, dialOpts := addr, s.dialOpts
+		if es, ok := spec.(*endpointSpec); ok && es.group {
+			target, dialOpts = endpointGroupDial(addr, dialOpts)
+		}
+		conn, err := grpc.DialContext(ctx, target, dialOpts...)
 		if err != nil {
 			return nil, errors.Wrap(err, "dialing connection")
 		}
@@ -191,7 +240,7 @@ func (s *StoreSet) updateStore(ctx context.Context, spec StoreSpec) (*storeRef,
 	}
 
 	var err error
-	st.labels, st.minTime, st.maxTime, err = spec.Metadata(ctx, st.StoreClient)
+	st.labels, st.minTime, st.maxTime, err = spec.Metadata(ctx, st.cc)
 	if err != nil {
 		st.close()
 		return nil, err
@@ -199,6 +248,14 @@ func (s *StoreSet) updateStore(ctx context.Context, spec StoreSpec) (*storeRef,
 	return st, nil
 }
 
+// endpointGroupDial returns the dial target and options that balance requests in round-robin fashion between all
+// addresses the DNS name of addr resolves to. The name is resolved again by gRPC when connections fail, so scaled
+// replicas are picked up.
+func endpointGroupDial(addr string, dialOpts []grpc.DialOption) (string, []grpc.DialOption) {
+	opts := append(dialOpts[:len(dialOpts):len(dialOpts)], grpc.WithDefaultServiceConfig(endpointGroupServiceConfig))
+	return "dns:///" + addr, opts
+}
+
 // Update updates the store set. It fetches current list of store specs from function and grabs fresh metadata.
 func (s *StoreSet) Update(ctx context.Context) {
 	var (
@@ -217,7 +274,7 @@ func (s *StoreSet) Update(ctx context.Context) {
 			}
 			innerMtx.Lock()
 			if dupSt, ok := stores[addr]; ok {
-				level.Error(s.logger).Log("msg", "duplicated address in gossip or static store nodes.", "addr", addr)
+				level.Error(s.logger).Log("msg", "duplicated address in store nodes.", "addr", addr)
 				dupSt.close()
 			}
 			stores[addr] = st
@@ -309,6 +366,42 @@ func (s *StoreSet) Get() []store.Client {
 	return stores
 }
 
+// Status returns the status of all active stores, retrieved from their Info services. Stores that fail to respond
+// are included with the error.
+func (s *StoreSet) Status(ctx context.Context) []status.Endpoint {
+	s.mtx.RLock()
+	stores := make([]*storeRef, 0, len(s.stores))
+	for _, st := range s.stores {
+		stores = append(stores, st)
+	}
+	s.mtx.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, s.gRPCRetryTimeout)
+	defer cancel()
+
+	var (
+		res = make([]status.Endpoint, len(stores))
+		wg  sync.WaitGroup
+	)
+	for i, st := range stores {
+		wg.Add(1)
+		go func(i int, st *storeRef) {
+			defer wg.Done()
+
+			resp, err := infopb.NewInfoClient(st.cc).Info(ctx, &infopb.InfoRequest{})
+			if err != nil {
+				res[i] = status.Endpoint{Name: st.addr, Error: errors.Wrapf(err, "fetching info from %s", st.addr).Error()}
+				return
+			}
+			res[i] = status.EndpointFromProto(st.addr, resp)
+		}(i, st)
+	}
+	wg.Wait()
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
 func (s *StoreSet) Close() {
 	for _, st := range s.stores {
 		st.close()
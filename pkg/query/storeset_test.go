@@ -10,6 +10,9 @@ import (
 	"sort"
 
 	"github.com/fortytw2/leaktest"
+	"github.com/improbable-eng/thanos/pkg/info"
+	"github.com/improbable-eng/thanos/pkg/info/infopb"
+	thanosstatus "github.com/improbable-eng/thanos/pkg/status"
 	"github.com/improbable-eng/thanos/pkg/store/storepb"
 	"github.com/improbable-eng/thanos/pkg/testutil"
 	"google.golang.org/grpc"
@@ -292,3 +295,73 @@ func TestStoreSet_AllAvailable_BlockExtLsetDuplicates(t *testing.T) {
 		}
 	}
 }
+
+func TestStoreSet_Endpoints(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	startEndpoint := func(srv infopb.InfoServer, store storepb.StoreServer) (string, func()) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		testutil.Ok(t, err)
+
+		s := grpc.NewServer()
+		infopb.RegisterInfoServer(s, srv)
+		if store != nil {
+			storepb.RegisterStoreServer(s, store)
+		}
+		go func() {
+			s.Serve(listener)
+		}()
+		return listener.Addr().String(), s.Stop
+	}
+	newStore := func(replica string) *testStore {
+		return &testStore{info: storepb.InfoResponse{
+			Labels:  []storepb.Label{{Name: "replica", Value: replica}},
+			MinTime: 10,
+			MaxTime: 20,
+		}}
+	}
+
+	store := newStore("a")
+	storeAddr, stop := startEndpoint(info.NewServer(info.ComponentSidecar, store, thanosstatus.New(map[string]string{"tsdb.path": "./data"})), store)
+	defer stop()
+
+	ruleAddr, stop := startEndpoint(info.NewServer(info.ComponentRule, nil, nil), nil)
+	defer stop()
+
+	// Endpoint group is dialed by DNS name.
+	groupStore := newStore("b")
+	addr, stop := startEndpoint(info.NewServer(info.ComponentStore, groupStore, nil), groupStore)
+	defer stop()
+	_, port, err := net.SplitHostPort(addr)
+	testutil.Ok(t, err)
+	groupAddr := net.JoinHostPort("localhost", port)
+
+	storeSet := NewStoreSet(nil, nil, func() []StoreSpec {
+		return []StoreSpec{NewEndpointSpec(storeAddr), NewEndpointSpec(ruleAddr), NewEndpointGroupSpec(groupAddr)}
+	}, testGRPCOpts)
+	storeSet.gRPCRetryTimeout = 2 * time.Second
+	defer storeSet.Close()
+
+	storeSet.Update(context.Background())
+
+	testutil.Equals(t, 2, len(storeSet.stores))
+	for addr, replica := range map[string]string{storeAddr: "a", groupAddr: "b"} {
+		st, ok := storeSet.stores[addr]
+		testutil.Assert(t, ok, "endpoint %s exposing Store API expected to be used as store", addr)
+		testutil.Equals(t, []storepb.Label{{Name: "replica", Value: replica}}, st.Labels())
+
+		mint, maxt := st.TimeRange()
+		testutil.Equals(t, int64(10), mint)
+		testutil.Equals(t, int64(20), maxt)
+	}
+
+	// Status is aggregated from stores, which do not have to expose it.
+	// Endpoints are sorted by address, 127.0.0.1 goes before localhost.
+	endpoints := storeSet.Status(context.Background())
+	testutil.Equals(t, 2, len(endpoints))
+	testutil.Equals(t, storeAddr, endpoints[0].Name)
+	testutil.Equals(t, info.ComponentSidecar, endpoints[0].Component)
+	testutil.Equals(t, map[string]string{"tsdb.path": "./data"}, endpoints[0].Flags)
+	testutil.Assert(t, endpoints[0].BuildInfo != nil && endpoints[0].RuntimeInfo != nil, "status of %s not aggregated", storeAddr)
+	testutil.Equals(t, thanosstatus.Endpoint{Name: groupAddr, Component: info.ComponentStore}, endpoints[1])
+}
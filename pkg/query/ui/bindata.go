@@ -1,13 +1,16 @@
 // Code generated by go-bindata.
 // sources:
 // pkg/query/ui/templates/_base.html
+// pkg/query/ui/templates/bucket.html
 // pkg/query/ui/templates/flags.html
 // pkg/query/ui/templates/graph.html
 // pkg/query/ui/templates/status.html
+// pkg/query/ui/static/css/bucket.css
 // pkg/query/ui/static/css/graph.css
 // pkg/query/ui/static/css/prometheus.css
 // pkg/query/ui/static/img/ajax-loader.gif
 // pkg/query/ui/static/img/favicon.ico
+// pkg/query/ui/static/js/bucket.js
 // pkg/query/ui/static/js/graph.js
 // pkg/query/ui/static/js/graph_template.handlebar
 // pkg/query/ui/static/vendor/bootstrap-3.3.1/css/bootstrap-theme.min.css
@@ -99,7 +102,7 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var _pkgQueryUiTemplates_baseHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xbc\x56\xdf\x6f\xdc\x44\x10\x7e\xef\x5f\x31\x6c\x11\x4d\x1e\x7c\x16\xea\x0b\x22\xb6\x11\x4d\x53\x1a\xa9\xa2\x51\x1a\x2a\x10\x42\xd1\x9c\x3d\xb6\x37\x5d\xef\x6e\x77\xc7\x26\xa7\xd3\xfd\xef\x68\xe3\x1f\xf8\x7c\xb9\x06\x24\xc4\x93\xd7\xa3\x99\xf9\xbe\xfb\xbe\xd9\x39\x27\x5f\xbd\x7e\x7f\x7e\xf3\xdb\xd5\x05\xd4\xdc\xa8\xec\x59\x12\x1e\xa0\x50\x57\xa9\x20\x2d\xb2\x67\x00\x49\x4d\x58\x84\x03\x40\xd2\x10\x23\xd4\xcc\x36\xa2\xcf\xad\xec\x52\x71\x6e\x34\x93\xe6\xe8\x66\x63\x49\x40\xde\xbf\xa5\x82\xe9\x9e\xe3\xd0\xea\x0c\xf2\x1a\x9d\x27\x4e\x5b\x2e\xa3\xef\xc4\xd0\x87\x25\x2b\xca\x6e\x6a\xd4\xc6\x83\x32\xba\x02\x26\xd7\x80\x67\xe3\xb0\x22\xb8\x72\xa6\x21\xae\xa9\xf5\xe0\x8d\x6a\x59\x1a\x9d\xc4\x7d\x4d\x5f\xaf\xa4\xfe\x04\x8e\x54\x2a\x7c\x6d\x1c\xe7\x2d\x83\xcc\x8d\x16\x50\x3b\x2a\x53\xb1\xdd\x82\x45\xae\xaf\x1c\x95\xf2\x1e\x76\xbb\xd8\x33\xb2\xcc\x63\xd9\x54\x71\x89\x5d\x48\x5d\xc9\xdc\xfc\xd0\xa5\xdb\x2d\xac\x5b\xa9\x8a\x8f\xe4\xbc\x34\x1a\x76\xbb\x91\xa2\xcf\x9d\xb4\x0c\xde\xe5\xc7\xfb\x75\xa4\x0b\xe3\xe2\x3b\x1f\xdf\x7d\x6e\xc9\x6d\x56\x8d\xd4\xab\x3b\x7f\xa4\x6f\x12\xf7\x3d\xff\x3d\xc0\xda\x18\xf6\xec\xd0\x46\x2f\x57\x2f\x57\xdf\x06\xc0\x29\xf4\x4f\x31\x67\xc2\xf1\xc6\xd2\xe0\x51\xee\xbd\x18\x84\xe4\x8d\x22\x5f\x13\xf1\x53\x2a\x1e\x21\x95\xfb\x25\xab\xdc\x1f\xa3\xf5\xdf\x91\x09\xa8\x76\x1a\x97\x2f\x41\xce\x55\xef\x09\x00\x74\xe8\xe0\xea\xc7\x9b\xb7\xb7\x57\xd7\x17\x6f\x2e\x7f\x85\x14\x0e\x80\xc4\xd9\x2c\xf7\xd5\x2f\x97\xef\x5e\xdf\x7e\xbc\xb8\xfe\x70\xf9\xfe\xe7\x21\x7b\x89\x34\xe6\x7f\x7d\x52\xb6\x3a\x0f\xb3\x0b\x27\xa7\xb0\x1d\xa2\x21\xfe\xe2\xf7\x02\x19\x23\x36\x55\xa5\xc2\x6f\x37\x46\xb1\xb4\xe2\x8f\x17\xa7\xab\xe1\x7c\x72\x3a\xa4\xef\xfa\xc3\xc2\xc6\xed\x96\xa9\xb1\x0a\x99\x40\x84\xdb\x29\x60\xb5\xdb\x85\xab\x1a\xf7\x77\x35\x1c\xd7\xa6\xd8\x0c\x3a\x6b\xec\x20\x57\xe8\x7d\x2a\x34\x76\x6b\x74\xd0\x3f\x22\xa9\x3b\x72\x9e\xc6\xd7\x52\xde\x53\x11\xb1\xb1\x62\xd4\x27\x29\xe4\x54\x1a\x2e\x37\x4a\x4d\x2e\x2a\x55\x2b\x8b\x29\x67\x3f\x6b\x68\x15\x78\x90\x9b\xe5\x04\x46\x2d\xb3\xd1\x83\xe1\xfd\x8b\x58\x94\xf5\x92\x40\x6e\x94\x42\xeb\xa9\x10\xb0\xa7\xd4\x18\x1f\xc3\xe8\x2a\xe2\x54\x3c\xef\xab\x05\xa0\x93\x18\xd1\xbd\x45\x5d\x50\x91\x8a\x12\x55\xc8\x7d\x88\x06\xf6\xce\xa8\x09\x6a\x8f\x5a\x98\x0b\x8b\x7a\x24\xe3\x5d\x64\xb4\xda\x88\xec\xa6\xa7\xa3\xb1\x93\x15\xf6\x5b\x28\xe4\x7d\xa1\x34\xac\x96\xe8\xa1\xfd\xff\x95\x9a\xc4\xbd\x94\x7b\x31\x5c\xe8\xba\x76\xa8\x8b\xa3\x57\x49\x0c\x9b\x38\x89\x71\x66\x6a\x5c\xc8\x6e\xe1\xb1\x2c\x26\xf9\x16\x00\xa3\x33\x93\x75\xfb\xd6\xb7\x6a\x96\x3f\x8e\xdb\xec\xa8\xa8\xe4\xa5\x23\x4a\x66\x09\x1e\xa3\x5c\x39\xb4\xb5\xc8\x7e\x0a\x8f\x40\x3b\x89\x95\x3c\xa8\x1f\x31\x0b\x67\x6c\x61\xfe\xd4\x0b\x84\x07\x9d\xfa\xfe\xcf\xc5\x32\x77\x98\xb9\xc5\x00\x4e\x9d\xc0\x19\x35\x9b\xe2\x87\x11\xab\xd1\x5b\x63\x5b\x9b\x0a\x76\x2d\x1d\x99\xc6\xec\x03\x23\xb7\x7e\xdf\xdf\x1c\x1d\xf1\x64\xee\x9e\x0d\x07\x02\x4e\x04\x1b\xd2\xed\xc1\x2f\x7a\x4a\x37\xff\x80\x2e\xb2\xeb\x56\xb3\x6c\x08\xbe\xc1\xc6\x9e\xc1\xab\xb0\xc2\xe0\x52\x97\xc6\x35\xc3\x9c\x3f\x26\xe9\xd3\xed\x4b\x85\x95\x17\xd9\xb9\x69\x1a\xd4\x45\xf4\x4e\x6a\x82\x37\x21\x76\xac\x61\x12\xb7\x6a\xe1\xdb\x63\x4e\x1e\x35\x2e\x7c\x8b\xf8\xef\xe3\xf9\x5f\x80\x34\x71\x61\x72\x2f\x60\x5c\x0f\xb7\x6b\x85\xfa\x93\xc8\xde\x92\xb2\x07\xda\x2e\xe1\xf6\x09\xed\x5d\x82\xd9\x4b\x12\x6b\xec\x1e\x59\xc6\xc3\x07\xd0\xdf\xfb\xb8\xdf\xc2\x49\xdc\x7f\x5d\xfd\x15\x00\x00\xff\xff\xb6\x36\x64\x59\x6e\x09\x00\x00")
+var _pkgQueryUiTemplates_baseHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xbc\x56\x51\x6f\xdb\x36\x10\x7e\xcf\xaf\xb8\xb1\xc3\x9a\x3c\xc8\xc2\xd0\x97\x61\xa1\x34\x2c\x69\xba\x06\x28\xd6\x20\xcd\x8a\x0d\xc3\x10\x9c\xa5\x93\xc5\x84\x22\x19\xf2\xe4\xc5\x30\xfc\xdf\x07\x5a\x92\x63\xcb\x71\xb3\x02\xc3\xe0\x07\x91\x87\xef\xbe\x3b\x7e\x77\x47\x5a\x7e\xf3\xf6\xe3\xf9\xcd\x1f\x57\x17\x50\x73\xa3\xf3\x23\x19\x3f\xa0\xd1\xcc\x32\x41\x46\xe4\x47\x00\xb2\x26\x2c\xe3\x02\x40\x36\xc4\x08\x35\xb3\x4b\xe8\xa1\x55\xf3\x4c\x9c\x5b\xc3\x64\x38\xb9\x59\x38\x12\x50\x74\xbb\x4c\x30\x3d\x72\x1a\xa9\x4e\xa1\xa8\xd1\x07\xe2\xac\xe5\x2a\xf9\x41\xf4\x3c\xac\x58\x53\x7e\x53\xa3\xb1\x01\xb4\x35\x33\x60\xf2\x0d\x04\xb6\x1e\x67\x04\x57\xde\x36\xc4\x35\xb5\x01\x82\xd5\x2d\x2b\x6b\x64\xda\xf9\x74\xfe\x5a\x99\x7b\xf0\xa4\x33\x11\x6a\xeb\xb9\x68\x19\x54\x61\x8d\x80\xda\x53\x95\x89\xe5\x12\x1c\x72\x7d\xe5\xa9\x52\x8f\xb0\x5a\xa5\x81\x91\x55\x91\xaa\x66\x96\x56\x38\x8f\xd0\x89\x2a\xec\x4f\xf3\x6c\xb9\x84\x69\xab\x74\xf9\x99\x7c\x50\xd6\xc0\x6a\x35\xa4\x18\x0a\xaf\x1c\x43\xf0\xc5\x61\xbe\x39\x99\xd2\xfa\xf4\x2e\xa4\x77\x0f\x2d\xf9\xc5\xa4\x51\x66\x72\x17\x0e\xf0\xca\xb4\xe3\xfc\xfa\x00\x53\x6b\x39\xb0\x47\x97\xbc\x99\xbc\x99\x7c\x1f\x03\x6e\x4c\xff\x36\xe6\x96\x70\xbc\x70\xd4\xd7\xa8\x08\x41\xf4\x42\xf2\x42\x53\xa8\x89\xf8\x25\x15\x0f\x24\x55\x84\x71\x56\x45\x38\x94\xd6\x7f\x97\x4c\x8c\xea\x36\xed\xf2\xa5\x90\xdb\xaa\x77\x25\x00\x98\xa3\x87\xab\x9f\x6f\xde\xdf\x5e\x5d\x5f\xbc\xbb\xfc\x1d\x32\xd8\x0b\x24\x4e\xb7\xb0\x67\xbf\x5d\x7e\x78\x7b\xfb\xf9\xe2\xfa\xd3\xe5\xc7\x5f\x7b\xf4\x38\xd2\x80\xff\xf6\xb8\x6a\x4d\x11\x7b\x17\x8e\x4f\x60\xd9\x5b\xa3\xfd\xf5\x9f\x25\x32\x26\x6c\x67\x33\x1d\xcf\x6e\xad\x66\xe5\xc4\x5f\xaf\x4f\x26\xfd\xfa\xf8\xa4\x87\xaf\xba\xc5\xa8\x8c\xcb\x25\x53\xe3\x34\x32\x81\x88\xd3\x29\x60\xb2\x5a\xc5\x51\x4d\xe3\x6e\x0d\x92\x53\x5b\x2e\x7a\x9d\x0d\xce\xa1\xd0\x18\x42\x26\x0c\xce\xa7\xe8\xa1\xfb\x24\xca\xcc\xc9\x07\x1a\xb6\x95\x7a\xa4\x32\x61\xeb\xfa\x02\x01\xc8\x52\x6d\x5c\xe3\x70\xa3\x32\xe4\x93\x4a\xb7\xaa\xdc\x60\x76\x51\x3d\x55\xcc\x83\xfc\x16\x06\x40\x4e\x5b\x66\x6b\xfa\x82\x77\x1b\x31\x72\xeb\x24\x81\xc2\x6a\x8d\x2e\x50\x29\x60\x47\xa9\xc1\x3e\x98\xd1\xcf\x88\x33\xf1\xaa\xf3\x16\x80\x5e\x61\x42\x8f\x0e\x4d\x49\x65\x26\x2a\xd4\x11\xbb\xb6\xc6\xec\xbd\xd5\x9b\x50\x3b\xa9\xc5\x69\x74\x68\x86\x64\x82\x4f\xac\xd1\x0b\x91\xdf\xac\xe3\x46\x79\xd4\x0c\x63\x25\x65\x1a\x1c\x9a\x2f\xb8\xc6\xab\x25\x59\xd3\xff\x5f\x50\x99\x76\x52\xee\xd8\x70\xa4\xeb\xd4\xa3\x29\x0f\x8e\x92\xe8\x6f\x62\x99\xe2\x13\x8b\x4c\x4b\x35\xdf\xda\xc6\x4e\x50\xe5\x46\xbe\x51\x80\xa1\x32\x9b\xd2\xed\x96\xbe\xd5\x5b\xf8\xa1\xdd\xb6\x96\x9a\x2a\x1e\x55\x64\xb9\x04\x55\x01\x3d\x40\x61\x1b\x67\x0d\x19\x06\x31\x6d\x8b\xfb\x78\x25\xac\x9b\xfd\xe9\x27\xb5\xca\x25\x1e\x3a\xdd\x54\xdb\xe2\x3e\x88\xfc\x6c\xfd\x8d\x67\x94\xa9\x56\x7b\xc1\x48\x07\xfa\x3a\xe2\x99\x47\x57\x8b\xfc\x97\xf8\x39\x4c\x6b\xca\x67\x58\x07\x35\x4a\x6f\x5d\x69\xff\x36\xa3\xb3\xaf\x2b\xd8\x1d\xe7\x95\x18\x63\xfb\x69\x18\x8d\xc6\x86\x09\xbc\xd5\x5b\xf3\xb5\x6e\xfe\x1a\x83\xb3\xae\x75\x99\x60\xdf\xd2\x81\x39\xc9\x3f\x31\x72\x1b\x76\x3b\xaf\x40\x4f\xbc\x69\xbb\x9d\x06\xd9\x2b\xed\x26\xc1\x86\x4c\xbb\x77\xa2\x97\xd4\x8c\x2f\x5e\x1b\x44\x7e\xdd\x1a\x56\x0d\xc1\x77\xd8\xb8\x53\x38\x8b\x97\x2b\x5c\x9a\xca\xfa\xa6\x9f\xc0\xe7\x84\x7e\x99\xbe\xd2\x38\x0b\x22\x3f\xb7\x4d\x83\xa6\x4c\x3e\x28\x43\xf0\x2e\xda\x0e\x11\xca\xb4\xd5\xbb\xb6\x7d\x94\x7c\xc6\x6d\xc8\x20\xfe\x4b\x0a\x3f\xa6\xdb\x8f\x93\xb2\x69\x69\x8b\x20\x60\xb8\xb8\x6e\xa7\x1a\xcd\xbd\xc8\xdf\x93\x76\x7b\xda\x8e\xc3\xed\x26\xb4\x33\x9e\x5b\x1b\x99\x1a\x9c\x3f\xf3\x4c\xf4\x7f\xcd\x9e\x5e\x8a\xee\x7d\x90\x69\xcd\x8d\xce\x8f\xfe\x19\x00\x7b\xa1\x41\x0b\x08\x0a\x00\x00")
 
 func pkgQueryUiTemplates_baseHtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -114,7 +117,27 @@ func pkgQueryUiTemplates_baseHtml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "pkg/query/ui/templates/_base.html", size: 2414, mode: os.FileMode(420), modTime: time.Unix(1510236039, 0)}
+	info := bindataFileInfo{name: "pkg/query/ui/templates/_base.html", size: 2568, mode: os.FileMode(420), modTime: time.Unix(1526301681, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _pkgQueryUiTemplatesBucketHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xac\x54\x4d\x6b\xdc\x30\x10\xbd\xef\xaf\x18\x74\xc9\xc9\x36\xcd\xb5\xb6\x4b\x0b\x29\x0d\x84\x52\xb6\x25\xd7\xa2\x95\xc6\xb1\xb2\xb2\x64\x46\x92\x49\x10\xfa\xef\x45\xf6\x7e\x78\x5b\x42\x49\x9b\xcb\x6a\x56\xd2\x7b\x6f\xde\x68\xc6\x31\x4a\xec\x94\x41\x60\x3d\x72\xc9\x52\xda\x00\x00\xd4\x5a\x99\x3d\xf8\xe7\x11\x1b\xe6\xf1\xc9\x57\xc2\x39\x06\x84\xba\x61\xce\x3f\x6b\x74\x3d\xa2\x67\xd0\x13\x76\x0d\x8b\x11\x46\xee\xfb\x6f\x84\x9d\x7a\x82\x94\x2a\xe7\xb9\x57\x22\x63\xaa\x5d\x10\x7b\xf4\xa5\x70\xee\xc3\xd4\xc4\x08\xbb\xa0\xb4\xbc\x47\x72\xca\x1a\x48\x89\xb5\x8b\x9c\x13\xa4\x46\x0f\x8e\xc4\xcb\x74\x13\x1a\x69\xa9\x1a\xec\x80\xc6\x1f\x96\x72\x50\xa6\x7c\x7c\x89\xbb\xae\x16\xde\x57\x88\x3c\x9e\x52\x7e\x1d\xeb\x22\x01\x30\x71\x82\xed\xcd\xe7\xed\xcd\xf7\x2f\x3f\x6f\xbf\xfe\xb8\xd9\xde\x7f\xbc\x83\x06\x62\x84\x72\x8b\x1d\xa1\xeb\x6f\x8d\x47\x9a\xb8\x86\x94\xde\xcf\xa0\x33\x5f\x8c\x68\x64\x4a\x9b\xcd\xf9\x51\x84\x35\x1e\x8d\x5f\xde\xa5\x96\x6a\x02\xa1\xb9\x73\xcd\x7c\xc0\x95\x41\x2a\x3a\x1d\x94\x3c\x16\xb2\xbf\x6e\x3f\x69\x2b\xf6\xae\xae\xfa\xeb\xc3\x5e\x67\x69\x38\xc2\x72\x5c\x28\xa3\x95\x41\x06\x4a\x36\x6c\x97\x6f\x17\x9d\xd2\x1e\xc9\x1d\x58\x2e\x95\x66\xc8\x03\xd9\x30\x9e\x8e\x73\x83\xf0\x1d\x6a\xe8\x2c\x35\x6c\x01\x17\xf3\x8e\x63\xed\xdd\xbc\xd6\xd5\xfc\x7f\x85\x50\x66\x0c\x7e\xd5\x53\xec\x42\x20\xfb\x21\xab\x97\xa4\x2e\x19\x61\xd4\x5c\x60\x6f\xb5\x44\x6a\xae\xb0\x7c\x28\x41\xe8\xe0\x3c\x52\xc3\x30\xbc\x63\x57\x47\x91\xba\x92\x6a\xfa\x2f\x0b\x38\xa1\x66\xed\x5d\x5e\xfe\x34\xe0\x50\xa3\xf0\x7f\xcf\x3a\xa3\x57\x3a\x00\xb5\x1d\x7d\xee\xc9\x89\xeb\x80\x0d\x63\x2d\xd7\xba\xae\x96\xcd\x15\x7f\xb5\x08\xbc\x99\x1b\x42\x67\x75\xc8\x22\xac\xdd\x9e\xe2\x7f\xf6\xb5\xa6\x7b\x4b\x73\x75\x95\x25\x0f\xf1\x78\x4c\x23\x7f\x75\x8a\x21\x78\x94\xab\x3e\x75\x45\x1e\xd3\xe0\xf2\x68\x8f\xed\xe6\xf7\xc2\x70\x8d\xe4\x61\xfe\x2d\x24\x37\x0f\x48\xd0\x2b\x29\xd1\x5c\x50\x20\x91\x25\xd6\xae\x33\xc8\xc5\x5d\xdd\xf0\x6a\xc0\x79\x42\xce\x97\x0e\x41\x8c\x68\x64\x4a\x9b\x5f\x03\x00\x57\x8d\xc4\x84\x36\x05\x00\x00")
+
+func pkgQueryUiTemplatesBucketHtmlBytes() ([]byte, error) {
+	return bindataRead(
+		_pkgQueryUiTemplatesBucketHtml,
+		"pkg/query/ui/templates/bucket.html",
+	)
+}
+
+func pkgQueryUiTemplatesBucketHtml() (*asset, error) {
+	bytes, err := pkgQueryUiTemplatesBucketHtmlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "pkg/query/ui/templates/bucket.html", size: 1334, mode: os.FileMode(420), modTime: time.Unix(1526301681, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
@@ -179,6 +202,26 @@ func pkgQueryUiTemplatesStatusHtml() (*asset, error) {
 	return a, nil
 }
 
+var _pkgQueryUiStaticCssBucketCss = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x91\xe1\x6e\xc2\x30\x0c\x84\xff\xf7\x29\x2c\xf1\x3b\x88\xa2\x21\xa6\xf0\x34\x69\x9b\x50\x8b\x24\x8e\x1c\x77\x65\x9b\x78\xf7\xa9\x29\x20\xa0\xd3\x34\xf9\x57\xd5\xbb\xfb\xce\xce\xaa\xf1\xd4\x9e\x94\x43\x2f\x96\x33\x7c\x57\x00\xc1\xf0\x11\xa3\x6a\x48\x84\x82\x86\x7a\x97\xce\x87\xea\x52\x55\x2f\xd2\xb5\x23\x0e\xea\xc8\x34\xa4\x47\x1b\xe3\xb1\x97\x07\xd7\xba\xb8\xf2\x52\x78\xcb\xdf\x6e\x7e\x53\x2a\x41\xf1\xb6\xe8\x1d\x45\x51\xce\x04\xf4\x9f\x1a\x02\x45\xca\xc9\xb4\xf6\xb0\x4c\x7a\x7b\x09\x62\x1a\x4b\x40\xa2\x8c\x82\x14\x35\xb0\xf5\x46\xf0\xa3\x98\x7b\x3b\x37\xdd\x6e\x27\x1b\x40\x63\xda\xd3\x54\x32\x76\xaa\x25\x4f\xac\x61\xe5\x76\xd3\x94\x9f\xc4\x9d\xe5\x3b\xa9\x4e\x67\xc8\xe4\xb1\x83\x95\xdd\x4d\xb3\xe0\xce\x6b\xbf\xe0\x4d\x93\xc9\x0f\x52\xf0\x42\x49\xc3\x15\x7d\xab\x52\xbf\xcf\xdf\x01\xa3\x1a\xb1\x93\xfe\xae\x98\xf9\x4f\x60\xe7\xdc\x43\x33\x36\x1d\x0e\xf9\xae\x6f\x07\xce\xd3\x0a\x89\x30\x8a\xe5\xa7\x7a\xe6\x8c\xf9\x3f\x77\xd9\xcc\x77\x29\xe7\xcf\xf8\x65\x35\xd4\xf5\x35\xfd\x7a\x9f\xfd\x7e\xbf\x4c\xce\xc9\xc4\x3f\xf6\x1e\x7b\x14\xab\xca\x13\x6a\x88\x34\xb2\x49\x87\xea\x52\xfd\x0c\x00\x0e\xa1\x64\x74\x88\x02\x00\x00")
+
+func pkgQueryUiStaticCssBucketCssBytes() ([]byte, error) {
+	return bindataRead(
+		_pkgQueryUiStaticCssBucketCss,
+		"pkg/query/ui/static/css/bucket.css",
+	)
+}
+
+func pkgQueryUiStaticCssBucketCss() (*asset, error) {
+	bytes, err := pkgQueryUiStaticCssBucketCssBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "pkg/query/ui/static/css/bucket.css", size: 648, mode: os.FileMode(420), modTime: time.Unix(1526301681, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _pkgQueryUiStaticCssGraphCss = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xac\x56\xff\x8e\xdb\x36\x0c\xfe\x3f\x4f\xc1\xf5\x30\xa0\x05\x62\xc3\xce\x2e\xbd\xab\x83\x15\xd8\x7f\x7b\x87\xe2\x60\xd0\x16\xed\x08\x27\x4b\x86\xc4\xfc\xb8\x0d\x7d\xf7\x41\x52\x9c\xd8\x17\x27\x6d\x81\xdd\x25\x01\x64\x52\xfc\x28\x7e\xe4\x67\x55\x46\xbc\xc1\xbf\x0b\x80\x0e\x6d\x2b\x75\x01\xd9\x66\xf1\x7d\xb1\x48\x69\x8f\xaa\x74\x8c\xec\x82\xb5\x31\x9a\x13\x27\xff\xa1\x02\xf2\xbc\x3f\x46\x9f\xd6\x62\xbf\x2d\x0f\x16\xfb\x9e\xec\x28\x48\xc2\xa6\x2f\x20\x5f\x4d\xfc\x82\xbd\x37\x4e\xb2\x34\xba\x00\x4b\x0a\x59\xee\x69\xb3\x00\x50\xd4\x70\x01\x8f\x99\xf7\x07\xe8\xa4\x4e\xb6\x24\xdb\x6d\x78\x96\x9d\x82\x3c\xa0\x10\xe5\x25\xd0\x04\x68\xf0\x49\x35\xee\x13\xc6\xca\xfd\x8c\xcb\x57\x50\x12\xbe\x02\xc6\xbc\x50\x08\xa9\xdb\x02\xd6\xfd\x71\xe4\xcc\x58\x25\x3d\x6a\x0a\x3e\x95\xb1\x82\x6c\x12\x93\xcd\xfb\x23\x38\xa3\xa4\x80\x07\x21\xc4\xe6\x62\xb6\x31\xf1\x9b\xf6\xca\x30\x9b\x6e\xce\x61\x9c\xc3\xb8\x6e\x6e\xdf\x8e\xf1\xe3\x79\x2e\xbb\x11\xf1\x2e\xfc\xd4\x3e\x03\x1f\x1c\x3c\x9c\xa2\x96\xb4\x08\x58\x42\xba\x5e\xe1\x5b\x01\x52\x2b\xa9\x29\xa9\x94\xa9\x5f\x7d\x98\x3d\x59\x96\x35\xaa\x04\x95\x6c\x75\x01\x6c\xfa\xcd\xb8\x79\xc2\xff\xe7\x6c\xda\x21\x68\x09\xef\xd0\x1f\x7a\xab\xc1\x4e\xaa\xb7\x02\xfe\xb2\x12\xd5\x12\xfe\x26\xb5\x27\x8f\xb4\x04\x87\xda\x25\x8e\xac\x6c\xc6\x48\x9e\xa8\x2c\xfc\xae\xce\x68\x6f\x25\x1e\x65\x24\xdf\xec\xc9\x36\xca\x1c\x0a\xd8\x4b\x27\x2b\x15\x80\x2e\xf0\x58\x39\xa3\x76\x1c\x9e\x0e\x05\x8d\x55\x8a\xe5\xc9\xfc\xe2\x20\x05\x6f\x87\xbe\x1c\xc5\x1f\x08\x99\xc1\xb8\xb0\x96\x0a\x62\x94\x0a\x52\xc9\xd4\xa5\x58\xfb\xc3\x86\x5d\xa1\x9e\x43\x7f\xe7\xe9\x23\x75\x13\xf2\xb3\x74\xed\x9f\x04\x3e\xb0\x22\x75\x63\xfc\xde\xc7\x99\xce\xe4\x14\x7d\x58\x95\xee\x80\x5c\xc7\xf9\x69\x94\x41\x2e\x20\xb4\xcb\xe6\x1e\xe1\xa7\x22\xe4\xa7\xe1\x3c\x03\x0e\xc3\x7a\xa2\x63\xe5\x89\x08\x94\x3c\x07\xc3\xf7\xc5\x42\xea\x7e\xc7\xdf\x58\xb2\xa2\x97\x62\xeb\x8b\x55\x60\xc3\x27\xa1\xa8\x8d\x66\xd2\x5c\x00\x32\xdb\x8f\xc1\xe9\x53\x3c\x40\x6d\x74\x23\x5b\x08\xbb\x97\x30\x2c\x1d\x29\xaa\x39\x6c\x3d\xa7\xb0\x1a\xa7\x90\x8c\xa8\x1b\x85\x09\x35\x9c\x6b\xe9\xb3\x97\x33\x8a\x4a\xc6\x4a\xd1\x44\x06\x43\x7f\x45\x80\x51\xf1\xb3\xf4\xf9\xc4\x4e\x4c\xe8\x9b\xc6\x8e\xfe\xfc\x20\xb5\x23\xcb\x65\x47\x6c\x65\xfd\xe1\x65\x2c\x3f\xe7\xb4\x06\x82\x04\x32\xf5\xb2\x7e\x3d\x15\x62\xcc\x6c\xd6\x73\xf0\x89\x95\x8b\xa1\x49\x8b\x32\xac\x3f\xbc\x2c\x61\x6c\xb0\xa8\x5b\x1a\x4c\x63\xc4\x28\x50\x49\x3e\xa9\xce\x49\x17\x92\x73\x9f\x90\xb5\xc6\x5e\x69\xdf\x3b\x4a\xa3\xeb\x01\xad\x96\xba\x75\x3f\xe7\x5d\xb1\x5e\x42\xda\x18\xdb\x25\x9e\x64\x6b\xd4\x12\x6e\xa8\xee\xa0\x59\x28\xe4\xce\x9d\x99\x13\x24\x76\x7d\x59\xb1\xbe\x3e\xd4\xf3\x00\xd2\x5b\xd3\x11\x6f\x69\xe7\x62\x05\xca\xd6\x9a\x5d\x7f\x5f\xba\x86\x4c\x7d\xeb\x0e\xd9\x5f\x46\x18\x77\x6c\xee\xc5\x4e\x47\xf5\xbe\x4e\x6c\xfd\xe5\x07\x99\xa5\xc3\x79\x66\x9b\xe9\xe6\xae\x0b\xdc\x79\x0e\xdf\x0d\xe2\xea\x4b\x5c\x9f\x79\xf9\xec\xdf\x60\xab\xab\xce\xcd\x1f\xe7\x64\x23\x7d\x5c\x3d\xaf\x9f\xf2\xc7\x3f\x36\x61\x26\x95\xb1\x05\x3c\xac\xd7\xeb\xa0\x85\x58\xbf\xfa\x34\xb4\x48\x06\x4b\xd3\x34\xef\x2c\xb2\xc3\x96\x0a\xd0\x46\xd3\xe5\x2d\x33\x79\xbd\xd4\x75\xed\x2d\xc9\x81\xaa\x57\xc9\x49\x65\x8e\x89\xdb\xa2\xf0\x35\xf7\x63\xc3\x90\x05\x6f\xff\xb5\x6d\x85\x1f\xb3\x25\xc4\x4f\x9a\x3d\xad\x3f\xc5\xa0\xbf\xbc\x65\x40\x63\x8b\x7a\xd0\xfc\x53\xb7\x85\xb3\x00\xa1\xa3\x44\xea\xc4\xec\x18\xd2\x7c\xed\x96\x33\x09\x5e\x39\x85\xc8\xe6\x57\x82\xfe\x20\xd8\xff\x15\xe9\x5e\x0b\x79\xbd\x29\xaf\xfa\x68\x75\xbe\x58\xa5\x74\xec\x2d\x39\x27\x8d\xbe\x76\xcb\xb3\xec\x77\xf8\x4d\x76\xbd\xb1\x8c\x9a\x67\xe4\x36\x9f\x8b\x33\x52\xeb\x01\x2f\x4c\xdd\x6c\xa4\x38\x41\x4f\xd3\x2b\x83\x97\x0e\x94\x9a\x2c\xa4\x56\xd6\xaf\x6e\x8b\x87\x72\x74\x3f\x99\xe9\xcd\x55\xf8\xdb\xdc\x90\x95\xff\x02\x00\x00\xff\xff\x7c\x4d\xdd\xbc\xe7\x0a\x00\x00")
 
 func pkgQueryUiStaticCssGraphCssBytes() ([]byte, error) {
@@ -259,6 +302,26 @@ func pkgQueryUiStaticImgFaviconIco() (*asset, error) {
 	return a, nil
 }
 
+var _pkgQueryUiStaticJsBucketJs = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xa4\x58\x7b\x73\x1b\xb7\x11\xff\x9f\x9f\x62\x0b\x3b\x19\x9c\x4c\x82\x92\xaa\x5a\x09\x19\x3a\x75\x6d\xb9\xf6\x8c\xed\x64\x14\xa5\xad\x4b\xb1\x1e\xf0\x0e\x47\xc2\xba\xc3\x5d\x01\x1c\x49\x45\xe6\x77\xef\xe0\x75\x0f\x92\x96\xec\xe9\x8c\x66\x84\x03\x76\x17\xfb\xf8\xed\x03\x5c\x51\x09\x57\x4b\x2a\x0a\x05\x93\xb0\xf8\xfc\x19\xee\xb6\xe3\x5e\xcf\x7d\x92\xb7\x6c\xc5\xb2\x17\x45\x56\x48\x43\x33\x45\x8f\x4e\xd2\xf3\xf3\xf9\x19\xea\x03\x7a\x94\xa6\xe7\xe9\x31\xb3\xcb\xd3\x98\x1e\x9f\xc6\x76\x99\x3c\x3d\x3d\x3f\xfd\xc1\x2e\x7f\x3c\x7b\x7a\x3e\x4f\xec\xf2\x87\xf8\x2f\x4f\xcf\xe6\x76\xc9\xfe\x7c\x7e\x1e\x9f\xa2\x59\x73\xc9\xdf\xb2\x22\xbe\x31\xf2\xd3\x4a\xc4\x9a\x17\x02\x47\x70\xd7\x03\xd0\x4b\xae\xc8\x3c\x1c\x4e\x67\xe3\xb0\xc7\x05\xd7\x9c\x66\xfc\x0f\x86\xa3\x71\xaf\xa5\xae\x93\x44\x4a\x59\xe8\x42\xdf\x96\xac\x45\xb9\x2f\xde\x98\xaf\x58\x96\xc2\xc4\x4a\x1d\xf7\x7a\x00\x8f\x31\x7a\x94\xf2\x4c\x33\x39\xc8\xe8\x9c\x65\x0a\x45\xa4\x10\x18\x71\x51\x56\x1a\xf5\x3b\x22\x2c\x33\x91\x4c\x24\x4c\xe2\x68\x0c\xdb\x68\xbc\x23\xc1\x38\xcf\x0b\x88\x97\x54\x2c\xd8\xb7\x4a\x90\x4c\x15\x59\x65\xc8\xbf\x55\x4c\x0f\xc2\x6e\x2a\x99\x5a\x1a\x3f\x01\xf0\x14\xf0\xe5\xc5\xab\xcb\x8b\xdf\x5e\x7f\x7c\xf3\xfe\xea\xe2\xf2\x1f\xcf\xdf\xc2\x33\x38\x76\xfe\x30\x1c\xfa\x8d\xd0\x4c\xae\x68\x86\x0f\x5d\x10\x44\xc1\xb6\x0f\xbb\x72\xec\x05\xdb\x7b\x83\xe1\x05\x7c\x65\x24\x08\xfd\x44\x37\xd8\x1c\x03\xe4\x4c\x2f\x8b\x64\x04\xe8\xef\x17\x57\xa8\x6f\xb7\x2a\x99\x8d\xe0\xd7\xe7\x57\xaf\x3f\xfe\x7a\x79\xf1\xea\xcd\xbf\xe0\x09\xa0\x21\x2d\xf9\x70\x75\x32\x74\x98\xf1\x84\x09\xd5\xf4\xea\xb6\x64\x23\x40\x9f\x54\x21\xfc\xae\xaa\xe2\x98\x29\x35\x6a\x54\x31\x87\xc1\x11\xde\x79\x35\xf6\xcc\x59\x40\xe2\xe7\xcf\x16\x8a\x9e\xce\xb8\xd4\x9e\x32\x29\x1b\x6e\x17\x44\xc7\x30\x60\x52\x16\x12\x45\x44\xb3\x8d\xc6\xe8\x2d\x55\x1a\x82\x27\x52\xca\x33\x66\xec\x82\x27\x50\x4b\x21\x92\xe5\xc5\x8a\xbd\xc8\xa8\x52\x18\x2d\x79\x92\x30\x81\xac\x7b\x8d\xe0\x2d\xb0\x4c\xb1\xfb\x6f\xa2\x49\xf2\x25\xee\x5d\xb5\xbd\x26\x2c\x79\xae\xbf\xa0\xbe\xd2\x54\x57\x2a\xe8\xdf\xf2\x0b\xc9\x98\x58\xe8\xa5\x71\x3c\x38\xda\x7e\x30\x8c\x25\xd6\xa4\xbc\xc8\x99\xd0\xfb\x17\x91\x54\x16\xf9\xfb\x62\x8d\xa3\xaf\x32\xab\xab\x01\xfa\x27\xe5\x9a\x8b\x05\xa4\x85\x04\xbd\x64\x90\x72\xd9\x72\x69\x91\xda\xcd\x79\x15\xdf\x30\x4d\xda\x96\xfb\x85\xb5\xa0\x2a\x13\xaa\xd9\x2b\x9b\xe9\xbf\x94\x06\xe7\x0a\xd7\xa4\xdd\x74\xb2\x6c\x5b\x87\x1a\xeb\xe0\x16\x66\x36\xcb\x56\xd0\x0f\x04\xc2\xba\x0c\x5d\x98\x2f\xc8\x0a\x9a\x18\xb5\x1d\x89\x8b\xf9\x66\x29\x89\xb3\xee\x8a\x6d\xf4\xbd\x91\xdf\x9a\xf4\x7a\xa0\xda\x1d\xb0\xea\x70\xb2\xd9\xca\x64\x8a\xaa\xa9\xf5\x6e\xab\x29\x35\x61\xbf\x5b\x81\x49\x5a\xc8\x0b\x1a\x2f\x9b\xc2\x30\x0f\xa6\x3b\x69\xd3\x39\x89\x8b\xbc\xa4\xf6\x90\xd8\xbd\x99\x49\x68\x59\x31\x73\x07\xb4\x6f\x98\xce\x89\x76\x36\x24\xc5\x5a\x28\x9a\x97\x19\x23\xcd\x79\x9b\xcf\x17\x33\xa3\x62\xca\xb3\xac\x6d\x8f\x62\x59\x1f\x56\x34\xab\x98\xea\x1b\x34\xe4\xb4\xc6\xb0\x21\x8f\x2b\x29\x99\xd0\x30\x31\xc9\x4c\x4c\x4d\xf3\xae\x34\x9f\x29\x17\x09\x46\x85\x0d\xfd\x48\x14\x1a\x8f\x2c\x8c\x22\x14\x82\x10\x88\x7f\x99\x7f\x62\xb1\x26\x37\xec\x56\x61\x77\x57\x44\x72\x5a\xe2\xf7\x55\x3e\x67\x32\x22\xaa\x90\xba\xf1\x09\xed\x83\x71\x0b\x48\xa6\x2b\x29\x80\xc2\x00\xe6\xa6\x20\xef\x7b\x6f\x15\x54\xb5\x78\x23\xb4\x2c\x99\x48\xf0\x63\x8c\x7e\x72\x4a\x3d\x43\x91\xd5\x79\xe5\x51\xe4\xec\xc3\xab\x28\xe4\xcc\xd6\xff\x0f\xc6\x79\x73\xed\xae\xa9\xc2\x60\xfd\x85\xf7\xfb\x51\xdf\x07\xac\xd5\x44\x56\x2d\x9d\x57\xa1\x0f\xed\xb2\x37\xf1\x41\x51\xbf\x1d\xcd\xbe\x1f\x1e\x8c\x91\x39\xd5\x97\xf5\xc9\x03\x70\x75\x4d\x8e\x25\x87\x31\x9a\x53\x1d\x2f\x99\x6c\x66\x13\x52\x52\xa9\xd8\x3b\xbf\x8d\x0f\xb5\x6a\xe3\x07\xe7\x9f\x1a\xe5\x30\x39\xd4\x92\x6b\x34\x74\xa1\xdf\x25\x6e\xf6\x1b\x8e\x1e\x04\x3f\x75\x72\xc3\x32\x1c\x48\x0d\xd3\x1e\xec\x9d\xf0\xa7\xc9\x04\x10\x82\xef\xbf\x87\xfd\x3c\xb1\x87\x0e\x50\x8e\x3a\x6a\xc0\xe1\x6f\x4b\x69\xa6\x7c\x1e\x6d\x6b\xc9\x2d\xc5\xdb\xe2\xef\x4b\xad\xf6\x55\xcd\xee\x57\xdc\x67\x1c\x95\x29\x66\xd2\xa9\xbe\xc1\xf9\x3d\xcc\x8c\x2d\xee\x10\x3b\xc2\x56\x4c\xde\x36\x7e\xc9\x5b\x38\x33\xc2\xa6\x39\x11\x34\x67\x33\x98\x4c\x26\x90\x1b\x1f\x57\x2c\xc0\xef\xa1\x62\xe7\xe6\x9d\xc3\xd8\xa9\x1b\xb7\x0d\x52\xc0\x59\x13\x71\xcd\x73\x96\x71\xc1\x60\xd2\xae\xda\x61\x17\x45\x84\xe5\xa5\xbe\x6d\x86\xa6\x6e\xc3\x33\xca\xd6\x33\x53\x60\x6a\x67\x70\xf9\xac\xae\xfd\xef\x8b\xa0\x4c\x5a\x54\x22\x21\x28\xa4\xaf\xf3\x82\x59\x6f\x43\x7d\xcb\xb9\xb8\xe2\xb9\x51\xea\x1d\xd5\x4b\x92\x73\x61\x84\x66\xb7\x58\x54\x59\xd6\xf7\x72\x6c\xf1\xa9\x4d\x6e\x17\x9b\x39\xf1\x02\x8c\x07\x6b\x53\x73\xba\xe9\x08\xa5\x9b\x6f\x15\x4a\x37\x7b\x42\x55\x49\x45\x4b\x22\x0e\x97\x0c\xc0\xab\xd0\x87\x93\x9a\xb8\x2c\x3a\xb3\xbd\x6e\x49\xc7\x27\xc7\xc7\x70\x04\x58\x37\x9c\x11\x0c\xad\xf8\xc8\xcc\x15\xdf\xa1\x31\x6c\xeb\xfa\x4f\x37\xdc\x48\x32\x1e\x4e\xf8\xea\x59\x67\xd0\xf1\x21\x34\x24\xae\x63\x9a\xe9\x00\x1b\x2e\x0e\x13\x38\x1e\x03\x87\x9f\x26\x70\x36\x06\xfe\xe4\x49\x08\x9d\x39\x35\x78\xf6\x37\xc3\x13\xe0\x70\x64\x2f\x87\x21\x9c\x19\x21\x00\x46\x60\x3b\xb4\xe6\xd4\xdc\x1c\x2b\x85\xb9\x85\xed\x19\xfc\x0c\x77\x92\x2f\x96\x7a\x04\xc7\x5b\x18\xc1\x5d\xc6\x52\x3d\x82\xb2\x50\x58\x47\x5b\x0f\x04\x37\x0a\x91\x4a\xc7\xd8\xcc\x3f\xb6\x50\x62\xf4\xe1\xc3\x87\x0f\x83\x77\xef\x06\x2f\x5f\xc2\xeb\xd7\xa3\x3c\x47\xbe\xba\x6f\x7b\xfb\xc0\x32\x9a\xb8\x5e\xe8\x33\x62\x21\x8b\xaa\x74\x45\xd5\x03\xf4\x40\x9b\x59\xb4\x8d\xb5\x1c\x0f\x78\xd0\xd2\x84\xa1\xc3\x7e\xb4\xcd\xbf\x97\x6b\xa0\xb9\xce\x58\x80\xfe\x82\xd8\x4f\x63\xd0\x5e\x23\x5d\xb8\xba\xf7\x2d\xad\x74\x0e\x03\xa0\x87\x5b\x69\xb6\xca\x82\x95\xbe\xa0\x17\xeb\x07\xac\x94\xc5\x3a\xd8\x08\x10\xb4\x99\x66\xab\x6c\x76\xcf\x9c\x63\xfe\x64\xb1\x7e\xd8\x1f\x1e\x1f\x0d\x17\x40\x83\x89\x3a\x4d\xa3\x7e\xeb\x7c\xcd\x13\xbd\x1c\xd5\x09\x51\xa7\x1d\x0c\x9a\xbc\xde\x49\x8d\x36\x3b\x9a\xd3\xf8\xc6\x04\x41\x24\x83\xd8\x3c\xd7\xd1\x08\xf6\x9f\xf0\x53\x9c\xad\x32\x18\xc0\x49\x04\xdf\x1d\x38\xf6\xf5\x6d\x56\xcb\xdd\x46\x84\x6a\x2d\x31\xb2\x91\x44\x75\x9f\x4f\x98\x8a\x25\x9f\x33\x0b\x3e\x3c\xaf\x47\x92\x66\x28\xd9\x81\x8e\x2c\xd6\x3b\x53\xcb\x2e\xba\x2d\x79\xa7\xee\x0f\x87\xd0\x42\xb8\x5b\x2b\x5f\xaf\x60\x7e\x0b\x6c\xa3\x99\x14\x34\x03\xdf\x85\xa8\x48\x5a\x9d\xbc\x6f\xbf\xd7\x5c\x2f\xb9\x19\xc3\x2c\xb7\xe1\x6a\x5a\xaf\x9b\x82\x48\x6f\x3f\x9b\xda\xd5\xca\x27\x56\xdd\x59\xbc\x1a\x61\x72\xf6\xe5\xf3\xcb\x98\x31\x70\xb4\xde\x6b\xc6\x18\x37\x25\xbd\xb5\x5a\xe3\x9d\x5e\x6a\x43\x0b\x7f\xb5\x8f\x83\x2f\x0c\x55\xf8\xfe\x06\xef\xfd\x6b\xee\x5d\xc0\xc4\xbb\x6d\x6a\x55\x98\xed\x7d\x9b\xce\x6d\x8f\x46\x60\xff\x85\xd1\x70\x04\x77\x5b\xdf\xd1\xf1\x82\xdc\x3b\xdf\xdf\x7b\x6c\xdf\xca\x11\x29\x2b\xb5\xc4\xf3\x3a\xba\xf5\x98\xd0\x29\x09\x56\x51\x5f\x04\xa2\x6e\x43\xba\x69\xd5\x01\x6f\xc0\xcd\x6c\xbc\x3b\x21\x74\x50\xd9\x89\xa1\x0b\x86\x17\x30\xb5\x66\xa1\xdf\xdf\xbe\x79\xe9\x1e\x61\x73\x52\x65\x3c\x71\xd9\x84\x5e\xc9\x22\x1f\xb5\x1e\xaf\xb6\x62\x37\x19\xe8\xa3\x81\x7d\xee\xa2\xdf\x85\xe6\xd9\x21\x7a\xba\x39\x48\x7f\x69\x7e\x05\xea\xd0\x27\x95\xa4\x3e\xac\x87\x52\x9e\x2c\xab\x9c\x0a\xfb\x4b\x97\x17\x61\x13\x36\x68\xbe\xeb\xf2\x70\x4d\x0d\x87\xd1\xff\x03\x25\x2f\xed\x37\x26\x39\xf3\x2f\xd6\xb9\x7d\xaf\x2a\x22\xaa\xdc\x6d\x07\x1a\xcb\x7c\x80\xc8\xed\x7b\xaa\x17\xcb\x4a\xdc\xec\x13\xb9\xed\x1e\xc0\x8c\x7c\x2a\xb8\xc0\xe8\x5a\xa0\x6e\x6c\xdb\x39\xd3\x0e\xad\x19\x22\x9b\xb1\xcf\xcc\x92\x66\x42\x68\xe3\xca\x50\xb8\x09\x35\x60\xab\x05\x40\x74\x67\x34\xb1\x6c\x5d\xc4\x89\x16\xe2\x84\xc9\xc9\xc9\x35\x32\xa4\x46\xda\x54\xcc\xcc\xce\x35\x32\xc3\x49\xe4\x35\xee\x03\xb2\xb9\xbb\x45\x07\xf4\x6e\x3c\xde\xd6\x5d\x32\x5f\x57\xfc\x28\xdf\x9d\x2b\x83\x86\x92\xae\x51\x18\x09\xfc\xde\x2e\x72\x8c\x20\x42\xd5\x3b\x2e\x2a\xcd\x14\xb6\x7a\xe4\x5e\x8f\xe1\x10\x3a\xcf\x26\xf7\xa5\x80\x42\x5c\xe4\x39\x05\xc5\x4a\x2a\xa9\x66\x09\x64\x5c\x69\x28\x52\xeb\x8d\x09\xb2\xa3\x38\x02\xf6\xdf\x8a\x66\x5c\xdf\xd6\xaf\x31\xd2\x3b\xf4\x18\x6b\x9b\xd5\x2a\x96\x92\x35\x3f\xdc\x9a\xf8\x48\x33\xdb\x0e\xaf\xd5\x11\x9e\xd2\xc1\x1f\xcf\x07\xff\xfe\x38\xf3\x8b\xe3\xc1\x8f\x1f\x67\x47\xd1\xb5\x3a\x9a\x5c\xab\x23\x84\xa7\xff\x41\xb3\xa3\x08\x5d\xab\xa3\xfe\xcf\xc3\x45\xe0\xcf\xcd\x62\xbd\xe4\x19\x03\x8c\x73\x98\x80\x64\x84\x6d\x58\x8c\xed\xaf\x72\x08\x45\x91\x7d\xde\x98\x71\xb9\x71\xa3\x72\xe5\xe7\x4e\xd0\x9c\x8d\x20\x9f\x9e\xcc\xfc\x8f\x06\xe6\xe3\x74\xb6\x8d\x76\xbc\x2b\x99\x72\xae\x7b\xdc\xc0\xc1\x49\x13\x6c\x1d\x32\xc9\x8f\x5d\xd1\xb8\xb7\x8d\xc6\xbd\xff\x0d\x00\x28\x7d\xb1\x47\x49\x17\x00\x00")
+
+func pkgQueryUiStaticJsBucketJsBytes() ([]byte, error) {
+	return bindataRead(
+		_pkgQueryUiStaticJsBucketJs,
+		"pkg/query/ui/static/js/bucket.js",
+	)
+}
+
+func pkgQueryUiStaticJsBucketJs() (*asset, error) {
+	bytes, err := pkgQueryUiStaticJsBucketJsBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "pkg/query/ui/static/js/bucket.js", size: 5961, mode: os.FileMode(420), modTime: time.Unix(1526301681, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _pkgQueryUiStaticJsGraphJs = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xe4\x7d\x69\x77\xdb\xb8\xb2\xe0\x77\xff\x8a\x0a\x6f\x4e\x44\xb5\x25\xca\x4e\xdf\xee\xb9\x2d\x5b\xee\x49\x67\xb9\xc9\x7b\xd9\x6e\xe2\xf4\xf2\x1c\x3f\x1f\x88\x84\x24\xc6\x14\xc9\x0b\x80\xb6\xd5\x89\x7e\xd6\xfc\x81\xf9\x65\x73\x50\x58\x08\x90\xd4\x92\xee\x37\xf7\xcc\x9c\x97\x0f\x72\x84\xa5\x50\x28\x14\x0a\xb5\x01\xba\x21\x0c\xde\xb2\x62\x49\xc5\x82\x56\x1c\x26\xee\x97\x2f\x5f\xe0\xf3\xfa\xe4\x40\x36\x99\x33\x52\x2e\xce\xe9\xb2\xcc\x88\xa0\x27\x07\x58\xf6\xfe\xe9\xe3\x37\xaf\x9f\xc0\x04\x8e\x8f\x8e\x8e\x4e\x0e\x0e\xea\x9e\xd1\xdf\x65\x73\x98\xc0\xac\xca\x63\x91\x16\x79\x48\x33\xba\xa4\xb9\x18\x40\x51\xca\xef\x7c\x00\x0b\x92\x27\x19\x7d\xbc\x20\xf9\x9c\x9a\x6f\xef\xe8\xb2\xb8\xa1\x7d\xf8\x7c\x00\x20\x16\x29\x8f\x68\x06\x13\xd0\x7d\x4f\x4c\x21\xe2\xf2\xfc\xfc\xd5\x4b\x98\x40\x5e\x65\x99\xad\xd0\xb0\x61\x62\x46\xb1\x35\xee\x60\x30\xf1\xc6\x6e\xb4\x51\x28\xb8\xa8\x2b\x74\xc0\x43\x31\x94\x3d\xfa\xb2\xeb\xda\xf6\x67\x69\x7c\xcd\x17\xe4\xd6\xcc\xdd\x43\x2d\x21\x82\xc0\x04\x2e\x2e\x4f\x0e\x4c\x51\x9a\xa7\x22\x25\x59\xfa\x3b\x0d\xfb\x27\x07\xeb\x0e\x02\x46\x22\x5d\xd2\x67\x24\x16\x05\x93\x93\x92\x68\x04\xab\x60\x0c\xdf\x1f\xc1\x37\xea\xe3\xe1\x5f\xe1\x1b\xf8\xf6\xfb\xef\x06\xb2\xea\xb6\x5d\xf5\x3f\xb0\x22\x69\x54\x60\xe1\xa2\x2e\xc4\xef\x4b\xfc\x8e\xff\xe5\xc1\x18\x8e\xbb\x31\xe2\x82\x96\x3f\x93\xac\xa2\x12\xa1\x0b\xd9\xf8\x98\x07\x03\x08\x8e\x8f\xd4\x9f\xa5\xfc\xfc\x0e\x3f\x8f\xd5\x9f\x6f\x8f\xd4\xb7\x85\xfc\x7c\x88\x9f\xdf\xe3\xe7\xb1\xfa\x72\x9c\x60\x45\x12\xe0\xd0\xc7\xb7\xf8\x0d\x3f\xff\x8a\x9f\x7f\xc3\xcf\xe3\x15\x96\xaf\x82\x83\xcb\x2e\xb4\xf2\x6a\x89\xff\x91\x58\x75\xb1\x62\x54\xb2\x42\x14\x62\x55\x52\x87\xec\xed\x45\x96\x5c\xcd\x69\x36\x83\x09\x2e\x91\x5c\x3d\xf9\x35\x4a\x13\x6f\x63\x34\x07\x3d\x3c\xc4\x55\x1d\x8d\xe0\x3d\x15\x90\xd0\x19\xa9\x32\x61\x78\x30\x32\x40\xcc\x77\x04\xa6\xc1\x9e\x34\x2b\x99\x64\xc9\xab\x34\x2f\x2b\x61\x5a\x75\x55\x7d\xf9\x82\x14\x95\xdd\xd3\x19\x84\x5e\x3b\x41\xa6\x30\x99\x4c\xa0\xca\x13\x3a\x4b\x73\x9a\x18\x06\x6e\xb7\x82\x63\x64\x61\x8d\xfc\x13\x46\x6e\xd5\x46\x87\xb8\xc8\x05\x2b\x32\x0e\x24\x4f\xf0\x0b\x49\x73\xca\x60\xc6\x8a\x25\x3c\xc7\x7d\x30\x25\x8c\x83\xd0\x02\x21\x3a\xd0\xc4\xab\x77\xa0\x1a\xb2\x57\x12\xb1\x78\xcb\xe8\x2c\xbd\xeb\x8d\xe1\xed\xa3\xf3\xe7\x57\x6f\xdf\x3d\x7d\xf6\xe2\xd7\x81\xaa\x9e\x56\x69\x96\xfc\x4c\x19\x4f\x8b\xbc\x37\x86\x9f\x3e\xbc\x78\xf9\xe4\xea\xe7\xa7\xef\xde\xbf\x78\xf3\xda\x6c\xae\x4f\xff\xa8\x28\x5b\x45\xf4\x4e\xd0\x3c\x09\xad\xfc\x70\x67\xd3\xb7\x74\x74\x65\xc3\xfd\xf0\x55\xc5\x05\x89\x17\x34\x62\x34\x4f\x28\x0b\x3d\x29\x66\x65\x51\xbf\xee\x4e\xb3\x88\x94\xa5\x1c\xc7\x87\xd6\x37\x0b\xfc\x77\x2a\x80\xd1\x19\x65\x34\x8f\x29\x07\x51\x00\xc9\x32\x10\x0b\x0a\x69\x2e\x28\xa3\x5c\xa4\xf9\xdc\x48\x2c\x0e\x69\x8e\x75\x35\x51\x15\x1d\x49\x9e\x28\x70\xd3\x34\x4f\x80\xde\xd0\x5c\x68\xf1\xc2\x90\x5f\xac\xc4\xfd\x85\x49\x74\x98\x61\x05\x9a\x45\xb3\x34\x4f\xc2\xe0\x2f\x58\x7b\x75\xab\xaa\x03\x38\x34\x0c\x55\x4f\xe5\x9f\x92\x6a\xcf\x0a\xb6\x84\x89\x07\x4b\x43\x50\xf5\x57\xb3\x82\x2d\x03\x35\x3b\x35\xc2\x5d\xc9\xba\x3b\x08\x7a\x27\x08\xa3\xe4\x22\x27\x4b\x3a\x91\xed\x2e\x03\x87\x70\x77\x25\x8b\xae\xe9\xaa\x64\x94\xf3\xb0\x16\xfb\x86\xf7\x46\x23\x78\x2a\x09\x04\xb7\x84\x03\x36\xa2\x09\xdc\xa6\x62\x51\x54\x02\x49\xc4\x17\xe9\x4c\xc0\x35\x5d\x45\xd8\x5e\x72\x35\x8d\x6e\x17\x69\xbc\x80\xc9\x04\x8e\xbf\x85\x07\x0f\xe0\x1e\x8d\xb0\xd9\xbf\xd3\x95\x81\xdb\x9c\x6c\xc4\xab\xe9\x32\x15\x21\x62\x26\xff\xd1\xa8\x64\x48\xe0\x27\x6a\x5b\x9a\x1a\x64\x7a\xc4\xeb\x51\x25\x8a\x21\xa3\x5c\x4a\x04\x89\x89\x9c\x28\xc8\x99\x42\x91\x03\x6e\x37\x85\x12\xf2\xf7\x6c\xc6\xa9\xd0\xe2\x21\x52\xdf\x9e\xd3\x74\xbe\x10\x30\x54\x65\x71\x96\xd2\x5c\x97\x9d\xd8\x7e\x0a\xfc\xb9\x26\xa1\x7f\x30\xd6\x53\x01\xb8\x2f\xbf\x47\x31\xe7\x61\x6f\x81\x20\x7a\x03\xe8\x91\x4a\x14\xbd\x66\x29\xcd\x22\x1e\xb3\x22\xcb\xf4\xf0\x87\x1a\x37\x33\x3d\xf5\xe7\xbe\x3a\xa8\xa2\x22\x0f\x7b\xd7\x74\x55\x95\x6a\x42\xbd\x81\x27\xf9\x1a\xe8\xe9\xc3\x0d\xd6\xea\x80\x6b\x2c\x72\x8c\xa7\xa6\xda\x1f\xee\x39\xea\x30\x51\x42\x93\xaa\xfc\x49\xe4\x86\x6d\xeb\xd5\xd1\xbc\x87\x0d\xae\xa6\x22\x77\x39\x28\x27\xd3\x8c\x3e\x91\x35\x9b\xfa\x21\xee\x8a\xff\x10\x82\xcb\x80\x28\x1d\x5f\xb8\x72\x73\x4b\x6f\x47\x94\xba\x30\xa4\xb0\xb8\xa6\xc9\x36\xcc\x75\x93\x06\xee\xba\x74\x8f\x91\x75\x4b\x77\xd4\x34\xe7\x94\x89\x57\x54\xb0\x34\xde\x04\x81\xd3\x8c\xc6\x1a\x84\x6a\x7f\xb5\xc4\x0e\x1e\x09\xe8\x8c\x51\xbe\x78\x21\xf7\xd9\x0d\xc9\xf6\x81\xa5\xbb\x5c\xba\x22\x20\x2e\x72\x5e\x64\xf4\x1c\x0f\x88\x2e\xc9\xa1\x1b\x04\x0d\xa9\x2b\x3b\xc0\x86\x2e\x4a\x5c\x59\x01\xe8\x0e\x27\xc8\x94\x77\xf7\x22\x17\x52\x6b\x1a\x8a\x62\x3e\xcf\xe8\xa4\x27\xc8\xb4\xe7\x4e\x57\x76\x8c\xe8\x3f\x5b\x87\x5f\x5f\x7e\x84\x01\x5f\x14\xb7\xcd\xd6\x45\xae\xca\xf3\x68\x8a\x4d\x03\x67\x1f\x58\x51\x25\xf7\xab\x20\x6c\x8e\xfb\xfc\x7e\x48\x23\xf5\x45\x6f\xac\x8e\x43\x54\xd5\x47\x25\x61\x34\x17\x61\x3f\x4a\xf3\x84\xde\x85\x6e\x7b\x77\x9f\x98\x0a\x29\xe1\xee\x87\xc1\x5f\xa4\xf0\xd6\x10\x88\x10\x2c\x0c\x08\x4b\xc9\xd0\x1c\xc0\x41\xbf\x1f\x2d\x08\x7f\x9c\x11\xce\xc3\x80\xd1\xac\x20\x49\xd0\x6f\x48\x3f\x25\xf3\xf0\x98\xac\xc5\x9b\xda\xb9\xea\x98\x79\x47\x45\xc5\x72\x90\x9a\x2b\x87\x59\x11\x57\x1c\xa6\x24\xbe\x96\xc7\x17\x0a\xfc\x34\xe7\x82\x92\x04\x8a\x19\x28\x58\xf2\x14\x8b\xba\x18\x34\x9a\xe2\xd2\x5c\xd3\x55\x52\xdc\xe6\x52\x27\x63\x08\xbb\x93\x92\xb5\xd0\xc0\x31\x3d\x92\x60\xf1\x0d\xc9\x42\xff\x5b\x5f\xb7\x51\x50\x37\x48\xef\x75\xbf\x3e\xaf\x18\x2b\x36\x1c\x58\xaa\x2e\xe8\x47\x8b\x34\xd1\x54\xc7\x2e\xb7\x84\xe5\x69\x3e\xdf\xc0\x74\xb6\xba\xdd\x11\x5b\x3f\x52\xf2\x7b\x33\x93\x4b\x09\xda\xdc\x1a\x66\x2b\x5a\x08\x5e\x17\xa7\xf5\xea\xd1\x5d\xca\x37\xb6\x5e\x5d\x91\xbb\x94\x3b\xcd\x33\x3a\xa7\x79\xb2\x01\x1d\x55\xe9\x4a\xa9\x32\xcd\x73\xba\x89\x5a\xba\xd6\x95\xc8\x37\x24\x7b\x2f\x88\xd8\x44\x29\x59\x7f\xc5\x65\x03\x4f\x83\xc8\x93\x27\x44\xd0\xee\x3e\x8e\x24\xa4\x79\xd2\x96\xc0\xba\xb3\x34\x97\xa8\x34\x7e\xca\x34\xbe\xa6\x2c\x54\xec\x94\x15\x31\xc9\xe8\x18\x7a\x34\xef\x29\xfd\x51\x6a\x2f\x44\x8c\xa1\xf7\xdb\x6f\xbf\xfd\x36\x7c\xf5\x6a\xf8\xe4\x09\x3c\x7f\x3e\x5e\x2e\x75\xbd\x28\x8a\x6c\x4a\xd8\xdb\x8c\xc4\xa8\x90\x8d\xa1\x37\x2d\x84\x28\x4c\x3d\x4f\x13\xfa\xd3\xea\x7d\x9a\xd0\x31\x08\x56\x51\x5d\xba\x28\x6e\xcf\x8b\x84\xac\x7e\xaa\x84\x28\xf2\x66\xd5\xe3\x8c\x12\xd6\x2e\x2c\xb8\x07\x44\x62\xff\x1f\x45\x2e\xd1\xfd\x70\xfe\x18\xc7\x53\x27\x69\x4b\x5f\xb7\x84\xf0\xb7\x4d\x4d\x09\x12\xf6\xe4\x7f\xcf\xd3\x25\x7d\x8b\xf4\xe8\xf5\x91\x40\x9b\xc0\x28\x9d\xbe\x01\x47\x8a\xbe\xa4\xd4\xa7\x77\xd0\x38\xff\x3b\xa4\x88\x7b\xee\x37\x0e\x16\xa3\x02\xb4\x41\x54\xa5\xc4\xeb\x9d\x6a\x6e\x80\x58\x31\xc2\xdf\xdb\x63\xb2\x65\x5c\xeb\xfd\xee\x9e\xa6\x4a\x1e\xa0\x29\xd3\x3b\xee\x69\x5b\xdb\x18\x69\x62\x95\x51\x04\xa7\x0e\xeb\x16\x3c\xd9\x28\x8d\x0b\x7b\x90\xd7\x47\xbb\xe2\xc4\x5e\x34\xcf\x56\xe5\x42\x36\xe9\x39\x02\xd9\x47\x34\x6c\x09\xda\x1a\x0a\x49\x12\x2d\x94\xa7\x22\x1f\x96\x2c\x5d\x12\xb6\x0a\xac\xda\x29\x01\x3b\x6d\xec\x60\xc3\x78\x41\xe3\xeb\x46\x3b\x86\x3e\x85\x56\xd3\x2a\xc7\xc6\x34\x31\xcd\xd7\x40\x33\x4e\x37\xa2\xe4\x81\xf9\x3a\xac\x5a\x43\x6d\xc7\xcc\x9b\xc4\xda\x18\x6a\xde\xa2\x84\xce\xca\x3b\x38\xc6\x59\x1a\x5f\x87\xad\xe5\xea\xa2\xbd\xd4\xf8\x6b\x39\xf8\x6f\xef\xdf\xbc\xae\x57\x63\x34\x82\x17\x33\xc7\xb4\x92\x56\x85\x1e\x65\x80\xc5\x05\x4b\xe7\x69\x4e\x32\xe0\x94\xa5\x94\x03\xfa\x5f\xe6\x85\x80\x65\x25\x88\xa0\x49\x0d\x27\xe4\x52\xaa\x24\x7d\x34\x75\x6f\x29\xe4\x94\x26\xf2\x60\x64\x54\xea\x39\x82\x55\xb1\x80\x54\x28\xd3\xd7\x83\x2c\x31\x42\xb8\x91\xbb\x1e\xda\xd1\xa3\x74\x0e\x46\x72\x2e\x65\xd4\x13\xb9\x89\x1b\x73\xa9\x89\x07\x6d\xb6\x6f\xd1\xe2\x47\xe8\x1d\xf5\x60\x2c\x77\x82\x39\x45\x9b\xd4\xb6\x80\xd4\x2e\x44\xd7\x44\x68\x55\xf8\x7a\x17\xa2\x8a\xfd\x14\xb5\xed\xce\xad\xe8\x6f\x46\x47\x2d\xef\xdc\x90\xce\x7e\x7c\x52\xab\xfd\x1d\x40\x9b\x3b\xd2\x18\x09\x1b\xf7\xa3\xc7\x15\x2e\xd2\xee\xb6\xfc\x9a\xbd\xf6\xd5\xfb\xad\xb5\xe3\xbe\x76\x0f\x7d\xd5\x3e\x6a\xee\x24\x43\xce\xb0\xc3\xb2\xda\xb4\x8f\xda\xb6\x94\xcb\x4e\x3e\x11\x3b\x78\xaa\x63\x64\x9f\x7b\x5a\x76\x76\x0b\x83\x86\x09\xe1\x50\xca\x28\xaf\x0e\xa7\x1a\xbb\x61\x7b\xab\x0e\xf5\x56\x73\xe8\x8c\x64\x9c\x36\x8c\x54\xad\xc7\x58\xe5\xad\x8d\xba\x52\x45\xa6\x78\xb8\x1b\x93\x2a\xbe\x42\x9b\xf0\x32\xe8\x77\x90\xd6\xa8\xc1\x31\xa3\x84\xd3\x77\x5a\x8b\x77\x07\xdd\x06\x3c\xa1\x7b\x00\x4f\x68\x07\xf0\x7d\x51\xa7\x79\xb2\x0f\xe2\x4f\xf3\xe4\x2b\xd1\xde\x01\xd8\x20\xed\x00\xee\xb4\x19\x3a\xf4\x85\x86\x21\xa0\x6c\x52\x59\x17\x30\x5a\x4a\x75\x2d\x18\xc0\x67\x41\xef\xc4\xb8\x03\x1e\xca\xa1\x01\x2c\x0b\xa9\xb7\x05\x53\x3a\x2b\x18\x0d\xd6\x2d\xeb\xc2\x18\x1d\x52\xca\x33\x8a\xdf\xd2\x7c\x5e\x73\xb4\x72\xcc\xc8\x8d\xa9\x84\x56\x87\xbe\x6a\xac\x64\xd9\x48\xeb\xa9\xb6\xc7\xa6\x3d\xa8\x55\x26\x0c\x13\x6c\x61\x57\x6b\x6e\x4b\x19\x20\x75\xbb\x27\x2c\x9d\x09\xc7\xdc\x28\x8b\xb2\xca\x88\xa0\x2f\x70\xea\x72\xd3\xaa\xe9\x73\xcd\xd5\x56\x3a\x3a\xc6\x93\x8b\x42\x6b\xdb\xac\xbb\x5d\xfa\xb5\x6b\xdc\x47\x65\x93\x5a\xd5\x70\x90\xab\xc2\x29\x2b\x6e\x39\x65\xb2\x33\x4c\x20\xa7\xb7\x20\xb5\xce\xb0\x1f\xcd\xa9\x90\x85\x61\x1f\x46\x3a\x4e\x84\x7e\xa9\x88\x7c\x22\x77\x61\x2d\x57\x25\x4a\x45\x32\x86\xe0\xef\x4f\xcf\x83\x81\x2d\xae\x58\xe6\xb9\x8d\xe1\x10\x82\x11\x29\xd3\xd1\xcd\xf1\x08\x99\xf7\x47\xfc\x9c\x08\x1c\xc2\xe9\x28\x8f\xe1\xf3\x55\x29\xf9\xe3\x13\x2f\x72\xa7\x06\xe9\x53\xc5\x31\xe5\x7c\x5c\x4f\x50\x36\x1a\xa0\xeb\x4f\x5a\x3c\x15\xf7\x4f\x18\x45\x6c\xd9\x46\x9e\xd2\xa2\xe2\x70\x6f\x32\x81\x40\x83\x09\x9a\x8d\xeb\x25\x58\x14\xb7\x4f\xa5\x15\x1a\x06\xf8\x07\x10\xdb\x34\x9f\xa3\x79\x10\xf9\x07\x85\x7b\xf6\xfa\xe5\x6b\xef\x9b\x5a\x03\x76\x63\xa9\x8d\x78\xa1\x22\xc2\x28\xaf\x32\x71\x71\x74\x79\xd2\xea\x91\xa4\x33\xb9\x6a\xaf\x88\x58\x44\x64\xca\x43\x77\xc1\x86\x0e\x3c\xc5\x5b\xfe\xc4\xb1\xef\xd9\x04\xbe\x3d\x6a\xcf\xf4\x7e\xd3\x19\x7d\x14\xf4\xa5\xd1\x8e\x4e\xf4\xd6\xec\x00\x82\xd3\x24\xbd\x81\x58\x0a\xfb\xc9\xc7\x80\x64\x94\x09\xc0\xcf\xa1\x36\xbc\x3f\x06\x67\xa7\x5c\xb0\x22\x9f\x9f\xfd\xa2\x4a\xee\x9d\x8e\x74\x01\x3c\xa1\x82\xc6\x82\x26\x10\xc0\x61\x07\x70\x89\x68\x24\x8a\x67\xe9\x1d\x4d\xc2\x87\xfd\xce\x36\x01\x70\xa9\xd9\x25\x1c\xd7\x00\xbb\x28\x6f\x3e\x4c\xa9\xb8\xa5\x34\x87\x55\x51\x59\x86\x46\xad\x10\xfd\xd3\x48\xa1\xc8\x0d\x8f\x32\x9a\x49\xd5\xb2\xc8\x81\xc4\x71\xc5\xa4\xd1\x8b\x20\xb1\x0b\xc2\xc6\x6d\xb4\x44\xff\x6c\x4c\x2a\x4e\xa1\xca\xe9\x5d\xa9\x66\x80\xac\x00\x6a\xc5\x78\x74\x3a\x4a\xd2\x9b\xb3\xa0\x81\x6f\x7f\x13\x1f\xac\x6b\x7e\x46\x2f\xc7\xb8\x4b\xe3\x52\xff\xba\x19\x51\x1e\xb2\x9d\x7c\xa8\xc6\x58\x6f\x8a\x48\xd6\xc2\x62\xa3\x78\xda\x2b\xac\xd6\x10\x00\x9d\xdb\x7f\xdb\xe6\xcf\xc8\x94\x66\xa3\xab\x2b\x29\x9f\xaf\xae\x46\x37\x18\x92\xb4\x3d\x37\xed\xfe\xaf\xdb\xf7\x5f\xb1\xe7\xb7\x13\x99\xdc\x90\x34\x93\x14\x02\xe5\xb4\xe5\xf7\xfc\x9d\xdf\xdc\xf3\xf5\x3a\x4b\xca\x2d\x2d\x59\xed\x46\xaf\x9b\xce\x0a\x06\x21\xaa\xd6\x18\xf9\x84\x14\x4e\x4d\x87\x28\xa3\xf9\x5c\x2c\x4e\x20\x3d\x3c\xec\xc0\xd6\x3d\x51\x2f\x8e\x2e\xad\x1f\x81\x24\x49\x28\xe5\xf7\x1b\xfc\x1e\x6a\x60\x17\xe9\xe5\x00\xea\xff\xf7\x3d\x8e\x39\xf0\x00\xcf\xaa\xdf\x7f\x5f\xbd\x43\xbe\xb6\x71\x40\xf5\x0f\x59\x7e\x8c\x81\xf1\x81\x37\x7d\xd9\xb6\x5d\xbe\x24\xe5\x18\x3e\xaf\x37\x0e\x84\xe7\x9e\xe4\x45\xb2\xa0\x24\x09\xbd\x19\x16\x15\x8b\xe9\xd8\x60\xec\x42\x4d\x05\x5d\xf2\x31\x04\x24\xcb\x02\x7f\x34\x11\x2f\xa8\xbb\x93\x64\xcb\xe6\x6e\x52\x86\xe7\x2d\x85\x05\xb9\xa1\x1a\x73\x5c\x84\xb8\x62\x8c\xe6\x42\xcd\x71\x00\xfc\x3a\x2d\x5b\x72\xb4\x49\x1e\xa5\x7f\x21\x5f\x61\xec\x08\xbf\xb6\x45\xec\x86\x6e\x6e\xa7\xe6\x39\xd2\xea\xb2\x24\xa5\x5c\x8c\xf5\xce\x86\xcc\x2c\x1c\x16\x46\xb3\x34\x13\x94\x85\xf5\x48\x91\xd6\xcf\xc2\x11\x8c\xe6\x03\xe8\xf5\xfa\x96\x2f\x06\x1d\xc7\x60\xc9\xe8\x18\x7a\x46\xa0\xf7\x06\xed\x06\x05\x17\xb2\x85\x11\xf1\xbd\x46\x8b\x75\xeb\x8c\xdc\x80\x72\x34\x2b\xd8\x53\x12\x2f\x6a\x85\x8c\x6d\x3c\x97\x1b\x94\xb9\x60\x91\xb1\xea\x2f\x61\x02\xac\x39\x62\x13\x87\xb5\x7f\x44\x6a\xed\x4e\xb2\x0b\xa4\x79\xe7\x08\x6e\xff\xf5\xe0\xc0\xe3\x54\x26\x5a\x5c\xd7\x56\x3f\x64\x61\x24\xdb\xd6\xd3\x23\x83\x69\x7b\x82\x46\x14\x74\x4e\x73\x7a\x19\xf1\xb8\x60\xea\xc0\xef\xa8\x27\xba\xbe\x39\x7f\x33\x41\x34\xfd\x8f\xe0\x47\x20\x91\xf2\xc5\x3e\x2e\x96\x25\x61\x34\x9c\xf6\x61\x0c\x69\x83\x48\x0d\xa2\x39\x54\xe2\x9b\xc9\xb1\x48\xe7\x8b\x4c\x1e\x98\x2e\x4d\xa0\x73\x2b\x6a\x80\xf7\xc3\x9e\x54\x29\xce\x7a\x26\x08\xde\x9c\x95\xec\x7b\x19\x71\xc1\xa4\x28\x3e\x94\xac\x86\xcd\xfb\x3e\x0e\x5d\x68\x8f\x46\x70\xbe\x48\x39\xba\x84\x30\xd6\xbf\xc0\xe4\x00\x20\x33\x21\x35\x03\x21\x48\xbc\xc0\x43\x74\x41\xc1\xca\x21\x28\xb3\x6a\x9e\xe6\x03\x20\x1c\x52\xe1\xc2\x2a\xc4\x82\xb2\xdb\x94\x53\x98\x32\x4a\xae\x79\xa3\x9f\x99\x2d\xc9\x52\xb1\x8a\x3a\x44\x9d\x17\x44\x71\x90\xde\xa6\x01\xfc\xf1\x83\x69\x6d\x5c\xd6\x3b\xf4\x80\x39\x15\x6f\x6c\xd6\xc7\xee\x83\xbf\x91\x25\x52\xbb\x74\x55\x21\x46\x70\x4d\x6e\x11\x40\xe0\x44\x6a\xb5\xb4\x0e\xac\xa3\xdb\x14\x70\x41\xcb\x66\x09\xfa\xcd\xa4\x3a\x75\xb9\xd9\x8c\x56\x5d\xfa\x11\xf5\xa4\x06\x46\xef\x06\x26\x85\xc3\x35\x7c\xa4\xae\x51\xa7\xa3\x45\xf2\xab\x13\xca\x8b\xd2\xfc\x11\x63\x64\x15\xca\xf2\x81\x37\x9d\xbe\x54\x9e\x1d\xdd\x19\x93\x1b\x34\x14\xd4\x5c\xf4\x51\x0d\x67\xe0\x69\xd8\x9a\x4e\x68\x84\x5e\x3a\x23\x63\x1f\xd7\x69\x54\xc7\xfb\x6c\x27\x93\xc9\xd1\xb0\x10\xdd\x16\x2a\x7a\xd9\x0c\x68\x2a\x1b\x17\xb7\x96\xcd\xa2\xdb\xa5\x0a\x12\xc6\xe9\x13\xa9\x01\xa7\x85\xe7\xfd\xc3\xd5\x3b\xa7\x77\xa2\x66\x07\x2c\x7a\xf7\x54\x1b\x89\xef\xe8\xfc\xe9\x5d\x19\x06\xff\x19\x5e\x1c\x0d\x7f\xb8\x3c\xec\x87\x17\xab\xdb\x64\xb1\xe4\x97\x87\xfd\xfb\x8a\x17\x51\x05\xc2\xb3\x59\xb2\x85\x85\x18\x61\x59\xa8\xc1\xd9\xc8\xca\x3d\xdd\x54\x65\x35\xa0\x5a\x85\xb4\x91\x75\xba\xca\x10\xfb\xde\x04\xbe\x6d\x84\x1f\xbe\x3f\x32\xb1\x13\x39\x2a\x92\x19\x26\x80\xd3\x7b\x91\x0b\x03\xe0\xe2\xf8\xd2\x62\x56\xe5\xa9\x3c\x2c\x4d\xcd\xc3\x4b\x87\x7c\xaa\xff\x37\xed\xc4\x31\x27\xad\xef\x42\x02\xb8\xdc\x49\x61\xcf\xf7\xb4\xf7\x3e\x43\xe2\xbc\xd7\xd6\x8e\x5e\x69\x6f\xad\xc2\x46\xea\x84\x13\x82\xed\x52\x2c\xb7\x64\x03\x76\x29\x9b\x92\xe6\x1e\x0a\xa7\x5d\x28\x6c\x01\x8a\x8a\xa6\xef\xd9\x6c\xe0\xba\xa3\x73\xcb\x91\xdc\x76\x95\xc0\x16\x2f\x63\xad\x89\xbb\x1a\xfa\x7a\x1f\x57\x8a\xe7\xcf\xfb\xd7\x2f\xd8\xee\x95\x82\x21\x1c\xcb\x55\x3d\x53\xab\x3b\x1c\x6e\x5c\xb5\xb3\xff\x3e\xab\x36\xa7\xe2\xa9\x0d\x5f\xef\x5e\x32\x14\x38\x5e\xd0\xfb\xcb\x17\xf0\x0a\x7c\xac\x99\x49\xc3\x58\x62\xa2\x88\x91\x35\x7e\xb8\x65\x77\xd8\x77\xbf\x33\x99\xbd\xff\xba\xc9\xa0\x93\x48\x35\x56\xbe\x79\xdb\xdd\xf1\x49\xf2\xba\x50\xb6\xed\x3b\xd2\x2e\xc1\xc4\xf0\x1d\x88\xf1\x4e\x9c\x10\xd4\xd6\x04\xdc\x7d\xc8\xa2\x11\xda\x53\x92\x3e\xcd\x3b\x82\x5f\x1b\xc8\x92\xd3\x5b\x8d\xb2\x5e\x3a\x43\x20\x97\xc8\x7a\x1b\xea\xb6\x68\x46\xef\xbd\x7f\x61\x04\x0f\x07\xd0\xd3\x8e\xa9\x5e\x27\xbd\x35\x60\xa7\xce\x67\xfd\x3d\x05\xd2\xff\xed\x79\xf3\x6a\x2a\x18\x89\xc5\xff\x53\x93\x77\x5a\xef\x9f\xf4\x1d\x67\x94\x30\xa5\x36\xf7\xfd\x42\xed\x97\xd4\xba\xb8\x23\x05\x5a\x72\xaa\x96\x40\xeb\x83\x66\x80\x4a\x6a\xe5\x61\x47\xb6\x4d\x44\x97\xa5\x58\x85\x7d\x27\xd9\x81\x30\xb1\xc5\xb3\xfe\x5f\x71\x7a\xe8\x24\xd5\x22\xab\xb4\x0e\x67\x95\x9e\xcd\xaa\xb3\xc9\x68\x34\xda\xf7\x65\xd0\x37\xb3\xff\xf2\x45\x79\x9a\x97\xe4\x2e\xc4\xff\xcc\xb2\xa2\x60\xfe\xb9\x32\x82\x87\xdf\x1d\xf5\x07\x70\x6c\x11\xa8\x53\x87\x5a\x12\xc8\x46\x0f\xdc\xc0\x07\x62\xf5\xeb\x82\x79\x61\x0f\x53\x18\x91\xa9\x34\x97\xfb\xae\x46\x57\xb1\xcc\x46\xac\x95\x1f\xcf\x7c\x2d\x09\x23\xcb\x3a\x6f\x3d\x40\x28\xc1\xb8\xa9\x3e\x0f\x6c\x16\x8a\xea\xa0\x02\xb2\x30\xd9\x10\xa7\x86\x1f\xa1\x27\x58\x45\x31\xca\x8a\xd1\x9f\x5e\x23\x76\xd3\x4c\xda\xb7\xfa\xbf\x86\x8f\x6b\x2f\x55\x7f\x4d\x9a\xa1\xb7\xca\x27\x6e\x53\x95\x09\xa6\x1b\x9e\xf8\x40\xa8\xc4\xb1\x5e\x5f\x55\x5b\xb1\x4c\xaa\x0a\x5b\xa2\x2b\x2a\x6e\x19\xe8\xc0\x9a\xa2\x98\xbb\x81\x3a\xbc\xa7\x6e\xc2\x23\x6e\xc3\x77\x94\x97\x45\xce\x69\xbb\xf1\x89\x0a\x76\x7b\x31\x76\x8d\xb1\x50\xdc\x5e\x73\xbe\x1b\x3c\xda\x8d\xf7\x1f\xc6\xf8\xb1\x0a\x5c\xef\xc6\xd9\x06\xe9\x0c\xdf\xa8\xff\x34\x8c\xcd\x5f\x17\xd2\x04\xdb\xe0\xeb\x6e\x6c\x2c\x95\xfc\xa9\x2a\x83\xbe\xe7\x03\xaf\x58\xb6\xcb\xb3\x2d\xcb\xc7\x1a\x89\x7f\xb5\xb7\x1b\x7b\xa1\x13\x62\x4f\xaf\xb6\x1d\xca\xe4\x5a\x6e\x00\x6f\xe5\xac\xdf\xb8\x0b\xa4\x46\x34\xb4\x2e\x72\x7f\xd5\x76\xb9\x4c\xee\x16\x6c\x20\xf7\x47\xd9\xa4\x88\x2c\x93\x96\x62\x80\xd2\xa4\x41\x07\x94\x59\xcc\x73\x17\xca\x3e\x77\x0b\x16\x31\xcd\x41\x98\x24\x74\xaf\xeb\x36\x8e\xf9\x47\x99\xe4\x91\x66\x1f\x45\x4f\xcf\x4f\xd6\x4e\x45\x71\x3b\xab\x55\x93\x96\xb1\xd7\x69\x67\x8c\x82\xde\xd1\xb8\xc2\x4b\x2b\xda\x3b\x1f\xc0\xa1\x04\xdb\x41\x65\x4b\xbd\xb8\x58\x96\x19\x15\x74\x6f\x02\x4e\x36\x10\x70\x7b\xe0\x23\xa9\x3d\x0a\x9d\x01\xe5\x61\x2d\x1f\x4e\xbc\x8e\xa2\x10\x24\x93\xc5\xef\x55\xf2\x17\xde\x09\xdb\xb6\x42\x2a\x6b\x6b\xcb\x32\x6d\xec\xa4\x9d\xcf\x72\x4b\xa2\xfc\x0e\x78\x4c\x32\xc2\x5a\x21\xe1\x36\x4a\xc7\x3b\x17\xb7\xdd\x67\x1b\x0a\xc6\x02\xef\x5c\xfd\x75\xc3\x9d\x68\x75\x8d\x85\x58\x66\x61\xf0\xb2\x20\x2a\x64\xa9\x96\xdf\x12\xfe\x10\x82\x25\x87\xd3\x29\x83\xd1\x19\xbc\xb3\xc7\x87\x6a\xe5\xa8\x0b\x87\x10\x98\x66\xb2\x26\x38\x97\x98\xab\x18\xa8\xca\xbf\x53\x3d\x1a\x13\x72\x58\xac\x33\x73\xa7\x46\x7d\x0f\x37\xa4\x65\x6c\x57\xda\x2f\xf9\x7c\x87\x5d\x21\x7b\x44\x52\x52\x60\xdb\x46\xb9\xd1\xd0\x76\xa5\x4d\x58\x45\xf1\x8f\x8e\xdd\xeb\x35\x87\x36\x34\xd8\x63\xd6\xbf\xd4\xf9\xec\xee\xe0\x7c\xab\x6a\x1f\x17\xb9\xa0\xb9\xd4\x2c\x82\xc0\x7a\x0f\xdc\x18\x22\x9f\x77\xfa\x74\x4c\xbf\xc3\x09\x04\xa7\x59\x8a\xcb\x4d\x79\x4c\x4a\xfa\xfc\xfc\xd5\x4b\x1c\x57\x9a\xf0\x92\x09\x4e\x47\xb2\xde\x3b\x2d\x8d\x08\xd7\x6c\x77\x5a\x65\x08\xc0\x02\x95\x9d\x64\x59\x3b\x59\xbf\x5e\x8b\xdd\x4b\xd1\x45\x90\xed\x4b\xd1\xc0\xab\x6b\x7c\xbb\x20\x5b\xc7\xf7\x12\xa0\xf7\x18\xdf\x55\x05\xe5\x76\x29\x2a\xf1\xe2\x89\xa1\xf5\x6d\x9a\x27\xc5\xad\x9a\xd3\xb9\xaa\x6c\xb6\xb4\x96\x45\xda\xb8\xf4\xd3\xa5\xf7\x37\xb2\xb8\x6b\xe5\x1f\x2d\x18\x03\xc1\xf7\x9c\xda\xeb\x33\x66\x48\x98\x18\xbc\xb8\x12\xc4\x12\xab\xee\x1c\xa8\x0e\xdf\x0c\xa7\x1d\x59\xe2\x72\x0e\x83\x7a\x06\xdf\xe8\x8b\xe5\xbb\xb9\x5f\xdd\xea\x7c\x49\xa6\x34\xf3\x16\x1b\x93\x03\x1c\xfe\xc7\xef\xef\x31\x00\xc4\xf5\x25\x6c\xc7\x5f\x86\xb5\x90\xe6\xe0\x76\x53\x44\x51\x55\xf2\xf8\x37\x99\x06\x8e\x60\x77\xa1\x46\x65\xc5\x17\x61\x60\xe2\x9c\x92\xa9\x55\x5f\x64\x69\x5d\xaa\xcf\xd6\x7a\xb7\xa8\x01\x2f\xf0\x8f\x0d\xa9\xaf\x7d\xaf\x50\x66\x66\xe7\x27\xce\xa8\xe2\x8f\x41\x3d\x94\xc1\xe4\x53\x91\xe6\x61\x70\x3a\x65\x67\x81\xde\x86\x98\x59\xb2\x93\x98\x2a\x02\x74\x5e\x9c\xf3\xd7\x2a\xce\xb1\x91\x9c\xc2\xb4\xd0\x35\x91\x21\x8e\x34\xfb\x7a\x3d\x1c\xf5\x73\x70\xb2\x8d\xf8\x3b\xa9\xbf\x9b\xfc\x1d\xf4\xb7\x24\x9f\x7c\x0c\x2c\x5d\x0c\x7d\x65\xf9\xc7\xc0\xc6\xb7\xf0\x44\x94\x1f\x7a\x36\x87\x93\x2e\x32\x0e\x14\x0d\xd7\x81\xe3\xe8\x52\x1d\xf6\x0b\x8a\xfc\xac\x43\x08\x96\x96\x18\x13\xa8\x49\xa9\x76\x2c\x36\x7d\x96\x15\x44\xe8\x7a\xb3\x29\x53\xfe\x9a\xbc\x96\x65\x7d\xe7\x1e\x6d\x70\xf8\x22\x9f\x05\x03\x08\x86\xfa\x2f\x7e\x87\xdb\x34\xcb\x60\x4a\x15\xb0\x44\x6e\xa7\x02\x5e\x93\xd7\x30\x5d\xb9\xf0\xfb\x11\x9c\x2f\xa8\x01\x15\x93\xbc\x27\x64\x27\xcc\xe0\xa2\xc9\x00\x78\x81\xd7\x59\x40\x2c\xe8\x12\x08\x87\x39\x29\x39\x84\x79\x95\x65\xfd\xc8\xf5\x61\x9a\xc7\x0d\xd6\x5e\xb8\x63\x27\x51\xbc\x8c\xf8\xa6\x5d\xb6\xf5\xc0\x2a\x49\x46\x85\x30\x2e\x90\x77\xfa\xad\x85\xe8\x71\x91\x15\x2c\x7a\xab\x2a\x6b\x7f\x0c\x9a\x01\x8e\x6a\x26\x79\x68\x49\x04\x4b\xef\x02\x5f\x44\xd5\xea\xb0\xce\x58\x49\x39\xe4\x85\x80\x62\x06\xaa\x3d\x06\x68\xef\xc1\xdb\x8c\x12\x4e\x81\xe2\x1d\x66\x02\x71\xc1\x18\x8d\x05\xde\x9e\xa3\x9c\xa7\x45\x6e\x93\xa8\x34\x35\x14\x9f\xaf\x6b\xc7\x2a\x31\x09\x3c\xcc\x86\xa6\x6b\xb9\x29\x78\x33\xd0\x58\xa7\x56\x2a\x2e\xae\x23\x8d\x82\xeb\xbd\x8a\x0a\x27\x2e\x8d\xdd\x14\x3a\x44\x69\xb4\xd0\x13\x57\x54\x71\x27\x01\xa4\xa1\x6f\x9a\xc8\x66\x2d\x9a\x90\x3a\xbe\x48\xa8\x07\xae\xb3\x7f\x2c\x60\x5b\x57\x0b\x31\x4b\x0a\x77\x94\x31\x7e\x0e\xbc\xee\x63\xfd\xd7\xb7\x65\x05\x57\x71\x4e\xee\x53\xca\xd9\x40\xea\x5f\x63\x10\xf9\xef\x6e\xac\x62\x6f\x17\x47\x97\x6e\xc2\xc9\x6a\xec\x9c\x8d\xb8\x33\x15\xb4\x8b\xe3\xcb\x3a\x19\xc0\x66\xc8\xac\xfb\xb5\xb9\x93\x49\x63\x51\x73\x60\x84\x5f\x43\xd5\x43\x39\x03\x90\x1c\xa8\x8a\xb7\x72\x50\xb8\xb3\x71\x55\xa6\x1c\xae\x18\x47\x01\x48\xb2\x0c\x96\x29\xe7\xd2\xfa\xe2\x82\x96\xbc\xbe\x68\x9e\xd3\x5b\xab\xf5\x6b\x91\xa9\xb6\x41\xe1\x98\x33\x56\x88\x0a\xe7\xd8\xb7\x5e\xa3\x13\x10\x70\xea\x97\xd3\x3c\x91\xa5\x87\xcd\xd6\xb4\xf4\xae\xd6\x3c\xca\xb2\xe2\x16\xa1\xcf\xa4\xd0\x90\xe8\x95\x45\x9a\x0b\x48\x73\x95\xe9\x18\xdb\xfc\x04\xd4\x5e\x94\x19\x62\x63\xd8\x12\xc7\x07\x0f\x40\x15\x5f\x94\x05\xbf\x8c\xee\xe0\x54\x8e\xdb\x1a\x56\xf9\x75\xdc\xe5\xb4\x13\x57\x22\xdd\x01\xe2\x98\x0b\x65\x81\x6f\x6e\xe8\x85\x6a\xda\x4e\x0d\x10\x9f\xef\xc6\x20\x06\xa0\x13\xcf\xd6\xfd\x76\xe0\x1c\xc0\x3e\xd0\x62\xfb\xd6\x0b\x5b\xc7\x37\xc8\x4e\xf9\xe6\x5c\xbd\xd9\x3b\x82\xa4\x52\xe9\x1d\x0a\x1a\x3f\xa0\xaf\x86\xe1\x35\x5e\x7c\x9b\x86\xe4\x2b\x10\x8c\xc4\x94\x4b\x31\x45\x72\xa0\x77\xa9\x7a\x77\x02\xc5\x78\xe4\xdf\x0e\xad\xdd\xc9\xce\x70\xf5\xd5\xd2\x78\x91\x66\x09\xa3\x79\xd8\xef\x48\x42\xa8\xdb\x36\x12\xda\xb1\x02\x2f\xab\x7a\x15\xeb\xe6\xad\x57\x9d\x9c\xa3\xd5\x96\x40\x5d\x77\x3d\x33\x19\x38\x27\xcd\x6b\xaf\x8d\xe6\xfa\xbe\x6b\xbb\x7d\x8d\x7e\xeb\xb5\x8e\x5d\x8d\x70\xa8\xda\xb7\x4e\xf3\x44\x7b\xd6\x37\xba\x9c\x25\xe5\x1f\x17\xf9\x8d\xdc\xbb\xa2\x80\x0f\xaf\x5f\xfc\x8a\xa6\x2d\x17\x64\x59\x9a\xd7\x3a\x1c\x5f\xc5\xfe\x81\x8f\x2f\x5f\xe0\xdb\xef\xf5\x08\xc7\x0b\xf3\x70\x4c\xd4\xe1\xf6\x37\x68\x0e\xed\x40\x76\x9a\xbb\xe5\xce\x5b\x92\x60\xb6\x8f\xbe\x0a\x77\x9b\x8a\x05\xa4\xf9\x4d\xca\xd3\x69\x46\x21\x90\xbb\x22\x50\x02\x93\x03\x51\xaf\x71\xc4\x45\x3e\x4b\xe7\x15\xa3\x09\xdc\x0d\xe5\x22\xc0\xb4\xa8\xf2\x84\x20\x00\x9a\xf3\x8a\x51\x6e\xc0\x8b\x05\x11\x8a\xf3\x38\x10\x46\x21\x49\x79\x99\x91\x95\x7e\xdf\x03\x08\xcc\xd2\xbb\x1a\x0e\x52\xc1\xbb\x70\x9e\x93\xb2\xc4\x2c\xaa\x02\x87\xb6\x39\x49\x16\xbe\x9c\xb8\xe9\x86\x4d\xea\x4b\x77\xb5\xf8\xb9\x38\x92\x52\xe6\xac\xa6\x9a\x13\x82\x56\x34\xaa\x72\x7c\x3c\x04\xe5\x81\x6d\xd5\x92\x0b\xeb\x26\x5c\x5f\xba\x0d\xe1\x58\x49\x33\xbd\x22\xad\x51\xac\xc8\xd1\x0d\x3a\x07\xa8\x6f\xe6\xbf\x2e\x6e\x21\x66\x14\x73\xc7\x17\x14\x75\x1b\x7f\x13\xb7\x5e\x95\x72\xb5\x1f\x75\xc7\x4f\x61\xa0\x93\x83\xc6\x0e\xf3\xdb\xf3\x4f\xbd\x1a\x32\xae\x63\x32\xce\xc6\x46\x9f\x8b\x7a\x44\x24\xec\x0f\x50\x1c\x0f\xb4\xf9\x99\x88\xc5\x96\x3e\xbf\xc8\x7a\x74\xc3\xfd\xed\x68\x00\x0f\x6d\x3f\x65\x95\x51\x36\xee\xb8\xd2\xf9\xa3\xce\xcd\x0a\x60\x0c\x41\x96\xe6\xd4\x78\xba\xd1\xfa\x2b\x8b\x8c\x68\xff\x92\xac\x23\x4c\xbb\xb7\x8d\x0f\xc9\xf2\xbb\x2a\x5e\xa6\xb2\x25\xa9\x44\x11\x0c\x3c\xa2\x3e\x4b\xf3\x04\xb3\xf0\x39\xd5\x9c\xd9\xe3\xb0\x24\x77\xa3\x65\x9a\x1f\x6c\xb8\x6c\x2a\x85\xae\x60\x95\xfb\x60\xcd\x2f\x0b\x9a\x9b\x5b\xa5\x52\x2f\x54\x0f\x51\x24\xf6\x2c\x5e\x92\xbb\xfa\x2c\xde\xb2\x17\x45\xed\xf1\xf2\x6e\x43\xc6\x15\x63\xaa\xfc\x95\x0b\x49\xdd\x1d\xd7\x27\x58\x37\x44\x59\xfa\x56\x9e\xc8\x4d\x6f\xab\xad\x88\x56\x70\xd6\x18\xe0\xc1\x03\x70\xab\xef\x35\x75\x47\x54\x75\x1a\x28\x39\x1d\x3a\xfc\xc1\xf6\x28\x95\x94\x38\x9c\xf8\xbd\x35\xb7\xbb\x07\x86\xc7\xcb\x91\x22\xdf\x92\xdc\x7d\x73\x1c\x1d\x7d\xb7\xb9\x59\x9a\x1b\xda\x78\x27\x3d\xae\x00\xd6\xbd\xc8\x67\x69\x9e\x8a\xd5\x49\x63\x65\x86\x7e\xc5\x57\xae\xd0\x7f\xcd\x22\x9c\x22\x8e\xfb\x90\x5e\xcd\x65\x2b\xc1\xbb\xd6\x78\xb9\xe7\xca\x2e\xf7\x5f\xcf\xb5\x73\x21\x1e\xb1\x9a\xe0\x32\x35\x73\x7a\xba\x17\x13\x0e\x6b\xcf\xf6\xc6\xd5\x94\x9f\x43\xd3\xae\xeb\x56\xfb\x66\xe0\xe1\x51\x74\xfc\x4d\x68\xaf\x31\xc9\xc2\xa1\x84\xd7\xaf\x8d\x92\x1d\xc3\xee\x84\xb0\x36\x4e\x35\xc9\x4a\x77\x5a\x35\x69\xcb\xdd\x08\xd5\x1f\x8c\x45\x7c\x56\x52\x66\xdc\x25\xb2\x9d\xcb\x86\xab\x1d\xb0\x7e\xd3\xa2\x7c\x23\x30\x25\xf7\x0a\x96\xd2\x5c\x58\x49\x49\x67\x26\xef\x55\xa4\xf1\xf5\x33\xfd\x24\x06\x66\xec\xab\xf7\x31\xfe\xfd\xd5\x4f\xe7\x83\x8e\x33\x02\xd1\xd1\x67\x84\x7b\x23\xd1\x27\x9d\x7e\x3a\xad\x9e\xc5\xa2\xb8\xa1\xec\x09\x15\x24\xcd\xba\xe7\xf2\xbc\x6e\xb0\xdf\x84\x14\x9a\x7e\x1a\xbc\x92\xf9\x03\xb8\x1b\xc0\xca\x17\x9b\x3a\x49\xa9\x77\xca\x4b\x92\x1b\x55\x51\x16\x06\x98\x03\x6e\x43\x45\x77\xf0\x0d\x2a\x70\xfd\x48\x14\x1f\xce\x1f\x2b\xc7\x4e\xd8\x57\x29\xe0\xb2\xef\x59\xef\xc4\x01\xcb\x6f\x89\x88\x17\x6d\xc0\x38\x8f\x2b\x55\x1b\xa8\xfb\xd1\x93\x60\x4a\xe2\xeb\x39\x93\x2a\xd1\x50\x5b\x87\x2a\xfd\x1c\xc5\x05\x96\xc8\x61\xa4\xe6\xda\x1e\xa8\x76\xbd\xeb\x21\x0f\x41\xcf\x36\xea\xf2\xa7\xa1\x62\xa6\x9c\x6a\x63\x70\x1d\x8c\x2b\x3d\x13\x7d\x6f\xc2\x0c\xe1\xa4\x63\x61\x83\x29\x43\xb2\xd4\x3e\x76\x5b\xa4\xbd\xc2\xb5\x0f\xd5\x47\xa3\xad\xaf\xa0\x37\xc2\x3c\x39\xd3\xb1\xf0\x2f\xb1\xae\x53\x1f\x51\xdd\xac\x42\xb2\x95\x21\x9c\xd1\x9c\xeb\x00\xdd\x43\xfe\x44\x17\xe4\x26\x2d\x58\xa4\x45\xf5\x73\xd3\x21\x84\xbd\x58\x4f\xe1\x35\xd6\x7f\xfd\xc1\xf9\x82\x66\x37\x52\x33\xdd\x6b\xe4\x73\xd4\x0e\xf6\x63\xf8\x4d\xa3\xba\x99\x08\xf6\xb1\xa8\x9d\x4e\x70\x9e\xfe\xfe\x47\x4c\x4e\x5f\x4c\xdd\x6b\xf8\x92\x3a\x24\x81\x35\x0a\x6c\x2a\xc3\x1f\x55\x11\xb7\x68\x05\xb5\xb8\xd9\x23\x5f\xb3\x23\xcd\x64\x47\xb2\x47\x37\x4d\xa4\x6d\xad\xb1\xd0\x0f\x84\x70\x28\x09\xbe\x51\xe8\xbe\x1f\x32\x2b\x98\xd5\x07\x95\xc1\x83\x0e\x53\xe7\xd1\x10\x4e\x6e\xe8\x81\xb6\x8a\x9c\xa7\x42\x1e\xfd\xdb\xa3\x5f\xc1\x04\x6e\xa5\x15\x53\xb0\x84\x32\xf5\xca\xc8\xd0\xfa\x44\x21\x15\xca\x6d\xeb\x8c\xa9\x80\xdd\x4a\x4d\x54\x42\xac\x38\x65\xd2\xc0\x92\xf6\x91\xba\x3f\x82\xf8\xb8\xaf\x75\xd9\x17\x46\xb4\xbf\xd1\x33\x14\xbb\x5f\x26\x41\xe7\xeb\x4e\x77\x44\xa7\xd7\xf4\x75\x81\x68\xa2\x7b\x88\xc3\x4c\x4a\xc4\x86\x27\xb4\xed\x17\x38\x27\x53\xff\x41\x0c\xf7\xcd\x07\x27\x42\x64\x5f\x30\xd9\x8b\x0b\x1a\xa9\x3b\x8d\xfc\x52\xb2\x17\x1f\xa8\x14\xbf\xfa\xf1\x8a\xed\x58\xba\x94\x56\xfe\x70\x13\x20\xf9\xa9\x48\x56\x86\xd4\x0e\x38\xff\xfd\xbc\x2b\xbc\x34\x0b\x62\x5a\x24\xfa\x89\x1e\xec\xe7\xa5\xff\xf1\xdb\x54\xc4\x8b\xb0\x91\x69\xa0\xf0\x8f\x09\xa7\x10\xdc\xd0\x58\x14\x2c\x18\x1f\xb8\xea\xa1\x9f\x12\xe0\xaf\xa0\x19\x46\x3b\x45\x82\x53\xc1\xce\x4e\x45\x02\x71\x91\xc9\xb3\x6a\xd2\x7b\xd8\x3b\x3b\x4d\xcf\x72\xb5\xb0\xa7\xa3\xf4\xec\x74\x24\x12\xf9\xc1\xce\xea\xdb\x41\xcd\xd4\xea\xee\x0b\x03\x1d\xe9\x09\xfe\x6d\x54\x5c\x03\xad\x97\x9a\xdb\xeb\xe9\xa5\x7b\x5a\xda\x60\x53\x97\x47\xda\x3a\xa4\x4f\xb6\x4d\xad\x19\xa4\x56\x20\x75\x70\x4c\x4e\x4d\x37\xd1\x0e\xe7\x8b\xe3\xcb\xba\xca\x9d\xb5\x9a\x27\xde\xdd\x3a\xb1\xf4\xd7\x51\x85\xff\x8f\xe9\x7f\xf3\xc7\xe9\x7f\xd3\xa4\xbf\xbd\x36\x73\x4e\xef\xea\xe4\x02\x0f\xbd\x4f\x0a\xbd\x4f\x70\x0a\x37\xc6\xc3\x6f\x70\xfb\xe4\xdf\x54\xae\x21\x1d\x4e\x6c\xe3\x8b\x4f\x97\x7a\x85\xe0\x7f\xca\x55\x73\xcb\x8f\xd4\xca\x4d\xd9\xe8\x2c\xf0\xdd\xbc\x7f\x92\x35\x1c\x4c\xf6\xe6\x0c\x1d\x83\x51\x9c\xd1\x3d\xba\x6a\xe2\x8d\xe4\xae\xc4\x26\x46\x6c\x0e\x84\x9a\xed\xf6\x81\xb0\x89\x37\x90\x33\x6b\x7f\xcc\xfe\x8e\x41\xb5\x9b\x72\xdc\x79\x1e\x7c\xc8\x79\x55\x96\x05\x13\x34\xd1\xf7\x9f\x30\x7e\xd6\x02\xb2\xf3\x68\x67\x1b\xde\x61\xef\x7a\x4b\xa0\xf9\x58\xb3\xe7\x93\x76\x74\xaa\x77\xdd\xc5\x7b\xab\x5a\xb5\x39\xe5\xe2\xb5\xaa\x11\x23\x53\x7e\xb5\x72\x5f\xd9\x58\xd9\x63\x55\x55\x9d\x4d\xe0\x98\x3e\xfc\x6b\xe3\x42\x48\xb8\x82\x91\x2a\x8f\x44\xe1\xd8\x29\xc1\x6f\x81\xe3\xf6\x68\x42\x39\xde\x00\xe5\xb8\x09\xe5\x3f\xb6\x40\x39\xfe\x5b\x37\x94\xe3\xbf\x35\xa1\x3c\xdd\x06\xe5\xbb\x0d\x50\xbe\x6b\x42\x79\xbb\x0d\xca\xc3\x0d\x50\x1e\x36\xa1\x9c\x6f\x81\xf2\x43\x37\x90\x1f\x9a\x30\xfe\xbe\x05\xc6\xf7\xdd\x30\xbe\x6f\xc2\x78\xb5\x05\x46\xf3\x6e\xa1\x86\xf1\x6d\x13\xc6\xf5\x66\x18\x0d\x08\xab\xae\x76\xde\xd9\xb2\xad\xe1\xa9\x44\x6a\xb8\x89\xf7\x86\x6d\xe6\x5b\x75\x23\xa6\xe1\x6c\xe0\xbe\x61\x9b\xfd\x7e\xdf\x06\x67\x13\xff\x0d\xdb\x0c\x48\xb6\xc2\xd9\xc0\x81\xc3\x36\x0b\xce\xb6\xc2\xd9\xc0\x83\xc3\x36\x13\x96\xdb\xe0\xfc\xd0\x7a\x4d\xcf\x00\x6a\x31\x62\xbe\x0d\xce\x06\x4e\x1c\xb6\x58\xf1\x7f\xff\xaf\x4d\x60\x8e\xe9\x70\x03\x2f\x0e\x5b\xcc\xb8\xdc\x8c\x4b\x17\x8f\x1d\xac\x0f\x0e\xec\x25\x7d\x37\x7b\x00\x41\xd6\x72\x91\xe6\x22\x15\xab\x57\xea\x0d\x0a\x84\x12\x3c\x08\xc6\x10\x3c\x20\xcb\xf2\xc4\x5c\xda\x3e\xc5\x92\x4c\xd8\x82\x33\x2c\x98\xdb\x82\x5e\xd0\x1b\x43\xef\xc1\x3f\xab\x42\x9c\xe8\x97\x24\x82\x5e\x20\x8b\xfe\xf2\xed\x0f\xb6\x64\xa4\x4a\xee\x1e\x3e\x3b\xe9\xd9\xdb\x1a\x1a\x69\x3d\x55\x8d\x5e\xfd\x94\xc5\xc5\x83\xd3\xb3\xa0\xf7\x71\x74\x39\x9a\x0f\x9c\x57\x07\x78\x63\xce\x76\x1a\x17\xfc\xd2\xc4\x87\xfd\x7c\xc0\xb7\xa4\xeb\xb6\x67\xfd\xab\x25\x26\x9c\xdf\x38\x68\x64\xb7\xc6\x4f\x54\x74\x9f\x7c\x08\xa4\xbe\x6e\x8f\x80\x31\xd4\xf8\xe1\xdd\xcb\x3a\xc4\xeb\xb6\xea\xd4\x41\xbd\x06\x2a\x62\xb5\xae\x73\x09\xbd\x5a\xe3\xf6\xc6\xa1\x48\x92\x28\x2f\x06\xe8\xdf\x3f\x39\x50\x0f\x40\x91\x24\xb9\xd2\x4f\x19\xeb\x57\xd1\xbc\xe6\xea\xd1\x68\x59\x34\x80\xcf\xeb\x7e\xfb\xa0\x6d\xcc\xdf\xcc\xa8\x4d\x03\x39\x3b\x9d\x7e\x98\x15\x31\xba\x40\x23\x4e\x09\x53\xbf\x12\x10\x04\x8d\x05\x33\x49\x38\x9a\x7a\x98\xe1\xfe\xd6\xdc\xd8\xe8\x86\x13\xf1\x6a\xaa\xf8\x23\x3c\xee\x47\xbc\xcc\x52\x11\xf6\x1e\xf4\xec\x1d\xa5\x1a\xc6\x73\x9a\x95\xd6\x2d\xd5\x9c\xcc\x3f\x1a\xcd\x42\x37\x95\xa0\x09\x43\x4d\xb8\xee\xc2\x43\x07\xd3\x9d\xd4\x32\x54\x76\xa9\x65\x7e\xd9\xc2\x67\x9c\x36\xae\xca\xc4\x46\x92\xd5\x0f\x79\x39\xcf\xb4\x6b\x87\xb3\xfe\xcd\x0d\xa5\x60\xca\x95\x55\x06\xfa\x87\x77\x2f\xeb\xa5\xed\x3b\xd5\x4a\xff\x6a\xac\x7d\xff\x00\x1f\xb4\xf2\xf7\x83\xe2\xbe\x3a\x72\x7f\x5f\x2f\x6f\x5f\xfb\xb5\xda\xa9\xa5\x26\x1d\xc1\x7a\xbd\xea\x57\x2a\x25\x9d\x46\x23\x78\xfd\xe6\xfc\xe9\xb8\xf1\x72\xc7\x94\xc2\x35\x2d\x05\xbe\xcf\xb2\xca\x63\x15\x9a\x1e\x55\x22\xcd\x46\x5c\x30\xf3\x37\x2e\xf2\x9b\x68\x5e\x8c\x11\xee\xcb\x34\xbf\x7e\x56\xb0\xa7\x36\xc5\x6b\xcb\x1a\x58\x7a\x74\x6f\x5b\x5c\x4e\x25\x7c\xcc\xae\xd5\xd3\xf7\x72\x9b\xe6\x6a\x6f\xe1\x0b\x14\x6e\x3e\x58\x63\xd7\x2b\x0a\xd4\xef\x6e\x98\xa4\x8c\x3f\xcd\x9e\x0e\x88\x37\xd3\x4f\x34\x96\x42\xa8\xc5\xab\x73\x9a\x53\x46\x84\x62\x57\xd5\xcc\x13\x38\x06\x7f\x2f\x1b\xee\xbe\x4a\xfa\x09\x1d\xd8\x26\xef\x57\xfd\x40\x85\x4a\xb7\x7c\xa0\x1f\x12\x5f\xa4\x5c\x14\x6c\x85\xcc\xf1\x5e\x10\x41\xc3\xcf\xeb\x01\x04\xc1\x00\x54\x0a\xc9\x8f\xd2\x80\x71\x88\xba\x73\x8f\x38\x0c\xe9\xae\x90\xe2\xbb\x0e\x19\xed\x2e\x91\x7e\x02\xa9\xee\xd4\x87\xcf\x7a\x5a\x73\x74\x9b\x62\xbb\x8e\x2b\x0a\x9d\x94\x6e\x30\xc8\x3e\x5d\x9a\x92\xf1\x1f\x9e\x18\xb3\xd0\x5c\x99\x61\x39\x0f\x1d\x8d\x34\xf1\xbb\xa8\xd8\x10\x4e\xeb\x45\x7e\x43\xb2\x34\xe9\x10\x3b\xea\xb5\x21\x57\x6c\xa9\x6e\x54\xc4\x66\xa9\x9f\xb1\x62\xf9\x46\x0d\xa0\x01\xb4\x87\x1b\xc0\xd1\x9e\x94\x89\xea\xd1\x55\x10\x0b\x26\x30\xfa\xcf\xf9\xc7\xe4\xf0\x63\x14\x1d\x4e\xa2\xc3\xfb\xa3\xaf\x23\x56\xc7\x0c\x5d\x7a\x21\x47\x9e\x57\x65\x66\xa2\xbe\x7a\x9a\x4e\x79\x6b\xed\xeb\xba\xc6\x49\xf3\xd5\x93\x8b\x04\xe5\xc2\x85\x77\xd2\x7d\xcf\x65\xe7\x24\xb7\xad\xc7\x06\xf6\x18\x28\x96\x7d\x51\xcb\x19\x79\xae\x3a\x0d\x6a\xa5\xa1\x65\x5b\x34\x8e\xd4\x12\x7f\xdb\xe9\xcd\x4c\x4a\x5b\x84\xe7\x3d\x4b\x86\xd0\xd4\xcf\x3f\x85\xce\x90\xe6\x2c\xcd\xab\xe5\x94\xb2\x37\x33\x35\xe8\xb3\x82\x49\x28\x66\x93\xba\xe8\xec\xbd\x0c\x75\x85\xca\x81\xe4\xbf\xa4\x62\x11\xb6\x90\xd4\xc4\xb6\x57\xa6\x34\x05\xb6\xe1\xb3\x9b\x12\xbb\x26\x21\x75\x89\x98\x86\x47\x83\x2d\xf3\xee\x3b\x77\x8b\x1b\xa0\xda\x85\xfe\xe1\xb1\x17\x4d\xac\x6e\xd3\x22\x89\xa6\x85\xfb\xe2\xb3\xff\x54\x53\xad\x6b\x3a\xbb\xfb\xcd\xec\x4d\xae\x4f\xe1\x36\x7e\x76\x9d\x15\x90\x47\x71\x5c\x2d\xab\x8c\x08\xbc\x27\xb5\x87\x30\xd9\xc0\xb1\x70\xa8\xaf\x8c\xb7\xc0\xda\x14\xaf\xfa\x67\xc1\x9a\x8f\x19\x39\xad\xbf\x7a\xab\x6d\x9e\xfc\x6e\x31\xec\xbd\x78\x05\x3e\x73\xb7\xb2\x51\xdc\x45\xac\x7b\xbf\x26\x4b\xfa\x28\x4f\xcc\x95\x02\xa1\x56\x54\x29\xa8\x93\x9e\x73\x80\xd7\xcd\xed\x2f\x21\xba\x7d\xf1\x79\xd8\x46\x63\x03\x34\xa1\x71\x91\xd0\x0f\xef\x5e\x3c\x2e\x96\x65\x91\xd3\xdc\xd0\xd2\x03\x70\x7c\x59\x9b\x4e\x1f\x0f\xa5\xcd\x14\x40\xd0\x37\x2f\xc7\xca\x9d\xe4\xa2\x30\x81\x40\x90\xa9\x73\x73\xc3\x1f\xd2\x3e\x34\xe0\x14\xab\x37\x9b\x05\x99\x42\xca\x31\x35\x6c\x4e\x99\x76\xb4\xba\x0a\xe9\x45\x3d\xcc\xa5\x9d\xea\xcf\xe6\x71\xac\x75\xc7\xf2\xb7\xdf\xb2\xda\xb5\xe8\x4d\x39\xe6\x2e\xb5\xa3\xa8\xe9\x51\x82\xb9\xd4\x4c\x52\xcd\xa6\x41\xd4\xbe\x76\xb3\x6b\xbc\x0e\xf5\xaa\xa5\xb1\x34\x34\x2d\xcb\x65\xa5\xc1\xb0\x5b\x02\xa7\x9e\xf0\xf5\xd5\x3c\xc5\x96\xea\x6b\x74\x4d\x57\xdc\x1b\xa9\xdf\x66\xd2\xeb\xfa\x37\xd8\x1c\x48\x17\x1a\x85\x43\xb8\xa6\xab\x4b\xa3\xab\x6a\x28\x17\xb2\xac\x95\x57\xed\xf4\x56\xc4\xb2\xf6\xb7\x34\x83\xb5\x12\xad\xae\xd0\xbf\xa7\xa2\x2a\x75\xf0\x39\x26\xf1\x82\x8e\xd5\x93\xda\xf5\x62\x7b\x57\xed\x3b\xdf\x8f\xe5\x82\x88\x34\x1e\x7d\xe2\x23\x65\xec\xd8\x9f\x30\x5c\x98\x9f\x35\xfc\xf1\x66\x22\x17\xd1\xfb\x2d\x42\x9d\x87\xd8\xba\x50\x9f\x10\x41\x24\x86\x9a\xb3\xbd\xdf\x17\xd4\x61\x15\x13\x87\xb0\xbf\x45\x88\x0c\xaf\x7a\x9a\x3a\x75\xd7\xe7\x09\x2d\x19\x8d\x89\xa0\xca\x9e\x43\x93\xde\xbf\xe9\x90\xa4\x8c\xc6\xe2\xbc\x78\x95\xce\x25\x8f\x24\xd6\xea\x87\xae\x3c\x78\xfc\x69\x57\xe5\x90\xe8\xb0\x01\x42\x27\x9f\x1e\x99\x52\x91\xbb\x9d\x1d\xaf\xbd\x1c\x68\x5a\x9d\x2f\x28\xa7\x20\x6e\x0b\xfd\x8a\x01\xef\xc6\x1b\x93\x2f\x3b\xd1\xed\x4b\x28\x84\x51\x20\x49\x42\x13\x28\xf2\x6c\x85\xa1\xa1\x29\x89\xaf\x6f\x09\x4b\xf0\x6e\x39\x11\xe9\x34\xcd\x52\xb1\x92\x96\x5b\x91\x99\xb7\x92\x95\xfb\x3d\x72\x18\xa4\x93\x64\x1b\x1d\x05\x0b\xc2\x17\x5b\x34\x9b\xfa\x75\x76\x73\xf8\x29\x69\x98\x3c\x63\x64\xbe\x54\x19\x3b\x1d\xf2\xb1\x6b\x14\x15\xcd\x65\x2b\xbb\x18\x78\x59\x5b\x2f\xbc\x0f\x54\x9f\xc9\xe1\x71\x5f\x09\xbd\x84\x15\x25\x06\xf6\x25\x1c\xf8\x0b\x7a\xe3\x62\x4c\x13\x0a\x69\xcb\xa7\xe8\xa0\x5c\x6b\xe9\x4c\x8a\x3f\xd7\x31\xb7\x81\x6f\xac\xd8\xf8\x73\xd3\xec\x30\x50\xff\xcc\x6c\xbb\x45\x53\xd3\x2b\xe5\x69\x3e\x85\x2f\x0e\xeb\x73\xd3\xca\xc3\x0e\xb1\x2c\xdb\xb8\xe2\xae\xd8\x47\xd2\x6d\x97\x75\x45\x43\xcc\x81\xf7\x0b\x8a\x76\x62\xf8\x22\x48\xb7\x39\xdc\x20\x72\xc7\x2b\x27\x0d\xf3\x17\x17\xfa\x7e\x28\xb7\x6e\xff\xe4\xe0\xff\x04\x00\x00\xff\xff\xc8\x7c\x3e\xa9\xcc\x79\x00\x00")
 
 func pkgQueryUiStaticJsGraphJsBytes() ([]byte, error) {
@@ -792,13 +855,16 @@ func AssetNames() []string {
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
 	"pkg/query/ui/templates/_base.html":                                                             pkgQueryUiTemplates_baseHtml,
+	"pkg/query/ui/templates/bucket.html":                                                            pkgQueryUiTemplatesBucketHtml,
 	"pkg/query/ui/templates/flags.html":                                                             pkgQueryUiTemplatesFlagsHtml,
 	"pkg/query/ui/templates/graph.html":                                                             pkgQueryUiTemplatesGraphHtml,
 	"pkg/query/ui/templates/status.html":                                                            pkgQueryUiTemplatesStatusHtml,
+	"pkg/query/ui/static/css/bucket.css":                                                            pkgQueryUiStaticCssBucketCss,
 	"pkg/query/ui/static/css/graph.css":                                                             pkgQueryUiStaticCssGraphCss,
 	"pkg/query/ui/static/css/prometheus.css":                                                        pkgQueryUiStaticCssPrometheusCss,
 	"pkg/query/ui/static/img/ajax-loader.gif":                                                       pkgQueryUiStaticImgAjaxLoaderGif,
 	"pkg/query/ui/static/img/favicon.ico":                                                           pkgQueryUiStaticImgFaviconIco,
+	"pkg/query/ui/static/js/bucket.js":                                                              pkgQueryUiStaticJsBucketJs,
 	"pkg/query/ui/static/js/graph.js":                                                               pkgQueryUiStaticJsGraphJs,
 	"pkg/query/ui/static/js/graph_template.handlebar":                                               pkgQueryUiStaticJsGraph_templateHandlebar,
 	"pkg/query/ui/static/vendor/bootstrap-3.3.1/css/bootstrap-theme.min.css":                        pkgQueryUiStaticVendorBootstrap331CssBootstrapThemeMinCss,
@@ -871,6 +937,7 @@ var _bintree = &bintree{nil, map[string]*bintree{
 			"ui": &bintree{nil, map[string]*bintree{
 				"static": &bintree{nil, map[string]*bintree{
 					"css": &bintree{nil, map[string]*bintree{
+						"bucket.css":     &bintree{pkgQueryUiStaticCssBucketCss, map[string]*bintree{}},
 						"graph.css":      &bintree{pkgQueryUiStaticCssGraphCss, map[string]*bintree{}},
 						"prometheus.css": &bintree{pkgQueryUiStaticCssPrometheusCss, map[string]*bintree{}},
 					}},
@@ -879,6 +946,7 @@ var _bintree = &bintree{nil, map[string]*bintree{
 						"favicon.ico":     &bintree{pkgQueryUiStaticImgFaviconIco, map[string]*bintree{}},
 					}},
 					"js": &bintree{nil, map[string]*bintree{
+						"bucket.js":                &bintree{pkgQueryUiStaticJsBucketJs, map[string]*bintree{}},
 						"graph.js":                 &bintree{pkgQueryUiStaticJsGraphJs, map[string]*bintree{}},
 						"graph_template.handlebar": &bintree{pkgQueryUiStaticJsGraph_templateHandlebar, map[string]*bintree{}},
 					}},
@@ -933,6 +1001,7 @@ var _bintree = &bintree{nil, map[string]*bintree{
 				}},
 				"templates": &bintree{nil, map[string]*bintree{
 					"_base.html":  &bintree{pkgQueryUiTemplates_baseHtml, map[string]*bintree{}},
+					"bucket.html": &bintree{pkgQueryUiTemplatesBucketHtml, map[string]*bintree{}},
 					"flags.html":  &bintree{pkgQueryUiTemplatesFlagsHtml, map[string]*bintree{}},
 					"graph.html":  &bintree{pkgQueryUiTemplatesGraphHtml, map[string]*bintree{}},
 					"status.html": &bintree{pkgQueryUiTemplatesStatusHtml, map[string]*bintree{}},
@@ -0,0 +1,110 @@
+package ui
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/route"
+)
+
+// Bucket is a web UI showing the blocks of an object storage bucket.
+type Bucket struct {
+	*UI
+
+	refreshInterval time.Duration
+
+	mtx         sync.RWMutex
+	blocks      []block.Meta
+	refreshedAt time.Time
+	err         error
+}
+
+// NewBucketUI returns a bucket UI. Blocks shown by it are updated via Set.
+func NewBucketUI(logger log.Logger, refreshInterval time.Duration) *Bucket {
+	u := New(logger, nil)
+	u.component = "bucket"
+
+	return &Bucket{
+		UI:              u,
+		refreshInterval: refreshInterval,
+	}
+}
+
+// Register registers the bucket UI handlers on the given router.
+func (b *Bucket) Register(r *route.Router) {
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/blocks", http.StatusFound)
+	})
+
+	instrf := prometheus.InstrumentHandlerFunc
+
+	r.Get("/blocks", instrf("blocks", b.root))
+	r.Get("/status", instrf("status", b.status))
+	r.Get("/flags", instrf("flags", b.flags))
+	r.Get("/api/v1/blocks", instrf("api_blocks", b.apiBlocks))
+
+	r.Get("/static/*filepath", instrf("static", b.serveStaticAsset))
+}
+
+// Set updates the blocks shown by the UI. If err is not nil, the previously known
+// blocks are kept and the error is reported instead.
+func (b *Bucket) Set(blocks []block.Meta, err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.err = err
+	if err != nil {
+		return
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		if blocks[i].MinTime == blocks[j].MinTime {
+			return blocks[i].ULID.Compare(blocks[j].ULID) < 0
+		}
+		return blocks[i].MinTime < blocks[j].MinTime
+	})
+	b.blocks = blocks
+	b.refreshedAt = time.Now()
+}
+
+func (b *Bucket) root(w http.ResponseWriter, r *http.Request) {
+	b.executeTemplate(w, "bucket.html", struct {
+		RefreshInterval int64
+	}{
+		RefreshInterval: int64(b.refreshInterval / time.Millisecond),
+	})
+}
+
+type blocksResponse struct {
+	Blocks      []block.Meta `json:"blocks"`
+	RefreshedAt *time.Time   `json:"refreshedAt,omitempty"`
+	Err         string       `json:"err,omitempty"`
+}
+
+func (b *Bucket) apiBlocks(w http.ResponseWriter, r *http.Request) {
+	b.mtx.RLock()
+	resp := blocksResponse{Blocks: b.blocks}
+	if !b.refreshedAt.IsZero() {
+		t := b.refreshedAt
+		resp.RefreshedAt = &t
+	}
+	if b.err != nil {
+		resp.Err = b.err.Error()
+	}
+	b.mtx.RUnlock()
+
+	if resp.Blocks == nil {
+		resp.Blocks = []block.Meta{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		level.Warn(b.logger).Log("msg", "failed to encode blocks response", "err", err)
+	}
+}
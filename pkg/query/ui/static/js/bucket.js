@@ -0,0 +1,181 @@
+var Thanos = Thanos || {};
+
+Thanos.LevelColors = ["#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2"];
+
+Thanos.Blocks = function() {
+  this.blocks = [];
+  this.initialize();
+};
+
+Thanos.Blocks.prototype.initialize = function() {
+  var self = this;
+
+  $("#filter-labels").on("input", function() { self.render(); });
+  $("#filter-level").on("change", function() { self.render(); });
+  $("#filter-resolution").on("change", function() { self.render(); });
+
+  self.refresh();
+  if (REFRESH_INTERVAL > 0) {
+    setInterval(function() { self.refresh(); }, REFRESH_INTERVAL);
+  }
+};
+
+Thanos.Blocks.prototype.refresh = function() {
+  var self = this;
+
+  $.ajax({
+    method: "GET",
+    url: PATH_PREFIX + "/api/v1/blocks",
+    dataType: "json",
+    success: function(json) {
+      self.blocks = json.blocks || [];
+
+      if (json.err) {
+        $("#blocks-error").text("Last refresh failed: " + json.err).removeClass("hidden");
+      } else {
+        $("#blocks-error").addClass("hidden");
+      }
+      if (json.refreshedAt) {
+        $("#blocks-status").text(self.blocks.length + " blocks, refreshed " + moment(json.refreshedAt).fromNow());
+      } else {
+        $("#blocks-status").text("Waiting for the first refresh of the bucket.");
+      }
+
+      self.updateFilterOptions();
+      self.render();
+    },
+    error: function(xhr) {
+      $("#blocks-error").text("Error loading blocks: " + xhr.statusText).removeClass("hidden");
+    }
+  });
+};
+
+Thanos.Blocks.prototype.updateFilterOptions = function() {
+  var levels = {};
+  var resolutions = {};
+
+  this.blocks.forEach(function(b) {
+    levels[b.compaction.level] = true;
+    resolutions[b.thanos.downsample.resolution] = true;
+  });
+
+  var fill = function(sel, values, format) {
+    var current = sel.val();
+    sel.find("option:not(:first)").remove();
+    Object.keys(values).map(Number).sort(function(a, b) { return a - b; }).forEach(function(v) {
+      sel.append($("<option>").val(v).text(format(v)));
+    });
+    sel.val(current);
+  };
+
+  fill($("#filter-level"), levels, function(v) { return v; });
+  fill($("#filter-resolution"), resolutions, Thanos.formatResolution);
+};
+
+Thanos.Blocks.prototype.filtered = function() {
+  var matchers = Thanos.parseMatchers($("#filter-labels").val());
+  var level = $("#filter-level").val();
+  var resolution = $("#filter-resolution").val();
+
+  return this.blocks.filter(function(b) {
+    if (level !== "" && b.compaction.level !== Number(level)) {
+      return false;
+    }
+    if (resolution !== "" && b.thanos.downsample.resolution !== Number(resolution)) {
+      return false;
+    }
+    var lset = b.thanos.labels || {};
+    return matchers.every(function(m) { return lset[m.name] === m.value; });
+  });
+};
+
+Thanos.Blocks.prototype.render = function() {
+  var blocks = this.filtered();
+  var timeline = $("#blocks-timeline").empty();
+  if (blocks.length === 0) {
+    timeline.append($("<p>").text("No blocks found."));
+    return;
+  }
+
+  var minTime = Math.min.apply(null, blocks.map(function(b) { return b.minTime; }));
+  var maxTime = Math.max.apply(null, blocks.map(function(b) { return b.maxTime; }));
+  var span = Math.max(maxTime - minTime, 1);
+  var pos = function(t) { return (100 * (t - minTime) / span) + "%"; };
+
+  var axis = $("<div>").addClass("blocks-axis");
+  for (var i = 0; i <= 4; i++) {
+    var t = minTime + i * span / 4;
+    axis.append($("<span>").css(i === 4 ? {right: 0} : {left: pos(t)}).text(moment.utc(t).format("YYYY-MM-DD HH:mm")));
+  }
+  timeline.append(axis);
+
+  Thanos.groupBlocks(blocks).forEach(function(g) {
+    var group = $("<div>").addClass("blocks-group");
+    group.append($("<div>").addClass("blocks-group-title").text(g.title));
+
+    Object.keys(g.levels).map(Number).sort(function(a, b) { return b - a; }).forEach(function(lvl) {
+      var row = $("<div>").addClass("blocks-row");
+      g.levels[lvl].forEach(function(b) {
+        row.append($("<div>").addClass("block").css({
+          left: pos(b.minTime),
+          width: (100 * (b.maxTime - b.minTime) / span) + "%",
+          "background-color": Thanos.LevelColors[(lvl - 1) % Thanos.LevelColors.length]
+        }).attr("title", Thanos.describeBlock(b)));
+      });
+      group.append(row);
+    });
+    timeline.append(group);
+  });
+};
+
+// groupBlocks groups blocks by external labels and resolution, and within a group by compaction level.
+Thanos.groupBlocks = function(blocks) {
+  var groups = {};
+  blocks.forEach(function(b) {
+    var title = Thanos.formatLabels(b.thanos.labels) + " @ " + Thanos.formatResolution(b.thanos.downsample.resolution);
+    var g = groups[title] = groups[title] || {title: title, levels: {}};
+    (g.levels[b.compaction.level] = g.levels[b.compaction.level] || []).push(b);
+  });
+  return Object.keys(groups).sort().map(function(k) { return groups[k]; });
+};
+
+Thanos.describeBlock = function(b) {
+  return [
+    "ULID: " + b.ulid,
+    "From: " + moment.utc(b.minTime).format(),
+    "Until: " + moment.utc(b.maxTime).format(),
+    "Range: " + moment.duration(b.maxTime - b.minTime).humanize(),
+    "Level: " + b.compaction.level,
+    "Resolution: " + Thanos.formatResolution(b.thanos.downsample.resolution),
+    "Series: " + b.stats.numSeries,
+    "Samples: " + b.stats.numSamples,
+    "Chunks: " + b.stats.numChunks
+  ].join("\n");
+};
+
+Thanos.formatLabels = function(lset) {
+  var names = Object.keys(lset || {}).sort();
+  return "{" + names.map(function(n) { return n + "=\"" + lset[n] + "\""; }).join(", ") + "}";
+};
+
+Thanos.formatResolution = function(res) {
+  if (res === 0) {
+    return "raw";
+  }
+  return moment.duration(res).asMinutes() + "m";
+};
+
+// parseMatchers parses a comma separated list of name="value" equality matchers.
+Thanos.parseMatchers = function(s) {
+  var res = [];
+  var re = /\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*=\s*"([^"]*)"\s*,?/g;
+  var m;
+  while ((m = re.exec(s || "")) !== null) {
+    res.push({name: m[1], value: m[2]});
+  }
+  return res;
+};
+
+$(function() {
+  new Thanos.Blocks();
+});
@@ -23,8 +23,9 @@ import (
 var localhostRepresentations = []string{"127.0.0.1", "localhost"}
 
 type UI struct {
-	logger   log.Logger
-	flagsMap map[string]string
+	logger    log.Logger
+	flagsMap  map[string]string
+	component string
 
 	cwd   string
 	birth time.Time
@@ -46,11 +47,12 @@ func New(logger log.Logger, flagsMap map[string]string) *UI {
 		cwd = "<error retrieving current working directory>"
 	}
 	return &UI{
-		logger:   logger,
-		flagsMap: flagsMap,
-		cwd:      cwd,
-		birth:    time.Now(),
-		now:      model.Now,
+		logger:    logger,
+		flagsMap:  flagsMap,
+		component: "query",
+		cwd:       cwd,
+		birth:     time.Now(),
+		now:       model.Now,
 	}
 }
 
@@ -105,6 +107,7 @@ func (u *UI) tmplFuncs() template.FuncMap {
 		},
 		"pathPrefix":   func() string { return "" },
 		"buildVersion": func() string { return version.Revision },
+		"component":    func() string { return u.component },
 		"stripLabels": func(lset map[string]string, labels ...string) map[string]string {
 			for _, ln := range labels {
 				delete(lset, ln)
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket rate limiter for operations of different costs, e.g. one token per transferred byte.
+// Operations costing more tokens than available put the bucket into debt and wait until it is paid off, so costs
+// larger than the burst do not block forever.
+type Limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mtx    sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a limiter refilled with rate tokens per second up to burst tokens. A burst lower than 1 is
+// treated as 1. A non-positive rate disables the limit.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		now:    time.Now,
+		tokens: float64(burst),
+	}
+}
+
+// reserve takes n tokens and returns the time until they are available.
+func (l *Limiter) reserve(n int) time.Duration {
+	now := l.now()
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// WaitN takes n tokens and blocks until they are available or the context is canceled.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l.rate <= 0 || n <= 0 {
+		return nil
+	}
+	d := l.reserve(n)
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
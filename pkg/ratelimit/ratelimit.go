@@ -0,0 +1,87 @@
+// Package ratelimit limits the rate of operations, e.g. requests of each client or bytes transferred from a bucket.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneInterval is the minimum time between two removals of idle buckets.
+const pruneInterval = time.Minute
+
+// Keyed is a token bucket rate limiter per key. Buckets are refilled with rate tokens per second up to
+// burst tokens, and every operation takes one token.
+type Keyed struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mtx       sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewKeyed returns a limiter allowing rate operations per second for each key, with bursts of up to burst
+// operations. A burst lower than 1 is treated as 1. A non-positive rate disables the limit.
+func NewKeyed(rate float64, burst int) *Keyed {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Keyed{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow reports whether an operation of the key can run now and takes a token if so. Otherwise it returns
+// the time until the next token is available.
+func (k *Keyed) Allow(key string) (bool, time.Duration) {
+	if k.rate <= 0 {
+		return true, 0
+	}
+	now := k.now()
+
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+
+	k.prune(now)
+
+	b, ok := k.buckets[key]
+	if !ok {
+		b = &bucket{tokens: k.burst, last: now}
+		k.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * k.rate
+	if b.tokens > k.burst {
+		b.tokens = k.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / k.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune removes buckets that are full again, as they behave like new ones. It must be called with the mutex held.
+func (k *Keyed) prune(now time.Time) {
+	if now.Sub(k.lastPrune) < pruneInterval {
+		return
+	}
+	k.lastPrune = now
+
+	refill := time.Duration(k.burst / k.rate * float64(time.Second))
+	for key, b := range k.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(k.buckets, key)
+		}
+	}
+}
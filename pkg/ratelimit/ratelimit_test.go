@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+func TestKeyed(t *testing.T) {
+	now := time.Unix(0, 0)
+	k := NewKeyed(2, 3)
+	k.now = func() time.Time { return now }
+
+	// The burst is allowed at once.
+	for i := 0; i < 3; i++ {
+		ok, _ := k.Allow("a")
+		testutil.Assert(t, ok, "request %d of burst rejected", i)
+	}
+	ok, retryAfter := k.Allow("a")
+	testutil.Assert(t, !ok, "request exceeding burst allowed")
+	testutil.Equals(t, 500*time.Millisecond, retryAfter)
+
+	// Other keys have their own bucket.
+	ok, _ = k.Allow("b")
+	testutil.Assert(t, ok, "request of other key rejected")
+
+	// Tokens are refilled at the rate.
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = k.Allow("a")
+	testutil.Assert(t, ok, "request after refill rejected")
+	ok, _ = k.Allow("a")
+	testutil.Assert(t, !ok, "request exceeding refill allowed")
+
+	// Full buckets are pruned.
+	now = now.Add(2 * pruneInterval)
+	ok, _ = k.Allow("c")
+	testutil.Assert(t, ok, "request of new key rejected")
+	testutil.Equals(t, 1, len(k.buckets))
+}
+
+func TestKeyed_Unlimited(t *testing.T) {
+	k := NewKeyed(0, 1)
+	for i := 0; i < 100; i++ {
+		ok, _ := k.Allow("a")
+		testutil.Assert(t, ok, "request %d rejected", i)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter(100, 200)
+	l.now = func() time.Time { return now }
+
+	// The burst is available at once.
+	testutil.Equals(t, time.Duration(0), l.reserve(150))
+	testutil.Equals(t, time.Duration(0), l.reserve(50))
+
+	// Costs exceeding the available tokens wait for the debt to be paid off.
+	testutil.Equals(t, 3*time.Second, l.reserve(300))
+	now = now.Add(time.Second)
+	testutil.Equals(t, 3*time.Second, l.reserve(100))
+
+	// Tokens are refilled at the rate up to the burst.
+	now = now.Add(time.Hour)
+	testutil.Equals(t, time.Duration(0), l.reserve(200))
+	testutil.Equals(t, 10*time.Millisecond, l.reserve(1))
+
+	// Canceled waits return the error of the context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	testutil.Equals(t, context.Canceled, l.WaitN(ctx, 1))
+
+	testutil.Ok(t, NewLimiter(0, 1).WaitN(ctx, 1000))
+}
@@ -0,0 +1,313 @@
+// Package replicate copies blocks from one object storage bucket into another.
+package replicate
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// BlockFilter selects blocks to be replicated based on their meta.
+type BlockFilter struct {
+	// Matchers that must all match the external labels of the block.
+	Matchers []*labels.Matcher
+	// Resolutions allowed for the block. Empty means any resolution.
+	Resolutions []int64
+	// Compaction levels allowed for the block. Empty means any level.
+	Levels []int
+	// MinTime and MaxTime restrict replication to blocks that overlap with the given time range.
+	// Zero means no restriction.
+	MinTime, MaxTime int64
+}
+
+// Match returns true if the block described by the given meta should be replicated.
+func (f *BlockFilter) Match(m *block.Meta) bool {
+	for _, matcher := range f.Matchers {
+		if !matcher.Matches(m.Thanos.Labels[matcher.Name]) {
+			return false
+		}
+	}
+	if len(f.Resolutions) > 0 && !containsInt64(f.Resolutions, m.Thanos.Downsample.Resolution) {
+		return false
+	}
+	if len(f.Levels) > 0 && !containsInt(f.Levels, m.Compaction.Level) {
+		return false
+	}
+	if f.MinTime != 0 && m.MaxTime <= f.MinTime {
+		return false
+	}
+	if f.MaxTime != 0 && m.MinTime >= f.MaxTime {
+		return false
+	}
+	return true
+}
+
+func containsInt64(s []int64, v int64) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(s []int, v int) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+type metrics struct {
+	runs               prometheus.Counter
+	runFailures        prometheus.Counter
+	blocksReplicated   prometheus.Counter
+	blocksAlreadyExist prometheus.Counter
+	objectsReplicated  prometheus.Counter
+	bytesReplicated    prometheus.Counter
+	blocksRemaining    prometheus.Gauge
+	lastSuccess        prometheus.Gauge
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	var m metrics
+
+	m.runs = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "thanos_replicate_runs_total",
+		Help: "Total number of replication runs.",
+	})
+	m.runFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "thanos_replicate_run_failures_total",
+		Help: "Total number of failed replication runs.",
+	})
+	m.blocksReplicated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "thanos_replicate_blocks_replicated_total",
+		Help: "Total number of blocks replicated into the target bucket.",
+	})
+	m.blocksAlreadyExist = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "thanos_replicate_blocks_already_replicated_total",
+		Help: "Total number of blocks skipped because they already exist in the target bucket.",
+	})
+	m.objectsReplicated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "thanos_replicate_objects_replicated_total",
+		Help: "Total number of objects replicated into the target bucket.",
+	})
+	m.bytesReplicated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "thanos_replicate_bytes_replicated_total",
+		Help: "Total number of bytes replicated into the target bucket.",
+	})
+	m.blocksRemaining = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_replicate_blocks_remaining",
+		Help: "Number of blocks left to be replicated by the current run.",
+	})
+	m.lastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_replicate_last_successful_run_timestamp_seconds",
+		Help: "Unix timestamp of the last successful replication run.",
+	})
+
+	if reg != nil {
+		reg.MustRegister(
+			m.runs,
+			m.runFailures,
+			m.blocksReplicated,
+			m.blocksAlreadyExist,
+			m.objectsReplicated,
+			m.bytesReplicated,
+			m.blocksRemaining,
+			m.lastSuccess,
+		)
+	}
+	return &m
+}
+
+// Replicator copies blocks matching a filter from one bucket into another.
+// Replication is idempotent. Blocks that already have a meta file in the target bucket are skipped
+// and the meta file is always copied last, so blocks partially copied by a failed run are copied
+// again by the next one.
+type Replicator struct {
+	logger  log.Logger
+	from    objstore.BucketReader
+	to      objstore.Bucket
+	filter  BlockFilter
+	state   *State
+	metrics *metrics
+}
+
+// New returns a new replicator copying blocks matched by filter from one bucket into another.
+// If state is not nil, replicated blocks are recorded in it and blocks recorded in it are skipped
+// without checking the source and target bucket.
+func New(logger log.Logger, reg prometheus.Registerer, from objstore.BucketReader, to objstore.Bucket, filter BlockFilter, state *State) *Replicator {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &Replicator{
+		logger:  logger,
+		from:    from,
+		to:      to,
+		filter:  filter,
+		state:   state,
+		metrics: newMetrics(reg),
+	}
+}
+
+// Replicate runs a single replication pass over all blocks in the source bucket.
+func (r *Replicator) Replicate(ctx context.Context) error {
+	r.metrics.runs.Inc()
+
+	if err := r.replicate(ctx); err != nil {
+		r.metrics.runFailures.Inc()
+		return err
+	}
+	r.metrics.lastSuccess.Set(float64(time.Now().UnixNano()) / 1e9)
+	return nil
+}
+
+func (r *Replicator) replicate(ctx context.Context) error {
+	var ids []ulid.ULID
+	err := r.from.Iter(ctx, "", func(name string) error {
+		id, ok := block.IsBlockDir(name)
+		if !ok {
+			return nil
+		}
+		if r.state != nil && r.state.Replicated(id) {
+			return nil
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "iterate source bucket")
+	}
+
+	var toReplicate []ulid.ULID
+	for _, id := range ids {
+		// Blocks without meta file are either still being uploaded or broken. Skip them.
+		ok, err := r.from.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+		if err != nil {
+			return errors.Wrapf(err, "check meta file for %s", id)
+		}
+		if !ok {
+			level.Debug(r.logger).Log("msg", "skipping block without meta file", "block", id)
+			continue
+		}
+
+		meta, err := block.DownloadMeta(ctx, r.from, id)
+		if err != nil {
+			return errors.Wrapf(err, "download meta for %s", id)
+		}
+		if !r.filter.Match(&meta) {
+			continue
+		}
+
+		ok, err = r.to.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+		if err != nil {
+			return errors.Wrapf(err, "check meta file for %s in target bucket", id)
+		}
+		if ok {
+			r.metrics.blocksAlreadyExist.Inc()
+			if err := r.markReplicated(id); err != nil {
+				return err
+			}
+			continue
+		}
+		toReplicate = append(toReplicate, id)
+	}
+
+	r.metrics.blocksRemaining.Set(float64(len(toReplicate)))
+	for i, id := range toReplicate {
+		level.Info(r.logger).Log("msg", "replicating block", "block", id, "remaining", len(toReplicate)-i)
+
+		begin := time.Now()
+		n, err := r.copyBlock(ctx, id)
+		if err != nil {
+			return errors.Wrapf(err, "replicate block %s", id)
+		}
+		if err := r.markReplicated(id); err != nil {
+			return err
+		}
+		r.metrics.blocksReplicated.Inc()
+		r.metrics.blocksRemaining.Dec()
+
+		elapsed := time.Since(begin)
+		level.Info(r.logger).Log("msg", "replicated block", "block", id, "bytes", n, "duration", elapsed,
+			"bytesPerSecond", int64(float64(n)/elapsed.Seconds()))
+	}
+	return nil
+}
+
+func (r *Replicator) markReplicated(id ulid.ULID) error {
+	if r.state == nil {
+		return nil
+	}
+	return errors.Wrapf(r.state.Add(id), "record %s as replicated", id)
+}
+
+// copyBlock copies all objects of the block and returns the number of copied bytes.
+// The meta file is copied last to mark the block as complete.
+func (r *Replicator) copyBlock(ctx context.Context, id ulid.ULID) (int64, error) {
+	var (
+		metaFile = path.Join(id.String(), block.MetaFilename)
+		total    int64
+	)
+	var copyDir func(dir string) error
+	copyDir = func(dir string) error {
+		return r.from.Iter(ctx, dir, func(name string) error {
+			if strings.HasSuffix(name, objstore.DirDelim) {
+				return copyDir(name)
+			}
+			if name == metaFile {
+				return nil
+			}
+			n, err := r.copyObject(ctx, name)
+			total += n
+			return err
+		})
+	}
+	if err := copyDir(id.String() + objstore.DirDelim); err != nil {
+		return total, err
+	}
+	n, err := r.copyObject(ctx, metaFile)
+	return total + n, err
+}
+
+func (r *Replicator) copyObject(ctx context.Context, name string) (int64, error) {
+	rc, err := r.from.Get(ctx, name)
+	if err != nil {
+		return 0, errors.Wrapf(err, "get %s", name)
+	}
+	defer rc.Close()
+
+	cr := &countingReader{r: rc}
+	err = r.to.Upload(ctx, name, cr)
+	r.metrics.bytesReplicated.Add(float64(cr.n))
+	if err != nil {
+		return cr.n, errors.Wrapf(err, "upload %s", name)
+	}
+	r.metrics.objectsReplicated.Inc()
+	return cr.n, nil
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,152 @@
+package replicate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/tsdb"
+)
+
+func uploadBlock(t *testing.T, bkt *inmem.Bucket, id uint64, lset map[string]string, res int64, lvl int, mint, maxt int64) ulid.ULID {
+	ctx := context.Background()
+
+	m := block.Meta{
+		Version: 1,
+		BlockMeta: tsdb.BlockMeta{
+			ULID:    ulid.MustNew(id, nil),
+			MinTime: mint,
+			MaxTime: maxt,
+		},
+	}
+	m.Compaction.Level = lvl
+	m.Thanos.Labels = lset
+	m.Thanos.Downsample.Resolution = res
+
+	var buf bytes.Buffer
+	testutil.Ok(t, json.NewEncoder(&buf).Encode(&m))
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(m.ULID.String(), block.IndexFilename), bytes.NewReader([]byte("index"))))
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(m.ULID.String(), block.ChunksDirname, "000001"), bytes.NewReader([]byte("chunks"))))
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(m.ULID.String(), block.MetaFilename), &buf))
+	return m.ULID
+}
+
+func equalMatcher(t *testing.T, name, value string) *labels.Matcher {
+	m, err := labels.NewMatcher(labels.MatchEqual, name, value)
+	testutil.Ok(t, err)
+	return m
+}
+
+func TestBlockFilter_Match(t *testing.T) {
+	m := &block.Meta{BlockMeta: tsdb.BlockMeta{MinTime: 100, MaxTime: 200}}
+	m.Compaction.Level = 2
+	m.Thanos.Labels = map[string]string{"cluster": "eu1"}
+	m.Thanos.Downsample.Resolution = 300000
+
+	for _, c := range []struct {
+		filter BlockFilter
+		match  bool
+	}{
+		{filter: BlockFilter{}, match: true},
+		{filter: BlockFilter{Matchers: []*labels.Matcher{equalMatcher(t, "cluster", "eu1")}}, match: true},
+		{filter: BlockFilter{Matchers: []*labels.Matcher{equalMatcher(t, "cluster", "us1")}}, match: false},
+		{filter: BlockFilter{Resolutions: []int64{0, 300000}}, match: true},
+		{filter: BlockFilter{Resolutions: []int64{0}}, match: false},
+		{filter: BlockFilter{Levels: []int{1}}, match: false},
+		{filter: BlockFilter{MinTime: 150, MaxTime: 160}, match: true},
+		{filter: BlockFilter{MinTime: 200}, match: false},
+		{filter: BlockFilter{MaxTime: 100}, match: false},
+	} {
+		testutil.Equals(t, c.match, c.filter.Match(m))
+	}
+}
+
+func TestReplicator_Replicate(t *testing.T) {
+	ctx := context.Background()
+
+	from := inmem.NewBucket()
+	to := inmem.NewBucket()
+
+	eu1 := map[string]string{"cluster": "eu1"}
+	us1 := map[string]string{"cluster": "us1"}
+
+	id1 := uploadBlock(t, from, 1, eu1, 0, 1, 0, 10)
+	id2 := uploadBlock(t, from, 2, eu1, 0, 2, 10, 20)
+	uploadBlock(t, from, 3, us1, 0, 1, 0, 10)
+
+	// Partial block without meta file must not be replicated.
+	testutil.Ok(t, from.Upload(ctx, path.Join(ulid.MustNew(4, nil).String(), block.IndexFilename), bytes.NewReader([]byte("index"))))
+
+	r := New(nil, nil, from, to, BlockFilter{
+		Matchers: []*labels.Matcher{equalMatcher(t, "cluster", "eu1")},
+	}, nil)
+
+	// Simulate a previously failed run that left a block without meta file behind.
+	testutil.Ok(t, to.Upload(ctx, path.Join(id2.String(), block.IndexFilename), bytes.NewReader([]byte("broken"))))
+
+	testutil.Ok(t, r.Replicate(ctx))
+
+	var expected []string
+	for _, id := range []ulid.ULID{id1, id2} {
+		expected = append(expected,
+			path.Join(id.String(), block.ChunksDirname, "000001"),
+			path.Join(id.String(), block.IndexFilename),
+			path.Join(id.String(), block.MetaFilename),
+		)
+	}
+	for _, name := range expected {
+		testutil.Equals(t, from.Objects()[name], to.Objects()[name])
+	}
+	testutil.Equals(t, len(expected), len(to.Objects()))
+
+	// Second run must not copy anything again.
+	testutil.Ok(t, to.Upload(ctx, path.Join(id1.String(), block.IndexFilename), bytes.NewReader([]byte("modified"))))
+	testutil.Ok(t, r.Replicate(ctx))
+	testutil.Equals(t, []byte("modified"), to.Objects()[path.Join(id1.String(), block.IndexFilename)])
+}
+
+func TestReplicator_ReplicateWithState(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "test-replicate-state")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	from := inmem.NewBucket()
+	to := inmem.NewBucket()
+
+	id1 := uploadBlock(t, from, 1, nil, 0, 1, 0, 10)
+	id2 := uploadBlock(t, from, 2, nil, 0, 1, 10, 20)
+
+	stateFile := filepath.Join(dir, "state.json")
+	state, err := LoadState(stateFile)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, state.Len())
+
+	testutil.Ok(t, New(nil, nil, from, to, BlockFilter{}, state).Replicate(ctx))
+	testutil.Equals(t, 6, len(to.Objects()))
+
+	// Replicated blocks are skipped after restart even if they are removed from the target bucket.
+	testutil.Ok(t, to.Delete(ctx, path.Join(id1.String(), block.MetaFilename)))
+	id3 := uploadBlock(t, from, 3, nil, 0, 1, 20, 30)
+
+	state, err = LoadState(stateFile)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, state.Len())
+	testutil.Assert(t, state.Replicated(id1), "block %s not recorded as replicated", id1)
+	testutil.Assert(t, state.Replicated(id2), "block %s not recorded as replicated", id2)
+
+	testutil.Ok(t, New(nil, nil, from, to, BlockFilter{}, state).Replicate(ctx))
+	testutil.Equals(t, 8, len(to.Objects()))
+	testutil.Assert(t, state.Replicated(id3), "block %s not recorded as replicated", id3)
+}
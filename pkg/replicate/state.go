@@ -0,0 +1,107 @@
+package replicate
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+)
+
+const stateVersion1 = 1
+
+// State records blocks that were already replicated. It is persisted in a local file, so
+// replication resumed after a restart does not need to check every block in the target bucket again.
+type State struct {
+	path string
+
+	mtx        sync.Mutex
+	replicated map[ulid.ULID]struct{}
+}
+
+type stateFile struct {
+	Version    int         `json:"version"`
+	Replicated []ulid.ULID `json:"replicated"`
+}
+
+// LoadState reads the state from the given file. If the file does not exist, an empty state is returned.
+func LoadState(path string) (*State, error) {
+	s := &State{
+		path:       path,
+		replicated: map[ulid.ULID]struct{}{},
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "read state file %s", path)
+	}
+
+	var f stateFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, errors.Wrapf(err, "decode state file %s", path)
+	}
+	if f.Version != stateVersion1 {
+		return nil, errors.Errorf("unexpected state file version %d", f.Version)
+	}
+	for _, id := range f.Replicated {
+		s.replicated[id] = struct{}{}
+	}
+	return s, nil
+}
+
+// Replicated returns true if the block was already replicated.
+func (s *State) Replicated(id ulid.ULID) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	_, ok := s.replicated[id]
+	return ok
+}
+
+// Add records the block as replicated and persists the state.
+func (s *State) Add(id ulid.ULID) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, ok := s.replicated[id]; ok {
+		return nil
+	}
+	s.replicated[id] = struct{}{}
+	return s.save()
+}
+
+// Len returns the number of replicated blocks.
+func (s *State) Len() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return len(s.replicated)
+}
+
+// save writes the state into a temporary file first, so an interrupted write does not corrupt it.
+func (s *State) save() error {
+	f := stateFile{Version: stateVersion1}
+	for id := range s.replicated {
+		f.Replicated = append(f.Replicated, id)
+	}
+	sort.Slice(f.Replicated, func(i, j int) bool { return f.Replicated[i].Compare(f.Replicated[j]) < 0 })
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		return errors.Wrap(err, "encode state")
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return errors.Wrapf(err, "write state file %s", tmp)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return errors.Wrapf(err, "rename state file %s", tmp)
+	}
+	return nil
+}
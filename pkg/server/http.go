@@ -0,0 +1,275 @@
+// Package server contains the HTTP server shared by all Thanos components. It serves the registered handlers with
+// request logging, metrics, optional TLS and basic authentication, and the /-/healthy and /-/ready probes.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	thanostls "github.com/improbable-eng/thanos/pkg/tls"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/alecthomas/kingpin.v2"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// HTTPFlags holds paths to the HTTP server configuration files.
+type HTTPFlags struct {
+	WebConfigFile            string
+	RequestLoggingConfigFile string
+}
+
+// RegisterHTTPFlags registers the HTTP server flags and returns an initialized HTTPFlags struct.
+func RegisterHTTPFlags(cmd *kingpin.CmdClause) *HTTPFlags {
+	var f HTTPFlags
+
+	cmd.Flag("http.config", "Path to YAML file with TLS and basic authentication configuration of the HTTP server. See docs/http.md for the format.").
+		Default("").StringVar(&f.WebConfigFile)
+	cmd.Flag("http.request-logging-config", "Path to YAML file with request logging configuration of the HTTP server. If empty, no requests are logged.").
+		Default("").StringVar(&f.RequestLoggingConfigFile)
+
+	return &f
+}
+
+// TLSServerConfig holds TLS files of the HTTP server.
+type TLSServerConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+// WebConfig configures TLS and basic authentication of the HTTP server.
+type WebConfig struct {
+	TLSServerConfig TLSServerConfig `yaml:"tls_server_config"`
+	// BasicAuthUsers maps user names to bcrypt hashes of their passwords.
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+}
+
+// ParseWebConfig parses web configuration in YAML.
+func ParseWebConfig(b []byte) (*WebConfig, error) {
+	c := &WebConfig{}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, errors.Wrap(err, "parse web config")
+	}
+	for user, hash := range c.BasicAuthUsers {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, errors.Wrapf(err, "invalid bcrypt hash of user %s", user)
+		}
+	}
+	return c, nil
+}
+
+func (f *HTTPFlags) webConfig() (*WebConfig, error) {
+	if f.WebConfigFile == "" {
+		return &WebConfig{}, nil
+	}
+	b, err := ioutil.ReadFile(f.WebConfigFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "read web config file")
+	}
+	return ParseWebConfig(b)
+}
+
+func (f *HTTPFlags) requestLoggingConfig() (*RequestLoggingConfig, error) {
+	if f.RequestLoggingConfigFile == "" {
+		return &RequestLoggingConfig{Default: NoLog}, nil
+	}
+	b, err := ioutil.ReadFile(f.RequestLoggingConfigFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "read request logging config file")
+	}
+	return ParseRequestLoggingConfig(b)
+}
+
+// HTTPServer serves HTTP endpoints of a component.
+type HTTPServer struct {
+	logger  log.Logger
+	mux     *http.ServeMux
+	srv     *http.Server
+	tlsCfg  *tls.Config
+	users   map[string]string
+	logging *RequestLoggingConfig
+	ready   int32
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewHTTPServer returns HTTP server configured by the given flags. The server is not ready until Ready is called.
+func NewHTTPServer(logger log.Logger, reg prometheus.Registerer, flags *HTTPFlags) (*HTTPServer, error) {
+	webCfg, err := flags.webConfig()
+	if err != nil {
+		return nil, err
+	}
+	logging, err := flags.requestLoggingConfig()
+	if err != nil {
+		return nil, err
+	}
+	return newHTTPServer(logger, reg, webCfg, logging)
+}
+
+func newHTTPServer(logger log.Logger, reg prometheus.Registerer, webCfg *WebConfig, logging *RequestLoggingConfig) (*HTTPServer, error) {
+	tlsCfg, err := thanostls.NewServerConfig(webCfg.TLSServerConfig.CertFile, webCfg.TLSServerConfig.KeyFile, webCfg.TLSServerConfig.ClientCAFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "TLS config")
+	}
+
+	s := &HTTPServer{
+		logger:  logger,
+		mux:     http.NewServeMux(),
+		tlsCfg:  tlsCfg,
+		users:   webCfg.BasicAuthUsers,
+		logging: logging,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_http_requests_total",
+			Help: "Total number of HTTP requests by handler, method and status code.",
+		}, []string{"handler", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "thanos_http_request_duration_seconds",
+			Help:    "Duration of HTTP requests by handler and method.",
+			Buckets: []float64{0.001, 0.01, 0.05, 0.1, 0.2, 0.4, 0.8, 1.6, 3.2, 6.4, 12.8, 25.6, 51.2, 102.4},
+		}, []string{"handler", "method"}),
+	}
+	s.srv = &http.Server{Handler: s.mux}
+	if reg != nil {
+		reg.MustRegister(s.requests, s.duration)
+	}
+
+	// Probes are not authenticated, so they can be used by orchestrators without credentials.
+	s.mux.Handle("/-/healthy", s.instrument("/-/healthy", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Thanos is Healthy.\n"))
+	})))
+	s.mux.Handle("/-/ready", s.instrument("/-/ready", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !s.IsReady() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("Thanos is not ready.\n"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Thanos is Ready.\n"))
+	})))
+	return s, nil
+}
+
+// Handle registers the handler for the given pattern. Requests are authenticated, logged and instrumented.
+func (s *HTTPServer) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, s.authenticate(s.instrument(pattern, h)))
+}
+
+// TLSEnabled returns true if the server serves TLS.
+func (s *HTTPServer) TLSEnabled() bool {
+	return s.tlsCfg != nil
+}
+
+// Ready marks the server as ready to serve traffic.
+func (s *HTTPServer) Ready() {
+	atomic.StoreInt32(&s.ready, 1)
+}
+
+// IsReady returns true if the server is ready to serve traffic.
+func (s *HTTPServer) IsReady() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
+// Serve serves HTTP requests on the listener until Shutdown is called.
+func (s *HTTPServer) Serve(l net.Listener) error {
+	if s.tlsCfg != nil {
+		l = tls.NewListener(l, s.tlsCfg)
+	}
+	if err := s.srv.Serve(l); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops the server. In-flight requests are given some time to finish.
+func (s *HTTPServer) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.srv.Shutdown(ctx); err != nil {
+		level.Warn(s.logger).Log("msg", "graceful shutdown of HTTP server failed", "err", err)
+		s.srv.Close()
+	}
+}
+
+func (s *HTTPServer) authenticate(next http.Handler) http.Handler {
+	if len(s.users) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if ok {
+			if hash, exists := s.users[user]; exists && bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="thanos"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+func (s *HTTPServer) instrument(handlerName string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		begin := time.Now()
+		rw := &responseWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(rw, r)
+		took := time.Since(begin)
+
+		s.requests.WithLabelValues(handlerName, r.Method, strconv.Itoa(rw.code)).Inc()
+		s.duration.WithLabelValues(handlerName, r.Method).Observe(took.Seconds())
+
+		if s.logging.decision(r.Method, r.URL.Path).shouldLog(rw.code) {
+			level.Info(s.logger).Log(
+				"msg", "HTTP request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"code", rw.code,
+				"bytes", rw.bytes,
+				"duration", took,
+				"remote", r.RemoteAddr,
+			)
+		}
+	})
+}
+
+// responseWriter records the status code and size of the response.
+type responseWriter struct {
+	http.ResponseWriter
+	code        int
+	bytes       int
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Flush implements http.Flusher if the wrapped writer supports it.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
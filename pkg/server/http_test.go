@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func serve(s *HTTPServer, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHTTPServer_Probes(t *testing.T) {
+	s, err := newHTTPServer(log.NewNopLogger(), nil, &WebConfig{}, &RequestLoggingConfig{Default: NoLog})
+	testutil.Ok(t, err)
+
+	testutil.Equals(t, http.StatusOK, serve(s, httptest.NewRequest("GET", "/-/healthy", nil)).Code)
+	testutil.Equals(t, http.StatusServiceUnavailable, serve(s, httptest.NewRequest("GET", "/-/ready", nil)).Code)
+
+	s.Ready()
+	testutil.Equals(t, http.StatusOK, serve(s, httptest.NewRequest("GET", "/-/ready", nil)).Code)
+}
+
+func TestHTTPServer_BasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	testutil.Ok(t, err)
+
+	webCfg, err := ParseWebConfig([]byte("basic_auth_users:\n  alice: " + string(hash)))
+	testutil.Ok(t, err)
+	s, err := newHTTPServer(log.NewNopLogger(), nil, webCfg, &RequestLoggingConfig{Default: NoLog})
+	testutil.Ok(t, err)
+	s.Handle("/metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	testutil.Equals(t, http.StatusUnauthorized, serve(s, req).Code)
+
+	req.SetBasicAuth("alice", "wrong")
+	testutil.Equals(t, http.StatusUnauthorized, serve(s, req).Code)
+
+	req.SetBasicAuth("bob", "secret")
+	testutil.Equals(t, http.StatusUnauthorized, serve(s, req).Code)
+
+	req.SetBasicAuth("alice", "secret")
+	testutil.Equals(t, http.StatusOK, serve(s, req).Code)
+
+	// Probes do not require authentication.
+	testutil.Equals(t, http.StatusOK, serve(s, httptest.NewRequest("GET", "/-/healthy", nil)).Code)
+
+	_, err = ParseWebConfig([]byte("basic_auth_users:\n  alice: secret"))
+	testutil.NotOk(t, err)
+}
+
+func TestHTTPServer_RequestLogging(t *testing.T) {
+	logCfg, err := ParseRequestLoggingConfig([]byte(`
+default: failure
+rules:
+  - path: /api/v1/query
+    method: GET
+    decision: all
+  - path: /metrics
+    decision: none
+`))
+	testutil.Ok(t, err)
+
+	var buf bytes.Buffer
+	reg := prometheus.NewRegistry()
+	s, err := newHTTPServer(log.NewLogfmtLogger(&buf), reg, &WebConfig{}, logCfg)
+	testutil.Ok(t, err)
+
+	code := http.StatusOK
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	})
+	s.Handle("/api/v1/query", h)
+	s.Handle("/metrics", h)
+	s.Handle("/", h)
+
+	for _, tcase := range []struct {
+		method, path string
+		code         int
+		logged       bool
+	}{
+		{method: "GET", path: "/api/v1/query", code: 200, logged: true},
+		{method: "POST", path: "/api/v1/query", code: 200, logged: false},
+		{method: "POST", path: "/api/v1/query", code: 500, logged: true},
+		{method: "GET", path: "/metrics", code: 500, logged: false},
+		{method: "GET", path: "/graph", code: 503, logged: true},
+		{method: "GET", path: "/graph", code: 404, logged: false},
+	} {
+		buf.Reset()
+		code = tcase.code
+		testutil.Equals(t, tcase.code, serve(s, httptest.NewRequest(tcase.method, tcase.path, nil)).Code)
+		testutil.Assert(t, tcase.logged == (buf.Len() > 0), "%s %s %d: unexpected log %q", tcase.method, tcase.path, tcase.code, buf.String())
+	}
+
+	// All requests are instrumented, regardless of logging.
+	var m dto.Metric
+	testutil.Ok(t, s.requests.WithLabelValues("/api/v1/query", "POST", "500").Write(&m))
+	testutil.Equals(t, 1.0, m.GetCounter().GetValue())
+	testutil.Ok(t, s.requests.WithLabelValues("/", "GET", "404").Write(&m))
+	testutil.Equals(t, 1.0, m.GetCounter().GetValue())
+
+	for _, c := range []string{
+		"default: sometimes",
+		"rules:\n  - path: /metrics\n    decision: always",
+		"rules:\n  - method: GET\n    decision: all",
+	} {
+		_, err := ParseRequestLoggingConfig([]byte(c))
+		testutil.NotOk(t, err)
+	}
+}
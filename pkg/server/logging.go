@@ -0,0 +1,81 @@
+package server
+
+import (
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Decision tells which requests are logged.
+type Decision string
+
+const (
+	// NoLog disables logging of requests.
+	NoLog Decision = "none"
+	// LogFailure logs requests which failed with 5xx status code.
+	LogFailure Decision = "failure"
+	// LogAll logs all requests.
+	LogAll Decision = "all"
+)
+
+func (d Decision) validate() error {
+	switch d {
+	case NoLog, LogFailure, LogAll:
+		return nil
+	}
+	return errors.Errorf("unknown decision %q, possible values: %s, %s, %s", d, NoLog, LogFailure, LogAll)
+}
+
+// shouldLog returns true if request with the given status code is logged.
+func (d Decision) shouldLog(code int) bool {
+	switch d {
+	case LogAll:
+		return true
+	case LogFailure:
+		return code >= 500
+	}
+	return false
+}
+
+// LoggingRule sets the decision for requests with the given path and method. Empty method matches all methods.
+type LoggingRule struct {
+	Path     string   `yaml:"path"`
+	Method   string   `yaml:"method"`
+	Decision Decision `yaml:"decision"`
+}
+
+// RequestLoggingConfig configures which requests are logged. The first rule matching the request
+// is applied, the default decision is used if no rule matches.
+type RequestLoggingConfig struct {
+	Default Decision      `yaml:"default"`
+	Rules   []LoggingRule `yaml:"rules"`
+}
+
+// ParseRequestLoggingConfig parses request logging configuration in YAML.
+func ParseRequestLoggingConfig(b []byte) (*RequestLoggingConfig, error) {
+	c := &RequestLoggingConfig{Default: NoLog}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, errors.Wrap(err, "parse request logging config")
+	}
+	if err := c.Default.validate(); err != nil {
+		return nil, errors.Wrap(err, "default")
+	}
+	for i, r := range c.Rules {
+		if r.Path == "" {
+			return nil, errors.Errorf("rule %d: empty path", i)
+		}
+		if err := r.Decision.validate(); err != nil {
+			return nil, errors.Wrapf(err, "rule %d", i)
+		}
+	}
+	return c, nil
+}
+
+// decision returns the decision for request with the given method and path.
+func (c *RequestLoggingConfig) decision(method, path string) Decision {
+	for _, r := range c.Rules {
+		if r.Path == path && (r.Method == "" || r.Method == method) {
+			return r.Decision
+		}
+	}
+	return c.Default
+}
@@ -27,6 +27,8 @@ type metrics struct {
 	dirSyncFailures prometheus.Counter
 	uploads         prometheus.Counter
 	uploadFailures  prometheus.Counter
+	oldestPending   prometheus.Gauge
+	overlaps        prometheus.Counter
 }
 
 func newMetrics(r prometheus.Registerer) *metrics {
@@ -48,6 +50,14 @@ func newMetrics(r prometheus.Registerer) *metrics {
 		Name: "thanos_shipper_upload_failures_total",
 		Help: "Total number of failed object uploads",
 	})
+	m.oldestPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_shipper_oldest_pending_block_min_time_seconds",
+		Help: "Min time of the oldest local block not uploaded yet after the last dir sync, 0 if all blocks were uploaded",
+	})
+	m.overlaps = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "thanos_shipper_overlapping_uploads_total",
+		Help: "Total number of block uploads refused because the block overlaps with a block of equal external labels in the bucket",
+	})
 
 	if r != nil {
 		r.MustRegister(
@@ -55,11 +65,16 @@ func newMetrics(r prometheus.Registerer) *metrics {
 			m.dirSyncFailures,
 			m.uploads,
 			m.uploadFailures,
+			m.oldestPending,
+			m.overlaps,
 		)
 	}
 	return &m
 }
 
+// metaFetchConcurrency is the number of concurrent downloads of bucket metas that are not cached yet.
+const metaFetchConcurrency = 4
+
 // Shipper watches a directory for matching files and directories and uploads
 // them to a remote data store.
 type Shipper struct {
@@ -68,16 +83,27 @@ type Shipper struct {
 	metrics *metrics
 	bucket  objstore.Bucket
 	labels  func() labels.Labels
+	fetcher *block.MetaFetcher
+
+	applyTombstones bool
+	uploadCompacted bool
+	uploadOpts      block.UploadOptions
 }
 
 // New creates a new shipper that detects new TSDB blocks in dir and uploads them
 // to remote if necessary. It attaches the return value of the labels getter to uploaded data.
+// If applyTombstones is true, samples deleted by the tombstones of a block are removed before it is uploaded.
+// If uploadCompacted is true, blocks compacted by Prometheus are uploaded as well, unless they hold data of blocks
+// that are already in the bucket. Chunk segment files of a block are uploaded by uploadConcurrency workers.
 func New(
 	logger log.Logger,
 	r prometheus.Registerer,
 	dir string,
 	bucket objstore.Bucket,
 	lbls func() labels.Labels,
+	applyTombstones bool,
+	uploadCompacted bool,
+	uploadConcurrency int,
 ) *Shipper {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -85,12 +111,23 @@ func New(
 	if lbls == nil {
 		lbls = func() labels.Labels { return nil }
 	}
+	// Metas of bucket blocks are cached on disk, so they are only downloaded once and not on every sync.
+	fetcher, err := block.NewMetaFetcher(logger, r, bucket, metaFetchConcurrency, filepath.Join(dir, "thanos", "meta-syncer"))
+	if err != nil {
+		level.Warn(logger).Log("msg", "creating meta cache dir failed, caching bucket metas in memory only", "err", err)
+		fetcher, _ = block.NewMetaFetcher(logger, r, bucket, metaFetchConcurrency, "")
+	}
 	return &Shipper{
 		logger:  logger,
 		dir:     dir,
 		bucket:  bucket,
 		labels:  lbls,
+		fetcher: fetcher,
 		metrics: newMetrics(r),
+
+		applyTombstones: applyTombstones,
+		uploadCompacted: uploadCompacted,
+		uploadOpts:      block.UploadOptions{Concurrency: uploadConcurrency, Backoff: block.DefaultBackoff},
 	}
 }
 
@@ -110,7 +147,7 @@ func (s *Shipper) Timestamps() (minTime, maxSyncTime int64, err error) {
 	minTime = math.MaxInt64
 	maxSyncTime = math.MinInt64
 
-	s.iterBlockMetas(func(m *block.Meta) error {
+	s.iterBlockMetas(s.dir, func(m *block.Meta) error {
 		if m.MinTime < minTime {
 			minTime = m.MinTime
 		}
@@ -126,6 +163,8 @@ func (s *Shipper) Timestamps() (minTime, maxSyncTime int64, err error) {
 // to the object bucket once.
 // It is not concurrency-safe.
 func (s *Shipper) Sync(ctx context.Context) {
+	s.metrics.dirSyncs.Inc()
+
 	meta, err := ReadMetaFile(s.dir)
 	if err != nil {
 		// If we encounter any error, proceed with an empty meta file and overwrite it later.
@@ -144,76 +183,375 @@ func (s *Shipper) Sync(ctx context.Context) {
 	// Reset the uploaded slice so we can rebuild it only with blocks that still exist locally.
 	meta.Uploaded = nil
 
-	if err = s.iterBlockMetas(func(m *block.Meta) error {
+	// Metas of the blocks in the bucket are only listed once per sync and only if a block has to be uploaded.
+	var bmetas []*block.Meta
+	bucketMetas := func() ([]*block.Meta, error) {
+		if bmetas != nil {
+			return bmetas, nil
+		}
+		metas, err := s.bucketMetas(ctx)
+		if err != nil {
+			return nil, err
+		}
+		bmetas = metas
+		return bmetas, nil
+	}
+
+	var (
+		oldestPending = int64(math.MaxInt64)
+		maxSyncTime   = int64(math.MinInt64)
+		pending       = map[ulid.ULID]struct{}{}
+	)
+	if err = s.iterBlockMetas(s.dir, func(m *block.Meta) error {
 		// Do not sync a block if we already uploaded it. If it is no longer found in the bucket,
 		// it was generally removed by the compaction process.
 		if _, ok := hasUploaded[m.ULID]; !ok {
-			if err := s.sync(ctx, m); err != nil {
+			if err := s.sync(ctx, m, bucketMetas); err != nil {
 				level.Error(s.logger).Log("msg", "shipping failed", "block", m.ULID, "err", err)
+				if m.MinTime < oldestPending {
+					oldestPending = m.MinTime
+				}
+				pending[m.ULID] = struct{}{}
 				return nil
 			}
 		}
 		meta.Uploaded = append(meta.Uploaded, m.ULID)
+		if m.MaxTime > maxSyncTime {
+			maxSyncTime = m.MaxTime
+		}
 		return nil
 	}); err != nil {
 		level.Error(s.logger).Log("msg", "iter block metas failed", "err", err)
+		s.metrics.dirSyncFailures.Inc()
 		return
 	}
+	if err := s.cleanUploadDirs(pending); err != nil {
+		level.Warn(s.logger).Log("msg", "cleaning upload dirs failed", "err", err)
+	}
+	if oldestPending == math.MaxInt64 {
+		s.metrics.oldestPending.Set(0)
+	} else {
+		s.metrics.oldestPending.Set(float64(oldestPending) / 1000)
+	}
+	// Head snapshots whose data was uploaded completely in persisted blocks are not needed anymore.
+	meta.HeadSnapshots = s.deleteHeadSnapshots(ctx, meta.HeadSnapshots, func(h HeadSnapshot) bool {
+		return h.MaxTime <= maxSyncTime
+	})
 	if err := WriteMetaFile(s.dir, meta); err != nil {
 		level.Warn(s.logger).Log("msg", "updating meta file failed", "err", err)
 	}
 }
 
-func (s *Shipper) sync(ctx context.Context, meta *block.Meta) (err error) {
-	dir := filepath.Join(s.dir, meta.ULID.String())
+// SnapshotSynced returns true if blocks of a TSDB snapshot were already uploaded by SyncSnapshot.
+func (s *Shipper) SnapshotSynced() (bool, error) {
+	meta, err := ReadMetaFile(s.dir)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "read shipper meta file")
+	}
+	return meta.SnapshotSynced, nil
+}
 
-	// We only ship of the first compacted block level.
-	// TODO(bplotka): https://github.com/improbable-eng/thanos/issues/206
-	if meta.Compaction.Level > 1 {
+// SyncSnapshot uploads all blocks of the TSDB snapshot in the given directory. Unlike Sync, it uploads
+// compacted blocks as well, so data that existed before the shipper was started is backfilled into the bucket.
+// Blocks already present in the bucket are skipped. Once all blocks are uploaded, it is recorded in the
+// shipper meta file, as blocks of later snapshots would overlap with the uploaded ones after Prometheus
+// compacted them. It must not run concurrently with Sync.
+func (s *Shipper) SyncSnapshot(ctx context.Context, dir string) error {
+	var failed int
+	if err := s.iterBlockMetas(dir, func(m *block.Meta) error {
+		if err := s.upload(ctx, filepath.Join(dir, m.ULID.String()), m); err != nil {
+			level.Error(s.logger).Log("msg", "shipping snapshot block failed", "block", m.ULID, "err", err)
+			failed++
+		}
 		return nil
+	}); err != nil {
+		return errors.Wrap(err, "iter snapshot block metas")
+	}
+	if failed > 0 {
+		return errors.Errorf("failed to upload %d snapshot blocks", failed)
 	}
 
-	// Check against bucket if the meta file for this block exists.
-	ok, err := s.bucket.Exists(ctx, path.Join(meta.ULID.String(), block.MetaFilename))
+	meta, err := ReadMetaFile(s.dir)
 	if err != nil {
-		return errors.Wrap(err, "check exists")
+		if !os.IsNotExist(err) {
+			level.Warn(s.logger).Log("msg", "reading meta file failed, removing it", "err", err)
+		}
+		meta = &Meta{Version: 1}
 	}
-	if ok {
+	meta.SnapshotSynced = true
+	return errors.Wrap(WriteMetaFile(s.dir, meta), "write shipper meta file")
+}
+
+// SyncHeadSnapshot uploads the block of the head in the TSDB snapshot in the given directory, so data that is not
+// persisted in a block yet reaches the bucket. The head block is the only block of the snapshot missing in the data
+// directory. As it overlaps with blocks persisted later, it is excluded from compaction and downsampling. Head snapshots
+// uploaded before are marked for deletion once their data is held by the new one and the uploaded persisted blocks.
+// It must not run concurrently with Sync.
+func (s *Shipper) SyncHeadSnapshot(ctx context.Context, dir string) error {
+	var head *block.Meta
+	if err := s.iterBlockMetas(dir, func(m *block.Meta) error {
+		// Persisted blocks are hard linked into the snapshot with their IDs.
+		if _, err := os.Stat(filepath.Join(s.dir, m.ULID.String())); err == nil {
+			return nil
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		if head != nil {
+			return errors.Errorf("snapshot blocks %s and %s are both missing in the data directory", head.ULID, m.ULID)
+		}
+		head = m
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "iter snapshot block metas")
+	}
+	if head == nil {
+		// Prometheus does not write empty heads into snapshots.
 		return nil
 	}
 
-	level.Info(s.logger).Log("msg", "upload new block", "id", meta.ULID)
+	meta, err := ReadMetaFile(s.dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			level.Warn(s.logger).Log("msg", "reading meta file failed, removing it", "err", err)
+		}
+		meta = &Meta{Version: 1}
+	}
 
+	// The marks are uploaded before the block, so the compactor never sees the block without them.
+	if err := block.MarkForNoCompact(ctx, s.logger, s.bucket, head.ULID, block.HeadSnapshotNoCompactReason, "head snapshot"); err != nil {
+		return err
+	}
+	if err := block.MarkForNoDownsample(ctx, s.logger, s.bucket, head.ULID, "head snapshot"); err != nil {
+		return err
+	}
+	// The meta file of the head block is written by the snapshot and not hard linked from the data directory.
+	bdir := filepath.Join(dir, head.ULID.String())
+	head.Thanos.HeadSnapshot = true
+	if err := block.WriteMetaFile(bdir, head); err != nil {
+		return errors.Wrap(err, "write meta file")
+	}
+	if err := s.upload(ctx, bdir, head); err != nil {
+		return errors.Wrapf(err, "upload head block %s", head.ULID)
+	}
+
+	// Data of head snapshots starting before the new one must be held by uploaded persisted blocks.
+	maxSyncTime := int64(math.MinInt64)
+	hasUploaded := make(map[ulid.ULID]struct{}, len(meta.Uploaded))
+	for _, id := range meta.Uploaded {
+		hasUploaded[id] = struct{}{}
+	}
+	if err := s.iterBlockMetas(s.dir, func(m *block.Meta) error {
+		if _, ok := hasUploaded[m.ULID]; ok && m.MaxTime > maxSyncTime {
+			maxSyncTime = m.MaxTime
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "iter block metas")
+	}
+	meta.HeadSnapshots = s.deleteHeadSnapshots(ctx, meta.HeadSnapshots, func(h HeadSnapshot) bool {
+		return h.MinTime >= head.MinTime || maxSyncTime >= head.MinTime
+	})
+	meta.HeadSnapshots = append(meta.HeadSnapshots, HeadSnapshot{ID: head.ULID, MinTime: head.MinTime, MaxTime: head.MaxTime})
+	return errors.Wrap(WriteMetaFile(s.dir, meta), "write shipper meta file")
+}
+
+// deleteHeadSnapshots marks the uploaded head snapshots for which superseded returns true for deletion and returns
+// the remaining ones. Head snapshots failing to be marked are kept and retried later.
+func (s *Shipper) deleteHeadSnapshots(ctx context.Context, snapshots []HeadSnapshot, superseded func(HeadSnapshot) bool) []HeadSnapshot {
+	var kept []HeadSnapshot
+	for _, h := range snapshots {
+		if !superseded(h) {
+			kept = append(kept, h)
+			continue
+		}
+		if err := block.MarkForDeletion(ctx, s.logger, s.bucket, h.ID, "superseded head snapshot"); err != nil {
+			level.Warn(s.logger).Log("msg", "marking head snapshot for deletion failed", "block", h.ID, "err", err)
+			kept = append(kept, h)
+		}
+	}
+	return kept
+}
+
+func (s *Shipper) sync(ctx context.Context, meta *block.Meta, bucketMetas func() ([]*block.Meta, error)) error {
+	// We only ship of the first compacted block level by default.
+	// TODO(bplotka): https://github.com/improbable-eng/thanos/issues/206
+	if meta.Compaction.Level > 1 && !s.uploadCompacted {
+		return nil
+	}
+	metas, err := bucketMetas()
+	if err != nil {
+		return errors.Wrap(err, "read metas of bucket blocks")
+	}
+	if meta.Compaction.Level > 1 {
+		// Compacted blocks replace the blocks they were compacted from. If any of them was shipped already,
+		// the data would be duplicated in the bucket.
+		sources := map[ulid.ULID]struct{}{}
+		for _, m := range metas {
+			sources[m.ULID] = struct{}{}
+			for _, id := range m.Compaction.Sources {
+				sources[id] = struct{}{}
+			}
+		}
+		for _, id := range meta.Compaction.Sources {
+			if _, ok := sources[id]; ok {
+				level.Warn(s.logger).Log("msg", "not uploading compacted block overlapping with blocks in the bucket", "block", meta.ULID, "source", id)
+				return nil
+			}
+		}
+	}
+	if err := s.checkOverlaps(meta, metas); err != nil {
+		s.metrics.overlaps.Inc()
+		return err
+	}
+	return s.upload(ctx, filepath.Join(s.dir, meta.ULID.String()), meta)
+}
+
+// checkOverlaps returns an error if a raw block of the bucket with the external labels of the shipper overlaps with
+// the time range of the block of the given meta. Blocks of a single Prometheus server never overlap, so the bucket
+// block was most likely uploaded by another producer configured with the same external labels. Uploading the block
+// would make the compactor halt on the overlap.
+func (s *Shipper) checkOverlaps(meta *block.Meta, metas []*block.Meta) error {
+	lset := s.labels()
+	for _, m := range metas {
+		if m.ULID == meta.ULID || m.Thanos.Downsample.Resolution != 0 || m.Thanos.HeadSnapshot {
+			continue
+		}
+		if !labels.FromMap(m.Thanos.Labels).Equals(lset) {
+			continue
+		}
+		if m.MinTime < meta.MaxTime && meta.MinTime < m.MaxTime {
+			return errors.Errorf("block overlaps with block %s of the bucket with equal external labels %s in time range [%d, %d), "+
+				"another producer may be configured with the same external labels", m.ULID, lset, m.MinTime, m.MaxTime)
+		}
+	}
+	return nil
+}
+
+// bucketMetas returns the metas of all blocks in the bucket. Blocks without meta file, e.g. of running uploads,
+// are ignored. Metas are cached by the fetcher, so only metas of new blocks are downloaded.
+func (s *Shipper) bucketMetas(ctx context.Context) ([]*block.Meta, error) {
+	metas, _, err := s.fetcher.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*block.Meta, 0, len(metas))
+	for _, m := range metas {
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+// upload uploads the block in the given directory unless it already exists in the bucket.
+func (s *Shipper) upload(ctx context.Context, dir string, meta *block.Meta) error {
+	// Check against bucket if the meta file for this block exists.
+	ok, err := s.bucket.Exists(ctx, path.Join(meta.ULID.String(), block.MetaFilename))
+	if err != nil {
+		return errors.Wrap(err, "check exists")
+	}
 	// We hard-link the files into a temporary upload directory so we are not affected
 	// by other operations happening against the TSDB directory.
-	updir := filepath.Join(s.dir, "thanos", "upload", meta.ULID.String())
+	updir := filepath.Join(s.uploadDir(), meta.ULID.String())
+	if ok {
+		return errors.Wrap(os.RemoveAll(updir), "clean upload directory")
+	}
 
-	if err := os.RemoveAll(updir); err != nil {
-		return errors.Wrap(err, "clean upload directory")
+	s.metrics.uploads.Inc()
+	if err := s.uploadResumable(ctx, dir, updir, meta); err != nil {
+		s.metrics.uploadFailures.Inc()
+		return err
 	}
-	if err := os.MkdirAll(updir, 0777); err != nil {
-		return errors.Wrap(err, "create upload dir")
+	return errors.Wrap(os.RemoveAll(updir), "clean upload directory")
+}
+
+// uploadResumable uploads the block in dir through the upload directory updir. Each file is retried with backoff
+// within the call.
+func (s *Shipper) uploadResumable(ctx context.Context, dir, updir string, meta *block.Meta) error {
+	// The upload directory of a failed upload is kept along with the partial block in the bucket. If any of its
+	// files were uploaded already, the upload is resumed with the prepared files.
+	_, err := os.Stat(filepath.Join(updir, block.UploadStateFilename))
+	resume := err == nil
+
+	if resume {
+		level.Info(s.logger).Log("msg", "resume upload of block", "id", meta.ULID)
+	} else {
+		level.Info(s.logger).Log("msg", "upload new block", "id", meta.ULID)
+
+		if err := os.RemoveAll(updir); err != nil {
+			return errors.Wrap(err, "clean upload directory")
+		}
+		if err := os.MkdirAll(updir, 0777); err != nil {
+			return errors.Wrap(err, "create upload dir")
+		}
+		if err := s.prepare(dir, updir, meta); err != nil {
+			os.RemoveAll(updir)
+			return err
+		}
 	}
-	defer os.RemoveAll(updir)
 
+	return block.UploadResumableWithOptions(ctx, s.bucket, updir, s.uploadOpts)
+}
+
+func (s *Shipper) uploadDir() string {
+	return filepath.Join(s.dir, "thanos", "upload")
+}
+
+// prepare hard links the block in dir into updir, applies its tombstones if enabled and writes the meta file
+// extended by the external labels.
+func (s *Shipper) prepare(dir, updir string, meta *block.Meta) error {
 	if err := hardlinkBlock(dir, updir); err != nil {
 		return errors.Wrap(err, "hard link block")
 	}
+	if s.applyTombstones {
+		applied, err := block.ApplyTombstones(updir)
+		if err != nil {
+			return errors.Wrap(err, "apply tombstones")
+		}
+		if applied {
+			level.Info(s.logger).Log("msg", "removed deleted samples from block", "id", meta.ULID)
+			// Stats changed with the rewritten chunks.
+			if meta, err = block.ReadMetaFile(updir); err != nil {
+				return errors.Wrap(err, "read rewritten meta file")
+			}
+		}
+	}
 	// Attach current labels and write a new meta file with Thanos extensions.
 	if lset := s.labels(); lset != nil {
 		meta.Thanos.Labels = lset.Map()
 	}
-	if err := block.WriteMetaFile(updir, meta); err != nil {
-		return errors.Wrap(err, "write meta file")
+	return errors.Wrap(block.WriteMetaFile(updir, meta), "write meta file")
+}
+
+// cleanUploadDirs removes upload directories of blocks that are not in the given set anymore, e.g. because
+// Prometheus deleted them before their failed upload was resumed.
+func (s *Shipper) cleanUploadDirs(keep map[ulid.ULID]struct{}) error {
+	names, err := fileutil.ReadDir(s.uploadDir())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "read upload dir")
+	}
+	for _, n := range names {
+		if id, ok := block.IsBlockDir(n); ok {
+			if _, ok := keep[id]; ok {
+				continue
+			}
+		}
+		if err := os.RemoveAll(filepath.Join(s.uploadDir(), n)); err != nil {
+			return errors.Wrapf(err, "remove upload dir %s", n)
+		}
 	}
-	return block.Upload(ctx, s.bucket, updir)
+	return nil
 }
 
 // iterBlockMetas calls f with the block meta for each block found in dir. It logs
 // an error and continues if it cannot access a meta.json file.
 // If f returns an error, the function returns with the same error.
-func (s *Shipper) iterBlockMetas(f func(m *block.Meta) error) error {
-	names, err := fileutil.ReadDir(s.dir)
+func (s *Shipper) iterBlockMetas(dir string, f func(m *block.Meta) error) error {
+	names, err := fileutil.ReadDir(dir)
 	if err != nil {
 		return errors.Wrap(err, "read dir")
 	}
@@ -221,9 +559,9 @@ func (s *Shipper) iterBlockMetas(f func(m *block.Meta) error) error {
 		if _, ok := block.IsBlockDir(n); !ok {
 			continue
 		}
-		dir := filepath.Join(s.dir, n)
+		bdir := filepath.Join(dir, n)
 
-		fi, err := os.Stat(dir)
+		fi, err := os.Stat(bdir)
 		if err != nil {
 			level.Warn(s.logger).Log("msg", "open file failed", "err", err)
 			continue
@@ -231,7 +569,7 @@ func (s *Shipper) iterBlockMetas(f func(m *block.Meta) error) error {
 		if !fi.IsDir() {
 			continue
 		}
-		m, err := block.ReadMetaFile(dir)
+		m, err := block.ReadMetaFile(bdir)
 		if err != nil {
 			level.Warn(s.logger).Log("msg", "reading meta file failed", "err", err)
 			continue
@@ -259,6 +597,11 @@ func hardlinkBlock(src, dst string) error {
 	}
 	files = append(files, block.MetaFilename, block.IndexFilename)
 
+	// Tombstones are optional and only needed if they are applied before upload.
+	if _, err := os.Stat(filepath.Join(src, "tombstones")); err == nil {
+		files = append(files, "tombstones")
+	}
+
 	for _, fn := range files {
 		if err := os.Link(filepath.Join(src, fn), filepath.Join(dst, fn)); err != nil {
 			return errors.Wrapf(err, "hard link file %s", fn)
@@ -271,6 +614,17 @@ func hardlinkBlock(src, dst string) error {
 type Meta struct {
 	Version  int         `json:"version"`
 	Uploaded []ulid.ULID `json:"uploaded"`
+	// SnapshotSynced is true if blocks of a TSDB snapshot were uploaded by SyncSnapshot.
+	SnapshotSynced bool `json:"snapshot_synced,omitempty"`
+	// HeadSnapshots are the head blocks uploaded by SyncHeadSnapshot that were not marked for deletion yet.
+	HeadSnapshots []HeadSnapshot `json:"head_snapshots,omitempty"`
+}
+
+// HeadSnapshot describes a head block uploaded by SyncHeadSnapshot.
+type HeadSnapshot struct {
+	ID      ulid.ULID `json:"id"`
+	MinTime int64     `json:"min_time"`
+	MaxTime int64     `json:"max_time"`
 }
 
 // MetaFilename is the known JSON filename for meta information.
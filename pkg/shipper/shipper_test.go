@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -14,8 +15,13 @@ import (
 
 	"github.com/go-kit/kit/log"
 	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
 	"github.com/improbable-eng/thanos/pkg/testutil"
 	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/prometheus/tsdb"
 	"github.com/prometheus/tsdb/labels"
@@ -32,7 +38,7 @@ func TestShipper_UploadBlocks(t *testing.T) {
 	defer cleanup()
 
 	extLset := labels.FromStrings("prometheus", "prom-1")
-	shipper := New(log.NewLogfmtLogger(os.Stderr), nil, dir, bucket, func() labels.Labels { return extLset })
+	shipper := New(log.NewLogfmtLogger(os.Stderr), nil, dir, bucket, func() labels.Labels { return extLset }, false, false, 1)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -88,8 +94,11 @@ func TestShipper_UploadBlocks(t *testing.T) {
 		// After rename sync should upload the block.
 		shipper.Sync(ctx)
 
-		// The external labels must be attached to the meta file on upload.
+		// The external labels and file descriptions must be attached to the meta file on upload.
 		meta.Thanos.Labels = extLset.Map()
+		files, err := block.GatherFiles(bdir)
+		testutil.Ok(t, err)
+		meta.Thanos.SetFiles(files)
 
 		var buf bytes.Buffer
 		enc := json.NewEncoder(&buf)
@@ -137,3 +146,339 @@ func TestShipper_UploadBlocks(t *testing.T) {
 	testutil.Ok(t, err)
 	testutil.Assert(t, ok == false, "fifth block was reuploaded")
 }
+
+func TestShipper_SyncSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shipper-test")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	bkt := inmem.NewBucket()
+	extLset := labels.FromStrings("prometheus", "prom-1")
+	shipper := New(log.NewNopLogger(), nil, dir, bkt, func() labels.Labels { return extLset }, false, false, 1)
+
+	synced, err := shipper.SnapshotSynced()
+	testutil.Ok(t, err)
+	testutil.Assert(t, !synced, "snapshot must not be synced initially")
+
+	// Compacted blocks are not uploaded by Sync, but must be uploaded from snapshots.
+	snapDir := filepath.Join(dir, "snapshots", "20180101T000000Z-abcdef")
+	id := ulid.MustNew(1, rand.New(rand.NewSource(0)))
+	bdir := filepath.Join(snapDir, id.String())
+	testutil.Ok(t, os.MkdirAll(filepath.Join(bdir, block.ChunksDirname), 0777))
+
+	meta := block.Meta{
+		Version: 1,
+		BlockMeta: tsdb.BlockMeta{
+			ULID:    id,
+			MinTime: 0,
+			MaxTime: 1000,
+		},
+	}
+	meta.Compaction.Level = 3
+	testutil.Ok(t, block.WriteMetaFile(bdir, &meta))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(bdir, block.IndexFilename), []byte("indexcontents"), 0666))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(bdir, block.ChunksDirname, "000001"), []byte("chunkcontents"), 0666))
+
+	testutil.Ok(t, shipper.SyncSnapshot(context.Background(), snapDir))
+
+	testutil.Equals(t, []byte("indexcontents"), bkt.Objects()[path.Join(id.String(), block.IndexFilename)])
+	testutil.Equals(t, []byte("chunkcontents"), bkt.Objects()[path.Join(id.String(), block.ChunksDirname, "000001")])
+
+	uploaded, err := block.DownloadMeta(context.Background(), bkt, id)
+	testutil.Ok(t, err)
+	testutil.Equals(t, extLset.Map(), uploaded.Thanos.Labels)
+
+	synced, err = shipper.SnapshotSynced()
+	testutil.Ok(t, err)
+	testutil.Assert(t, synced, "snapshot must be synced")
+
+	// Syncing local blocks keeps the snapshot state.
+	shipper.Sync(context.Background())
+	synced, err = shipper.SnapshotSynced()
+	testutil.Ok(t, err)
+	testutil.Assert(t, synced, "snapshot must be synced")
+}
+
+func TestShipper_UploadCompacted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shipper-test")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	randr := rand.New(rand.NewSource(0))
+	var ids []ulid.ULID
+	for i := 0; i < 6; i++ {
+		ids = append(ids, ulid.MustNew(uint64(i), randr))
+	}
+	writeBlock := func(id ulid.ULID, lvl int, sources ...ulid.ULID) {
+		bdir := filepath.Join(dir, id.String())
+		testutil.Ok(t, os.MkdirAll(filepath.Join(bdir, block.ChunksDirname), 0777))
+
+		meta := block.Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: 0, MaxTime: 1000}}
+		meta.Compaction.Level = lvl
+		meta.Compaction.Sources = sources
+		testutil.Ok(t, block.WriteMetaFile(bdir, &meta))
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(bdir, block.IndexFilename), []byte("indexcontents"), 0666))
+	}
+	exists := func(bkt *inmem.Bucket, id ulid.ULID) bool {
+		_, ok := bkt.Objects()[path.Join(id.String(), block.MetaFilename)]
+		return ok
+	}
+
+	// The first block was shipped before Prometheus compacted it into the second one.
+	bkt := inmem.NewBucket()
+	meta := block.Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: ids[0]}}
+	meta.Compaction.Level = 1
+	meta.Compaction.Sources = []ulid.ULID{ids[0]}
+	metab, err := json.Marshal(&meta)
+	testutil.Ok(t, err)
+	testutil.Ok(t, bkt.Upload(context.Background(), path.Join(ids[0].String(), block.MetaFilename), bytes.NewReader(metab)))
+
+	writeBlock(ids[1], 2, ids[0], ids[2])
+	writeBlock(ids[3], 2, ids[4], ids[5])
+
+	lbls := func() labels.Labels { return labels.FromStrings("prometheus", "prom-1") }
+	New(log.NewNopLogger(), nil, dir, bkt, lbls, false, false, 1).Sync(context.Background())
+	testutil.Assert(t, !exists(bkt, ids[1]), "compacted block must not be uploaded by default")
+	testutil.Assert(t, !exists(bkt, ids[3]), "compacted block must not be uploaded by default")
+
+	testutil.Ok(t, os.Remove(filepath.Join(dir, MetaFilename)))
+	New(log.NewNopLogger(), nil, dir, bkt, lbls, false, true, 1).Sync(context.Background())
+	testutil.Assert(t, !exists(bkt, ids[1]), "compacted block overlapping with the bucket must not be uploaded")
+	testutil.Assert(t, exists(bkt, ids[3]), "compacted block must be uploaded")
+}
+
+func TestShipper_Metrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shipper-test")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	id := ulid.MustNew(1, rand.New(rand.NewSource(0)))
+	bdir := filepath.Join(dir, id.String())
+	testutil.Ok(t, os.MkdirAll(filepath.Join(bdir, block.ChunksDirname), 0777))
+	meta := block.Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: 5000, MaxTime: 10000}}
+	meta.Compaction.Level = 1
+	testutil.Ok(t, block.WriteMetaFile(bdir, &meta))
+
+	shipper := New(log.NewNopLogger(), nil, dir, inmem.NewBucket(), func() labels.Labels { return labels.FromStrings("prometheus", "prom-1") }, false, false, 1)
+	value := func(c prometheus.Metric) float64 {
+		var m dto.Metric
+		testutil.Ok(t, c.Write(&m))
+		if m.Gauge != nil {
+			return m.Gauge.GetValue()
+		}
+		return m.Counter.GetValue()
+	}
+
+	// The upload fails without index file and the block stays pending.
+	shipper.Sync(context.Background())
+	testutil.Equals(t, 1.0, value(shipper.metrics.dirSyncs))
+	testutil.Equals(t, 1.0, value(shipper.metrics.uploads))
+	testutil.Equals(t, 1.0, value(shipper.metrics.uploadFailures))
+	testutil.Equals(t, 5.0, value(shipper.metrics.oldestPending))
+
+	shipMeta, err := ReadMetaFile(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(shipMeta.Uploaded))
+
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(bdir, block.IndexFilename), []byte("indexcontents"), 0666))
+	shipper.Sync(context.Background())
+	testutil.Equals(t, 2.0, value(shipper.metrics.uploads))
+	testutil.Equals(t, 1.0, value(shipper.metrics.uploadFailures))
+	testutil.Equals(t, 0.0, value(shipper.metrics.oldestPending))
+	testutil.Equals(t, 0.0, value(shipper.metrics.dirSyncFailures))
+
+	shipMeta, err = ReadMetaFile(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []ulid.ULID{id}, shipMeta.Uploaded)
+}
+
+// failingUploadBucket fails uploads of objects with the given name with a transient error and records all uploaded objects.
+type failingUploadBucket struct {
+	objstore.Bucket
+
+	fail     string
+	uploaded []string
+}
+
+func (b *failingUploadBucket) Upload(ctx context.Context, name string, r io.Reader) error {
+	if name == b.fail {
+		return errors.Wrapf(io.ErrUnexpectedEOF, "failed upload of %s", name)
+	}
+	b.uploaded = append(b.uploaded, name)
+	return b.Bucket.Upload(ctx, name, r)
+}
+
+func TestShipper_ResumeUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shipper-test")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	id := ulid.MustNew(1, rand.New(rand.NewSource(0)))
+	bdir := filepath.Join(dir, id.String())
+	testutil.Ok(t, os.MkdirAll(filepath.Join(bdir, block.ChunksDirname), 0777))
+	meta := block.Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: 0, MaxTime: 1000}}
+	meta.Compaction.Level = 1
+	testutil.Ok(t, block.WriteMetaFile(bdir, &meta))
+	for _, f := range []string{"chunks/000001", "chunks/000002", block.IndexFilename} {
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(bdir, f), []byte(f), 0666))
+	}
+
+	bkt := &failingUploadBucket{Bucket: inmem.NewBucket(), fail: path.Join(id.String(), "chunks/000002")}
+	shipper := New(log.NewNopLogger(), nil, dir, bkt, func() labels.Labels { return labels.FromStrings("prometheus", "prom-1") }, false, false, 1)
+	shipper.uploadOpts.Backoff = block.Backoff{MaxRetries: 1}
+
+	// The failed file is retried within the sync, but the partial upload is kept once the retries are exhausted.
+	shipper.Sync(context.Background())
+	testutil.Equals(t, []string{path.Join(id.String(), "chunks/000001")}, bkt.uploaded)
+	_, err = os.Stat(filepath.Join(dir, "thanos", "upload", id.String(), block.UploadStateFilename))
+	testutil.Ok(t, err)
+
+	// The next sync only uploads the missing files.
+	bkt.fail = ""
+	bkt.uploaded = nil
+	shipper.Sync(context.Background())
+	testutil.Equals(t, []string{
+		path.Join(id.String(), "chunks/000002"),
+		path.Join(id.String(), block.IndexFilename),
+		path.Join(block.DebugMetas, id.String()+".json"),
+		path.Join(id.String(), block.MetaFilename),
+	}, bkt.uploaded)
+	_, err = os.Stat(filepath.Join(dir, "thanos", "upload", id.String()))
+	testutil.Assert(t, os.IsNotExist(err), "expected upload dir to be removed, got %v", err)
+
+	shipMeta, err := ReadMetaFile(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []ulid.ULID{id}, shipMeta.Uploaded)
+
+	// Upload dirs of blocks that are not pending anymore are removed.
+	testutil.Ok(t, os.MkdirAll(filepath.Join(dir, "thanos", "upload", ulid.MustNew(2, nil).String()), 0777))
+	shipper.Sync(context.Background())
+	names, err := ioutil.ReadDir(filepath.Join(dir, "thanos", "upload"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(names))
+}
+
+func TestShipper_RefuseOverlappingUploads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shipper-test")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+	extLset := labels.FromStrings("prometheus", "prom-1")
+	uploadMeta := func(id ulid.ULID, lset labels.Labels, res, mint, maxt int64) {
+		meta := block.Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: mint, MaxTime: maxt}}
+		meta.Thanos.Labels = lset.Map()
+		meta.Thanos.Downsample.Resolution = res
+		b, err := json.Marshal(&meta)
+		testutil.Ok(t, err)
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), block.MetaFilename), bytes.NewReader(b)))
+	}
+	// Neither blocks of other producers nor downsampled blocks are considered overlaps.
+	uploadMeta(ulid.MustNew(1, nil), labels.FromStrings("prometheus", "prom-2"), 0, 0, 2000)
+	uploadMeta(ulid.MustNew(2, nil), extLset, 300000, 0, 2000)
+
+	id := ulid.MustNew(3, nil)
+	bdir := filepath.Join(dir, id.String())
+	testutil.Ok(t, os.MkdirAll(filepath.Join(bdir, block.ChunksDirname), 0777))
+	meta := block.Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: 1000, MaxTime: 2000}}
+	meta.Compaction.Level = 1
+	testutil.Ok(t, block.WriteMetaFile(bdir, &meta))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(bdir, block.IndexFilename), []byte("indexcontents"), 0666))
+
+	shipper := New(log.NewNopLogger(), nil, dir, bkt, func() labels.Labels { return extLset }, false, false, 1)
+	var m dto.Metric
+
+	// A raw block of another producer with equal external labels overlaps with the local block.
+	uploadMeta(ulid.MustNew(4, nil), extLset, 0, 0, 1500)
+	shipper.Sync(ctx)
+	_, ok := bkt.Objects()[path.Join(id.String(), block.IndexFilename)]
+	testutil.Assert(t, !ok, "overlapping block must not be uploaded")
+	testutil.Ok(t, shipper.metrics.overlaps.Write(&m))
+	testutil.Equals(t, 1.0, m.Counter.GetValue())
+
+	shipMeta, err := ReadMetaFile(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(shipMeta.Uploaded))
+
+	// Bucket metas are cached on disk instead of being downloaded on every sync.
+	_, err = os.Stat(filepath.Join(dir, "thanos", "meta-syncer", ulid.MustNew(4, nil).String(), block.MetaFilename))
+	testutil.Ok(t, err)
+
+	// Adjacent blocks do not overlap.
+	testutil.Ok(t, block.Delete(ctx, bkt, ulid.MustNew(4, nil)))
+	uploadMeta(ulid.MustNew(5, nil), extLset, 0, 0, 1000)
+	shipper.Sync(ctx)
+	_, ok = bkt.Objects()[path.Join(id.String(), block.IndexFilename)]
+	testutil.Assert(t, ok, "block must be uploaded")
+	testutil.Ok(t, shipper.metrics.overlaps.Write(&m))
+	testutil.Equals(t, 1.0, m.Counter.GetValue())
+
+	// Metas of deleted blocks are removed from the cache.
+	_, err = os.Stat(filepath.Join(dir, "thanos", "meta-syncer", ulid.MustNew(4, nil).String()))
+	testutil.Assert(t, os.IsNotExist(err), "cached meta of deleted block not removed")
+}
+
+func TestShipper_SyncHeadSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shipper-test")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	writeBlock := func(dir string, id ulid.ULID, mint, maxt int64) {
+		bdir := filepath.Join(dir, id.String())
+		testutil.Ok(t, os.MkdirAll(filepath.Join(bdir, block.ChunksDirname), 0777))
+		meta := block.Meta{Version: 1, BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: mint, MaxTime: maxt}}
+		meta.Compaction.Level = 1
+		testutil.Ok(t, block.WriteMetaFile(bdir, &meta))
+		testutil.Ok(t, ioutil.WriteFile(filepath.Join(bdir, block.IndexFilename), []byte("indexcontents"), 0666))
+	}
+	marked := func(bkt *inmem.Bucket, id ulid.ULID, mark string) bool {
+		_, ok := bkt.Objects()[path.Join(id.String(), mark)]
+		return ok
+	}
+
+	bkt := inmem.NewBucket()
+	shipper := New(log.NewNopLogger(), nil, dir, bkt, func() labels.Labels { return labels.FromStrings("prometheus", "prom-1") }, false, false, 1)
+
+	ids := []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(2, nil), ulid.MustNew(3, nil), ulid.MustNew(4, nil)}
+	writeBlock(dir, ids[0], 0, 1000)
+	shipper.Sync(ctx)
+
+	// Persisted blocks are part of the snapshot as well, but only the head block is uploaded.
+	snapDir := filepath.Join(dir, "snapshots", "1")
+	writeBlock(snapDir, ids[0], 0, 1000)
+	writeBlock(snapDir, ids[1], 1000, 1500)
+	testutil.Ok(t, shipper.SyncHeadSnapshot(ctx, snapDir))
+
+	head, err := block.DownloadMeta(ctx, bkt, ids[1])
+	testutil.Ok(t, err)
+	testutil.Assert(t, head.Thanos.HeadSnapshot, "expected head snapshot to be flagged in meta")
+	testutil.Equals(t, map[string]string{"prometheus": "prom-1"}, head.Thanos.Labels)
+	testutil.Assert(t, marked(bkt, ids[1], block.NoCompactMarkFilename), "expected head snapshot to be excluded from compaction")
+	testutil.Assert(t, marked(bkt, ids[1], block.NoDownsampleMarkFilename), "expected head snapshot to be excluded from downsampling")
+	testutil.Assert(t, !marked(bkt, ids[0], block.NoCompactMarkFilename), "expected persisted block not to be marked")
+
+	// The next head snapshot holds all data of the previous one.
+	snapDir = filepath.Join(dir, "snapshots", "2")
+	writeBlock(snapDir, ids[0], 0, 1000)
+	writeBlock(snapDir, ids[2], 1000, 1800)
+	testutil.Ok(t, shipper.SyncHeadSnapshot(ctx, snapDir))
+	testutil.Assert(t, marked(bkt, ids[1], block.DeletionMarkFilename), "expected superseded head snapshot to be marked for deletion")
+	testutil.Assert(t, !marked(bkt, ids[2], block.DeletionMarkFilename), "expected latest head snapshot not to be marked for deletion")
+
+	shipMeta, err := ReadMetaFile(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []HeadSnapshot{{ID: ids[2], MinTime: 1000, MaxTime: 1800}}, shipMeta.HeadSnapshots)
+
+	// The persisted block overlapping with the head snapshot is uploaded and replaces it.
+	writeBlock(dir, ids[3], 1000, 2000)
+	shipper.Sync(ctx)
+	testutil.Assert(t, marked(bkt, ids[3], block.MetaFilename), "expected persisted block to be uploaded")
+	testutil.Assert(t, marked(bkt, ids[2], block.DeletionMarkFilename), "expected head snapshot to be marked for deletion")
+
+	shipMeta, err = ReadMetaFile(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, []ulid.ULID{ids[0], ids[3]}, shipMeta.Uploaded)
+	testutil.Equals(t, 0, len(shipMeta.HeadSnapshots))
+}
@@ -0,0 +1,208 @@
+// Package status exposes the build information, command line flags and runtime information of a component in the
+// format of the Prometheus status API, so versions and configuration of all components can be audited centrally.
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/info/infopb"
+	"github.com/prometheus/common/version"
+)
+
+// Paths of the status endpoints.
+const (
+	BuildInfoPath   = "/api/v1/status/buildinfo"
+	FlagsPath       = "/api/v1/status/flags"
+	RuntimeInfoPath = "/api/v1/status/runtimeinfo"
+	// EndpointsPath is served by the querier only.
+	EndpointsPath = "/api/v1/status/endpoints"
+)
+
+// BuildInfo holds the version information of the component binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	Branch    string `json:"branch"`
+	BuildUser string `json:"buildUser"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// RuntimeInfo holds the information about the running process of the component.
+type RuntimeInfo struct {
+	StartTime      time.Time `json:"startTime"`
+	CWD            string    `json:"CWD"`
+	GoroutineCount int       `json:"goroutineCount"`
+	GOMAXPROCS     int       `json:"GOMAXPROCS"`
+	GOGC           string    `json:"GOGC"`
+	GODEBUG        string    `json:"GODEBUG"`
+}
+
+// Status provides the status of the running component.
+type Status struct {
+	flags     map[string]string
+	startTime time.Time
+	cwd       string
+}
+
+// New returns the status of a component started now with the given flag values.
+func New(flags map[string]string) *Status {
+	cwd, err := os.Getwd()
+	if err != nil {
+		cwd = "<error retrieving current working directory>"
+	}
+	return &Status{
+		flags:     flags,
+		startTime: time.Now(),
+		cwd:       cwd,
+	}
+}
+
+// BuildInfo returns the version information of the binary.
+func (s *Status) BuildInfo() BuildInfo {
+	return BuildInfo{
+		Version:   version.Version,
+		Revision:  version.Revision,
+		Branch:    version.Branch,
+		BuildUser: version.BuildUser,
+		BuildDate: version.BuildDate,
+		GoVersion: version.GoVersion,
+	}
+}
+
+// Flags returns the values of all flags the component was started with, including defaults.
+func (s *Status) Flags() map[string]string {
+	flags := make(map[string]string, len(s.flags))
+	for k, v := range s.flags {
+		flags[k] = v
+	}
+	return flags
+}
+
+// RuntimeInfo returns the current information about the process.
+func (s *Status) RuntimeInfo() RuntimeInfo {
+	return RuntimeInfo{
+		StartTime:      s.startTime,
+		CWD:            s.cwd,
+		GoroutineCount: runtime.NumGoroutine(),
+		GOMAXPROCS:     runtime.GOMAXPROCS(0),
+		GOGC:           os.Getenv("GOGC"),
+		GODEBUG:        os.Getenv("GODEBUG"),
+	}
+}
+
+// Proto returns the status in the form advertised by the Info gRPC service.
+func (s *Status) Proto() *infopb.StatusInfo {
+	bi := s.BuildInfo()
+	ri := s.RuntimeInfo()
+
+	flags := make([]infopb.Flag, 0, len(s.flags))
+	for k, v := range s.flags {
+		flags = append(flags, infopb.Flag{Name: k, Value: v})
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+
+	return &infopb.StatusInfo{
+		BuildInfo: &infopb.BuildInfo{
+			Version:   bi.Version,
+			Revision:  bi.Revision,
+			Branch:    bi.Branch,
+			BuildUser: bi.BuildUser,
+			BuildDate: bi.BuildDate,
+			GoVersion: bi.GoVersion,
+		},
+		Flags: flags,
+		RuntimeInfo: &infopb.RuntimeInfo{
+			StartTime:      ri.StartTime.UnixNano() / int64(time.Millisecond),
+			Cwd:            ri.CWD,
+			GoroutineCount: int64(ri.GoroutineCount),
+			Gomaxprocs:     int64(ri.GOMAXPROCS),
+			Gogc:           ri.GOGC,
+			Godebug:        ri.GODEBUG,
+		},
+	}
+}
+
+// Endpoint is the status of a remote component, as aggregated by the querier from the Info services of its stores.
+type Endpoint struct {
+	Name        string            `json:"name"`
+	Component   string            `json:"component,omitempty"`
+	BuildInfo   *BuildInfo        `json:"buildinfo,omitempty"`
+	Flags       map[string]string `json:"flags,omitempty"`
+	RuntimeInfo *RuntimeInfo      `json:"runtimeinfo,omitempty"`
+	// Error is set if the status of the endpoint could not be retrieved.
+	Error string `json:"error,omitempty"`
+}
+
+// EndpointFromProto returns the status of the named endpoint from its Info response. Components that do not
+// expose their status in the Info service result in an endpoint with the component type only.
+func EndpointFromProto(name string, resp *infopb.InfoResponse) Endpoint {
+	e := Endpoint{Name: name, Component: resp.ComponentType}
+	if resp.Status == nil {
+		return e
+	}
+	if bi := resp.Status.BuildInfo; bi != nil {
+		e.BuildInfo = &BuildInfo{
+			Version:   bi.Version,
+			Revision:  bi.Revision,
+			Branch:    bi.Branch,
+			BuildUser: bi.BuildUser,
+			BuildDate: bi.BuildDate,
+			GoVersion: bi.GoVersion,
+		}
+	}
+	e.Flags = make(map[string]string, len(resp.Status.Flags))
+	for _, f := range resp.Status.Flags {
+		e.Flags[f.Name] = f.Value
+	}
+	if ri := resp.Status.RuntimeInfo; ri != nil {
+		e.RuntimeInfo = &RuntimeInfo{
+			StartTime:      time.Unix(0, ri.StartTime*int64(time.Millisecond)).UTC(),
+			CWD:            ri.Cwd,
+			GoroutineCount: int(ri.GoroutineCount),
+			GOMAXPROCS:     int(ri.Gomaxprocs),
+			GOGC:           ri.Gogc,
+			GODEBUG:        ri.Godebug,
+		}
+	}
+	return e
+}
+
+// Mux is implemented by http.ServeMux and server.HTTPServer.
+type Mux interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// Register registers the status endpoints on the mux.
+func (s *Status) Register(mux Mux) {
+	mux.Handle(BuildInfoPath, Handler(func(*http.Request) interface{} { return s.BuildInfo() }))
+	mux.Handle(FlagsPath, Handler(func(*http.Request) interface{} { return s.Flags() }))
+	mux.Handle(RuntimeInfoPath, Handler(func(*http.Request) interface{} { return s.RuntimeInfo() }))
+}
+
+// Handler returns HTTP handler responding to GET requests with the data returned by f, wrapped in the response
+// envelope of the Prometheus HTTP API.
+func Handler(f func(*http.Request) interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]string{
+				"status":    "error",
+				"errorType": "bad_data",
+				"error":     "method not allowed",
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   f(r),
+		})
+	})
+}
@@ -0,0 +1,71 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/info/infopb"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+func TestStatus_Register(t *testing.T) {
+	s := New(map[string]string{"log.level": "info", "query.timeout": "2m0s"})
+	mux := http.NewServeMux()
+	s.Register(mux)
+
+	get := func(path string, data interface{}) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		testutil.Equals(t, http.StatusOK, rec.Code)
+
+		var resp struct {
+			Status string          `json:"status"`
+			Data   json.RawMessage `json:"data"`
+		}
+		testutil.Ok(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		testutil.Equals(t, "success", resp.Status)
+		testutil.Ok(t, json.Unmarshal(resp.Data, data))
+	}
+
+	var bi BuildInfo
+	get(BuildInfoPath, &bi)
+	testutil.Equals(t, runtime.Version(), bi.GoVersion)
+
+	var flags map[string]string
+	get(FlagsPath, &flags)
+	testutil.Equals(t, map[string]string{"log.level": "info", "query.timeout": "2m0s"}, flags)
+
+	var ri RuntimeInfo
+	get(RuntimeInfoPath, &ri)
+	testutil.Equals(t, s.startTime.Unix(), ri.StartTime.Unix())
+	testutil.Equals(t, runtime.GOMAXPROCS(0), ri.GOMAXPROCS)
+	testutil.Assert(t, ri.GoroutineCount > 0, "no goroutines reported")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, FlagsPath, nil))
+	testutil.Equals(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestEndpointFromProto(t *testing.T) {
+	s := New(map[string]string{"b": "2", "a": "1"})
+	s.startTime = time.Unix(1500, 0)
+
+	pb := s.Proto()
+	testutil.Equals(t, []infopb.Flag{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}}, pb.Flags)
+	testutil.Equals(t, int64(1500000), pb.RuntimeInfo.StartTime)
+
+	e := EndpointFromProto("store:10901", &infopb.InfoResponse{ComponentType: "store", Status: pb})
+	testutil.Equals(t, "store:10901", e.Name)
+	testutil.Equals(t, "store", e.Component)
+	testutil.Equals(t, s.BuildInfo(), *e.BuildInfo)
+	testutil.Equals(t, s.Flags(), e.Flags)
+	testutil.Equals(t, time.Unix(1500, 0).UTC(), e.RuntimeInfo.StartTime)
+	testutil.Equals(t, s.cwd, e.RuntimeInfo.CWD)
+
+	// Components that do not expose their status only report the component type.
+	testutil.Equals(t, Endpoint{Name: "rule:10901", Component: "rule"}, EndpointFromProto("rule:10901", &infopb.InfoResponse{ComponentType: "rule"}))
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/go-kit/kit/log/level"
 	"github.com/improbable-eng/thanos/pkg/block"
 	"github.com/improbable-eng/thanos/pkg/compact/downsample"
+	"github.com/improbable-eng/thanos/pkg/gate"
 	"github.com/improbable-eng/thanos/pkg/objstore"
 	"github.com/improbable-eng/thanos/pkg/pool"
 	"github.com/improbable-eng/thanos/pkg/store/storepb"
@@ -159,6 +160,10 @@ type BucketStore struct {
 	dir        string
 	indexCache *indexCache
 	chunkPool  *pool.BytesPool
+	seriesGate *gate.Gate
+
+	// Blocks marked for deletion longer than this are no longer served.
+	ignoreDeletionMarksDelay time.Duration
 
 	// Sets of blocks that have the same labels. They are indexed by a hash over their label set.
 	mtx       sync.RWMutex
@@ -168,6 +173,9 @@ type BucketStore struct {
 
 // NewBucketStore creates a new bucket backed store that implements the store API against
 // an object store bucket. It is optimized to work against high latency backends.
+// The series gate limits the number of concurrently processed Series requests.
+// Blocks marked for deletion are still served until ignoreDeletionMarksDelay passed, so queries keep working
+// until the blocks replacing them are loaded. It must be lower than the delete delay of the compactor.
 func NewBucketStore(
 	logger log.Logger,
 	reg prometheus.Registerer,
@@ -175,6 +183,8 @@ func NewBucketStore(
 	dir string,
 	indexCacheSizeBytes uint64,
 	maxChunkPoolBytes uint64,
+	seriesGate *gate.Gate,
+	ignoreDeletionMarksDelay time.Duration,
 ) (*BucketStore, error) {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -193,8 +203,11 @@ func NewBucketStore(
 		dir:        dir,
 		indexCache: indexCache,
 		chunkPool:  chunkPool,
+		seriesGate: seriesGate,
 		blocks:     map[ulid.ULID]*bucketBlock{},
 		blockSets:  map[uint64]*bucketBlockSet{},
+
+		ignoreDeletionMarksDelay: ignoreDeletionMarksDelay,
 	}
 	s.metrics = newBucketStoreMetrics(reg, s)
 
@@ -230,6 +243,10 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 		go func() {
 			for id := range blockc {
 				if err := s.addBlock(ctx, id); err != nil {
+					if block.IsCorruptionError(err) {
+						level.Error(s.logger).Log("msg", "loading corrupted block failed", "id", id, "err", err)
+						continue
+					}
 					level.Warn(s.logger).Log("msg", "loading block failed", "id", id, "err", err)
 					continue
 				}
@@ -246,6 +263,15 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 		if err != nil {
 			return nil
 		}
+
+		// Blocks marked for deletion long enough are left out of allIDs, so loaded ones are dropped below.
+		m, err := block.ReadDeletionMark(ctx, s.bucket, id)
+		if err != nil && err != block.ErrMarkNotFound {
+			level.Warn(s.logger).Log("msg", "reading deletion mark failed", "id", id, "err", err)
+		}
+		if err == nil && time.Since(time.Unix(m.DeletionTime, 0)) >= s.ignoreDeletionMarksDelay {
+			return nil
+		}
 		allIDs[id] = struct{}{}
 
 		if b := s.getBlock(id); b != nil {
@@ -636,6 +662,10 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 	if err != nil {
 		return status.Error(codes.InvalidArgument, err.Error())
 	}
+	if err := s.seriesGate.Start(srv.Context()); err != nil {
+		return gateError(err)
+	}
+	defer s.seriesGate.Done()
 	var (
 		stats = &queryStats{}
 		g     run.Group
@@ -751,7 +781,7 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 	s.metrics.seriesDataSizeFetched.WithLabelValues("chunks").Observe(float64(stats.chunksFetchedSizeSum))
 	s.metrics.resultSeriesCount.Observe(float64(stats.mergedSeriesCount))
 
-	level.Debug(s.logger).Log("msg", "series query processed",
+	level.Debug(tracing.LoggerWithTraceID(srv.Context(), s.logger)).Log("msg", "series query processed",
 		"stats", fmt.Sprintf("%+v", stats))
 
 	return nil
@@ -843,9 +873,16 @@ func (s *bucketBlockSet) add(b *bucketBlock) error {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
-	i := int64index(s.resolutions, b.meta.Thanos.Downsample.Resolution)
+	res := b.meta.Thanos.Downsample.Resolution
+	i := int64index(s.resolutions, res)
 	if i < 0 {
-		return errors.Errorf("unsupported downsampling resolution %d", b.meta.Thanos.Downsample.Resolution)
+		// Resolutions of custom downsampling levels are added once their first block is.
+		if res < 0 {
+			return errors.Errorf("unsupported downsampling resolution %d", res)
+		}
+		i = sort.Search(len(s.resolutions), func(j int) bool { return s.resolutions[j] < res })
+		s.resolutions = append(s.resolutions[:i], append([]int64{res}, s.resolutions[i:]...)...)
+		s.blocks = append(s.blocks[:i], append([][]*bucketBlock{nil}, s.blocks[i:]...)...)
 	}
 	bs := append(s.blocks[i], b)
 	s.blocks[i] = bs
@@ -906,6 +943,9 @@ func (s *bucketBlockSet) getFor(mint, maxt, minResolution int64) (bs []*bucketBl
 		if b.meta.MinTime >= maxt {
 			break
 		}
+		if b.meta.Thanos.HeadSnapshot && headSnapshotCovered(b, s.blocks[i]) {
+			continue
+		}
 		bs = append(bs, b)
 	}
 	// Our current resolution might not cover all data, recursively fill the gaps at the start
@@ -924,6 +964,29 @@ func (s *bucketBlockSet) getFor(mint, maxt, minResolution int64) (bs []*bucketBl
 	return append(left, append(bs, right...)...)
 }
 
+// headSnapshotCovered returns true if the time range of the head snapshot block b is covered by the persisted blocks
+// and newer head snapshots in bs, which are sorted by min time. Head snapshots overlap with the blocks Prometheus
+// persists later, so they are left out of queries as soon as those are loaded instead of returning their chunks twice
+// until the marked head snapshot is dropped.
+func headSnapshotCovered(b *bucketBlock, bs []*bucketBlock) bool {
+	t := b.meta.MinTime
+	for _, o := range bs {
+		if o == b || (o.meta.Thanos.HeadSnapshot && o.meta.ULID.Compare(b.meta.ULID) <= 0) {
+			continue
+		}
+		if o.meta.MinTime > t {
+			return false
+		}
+		if o.meta.MaxTime > t {
+			t = o.meta.MaxTime
+		}
+		if t >= b.meta.MaxTime {
+			return true
+		}
+	}
+	return false
+}
+
 // labelMatchers verifies whether the block set matches the given matchers and returns a new
 // set of matchers that is equivalent when querying data within the block.
 func (s *bucketBlockSet) labelMatchers(matchers ...labels.Matcher) ([]labels.Matcher, bool) {
@@ -959,6 +1022,8 @@ type bucketBlock struct {
 
 	indexObj  string
 	chunkObjs []string
+	// chunkSizes holds the sizes of the chunk objects if they are known from the meta file.
+	chunkSizes []int64
 
 	pendingReaders sync.WaitGroup
 }
@@ -986,7 +1051,14 @@ func newBucketBlock(
 	if err = b.loadIndexCache(ctx); err != nil {
 		return nil, errors.Wrap(err, "load index cache")
 	}
-	// Get object handles for all chunk files.
+	// Get object handles for all chunk files. Newer meta files list them, so the bucket does not need to be listed.
+	if files, ok := b.meta.Thanos.ChunkFiles(); ok {
+		for _, f := range files {
+			b.chunkObjs = append(b.chunkObjs, path.Join(id.String(), f.RelPath))
+			b.chunkSizes = append(b.chunkSizes, f.SizeBytes)
+		}
+		return b, nil
+	}
 	err = bkt.Iter(ctx, path.Join(id.String(), block.ChunksDirname), func(n string) error {
 		b.chunkObjs = append(b.chunkObjs, n)
 		return nil
@@ -1037,6 +1109,16 @@ func (b *bucketBlock) loadIndexCache(ctx context.Context) (err error) {
 	}
 	defer os.Remove(fn)
 
+	// Only the index is downloaded, chunks are fetched by ranges on query time.
+	for _, f := range b.meta.Thanos.Files {
+		if f.RelPath != block.IndexFilename {
+			continue
+		}
+		if err := block.VerifyFiles(b.dir, []block.File{f}); err != nil {
+			return errors.Wrap(err, "verify index file")
+		}
+	}
+
 	indexr, err := index.NewFileReader(fn)
 	if err != nil {
 		return errors.Wrap(err, "open index reader")
@@ -1069,6 +1151,20 @@ func (b *bucketBlock) readIndexRange(ctx context.Context, off, length int64) ([]
 }
 
 func (b *bucketBlock) readChunkRange(ctx context.Context, seq int, off, length int64) ([]byte, error) {
+	if seq >= len(b.chunkObjs) {
+		return nil, errors.Errorf("chunk segment %d of block %s does not exist", seq, b.meta.ULID)
+	}
+	// Requested ranges may reach beyond the end of the segment. Fetch only the existing bytes if the size is known.
+	if b.chunkSizes != nil {
+		size := b.chunkSizes[seq]
+		if off >= size {
+			return nil, errors.Errorf("offset %d beyond size %d of chunk segment %s", off, size, b.chunkObjs[seq])
+		}
+		if off+length > size {
+			length = size - off
+		}
+	}
+
 	c, err := b.chunkPool.Get(int(length))
 	if err != nil {
 		return nil, errors.Wrap(err, "allocate chunk bytes")
@@ -1077,7 +1173,7 @@ func (b *bucketBlock) readChunkRange(ctx context.Context, seq int, off, length i
 
 	r, err := b.bucket.GetRange(ctx, b.chunkObjs[seq], off, length)
 	if err != nil {
-		return nil, errors.Wrap(err, "get range reader")
+		return nil, errors.Wrapf(err, "get range reader of %s", b.chunkObjs[seq])
 	}
 	defer r.Close()
 
@@ -1596,3 +1692,16 @@ func (s queryStats) merge(o *queryStats) *queryStats {
 
 	return &s
 }
+
+// gateError converts error returned by a gate into gRPC status error.
+func gateError(err error) error {
+	switch err {
+	case gate.ErrQueueTimeout:
+		return status.Error(codes.ResourceExhausted, errors.Wrap(err, "too many concurrent requests").Error())
+	case context.Canceled:
+		return status.Error(codes.Canceled, err.Error())
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
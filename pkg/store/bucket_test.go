@@ -14,7 +14,10 @@ import (
 	"github.com/improbable-eng/thanos/pkg/compact/downsample"
 
 	"github.com/fortytw2/leaktest"
+	"github.com/go-kit/kit/log"
 	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/gate"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
 	"github.com/improbable-eng/thanos/pkg/runutil"
 	"github.com/improbable-eng/thanos/pkg/store/storepb"
 	"github.com/improbable-eng/thanos/pkg/testutil"
@@ -85,7 +88,7 @@ func TestBucketStore_e2e(t *testing.T) {
 		testutil.Ok(t, os.RemoveAll(dir2))
 	}
 
-	store, err := NewBucketStore(nil, nil, bkt, dir, 100, 0)
+	store, err := NewBucketStore(nil, nil, bkt, dir, 100, 0, gate.New(nil, "test", 20, 0), 0)
 	testutil.Ok(t, err)
 
 	go func() {
@@ -295,6 +298,86 @@ func TestBucketBlockSet_addGet(t *testing.T) {
 	}
 }
 
+func TestBucketBlockSet_getFor_rawOnly(t *testing.T) {
+	set := newBucketBlockSet(labels.Labels{})
+
+	var exp []*bucketBlock
+	for _, r := range [][2]int64{{0, 100}, {100, 200}} {
+		var m block.Meta
+		m.MinTime = r[0]
+		m.MaxTime = r[1]
+		b := &bucketBlock{meta: &m}
+		testutil.Ok(t, set.add(b))
+		exp = append(exp, b)
+	}
+	// Without downsampled blocks, e.g. with downsampling disabled in the compactor, raw blocks are used for all resolutions.
+	for _, res := range []int64{downsample.ResLevel0, downsample.ResLevel1, downsample.ResLevel2, 10 * downsample.ResLevel2} {
+		testutil.Equals(t, exp, set.getFor(0, 200, res))
+	}
+}
+
+func TestBucketBlockSet_getFor_customResolution(t *testing.T) {
+	set := newBucketBlockSet(labels.Labels{})
+
+	newBlock := func(id uint64, res, mint, maxt int64) *bucketBlock {
+		var m block.Meta
+		m.ULID = ulid.MustNew(id, nil)
+		m.Thanos.Downsample.Resolution = res
+		m.MinTime = mint
+		m.MaxTime = maxt
+		return &bucketBlock{meta: &m}
+	}
+	// Blocks of a 6h resolution configured as additional downsampling level.
+	res6h := 6 * downsample.ResLevel2
+	raw := newBlock(1, downsample.ResLevel0, 100, 200)
+	b6h := newBlock(2, res6h, 0, 100)
+	b1h := newBlock(3, downsample.ResLevel2, 0, 100)
+	testutil.Ok(t, set.add(raw))
+	testutil.Ok(t, set.add(b6h))
+	testutil.Ok(t, set.add(b1h))
+	testutil.NotOk(t, set.add(newBlock(4, -1, 0, 100)))
+
+	testutil.Equals(t, []*bucketBlock{b6h, raw}, set.getFor(0, 200, res6h))
+	testutil.Equals(t, []*bucketBlock{b1h, raw}, set.getFor(0, 200, res6h-1))
+
+	set.remove(b6h.meta.ULID)
+	testutil.Equals(t, []*bucketBlock{b1h, raw}, set.getFor(0, 200, res6h))
+}
+
+func TestBucketBlockSet_getFor_headSnapshots(t *testing.T) {
+	set := newBucketBlockSet(labels.Labels{})
+
+	newBlock := func(id uint64, mint, maxt int64, headSnapshot bool) *bucketBlock {
+		var m block.Meta
+		m.ULID = ulid.MustNew(id, nil)
+		m.MinTime = mint
+		m.MaxTime = maxt
+		m.Thanos.HeadSnapshot = headSnapshot
+		b := &bucketBlock{meta: &m}
+		testutil.Ok(t, set.add(b))
+		return b
+	}
+	b1 := newBlock(1, 0, 100, false)
+	// Head snapshots taken before the block of [100, 200) was persisted.
+	h1 := newBlock(2, 110, 150, true)
+	h2 := newBlock(3, 110, 250, true)
+	testutil.Equals(t, []*bucketBlock{b1, h2}, set.getFor(0, 300, 0))
+
+	// A persisted block not covering the whole head snapshot does not replace it.
+	b2 := newBlock(4, 100, 200, false)
+	testutil.Equals(t, []*bucketBlock{b1, b2, h2}, set.getFor(0, 300, 0))
+
+	b3 := newBlock(5, 200, 300, false)
+	testutil.Equals(t, []*bucketBlock{b1, b2, b3}, set.getFor(0, 300, 0))
+
+	// Head snapshots are served again once the persisted blocks covering them are dropped.
+	set.remove(b2.meta.ULID)
+	set.remove(b3.meta.ULID)
+	testutil.Equals(t, []*bucketBlock{b1, h2}, set.getFor(0, 300, 0))
+	set.remove(h2.meta.ULID)
+	testutil.Equals(t, []*bucketBlock{b1, h1}, set.getFor(0, 300, 0))
+}
+
 func TestBucketBlockSet_remove(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 
@@ -417,3 +500,36 @@ func TestPartitionRanges(t *testing.T) {
 		testutil.Equals(t, c.expected, res)
 	}
 }
+
+func TestBucketStore_SyncBlocks_DeletionMark(t *testing.T) {
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+
+	dir, err := ioutil.TempDir("", "test_bucketstore_deletion_mark")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	series := []labels.Labels{labels.FromStrings("a", "1")}
+	extLset := labels.FromStrings("ext1", "value1")
+
+	var ids []ulid.ULID
+	for i := 0; i < 2; i++ {
+		id, err := testutil.CreateBlock(dir, series, 10, int64(i)*1000, int64(i+1)*1000, extLset, 0)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, bkt, filepath.Join(dir, id.String())))
+		ids = append(ids, id)
+	}
+	testutil.Ok(t, block.MarkForDeletion(ctx, log.NewNopLogger(), bkt, ids[0], "test"))
+
+	// Recently marked blocks are still served.
+	store, err := NewBucketStore(nil, nil, bkt, filepath.Join(dir, "store"), 100, 0, gate.New(nil, "test", 20, 0), time.Hour)
+	testutil.Ok(t, err)
+	testutil.Ok(t, store.SyncBlocks(ctx))
+	testutil.Equals(t, 2, store.numBlocks())
+
+	// Once the delay passed, the marked block is dropped.
+	store.ignoreDeletionMarksDelay = 0
+	testutil.Ok(t, store.SyncBlocks(ctx))
+	testutil.Equals(t, 1, store.numBlocks())
+	testutil.Assert(t, store.getBlock(ids[1]) != nil, "unmarked block not loaded")
+}
@@ -41,6 +41,7 @@ type indexCache struct {
 	requests    *prometheus.CounterVec
 	hits        *prometheus.CounterVec
 	added       *prometheus.CounterVec
+	overflow    *prometheus.CounterVec
 	current     *prometheus.GaugeVec
 	currentSize *prometheus.GaugeVec
 }
@@ -61,6 +62,11 @@ func newIndexCache(reg prometheus.Registerer, maxBytes uint64) (*indexCache, err
 		Help: "Total number of items that were added to the index cache.",
 	}, []string{"item_type"})
 
+	c.overflow = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_store_index_cache_items_overflowed_total",
+		Help: "Total number of items that could not be added to the index cache because they are larger than its maximum size.",
+	}, []string{"item_type"})
+
 	c.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "thanos_store_index_cache_requests_total",
 		Help: "Total number of requests to the cache.",
@@ -81,9 +87,16 @@ func newIndexCache(reg prometheus.Registerer, maxBytes uint64) (*indexCache, err
 		Help: "Current byte size of items in the index cache.",
 	}, []string{"item_type"})
 
-	// Initialize eviction metric with 0.
-	evicted.WithLabelValues(cacheTypePostings).Set(0)
-	evicted.WithLabelValues(cacheTypeSeries).Set(0)
+	// Initialize all metrics with 0, so misses can be computed before the first hit.
+	for _, typ := range []string{cacheTypePostings, cacheTypeSeries} {
+		evicted.WithLabelValues(typ)
+		c.added.WithLabelValues(typ)
+		c.overflow.WithLabelValues(typ)
+		c.requests.WithLabelValues(typ)
+		c.hits.WithLabelValues(typ)
+		c.current.WithLabelValues(typ)
+		c.currentSize.WithLabelValues(typ)
+	}
 
 	// Initialize LRU cache with a high size limit since we will manage evictions ourselves
 	// based on stored size.
@@ -110,75 +123,77 @@ func newIndexCache(reg prometheus.Registerer, maxBytes uint64) (*indexCache, err
 		}, func() float64 {
 			return float64(maxBytes)
 		}))
-		reg.MustRegister(c.requests, c.hits, c.added, evicted, c.current, c.currentSize)
+		reg.MustRegister(c.requests, c.hits, c.added, c.overflow, evicted, c.current, c.currentSize)
 	}
 	return c, nil
 }
 
-func (c *indexCache) ensureFits(b []byte) {
-	for c.curSize+uint64(len(b)) > c.maxSize {
-		c.lru.RemoveOldest()
+// ensureFits evicts the least recently used items until an item of the given size fits into the cache. It returns
+// false if the item is larger than the maximum size of the cache.
+func (c *indexCache) ensureFits(size uint64) bool {
+	if size > c.maxSize {
+		return false
+	}
+	for c.curSize+size > c.maxSize {
+		if _, _, ok := c.lru.RemoveOldest(); !ok {
+			return false
+		}
 	}
+	return true
 }
 
-func (c *indexCache) setPostings(b ulid.ULID, l labels.Label, v []byte) {
-	c.added.WithLabelValues(cacheTypePostings).Inc()
-
+func (c *indexCache) set(typ string, key cacheItem, v []byte) {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	c.ensureFits(v)
+	// Concurrent requests may fetch the same item, it only needs to be cached once.
+	if c.lru.Contains(key) {
+		return
+	}
+	size := uint64(len(v))
+	if !c.ensureFits(size) {
+		c.overflow.WithLabelValues(typ).Inc()
+		return
+	}
 
 	// The caller may be passing in a sub-slice of a huge array. Copy the data
 	// to ensure we don't waste huge amounts of space for something small.
 	cv := make([]byte, len(v))
 	copy(cv, v)
-	c.lru.Add(cacheItem{b, cacheKeyPostings(l)}, cv)
+	c.lru.Add(key, cv)
+	c.curSize += size
 
-	c.currentSize.WithLabelValues(cacheTypePostings).Add(float64(len(v)))
+	c.added.WithLabelValues(typ).Inc()
+	c.current.WithLabelValues(typ).Inc()
+	c.currentSize.WithLabelValues(typ).Add(float64(size))
 }
 
-func (c *indexCache) postings(b ulid.ULID, l labels.Label) ([]byte, bool) {
-	c.requests.WithLabelValues(cacheTypePostings).Inc()
+func (c *indexCache) get(typ string, key cacheItem) ([]byte, bool) {
+	c.requests.WithLabelValues(typ).Inc()
 
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	v, ok := c.lru.Get(cacheItem{b, cacheKeyPostings(l)})
+	v, ok := c.lru.Get(key)
 	if !ok {
 		return nil, false
 	}
-	c.hits.WithLabelValues(cacheTypePostings).Inc()
+	c.hits.WithLabelValues(typ).Inc()
 	return v.([]byte), true
 }
 
-func (c *indexCache) setSeries(b ulid.ULID, id uint64, v []byte) {
-	c.added.WithLabelValues(cacheTypeSeries).Inc()
-
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
-
-	c.ensureFits(v)
+func (c *indexCache) setPostings(b ulid.ULID, l labels.Label, v []byte) {
+	c.set(cacheTypePostings, cacheItem{b, cacheKeyPostings(l)}, v)
+}
 
-	// The caller may be passing in a sub-slice of a huge array. Copy the data
-	// to ensure we don't waste huge amounts of space for something small.
-	cv := make([]byte, len(v))
-	copy(cv, v)
-	c.lru.Add(cacheItem{b, cacheKeySeries(id)}, cv)
+func (c *indexCache) postings(b ulid.ULID, l labels.Label) ([]byte, bool) {
+	return c.get(cacheTypePostings, cacheItem{b, cacheKeyPostings(l)})
+}
 
-	c.currentSize.WithLabelValues(cacheTypeSeries).Add(float64(len(v)))
+func (c *indexCache) setSeries(b ulid.ULID, id uint64, v []byte) {
+	c.set(cacheTypeSeries, cacheItem{b, cacheKeySeries(id)}, v)
 }
 
 func (c *indexCache) series(b ulid.ULID, id uint64) ([]byte, bool) {
-	c.requests.WithLabelValues(cacheTypeSeries).Inc()
-
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
-
-	v, ok := c.lru.Get(cacheItem{b, cacheKeySeries(id)})
-	if !ok {
-		return nil, false
-	}
-	c.hits.WithLabelValues(cacheTypeSeries).Inc()
-	return v.([]byte), true
+	return c.get(cacheTypeSeries, cacheItem{b, cacheKeySeries(id)})
 }
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/tsdb/labels"
+)
+
+func TestIndexCache_Eviction(t *testing.T) {
+	cache, err := newIndexCache(nil, 10)
+	testutil.Ok(t, err)
+
+	id := ulid.MustNew(0, nil)
+	lbl := labels.Label{Name: "a", Value: "1"}
+	value := func(c prometheus.Metric) float64 {
+		var m dto.Metric
+		testutil.Ok(t, c.Write(&m))
+		if m.Gauge != nil {
+			return m.Gauge.GetValue()
+		}
+		return m.Counter.GetValue()
+	}
+
+	_, ok := cache.postings(id, lbl)
+	testutil.Assert(t, !ok, "expected miss on empty cache")
+
+	cache.setPostings(id, lbl, []byte{1, 2, 3, 4})
+	cache.setSeries(id, 1, []byte{1, 2, 3, 4})
+	b, ok := cache.postings(id, lbl)
+	testutil.Assert(t, ok, "expected postings to be cached")
+	testutil.Equals(t, []byte{1, 2, 3, 4}, b)
+	testutil.Equals(t, uint64(8), cache.curSize)
+
+	// Adding an item again does not count it twice.
+	cache.setSeries(id, 1, []byte{1, 2, 3, 4})
+	testutil.Equals(t, uint64(8), cache.curSize)
+	testutil.Equals(t, 1.0, value(cache.current.WithLabelValues(cacheTypeSeries)))
+
+	// The series were used least recently and are evicted first.
+	cache.setSeries(id, 2, []byte{1, 2, 3})
+	_, ok = cache.series(id, 1)
+	testutil.Assert(t, !ok, "expected series to be evicted")
+	_, ok = cache.postings(id, lbl)
+	testutil.Assert(t, ok, "expected postings to be cached")
+	testutil.Equals(t, uint64(7), cache.curSize)
+	testutil.Equals(t, 1.0, value(cache.current.WithLabelValues(cacheTypeSeries)))
+	testutil.Equals(t, 3.0, value(cache.currentSize.WithLabelValues(cacheTypeSeries)))
+
+	// Items larger than the cache are never added and do not evict others.
+	cache.setSeries(id, 3, make([]byte, 11))
+	_, ok = cache.series(id, 3)
+	testutil.Assert(t, !ok, "expected oversized series not to be cached")
+	testutil.Equals(t, uint64(7), cache.curSize)
+	testutil.Equals(t, 1.0, value(cache.overflow.WithLabelValues(cacheTypeSeries)))
+
+	testutil.Equals(t, 3.0, value(cache.requests.WithLabelValues(cacheTypePostings)))
+	testutil.Equals(t, 2.0, value(cache.hits.WithLabelValues(cacheTypePostings)))
+	testutil.Equals(t, 2.0, value(cache.requests.WithLabelValues(cacheTypeSeries)))
+	testutil.Equals(t, 0.0, value(cache.hits.WithLabelValues(cacheTypeSeries)))
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"io"
 	"math"
+	"sort"
 	"sync"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/gate"
 	"github.com/improbable-eng/thanos/pkg/store/storepb"
 	"github.com/improbable-eng/thanos/pkg/strutil"
+	"github.com/improbable-eng/thanos/pkg/tracing"
 	"github.com/pkg/errors"
 	"github.com/prometheus/tsdb/labels"
 	"golang.org/x/sync/errgroup"
@@ -26,6 +30,9 @@ type Client interface {
 
 	// Minimum and maximum time range of data in the store.
 	TimeRange() (mint int64, maxt int64)
+
+	// String returns the address of the store.
+	String() string
 }
 
 // ProxyStore implements the store API that proxies request to all given underlying stores.
@@ -33,14 +40,17 @@ type ProxyStore struct {
 	logger         log.Logger
 	stores         func(context.Context) ([]Client, error)
 	selectorLabels labels.Labels
+	storeGate      *gate.Keyed
 }
 
 // NewProxyStore returns a new ProxyStore that uses the given clients that implements storeAPI to fan-in all series to the client.
 // Note that there is no deduplication support. Deduplication should be done on the highest level (just before PromQL)
+// The store gate limits the number of concurrent Series requests to a single store. It can be nil.
 func NewProxyStore(
 	logger log.Logger,
 	stores func(context.Context) ([]Client, error),
 	selectorLabels labels.Labels,
+	storeGate *gate.Keyed,
 ) *ProxyStore {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -49,6 +59,7 @@ func NewProxyStore(
 		logger:         logger,
 		stores:         stores,
 		selectorLabels: selectorLabels,
+		storeGate:      storeGate,
 	}
 	return s
 }
@@ -83,6 +94,7 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 	var (
 		respCh    = make(chan *storepb.SeriesResponse, 10)
 		seriesSet []storepb.SeriesSet
+		warnings  []error
 		g         errgroup.Group
 	)
 
@@ -90,6 +102,7 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 	if err != nil {
 		return status.Errorf(codes.Unknown, err.Error())
 	}
+	var matching []Client
 	for _, st := range stores {
 		// We might be able to skip the store if its meta information indicates
 		// it cannot have series matching our query.
@@ -97,6 +110,23 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 		if ok, _ := storeMatches(st, r.MinTime, r.MaxTime, newMatchers...); !ok {
 			continue
 		}
+		matching = append(matching, st)
+	}
+	// Streams hold the slot of their store until they are consumed, which only starts once all of them are opened.
+	// All requests take the slots in the same order, so no two of them wait for a slot held by the other.
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].String() < matching[j].String()
+	})
+	dones, errs := s.startStores(srv.Context(), matching)
+
+	for i, st := range matching {
+		done, err := dones[i], errs[i]
+		if err != nil {
+			err = errors.Wrapf(err, "wait for concurrency limit of store %v", st.Labels())
+			level.Warn(tracing.LoggerWithTraceID(srv.Context(), s.logger)).Log("msg", "partial response", "err", err)
+			warnings = append(warnings, err)
+			continue
+		}
 		sc, err := st.Series(srv.Context(), &storepb.SeriesRequest{
 			MinTime:             r.MinTime,
 			MaxTime:             r.MaxTime,
@@ -105,16 +135,23 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 			MaxResolutionWindow: r.MaxResolutionWindow,
 		})
 		if err != nil {
-			respCh <- storepb.NewWarnSeriesResponse(errors.Wrapf(err, "fetch series for store %v", st.Labels()))
+			done()
+			err = errors.Wrapf(err, "fetch series for store %v", st.Labels())
+			level.Warn(tracing.LoggerWithTraceID(srv.Context(), s.logger)).Log("msg", "partial response", "err", err)
+			warnings = append(warnings, err)
 			continue
 		}
 
-		seriesSet = append(seriesSet, startStreamSeriesSet(sc, respCh, 10))
+		seriesSet = append(seriesSet, startStreamSeriesSet(sc, respCh, 10, done))
 	}
 
 	g.Go(func() error {
 		defer close(respCh)
 
+		for _, w := range warnings {
+			respCh <- storepb.NewWarnSeriesResponse(w)
+		}
+
 		mergedSet := storepb.MergeSeriesSets(seriesSet...)
 		for mergedSet.Next() {
 			var series storepb.Series
@@ -133,11 +170,67 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 	return g.Wait()
 }
 
+// startStores waits until Series requests can be sent to the given stores, which must be sorted by their addresses.
+// For each store, it returns either a function that must be called once its request finished or the error of waiting.
+// Stores of the same address share a single slot, as the request would otherwise wait for a slot it holds itself.
+func (s *ProxyStore) startStores(ctx context.Context, stores []Client) ([]func(), []error) {
+	var (
+		dones = make([]func(), len(stores))
+		errs  = make([]error, len(stores))
+	)
+	for i := 0; i < len(stores); {
+		j := i + 1
+		for j < len(stores) && stores[j].String() == stores[i].String() {
+			j++
+		}
+		done, err := s.startStore(ctx, stores[i])
+		if err != nil {
+			for k := i; k < j; k++ {
+				errs[k] = err
+			}
+			i = j
+			continue
+		}
+
+		var (
+			mtx  sync.Mutex
+			refs = j - i
+		)
+		for k := i; k < j; k++ {
+			dones[k] = func() {
+				mtx.Lock()
+				refs--
+				last := refs == 0
+				mtx.Unlock()
+				if last {
+					done()
+				}
+			}
+		}
+		i = j
+	}
+	return dones, errs
+}
+
+// startStore waits until a Series request can be sent to the store. The returned function must be called
+// once the request finished.
+func (s *ProxyStore) startStore(ctx context.Context, st Client) (func(), error) {
+	if s.storeGate == nil {
+		return func() {}, nil
+	}
+	key := st.String()
+	if err := s.storeGate.Start(ctx, key); err != nil {
+		return nil, err
+	}
+	return func() { s.storeGate.Done(key) }, nil
+}
+
 // streamSeriesSet iterates over incoming stream of series.
 // All errors are sent out of band via warning channel.
 type streamSeriesSet struct {
 	stream storepb.Store_SeriesClient
 	warnCh chan<- *storepb.SeriesResponse
+	done   func()
 
 	currSeries *storepb.Series
 	recvCh     chan *storepb.Series
@@ -147,10 +240,12 @@ func startStreamSeriesSet(
 	stream storepb.Store_SeriesClient,
 	warnCh chan<- *storepb.SeriesResponse,
 	bufferSize int,
+	done func(),
 ) *streamSeriesSet {
 	s := &streamSeriesSet{
 		stream: stream,
 		warnCh: warnCh,
+		done:   done,
 		recvCh: make(chan *storepb.Series, bufferSize),
 	}
 	go s.fetchLoop()
@@ -158,6 +253,7 @@ func startStreamSeriesSet(
 }
 
 func (s *streamSeriesSet) fetchLoop() {
+	defer s.done()
 	defer close(s.recvCh)
 	for {
 		r, err := s.stream.Recv()
@@ -234,6 +330,7 @@ func (s *ProxyStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequ
 		all      [][]string
 		mtx      sync.Mutex
 		wg       sync.WaitGroup
+		logger   = tracing.LoggerWithTraceID(ctx, s.logger)
 	)
 	stores, err := s.stores(ctx)
 	if err != nil {
@@ -247,8 +344,11 @@ func (s *ProxyStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequ
 				Label: r.Label,
 			})
 			if err != nil {
+				err = errors.Wrap(err, "fetch label values")
+				level.Warn(logger).Log("msg", "partial response", "err", err)
+
 				mtx.Lock()
-				warnings = append(warnings, errors.Wrap(err, "fetch label values").Error())
+				warnings = append(warnings, err.Error())
 				mtx.Unlock()
 				return
 			}
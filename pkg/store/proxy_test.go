@@ -2,12 +2,14 @@ package store
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"testing"
 
 	"time"
 
 	"github.com/fortytw2/leaktest"
+	"github.com/improbable-eng/thanos/pkg/gate"
 	"github.com/improbable-eng/thanos/pkg/store/storepb"
 	"github.com/improbable-eng/thanos/pkg/testutil"
 	"github.com/pkg/errors"
@@ -26,6 +28,7 @@ type testClient struct {
 	labels  []storepb.Label
 	minTime int64
 	maxTime int64
+	name    string
 }
 
 func (c *testClient) Labels() []storepb.Label {
@@ -37,6 +40,9 @@ func (c *testClient) TimeRange() (int64, int64) {
 }
 
 func (c *testClient) String() string {
+	if c.name != "" {
+		return c.name
+	}
 	return "test"
 }
 
@@ -96,6 +102,7 @@ func TestQueryStore_Series(t *testing.T) {
 	q := NewProxyStore(nil,
 		func(context.Context) ([]Client, error) { return cls, nil },
 		tlabels.FromStrings("fed", "a"),
+		nil,
 	)
 
 	ctx := context.Background()
@@ -169,6 +176,91 @@ func TestQueryStore_Series(t *testing.T) {
 	testutil.Equals(t, 2, len(s2.Warnings))
 }
 
+func TestQueryStore_Series_StoreGate(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	// Responses exceed the buffers of the streams, so streams keep their slot until the series are merged.
+	newClient := func(name string) Client {
+		var resps []*storepb.SeriesResponse
+		for i := 0; i < 30; i++ {
+			resps = append(resps, storeSeriesResponse(t, labels.FromStrings("store", name, "i", fmt.Sprintf("%02d", i)), []sample{{1, 1}}))
+		}
+		return &testClient{
+			StoreClient: &storeClient{RespSet: resps},
+			minTime:     1,
+			maxTime:     300,
+			name:        name,
+		}
+	}
+	a, b := newClient("a"), newClient("b")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 10; i++ {
+		var (
+			order     = [][]Client{{a, b}, {b, a}}
+			storeGate = gate.NewKeyed(nil, "test", 1, 0)
+			errs      = make(chan error, len(order))
+		)
+		for _, stores := range order {
+			stores := stores
+			go func() {
+				q := NewProxyStore(nil, func(context.Context) ([]Client, error) { return stores, nil }, nil, storeGate)
+				srv := newStoreSeriesServer(ctx)
+				if err := q.Series(&storepb.SeriesRequest{MinTime: 1, MaxTime: 300}, srv); err != nil {
+					errs <- err
+					return
+				}
+				if len(srv.Warnings) > 0 {
+					errs <- errors.Errorf("unexpected warnings %v", srv.Warnings)
+					return
+				}
+				if len(srv.SeriesSet) != 60 {
+					errs <- errors.Errorf("expected 60 series, got %d", len(srv.SeriesSet))
+					return
+				}
+				errs <- nil
+			}()
+		}
+		for range order {
+			testutil.Ok(t, <-errs)
+		}
+	}
+}
+
+func TestQueryStore_Series_StoreGate_SameAddress(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	newClient := func(name string) Client {
+		var resps []*storepb.SeriesResponse
+		for i := 0; i < 30; i++ {
+			resps = append(resps, storeSeriesResponse(t, labels.FromStrings("store", name, "i", fmt.Sprintf("%02d", i)), []sample{{1, 1}}))
+		}
+		return &testClient{
+			StoreClient: &storeClient{RespSet: resps},
+			labels:      []storepb.Label{{Name: "ext", Value: name}},
+			minTime:     1,
+			maxTime:     300,
+			name:        "a",
+		}
+	}
+	// Both clients have the same address, so a request would wait for itself if each of them took a slot.
+	stores := []Client{newClient("1"), newClient("2")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	storeGate := gate.NewKeyed(nil, "test", 1, 0)
+	for i := 0; i < 2; i++ {
+		q := NewProxyStore(nil, func(context.Context) ([]Client, error) { return stores, nil }, nil, storeGate)
+		srv := newStoreSeriesServer(ctx)
+		testutil.Ok(t, q.Series(&storepb.SeriesRequest{MinTime: 1, MaxTime: 300}, srv))
+		testutil.Equals(t, 0, len(srv.Warnings))
+		testutil.Equals(t, 60, len(srv.SeriesSet))
+	}
+}
+
 func TestStoreMatches(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 
@@ -45,7 +45,13 @@ func NewObjectStoreBucket(t testing.TB) (*gcs.Bucket, func(), error) {
 		return nil, nil, err
 	}
 
-	return gcs.NewBucket(name, bkt, nil), func() {
+	b, err := gcs.NewBucket(name, bkt, &gcs.Config{}, nil)
+	if err != nil {
+		cancel()
+		gcsClient.Close()
+		return nil, nil, err
+	}
+	return b, func() {
 		deleteAllBucket(t, ctx, bkt)
 		cancel()
 		gcsClient.Close()
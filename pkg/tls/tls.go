@@ -0,0 +1,147 @@
+// Package tls builds TLS configuration of gRPC servers and clients from certificate files.
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// ServerConfig holds TLS files of a server. TLS is disabled if no certificate is set.
+type ServerConfig struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables verification of client certificates signed by the CA.
+	ClientCAFile string
+}
+
+// RegisterServerFlags registers the gRPC server TLS flags and returns an initialized ServerConfig struct.
+func RegisterServerFlags(cmd *kingpin.CmdClause) *ServerConfig {
+	var c ServerConfig
+
+	cmd.Flag("grpc-server-tls-cert", "TLS certificate for the gRPC server, leave blank to disable TLS.").
+		Default("").StringVar(&c.CertFile)
+	cmd.Flag("grpc-server-tls-key", "TLS key for the gRPC server, leave blank to disable TLS.").
+		Default("").StringVar(&c.KeyFile)
+	cmd.Flag("grpc-server-tls-client-ca", "TLS CA to verify clients against. If no client CA is specified, there is no client verification on server side.").
+		Default("").StringVar(&c.ClientCAFile)
+
+	return &c
+}
+
+// TLSConfig returns the server TLS configuration, or nil if TLS is disabled.
+func (c *ServerConfig) TLSConfig() (*tls.Config, error) {
+	return NewServerConfig(c.CertFile, c.KeyFile, c.ClientCAFile)
+}
+
+// ClientConfig holds TLS files of a client.
+type ClientConfig struct {
+	Secure     bool
+	CertFile   string
+	KeyFile    string
+	CAFile     string
+	ServerName string
+}
+
+// RegisterClientFlags registers the gRPC client TLS flags and returns an initialized ClientConfig struct.
+func RegisterClientFlags(cmd *kingpin.CmdClause) *ClientConfig {
+	var c ClientConfig
+
+	cmd.Flag("grpc-client-tls-secure", "Use TLS when talking to the gRPC server.").
+		Default("false").BoolVar(&c.Secure)
+	cmd.Flag("grpc-client-tls-cert", "TLS certificates to identify this client to the server.").
+		Default("").StringVar(&c.CertFile)
+	cmd.Flag("grpc-client-tls-key", "TLS key for the client's certificate.").
+		Default("").StringVar(&c.KeyFile)
+	cmd.Flag("grpc-client-tls-ca", "TLS CA certificates to use to verify gRPC servers. If empty, the system CA certificates are used.").
+		Default("").StringVar(&c.CAFile)
+	cmd.Flag("grpc-client-server-name", "Server name to verify the hostname on the returned gRPC certificates. See https://tools.ietf.org/html/rfc4366#section-3.1").
+		Default("").StringVar(&c.ServerName)
+
+	return &c
+}
+
+// TLSConfig returns the client TLS configuration, or nil if TLS is disabled.
+func (c *ClientConfig) TLSConfig() (*tls.Config, error) {
+	if !c.Secure {
+		return nil, nil
+	}
+	return NewClientConfig(c.CertFile, c.KeyFile, c.CAFile, c.ServerName, false)
+}
+
+// NewServerConfig returns TLS configuration of a server with the given certificate. If clientCA is set,
+// clients have to present a certificate signed by it. It returns nil if cert and key are empty.
+func NewServerConfig(cert, key, clientCA string) (*tls.Config, error) {
+	if cert == "" && key == "" {
+		if clientCA != "" {
+			return nil, errors.New("when a client CA is used a server key and certificate must also be provided")
+		}
+		return nil, nil
+	}
+	if cert == "" || key == "" {
+		return nil, errors.New("both server key and certificate must be provided")
+	}
+
+	tlsCert, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "load server certificate")
+	}
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{tlsCert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCA != "" {
+		pool, err := certPool(clientCA)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsCfg, nil
+}
+
+// NewClientConfig returns TLS configuration of a client. Servers are verified against the given CA
+// or the system CA certificates if it is empty. The client certificate is optional.
+func NewClientConfig(cert, key, ca, serverName string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	if ca != "" {
+		pool, err := certPool(ca)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if (cert == "") != (key == "") {
+		return nil, errors.New("both client key and certificate must be provided")
+	}
+	if cert != "" {
+		tlsCert, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, errors.Wrap(err, "load client certificate")
+		}
+		tlsCfg.Certificates = []tls.Certificate{tlsCert}
+	}
+	return tlsCfg, nil
+}
+
+func certPool(caFile string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read CA file %s", caFile)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, errors.Errorf("no certificates found in CA file %s", caFile)
+	}
+	return pool, nil
+}
@@ -0,0 +1,146 @@
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/testutil"
+)
+
+type certFiles struct {
+	cert, key string
+}
+
+// writeCert creates certificate signed by the parent, or self-signed CA if parent is nil, and writes it with its key into dir.
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (certFiles, *x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testutil.Ok(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	testutil.Ok(t, err)
+	cert, err := x509.ParseCertificate(der)
+	testutil.Ok(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	testutil.Ok(t, err)
+
+	f := certFiles{cert: filepath.Join(dir, name+".crt"), key: filepath.Join(dir, name+".key")}
+	testutil.Ok(t, ioutil.WriteFile(f.cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	testutil.Ok(t, ioutil.WriteFile(f.key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return f, cert, key
+}
+
+func handshake(t *testing.T, srvCfg, clientCfg *tls.Config) error {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", srvCfg)
+	testutil.Ok(t, err)
+	defer l.Close()
+
+	srvErr := make(chan error, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			srvErr <- err
+			return
+		}
+		defer c.Close()
+		srvErr <- c.(*tls.Conn).Handshake()
+	}()
+
+	c, err := tls.Dial("tcp", l.Addr().String(), clientCfg)
+	if err == nil {
+		// The client finishes its handshake before the server verifies the client certificate.
+		if _, err = c.Read(make([]byte, 1)); err == io.EOF {
+			// Server closed the connection after successful handshake.
+			err = nil
+		}
+		c.Close()
+	}
+	if sErr := <-srvErr; sErr != nil {
+		return sErr
+	}
+	return err
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-tls")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	ca, caCert, caKey := writeCert(t, dir, "ca", nil, nil)
+	srv, _, _ := writeCert(t, dir, "store", caCert, caKey)
+	client, _, _ := writeCert(t, dir, "query", caCert, caKey)
+	otherCA, otherCACert, otherCAKey := writeCert(t, dir, "other-ca", nil, nil)
+	otherClient, _, _ := writeCert(t, dir, "other-query", otherCACert, otherCAKey)
+
+	srvCfg, err := NewServerConfig(srv.cert, srv.key, ca.cert)
+	testutil.Ok(t, err)
+
+	clientCfg, err := NewClientConfig(client.cert, client.key, ca.cert, "store", false)
+	testutil.Ok(t, err)
+	testutil.Ok(t, handshake(t, srvCfg, clientCfg))
+
+	// Client without certificate.
+	clientCfg, err = NewClientConfig("", "", ca.cert, "store", false)
+	testutil.Ok(t, err)
+	testutil.NotOk(t, handshake(t, srvCfg, clientCfg))
+
+	// Client with certificate signed by other CA.
+	clientCfg, err = NewClientConfig(otherClient.cert, otherClient.key, ca.cert, "store", false)
+	testutil.Ok(t, err)
+	testutil.NotOk(t, handshake(t, srvCfg, clientCfg))
+
+	// Server not trusted by client.
+	clientCfg, err = NewClientConfig(client.cert, client.key, otherCA.cert, "store", false)
+	testutil.Ok(t, err)
+	testutil.NotOk(t, handshake(t, srvCfg, clientCfg))
+}
+
+func TestNewServerConfig(t *testing.T) {
+	c, err := NewServerConfig("", "", "")
+	testutil.Ok(t, err)
+	testutil.Assert(t, c == nil, "expected TLS to be disabled")
+
+	_, err = NewServerConfig("", "", "ca.crt")
+	testutil.NotOk(t, err)
+	_, err = NewServerConfig("server.crt", "", "")
+	testutil.NotOk(t, err)
+}
+
+func TestNewClientConfig(t *testing.T) {
+	_, err := NewClientConfig("client.crt", "", "", "", false)
+	testutil.NotOk(t, err)
+	_, err = NewClientConfig("", "", "/nonexistent/ca.crt", "", false)
+	testutil.NotOk(t, err)
+
+	c, err := NewClientConfig("", "", "", "store", true)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "store", c.ServerName)
+	testutil.Assert(t, c.InsecureSkipVerify, "expected insecure skip verify")
+}
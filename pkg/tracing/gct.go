@@ -3,15 +3,18 @@ package tracing
 
 import (
 	"context"
-
 	"fmt"
+	"os"
 
+	"cloud.google.com/go/compute/metadata"
 	"cloud.google.com/go/trace/apiv1"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/lovoo/gcloud-opentracing"
 	"github.com/opentracing/basictracer-go"
 	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
 )
 
 type gcloudRecorderLogger struct {
@@ -26,13 +29,69 @@ func (l *gcloudRecorderLogger) Errorf(format string, args ...interface{}) {
 	level.Error(l.logger).Log("msg", fmt.Sprintf(format, args...))
 }
 
+// StackdriverConfig is the configuration of the Google Cloud Trace (Stackdriver) provider.
+type StackdriverConfig struct {
+	// ProjectID defaults to the project of the GCE instance Thanos runs on.
+	ProjectID string `yaml:"project_id"`
+	// SampleFactor makes every 1/<sample_factor> trace sampled. If 0, only traces forced by baggage are sent.
+	SampleFactor uint64 `yaml:"sample_factor"`
+	// ClusterName is added to every span. It defaults to the name of the GKE cluster Thanos runs on.
+	ClusterName string `yaml:"cluster_name"`
+}
+
+// metadataClient gives access to the GCE metadata server.
+type metadataClient interface {
+	OnGCE() bool
+	ProjectID() (string, error)
+	InstanceAttributeValue(attr string) (string, error)
+}
+
+type gceMetadata struct{}
+
+func (gceMetadata) OnGCE() bool                { return metadata.OnGCE() }
+func (gceMetadata) ProjectID() (string, error) { return metadata.ProjectID() }
+func (gceMetadata) InstanceAttributeValue(attr string) (string, error) {
+	return metadata.InstanceAttributeValue(attr)
+}
+
+func parseStackdriverConfig(conf []byte, md metadataClient) (StackdriverConfig, error) {
+	c := StackdriverConfig{SampleFactor: 1}
+	if err := yaml.UnmarshalStrict(conf, &c); err != nil {
+		return c, errors.Wrap(err, "parse stackdriver tracing config")
+	}
+	if c.ProjectID != "" && c.ClusterName != "" {
+		return c, nil
+	}
+	if !md.OnGCE() {
+		if c.ProjectID == "" {
+			return c, errors.New("no project_id specified for stackdriver tracing and not running on GCE")
+		}
+		return c, nil
+	}
+
+	if c.ProjectID == "" {
+		id, err := md.ProjectID()
+		if err != nil {
+			return c, errors.Wrap(err, "get project ID from GCE metadata")
+		}
+		c.ProjectID = id
+	}
+	if c.ClusterName == "" {
+		// GKE nodes have the cluster name in the instance attributes, it is not set on plain GCE instances.
+		if name, err := md.InstanceAttributeValue("cluster-name"); err == nil {
+			c.ClusterName = name
+		}
+	}
+	return c, nil
+}
+
 // NewOptionalGCloudTracer returns GoogleCloudTracer Tracer. In case of error it log warning and returns noop tracer.
 func NewOptionalGCloudTracer(ctx context.Context, logger log.Logger, gcloudTraceProjectID string, sampleFactor uint64, debugName string) (opentracing.Tracer, func() error) {
 	if gcloudTraceProjectID == "" {
 		return &opentracing.NoopTracer{}, func() error { return nil }
 	}
 
-	tracer, closeFn, err := newGCloudTracer(ctx, logger, gcloudTraceProjectID, sampleFactor, debugName)
+	tracer, closeFn, err := newGCloudTracer(ctx, logger, gcloudTraceProjectID, sampleFactor, debugName, gcloudResourceTags(gcloudTraceProjectID, ""))
 	if err != nil {
 		level.Warn(logger).Log("msg", "failed to init Google Cloud Tracer. Tracing will be disabled", "err", err)
 		return &opentracing.NoopTracer{}, func() error { return nil }
@@ -41,7 +100,19 @@ func NewOptionalGCloudTracer(ctx context.Context, logger log.Logger, gcloudTrace
 	return tracer, closeFn
 }
 
-func newGCloudTracer(ctx context.Context, logger log.Logger, gcloudTraceProjectID string, sampleFactor uint64, debugName string) (opentracing.Tracer, func() error, error) {
+// gcloudResourceTags returns tags describing the GCP resource the component runs on. Empty values are omitted.
+func gcloudResourceTags(projectID, cluster string) []opentracing.Tag {
+	tags := []opentracing.Tag{{Key: "gcp.project_id", Value: projectID}}
+	if cluster != "" {
+		tags = append(tags, opentracing.Tag{Key: "k8s.cluster.name", Value: cluster})
+	}
+	if len(os.Args) > 1 {
+		tags = append(tags, opentracing.Tag{Key: "thanos.component", Value: os.Args[1]})
+	}
+	return tags
+}
+
+func newGCloudTracer(ctx context.Context, logger log.Logger, gcloudTraceProjectID string, sampleFactor uint64, debugName string, tags []opentracing.Tag) (opentracing.Tracer, func() error, error) {
 	traceClient, err := trace.NewClient(ctx)
 	if err != nil {
 		return nil, nil, err
@@ -73,5 +144,6 @@ func newGCloudTracer(ctx context.Context, logger log.Logger, gcloudTraceProjectI
 			Recorder:       &forceRecorder{wrapped: r},
 			MaxLogsPerSpan: 100,
 		}),
+		tags: tags,
 	}, r.Close, nil
 }
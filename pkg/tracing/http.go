@@ -27,12 +27,19 @@ func HTTPMiddleware(tracer opentracing.Tracer, name string, logger log.Logger, n
 			level.Error(logger).Log("msg", "failed to extract tracer from request", "operationName", operationName, "err", err)
 		}
 
-		span = tracer.StartSpan(operationName, ext.RPCServerOption(wireContext))
+		opts := []opentracing.StartSpanOption{ext.RPCServerOption(wireContext)}
+		force := r.Header.Get(ForceTracingBaggageKey)
+		if force != "" {
+			// Tracers that decide about sampling on span start (e.g Jaeger or OTLP) do not look at the baggage.
+			opts = append(opts, opentracing.Tag{Key: string(ext.SamplingPriority), Value: uint16(1)})
+		}
+		span = tracer.StartSpan(operationName, opts...)
 		ext.HTTPMethod.Set(span, r.Method)
 		ext.HTTPUrl.Set(span, r.URL.String())
 
 		// If client specified ForceTracingBaggageKey header, ensure span includes it to force tracing.
-		span.SetBaggageItem(ForceTracingBaggageKey, r.Header.Get(ForceTracingBaggageKey))
+		// The baggage is propagated with the span to all called components.
+		span.SetBaggageItem(ForceTracingBaggageKey, force)
 
 		next.ServeHTTP(w, r.WithContext(opentracing.ContextWithSpan(ContextWithTracer(r.Context(), tracer), span)))
 		span.Finish()
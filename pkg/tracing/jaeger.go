@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/uber/jaeger-client-go"
+	jaegercfg "github.com/uber/jaeger-client-go/config"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// JaegerConfig is the configuration of the Jaeger provider.
+type JaegerConfig struct {
+	// ServiceName defaults to the debug name or "thanos".
+	ServiceName string `yaml:"service_name"`
+	// AgentHostPort is the address of the Jaeger agent spans are sent to over UDP.
+	AgentHostPort string `yaml:"agent_host_port"`
+
+	// SamplerType is one of const, probabilistic, ratelimiting or remote.
+	// * const samples all traces if SamplerParam is 1 and none if it is 0.
+	// * probabilistic samples traces with the probability of SamplerParam, between 0 and 1.
+	// * ratelimiting samples at most SamplerParam traces per second.
+	// * remote fetches the sampling strategy from SamplingServerURL and uses SamplerParam
+	//   as the probability until the strategy is fetched.
+	SamplerType             string        `yaml:"sampler_type"`
+	SamplerParam            float64       `yaml:"sampler_param"`
+	SamplingServerURL       string        `yaml:"sampling_server_url"`
+	SamplingRefreshInterval time.Duration `yaml:"sampling_refresh_interval"`
+
+	ReporterQueueSize     int           `yaml:"reporter_queue_size"`
+	ReporterFlushInterval time.Duration `yaml:"reporter_flush_interval"`
+	// LogSpans logs all reported spans, useful for debugging.
+	LogSpans bool `yaml:"log_spans"`
+}
+
+// DefaultJaegerConfig samples all traces and sends them to the agent on localhost.
+var DefaultJaegerConfig = JaegerConfig{
+	AgentHostPort:           "localhost:6831",
+	SamplerType:             jaeger.SamplerTypeConst,
+	SamplerParam:            1,
+	SamplingServerURL:       "http://localhost:5778/sampling",
+	SamplingRefreshInterval: time.Minute,
+	ReporterQueueSize:       100,
+	ReporterFlushInterval:   time.Second,
+}
+
+func parseJaegerConfig(conf []byte) (JaegerConfig, error) {
+	c := DefaultJaegerConfig
+	if err := yaml.UnmarshalStrict(conf, &c); err != nil {
+		return c, errors.Wrap(err, "parse jaeger tracing config")
+	}
+
+	switch c.SamplerType {
+	case jaeger.SamplerTypeConst:
+		if c.SamplerParam != 0 && c.SamplerParam != 1 {
+			return c, errors.Errorf("sampler_param of %s sampler must be 0 or 1, got %v", c.SamplerType, c.SamplerParam)
+		}
+	case jaeger.SamplerTypeProbabilistic, jaeger.SamplerTypeRemote:
+		if c.SamplerParam < 0 || c.SamplerParam > 1 {
+			return c, errors.Errorf("sampler_param of %s sampler must be between 0 and 1, got %v", c.SamplerType, c.SamplerParam)
+		}
+	case jaeger.SamplerTypeRateLimiting:
+		if c.SamplerParam < 0 {
+			return c, errors.Errorf("sampler_param of %s sampler must not be negative, got %v", c.SamplerType, c.SamplerParam)
+		}
+	default:
+		return c, errors.Errorf("unknown sampler_type %q, possible values: %s, %s, %s, %s", c.SamplerType,
+			jaeger.SamplerTypeConst, jaeger.SamplerTypeProbabilistic, jaeger.SamplerTypeRateLimiting, jaeger.SamplerTypeRemote)
+	}
+	return c, nil
+}
+
+type jaegerLogger struct {
+	logger log.Logger
+}
+
+func (l *jaegerLogger) Infof(format string, args ...interface{}) {
+	level.Info(l.logger).Log("msg", fmt.Sprintf(format, args...))
+}
+
+func (l *jaegerLogger) Error(msg string) {
+	level.Error(l.logger).Log("msg", msg)
+}
+
+func newJaegerTracer(logger log.Logger, conf JaegerConfig, debugName string) (opentracing.Tracer, func() error, error) {
+	name := serviceName(conf.ServiceName, debugName)
+
+	cfg := jaegercfg.Configuration{
+		Sampler: &jaegercfg.SamplerConfig{
+			Type:                    conf.SamplerType,
+			Param:                   conf.SamplerParam,
+			SamplingServerURL:       conf.SamplingServerURL,
+			SamplingRefreshInterval: conf.SamplingRefreshInterval,
+		},
+		Reporter: &jaegercfg.ReporterConfig{
+			QueueSize:           conf.ReporterQueueSize,
+			BufferFlushInterval: conf.ReporterFlushInterval,
+			LogSpans:            conf.LogSpans,
+			LocalAgentHostPort:  conf.AgentHostPort,
+		},
+	}
+	t, closer, err := cfg.New(name, jaegercfg.Logger(&jaegerLogger{logger: logger}))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "create jaeger tracer")
+	}
+
+	level.Info(logger).Log("msg", "enabled jaeger tracing", "service", name, "agent", conf.AgentHostPort,
+		"sampler", conf.SamplerType, "param", conf.SamplerParam)
+	return &tracer{debugName: debugName, wrapped: t}, closer.Close, nil
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/opentracing/basictracer-go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	// TraceIDLogKey is the key of the trace ID injected into request-scoped log lines.
+	TraceIDLogKey = "trace_id"
+	// SpanIDLogKey is the key of the span ID injected into request-scoped log lines.
+	SpanIDLogKey = "span_id"
+
+	traceparentHeader = "traceparent"
+)
+
+// LoggerWithTraceID returns logger that adds IDs of the trace and span found in the given context
+// to every log line, so logs can be joined with traces. The logger is returned unchanged if there is no span
+// in the context or the tracer does not expose IDs, e.g. if tracing is disabled.
+func LoggerWithTraceID(ctx context.Context, logger log.Logger) log.Logger {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return logger
+	}
+	traceID, spanID, ok := spanIDs(span)
+	if !ok {
+		return logger
+	}
+	return log.With(logger, TraceIDLogKey, traceID, SpanIDLogKey, spanID)
+}
+
+// spanIDs returns hex encoded trace and span IDs of the span.
+func spanIDs(span opentracing.Span) (traceID string, spanID string, ok bool) {
+	switch sc := span.Context().(type) {
+	case basictracer.SpanContext:
+		return fmt.Sprintf("%016x", sc.TraceID), fmt.Sprintf("%016x", sc.SpanID), true
+	case jaeger.SpanContext:
+		if !sc.IsValid() {
+			return "", "", false
+		}
+		return sc.TraceID().String(), sc.SpanID().String(), true
+	}
+
+	// Tracers bridged from OpenTelemetry do not expose their span context, but propagate it
+	// as W3C trace context header.
+	carrier := opentracing.TextMapCarrier{}
+	if err := span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier); err != nil {
+		return "", "", false
+	}
+	return parseTraceparent(carrier[traceparentHeader])
+}
+
+// parseTraceparent parses trace and span ID from W3C traceparent header value in
+// the "<version>-<trace-id>-<parent-id>-<flags>" format.
+func parseTraceparent(v string) (traceID string, spanID string, ok bool) {
+	parts := strings.Split(v, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
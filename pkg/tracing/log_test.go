@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/opentracing/basictracer-go"
+)
+
+func TestLoggerWithTraceID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.NewLogfmtLogger(&buf)
+
+	// No span in context.
+	testutil.Ok(t, LoggerWithTraceID(context.Background(), logger).Log("msg", "a"))
+	testutil.Equals(t, "msg=a\n", buf.String())
+
+	// Noop tracer does not expose any IDs.
+	buf.Reset()
+	_, ctx := StartSpan(context.Background(), "noop")
+	testutil.Ok(t, LoggerWithTraceID(ctx, logger).Log("msg", "a"))
+	testutil.Equals(t, "msg=a\n", buf.String())
+
+	buf.Reset()
+	tr := &tracer{
+		wrapped: basictracer.NewWithOptions(basictracer.Options{
+			ShouldSample: func(traceID uint64) bool { return true },
+			Recorder:     &basictracer.InMemorySpanRecorder{},
+		}),
+	}
+	span, ctx := StartSpan(ContextWithTracer(context.Background(), tr), "a")
+	sc := span.Context().(basictracer.SpanContext)
+
+	testutil.Ok(t, LoggerWithTraceID(ctx, logger).Log("msg", "a"))
+	testutil.Equals(t, fmt.Sprintf("trace_id=%016x span_id=%016x msg=a\n", sc.TraceID, sc.SpanID), buf.String())
+
+	// Child span shares the trace ID.
+	buf.Reset()
+	_, childCtx := StartSpan(ctx, "b")
+	testutil.Ok(t, LoggerWithTraceID(childCtx, logger).Log("msg", "b"))
+	testutil.Assert(t, strings.HasPrefix(buf.String(), fmt.Sprintf("trace_id=%016x ", sc.TraceID)), "unexpected log line %s", buf.String())
+	testutil.Assert(t, !strings.Contains(buf.String(), fmt.Sprintf("span_id=%016x ", sc.SpanID)), "unexpected log line %s", buf.String())
+}
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, spanID, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	testutil.Assert(t, ok, "expected valid traceparent")
+	testutil.Equals(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	testutil.Equals(t, "00f067aa0ba902b7", spanID)
+
+	for _, v := range []string{"", "00-4bf92f3577b34da6-00f067aa0ba902b7-01", "00-4bf92f3577b34da6a3ce929d0e0e4736"} {
+		_, _, ok := parseTraceparent(v)
+		testutil.Assert(t, !ok, "expected invalid traceparent %q", v)
+	}
+}
@@ -0,0 +1,215 @@
+package tracing
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	thanostls "github.com/improbable-eng/thanos/pkg/tls"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	bridge "go.opentelemetry.io/otel/bridge/opentracing"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/credentials"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	otlpClientGRPC = "grpc"
+	otlpClientHTTP = "http"
+
+	otlpSamplerAlwaysOn     = "always_on"
+	otlpSamplerAlwaysOff    = "always_off"
+	otlpSamplerTraceIDRatio = "traceidratio"
+)
+
+// OTLPConfig is the configuration of the OpenTelemetry protocol (OTLP) provider. Spans are sent directly
+// to an OTLP receiver, e.g. OpenTelemetry Collector or Tempo.
+type OTLPConfig struct {
+	// ServiceName defaults to the debug name or "thanos".
+	ServiceName string `yaml:"service_name"`
+	// ClientType is either grpc or http.
+	ClientType string `yaml:"client_type"`
+	// Endpoint is the host:port of the receiver.
+	Endpoint string `yaml:"endpoint"`
+	// URLPath is the path spans are posted to, only used by the http client.
+	URLPath string `yaml:"url_path"`
+	// Insecure disables TLS.
+	Insecure    bool              `yaml:"insecure"`
+	TLSConfig   TLSConfig         `yaml:"tls_config"`
+	Headers     map[string]string `yaml:"headers"`
+	Compression string            `yaml:"compression"`
+	Timeout     time.Duration     `yaml:"timeout"`
+
+	// SamplerType is one of always_on, always_off or traceidratio. Sampling decisions of the parent span,
+	// e.g. propagated from another Thanos component, are always respected.
+	SamplerType  string  `yaml:"sampler_type"`
+	SamplerParam float64 `yaml:"sampler_param"`
+}
+
+// TLSConfig configures TLS connection to the tracing backend.
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// DefaultOTLPConfig samples all traces and sends them to the gRPC receiver on localhost.
+var DefaultOTLPConfig = OTLPConfig{
+	ClientType:  otlpClientGRPC,
+	Endpoint:    "localhost:4317",
+	URLPath:     "/v1/traces",
+	Timeout:     10 * time.Second,
+	SamplerType: otlpSamplerAlwaysOn,
+}
+
+func parseOTLPConfig(conf []byte) (OTLPConfig, error) {
+	c := DefaultOTLPConfig
+	if err := yaml.UnmarshalStrict(conf, &c); err != nil {
+		return c, errors.Wrap(err, "parse otlp tracing config")
+	}
+
+	if c.ClientType != otlpClientGRPC && c.ClientType != otlpClientHTTP {
+		return c, errors.Errorf("unknown client_type %q, possible values: %s, %s", c.ClientType, otlpClientGRPC, otlpClientHTTP)
+	}
+	if c.Compression != "" && c.Compression != "gzip" {
+		return c, errors.Errorf("unknown compression %q, only gzip is supported", c.Compression)
+	}
+	switch c.SamplerType {
+	case otlpSamplerAlwaysOn, otlpSamplerAlwaysOff:
+	case otlpSamplerTraceIDRatio:
+		if c.SamplerParam < 0 || c.SamplerParam > 1 {
+			return c, errors.Errorf("sampler_param of %s sampler must be between 0 and 1, got %v", c.SamplerType, c.SamplerParam)
+		}
+	default:
+		return c, errors.Errorf("unknown sampler_type %q, possible values: %s, %s, %s", c.SamplerType,
+			otlpSamplerAlwaysOn, otlpSamplerAlwaysOff, otlpSamplerTraceIDRatio)
+	}
+	return c, nil
+}
+
+func newOTLPClient(conf OTLPConfig) (otlptrace.Client, error) {
+	var tlsConfig *tls.Config
+	if !conf.Insecure {
+		var err error
+		c := conf.TLSConfig
+		if tlsConfig, err = thanostls.NewClientConfig(c.CertFile, c.KeyFile, c.CAFile, c.ServerName, c.InsecureSkipVerify); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.ClientType == otlpClientHTTP {
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(conf.Endpoint),
+			otlptracehttp.WithURLPath(conf.URLPath),
+			otlptracehttp.WithHeaders(conf.Headers),
+			otlptracehttp.WithTimeout(conf.Timeout),
+		}
+		if conf.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		} else {
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsConfig))
+		}
+		if conf.Compression == "gzip" {
+			opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+		}
+		return otlptracehttp.NewClient(opts...), nil
+	}
+
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(conf.Endpoint),
+		otlptracegrpc.WithHeaders(conf.Headers),
+		otlptracegrpc.WithTimeout(conf.Timeout),
+	}
+	if conf.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	} else {
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+	}
+	if conf.Compression == "gzip" {
+		opts = append(opts, otlptracegrpc.WithCompressor("gzip"))
+	}
+	return otlptracegrpc.NewClient(opts...), nil
+}
+
+func otlpSampler(conf OTLPConfig) sdktrace.Sampler {
+	var root sdktrace.Sampler
+	switch conf.SamplerType {
+	case otlpSamplerAlwaysOff:
+		root = sdktrace.NeverSample()
+	case otlpSamplerTraceIDRatio:
+		root = sdktrace.TraceIDRatioBased(conf.SamplerParam)
+	default:
+		root = sdktrace.AlwaysSample()
+	}
+	return forceSampler{wrapped: sdktrace.ParentBased(root)}
+}
+
+// forceSampler samples all spans started with the sampling priority tag, e.g. requests with the ForceTracingBaggageKey header.
+type forceSampler struct {
+	wrapped sdktrace.Sampler
+}
+
+func (s forceSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, attr := range p.Attributes {
+		if string(attr.Key) == string(ext.SamplingPriority) && attr.Value.AsInt64() > 0 {
+			return sdktrace.SamplingResult{
+				Decision:   sdktrace.RecordAndSample,
+				Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+			}
+		}
+	}
+	return s.wrapped.ShouldSample(p)
+}
+
+func (s forceSampler) Description() string {
+	return fmt.Sprintf("ForceSampler{%s}", s.wrapped.Description())
+}
+
+func newOTLPTracer(ctx context.Context, logger log.Logger, conf OTLPConfig, debugName string) (opentracing.Tracer, func() error, error) {
+	client, err := newOTLPClient(conf)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "create otlp client")
+	}
+	exporter, err := otlptrace.New(ctx, client)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "create otlp exporter")
+	}
+
+	name := serviceName(conf.ServiceName, debugName)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(otlpSampler(conf)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", name))),
+	)
+
+	// Thanos components are instrumented with OpenTracing, so spans are passed to OpenTelemetry through the bridge.
+	bridgeTracer, _ := bridge.NewTracerPair(tp.Tracer("thanos"))
+	// Baggage has to be propagated as well, as it carries the ForceTracingBaggageKey item.
+	bridgeTracer.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	bridgeTracer.SetWarningHandler(func(msg string) {
+		level.Warn(logger).Log("msg", "opentelemetry bridge", "warning", msg)
+	})
+
+	level.Info(logger).Log("msg", "enabled otlp tracing", "service", name, "client", conf.ClientType, "endpoint", conf.Endpoint,
+		"sampler", conf.SamplerType, "param", conf.SamplerParam)
+	return &tracer{debugName: debugName, wrapped: bridgeTracer}, func() error {
+		// Flush pending spans, but do not block the exit for too long if the receiver is unavailable.
+		ctx, cancel := context.WithTimeout(context.Background(), conf.Timeout)
+		defer cancel()
+		return tp.Shutdown(ctx)
+	}, nil
+}
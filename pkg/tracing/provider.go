@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// TracingProvider is the name of the tracing backend.
+type TracingProvider string
+
+const (
+	STACKDRIVER TracingProvider = "STACKDRIVER"
+	JAEGER      TracingProvider = "JAEGER"
+	OTLP        TracingProvider = "OTLP"
+)
+
+// TracingConfig is the tracing configuration passed in YAML. Config holds the provider specific configuration.
+type TracingConfig struct {
+	Type   TracingProvider `yaml:"type"`
+	Config interface{}     `yaml:"config"`
+}
+
+// NewTracer returns the tracer configured by the given YAML content. Empty content disables tracing and
+// the noop tracer is returned. Returned function flushes pending spans and must be called on exit.
+func NewTracer(ctx context.Context, logger log.Logger, confContentYaml []byte, debugName string) (opentracing.Tracer, func() error, error) {
+	noop := func() error { return nil }
+	if len(confContentYaml) == 0 {
+		level.Info(logger).Log("msg", "tracing is disabled")
+		return &opentracing.NoopTracer{}, noop, nil
+	}
+
+	tracingConf := &TracingConfig{}
+	if err := yaml.UnmarshalStrict(confContentYaml, tracingConf); err != nil {
+		return nil, nil, errors.Wrap(err, "parse tracing config")
+	}
+	// Config is decoded into the provider specific struct once the type is known.
+	config, err := yaml.Marshal(tracingConf.Config)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "marshal content of tracing configuration")
+	}
+
+	switch tracingConf.Type {
+	case STACKDRIVER:
+		conf, err := parseStackdriverConfig(config, gceMetadata{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return newGCloudTracer(ctx, logger, conf.ProjectID, conf.SampleFactor, debugName, gcloudResourceTags(conf.ProjectID, conf.ClusterName))
+	case JAEGER:
+		conf, err := parseJaegerConfig(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newJaegerTracer(logger, conf, debugName)
+	case OTLP:
+		conf, err := parseOTLPConfig(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newOTLPTracer(ctx, logger, conf, debugName)
+	default:
+		return nil, nil, errors.Errorf("tracing with type %s is not supported", tracingConf.Type)
+	}
+}
+
+// serviceName returns the configured service name, defaulting to the debug name or "thanos".
+func serviceName(configured, debugName string) string {
+	if configured != "" {
+		return configured
+	}
+	if debugName != "" {
+		return debugName
+	}
+	return "thanos"
+}
@@ -0,0 +1,151 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestNewTracer_Disabled(t *testing.T) {
+	tr, closeFn, err := NewTracer(context.Background(), log.NewNopLogger(), nil, "")
+	testutil.Ok(t, err)
+	testutil.Equals(t, &opentracing.NoopTracer{}, tr)
+	testutil.Ok(t, closeFn())
+}
+
+func TestNewTracer_InvalidConfig(t *testing.T) {
+	for _, conf := range []string{
+		"type: ZIPKIN",
+		"type: JAEGER\nconfig:\n  sampler_type: unknown",
+		"type: JAEGER\nconfig:\n  unknown_field: 1",
+		"type: STACKDRIVER\nconfig:\n  project: test",
+	} {
+		_, _, err := NewTracer(context.Background(), log.NewNopLogger(), []byte(conf), "")
+		testutil.NotOk(t, err)
+	}
+}
+
+func TestParseJaegerConfig(t *testing.T) {
+	conf, err := parseJaegerConfig([]byte("service_name: thanos-query\n"))
+	testutil.Ok(t, err)
+	exp := DefaultJaegerConfig
+	exp.ServiceName = "thanos-query"
+	testutil.Equals(t, exp, conf)
+
+	conf, err = parseJaegerConfig([]byte(`
+agent_host_port: jaeger-agent:6831
+sampler_type: ratelimiting
+sampler_param: 5
+reporter_flush_interval: 5s
+`))
+	testutil.Ok(t, err)
+	testutil.Equals(t, "jaeger-agent:6831", conf.AgentHostPort)
+	testutil.Equals(t, "ratelimiting", conf.SamplerType)
+	testutil.Equals(t, 5.0, conf.SamplerParam)
+	testutil.Equals(t, 5*time.Second, conf.ReporterFlushInterval)
+
+	for _, c := range []string{
+		"sampler_type: const\nsampler_param: 0.5",
+		"sampler_type: probabilistic\nsampler_param: 2",
+		"sampler_type: remote\nsampler_param: -0.1",
+		"sampler_type: ratelimiting\nsampler_param: -1",
+	} {
+		_, err := parseJaegerConfig([]byte(c))
+		testutil.NotOk(t, err)
+	}
+}
+
+func TestParseOTLPConfig(t *testing.T) {
+	conf, err := parseOTLPConfig([]byte(`
+client_type: http
+endpoint: tempo:4318
+insecure: true
+headers:
+  X-Scope-OrgID: team-a
+compression: gzip
+sampler_type: traceidratio
+sampler_param: 0.1
+`))
+	testutil.Ok(t, err)
+	exp := DefaultOTLPConfig
+	exp.ClientType = "http"
+	exp.Endpoint = "tempo:4318"
+	exp.Insecure = true
+	exp.Headers = map[string]string{"X-Scope-OrgID": "team-a"}
+	exp.Compression = "gzip"
+	exp.SamplerType = "traceidratio"
+	exp.SamplerParam = 0.1
+	testutil.Equals(t, exp, conf)
+
+	for _, c := range []string{
+		"client_type: thrift",
+		"compression: snappy",
+		"sampler_type: traceidratio\nsampler_param: 1.5",
+		"sampler_type: probabilistic",
+	} {
+		_, err := parseOTLPConfig([]byte(c))
+		testutil.NotOk(t, err)
+	}
+}
+
+type fakeMetadata struct {
+	onGCE      bool
+	project    string
+	attributes map[string]string
+}
+
+func (m fakeMetadata) OnGCE() bool                { return m.onGCE }
+func (m fakeMetadata) ProjectID() (string, error) { return m.project, nil }
+func (m fakeMetadata) InstanceAttributeValue(attr string) (string, error) {
+	v, ok := m.attributes[attr]
+	if !ok {
+		return "", errors.Errorf("attribute %s not defined", attr)
+	}
+	return v, nil
+}
+
+func TestParseStackdriverConfig(t *testing.T) {
+	gke := fakeMetadata{onGCE: true, project: "gke-project", attributes: map[string]string{"cluster-name": "prod-eu"}}
+
+	_, err := parseStackdriverConfig([]byte("sample_factor: 2"), fakeMetadata{})
+	testutil.NotOk(t, err)
+
+	conf, err := parseStackdriverConfig([]byte("project_id: my-project"), fakeMetadata{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, StackdriverConfig{ProjectID: "my-project", SampleFactor: 1}, conf)
+
+	conf, err = parseStackdriverConfig([]byte("sample_factor: 10"), gke)
+	testutil.Ok(t, err)
+	testutil.Equals(t, StackdriverConfig{ProjectID: "gke-project", SampleFactor: 10, ClusterName: "prod-eu"}, conf)
+
+	conf, err = parseStackdriverConfig([]byte("project_id: my-project\ncluster_name: dev"), gke)
+	testutil.Ok(t, err)
+	testutil.Equals(t, StackdriverConfig{ProjectID: "my-project", SampleFactor: 1, ClusterName: "dev"}, conf)
+
+	// Plain GCE instance without cluster.
+	conf, err = parseStackdriverConfig(nil, fakeMetadata{onGCE: true, project: "gce-project"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, StackdriverConfig{ProjectID: "gce-project", SampleFactor: 1}, conf)
+}
+
+func TestForceSampler(t *testing.T) {
+	s := otlpSampler(OTLPConfig{SamplerType: otlpSamplerAlwaysOff})
+
+	res := s.ShouldSample(sdktrace.SamplingParameters{ParentContext: context.Background(), Name: "a"})
+	testutil.Equals(t, sdktrace.Drop, res.Decision)
+
+	res = s.ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: context.Background(),
+		Name:          "a",
+		Attributes:    []attribute.KeyValue{attribute.Int64(string(ext.SamplingPriority), 1)},
+	})
+	testutil.Equals(t, sdktrace.RecordAndSample, res.Decision)
+}
@@ -49,6 +49,8 @@ func StartSpan(ctx context.Context, operationName string, opts ...opentracing.St
 type tracer struct {
 	debugName string
 	wrapped   opentracing.Tracer
+	// tags are set on every span, e.g. attributes of the resource the component runs on.
+	tags []opentracing.Tag
 }
 
 func (t *tracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
@@ -67,6 +69,9 @@ func (t *tracer) StartSpan(operationName string, opts ...opentracing.StartSpanOp
 	if len(os.Args) > 1 {
 		span.SetTag("binary_cmd", os.Args[1])
 	}
+	for _, tag := range t.tags {
+		tag.Set(span)
+	}
 
 	return span
 }
@@ -4,13 +4,14 @@
 package tracing
 
 import (
-	"testing"
-
 	"context"
-
+	"net/http"
+	"net/http/httptest"
+	"testing"
 	"time"
 
 	"github.com/fortytw2/leaktest"
+	"github.com/go-kit/kit/log"
 	"github.com/improbable-eng/thanos/pkg/testutil"
 	"github.com/opentracing/basictracer-go"
 )
@@ -160,3 +161,62 @@ func TestContextTracing_ForceTracing(t *testing.T) {
 	testutil.Equals(t, 3, len(m.GetSpans()))
 	testutil.Equals(t, 3, len(m.GetSampledSpans()))
 }
+
+// This test shows that resource tags of the tracer are set on every span.
+func TestTracer_ResourceTags(t *testing.T) {
+	m := &basictracer.InMemorySpanRecorder{}
+	tr := &tracer{
+		wrapped: basictracer.NewWithOptions(basictracer.Options{
+			ShouldSample: func(traceID uint64) bool {
+				return true
+			},
+			Recorder:       m,
+			MaxLogsPerSpan: 100,
+		}),
+		tags: gcloudResourceTags("test-project", "test-cluster"),
+	}
+
+	root, ctx := StartSpan(ContextWithTracer(context.Background(), tr), "a")
+	child, _ := StartSpan(ctx, "b")
+	child.Finish()
+	root.Finish()
+
+	testutil.Equals(t, 2, len(m.GetSpans()))
+	for _, sp := range m.GetSpans() {
+		testutil.Equals(t, "test-project", sp.Tags["gcp.project_id"])
+		testutil.Equals(t, "test-cluster", sp.Tags["k8s.cluster.name"])
+	}
+}
+
+// This test shows that ForceTracingBaggageKey header enables tracing of the request and all spans started while handling it,
+// even if sampling is disabled.
+func TestHTTPMiddleware_ForceTracing(t *testing.T) {
+	m := &basictracer.InMemorySpanRecorder{}
+	tr := &tracer{
+		wrapped: basictracer.NewWithOptions(basictracer.Options{
+			ShouldSample: func(traceID uint64) bool {
+				return false
+			},
+			Recorder:       &forceRecorder{wrapped: m},
+			MaxLogsPerSpan: 100,
+		}),
+	}
+
+	h := HTTPMiddleware(tr, "test", log.NewNopLogger(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span, _ := StartSpan(r.Context(), "child")
+		span.Finish()
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	testutil.Equals(t, 2, len(m.GetSpans()))
+	testutil.Equals(t, 0, len(m.GetSampledSpans()))
+
+	m.Reset()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(ForceTracingBaggageKey, "debug slow query")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	testutil.Equals(t, 2, len(m.GetSampledSpans()))
+	for _, sp := range m.GetSampledSpans() {
+		testutil.Equals(t, "debug slow query", sp.Context.Baggage[ForceTracingBaggageKey])
+	}
+}
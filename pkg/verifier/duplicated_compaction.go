@@ -2,14 +2,14 @@ package verifier
 
 import (
 	"context"
-
 	"fmt"
-
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/block"
 	"github.com/improbable-eng/thanos/pkg/objstore"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
@@ -20,28 +20,24 @@ const DuplicatedCompactionIssueID = "duplicated_compaction"
 
 // DuplicatedCompactionIssue was a bug fixed in https://github.com/improbable-eng/thanos/commit/94e26c63e52ba45b713fd998638d0e7b2492664f.
 // Bug resulted in source block not being removed immediately after compaction, so we were compacting again and again same sources
-// until sync-delay passes.
-// The expected print of this are same overlapped blocks with exactly the same sources, time ranges and stats.
-// If repair is enabled, all but one duplicates are safely deleted.
-func DuplicatedCompactionIssue(ctx context.Context, logger log.Logger, bkt objstore.Bucket, backupBkt objstore.Bucket, repair bool) error {
-	level.Info(logger).Log("msg", "started verifying issue", "with-repair", repair, "issue", DuplicatedCompactionIssueID)
+// until sync-delay passes. The same happens when two compactors run concurrently against the same bucket.
+// The expected print of this are overlapped blocks with different ULIDs, but exactly the same sources and time ranges.
+// If repair is enabled, one block of each duplicates set is kept and the others are marked for deletion.
+var DuplicatedCompactionIssue = Issue{
+	ID:          DuplicatedCompactionIssueID,
+	Description: "overlapping blocks compacted from exactly the same sources",
+	Verify:      verifyDuplicatedCompaction,
+	Repair:      repairDuplicatedCompaction,
+}
 
+// verifyDuplicatedCompaction reports a finding for each set of duplicates. Blocks of the finding
+// are the duplicates that are ok to be removed. Blocks already marked for deletion are not reported.
+func verifyDuplicatedCompaction(ctx context.Context, logger log.Logger, bkt objstore.BucketReader) (res []Finding, err error) {
 	overlaps, err := fetchOverlaps(ctx, bkt)
 	if err != nil {
-		return errors.Wrap(err, DuplicatedCompactionIssueID)
+		return nil, err
 	}
 
-	if len(overlaps) == 0 {
-		// All good.
-		return nil
-	}
-
-	// We have overlaps, let's see if they include exact duplicates. If yes, let's put them into distinct set.
-	var (
-		toKillLookup = map[ulid.ULID]struct{}{}
-		toKill       []ulid.ULID
-	)
-
 	// Loop over label-resolution groups.
 	for k, o := range overlaps {
 		// Loop over overlap group.
@@ -50,45 +46,70 @@ func DuplicatedCompactionIssue(ctx context.Context, logger log.Logger, bkt objst
 
 			// Loop over duplicates sets.
 			for _, d := range dups {
-				level.Warn(logger).Log("msg", "found duplicated blocks", "group", k, "range-min", r.Min, "range-max", r.Max,
-					"kill", sprintMetas(d[1:]), "issue", DuplicatedCompactionIssueID)
-
+				var toKill []tsdb.BlockMeta
 				for _, m := range d[1:] {
-					if _, ok := toKillLookup[m.ULID]; ok {
+					_, err := block.ReadDeletionMark(ctx, bkt, m.ULID)
+					if err == block.ErrMarkNotFound {
+						toKill = append(toKill, m)
 						continue
 					}
-
-					toKillLookup[m.ULID] = struct{}{}
-					toKill = append(toKill, m.ULID)
+					if err != nil {
+						return nil, errors.Wrapf(err, "read deletion mark for %s", m.ULID)
+					}
+				}
+				if len(toKill) == 0 {
+					continue
 				}
+
+				res = append(res, Finding{
+					Issue:  DuplicatedCompactionIssueID,
+					Group:  k,
+					Blocks: metaULIDs(toKill),
+					Details: fmt.Sprintf("duplicates of %s in range [%d, %d) that are ok to be removed: %s",
+						d[0].ULID, r.Min, r.Max, sprintMetas(toKill)),
+				})
 			}
 
 			if len(dups) == 0 {
 				level.Warn(logger).Log("msg", "found overlapped blocks, but all of the blocks are unique. Seems like unrelated issue. Ignoring overlap", "group", k,
-					"range", fmt.Sprintf("%v", r), "overlap", sprintMetas(blocks), "issue", DuplicatedCompactionIssueID)
+					"range", fmt.Sprintf("%v", r), "overlap", sprintMetas(blocks))
 			}
 		}
 	}
+	return res, nil
+}
 
-	level.Warn(logger).Log("msg", "Found duplicated blocks that are ok to be removed", "ULIDs", fmt.Sprintf("%v", toKill), "num", len(toKill), "issue", DuplicatedCompactionIssueID)
-	if !repair {
-		return nil
+// repairDuplicatedCompaction marks duplicates for deletion. They are removed from the bucket
+// (and optionally backed up) by the bucket cleanup command once the deletion delay passed.
+func repairDuplicatedCompaction(ctx context.Context, logger log.Logger, bkt objstore.Bucket, _ objstore.Bucket, findings []Finding) error {
+	var (
+		toKillLookup = map[ulid.ULID]struct{}{}
+		toKill       []ulid.ULID
+	)
+	for _, f := range findings {
+		for _, id := range f.Blocks {
+			if _, ok := toKillLookup[id]; ok {
+				continue
+			}
+			toKillLookup[id] = struct{}{}
+			toKill = append(toKill, id)
+		}
 	}
 
 	for i, id := range toKill {
-		if err := SafeDelete(ctx, bkt, backupBkt, id); err != nil {
-			return err
+		if err := block.MarkForDeletion(ctx, logger, bkt, id, "verify: "+DuplicatedCompactionIssueID); err != nil {
+			return errors.Wrapf(err, "mark %s for deletion", id)
 		}
-		level.Info(logger).Log("msg", "Removed duplicated block", "id", id, "to-be-removed", len(toKill)-(i+1), "removed", i+1, "issue", DuplicatedCompactionIssueID)
+		level.Info(logger).Log("msg", "Marked duplicated block for deletion", "id", id, "to-be-marked", len(toKill)-(i+1), "marked", i+1)
 	}
 
-	level.Info(logger).Log("msg", "Removed all duplicated blocks. You might want to rerun this verify to check if there is still any unrelated overlap",
-		"issue", DuplicatedCompactionIssueID)
+	level.Info(logger).Log("msg", "Marked all duplicated blocks for deletion. You might want to rerun this verify to check if there is still any unrelated overlap")
 	return nil
 }
 
-// duplicatedBlocks returns duplicated blocks that have exactly same range, sources and stats.
-// If block is unique it is not included in the resulted blocs.
+// duplicatedBlocks returns duplicated blocks that have exactly same range and sources.
+// If block is unique it is not included in the resulted blocs. The first block of each duplicates set
+// is the one to keep: the one with most samples, or the oldest one if they have the same number of samples.
 func duplicatedBlocks(blocks []tsdb.BlockMeta) (res [][]tsdb.BlockMeta) {
 	var dups [][]tsdb.BlockMeta
 	for _, b := range blocks {
@@ -106,10 +127,6 @@ func duplicatedBlocks(blocks []tsdb.BlockMeta) (res [][]tsdb.BlockMeta) {
 				continue
 			}
 
-			if d[0].Stats != b.Stats {
-				continue
-			}
-
 			dups[i] = append(dups[i], b)
 			added = true
 			break
@@ -124,6 +141,12 @@ func duplicatedBlocks(blocks []tsdb.BlockMeta) (res [][]tsdb.BlockMeta) {
 		if len(d) < 2 {
 			continue
 		}
+		sort.SliceStable(d, func(i, j int) bool {
+			if d[i].Stats.NumSamples != d[j].Stats.NumSamples {
+				return d[i].Stats.NumSamples > d[j].Stats.NumSamples
+			}
+			return d[i].ULID.Compare(d[j].ULID) < 0
+		})
 		res = append(res, d)
 	}
 	return res
@@ -1,8 +1,15 @@
 package verifier
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
 	"testing"
 
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
 	"github.com/improbable-eng/thanos/pkg/testutil"
 	"github.com/oklog/ulid"
 	"github.com/prometheus/tsdb"
@@ -42,6 +49,63 @@ func TestDuplicatedBlocks(t *testing.T) {
 	b5 := b1
 
 	testutil.Equals(t, [][]tsdb.BlockMeta{
-		{b1, dupB1, b5},
+		{b1, dupB1, b3, b5},
 	}, duplicatedBlocks([]tsdb.BlockMeta{b1, dupB1, b2, b3, b4, b5}))
+
+	// Block with most samples is kept, then the oldest one.
+	b6 := b1
+	b6.ULID = ulid.MustNew(6, nil)
+	b7 := b1
+	b7.ULID = ulid.MustNew(7, nil)
+	b8 := b1
+	b8.ULID = ulid.MustNew(8, nil)
+	b8.Stats.NumSamples++
+
+	testutil.Equals(t, [][]tsdb.BlockMeta{
+		{b8, b6, b7},
+	}, duplicatedBlocks([]tsdb.BlockMeta{b7, b6, b8}))
+}
+
+func TestDuplicatedCompactionIssue(t *testing.T) {
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+
+	upload := func(id ulid.ULID, sources ...ulid.ULID) {
+		var m block.Meta
+		m.Version = 1
+		m.ULID = id
+		m.MinTime = 0
+		m.MaxTime = 100
+		m.Compaction.Level = 2
+		m.Compaction.Sources = sources
+		b, err := json.Marshal(m)
+		testutil.Ok(t, err)
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), block.MetaFilename), bytes.NewReader(b)))
+	}
+	var (
+		src1  = ulid.MustNew(1, nil)
+		src2  = ulid.MustNew(2, nil)
+		keep  = ulid.MustNew(10, nil)
+		dup   = ulid.MustNew(11, nil)
+		other = ulid.MustNew(12, nil)
+	)
+	upload(keep, src1, src2)
+	upload(dup, src1, src2)
+	upload(other, src1)
+
+	findings, err := DuplicatedCompactionIssue.Verify(ctx, log.NewNopLogger(), bkt)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(findings))
+	testutil.Equals(t, []ulid.ULID{dup}, findings[0].Blocks)
+
+	testutil.Ok(t, DuplicatedCompactionIssue.Repair(ctx, log.NewNopLogger(), bkt, nil, findings))
+	_, err = block.ReadDeletionMark(ctx, bkt, dup)
+	testutil.Ok(t, err)
+	_, err = block.ReadDeletionMark(ctx, bkt, keep)
+	testutil.Equals(t, block.ErrMarkNotFound, err)
+
+	// Marked duplicates are not reported again.
+	findings, err = DuplicatedCompactionIssue.Verify(ctx, log.NewNopLogger(), bkt)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(findings))
 }
@@ -0,0 +1,168 @@
+package verifier
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+)
+
+const IndexKnownIssuesID = "index_known_issues"
+
+// IndexKnownIssues verifies any known index issue.
+// It rewrites the problematic blocks while fixing repairable inconsistencies.
+// If the replacement was created successfully it is uploaded to the bucket and the input
+// block is backed up and marked for deletion. Blocks already marked for deletion are not verified.
+// NOTE: This also verifies all indexes against chunks mismatches and duplicates.
+var IndexKnownIssues = Issue{
+	ID:          IndexKnownIssuesID,
+	Description: "known index issues like out of order or duplicated chunks and chunks outside of the block time range",
+	Verify:      verifyIndexKnownIssues,
+	Repair:      repairIndexKnownIssues,
+}
+
+func verifyIndexKnownIssues(ctx context.Context, logger log.Logger, bkt objstore.BucketReader) (res []Finding, err error) {
+	err = bkt.Iter(ctx, "", func(name string) error {
+		id, ok := block.IsBlockDir(name)
+		if !ok {
+			return nil
+		}
+
+		ok, err := bkt.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+		if err != nil {
+			return errors.Wrapf(err, "check meta file for %s", id)
+		}
+		if !ok {
+			level.Warn(logger).Log("msg", "skipping block without meta file", "id", id)
+			return nil
+		}
+
+		_, err = block.ReadDeletionMark(ctx, bkt, id)
+		if err == nil {
+			return nil
+		}
+		if err != block.ErrMarkNotFound {
+			return errors.Wrapf(err, "read deletion mark for %s", id)
+		}
+
+		tmpdir, err := ioutil.TempDir("", fmt.Sprintf("index-issue-block-%s-", id))
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpdir)
+
+		err = objstore.DownloadFile(ctx, bkt, path.Join(id.String(), block.IndexFilename), filepath.Join(tmpdir, block.IndexFilename))
+		if err != nil {
+			return errors.Wrapf(err, "download index file %s", path.Join(id.String(), block.IndexFilename))
+		}
+
+		meta, err := block.DownloadMeta(ctx, bkt, id)
+		if err != nil {
+			return errors.Wrapf(err, "download meta file %s", id)
+		}
+
+		stats, err := block.GatherIndexHealthStats(filepath.Join(tmpdir, block.IndexFilename), meta.MinTime, meta.MaxTime)
+		if err != nil {
+			return errors.Wrapf(err, "gather index issues %s", id)
+		}
+
+		if err := stats.ErrSummary(); err != nil {
+			res = append(res, Finding{
+				Issue:   IndexKnownIssuesID,
+				Blocks:  []ulid.ULID{id},
+				Details: err.Error(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "iter")
+	}
+	return res, nil
+}
+
+func repairIndexKnownIssues(ctx context.Context, logger log.Logger, bkt objstore.Bucket, backupBkt objstore.Bucket, findings []Finding) error {
+	for _, f := range findings {
+		for _, id := range f.Blocks {
+			if err := repairIndex(ctx, logger, bkt, backupBkt, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func repairIndex(ctx context.Context, logger log.Logger, bkt objstore.Bucket, backupBkt objstore.Bucket, id ulid.ULID) error {
+	tmpdir, err := ioutil.TempDir("", fmt.Sprintf("index-issue-block-%s-", id))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	meta, err := block.DownloadMeta(ctx, bkt, id)
+	if err != nil {
+		return errors.Wrapf(err, "download meta file %s", id)
+	}
+	if meta.Thanos.Downsample.Resolution > 0 {
+		return errors.New("cannot repair downsampled blocks")
+	}
+
+	err = block.Download(ctx, bkt, id, path.Join(tmpdir, id.String()))
+	if err != nil {
+		return errors.Wrapf(err, "download block %s", id)
+	}
+	level.Info(logger).Log("msg", "downloaded block to be repaired", "id", id)
+
+	stats, err := block.GatherIndexHealthStats(filepath.Join(tmpdir, id.String(), block.IndexFilename), meta.MinTime, meta.MaxTime)
+	if err != nil {
+		return errors.Wrapf(err, "gather index issues %s", id)
+	}
+	if stats.OutOfOrderChunks > stats.DuplicatedChunks {
+		level.Warn(logger).Log("msg", "detected overlaps are not entirely by duplicated chunks. We are able to repair only duplicates", "id", id)
+	}
+	if stats.OutsideChunks > stats.CompleteOutsideChunks {
+		level.Warn(logger).Log("msg", "detected outsiders are not all 'complete' outsiders. We can safely delete only complete outsiders", "id", id)
+	}
+
+	level.Info(logger).Log("msg", "repairing block", "id", id)
+	resid, err := block.Repair(tmpdir, id)
+	if err != nil {
+		return errors.Wrapf(err, "repair failed for block %s", id)
+	}
+
+	// Verify repaired block before uploading it.
+	err = block.VerifyIndex(filepath.Join(tmpdir, resid.String(), block.IndexFilename), meta.MinTime, meta.MaxTime)
+	if err != nil {
+		return errors.Wrapf(err, "repaired block is invalid %s", resid)
+	}
+
+	level.Info(logger).Log("msg", "uploading repaired block", "newID", resid)
+	if err = block.Upload(ctx, bkt, filepath.Join(tmpdir, resid.String())); err != nil {
+		return errors.Wrapf(err, "upload of %s failed", resid)
+	}
+
+	// The broken block is removed by the bucket cleanup command once the deletion delay passed, so store
+	// gateways never see it half deleted.
+	reason := fmt.Sprintf("verify: %s; repaired as %s", IndexKnownIssuesID, resid)
+	if backupBkt != nil {
+		level.Info(logger).Log("msg", "backing up broken block", "id", id)
+		if err := block.Backup(ctx, logger, bkt, backupBkt, id, reason); err != nil {
+			return errors.Wrapf(err, "backup of old block %s failed", id)
+		}
+	}
+	level.Info(logger).Log("msg", "marking broken block for deletion", "id", id)
+	if err := block.MarkForDeletion(ctx, logger, bkt, id, reason); err != nil {
+		return errors.Wrapf(err, "mark old block %s for deletion", id)
+	}
+	level.Info(logger).Log("msg", "all good, continuing", "id", id)
+	return nil
+}
@@ -0,0 +1,49 @@
+package verifier
+
+import (
+	"context"
+	"path"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+)
+
+const MissingMetaIssueID = "missing_meta"
+
+// MissingMetaIssue checks bucket for block directories without meta.json file. Such directories are leftovers
+// of aborted uploads and are ignored by all components, so they only take space.
+// No repair is available for this issue, use bucket cleanup command to delete them.
+var MissingMetaIssue = Issue{
+	ID:          MissingMetaIssueID,
+	Description: "block directories without meta file, usually leftovers of aborted uploads",
+	Verify:      verifyMissingMeta,
+}
+
+func verifyMissingMeta(ctx context.Context, _ log.Logger, bkt objstore.BucketReader) (res []Finding, err error) {
+	err = bkt.Iter(ctx, "", func(name string) error {
+		id, ok := block.IsBlockDir(name)
+		if !ok {
+			return nil
+		}
+
+		ok, err := bkt.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+		if err != nil {
+			return errors.Wrapf(err, "check meta file for %s", id)
+		}
+		if !ok {
+			res = append(res, Finding{
+				Issue:   MissingMetaIssueID,
+				Blocks:  []ulid.ULID{id},
+				Details: "block without meta file",
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "iter")
+	}
+	return res, nil
+}
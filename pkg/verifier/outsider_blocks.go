@@ -0,0 +1,70 @@
+package verifier
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/compact"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/oklog/ulid"
+)
+
+const OutsiderBlocksIssueID = "outsider_blocks"
+
+// outsiderClockSkew is the tolerated difference between the clocks of the machines that
+// produced the samples and the machine that created the block.
+const outsiderClockSkew = 10 * time.Minute
+
+// OutsiderBlocksIssue checks bucket for blocks whose time range does not match the creation time
+// encoded in their ULID. A block cannot contain samples newer than its creation time and a compacted block
+// cannot be created before its sources. Such blocks are usually uploaded from machines with skewed clocks or by
+// misconfigured backfills and break compaction planning, which relies on ULID ordering.
+// No repair is available for this issue.
+var OutsiderBlocksIssue = Issue{
+	ID:          OutsiderBlocksIssueID,
+	Description: "blocks with time range or sources newer than the creation time of the block",
+	Verify:      verifyOutsiderBlocks,
+}
+
+func verifyOutsiderBlocks(ctx context.Context, _ log.Logger, bkt objstore.BucketReader) (res []Finding, err error) {
+	metas, err := fetchMetas(ctx, bkt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range metas {
+		if details, ok := outsider(m); ok {
+			res = append(res, Finding{
+				Issue:   OutsiderBlocksIssueID,
+				Group:   compact.GroupKey(m),
+				Blocks:  []ulid.ULID{m.ULID},
+				Details: details,
+			})
+		}
+	}
+	return res, nil
+}
+
+// outsider returns details why the block does not match its ULID creation time, if it does not.
+func outsider(m block.Meta) (string, bool) {
+	created := int64(m.ULID.Time())
+
+	if m.MaxTime > created+int64(outsiderClockSkew/time.Millisecond) {
+		return fmt.Sprintf("block contains samples up to %s, which is after the block was created at %s",
+			timestamp(m.MaxTime), timestamp(created)), true
+	}
+	for _, s := range m.Compaction.Sources {
+		if s.Time() > m.ULID.Time() {
+			return fmt.Sprintf("source block %s was created at %s, which is after the block was created at %s",
+				s, timestamp(int64(s.Time())), timestamp(created)), true
+		}
+	}
+	return "", false
+}
+
+func timestamp(ms int64) string {
+	return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,46 @@
+package verifier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/oklog/ulid"
+)
+
+func TestOutsider(t *testing.T) {
+	created := uint64(time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond))
+	hour := int64(time.Hour / time.Millisecond)
+
+	newMeta := func(id ulid.ULID, mint, maxt int64, sources ...ulid.ULID) block.Meta {
+		var m block.Meta
+		m.ULID = id
+		m.MinTime = mint
+		m.MaxTime = maxt
+		m.Compaction.Sources = sources
+		return m
+	}
+	id := ulid.MustNew(created, nil)
+
+	for _, tcase := range []struct {
+		meta     block.Meta
+		outsider bool
+	}{
+		// Block created right after its range ended.
+		{meta: newMeta(id, int64(created)-2*hour, int64(created))},
+		// Backfilled block with old data.
+		{meta: newMeta(id, int64(created)-200*hour, int64(created)-198*hour)},
+		// Samples newer than the creation time within tolerated clock skew.
+		{meta: newMeta(id, int64(created)-2*hour, int64(created)+hour/12)},
+		// Samples from the future.
+		{meta: newMeta(id, int64(created)-hour, int64(created)+hour), outsider: true},
+		// Compacted block with older sources.
+		{meta: newMeta(id, int64(created)-8*hour, int64(created)-2*hour, ulid.MustNew(created-1000, nil), ulid.MustNew(created-2000, nil))},
+		// Compacted block created before one of its sources.
+		{meta: newMeta(id, int64(created)-8*hour, int64(created)-2*hour, ulid.MustNew(created-1000, nil), ulid.MustNew(created+1000, nil)), outsider: true},
+	} {
+		_, ok := outsider(tcase.meta)
+		testutil.Equals(t, tcase.outsider, ok)
+	}
+}
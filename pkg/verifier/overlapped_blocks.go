@@ -2,12 +2,14 @@ package verifier
 
 import (
 	"context"
+	"fmt"
+	"path"
 
 	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/log/level"
 	"github.com/improbable-eng/thanos/pkg/block"
 	"github.com/improbable-eng/thanos/pkg/compact"
 	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/prometheus/tsdb"
 )
@@ -16,56 +18,87 @@ const OverlappedBlocksIssueID = "overlapped_blocks"
 
 // OverlappedBlocksIssue checks bucket for blocks with overlapped time ranges.
 // No repair is available for this issue.
-func OverlappedBlocksIssue(ctx context.Context, logger log.Logger, bkt objstore.Bucket, _ objstore.Bucket, repair bool) error {
-	level.Info(logger).Log("msg", "started verifying issue", "with-repair", repair, "issue", OverlappedBlocksIssueID)
+var OverlappedBlocksIssue = Issue{
+	ID:          OverlappedBlocksIssueID,
+	Description: "blocks of the same compaction group with overlapping time ranges",
+	Verify:      verifyOverlappedBlocks,
+}
 
+func verifyOverlappedBlocks(ctx context.Context, _ log.Logger, bkt objstore.BucketReader) (res []Finding, err error) {
 	overlaps, err := fetchOverlaps(ctx, bkt)
 	if err != nil {
-		return errors.Wrap(err, OverlappedBlocksIssueID)
+		return nil, err
 	}
 
-	if len(overlaps) == 0 {
-		// All good.
-		return nil
+	for k, o := range overlaps {
+		for r, blocks := range o {
+			res = append(res, Finding{
+				Issue:   OverlappedBlocksIssueID,
+				Group:   k,
+				Blocks:  metaULIDs(blocks),
+				Details: fmt.Sprintf("overlapped blocks in range [%d, %d): %s", r.Min, r.Max, sprintMetas(blocks)),
+			})
+		}
 	}
+	return res, nil
+}
 
-	for k, o := range overlaps {
-		level.Warn(logger).Log("msg", "found overlapped blocks", "group", k, "overlap", o)
+func fetchOverlaps(ctx context.Context, bkt objstore.BucketReader) (map[string]tsdb.Overlaps, error) {
+	ms, err := fetchMetas(ctx, bkt)
+	if err != nil {
+		return nil, err
+	}
+
+	metas := map[string][]tsdb.BlockMeta{}
+	for _, m := range ms {
+		metas[compact.GroupKey(m)] = append(metas[compact.GroupKey(m)], m.BlockMeta)
 	}
 
-	if repair {
-		level.Warn(logger).Log("msg", "repair is not implemented for this issue", "issue", OverlappedBlocksIssueID)
+	overlaps := map[string]tsdb.Overlaps{}
+	for k, groupMetas := range metas {
+		o := tsdb.OverlappingBlocks(groupMetas)
+		if len(o) > 0 {
+			overlaps[k] = o
+		}
 	}
-	return nil
+
+	return overlaps, nil
 }
 
-func fetchOverlaps(ctx context.Context, bkt objstore.Bucket) (map[string]tsdb.Overlaps, error) {
-	metas := map[string][]tsdb.BlockMeta{}
-	err := bkt.Iter(ctx, "", func(name string) error {
+// fetchMetas returns metas of all blocks in the bucket. Blocks without meta file are skipped.
+func fetchMetas(ctx context.Context, bkt objstore.BucketReader) (metas []block.Meta, err error) {
+	err = bkt.Iter(ctx, "", func(name string) error {
 		id, ok := block.IsBlockDir(name)
 		if !ok {
 			return nil
 		}
 
+		ok, err := bkt.Exists(ctx, path.Join(id.String(), block.MetaFilename))
+		if err != nil {
+			return errors.Wrapf(err, "check meta file for %s", id)
+		}
+		if !ok {
+			// Partial upload, reported by the missing meta issue.
+			return nil
+		}
+
 		m, err := block.DownloadMeta(ctx, bkt, id)
 		if err != nil {
 			return err
 		}
-
-		metas[compact.GroupKey(m)] = append(metas[compact.GroupKey(m)], m.BlockMeta)
+		metas = append(metas, m)
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	return metas, nil
+}
 
-	overlaps := map[string]tsdb.Overlaps{}
-	for k, groupMetas := range metas {
-		o := tsdb.OverlappingBlocks(groupMetas)
-		if len(o) > 0 {
-			overlaps[k] = o
-		}
+func metaULIDs(ms []tsdb.BlockMeta) []ulid.ULID {
+	res := make([]ulid.ULID, 0, len(ms))
+	for _, m := range ms {
+		res = append(res, m.ULID)
 	}
-
-	return overlaps, nil
+	return res
 }
@@ -2,16 +2,96 @@ package verifier
 
 import (
 	"context"
+	"fmt"
+	"sort"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 )
 
-// Issue is an function that does verification and repair only if repair arg is true.
-// It should log affected blocks using warn level logs. It should be safe for issue to run on healthy bucket.
-type Issue func(ctx context.Context, logger log.Logger, bkt objstore.Bucket, backupBkt objstore.Bucket, repair bool) error
+// Finding is a single problem detected by an issue.
+type Finding struct {
+	// Issue is the ID of the issue that reported the finding.
+	Issue string `json:"issue"`
+	// Group is the compaction group of the affected blocks, if known.
+	Group string `json:"group,omitempty"`
+	// Blocks affected by the finding.
+	Blocks []ulid.ULID `json:"blocks"`
+	// Details is a human readable description of the finding.
+	Details string `json:"details"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s (blocks: %v)", f.Issue, f.Details, f.Blocks)
+}
+
+// VerifyFunc checks the bucket and returns all findings. It should be safe to run on healthy bucket.
+type VerifyFunc func(ctx context.Context, logger log.Logger, bkt objstore.BucketReader) ([]Finding, error)
+
+// RepairFunc attempts to repair the given findings of its issue. Blocks are never deleted directly, but marked
+// for deletion, so they are backed up into the backup bucket, if any, and removed by the bucket cleanup command.
+type RepairFunc func(ctx context.Context, logger log.Logger, bkt objstore.Bucket, backupBkt objstore.Bucket, findings []Finding) error
+
+// Issue is a named check of the bucket health.
+type Issue struct {
+	ID          string
+	Description string
+	Verify      VerifyFunc
+	// Repair is nil if no repair is available for the issue.
+	Repair RepairFunc
+}
+
+// Registry holds issues by their ID.
+type Registry map[string]Issue
+
+// DefaultRegistry contains all issues known to the verifier.
+var DefaultRegistry = Registry{}
+
+func init() {
+	DefaultRegistry.Register(
+		MissingMetaIssue,
+		IndexKnownIssues,
+		OverlappedBlocksIssue,
+		DuplicatedCompactionIssue,
+		OutsiderBlocksIssue,
+	)
+}
+
+// Register adds issues to the registry. It panics if an issue with the same ID is already registered.
+func (r Registry) Register(issues ...Issue) {
+	for _, i := range issues {
+		if _, ok := r[i.ID]; ok {
+			panic(fmt.Sprintf("issue %s registered twice", i.ID))
+		}
+		r[i.ID] = i
+	}
+}
+
+// IDs returns sorted IDs of all registered issues.
+func (r Registry) IDs() []string {
+	ids := make([]string, 0, len(r))
+	for id := range r {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Get returns issues for the given IDs in the same order.
+func (r Registry) Get(ids ...string) ([]Issue, error) {
+	var res []Issue
+	for _, id := range ids {
+		i, ok := r[id]
+		if !ok {
+			return nil, errors.Errorf("no such issue %s, possible values: %v", id, r.IDs())
+		}
+		res = append(res, i)
+	}
+	return res, nil
+}
 
 // Verifier runs given issues to verify if bucket is healthy.
 type Verifier struct {
@@ -43,8 +123,9 @@ func NewWithRepair(logger log.Logger, bkt objstore.Bucket, backupBkt objstore.Bu
 	}
 }
 
-// Verify verifies registered issues.
-func (v *Verifier) Verify(ctx context.Context) error {
+// Verify verifies registered issues and returns all findings. If repair is enabled, findings of
+// issues that support repair are repaired after they were reported.
+func (v *Verifier) Verify(ctx context.Context) ([]Finding, error) {
 	level.Warn(v.logger).Log(
 		"msg", "GLOBAL COMPACTOR SHOULD __NOT__ BE RUNNING ON THE SAME BUCKET",
 		"issues", len(v.issues),
@@ -52,18 +133,40 @@ func (v *Verifier) Verify(ctx context.Context) error {
 	)
 
 	if len(v.issues) == 0 {
-		return errors.New("nothing to verify. No issue registered")
+		return nil, errors.New("nothing to verify. No issue registered")
 	}
 
 	// TODO(blotka): Wrap bucket with BucketWithMetrics and print metrics after each issue (e.g how many blocks where touched).
 	// TODO(bplotka): Implement disk "bucket" to allow this verify to work on local disk space as well.
-	for _, issueFn := range v.issues {
-		err := issueFn(ctx, v.logger, v.bkt, v.backupBkt, v.repair)
+	var res []Finding
+	for _, issue := range v.issues {
+		logger := log.With(v.logger, "issue", issue.ID)
+		level.Info(logger).Log("msg", "started verifying issue", "with-repair", v.repair)
+
+		findings, err := issue.Verify(ctx, logger, v.bkt)
 		if err != nil {
-			return errors.Wrap(err, "verify")
+			return nil, errors.Wrapf(err, "verify %s", issue.ID)
+		}
+		for _, f := range findings {
+			level.Warn(logger).Log("msg", "detected issue", "group", f.Group, "blocks", fmt.Sprintf("%v", f.Blocks), "details", f.Details)
+		}
+		res = append(res, findings...)
+
+		level.Info(logger).Log("msg", "verified issue", "findings", len(findings))
+
+		if !v.repair || len(findings) == 0 {
+			continue
+		}
+		if issue.Repair == nil {
+			level.Warn(logger).Log("msg", "repair is not implemented for this issue")
+			continue
+		}
+		if err := issue.Repair(ctx, logger, v.bkt, v.backupBkt, findings); err != nil {
+			return nil, errors.Wrapf(err, "repair %s", issue.ID)
 		}
+		level.Info(logger).Log("msg", "repaired issue", "findings", len(findings))
 	}
 
-	level.Info(v.logger).Log("msg", "verify completed", "issues", len(v.issues), "repair", v.repair)
-	return nil
+	level.Info(v.logger).Log("msg", "verify completed", "issues", len(v.issues), "findings", len(res), "repair", v.repair)
+	return res, nil
 }
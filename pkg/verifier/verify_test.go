@@ -0,0 +1,57 @@
+package verifier
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/objstore/inmem"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/oklog/ulid"
+)
+
+func TestRegistry(t *testing.T) {
+	r := Registry{}
+	r.Register(MissingMetaIssue, OverlappedBlocksIssue)
+
+	testutil.Equals(t, []string{MissingMetaIssueID, OverlappedBlocksIssueID}, r.IDs())
+
+	issues, err := r.Get(OverlappedBlocksIssueID, MissingMetaIssueID)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(issues))
+	testutil.Equals(t, OverlappedBlocksIssueID, issues[0].ID)
+	testutil.Equals(t, MissingMetaIssueID, issues[1].ID)
+
+	_, err = r.Get("unknown")
+	testutil.NotOk(t, err)
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+
+	id := ulid.MustNew(1, nil)
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), block.IndexFilename), bytes.NewReader([]byte("index"))))
+
+	var repaired []Finding
+	issue := MissingMetaIssue
+	issue.Repair = func(_ context.Context, _ log.Logger, _ objstore.Bucket, _ objstore.Bucket, findings []Finding) error {
+		repaired = findings
+		return nil
+	}
+	expected := []Finding{{Issue: MissingMetaIssueID, Blocks: []ulid.ULID{id}, Details: "block without meta file"}}
+
+	findings, err := New(log.NewNopLogger(), bkt, []Issue{issue}).Verify(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, expected, findings)
+	testutil.Equals(t, 0, len(repaired))
+
+	findings, err = NewWithRepair(log.NewNopLogger(), bkt, inmem.NewBucket(), []Issue{issue}).Verify(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, expected, findings)
+	testutil.Equals(t, expected, repaired)
+}
@@ -37,3 +37,15 @@ for dir in ${DIRS}; do
 		goimports -w *.pb.go
 	popd
 done
+
+# Info API refers to types of the Store API, so their Go package has to be mapped explicitly.
+pushd pkg/info/infopb
+	protoc --gogofast_out=plugins=grpc,Mtypes.proto=github.com/improbable-eng/thanos/pkg/store/storepb:. -I=. \
+		-I="${GOGOPROTO_PATH}" \
+		-I="${PROM_PATH}" \
+		*.proto
+
+	sed -i.bak -E 's/import _ \"gogoproto\"//g' *.pb.go
+	rm -f *.bak
+	goimports -w *.pb.go
+popd
@@ -1,7 +1,7 @@
 #!/usr/bin/env bash
 #
 # Starts three Prometheus servers scraping themselves and sidecars for each.
-# Two query nodes are started and all are clustered together.
+# Two query nodes are started and query all sidecars and the store node.
 
 trap 'kill 0' SIGTERM
 
@@ -86,16 +86,15 @@ do
     --http-address              0.0.0.0:1919${i} \
     --prometheus.url            http://localhost:909${i} \
     --tsdb.path                 data/prom${i} \
-    --gcs.bucket                "${GCS_BUCKET}" \
-    --cluster.address           0.0.0.0:1939${i} \
-    --cluster.advertise-address 127.0.0.1:1939${i} \
-    --cluster.peers             127.0.0.1:19391 &
+    --gcs.bucket                "${GCS_BUCKET}" &
 
   sleep 0.25
 done
 
 sleep 0.5
 
+STORES="--store 127.0.0.1:19091 --store 127.0.0.1:19092 --store 127.0.0.1:19093"
+
 if [ -n "${GCS_BUCKET}" -o -n "${S3_ENDPOINT}" ]
 then
   thanos store \
@@ -104,10 +103,9 @@ then
     --grpc-address              0.0.0.0:19691 \
     --http-address              0.0.0.0:19791 \
     --tsdb.path                 data/store \
-    --gcs.bucket                "${GCS_BUCKET}" \
-    --cluster.address           0.0.0.0:19891 \
-    --cluster.advertise-address 127.0.0.1:19891 \
-    --cluster.peers             127.0.0.1:19391 &
+    --gcs.bucket                "${GCS_BUCKET}" &
+
+  STORES="${STORES} --store 127.0.0.1:19691"
 fi
 
 sleep 0.5
@@ -119,9 +117,7 @@ do
     --debug.name                query-${i} \
     --grpc-address              0.0.0.0:1999${i} \
     --http-address              0.0.0.0:1949${i} \
-    --cluster.address           0.0.0.0:1959${i} \
-    --cluster.advertise-address 127.0.0.1:1959${i} \
-    --cluster.peers             127.0.0.1:19391 &
+    ${STORES} &
 done
 
 wait
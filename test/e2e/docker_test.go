@@ -0,0 +1,137 @@
+package e2e_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/runutil"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/improbable-eng/thanos/test/e2e/e2edocker"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/tsdb/labels"
+)
+
+// TestDockerQueryStoreAndSidecars runs HA Prometheus pairs with sidecars, a store gateway serving synthetic blocks
+// from a MinIO bucket and a query node in containers, and verifies that queries return deduplicated data from all of them.
+func TestDockerQueryStoreAndSidecars(t *testing.T) {
+	env, err := e2edocker.NewEnvironment(t, "query_store")
+	testutil.Ok(t, err)
+	defer env.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	minio, err := env.NewMinio("minio", "thanos")
+	testutil.Ok(t, err)
+	testutil.Ok(t, minio.Start(ctx))
+
+	// Blocks of the same data uploaded by two replicas.
+	bkt, err := minio.HostBucket()
+	testutil.Ok(t, err)
+	now := time.Now()
+	series := []labels.Labels{labels.FromStrings("__name__", "synthetic", "a", "1")}
+	for _, replica := range []string{"0", "1"} {
+		_, err := e2edocker.UploadSyntheticBlock(ctx, bkt, series, 100,
+			timestamp.FromTime(now.Add(-2*time.Hour)), timestamp.FromTime(now),
+			labels.FromStrings("prometheus", "synthetic", "replica", replica), 0)
+		testutil.Ok(t, err)
+	}
+
+	stores := []*e2edocker.Service{}
+	for _, replica := range []string{"0", "1"} {
+		prom, sidecar, err := env.NewPrometheusWithSidecar("prom-"+replica, fmt.Sprintf(`
+global:
+  external_labels:
+    prometheus: prom-ha
+    replica: %s
+scrape_configs:
+- job_name: prometheus
+  scrape_interval: 1s
+  static_configs:
+  - targets:
+    - "localhost:%d"
+`, replica, e2edocker.PrometheusPort), minio)
+		testutil.Ok(t, err)
+		testutil.Ok(t, prom.Start(ctx))
+		testutil.Ok(t, sidecar.Start(ctx))
+		stores = append(stores, sidecar)
+	}
+
+	store, err := env.NewStore("store", minio)
+	testutil.Ok(t, err)
+	testutil.Ok(t, store.Start(ctx))
+	stores = append(stores, store)
+
+	querier := env.NewQuerier("querier", "replica", stores...)
+	testutil.Ok(t, querier.Start(ctx))
+
+	for _, tcase := range []struct {
+		query string
+		dedup bool
+		// Time of the query, the current time if zero.
+		ts       time.Time
+		expected []string
+	}{
+		{
+			query: "up",
+			expected: []string{
+				`{__name__="up", instance="localhost:9090", job="prometheus", prometheus="prom-ha", replica="0"}`,
+				`{__name__="up", instance="localhost:9090", job="prometheus", prometheus="prom-ha", replica="1"}`,
+			},
+		},
+		{
+			query:    "up",
+			dedup:    true,
+			expected: []string{`{__name__="up", instance="localhost:9090", job="prometheus", prometheus="prom-ha"}`},
+		},
+		{
+			query: "synthetic",
+			// The last sample of the synthetic blocks is a few minutes old.
+			ts: now.Add(-time.Minute),
+			expected: []string{
+				`{__name__="synthetic", a="1", prometheus="synthetic", replica="0"}`,
+				`{__name__="synthetic", a="1", prometheus="synthetic", replica="1"}`,
+			},
+		},
+		{
+			query:    "synthetic",
+			dedup:    true,
+			ts:       now.Add(-time.Minute),
+			expected: []string{`{__name__="synthetic", a="1", prometheus="synthetic"}`},
+		},
+	} {
+		// Data from stores shows up once they are discovered and synced.
+		testutil.Ok(t, runutil.Retry(time.Second, ctx.Done(), func() error {
+			ts := tcase.ts
+			if ts.IsZero() {
+				ts = time.Now()
+			}
+			res, err := e2edocker.Query(ctx, querier, e2edocker.HTTPPort, tcase.query, ts, tcase.dedup)
+			if err != nil {
+				return err
+			}
+			return expectSeries(res, tcase.expected)
+		}))
+	}
+}
+
+// expectSeries returns an error if the vector does not consist of exactly the given series.
+func expectSeries(res promql.Vector, expected []string) error {
+	var got []string
+	for _, s := range res {
+		got = append(got, s.Metric.String())
+	}
+	if len(got) != len(expected) {
+		return errors.Errorf("unexpected result %v, expected %v", got, expected)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			return errors.Errorf("unexpected result %v, expected %v", got, expected)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package e2edocker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/improbable-eng/thanos/pkg/block"
+	"github.com/improbable-eng/thanos/pkg/objstore"
+	"github.com/improbable-eng/thanos/pkg/testutil"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/tsdb/labels"
+)
+
+// UploadSyntheticBlock creates a block with the given series, each with numSamples random samples in
+// the time range [mint, maxt), and uploads it into the bucket.
+func UploadSyntheticBlock(
+	ctx context.Context,
+	bkt objstore.Bucket,
+	series []labels.Labels,
+	numSamples int,
+	mint, maxt int64,
+	extLset labels.Labels,
+	resolution int64,
+) (ulid.ULID, error) {
+	dir, err := ioutil.TempDir("", "e2e-block")
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "create temporary dir")
+	}
+	defer os.RemoveAll(dir)
+
+	id, err := testutil.CreateBlock(dir, series, numSamples, mint, maxt, extLset, resolution)
+	if err != nil {
+		return id, errors.Wrap(err, "create block")
+	}
+	if err := block.Upload(ctx, bkt, filepath.Join(dir, id.String())); err != nil {
+		return id, errors.Wrapf(err, "upload block %s", id)
+	}
+	return id, nil
+}
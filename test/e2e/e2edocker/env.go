@@ -0,0 +1,234 @@
+// Package e2edocker runs Thanos components, Prometheus and MinIO in Docker containers connected through
+// a dedicated network, so end-to-end tests can exercise features spanning multiple components, e.g.
+// deduplication or downsampling, against a realistic setup.
+//
+// Tests using it are skipped unless the Thanos image to test is given in the THANOS_E2E_IMAGE environment
+// variable, e.g. the one built by 'make docker'.
+package e2edocker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/runutil"
+	"github.com/pkg/errors"
+)
+
+// ThanosImageEnvVar is the environment variable holding the Thanos image to test.
+const ThanosImageEnvVar = "THANOS_E2E_IMAGE"
+
+// Environment is a Docker network with services running in it. Files shared with containers are
+// kept in a temporary directory on the host.
+type Environment struct {
+	t           testing.TB
+	name        string
+	dir         string
+	thanosImage string
+
+	services []*Service
+}
+
+// NewEnvironment creates a Docker network for the test. The test is skipped if no Thanos image is given.
+func NewEnvironment(t testing.TB, name string) (*Environment, error) {
+	image := os.Getenv(ThanosImageEnvVar)
+	if image == "" {
+		t.Skipf("test can only run with a Thanos image given in %s", ThanosImageEnvVar)
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		return nil, errors.Wrap(err, "find docker binary")
+	}
+
+	dir, err := ioutil.TempDir("", "e2e_"+name)
+	if err != nil {
+		return nil, errors.Wrap(err, "create temporary dir")
+	}
+	e := &Environment{
+		t:           t,
+		name:        "e2e_" + name,
+		dir:         dir,
+		thanosImage: image,
+	}
+	// Remove leftovers of previous runs that were not closed properly.
+	docker("network", "rm", e.name)
+	if _, err := docker("network", "create", e.name); err != nil {
+		os.RemoveAll(dir)
+		return nil, errors.Wrapf(err, "create network %s", e.name)
+	}
+	return e, nil
+}
+
+// Dir returns the directory shared with containers.
+func (e *Environment) Dir() string {
+	return e.dir
+}
+
+// Close stops all services and removes the network. Logs of all services are written to
+// the test log if the test failed.
+func (e *Environment) Close() {
+	for _, s := range e.services {
+		if e.t.Failed() {
+			logs, err := s.Logs()
+			if err != nil {
+				e.t.Logf("get logs of %s: %v", s.Name, err)
+			}
+			e.t.Logf("%s LOGS\n%s", s.Name, logs)
+		}
+		if err := s.Stop(); err != nil {
+			e.t.Logf("stop %s: %v", s.Name, err)
+		}
+	}
+	if _, err := docker("network", "rm", e.name); err != nil {
+		e.t.Logf("remove network %s: %v", e.name, err)
+	}
+	os.RemoveAll(e.dir)
+}
+
+// Service is a container running in the environment. Other containers reach it through its name
+// and the container ports, the host through the ports published on the loopback interface.
+type Service struct {
+	Name string
+
+	env       *Environment
+	image     string
+	args      []string
+	envVars   []string
+	volumes   map[string]string
+	ports     []int
+	readyPath string
+	readyPort int
+	running   bool
+}
+
+// NewService returns a new service running the image with the given arguments. The ports are published to the host.
+// The service is considered ready once the HTTP path on the ready port returns 200. No readiness is checked if the path is empty.
+func (e *Environment) NewService(name, image string, args []string, ports []int, readyPort int, readyPath string) *Service {
+	s := &Service{
+		Name:      name,
+		env:       e,
+		image:     image,
+		args:      args,
+		volumes:   map[string]string{},
+		ports:     ports,
+		readyPath: readyPath,
+		readyPort: readyPort,
+	}
+	e.services = append(e.services, s)
+	return s
+}
+
+// SetEnv sets an environment variable in the container. It must be called before Start.
+func (s *Service) SetEnv(name, value string) {
+	s.envVars = append(s.envVars, name+"="+value)
+}
+
+// Mount mounts the host directory into the container. It must be called before Start.
+func (s *Service) Mount(hostDir, containerDir string) {
+	s.volumes[hostDir] = containerDir
+}
+
+func (s *Service) containerName() string {
+	return s.env.name + "-" + s.Name
+}
+
+// Start starts the container and waits until it is ready.
+func (s *Service) Start(ctx context.Context) error {
+	args := []string{"run", "-d",
+		"--name", s.containerName(),
+		"--network", s.env.name,
+		"--network-alias", s.Name,
+	}
+	for _, v := range s.envVars {
+		args = append(args, "-e", v)
+	}
+	for host, container := range s.volumes {
+		args = append(args, "-v", host+":"+container)
+	}
+	for _, p := range s.ports {
+		args = append(args, "-p", fmt.Sprintf("127.0.0.1::%d", p))
+	}
+	args = append(args, s.image)
+	args = append(args, s.args...)
+
+	// Remove leftovers of previous runs that were not closed properly.
+	docker("rm", "-f", s.containerName())
+	if _, err := docker(args...); err != nil {
+		return errors.Wrapf(err, "start %s", s.Name)
+	}
+	s.running = true
+	return s.WaitReady(ctx)
+}
+
+// WaitReady waits until the ready path of the service returns 200.
+func (s *Service) WaitReady(ctx context.Context) error {
+	if s.readyPath == "" {
+		return nil
+	}
+	addr, err := s.HostAddr(s.readyPort)
+	if err != nil {
+		return err
+	}
+	err = runutil.Retry(time.Second, ctx.Done(), func() error {
+		resp, err := http.Get("http://" + addr + s.readyPath)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return errors.Errorf("status code %d", resp.StatusCode)
+		}
+		return nil
+	})
+	return errors.Wrapf(err, "wait for %s to be ready", s.Name)
+}
+
+// HostAddr returns the address of the container port published on the host.
+func (s *Service) HostAddr(port int) (string, error) {
+	out, err := docker("port", s.containerName(), fmt.Sprintf("%d/tcp", port))
+	if err != nil {
+		return "", errors.Wrapf(err, "get published port %d of %s", port, s.Name)
+	}
+	// Multiple lines are returned if the port is published on IPv4 and IPv6.
+	return strings.TrimSpace(strings.Split(out, "\n")[0]), nil
+}
+
+// NetworkAddr returns the address of the container port inside the Docker network.
+func (s *Service) NetworkAddr(port int) string {
+	return fmt.Sprintf("%s:%d", s.Name, port)
+}
+
+// Logs returns the output of the container.
+func (s *Service) Logs() (string, error) {
+	return docker("logs", s.containerName())
+}
+
+// Stop removes the container. It is a no-op if the service is not running.
+func (s *Service) Stop() error {
+	if !s.running {
+		return nil
+	}
+	if _, err := docker("rm", "-f", "-v", s.containerName()); err != nil {
+		return errors.Wrapf(err, "stop %s", s.Name)
+	}
+	s.running = false
+	return nil
+}
+
+// docker runs the docker CLI and returns its combined output.
+func docker(args ...string) (string, error) {
+	var out bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return out.String(), errors.Wrapf(err, "docker %s: %s", strings.Join(args, " "), out.String())
+	}
+	return out.String(), nil
+}
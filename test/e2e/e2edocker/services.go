@@ -0,0 +1,201 @@
+package e2edocker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/improbable-eng/thanos/pkg/objstore/s3"
+	"github.com/improbable-eng/thanos/pkg/promclient"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/promql"
+)
+
+const (
+	// PrometheusImage is the Prometheus image run next to sidecars.
+	PrometheusImage = "quay.io/prometheus/prometheus:v2.3.2"
+	// MinioImage is the MinIO image providing the S3 compatible bucket.
+	MinioImage = "minio/minio:RELEASE.2018-08-02T23-11-36Z"
+
+	// GRPCPort is the gRPC port of Thanos components.
+	GRPCPort = 10901
+	// HTTPPort is the HTTP port of Thanos components.
+	HTTPPort = 10902
+	// PrometheusPort is the HTTP port of Prometheus.
+	PrometheusPort = 9090
+	// MinioPort is the port of the MinIO S3 API.
+	MinioPort = 9000
+
+	minioAccessKey = "thanos"
+	minioSecretKey = "thanos-secret-key"
+)
+
+// NewThanos returns a service running the Thanos image with the given command and arguments. It is ready
+// once the component reports readiness on its HTTP port.
+func (e *Environment) NewThanos(name, command string, args ...string) *Service {
+	args = append([]string{command,
+		"--debug.name", name,
+		"--log.level", "debug",
+		"--grpc-address", fmt.Sprintf("0.0.0.0:%d", GRPCPort),
+		"--http-address", fmt.Sprintf("0.0.0.0:%d", HTTPPort),
+	}, args...)
+	return e.NewService(name, e.thanosImage, args, []int{GRPCPort, HTTPPort}, HTTPPort, "/-/ready")
+}
+
+// newDir creates a directory in the shared directory which is writable by any user in containers.
+func (e *Environment) newDir(elem ...string) (string, error) {
+	dir := filepath.Join(append([]string{e.dir}, elem...)...)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", errors.Wrapf(err, "create dir %s", dir)
+	}
+	// Ignore the umask, Prometheus does not run as root.
+	return dir, os.Chmod(dir, 0777)
+}
+
+// Minio is a MinIO server with a single bucket.
+type Minio struct {
+	*Service
+	Bucket string
+}
+
+// NewMinio returns a MinIO server with the given bucket created.
+func (e *Environment) NewMinio(name, bucket string) (*Minio, error) {
+	dir, err := e.newDir(name)
+	if err != nil {
+		return nil, err
+	}
+	// MinIO serves top-level directories as buckets.
+	if _, err := e.newDir(name, bucket); err != nil {
+		return nil, err
+	}
+	s := e.NewService(name, MinioImage, []string{"server", "/data"}, []int{MinioPort}, MinioPort, "/minio/health/ready")
+	s.Mount(dir, "/data")
+	s.SetEnv("MINIO_ACCESS_KEY", minioAccessKey)
+	s.SetEnv("MINIO_SECRET_KEY", minioSecretKey)
+	return &Minio{Service: s, Bucket: bucket}, nil
+}
+
+// configure sets the flags and environment of a Thanos component to use the bucket.
+func (m *Minio) configure(s *Service) {
+	s.args = append(s.args,
+		"--s3.bucket", m.Bucket,
+		"--s3.endpoint", m.NetworkAddr(MinioPort),
+		"--s3.access-key", minioAccessKey,
+		"--s3.insecure",
+	)
+	s.SetEnv("S3_SECRET_KEY", minioSecretKey)
+}
+
+// HostBucket returns a client of the bucket reachable from the host, e.g. to upload blocks.
+// The service must be started.
+func (m *Minio) HostBucket() (*s3.Bucket, error) {
+	addr, err := m.HostAddr(MinioPort)
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewBucket(&s3.Config{
+		Bucket:    m.Bucket,
+		Endpoint:  addr,
+		AccessKey: minioAccessKey,
+		SecretKey: minioSecretKey,
+		Insecure:  true,
+	}, nil, "e2e")
+}
+
+// NewPrometheusWithSidecar returns a Prometheus server with the given configuration and a sidecar sharing
+// its data directory. Blocks are uploaded to the bucket if it is not nil. Blocks are cut every two hours,
+// as required by the sidecar, and the admin APIs are enabled.
+func (e *Environment) NewPrometheusWithSidecar(name, config string, bkt *Minio) (prom *Service, sidecar *Service, err error) {
+	dir, err := e.newDir(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	dataDir, err := e.newDir(name, "data")
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "prometheus.yml"), []byte(config), 0666); err != nil {
+		return nil, nil, errors.Wrap(err, "write Prometheus config")
+	}
+
+	prom = e.NewService(name, PrometheusImage, []string{
+		"--config.file", "/etc/prometheus/prometheus.yml",
+		"--storage.tsdb.path", "/prometheus",
+		"--storage.tsdb.min-block-duration", "2h",
+		"--storage.tsdb.max-block-duration", "2h",
+		"--web.listen-address", fmt.Sprintf("0.0.0.0:%d", PrometheusPort),
+		"--web.enable-admin-api",
+		"--web.enable-lifecycle",
+		"--log.level", "info",
+	}, []int{PrometheusPort}, PrometheusPort, "/-/ready")
+	prom.Mount(filepath.Join(dir, "prometheus.yml"), "/etc/prometheus/prometheus.yml")
+	prom.Mount(dataDir, "/prometheus")
+
+	sidecar = e.NewThanos(name+"-sidecar", "sidecar",
+		"--prometheus.url", "http://"+prom.NetworkAddr(PrometheusPort),
+		"--tsdb.path", "/prometheus",
+	)
+	sidecar.Mount(dataDir, "/prometheus")
+	if bkt != nil {
+		bkt.configure(sidecar)
+	}
+	return prom, sidecar, nil
+}
+
+// NewStore returns a store gateway serving blocks of the bucket.
+func (e *Environment) NewStore(name string, bkt *Minio, args ...string) (*Service, error) {
+	dir, err := e.newDir(name)
+	if err != nil {
+		return nil, err
+	}
+	s := e.NewThanos(name, "store", append([]string{"--tsdb.path", "/data"}, args...)...)
+	s.Mount(dir, "/data")
+	bkt.configure(s)
+	return s, nil
+}
+
+// NewCompactor returns a compactor continuously processing blocks of the bucket.
+func (e *Environment) NewCompactor(name string, bkt *Minio, args ...string) (*Service, error) {
+	dir, err := e.newDir(name)
+	if err != nil {
+		return nil, err
+	}
+	args = append([]string{"compact",
+		"--debug.name", name,
+		"--log.level", "debug",
+		"--http-address", fmt.Sprintf("0.0.0.0:%d", HTTPPort),
+		"--data-dir", "/data",
+		"--wait",
+	}, args...)
+	s := e.NewService(name, e.thanosImage, args, []int{HTTPPort}, HTTPPort, "/-/ready")
+	s.Mount(dir, "/data")
+	bkt.configure(s)
+	return s, nil
+}
+
+// NewQuerier returns a query node using the given store API servers, given by their gRPC network address.
+func (e *Environment) NewQuerier(name, replicaLabel string, stores ...*Service) *Service {
+	args := []string{"--query.replica-label", replicaLabel}
+	for _, st := range stores {
+		args = append(args, "--store", st.NetworkAddr(GRPCPort))
+	}
+	return e.NewThanos(name, "query", args...)
+}
+
+// Query runs an instant query against the HTTP API of the service, e.g. a query node or Prometheus,
+// on the given port.
+func Query(ctx context.Context, s *Service, port int, q string, t time.Time, dedup bool) (promql.Vector, error) {
+	addr, err := s.HostAddr(port)
+	if err != nil {
+		return nil, err
+	}
+	c, err := promclient.NewClient(nil, nil, "e2e", nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.QueryInstant(ctx, &url.URL{Scheme: "http", Host: addr}, q, t, promclient.QueryOptions{Deduplicate: dedup})
+}
@@ -21,17 +21,14 @@ var (
 	// We keep this one with localhost, to have perfect match with what Prometheus will expose in up metric.
 	promHTTP = func(i int) string { return fmt.Sprintf("localhost:%s", promHTTPPort(i)) }
 
-	sidecarGRPC    = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19090+i) }
-	sidecarHTTP    = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19190+i) }
-	sidecarCluster = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19390+i) }
+	sidecarGRPC = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19090+i) }
+	sidecarHTTP = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19190+i) }
 
-	queryGRPC    = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19490+i) }
-	queryHTTP    = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19590+i) }
-	queryCluster = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19690+i) }
+	queryGRPC = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19490+i) }
+	queryHTTP = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19590+i) }
 
-	rulerGRPC    = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19790+i) }
-	rulerHTTP    = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19890+i) }
-	rulerCluster = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19990+i) }
+	rulerGRPC = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19790+i) }
+	rulerHTTP = func(i int) string { return fmt.Sprintf("127.0.0.1:%d", 19890+i) }
 )
 
 type config struct {
@@ -46,26 +43,30 @@ type config struct {
 	numAlertmanagers    int
 }
 
-func evalClusterPeersFlags(cfg config) []string {
+// storeFlags returns --store flags with addresses of all sidecars and rulers.
+func storeFlags(cfg config) []string {
 	var flags []string
 	for i := 1; i <= len(cfg.promConfigs); i++ {
-		flags = append(flags, "--cluster.peers", sidecarCluster(i))
-	}
-	for i := 1; i <= cfg.numQueries; i++ {
-		flags = append(flags, "--cluster.peers", queryCluster(i))
+		flags = append(flags, "--store", sidecarGRPC(i))
 	}
 	for i := 1; i <= cfg.numRules; i++ {
-		flags = append(flags, "--cluster.peers", rulerCluster(i))
+		flags = append(flags, "--store", rulerGRPC(i))
+	}
+	return flags
+}
+
+// queryFlags returns --query flags with addresses of all query nodes.
+func queryFlags(cfg config) []string {
+	var flags []string
+	for i := 1; i <= cfg.numQueries; i++ {
+		flags = append(flags, "--query", queryHTTP(i))
 	}
 	return flags
 }
 
 // NOTE: It is important to install Thanos before using this function to compile latest changes.
 func spinup(t testing.TB, ctx context.Context, cfg config) (chan error, error) {
-	var (
-		commands     []*exec.Cmd
-		clusterPeers = evalClusterPeersFlags(cfg)
-	)
+	var commands []*exec.Cmd
 
 	for k, promConfig := range cfg.promConfigs {
 		i := k + 1
@@ -86,20 +87,13 @@ func spinup(t testing.TB, ctx context.Context, cfg config) (chan error, error) {
 			"--web.listen-address", promHTTP(i),
 		))
 		commands = append(commands, exec.Command("thanos",
-			append([]string{
-				"sidecar",
-				"--debug.name", fmt.Sprintf("sidecar-%d", i),
-				"--grpc-address", sidecarGRPC(i),
-				"--http-address", sidecarHTTP(i),
-				"--prometheus.url", fmt.Sprintf("http://%s", promHTTP(i)),
-				"--tsdb.path", promDir,
-				"--cluster.address", sidecarCluster(i),
-				"--cluster.advertise-address", sidecarCluster(i),
-				"--cluster.gossip-interval", "200ms",
-				"--cluster.pushpull-interval", "200ms",
-				"--log.level", "debug",
-			},
-				clusterPeers...)...,
+			"sidecar",
+			"--debug.name", fmt.Sprintf("sidecar-%d", i),
+			"--grpc-address", sidecarGRPC(i),
+			"--http-address", sidecarHTTP(i),
+			"--prometheus.url", fmt.Sprintf("http://%s", promHTTP(i)),
+			"--tsdb.path", promDir,
+			"--log.level", "debug",
 		))
 
 		time.Sleep(200 * time.Millisecond)
@@ -111,14 +105,10 @@ func spinup(t testing.TB, ctx context.Context, cfg config) (chan error, error) {
 				"--debug.name", fmt.Sprintf("query-%d", i),
 				"--grpc-address", queryGRPC(i),
 				"--http-address", queryHTTP(i),
-				"--cluster.address", queryCluster(i),
-				"--cluster.advertise-address", queryCluster(i),
-				"--cluster.gossip-interval", "200ms",
-				"--cluster.pushpull-interval", "200ms",
 				"--log.level", "debug",
 				"--query.replica-label", cfg.queriesReplicaLabel,
 			},
-				clusterPeers...)...,
+				storeFlags(cfg)...)...,
 		))
 		time.Sleep(200 * time.Millisecond)
 	}
@@ -144,13 +134,9 @@ func spinup(t testing.TB, ctx context.Context, cfg config) (chan error, error) {
 				"--alertmanagers.url", "http://127.0.0.1:29093",
 				"--grpc-address", rulerGRPC(i),
 				"--http-address", rulerHTTP(i),
-				"--cluster.address", rulerCluster(i),
-				"--cluster.advertise-address", rulerCluster(i),
-				"--cluster.gossip-interval", "200ms",
-				"--cluster.pushpull-interval", "200ms",
 				"--log.level", "debug",
 			},
-				clusterPeers...)...,
+				queryFlags(cfg)...)...,
 		))
 		time.Sleep(200 * time.Millisecond)
 	}